@@ -0,0 +1,112 @@
+// Package accesslog records one structured entry per proxied connection,
+// describing its client, the backend it was routed to and how its
+// transfer ended.
+package accesslog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Stdout is the destination writing the access log to the standard output.
+const Stdout = "stdout"
+
+// Entry describes a proxied connection.
+type Entry struct {
+	// Time is the time the connection was closed.
+	Time time.Time `json:"time"`
+
+	// ConnectionID is the ID of the connection.
+	ConnectionID string `json:"connection_id"`
+
+	// ClientID and CommonName identify the client.
+	ClientID   string `json:"client_id"`
+	CommonName string `json:"common_name,omitempty"`
+
+	// RemoteAddr is the address the client connected from.
+	RemoteAddr string `json:"remote_addr"`
+
+	// Backend and Pool identify the backend the connection was routed to,
+	// blank if none was.
+	Backend string `json:"backend,omitempty"`
+	Pool    string `json:"pool,omitempty"`
+
+	// Duration is the time the connection was routed for, from the
+	// selection of its backend to its close.
+	Duration time.Duration `json:"duration_ns"`
+
+	// BytesReceived and BytesSent count the data received from and sent
+	// to the client.
+	BytesReceived int64 `json:"bytes_received"`
+	BytesSent     int64 `json:"bytes_sent"`
+
+	// Reason is why the connection was closed.
+	Reason string `json:"reason"`
+
+	// Error describes the error that ended the connection, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// Log writes entries to a destination as JSON lines.
+type Log struct {
+	// mu serializes the writes of entries.
+	mu sync.Mutex
+
+	// out is the destination of the entries.
+	out io.Writer
+
+	// closer closes the destination, nil for the standard output.
+	closer io.Closer
+}
+
+// Open opens the access log destination, either Stdout or the path to a
+// file to append to, created if it does not exist.
+func Open(destination string) (*Log, error) {
+	if destination == "" {
+		return nil, errors.New("access log destination is blank")
+	}
+	if destination == Stdout {
+		return &Log{out: os.Stdout}, nil
+	}
+	file, err := os.OpenFile(destination, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open access log: %w", err)
+	}
+	return &Log{out: file, closer: file}, nil
+}
+
+// New returns an access log writing entries to out.
+func New(out io.Writer) *Log {
+	return &Log{out: out}
+}
+
+// Record writes the entry to the log. Unlike the audit log, entries are
+// not synced to disk, as they are written for every connection.
+func (l *Log) Record(entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("unable to encode access log entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err := l.out.Write(line); err != nil {
+		return fmt.Errorf("unable to write access log entry: %w", err)
+	}
+	return nil
+}
+
+// Close closes the access log file, if any.
+func (l *Log) Close() error {
+	if l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
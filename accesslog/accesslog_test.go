@@ -0,0 +1,75 @@
+package accesslog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecord(t *testing.T) {
+	require := require.New(t)
+	path := filepath.Join(t.TempDir(), "access.log")
+
+	log, err := Open(path)
+	require.NoError(err)
+	require.NoError(log.Record(Entry{
+		Time:          time.Now(),
+		ConnectionID:  "1",
+		ClientID:      "client1",
+		CommonName:    "client1.example.com",
+		RemoteAddr:    "127.0.0.1:40000",
+		Backend:       "127.0.0.1:5001",
+		Pool:          "default",
+		Duration:      time.Second,
+		BytesReceived: 10,
+		BytesSent:     20,
+		Reason:        "client_eof",
+	}))
+	require.NoError(log.Close())
+
+	// Reopening appends to the existing entries
+	log, err = Open(path)
+	require.NoError(err)
+	require.NoError(log.Record(Entry{Time: time.Now(), ConnectionID: "2", ClientID: "client2", Reason: "error", Error: "no backend"}))
+	require.NoError(log.Close())
+
+	file, err := os.Open(path)
+	require.NoError(err)
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry Entry
+		require.NoError(json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	require.Len(entries, 2)
+	require.Equal("127.0.0.1:5001", entries[0].Backend)
+	require.Equal(time.Second, entries[0].Duration)
+	require.Equal(int64(20), entries[0].BytesSent)
+	require.Equal("no backend", entries[1].Error)
+
+	_, err = Open("")
+	require.Error(err)
+}
+
+func TestRecordWriter(t *testing.T) {
+	require := require.New(t)
+
+	var out bytes.Buffer
+	log := New(&out)
+	require.NoError(log.Record(Entry{ConnectionID: "1", ClientID: "client1", Reason: "backend_eof"}))
+	require.NoError(log.Close())
+
+	var entry map[string]any
+	require.NoError(json.Unmarshal(out.Bytes(), &entry))
+	require.Equal("backend_eof", entry["reason"])
+	require.NotContains(entry, "backend")
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rrasulzade/tcp-lb-go/server"
+)
+
+// aclOptions holds the settings of the acl subcommand.
+type aclOptions struct {
+	adminOptions
+
+	// file is the path of the list to import or of the exported list,
+	// "-" meaning the standard input or output.
+	file string
+
+	// dryRun validates and compares an imported list without applying it.
+	dryRun bool
+}
+
+// runACL runs the acl subcommand, which exports the access control list
+// in effect, imports a new one or rolls back the last import through the
+// admin API:
+//
+//	tcp-lb-go acl export [-admin URL] [-file acl.json]
+//	tcp-lb-go acl import [-admin URL] -file acl.json [-dry-run]
+//	tcp-lb-go acl rollback [-admin URL]
+func runACL(args []string) error {
+	if len(args) == 0 || (args[0] != "export" && args[0] != "import" && args[0] != "rollback") {
+		return errors.New("usage: acl export|import|rollback [flags]")
+	}
+	action := args[0]
+
+	var opts aclOptions
+	flags := flag.NewFlagSet("acl "+action, flag.ExitOnError)
+	opts.register(flags)
+	if action != "rollback" {
+		flags.StringVar(&opts.file, "file", "-", "Access control list file, - for standard input or output")
+	}
+	if action == "import" {
+		flags.BoolVar(&opts.dryRun, "dry-run", false, "Validate and compare the list without applying it")
+	}
+	flags.Parse(args[1:])
+
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "export":
+		return exportACL(client, opts)
+	case "rollback":
+		return rollbackACL(client, opts)
+	}
+	return importACL(client, opts)
+}
+
+// exportACL writes the access control list in effect to the file.
+func exportACL(client *http.Client, opts aclOptions) error {
+	body, err := adminRequest(client, opts.adminOptions, http.MethodGet, "/acl", nil)
+	if err != nil {
+		return err
+	}
+
+	var acl map[string][]string
+	if err := json.Unmarshal(body, &acl); err != nil {
+		return fmt.Errorf("invalid admin API response: %w", err)
+	}
+	data, err := json.MarshalIndent(acl, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if opts.file == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(opts.file, data, 0o600)
+}
+
+// importACL submits the access control list of the file and prints its
+// differences to the list in effect.
+func importACL(client *http.Client, opts aclOptions) error {
+	var data []byte
+	var err error
+	if opts.file == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(opts.file)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read access control list: %w", err)
+	}
+
+	path := "/acl"
+	if opts.dryRun {
+		path += "?dry_run=true"
+	}
+	body, err := adminRequest(client, opts.adminOptions, http.MethodPut, path, data)
+	if err != nil {
+		return err
+	}
+
+	var resp aclImportResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("invalid admin API response: %w", err)
+	}
+
+	fmt.Print(formatACLDiff(resp.Diff))
+	switch {
+	case resp.Applied:
+		fmt.Println("Access control list applied")
+	case opts.dryRun:
+		fmt.Println("Dry run, access control list not applied")
+	}
+	return nil
+}
+
+// rollbackACL restores the access control list replaced by the last
+// import and prints its differences to the list it replaces.
+func rollbackACL(client *http.Client, opts aclOptions) error {
+	body, err := adminRequest(client, opts.adminOptions, http.MethodPost, "/acl/rollback", nil)
+	if err != nil {
+		return err
+	}
+
+	var resp aclImportResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("invalid admin API response: %w", err)
+	}
+	fmt.Print(formatACLDiff(resp.Diff))
+	fmt.Println("Access control list rolled back")
+	return nil
+}
+
+// aclImportResponse is the response of the admin API to an import or
+// a rollback of the access control list.
+type aclImportResponse struct {
+	Applied bool           `json:"applied"`
+	Diff    server.ACLDiff `json:"diff"`
+}
+
+// formatACLDiff renders the differences between two access control lists,
+// one line per added (+), removed (-) and changed (~) client.
+func formatACLDiff(diff server.ACLDiff) string {
+	if diff.Empty() {
+		return "No changes\n"
+	}
+
+	var b strings.Builder
+	for _, clientID := range sortedKeys(diff.AddedClients) {
+		fmt.Fprintf(&b, "+ %s: %s\n", clientID, strings.Join(diff.AddedClients[clientID], ", "))
+	}
+	for _, clientID := range diff.RemovedClients {
+		fmt.Fprintf(&b, "- %s\n", clientID)
+	}
+	for _, clientID := range sortedKeys(diff.ChangedClients) {
+		change := diff.ChangedClients[clientID]
+		var parts []string
+		for _, entry := range change.Added {
+			parts = append(parts, "+"+entry)
+		}
+		for _, entry := range change.Removed {
+			parts = append(parts, "-"+entry)
+		}
+		if change.Reordered {
+			parts = append(parts, "reordered")
+		}
+		fmt.Fprintf(&b, "~ %s: %s\n", clientID, strings.Join(parts, ", "))
+	}
+	return b.String()
+}
+
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
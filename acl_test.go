@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rrasulzade/tcp-lb-go/server"
+	"github.com/stretchr/testify/require"
+)
+
+// captureStdout returns what run writes to the standard output,
+// along with its error.
+func captureStdout(t *testing.T, run func() error) (string, error) {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		output <- data
+	}()
+	runErr := run()
+	w.Close()
+	return string(<-output), runErr
+}
+
+// writeJSONResponse answers an admin API request with v.
+func writeJSONResponse(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func TestACLSubcommand(t *testing.T) {
+	acl := map[string][]string{"client1": {"pool:api"}}
+	var imported map[string][]string
+	var dryRun bool
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/acl":
+			writeJSONResponse(w, http.StatusOK, acl)
+		case r.Method == http.MethodPut && r.URL.Path == "/acl":
+			imported = nil
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&imported))
+			dryRun = r.URL.Query().Get("dry_run") == "true"
+			writeJSONResponse(w, http.StatusOK, aclImportResponse{Applied: !dryRun, Diff: server.DiffACL(acl, imported)})
+		case r.Method == http.MethodPost && r.URL.Path == "/acl/rollback":
+			writeJSONResponse(w, http.StatusConflict, map[string]string{"error": server.ErrNoACLSnapshot.Error()})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer admin.Close()
+	flags := []string{"-admin", admin.URL, "-token", "secret"}
+
+	t.Run("Export", func(t *testing.T) {
+		require := require.New(t)
+
+		file := filepath.Join(t.TempDir(), "acl.json")
+		_, err := captureStdout(t, func() error {
+			return runACL(append([]string{"export", "-file", file}, flags...))
+		})
+		require.NoError(err)
+		data, err := os.ReadFile(file)
+		require.NoError(err)
+		require.JSONEq(`{"client1": ["pool:api"]}`, string(data))
+	})
+
+	t.Run("Import", func(t *testing.T) {
+		require := require.New(t)
+
+		file := filepath.Join(t.TempDir(), "acl.json")
+		require.NoError(os.WriteFile(file, []byte(`{"client1": ["pool:api", "pool:batch"], "client2": ["pool:web"]}`), 0o600))
+
+		output, err := captureStdout(t, func() error {
+			return runACL(append([]string{"import", "-file", file, "-dry-run"}, flags...))
+		})
+		require.NoError(err)
+		require.True(dryRun)
+		require.Equal(map[string][]string{"client1": {"pool:api", "pool:batch"}, "client2": {"pool:web"}}, imported)
+		require.Equal("+ client2: pool:web\n~ client1: +pool:batch\nDry run, access control list not applied\n", output)
+
+		output, err = captureStdout(t, func() error {
+			return runACL(append([]string{"import", "-file", file}, flags...))
+		})
+		require.NoError(err)
+		require.False(dryRun)
+		require.Contains(output, "Access control list applied\n")
+	})
+
+	t.Run("Admin API error", func(t *testing.T) {
+		_, err := captureStdout(t, func() error {
+			return runACL(append([]string{"rollback"}, flags...))
+		})
+		require.EqualError(t, err, "admin API error (409 Conflict): no access control list to roll back to")
+	})
+
+	t.Run("Usage", func(t *testing.T) {
+		require.ErrorContains(t, runACL([]string{"delete"}), "usage: acl export|import|rollback")
+	})
+}
+
+func TestFormatACLDiff(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal("No changes\n", formatACLDiff(server.ACLDiff{}))
+	require.Equal("+ a: pool:api, pool:web\n- b\n~ c: +pool:web, -pool:api\n~ d: reordered\n", formatACLDiff(server.ACLDiff{
+		AddedClients:   map[string][]string{"a": {"pool:api", "pool:web"}},
+		RemovedClients: []string{"b"},
+		ChangedClients: map[string]server.ACLChange{
+			"c": {Added: []string{"pool:web"}, Removed: []string{"pool:api"}},
+			"d": {Reordered: true},
+		},
+	}))
+}
@@ -0,0 +1,102 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rrasulzade/tcp-lb-go/logging"
+	"github.com/rrasulzade/tcp-lb-go/server"
+)
+
+// importACLResponse is the result of an access control list import.
+type importACLResponse struct {
+	// Applied is set if the imported list replaced the one in effect.
+	Applied bool `json:"applied"`
+
+	// Diff describes the differences between the list in effect and the imported one.
+	Diff server.ACLDiff `json:"diff"`
+}
+
+// handleACL exports the access control list in effect and atomically
+// replaces it with an imported one, e.g. when the list is managed in an
+// external IAM system. An import is validated against the configured
+// backends and pools and answered with its differences to the list in
+// effect; with dry_run=true it is only validated and compared.
+func (s *Server) handleACL(w http.ResponseWriter, r *http.Request) {
+	proxyServer := s.config.ProxyServer
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, proxyServer.ClientBackendACL())
+
+	case http.MethodPut:
+		dryRun, err := parseDryRun(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		var acl map[string][]string
+		if err := decodeJSON(r, &acl); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if len(acl) == 0 {
+			writeError(w, http.StatusBadRequest, errors.New("access control list configuration is required"))
+			return
+		}
+		if s.config.ValidateACL != nil {
+			if err := s.config.ValidateACL(acl); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+
+		if dryRun {
+			writeJSON(w, http.StatusOK, importACLResponse{Diff: proxyServer.DiffClientBackendACL(acl)})
+			return
+		}
+		diff, err := proxyServer.SetClientBackendACL(acl)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, importACLResponse{Applied: true, Diff: diff})
+
+	default:
+		w.Header().Set("Allow", strings.Join([]string{http.MethodGet, http.MethodPut}, ", "))
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+// handleACLSnapshots lists the access control lists replaced by imports,
+// newest first, which can be rolled back to.
+func (s *Server) handleACLSnapshots(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.config.ProxyServer.ACLSnapshots())
+}
+
+// handleACLRollback restores the access control list replaced by the last
+// import, limiting the impact of a bad import to the time it takes to
+// roll it back.
+func (s *Server) handleACLRollback(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	diff, err := s.config.ProxyServer.RollbackClientBackendACL()
+	if errors.Is(err, server.ErrNoACLSnapshot) {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	logging.Infof("Access control list rolled back: %d clients added, %d removed, %d changed",
+		len(diff.AddedClients), len(diff.RemovedClients), len(diff.ChangedClients))
+	writeJSON(w, http.StatusOK, importACLResponse{Applied: true, Diff: diff})
+}
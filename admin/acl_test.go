@@ -0,0 +1,85 @@
+package admin
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rrasulzade/tcp-lb-go/lib"
+	"github.com/rrasulzade/tcp-lb-go/server"
+	"github.com/stretchr/testify/require"
+)
+
+func TestACLRollback(t *testing.T) {
+	require := require.New(t)
+
+	lb := lib.NewLoadBalancer(100, 100)
+	initial := map[string][]string{"client1": {"pool:api"}}
+	proxyServer, err := server.NewServer(&server.ServerConfig{
+		Address:              "127.0.0.1:0",
+		LoadBalancer:         lb,
+		TLSConfig:            &tls.Config{},
+		AllowedClients:       map[string]bool{"api": true},
+		ClientBackendEntries: initial,
+	})
+	require.NoError(err)
+	s, err := NewServer(&AdminConfig{
+		Address:      "127.0.0.1:0",
+		LoadBalancer: lb,
+		ProxyServer:  proxyServer,
+		ValidateACL: func(acl map[string][]string) error {
+			for _, entries := range acl {
+				for _, entry := range entries {
+					if entry != "pool:api" && entry != "pool:batch" {
+						return errors.New("unknown pool")
+					}
+				}
+			}
+			return nil
+		},
+	})
+	require.NoError(err)
+	admin := httptest.NewServer(s.httpServer.Handler)
+	defer admin.Close()
+
+	request := func(method, path, body string, v any) int {
+		req, err := http.NewRequest(method, admin.URL+path, strings.NewReader(body))
+		require.NoError(err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(err)
+		defer resp.Body.Close()
+		if v != nil {
+			require.NoError(json.NewDecoder(resp.Body).Decode(v))
+		}
+		return resp.StatusCode
+	}
+
+	imported := map[string][]string{"client2": {"pool:batch"}}
+	require.Equal(http.StatusOK, request(http.MethodPut, "/acl", `{"client2": ["pool:batch"]}`, nil))
+
+	// A failed import neither replaces the list nor is snapshotted
+	require.Equal(http.StatusBadRequest, request(http.MethodPut, "/acl", `{"client3": ["pool:unknown"]}`, nil))
+	require.Equal(http.StatusBadRequest, request(http.MethodPut, "/acl", `{}`, nil))
+	var acl map[string][]string
+	require.Equal(http.StatusOK, request(http.MethodGet, "/acl", "", &acl))
+	require.Equal(imported, acl)
+	var snapshots []server.ACLSnapshot
+	require.Equal(http.StatusOK, request(http.MethodGet, "/acl/snapshots", "", &snapshots))
+	require.Len(snapshots, 1)
+	require.Equal(initial, snapshots[0].ACL)
+
+	// The rollback restores the list in effect before the last successful import
+	var rollback importACLResponse
+	require.Equal(http.StatusOK, request(http.MethodPost, "/acl/rollback", "", &rollback))
+	require.True(rollback.Applied)
+	require.Equal(initial, rollback.Diff.AddedClients)
+	require.Equal([]string{"client2"}, rollback.Diff.RemovedClients)
+	require.Equal(initial, proxyServer.ClientBackendACL())
+
+	require.Equal(http.StatusConflict, request(http.MethodPost, "/acl/rollback", "", nil))
+	require.Equal(http.StatusMethodNotAllowed, request(http.MethodGet, "/acl/rollback", "", nil))
+}
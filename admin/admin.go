@@ -0,0 +1,270 @@
+package admin
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/audit"
+	"github.com/rrasulzade/tcp-lb-go/devca"
+	"github.com/rrasulzade/tcp-lb-go/featureflag"
+	"github.com/rrasulzade/tcp-lb-go/health"
+	"github.com/rrasulzade/tcp-lb-go/httpauth"
+	"github.com/rrasulzade/tcp-lb-go/lib"
+	"github.com/rrasulzade/tcp-lb-go/listen"
+	"github.com/rrasulzade/tcp-lb-go/logging"
+	"github.com/rrasulzade/tcp-lb-go/metrics"
+	"github.com/rrasulzade/tcp-lb-go/server"
+)
+
+// AdminConfig encapsulates the configuration parameters required
+// to initialize and run the admin API server.
+type AdminConfig struct {
+	// Address is an address on which the admin API listens.
+	Address string
+
+	// LoadBalancer is the LoadBalancer instance managed through the API.
+	LoadBalancer *lib.LoadBalancer
+
+	// DefaultGracePeriod is the drain grace period used by operations
+	// that do not specify one.
+	DefaultGracePeriod time.Duration
+
+	// HealthChecker serves the process health on /healthz. Optional.
+	HealthChecker *health.Checker
+
+	// ProxyServer is the load balancer server drained on /drain, whose
+	// readiness is served on /readyz, whose clients are debugged on
+	// /debug/clients, whose active connections are listed on
+	// /connections, whose new connections are shed on /shedding, whose
+	// client rates are served on /clients/rates, whose clients are
+	// pinned to backends on /clients/pins, whose access control list is
+	// managed on /acl and whose routing decisions are explained on
+	// /routing/explain. Optional.
+	ProxyServer *server.Server
+
+	// ValidateACL validates an imported access control list and rewrites
+	// its entries into their canonical form. Optional.
+	ValidateACL func(acl map[string][]string) error
+
+	// Shutdown stops the load balancer gracefully when requested on
+	// /shutdown. Optional.
+	Shutdown func()
+
+	// DefaultMaxBackendConnections is the connection limit of backends
+	// added on /backends and /backends/transaction that do not specify one.
+	DefaultMaxBackendConnections int64
+
+	// DefaultReadinessDelay is the time a drained server is reported as
+	// not ready before it stops accepting connections.
+	DefaultReadinessDelay time.Duration
+
+	// DefaultDrainTimeout is the maximum time a drain waits for
+	// active connections to finish.
+	DefaultDrainTimeout time.Duration
+
+	// ClientCAs are the trusted client CAs managed on /tls/client-cas. Optional.
+	ClientCAs *lib.ClientCAPool
+
+	// DevCA issues client certificates of the ProxyServer on
+	// /dev/certificates, for development only. Optional.
+	DevCA *devca.CA
+
+	// DevCAMaxTTL bounds the lifetime of the certificates issued by DevCA.
+	DevCAMaxTTL time.Duration
+
+	// BackendLatencies maps a latency phase to its histograms labeled by
+	// pool and backend, served on /backends/latency. Optional.
+	BackendLatencies map[lib.LatencyPhase]*metrics.HistogramFamily
+
+	// FeatureFlags are the feature flags managed on /features. Optional.
+	FeatureFlags *featureflag.Set
+
+	// TLSConfig is the TLS configuration of the admin listener, whose
+	// client CAs are separate from the data-plane ones. The admin API is
+	// served over plain HTTP if nil.
+	TLSConfig *tls.Config
+
+	// ListenRetry defines how binding an address in use is retried.
+	ListenRetry listen.Retry
+
+	// Tokens are the bearer tokens granting access to the admin API.
+	// If neither tokens nor client certificates are configured, the
+	// admin API is not authenticated.
+	Tokens []string
+
+	// Peers are the admin APIs to which changes of backends and pools
+	// requested with ?cluster=true are propagated. Optional.
+	Peers *Peers
+
+	// AuditLog records every change requested on the admin API with the
+	// identity that requested it. Optional.
+	AuditLog *audit.Log
+}
+
+// Server serves the admin HTTP API.
+type Server struct {
+	// config is configuration object that holds all the admin settings.
+	config *AdminConfig
+
+	// mux routes admin API requests to their handlers.
+	mux *http.ServeMux
+
+	// httpServer serves the admin API.
+	httpServer *http.Server
+
+	// statsMu ensures concurrent access to the latencyBaselines map.
+	statsMu sync.Mutex
+
+	// latencyBaselines maps a backend latency histogram to its
+	// snapshot at the last statistics reset.
+	latencyBaselines map[latencyKey]latencyBaseline
+}
+
+// NewServer creates a new admin Server instance.
+func NewServer(config *AdminConfig) (*Server, error) {
+	if config.Address == "" {
+		return nil, errors.New("provided admin address is blank")
+	}
+	if config.LoadBalancer == nil {
+		return nil, errors.New("load balancer instance is required")
+	}
+
+	s := &Server{
+		config:           config,
+		mux:              http.NewServeMux(),
+		latencyBaselines: make(map[latencyKey]latencyBaseline),
+	}
+	s.mux.HandleFunc("/backends", s.clustered(s.handleBackends))
+	s.mux.HandleFunc("/pools/switch", s.clustered(s.handleSwitchPool))
+	s.mux.HandleFunc("/pools/maintenance", s.clustered(s.handleMaintenance))
+	s.mux.HandleFunc("/backends/weights", s.clustered(s.handleBackendWeights))
+	s.mux.HandleFunc("/backends/transaction", s.clustered(s.handleBackendTransaction))
+	s.mux.HandleFunc("/backends/stats", s.handleBackendStats)
+	s.mux.HandleFunc("/backends/history", s.handleBackendHistory)
+	s.mux.HandleFunc("/log/level", s.handleLogLevel)
+	s.mux.HandleFunc("/debug/vars", s.handleRuntimeVars)
+	publishRuntimeVars()
+	if config.HealthChecker != nil {
+		s.mux.Handle("/healthz", config.HealthChecker)
+	}
+	if config.ProxyServer != nil {
+		s.mux.HandleFunc("/drain", s.handleDrain)
+		s.mux.HandleFunc("/readyz", s.handleReady)
+		s.mux.HandleFunc("/debug/clients", s.handleDebugClients)
+		s.mux.HandleFunc("/connections", s.handleConnections)
+		s.mux.HandleFunc("/shedding", s.clustered(s.handleShedding))
+		s.mux.HandleFunc("/clients/rates", s.handleClientRates)
+		s.mux.HandleFunc("/clients/pins", s.clustered(s.handleClientPins))
+		s.mux.HandleFunc("/acl", s.handleACL)
+		s.mux.HandleFunc("/acl/snapshots", s.handleACLSnapshots)
+		s.mux.HandleFunc("/acl/rollback", s.handleACLRollback)
+		s.mux.HandleFunc("/routing/explain", s.handleExplainRoute)
+		if config.DevCA != nil {
+			s.mux.HandleFunc("/dev/certificates", s.handleIssueCertificate)
+		}
+	}
+	if config.BackendLatencies != nil {
+		s.mux.HandleFunc("/backends/latency", s.handleBackendLatency)
+	}
+	if config.ProxyServer != nil || config.BackendLatencies != nil {
+		s.mux.HandleFunc("/stats/reset", s.handleResetStats)
+	}
+	if config.Shutdown != nil {
+		s.mux.HandleFunc("/shutdown", s.handleShutdown)
+	}
+	if config.ClientCAs != nil {
+		s.mux.HandleFunc("/tls/client-cas", s.handleClientCAs)
+	}
+	if config.FeatureFlags != nil {
+		s.mux.HandleFunc("/features", s.handleFeatures)
+	}
+
+	clientCerts := config.TLSConfig != nil && config.TLSConfig.ClientCAs != nil
+	s.httpServer = &http.Server{
+		Handler:           httpauth.New(config.Tokens, clientCerts).Wrap(s.audited(s.mux)),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return s, nil
+}
+
+// Start initializes the admin listener and starts serving requests.
+func (s *Server) Start() error {
+	listener, err := listen.Listen(s.config.Address, s.config.ListenRetry)
+	if err != nil {
+		return fmt.Errorf("unable to initialize admin listener: %w", err)
+	}
+	if s.config.TLSConfig != nil {
+		listener = tls.NewListener(listener, s.config.TLSConfig)
+	}
+
+	logging.Infof("Admin API is listening on %s", s.config.Address)
+	go func() {
+		err := s.httpServer.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Errorf("Admin API server error: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Stop shuts down the admin API server, and stops retrying the changes
+// that did not reach the peers.
+func (s *Server) Stop() error {
+	if s.config.Peers != nil {
+		s.config.Peers.Close()
+	}
+	return s.httpServer.Close()
+}
+
+// writeJSON writes v as a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error as a JSON response with the given status code.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// decodeJSON decodes the request body into v, rejecting unknown fields.
+func decodeJSON(r *http.Request, v any) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+// parseDryRun returns the dry_run query parameter of a request
+// changing the configuration, which defaults to false.
+func parseDryRun(r *http.Request) (bool, error) {
+	value := r.URL.Query().Get("dry_run")
+	if value == "" {
+		return false, nil
+	}
+	dryRun, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.New("invalid dry_run")
+	}
+	return dryRun, nil
+}
+
+// allowMethod replies with 405 and returns false if the request
+// method is not the expected one.
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return false
+	}
+	return true
+}
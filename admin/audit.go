@@ -0,0 +1,80 @@
+package admin
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/audit"
+	"github.com/rrasulzade/tcp-lb-go/httpauth"
+	"github.com/rrasulzade/tcp-lb-go/logging"
+)
+
+// auditWriter captures the status and body of a response while writing it.
+type auditWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// Write implements http.ResponseWriter.
+func (w *auditWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (w *auditWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// audited wraps the admin API so that every request other than a read is
+// recorded to the audit log with the identity that sent it, the requested
+// change and its outcome, whether the change was applied or rejected.
+func (s *Server) audited(next http.Handler) http.Handler {
+	if s.config.AuditLog == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		entry := audit.Entry{
+			Time:       time.Now(),
+			Identity:   httpauth.Identity(r),
+			RemoteAddr: r.RemoteAddr,
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Query:      r.URL.RawQuery,
+			Request:    rawJSON(body),
+		}
+		recorder := &auditWriter{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		entry.Status = recorder.status
+		if entry.Status == 0 {
+			entry.Status = http.StatusOK
+		}
+		entry.Response = rawJSON(recorder.body.Bytes())
+		if err := s.config.AuditLog.Record(entry); err != nil {
+			logging.Errorf("Unable to record %s %s by %s to the audit log: %v", r.Method, r.URL.Path, entry.Identity, err)
+		}
+	})
+}
@@ -0,0 +1,163 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/lib"
+	"github.com/rrasulzade/tcp-lb-go/logging"
+)
+
+// backendRemovalResponse describes the removal of a drained backend.
+type backendRemovalResponse struct {
+	// Address is the address of the backend.
+	Address string `json:"address"`
+
+	// Pool is the pool of the backend.
+	Pool string `json:"pool"`
+
+	// ActiveAtStart is the number of active connections when the
+	// backend was removed.
+	ActiveAtStart int64 `json:"active_at_start"`
+
+	// ForceClosed is the number of connections force-closed at the drain timeout.
+	ForceClosed int64 `json:"force_closed"`
+
+	// Duration is the time the active connections took to finish.
+	Duration string `json:"duration"`
+}
+
+// handleBackends lists the backends with whether they can be selected and
+// their connections, adds a backend and removes one. Additions and
+// removals are applied as single-change backend transactions. With a
+// drain_timeout, a removal is answered once the active connections of the
+// backend finished, those still active at the timeout being force-closed.
+func (s *Server) handleBackends(w http.ResponseWriter, r *http.Request) {
+	lb := s.config.LoadBalancer
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, lb.BackendStatuses())
+
+	case http.MethodPost:
+		var add addBackendRequest
+		if err := decodeJSON(r, &add); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		req := backendTransactionRequest{Add: []addBackendRequest{add}}
+		tx, err := req.transaction(s.config.DefaultMaxBackendConnections)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		result, err := lb.ApplyBackendTransaction(tx)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		logging.Infof("Backend %s added to pool %s", add.Address, add.Pool)
+		writeJSON(w, http.StatusCreated, backendWeights(result.Added))
+
+	case http.MethodDelete:
+		ref := backendRefRequest{Pool: r.URL.Query().Get("pool"), Address: r.URL.Query().Get("address")}
+		if ref.Pool == "" || ref.Address == "" {
+			writeError(w, http.StatusBadRequest, errors.New("pool and address are required"))
+			return
+		}
+		if drainTimeout := r.URL.Query().Get("drain_timeout"); drainTimeout != "" {
+			timeout, err := time.ParseDuration(drainTimeout)
+			if err != nil || timeout < 0 {
+				writeError(w, http.StatusBadRequest, errors.New("invalid drain timeout"))
+				return
+			}
+			s.removeDrainedBackend(w, r, ref, timeout)
+			return
+		}
+		req := backendTransactionRequest{Remove: []backendRefRequest{ref}}
+		tx, err := req.transaction(s.config.DefaultMaxBackendConnections)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		result, err := lb.ApplyBackendTransaction(tx)
+		if errors.Is(err, lib.ErrUnknownBackend) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		logging.Infof("Backend %s removed from pool %s", ref.Address, ref.Pool)
+		writeJSON(w, http.StatusOK, backendWeights(result.Removed))
+
+	default:
+		w.Header().Set("Allow", strings.Join([]string{http.MethodGet, http.MethodPost, http.MethodDelete}, ", "))
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+// removeDrainedBackend removes a backend and waits for its active
+// connections to finish, up to timeout, or until the request is canceled.
+func (s *Server) removeDrainedBackend(w http.ResponseWriter, r *http.Request, ref backendRefRequest, timeout time.Duration) {
+	removal, err := s.config.LoadBalancer.RemoveBackend(r.Context(), lib.BackendRef{Pool: ref.Pool, Address: ref.Address}, timeout)
+	switch {
+	case errors.Is(err, lib.ErrUnknownBackend):
+		writeError(w, http.StatusNotFound, err)
+		return
+	case removal == nil:
+		writeError(w, http.StatusBadRequest, err)
+		return
+	case err != nil:
+		// The request was canceled once the backend was removed
+		logging.Warnf("Backend %s removed from pool %s without waiting for its connections: %v", ref.Address, ref.Pool, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, backendRemovalResponse{
+		Address:       removal.Backend.Address,
+		Pool:          removal.Backend.Pool,
+		ActiveAtStart: removal.ActiveAtStart,
+		ForceClosed:   removal.ForceClosed,
+		Duration:      removal.Duration.Round(time.Millisecond).String(),
+	})
+}
+
+// handleBackendStats serves the transfer statistics of every backend,
+// so that the traffic each backend handles can be compared.
+func (s *Server) handleBackendStats(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.config.LoadBalancer.Stats())
+}
+
+// handleBackendHistory serves the recent health transitions and dial
+// errors of every backend, or of the backends with the address given as
+// the "address" query parameter, so that flapping backends can be
+// investigated without searching the logs.
+func (s *Server) handleBackendHistory(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	histories := s.config.LoadBalancer.Histories()
+	address := r.URL.Query().Get("address")
+	if address == "" {
+		writeJSON(w, http.StatusOK, histories)
+		return
+	}
+	matching := make([]lib.BackendHistory, 0, 1)
+	for _, history := range histories {
+		if history.Address == address {
+			matching = append(matching, history)
+		}
+	}
+	if len(matching) == 0 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%w '%s'", lib.ErrUnknownBackend, address))
+		return
+	}
+	writeJSON(w, http.StatusOK, matching)
+}
@@ -0,0 +1,12 @@
+package admin
+
+import "net/http"
+
+// handleClientRates serves the rolling and peak connection rates of every
+// client, busiest first, as observed by the load balancer.
+func (s *Server) handleClientRates(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.config.ProxyServer.ClientRates())
+}
@@ -0,0 +1,399 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/logging"
+)
+
+// maxPeerResponseSize bounds the response body read from a peer.
+const maxPeerResponseSize = 1 << 20
+
+// maxPendingPeerChanges bounds the number of changes kept for retry per
+// peer.
+const maxPendingPeerChanges = 1000
+
+// DefaultPeerRetryInterval is the default interval at which changes that
+// did not reach a peer are retried.
+const DefaultPeerRetryInterval = 5 * time.Second
+
+// Peers are the admin APIs of the other load balancer instances of a
+// cluster. Changes requested with ?cluster=true are applied locally, then
+// forwarded to every peer, so that operators change the whole cluster,
+// e.g. drain a backend everywhere, with a single call. Changes that did
+// not reach a peer are retried in order until it is reachable again, so
+// that the peers converge once a peer that was down is back. Changes a
+// peer responded to, even with an error, are not retried.
+type Peers struct {
+	// URLs are the base URLs of the peer admin APIs.
+	URLs []string
+
+	// Token is the bearer token sent to the peers. Optional.
+	Token string
+
+	// Client sends the requests to the peers, and bounds their duration.
+	Client *http.Client
+
+	// RetryInterval is the interval at which changes that did not reach
+	// a peer are retried. Defaults to DefaultPeerRetryInterval.
+	RetryInterval time.Duration
+
+	// mu guards pending and done.
+	mu sync.Mutex
+
+	// pending maps a peer to the changes to retry, in request order.
+	pending map[string][]peerChange
+
+	// done is closed by Close to stop the retries.
+	done chan struct{}
+}
+
+// peerChange is a change forwarded to a peer.
+type peerChange struct {
+	method      string
+	path        string
+	contentType string
+	body        []byte
+}
+
+// peerResult describes the outcome of a change forwarded to a peer.
+type peerResult struct {
+	// Peer is the base URL of the peer.
+	Peer string `json:"peer"`
+
+	// Status is the HTTP status of the peer response, zero if none.
+	Status int `json:"status,omitempty"`
+
+	// Response is the JSON response of the peer.
+	Response json.RawMessage `json:"response,omitempty"`
+
+	// Error describes why the change failed on the peer.
+	Error string `json:"error,omitempty"`
+
+	// Queued is set if the change did not reach the peer and is retried.
+	Queued bool `json:"queued,omitempty"`
+
+	// unreachable is set if the change did not reach the peer.
+	unreachable bool
+}
+
+// clusterResponse is the response to a change applied to the cluster.
+type clusterResponse struct {
+	// Local is the response of this instance.
+	Local json.RawMessage `json:"local"`
+
+	// Peers are the outcomes on the peers.
+	Peers []peerResult `json:"peers"`
+}
+
+// responseRecorder captures the response of a handler.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+// Header implements http.ResponseWriter.
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+// Write implements http.ResponseWriter.
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(b)
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+// parseCluster returns the cluster query parameter of a request changing
+// the configuration, which defaults to false.
+func parseCluster(r *http.Request) (bool, error) {
+	value := r.URL.Query().Get("cluster")
+	if value == "" {
+		return false, nil
+	}
+	cluster, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.New("invalid cluster")
+	}
+	return cluster, nil
+}
+
+// clustered wraps a handler changing the configuration so that requests
+// with ?cluster=true are forwarded to the peers once applied locally.
+// Changes rejected locally are not forwarded. Forwarded requests do not
+// carry the cluster parameter, so that peers apply them locally only.
+func (s *Server) clustered(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cluster, err := parseCluster(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if !cluster || r.Method == http.MethodGet {
+			handler(w, r)
+			return
+		}
+		if s.config.Peers == nil {
+			writeError(w, http.StatusBadRequest, errors.New("no peers are configured"))
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		local := &responseRecorder{header: make(http.Header)}
+		handler(local, r)
+		if local.status < 200 || local.status >= 300 {
+			for name, values := range local.header {
+				w.Header()[name] = values
+			}
+			w.WriteHeader(local.status)
+			w.Write(local.body.Bytes())
+			return
+		}
+
+		response := clusterResponse{
+			Local: rawJSON(local.body.Bytes()),
+			Peers: s.config.Peers.forward(r, body),
+		}
+		status := http.StatusOK
+		for _, result := range response.Peers {
+			if result.Error != "" {
+				status = http.StatusBadGateway
+			}
+		}
+		writeJSON(w, status, response)
+	}
+}
+
+// forward sends the request with the body to every peer, without the
+// cluster query parameter, and returns the outcomes in peer order. The
+// requests are not canceled with r, and are bounded by the timeout of the
+// client instead.
+func (p *Peers) forward(r *http.Request, body []byte) []peerResult {
+	query := r.URL.Query()
+	query.Del("cluster")
+	path := r.URL.Path
+	if encoded := query.Encode(); encoded != "" {
+		path += "?" + encoded
+	}
+	change := peerChange{
+		method:      r.Method,
+		path:        path,
+		contentType: r.Header.Get("Content-Type"),
+		body:        body,
+	}
+
+	results := make([]peerResult, len(p.URLs))
+	var wg sync.WaitGroup
+	for i, peer := range p.URLs {
+		wg.Add(1)
+		go func(i int, peer string) {
+			defer wg.Done()
+			results[i] = p.apply(peer, change)
+			results[i].Peer = peer
+			switch {
+			case results[i].Queued:
+				logging.Warnf("Unable to apply %s %s on peer %s, retrying: %s", r.Method, r.URL.Path, peer, results[i].Error)
+			case results[i].Error != "":
+				logging.Warnf("Unable to apply %s %s on peer %s: %s", r.Method, r.URL.Path, peer, results[i].Error)
+			default:
+				logging.Infof("Applied %s %s on peer %s", r.Method, r.URL.Path, peer)
+			}
+		}(i, peer)
+	}
+	wg.Wait()
+	return results
+}
+
+// apply sends the change to the peer, unless changes are already pending
+// for it, and queues the change for retry if it did not reach the peer.
+func (p *Peers) apply(peer string, change peerChange) peerResult {
+	p.mu.Lock()
+	pending := len(p.pending[peer])
+	p.mu.Unlock()
+	if pending > 0 {
+		result := peerResult{Error: fmt.Sprintf("%d earlier changes are pending retry", pending)}
+		result.Queued = p.enqueue(peer, change)
+		return result
+	}
+
+	result := p.send(context.Background(), peer, change)
+	if result.unreachable {
+		result.Queued = p.enqueue(peer, change)
+	}
+	return result
+}
+
+// enqueue queues the change for retry, and starts retrying the changes of
+// the peer if none was pending. Returns false if the change was dropped,
+// as the peers are closed or too many changes are pending for the peer.
+func (p *Peers) enqueue(peer string, change peerChange) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed() {
+		return false
+	}
+	if len(p.pending[peer]) >= maxPendingPeerChanges {
+		logging.Errorf("Dropping %s %s for peer %s: %d changes are pending retry", change.method, change.path, peer, maxPendingPeerChanges)
+		return false
+	}
+	if p.pending == nil {
+		p.pending = make(map[string][]peerChange)
+	}
+	if len(p.pending[peer]) == 0 {
+		go p.retry(peer, p.doneLocked())
+	}
+	p.pending[peer] = append(p.pending[peer], change)
+	return true
+}
+
+// retry sends the pending changes of the peer in order, every retry
+// interval until the peer is reachable, until none is left or done is
+// closed.
+func (p *Peers) retry(peer string, done <-chan struct{}) {
+	interval := p.RetryInterval
+	if interval <= 0 {
+		interval = DefaultPeerRetryInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		for {
+			p.mu.Lock()
+			if len(p.pending[peer]) == 0 {
+				// The peers were closed
+				p.mu.Unlock()
+				return
+			}
+			change := p.pending[peer][0]
+			p.mu.Unlock()
+
+			result := p.send(context.Background(), peer, change)
+			if result.unreachable {
+				break
+			}
+			if result.Error != "" {
+				logging.Warnf("Unable to apply %s %s on peer %s: %s", change.method, change.path, peer, result.Error)
+			} else {
+				logging.Infof("Applied %s %s on peer %s after retrying", change.method, change.path, peer)
+			}
+
+			p.mu.Lock()
+			left := len(p.pending[peer])
+			if left > 0 {
+				p.pending[peer] = p.pending[peer][1:]
+				left--
+			}
+			if left == 0 {
+				delete(p.pending, peer)
+			}
+			p.mu.Unlock()
+			if left == 0 {
+				return
+			}
+		}
+	}
+}
+
+// Close stops retrying the changes that did not reach the peers, which
+// are dropped.
+func (p *Peers) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.closed() {
+		close(p.doneLocked())
+	}
+	p.pending = nil
+}
+
+// doneLocked returns the channel closed by Close, creating it on first
+// use. The caller must hold p.mu.
+func (p *Peers) doneLocked() chan struct{} {
+	if p.done == nil {
+		p.done = make(chan struct{})
+	}
+	return p.done
+}
+
+// closed reports whether Close was called. The caller must hold p.mu.
+func (p *Peers) closed() bool {
+	select {
+	case <-p.doneLocked():
+		return true
+	default:
+		return false
+	}
+}
+
+// send sends a change to a peer.
+func (p *Peers) send(ctx context.Context, peer string, change peerChange) peerResult {
+	url := strings.TrimSuffix(peer, "/") + change.path
+	req, err := http.NewRequestWithContext(ctx, change.method, url, bytes.NewReader(change.body))
+	if err != nil {
+		return peerResult{Error: err.Error()}
+	}
+	if change.contentType != "" {
+		req.Header.Set("Content-Type", change.contentType)
+	}
+	if p.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.Token)
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return peerResult{Error: err.Error(), unreachable: true}
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxPeerResponseSize))
+	result := peerResult{Status: resp.StatusCode, Response: rawJSON(respBody)}
+	switch {
+	case err != nil:
+		result.Error = fmt.Sprintf("unable to read response: %v", err)
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		result.Error = fmt.Sprintf("peer responded with status %d", resp.StatusCode)
+	}
+	return result
+}
+
+// rawJSON returns b if it is a JSON document, nil otherwise.
+func rawJSON(b []byte) json.RawMessage {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 || !json.Valid(b) {
+		return nil
+	}
+	return b
+}
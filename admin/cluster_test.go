@@ -0,0 +1,95 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/lib"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyTransport fails the requests while down is set.
+type flakyTransport struct {
+	down atomic.Bool
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *flakyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.down.Load() {
+		return nil, errors.New("connection refused")
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestPeersRetry(t *testing.T) {
+	require := require.New(t)
+
+	var mu sync.Mutex
+	var received []string
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, r.URL.RequestURI()+" "+string(body))
+		mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]string{})
+	}))
+	defer peer.Close()
+
+	lb := lib.NewLoadBalancer(100, 100)
+	lb.AddBackend(&lib.Backend{Address: "127.0.0.1:5001", Pool: "web"})
+	transport := &flakyTransport{}
+	transport.down.Store(true)
+	s, err := NewServer(&AdminConfig{
+		Address:      "127.0.0.1:0",
+		LoadBalancer: lb,
+		Peers: &Peers{
+			URLs:          []string{peer.URL},
+			Client:        &http.Client{Transport: transport, Timeout: time.Second},
+			RetryInterval: 10 * time.Millisecond,
+		},
+	})
+	require.NoError(err)
+	defer s.Stop()
+	admin := httptest.NewServer(s.httpServer.Handler)
+	defer admin.Close()
+
+	setWeight := func(weight string) clusterResponse {
+		req, err := http.NewRequest(http.MethodPut, admin.URL+"/backends/weights?cluster=true", strings.NewReader(`{"address": "127.0.0.1:5001", "weight": `+weight+`}`))
+		require.NoError(err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(err)
+		defer resp.Body.Close()
+		require.Equal(http.StatusBadGateway, resp.StatusCode)
+		var response clusterResponse
+		require.NoError(json.NewDecoder(resp.Body).Decode(&response))
+		return response
+	}
+
+	// Changes that did not reach the peer are queued, in order
+	response := setWeight("50")
+	require.True(response.Peers[0].Queued)
+	require.Contains(response.Peers[0].Error, "connection refused")
+	response = setWeight("20")
+	require.True(response.Peers[0].Queued)
+	require.Contains(response.Peers[0].Error, "1 earlier changes are pending retry")
+	transport.down.Store(false)
+
+	// They are applied on the peer once it is reachable
+	require.Eventually(func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) == 2
+	}, time.Second, 5*time.Millisecond)
+	require.Equal([]string{
+		`/backends/weights {"address": "127.0.0.1:5001", "weight": 50}`,
+		`/backends/weights {"address": "127.0.0.1:5001", "weight": 20}`,
+	}, received)
+}
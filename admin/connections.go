@@ -0,0 +1,39 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/rrasulzade/tcp-lb-go/server"
+)
+
+// handleConnections serves the active client connections, oldest first,
+// or the connection with the ID given as the id query parameter. The
+// connections of a single client are listed with the client_id parameter.
+func (s *Server) handleConnections(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	if id := r.URL.Query().Get("id"); id != "" {
+		connection, ok := s.config.ProxyServer.Connection(id)
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("connection '%s' is not active", id))
+			return
+		}
+		writeJSON(w, http.StatusOK, connection)
+		return
+	}
+
+	connections := s.config.ProxyServer.Connections()
+	if clientID := r.URL.Query().Get("client_id"); clientID != "" {
+		filtered := make([]server.ConnectionInfo, 0, len(connections))
+		for _, connection := range connections {
+			if connection.ClientID == clientID {
+				filtered = append(filtered, connection)
+			}
+		}
+		connections = filtered
+	}
+	writeJSON(w, http.StatusOK, connections)
+}
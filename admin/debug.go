@@ -0,0 +1,70 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// startDebugRequest is the body of a request to debug a client.
+type startDebugRequest struct {
+	// ClientID selects the client by its ID.
+	ClientID string `json:"client_id"`
+
+	// CommonName selects the clients by their certificate CommonName.
+	CommonName string `json:"common_name"`
+
+	// Duration is the time the client is debugged, e.g. "10m".
+	Duration string `json:"duration"`
+
+	// Capture enables recording the data of the client's connections.
+	Capture bool `json:"capture"`
+}
+
+// handleDebugClients lists, starts and stops the debug sessions tracing
+// the connections of selected clients in detail for a limited time.
+func (s *Server) handleDebugClients(w http.ResponseWriter, r *http.Request) {
+	proxyServer := s.config.ProxyServer
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, proxyServer.DebugSessions())
+
+	case http.MethodPost:
+		var req startDebugRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		duration, err := time.ParseDuration(req.Duration)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("invalid duration"))
+			return
+		}
+		session, err := proxyServer.StartDebug(req.ClientID, req.CommonName, duration, req.Capture)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, session)
+
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			writeError(w, http.StatusBadRequest, errors.New("id is required"))
+			return
+		}
+		if err := proxyServer.StopDebug(id); err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		methods := []string{http.MethodGet, http.MethodPost, http.MethodDelete}
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
@@ -0,0 +1,110 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/logging"
+	"github.com/rrasulzade/tcp-lb-go/server"
+)
+
+// issueCertificateRequest is the body of a development client certificate request.
+type issueCertificateRequest struct {
+	// CommonName is the CommonName of the client, which is allowed to connect.
+	CommonName string `json:"common_name"`
+
+	// TTL is the lifetime of the certificate, e.g. "1h".
+	// Optional, defaults to the maximum lifetime.
+	TTL string `json:"ttl"`
+
+	// ACL are the access control list entries granted to the client,
+	// i.e. backend addresses and pool names. Optional, the client is
+	// subject to the unknown client policy if empty.
+	ACL []string `json:"acl"`
+}
+
+// issueCertificateResponse is a development client certificate.
+type issueCertificateResponse struct {
+	// ClientID is the client ID of the certificate, listed in the
+	// access control list if entries were granted.
+	ClientID string `json:"client_id"`
+
+	// NotAfter is the expiry of the certificate.
+	NotAfter time.Time `json:"not_after"`
+
+	// Certificate is the PEM encoded client certificate.
+	Certificate string `json:"certificate"`
+
+	// PrivateKey is the PEM encoded private key of the certificate.
+	PrivateKey string `json:"private_key"`
+
+	// CACertificate is the PEM encoded development CA certificate.
+	CACertificate string `json:"ca_certificate"`
+}
+
+// handleIssueCertificate issues a short-lived client certificate signed
+// by the development CA, allows its CommonName to connect and grants its
+// client ID the requested access control list entries, so that a test
+// client can connect without a PKI.
+func (s *Server) handleIssueCertificate(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req issueCertificateRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.CommonName == "" {
+		writeError(w, http.StatusBadRequest, errors.New("common name is required"))
+		return
+	}
+	ttl := s.config.DevCAMaxTTL
+	if req.TTL != "" {
+		var err error
+		ttl, err = time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			writeError(w, http.StatusBadRequest, errors.New("invalid certificate TTL"))
+			return
+		}
+		if ttl > s.config.DevCAMaxTTL {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("certificate TTL must not exceed %s", s.config.DevCAMaxTTL))
+			return
+		}
+	}
+
+	issued, err := s.config.DevCA.Issue(req.CommonName, ttl)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	clientID := server.GenerateClientID(req.CommonName, issued.Certificate.SerialNumber.String())
+
+	// The entries are granted first, so that a failure leaves the allowed
+	// clients unchanged, while a client whose CommonName is then denied
+	// cannot use them
+	proxyServer := s.config.ProxyServer
+	if len(req.ACL) > 0 {
+		if _, err := proxyServer.SetClientACLEntries(clientID, req.ACL, s.config.ValidateACL); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if err := proxyServer.AllowClient(req.CommonName); err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+
+	logging.Warnf("Development certificate issued to %s (client %s), valid until %s",
+		req.CommonName, clientID, issued.Certificate.NotAfter.Format(time.RFC3339))
+	writeJSON(w, http.StatusCreated, issueCertificateResponse{
+		ClientID:      clientID,
+		NotAfter:      issued.Certificate.NotAfter,
+		Certificate:   string(issued.CertificatePEM),
+		PrivateKey:    string(issued.KeyPEM),
+		CACertificate: string(s.config.DevCA.CertificatePEM()),
+	})
+}
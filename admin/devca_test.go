@@ -0,0 +1,75 @@
+package admin
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/devca"
+	"github.com/rrasulzade/tcp-lb-go/lib"
+	"github.com/rrasulzade/tcp-lb-go/server"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIssueCertificate(t *testing.T) {
+	require := require.New(t)
+
+	lb := lib.NewLoadBalancer(100, 100)
+	proxyServer, err := server.NewServer(&server.ServerConfig{
+		Address:              "127.0.0.1:0",
+		LoadBalancer:         lb,
+		TLSConfig:            &tls.Config{},
+		AllowedClients:       map[string]bool{"api": true, "denied": false},
+		ClientBackendEntries: map[string][]string{"client1": {"pool:api"}},
+	})
+	require.NoError(err)
+	ca, err := devca.New("test")
+	require.NoError(err)
+	s, err := NewServer(&AdminConfig{
+		Address:      "127.0.0.1:0",
+		LoadBalancer: lb,
+		ProxyServer:  proxyServer,
+		DevCA:        ca,
+		DevCAMaxTTL:  time.Hour,
+		ValidateACL: func(acl map[string][]string) error {
+			for _, entries := range acl {
+				for _, entry := range entries {
+					if !strings.HasPrefix(entry, lib.PoolPrefix) {
+						return errors.New("unknown backend address")
+					}
+				}
+			}
+			return nil
+		},
+	})
+	require.NoError(err)
+	admin := httptest.NewServer(s.httpServer.Handler)
+	defer admin.Close()
+
+	issue := func(body string, v any) int {
+		resp, err := http.Post(admin.URL+"/dev/certificates", "application/json", strings.NewReader(body))
+		require.NoError(err)
+		defer resp.Body.Close()
+		if v != nil {
+			require.NoError(json.NewDecoder(resp.Body).Decode(v))
+		}
+		return resp.StatusCode
+	}
+
+	var issued issueCertificateResponse
+	require.Equal(http.StatusCreated, issue(`{"common_name": "dev", "acl": ["pool:web"]}`, &issued))
+	require.Equal([]string{"pool:web"}, proxyServer.ClientBackendACL()[issued.ClientID])
+	require.Contains(proxyServer.ClientBackendACL(), "client1")
+
+	// Entries failing validation are not granted
+	require.Equal(http.StatusBadRequest, issue(`{"common_name": "rejected", "acl": ["web"]}`, nil))
+	require.Len(proxyServer.ACLSnapshots(), 1)
+
+	// Denied CommonNames are not allowed
+	require.Equal(http.StatusConflict, issue(`{"common_name": "denied"}`, nil))
+}
@@ -0,0 +1,87 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/logging"
+	"github.com/rrasulzade/tcp-lb-go/server"
+)
+
+// handleDrain drains the load balancer server, streaming its progress as
+// newline-delimited JSON until the drain completes or times out. GET is
+// accepted along with POST so that the endpoint can be called from a
+// Kubernetes preStop httpGet hook. The readiness delay and timeout
+// default to the configured ones and can be set with the
+// "readiness_delay" and "timeout" query parameters, e.g. "30s".
+func (s *Server) handleDrain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	readinessDelay, err := durationParam(r, "readiness_delay", s.config.DefaultReadinessDelay)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	timeout, err := durationParam(r, "timeout", s.config.DefaultDrainTimeout)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	encoder := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	progress := func(p server.DrainProgress) {
+		if p.Phase == server.DrainNotReady {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+		}
+		encoder.Encode(p)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	_, err = s.config.ProxyServer.Drain(r.Context(), readinessDelay, timeout, progress)
+	if errors.Is(err, server.ErrDrainInProgress) {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		logging.Warnf("Drain requested over the admin API was aborted: %v", err)
+	}
+}
+
+// handleReady reports whether the load balancer server accepts new
+// traffic, responding with 503 once it is draining.
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	if !s.config.ProxyServer.Ready() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "not_ready"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+// durationParam parses the named query parameter as a non-negative
+// duration, returning def if it is not set.
+func durationParam(r *http.Request, name string, def time.Duration) (time.Duration, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid %s '%s'", name, value)
+	}
+	return d, nil
+}
@@ -0,0 +1,29 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+)
+
+// handleExplainRoute serves which backend a new connection of the
+// client_id, from the optional source_ip, would be routed to in the
+// current state, along with the score
+// of each candidate backend and why ineligible ones were skipped, to debug
+// the traffic distribution without sending real traffic.
+func (s *Server) handleExplainRoute(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	clientID := r.URL.Query().Get("client_id")
+	if clientID == "" {
+		writeError(w, http.StatusBadRequest, errors.New("client_id is required"))
+		return
+	}
+
+	explanation, err := s.config.ProxyServer.ExplainRoute(clientID, r.URL.Query().Get("source_ip"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, explanation)
+}
@@ -0,0 +1,68 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rrasulzade/tcp-lb-go/featureflag"
+)
+
+// setFeatureRequest is the body of a feature flag change request.
+type setFeatureRequest struct {
+	// Name identifies the behavior.
+	Name string `json:"name"`
+
+	// Enabled turns the behavior on.
+	Enabled bool `json:"enabled"`
+
+	// Pools limits the behavior to these pools. Optional.
+	Pools []string `json:"pools"`
+
+	// Percentage is the share of connections the behavior is
+	// turned on for. Optional, defaults to 100.
+	Percentage *float64 `json:"percentage"`
+}
+
+// handleFeatures lists the feature flags and adds or replaces a flag,
+// e.g. to widen the rollout of an experimental behavior or to turn it
+// off at once. Changes apply to new connections until the next restart.
+func (s *Server) handleFeatures(w http.ResponseWriter, r *http.Request) {
+	flags := s.config.FeatureFlags
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, flags.Flags())
+
+	case http.MethodPut:
+		var req setFeatureRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if req.Name == "" {
+			writeError(w, http.StatusBadRequest, errors.New("name is required"))
+			return
+		}
+		percentage := 100.0
+		if req.Percentage != nil {
+			percentage = *req.Percentage
+		}
+		flag := featureflag.Flag{
+			Name:       req.Name,
+			Enabled:    req.Enabled,
+			Pools:      req.Pools,
+			Percentage: percentage,
+		}
+		if err := flags.Set(flag); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, flags.Flags())
+
+	default:
+		w.Header().Set("Allow", strings.Join([]string{http.MethodGet, http.MethodPut}, ", "))
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
@@ -0,0 +1,98 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/lib"
+	"github.com/rrasulzade/tcp-lb-go/metrics"
+)
+
+// latencyDistribution describes the latency distribution of a backend
+// in one phase, in milliseconds.
+type latencyDistribution struct {
+	// Count is the number of observations.
+	Count uint64 `json:"count"`
+
+	// Mean is the mean latency.
+	Mean float64 `json:"mean"`
+
+	// P50, P90 and P99 are the estimated percentiles.
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+
+	// Buckets maps a bucket upper bound ("+Inf" for the last one)
+	// to its number of observations, not cumulative.
+	Buckets map[string]uint64 `json:"buckets"`
+}
+
+// newLatencyDistribution describes the histogram snapshot.
+func newLatencyDistribution(snapshot metrics.HistogramSnapshot) latencyDistribution {
+	d := latencyDistribution{
+		Count:   snapshot.Count,
+		Buckets: make(map[string]uint64, len(snapshot.Counts)),
+	}
+	for i, count := range snapshot.Counts {
+		le := "+Inf"
+		if i < len(snapshot.Bounds) {
+			le = strconv.FormatFloat(snapshot.Bounds[i], 'g', -1, 64)
+		}
+		d.Buckets[le] = count
+	}
+	if snapshot.Count > 0 {
+		d.Mean = snapshot.Sum / float64(snapshot.Count)
+		d.P50 = snapshot.Quantile(0.5)
+		d.P90 = snapshot.Quantile(0.9)
+		d.P99 = snapshot.Quantile(0.99)
+	}
+	return d
+}
+
+// backendLatency describes the latency distributions of a backend.
+type backendLatency struct {
+	// Address is the address of the backend.
+	Address string `json:"address"`
+
+	// Pool is the pool of the backend.
+	Pool string `json:"pool"`
+
+	// Latency maps a phase, e.g. "dial", to its latency distribution.
+	Latency map[lib.LatencyPhase]latencyDistribution `json:"latency"`
+
+	// ResetAt is the time the distributions were last reset. Nil if
+	// they include every observation since the start.
+	ResetAt *time.Time `json:"reset_at,omitempty"`
+}
+
+// handleBackendLatency serves the dial and first-byte latency distributions
+// of every backend, so that backends can be compared to spot a slow replica.
+// Distributions only include the observations since their last reset.
+func (s *Server) handleBackendLatency(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	backends := s.config.LoadBalancer.Backends()
+	latencies := make([]backendLatency, 0, len(backends))
+	for _, backend := range backends {
+		latency := backendLatency{
+			Address: backend.Address,
+			Pool:    backend.Pool,
+			Latency: make(map[lib.LatencyPhase]latencyDistribution),
+		}
+		for phase, family := range s.config.BackendLatencies {
+			h, ok := family.Lookup(backend.Pool, backend.Address)
+			if !ok {
+				continue
+			}
+			key := latencyKey{phase: phase, pool: backend.Pool, address: backend.Address}
+			snapshot, resetAt := s.latencySince(key, h.Snapshot())
+			latency.Latency[phase] = newLatencyDistribution(snapshot)
+			latency.ResetAt = resetAt
+		}
+		latencies = append(latencies, latency)
+	}
+	writeJSON(w, http.StatusOK, latencies)
+}
@@ -0,0 +1,43 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rrasulzade/tcp-lb-go/logging"
+)
+
+// logLevel is the body of log level requests and responses.
+type logLevel struct {
+	// Level is the minimum level of logged messages, e.g. "debug".
+	Level string `json:"level"`
+}
+
+// handleLogLevel returns or changes the log level at runtime, so that
+// verbose logging can be enabled while investigating without a restart.
+func (s *Server) handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, logLevel{Level: logging.GetLevel().String()})
+
+	case http.MethodPut:
+		var req logLevel
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		level, err := logging.ParseLevel(req.Level)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		logging.SetLevel(level)
+		logging.Infof("Log level set to %s", level)
+		writeJSON(w, http.StatusOK, logLevel{Level: level.String()})
+
+	default:
+		w.Header().Set("Allow", strings.Join([]string{http.MethodGet, http.MethodPut}, ", "))
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
@@ -0,0 +1,107 @@
+package admin
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rrasulzade/tcp-lb-go/logging"
+)
+
+// startMaintenanceRequest is the body of a request to put a pool in maintenance.
+type startMaintenanceRequest struct {
+	// Pool is the name of the pool.
+	Pool string `json:"pool"`
+
+	// Message is the text sent to the clients of the pool. Optional.
+	Message string `json:"message"`
+
+	// MessageHex is the hex-encoded message sent to the clients of the
+	// pool, for binary protocols. Optional.
+	MessageHex string `json:"message_hex"`
+}
+
+// maintenanceStatus describes a pool in maintenance.
+type maintenanceStatus struct {
+	// Message is the message sent to the clients of the pool,
+	// if it is valid UTF-8.
+	Message string `json:"message,omitempty"`
+
+	// MessageHex is the hex-encoded message otherwise.
+	MessageHex string `json:"message_hex,omitempty"`
+}
+
+// message returns the decoded message of the request.
+func (req *startMaintenanceRequest) message() ([]byte, error) {
+	if req.Message != "" && req.MessageHex != "" {
+		return nil, errors.New("only one of message or message_hex may be set")
+	}
+	if req.MessageHex != "" {
+		b, err := hex.DecodeString(req.MessageHex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid message_hex: %w", err)
+		}
+		return b, nil
+	}
+	return []byte(req.Message), nil
+}
+
+// handleMaintenance lists the pools in maintenance, and puts a pool in
+// maintenance or takes it out, so that planned downtime is reported to
+// the pool's clients rather than looking like connection failures.
+func (s *Server) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	lb := s.config.LoadBalancer
+
+	switch r.Method {
+	case http.MethodGet:
+		pools := make(map[string]maintenanceStatus)
+		for pool, message := range lb.Maintenance() {
+			if utf8.Valid(message) {
+				pools[pool] = maintenanceStatus{Message: string(message)}
+			} else {
+				pools[pool] = maintenanceStatus{MessageHex: hex.EncodeToString(message)}
+			}
+		}
+		writeJSON(w, http.StatusOK, pools)
+
+	case http.MethodPost:
+		var req startMaintenanceRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if req.Pool == "" {
+			writeError(w, http.StatusBadRequest, errors.New("pool is required"))
+			return
+		}
+		message, err := req.message()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		lb.StartMaintenance(req.Pool, message)
+		logging.Warnf("Pool %s is in maintenance", req.Pool)
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodDelete:
+		pool := r.URL.Query().Get("pool")
+		if pool == "" {
+			writeError(w, http.StatusBadRequest, errors.New("pool is required"))
+			return
+		}
+		if !lb.EndMaintenance(pool) {
+			writeError(w, http.StatusNotFound, fmt.Errorf("pool '%s' is not in maintenance", pool))
+			return
+		}
+		logging.Infof("Pool %s is no longer in maintenance", pool)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		methods := []string{http.MethodGet, http.MethodPost, http.MethodDelete}
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
@@ -0,0 +1,71 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// pinClientRequest is the body of a request to pin a client to a backend.
+type pinClientRequest struct {
+	// ClientID is the ID of the client.
+	ClientID string `json:"client_id"`
+
+	// Pool is the migration-capable pool of the backend.
+	Pool string `json:"pool"`
+
+	// Backend is the address of the backend.
+	Backend string `json:"backend"`
+
+	// Duration is the time the client is pinned, e.g. "30m".
+	Duration string `json:"duration"`
+}
+
+// handleClientPins lists, creates and removes the pins routing the next
+// connections of clients to a designated backend of a migration-capable
+// pool, e.g. to debug a client or migrate its data.
+func (s *Server) handleClientPins(w http.ResponseWriter, r *http.Request) {
+	proxyServer := s.config.ProxyServer
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, proxyServer.ClientPins())
+
+	case http.MethodPost:
+		var req pinClientRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		duration, err := time.ParseDuration(req.Duration)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("invalid duration"))
+			return
+		}
+		pin, err := proxyServer.PinClient(req.ClientID, req.Pool, req.Backend, duration)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, pin)
+
+	case http.MethodDelete:
+		clientID := r.URL.Query().Get("client_id")
+		if clientID == "" {
+			writeError(w, http.StatusBadRequest, errors.New("client_id is required"))
+			return
+		}
+		if err := proxyServer.UnpinClient(clientID); err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		methods := []string{http.MethodGet, http.MethodPost, http.MethodDelete}
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
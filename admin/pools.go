@@ -0,0 +1,80 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// switchPoolRequest is the body of a pool group switch request.
+type switchPoolRequest struct {
+	// Pool is the name of the pool to switch.
+	Pool string `json:"pool"`
+
+	// Group is the deployment group to switch the pool to.
+	Group string `json:"group"`
+
+	// GracePeriod is the time given to the previous group's connections
+	// before they are force-closed, e.g. "30s". Optional.
+	GracePeriod string `json:"grace_period"`
+}
+
+// switchPoolResponse is the body of a pool group switch response.
+type switchPoolResponse struct {
+	// Pool is the name of the switched pool.
+	Pool string `json:"pool"`
+
+	// ActiveGroup is the new active deployment group.
+	ActiveGroup string `json:"active_group"`
+
+	// GracePeriod is the applied grace period.
+	GracePeriod string `json:"grace_period"`
+
+	// Draining maps the drained backends to their active connection count.
+	Draining map[string]int64 `json:"draining"`
+}
+
+// handleSwitchPool switches a pool from its active deployment group to
+// another one, e.g. from blue to green, draining the previous group.
+func (s *Server) handleSwitchPool(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req switchPoolRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Pool == "" || req.Group == "" {
+		writeError(w, http.StatusBadRequest, errors.New("pool and group are required"))
+		return
+	}
+
+	gracePeriod := s.config.DefaultGracePeriod
+	if req.GracePeriod != "" {
+		var err error
+		gracePeriod, err = time.ParseDuration(req.GracePeriod)
+		if err != nil || gracePeriod < 0 {
+			writeError(w, http.StatusBadRequest, errors.New("invalid grace period"))
+			return
+		}
+	}
+
+	draining, err := s.config.LoadBalancer.SwitchPoolGroup(req.Pool, req.Group, gracePeriod)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	resp := switchPoolResponse{
+		Pool:        req.Pool,
+		ActiveGroup: req.Group,
+		GracePeriod: gracePeriod.String(),
+		Draining:    make(map[string]int64, len(draining)),
+	}
+	for _, backend := range draining {
+		resp.Draining[backend.Address] = backend.ConnectionCount()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,95 @@
+package admin
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// publishRuntime ensures the runtime variables are published once, as
+// expvar panics when a variable is published twice.
+var publishRuntime sync.Once
+
+// gcStats are the garbage collector statistics published as expvar.
+type gcStats struct {
+	// NumGC is the number of completed GC cycles.
+	NumGC uint32 `json:"num_gc"`
+
+	// PauseTotalNs is the cumulative stop-the-world pause time.
+	PauseTotalNs uint64 `json:"pause_total_ns"`
+
+	// LastPauseNs is the pause time of the last GC cycle.
+	LastPauseNs uint64 `json:"last_pause_ns"`
+
+	// LastGC is the time the last GC cycle finished, zero if none did.
+	LastGC time.Time `json:"last_gc"`
+
+	// HeapAlloc is the number of bytes of allocated heap objects.
+	HeapAlloc uint64 `json:"heap_alloc"`
+
+	// HeapSys is the number of bytes of heap memory obtained from the OS.
+	HeapSys uint64 `json:"heap_sys"`
+
+	// NextGC is the heap size the next GC cycle targets.
+	NextGC uint64 `json:"next_gc"`
+
+	// GCCPUFraction is the share of CPU time used by the GC since the
+	// process started.
+	GCCPUFraction float64 `json:"gc_cpu_fraction"`
+}
+
+// readGCStats reads the garbage collector statistics.
+func readGCStats() gcStats {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	stats := gcStats{
+		NumGC:         memStats.NumGC,
+		PauseTotalNs:  memStats.PauseTotalNs,
+		HeapAlloc:     memStats.HeapAlloc,
+		HeapSys:       memStats.HeapSys,
+		NextGC:        memStats.NextGC,
+		GCCPUFraction: memStats.GCCPUFraction,
+	}
+	if memStats.NumGC > 0 {
+		stats.LastPauseNs = memStats.PauseNs[(memStats.NumGC+255)%256]
+		stats.LastGC = time.Unix(0, int64(memStats.LastGC))
+	}
+	return stats
+}
+
+// publishRuntimeVars publishes the goroutine count, garbage collector
+// statistics and open file descriptor count of the process as expvar
+// variables, evaluated when they are served.
+func publishRuntimeVars() {
+	publishRuntime.Do(func() {
+		expvar.Publish("goroutines", expvar.Func(func() any {
+			return runtime.NumGoroutine()
+		}))
+		expvar.Publish("gc", expvar.Func(func() any {
+			return readGCStats()
+		}))
+		expvar.Publish("open_fds", expvar.Func(func() any {
+			// Reported as null where counting is not supported
+			if count, ok := openFDs(); ok {
+				return count
+			}
+			return nil
+		}))
+	})
+}
+
+// handleRuntimeVars serves the expvar variables, including those of
+// publishRuntimeVars, so that the health of the process can be watched
+// without a metrics stack.
+func (s *Server) handleRuntimeVars(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	expvar.Handler().ServeHTTP(w, r)
+}
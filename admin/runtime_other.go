@@ -0,0 +1,9 @@
+//go:build !linux
+
+package admin
+
+// openFDs returns the number of file descriptors open in the process.
+// Counting them is only supported on Linux.
+func openFDs() (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,61 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/rrasulzade/tcp-lb-go/lib"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuntimeVars(t *testing.T) {
+	require := require.New(t)
+
+	s, err := NewServer(&AdminConfig{
+		Address:      "127.0.0.1:0",
+		LoadBalancer: lib.NewLoadBalancer(100, 100),
+		Tokens:       []string{"secret"},
+	})
+	require.NoError(err)
+	// Creating a second server does not publish the variables twice
+	_, err = NewServer(&AdminConfig{Address: "127.0.0.1:0", LoadBalancer: lib.NewLoadBalancer(100, 100)})
+	require.NoError(err)
+	admin := httptest.NewServer(s.httpServer.Handler)
+	defer admin.Close()
+
+	get := func(method, token string) *http.Response {
+		req, err := http.NewRequest(method, admin.URL+"/debug/vars", nil)
+		require.NoError(err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	// The variables require authentication like the rest of the admin API
+	require.Equal(http.StatusUnauthorized, get(http.MethodGet, "").StatusCode)
+	require.Equal(http.StatusMethodNotAllowed, get(http.MethodPost, "secret").StatusCode)
+
+	resp := get(http.MethodGet, "secret")
+	require.Equal(http.StatusOK, resp.StatusCode)
+	var vars struct {
+		Goroutines int      `json:"goroutines"`
+		GC         gcStats  `json:"gc"`
+		OpenFDs    *int     `json:"open_fds"`
+		Cmdline    []string `json:"cmdline"`
+	}
+	require.NoError(json.NewDecoder(resp.Body).Decode(&vars))
+	require.Positive(vars.Goroutines)
+	require.Positive(vars.GC.HeapSys)
+	require.NotEmpty(vars.Cmdline, "Expected the standard expvar variables to be served")
+	if runtime.GOOS == "linux" {
+		require.NotNil(vars.OpenFDs)
+		require.Positive(*vars.OpenFDs)
+	}
+}
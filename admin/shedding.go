@@ -0,0 +1,47 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// shedding is the body of shedding requests and responses.
+type shedding struct {
+	// Percent is the percentage of new connections shed, from 0 to 100.
+	Percent *int `json:"percent"`
+}
+
+// handleShedding returns or changes the percentage of new connections
+// shed regardless of overload, so that external remediation tooling can
+// relieve an overloaded cluster gradually instead of draining instances.
+func (s *Server) handleShedding(w http.ResponseWriter, r *http.Request) {
+	proxy := s.config.ProxyServer
+
+	switch r.Method {
+	case http.MethodGet:
+		percent := proxy.ShedPercent()
+		writeJSON(w, http.StatusOK, shedding{Percent: &percent})
+
+	case http.MethodPut:
+		var req shedding
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if req.Percent == nil {
+			writeError(w, http.StatusBadRequest, errors.New("percent is required"))
+			return
+		}
+		if err := proxy.SetShedPercent(*req.Percent); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, req)
+
+	default:
+		w.Header().Set("Allow", strings.Join([]string{http.MethodGet, http.MethodPut}, ", "))
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
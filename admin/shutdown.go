@@ -0,0 +1,23 @@
+package admin
+
+import "net/http"
+
+// shutdownResponse is the body of shutdown responses.
+type shutdownResponse struct {
+	// Status is "shutting_down" once the shutdown was requested.
+	Status string `json:"status"`
+}
+
+// handleShutdown stops the load balancer gracefully, as on SIGTERM. The
+// response is sent before the shutdown starts; a drain should precede it
+// so that no new traffic is sent to the load balancer meanwhile.
+func (s *Server) handleShutdown(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	writeJSON(w, http.StatusAccepted, shutdownResponse{Status: "shutting_down"})
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	s.config.Shutdown()
+}
@@ -0,0 +1,142 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/lib"
+	"github.com/rrasulzade/tcp-lb-go/logging"
+	"github.com/rrasulzade/tcp-lb-go/metrics"
+)
+
+// define statistics reset scopes.
+const (
+	statsScopeAll      = "all"
+	statsScopeClients  = "clients"
+	statsScopeBackends = "backends"
+)
+
+// resetStatsRequest is the body of a statistics reset request.
+type resetStatsRequest struct {
+	// Scope selects the statistics to reset: "clients", "backends"
+	// or "all". Optional, defaults to "all".
+	Scope string `json:"scope"`
+
+	// ClientID limits the reset to a client. Optional.
+	ClientID string `json:"client_id"`
+
+	// Backend limits the reset to the backends with an address. Optional.
+	Backend string `json:"backend"`
+}
+
+// resetStatsResponse is the body of a statistics reset response.
+type resetStatsResponse struct {
+	// ResetAt is the time of the reset.
+	ResetAt time.Time `json:"reset_at"`
+
+	// Clients is the number of clients reset.
+	Clients int `json:"clients"`
+
+	// Backends is the number of backends reset.
+	Backends int `json:"backends"`
+}
+
+// latencyKey identifies the latency histogram of a backend in a phase.
+type latencyKey struct {
+	phase   lib.LatencyPhase
+	pool    string
+	address string
+}
+
+// latencyBaseline is the snapshot of a latency histogram at a reset.
+type latencyBaseline struct {
+	// snapshot is the histogram at the reset.
+	snapshot metrics.HistogramSnapshot
+
+	// resetAt is the time of the reset.
+	resetAt time.Time
+}
+
+// handleResetStats resets the per-client connection statistics and the
+// per-backend latency distributions served by the admin API, so that they
+// can be compared before and after a change. The exposed metrics remain
+// monotonic: backend distributions are reported relative to a snapshot
+// taken at the reset, and every reset statistic carries its reset time.
+func (s *Server) handleResetStats(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req resetStatsRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Scope == "" {
+		req.Scope = statsScopeAll
+	}
+	clients := req.Scope == statsScopeAll || req.Scope == statsScopeClients
+	backends := req.Scope == statsScopeAll || req.Scope == statsScopeBackends
+	if !clients && !backends {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid scope '%s'", req.Scope))
+		return
+	}
+	if (clients && s.config.ProxyServer == nil) || (backends && s.config.BackendLatencies == nil) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%s statistics are not available", req.Scope))
+		return
+	}
+	if (req.ClientID != "" && !clients) || (req.Backend != "" && !backends) {
+		writeError(w, http.StatusBadRequest, errors.New("client_id and backend must match the scope"))
+		return
+	}
+
+	resp := resetStatsResponse{ResetAt: time.Now()}
+	if clients && req.Backend == "" {
+		resp.Clients = s.config.ProxyServer.ResetClientRates(req.ClientID)
+	}
+	if backends && req.ClientID == "" {
+		resp.Backends = s.resetBackendLatencies(req.Backend, resp.ResetAt)
+	}
+	logging.Infof("Statistics reset: %d clients, %d backends", resp.Clients, resp.Backends)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// resetBackendLatencies records the latency histograms of the backends
+// with the address, or of every backend if empty, as the baselines of
+// their distributions. Returns the number of backends reset.
+func (s *Server) resetBackendLatencies(address string, now time.Time) int {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	reset := 0
+	for _, backend := range s.config.LoadBalancer.Backends() {
+		if address != "" && backend.Address != address {
+			continue
+		}
+		for phase, family := range s.config.BackendLatencies {
+			key := latencyKey{phase: phase, pool: backend.Pool, address: backend.Address}
+			baseline := latencyBaseline{resetAt: now}
+			if h, ok := family.Lookup(backend.Pool, backend.Address); ok {
+				baseline.snapshot = h.Snapshot()
+			}
+			s.latencyBaselines[key] = baseline
+		}
+		reset++
+	}
+	return reset
+}
+
+// latencySince returns the latency histogram of a backend in a phase
+// since its last reset, along with the time of the reset if any.
+func (s *Server) latencySince(key latencyKey, snapshot metrics.HistogramSnapshot) (metrics.HistogramSnapshot, *time.Time) {
+	s.statsMu.Lock()
+	baseline, ok := s.latencyBaselines[key]
+	s.statsMu.Unlock()
+
+	if !ok {
+		return snapshot, nil
+	}
+	return snapshot.Since(baseline.snapshot), &baseline.resetAt
+}
@@ -0,0 +1,68 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rrasulzade/tcp-lb-go/lib"
+)
+
+// setClientCARequest is the body of a client CA bundle update request.
+type setClientCARequest struct {
+	// Name identifies the bundle. An existing bundle is replaced.
+	Name string `json:"name"`
+
+	// PEM holds the PEM encoded CA certificates of the bundle.
+	PEM string `json:"pem"`
+}
+
+// handleClientCAs lists, adds or replaces, and removes the bundles of
+// CAs trusted to sign client certificates, e.g. to trust both the old
+// and the new CA during a rotation and then remove the old one.
+func (s *Server) handleClientCAs(w http.ResponseWriter, r *http.Request) {
+	clientCAs := s.config.ClientCAs
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, clientCAs.Bundles())
+
+	case http.MethodPut:
+		var req setClientCARequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if req.Name == "" || req.PEM == "" {
+			writeError(w, http.StatusBadRequest, errors.New("name and pem are required"))
+			return
+		}
+		if err := clientCAs.Set(req.Name, []byte(req.PEM)); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, clientCAs.Bundles())
+
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			writeError(w, http.StatusBadRequest, errors.New("name is required"))
+			return
+		}
+		if err := clientCAs.Remove(name); err != nil {
+			status := http.StatusConflict
+			if errors.Is(err, lib.ErrUnknownClientCA) {
+				status = http.StatusNotFound
+			}
+			writeError(w, status, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, clientCAs.Bundles())
+
+	default:
+		methods := []string{http.MethodGet, http.MethodPut, http.MethodDelete}
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
@@ -0,0 +1,162 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/lib"
+	"github.com/rrasulzade/tcp-lb-go/logging"
+)
+
+// backendRefRequest identifies a backend to remove.
+type backendRefRequest struct {
+	// Pool is the pool of the backend.
+	Pool string `json:"pool"`
+
+	// Address is the address of the backend.
+	Address string `json:"address"`
+}
+
+// addBackendRequest describes a backend to add.
+type addBackendRequest struct {
+	// Pool is the pool the backend joins.
+	Pool string `json:"pool"`
+
+	// Address is the address of the backend.
+	Address string `json:"address"`
+
+	// Group is the deployment group of the backend. Optional.
+	Group string `json:"group"`
+
+	// FailureDomain is the failure domain of the backend. Optional.
+	FailureDomain string `json:"failure_domain"`
+
+	// MaxConnections is the connection limit of the backend. Optional,
+	// defaults to the configured limit of backends.
+	MaxConnections *int64 `json:"max_connections"`
+}
+
+// backendTransactionRequest is the body of a backend transaction request.
+type backendTransactionRequest struct {
+	// Remove lists the backends to remove.
+	Remove []backendRefRequest `json:"remove"`
+
+	// Add lists the backends to add.
+	Add []addBackendRequest `json:"add"`
+
+	// Weights lists the weight changes.
+	Weights []setWeightRequest `json:"weights"`
+}
+
+// backendTransactionResponse is the body of a backend transaction response.
+type backendTransactionResponse struct {
+	// Applied is set if the transaction was applied rather than only validated.
+	Applied bool `json:"applied"`
+
+	// Added are the added backends.
+	Added []backendWeight `json:"added"`
+
+	// Removed are the removed backends.
+	Removed []backendWeight `json:"removed"`
+
+	// Reweighted are the backends whose weight changed.
+	Reweighted []backendWeight `json:"reweighted"`
+}
+
+// transaction converts the request into a backend transaction.
+func (req *backendTransactionRequest) transaction(defaultMaxConnections int64) (lib.BackendTransaction, error) {
+	var tx lib.BackendTransaction
+	for _, ref := range req.Remove {
+		if ref.Pool == "" || ref.Address == "" {
+			return tx, errors.New("pool and address of removed backends are required")
+		}
+		tx.Remove = append(tx.Remove, lib.BackendRef{Pool: ref.Pool, Address: ref.Address})
+	}
+	for _, add := range req.Add {
+		if add.Pool == "" || add.Address == "" {
+			return tx, errors.New("pool and address of added backends are required")
+		}
+		maxConnections := defaultMaxConnections
+		if add.MaxConnections != nil {
+			maxConnections = *add.MaxConnections
+		}
+		tx.Add = append(tx.Add, &lib.Backend{
+			Address:        add.Address,
+			Pool:           add.Pool,
+			Group:          add.Group,
+			FailureDomain:  add.FailureDomain,
+			MaxConnections: maxConnections,
+		})
+	}
+	for _, change := range req.Weights {
+		if change.Address == "" || change.Weight == nil {
+			return tx, errors.New("address and weight of weight changes are required")
+		}
+		var ramp time.Duration
+		if change.Ramp != "" {
+			var err error
+			ramp, err = time.ParseDuration(change.Ramp)
+			if err != nil {
+				return tx, fmt.Errorf("invalid ramp of backend %s", change.Address)
+			}
+		}
+		tx.Weights = append(tx.Weights, lib.WeightChange{Address: change.Address, Weight: *change.Weight, Ramp: ramp})
+	}
+	if len(tx.Remove)+len(tx.Add)+len(tx.Weights) == 0 {
+		return tx, errors.New("transaction has no changes")
+	}
+	return tx, nil
+}
+
+// handleBackendTransaction adds and removes backends and changes their
+// weights as a single transaction, which is validated as a whole and
+// applied atomically, so that a pool is never left in an intermediate
+// state; with dry_run=true it is only validated.
+func (s *Server) handleBackendTransaction(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	dryRun, err := parseDryRun(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var req backendTransactionRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	tx, err := req.transaction(s.config.DefaultMaxBackendConnections)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	lb := s.config.LoadBalancer
+	if dryRun {
+		if err := lb.ValidateBackendTransaction(tx); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, backendTransactionResponse{})
+		return
+	}
+
+	result, err := lb.ApplyBackendTransaction(tx)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	logging.Infof("Backend transaction applied: %d added, %d removed, %d reweighted",
+		len(result.Added), len(result.Removed), len(result.Reweighted))
+	writeJSON(w, http.StatusOK, backendTransactionResponse{
+		Applied:    true,
+		Added:      backendWeights(result.Added),
+		Removed:    backendWeights(result.Removed),
+		Reweighted: backendWeights(result.Reweighted),
+	})
+}
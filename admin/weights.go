@@ -0,0 +1,114 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/lib"
+)
+
+// setWeightRequest is the body of a backend weight change request.
+type setWeightRequest struct {
+	// Address is the address of the backend.
+	Address string `json:"address"`
+
+	// Weight is the new weight of the backend.
+	Weight *int `json:"weight"`
+
+	// Ramp is the time over which the weight moves to the new value,
+	// e.g. "5m". Optional, the weight is applied at once if empty.
+	Ramp string `json:"ramp"`
+}
+
+// backendWeight describes the weight of a backend.
+type backendWeight struct {
+	// Address is the address of the backend.
+	Address string `json:"address"`
+
+	// Pool is the pool of the backend.
+	Pool string `json:"pool"`
+
+	// Weight is the current weight of the backend.
+	Weight int `json:"weight"`
+
+	// TargetWeight is the weight the backend is ramping to.
+	TargetWeight int `json:"target_weight"`
+
+	// EffectiveWeight is the weight of the backend adjusted by health
+	// checks, which is used for selection.
+	EffectiveWeight int `json:"effective_weight"`
+
+	// Connections is the active connection count of the backend.
+	Connections int64 `json:"connections"`
+}
+
+// newBackendWeight describes the weight of the backend.
+func newBackendWeight(backend *lib.Backend) backendWeight {
+	return backendWeight{
+		Address:         backend.Address,
+		Pool:            backend.Pool,
+		Weight:          backend.Weight(),
+		TargetWeight:    backend.TargetWeight(),
+		EffectiveWeight: backend.EffectiveWeight(),
+		Connections:     backend.ConnectionCount(),
+	}
+}
+
+// backendWeights describes the weights of the backends.
+func backendWeights(backends []*lib.Backend) []backendWeight {
+	weights := make([]backendWeight, len(backends))
+	for i, backend := range backends {
+		weights[i] = newBackendWeight(backend)
+	}
+	return weights
+}
+
+// handleBackendWeights lists the backend weights and changes the weight
+// of a backend, optionally ramping it over time so that traffic shifts
+// gradually.
+func (s *Server) handleBackendWeights(w http.ResponseWriter, r *http.Request) {
+	lb := s.config.LoadBalancer
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, backendWeights(lb.Backends()))
+
+	case http.MethodPut:
+		var req setWeightRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if req.Address == "" || req.Weight == nil {
+			writeError(w, http.StatusBadRequest, errors.New("address and weight are required"))
+			return
+		}
+		var ramp time.Duration
+		if req.Ramp != "" {
+			var err error
+			ramp, err = time.ParseDuration(req.Ramp)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, errors.New("invalid ramp"))
+				return
+			}
+		}
+
+		updated, err := lb.SetBackendWeight(req.Address, *req.Weight, ramp)
+		if errors.Is(err, lib.ErrUnknownBackend) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, backendWeights(updated))
+
+	default:
+		w.Header().Set("Allow", strings.Join([]string{http.MethodGet, http.MethodPut}, ", "))
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
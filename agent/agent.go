@@ -0,0 +1,148 @@
+// Package agent implements an agent-check listener in the style of the
+// HAProxy agent-check text protocol, so that external load balancers can
+// query this instance's own availability and weight.
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/listen"
+	"github.com/rrasulzade/tcp-lb-go/logging"
+)
+
+// writeTimeout bounds the time taken to write a reply to a slow agent client.
+const writeTimeout = time.Second
+
+// State is the availability of the instance reported to agent clients.
+type State string
+
+// define agent states.
+const (
+	// StateUp reports the instance as available at the given weight.
+	StateUp State = "up"
+
+	// StateDrain reports that the instance no longer takes new connections.
+	StateDrain State = "drain"
+
+	// StateDown reports the instance as unavailable.
+	StateDown State = "down"
+)
+
+// Status is the reply sent to agent clients.
+type Status struct {
+	// State is the availability of the instance.
+	State State
+
+	// Weight is the percentage of the configured weight at which the
+	// instance takes new connections. Only sent with StateUp.
+	Weight int
+
+	// Message describes the status. Optional.
+	Message string
+}
+
+// String formats the status as an agent-check reply line
+// without the trailing newline, e.g. "up 75%" or "down #reason".
+func (s Status) String() string {
+	var sb strings.Builder
+	sb.WriteString(string(s.State))
+	if s.State == StateUp {
+		fmt.Fprintf(&sb, " %d%%", s.Weight)
+	}
+	if s.Message != "" {
+		sb.WriteString(" #")
+		// The reply is a single line
+		sb.WriteString(strings.ReplaceAll(s.Message, "\n", " "))
+	}
+	return sb.String()
+}
+
+// AgentConfig encapsulates the configuration parameters required
+// to initialize and run the agent listener.
+type AgentConfig struct {
+	// Address is an address on which the agent listens.
+	Address string
+
+	// Status returns the current status of the instance.
+	Status func() Status
+
+	// ListenRetry defines how binding an address in use is retried.
+	ListenRetry listen.Retry
+}
+
+// Server replies to every agent connection with the current status
+// of the instance and closes it.
+type Server struct {
+	// config is configuration object that holds all the agent settings.
+	config *AgentConfig
+
+	// listener accepts agent connections.
+	listener net.Listener
+
+	// wg waits for the accept loop to exit.
+	wg sync.WaitGroup
+}
+
+// NewServer creates a new agent Server instance.
+func NewServer(config *AgentConfig) (*Server, error) {
+	if config.Address == "" {
+		return nil, errors.New("provided agent address is blank")
+	}
+	if config.Status == nil {
+		return nil, errors.New("agent status function is required")
+	}
+	return &Server{config: config}, nil
+}
+
+// Start initializes the agent listener and starts replying to connections.
+func (s *Server) Start() error {
+	listener, err := listen.Listen(s.config.Address, s.config.ListenRetry)
+	if err != nil {
+		return fmt.Errorf("unable to initialize agent listener: %w", err)
+	}
+	s.listener = listener
+
+	logging.Infof("Agent is listening on %s", listener.Addr())
+	s.wg.Add(1)
+	go s.acceptConnections()
+	return nil
+}
+
+// Stop closes the agent listener.
+func (s *Server) Stop() error {
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+// Addr returns the address the agent listens on.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// acceptConnections replies to agent connections until the listener is closed.
+func (s *Server) acceptConnections() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			logging.Errorf("Error accepting agent connection: %v", err)
+			continue
+		}
+
+		// Replies are short, so they are written inline. Anything sent
+		// by the client (e.g. HAProxy's agent-send) is ignored.
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		fmt.Fprintf(conn, "%s\n", s.config.Status())
+		conn.Close()
+	}
+}
@@ -0,0 +1,40 @@
+package agent
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusString(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal("up 75%", Status{State: StateUp, Weight: 75}.String())
+	require.Equal("drain", Status{State: StateDrain, Weight: 75}.String())
+	require.Equal("down #accept loop\tis wedged", Status{State: StateDown, Message: "accept loop\tis wedged"}.String())
+	require.Equal("down #a b", Status{State: StateDown, Message: "a\nb"}.String())
+}
+
+func TestServer(t *testing.T) {
+	require := require.New(t)
+
+	status := Status{State: StateUp, Weight: 100}
+	s, err := NewServer(&AgentConfig{
+		Address: "127.0.0.1:0",
+		Status:  func() Status { return status },
+	})
+	require.NoError(err)
+	require.NoError(s.Start())
+	defer s.Stop()
+
+	conn, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(err)
+	reply, err := io.ReadAll(conn)
+	require.NoError(err)
+	require.Equal("up 100%\n", string(reply))
+
+	_, err = NewServer(&AgentConfig{Address: "127.0.0.1:0"})
+	require.Error(err)
+}
@@ -0,0 +1,87 @@
+// Package audit records runtime configuration changes to an append-only
+// log, so that every change of access control lists, backends or limits
+// can be traced to the identity that requested it.
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Entry describes a change requested at runtime.
+type Entry struct {
+	// Time is the time the change was requested.
+	Time time.Time `json:"time"`
+
+	// Identity describes who requested the change.
+	Identity string `json:"identity"`
+
+	// RemoteAddr is the address the change was requested from.
+	RemoteAddr string `json:"remote_addr"`
+
+	// Method and Path identify the requested change.
+	Method string `json:"method"`
+	Path   string `json:"path"`
+
+	// Query is the query string of the request, if any.
+	Query string `json:"query,omitempty"`
+
+	// Request is the body of the request, describing the change.
+	Request json.RawMessage `json:"request,omitempty"`
+
+	// Status is the HTTP status of the response.
+	Status int `json:"status"`
+
+	// Response is the body of the response, describing the outcome.
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+// Log appends entries to a file as JSON lines. Entries are never
+// rewritten; the file is only opened in append mode.
+type Log struct {
+	// mu serializes the writes of entries.
+	mu sync.Mutex
+
+	// file is the audit log file.
+	file *os.File
+}
+
+// Open opens the audit log file for appending, creating it if it does
+// not exist.
+func Open(path string) (*Log, error) {
+	if path == "" {
+		return nil, errors.New("audit log path is blank")
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open audit log: %w", err)
+	}
+	return &Log{file: file}, nil
+}
+
+// Record appends the entry to the log and syncs it to disk, so that
+// recorded changes survive a crash.
+func (l *Log) Record(entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("unable to encode audit entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err := l.file.Write(line); err != nil {
+		return fmt.Errorf("unable to write audit entry: %w", err)
+	}
+	return l.file.Sync()
+}
+
+// Close closes the audit log file.
+func (l *Log) Close() error {
+	return l.file.Close()
+}
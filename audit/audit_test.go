@@ -0,0 +1,59 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func readEntries(t *testing.T, path string) []Entry {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry Entry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestRecord(t *testing.T) {
+	require := require.New(t)
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	log, err := Open(path)
+	require.NoError(err)
+	require.NoError(log.Record(Entry{
+		Time:     time.Now(),
+		Identity: "cn:operator",
+		Method:   "PUT",
+		Path:     "/acl",
+		Request:  json.RawMessage(`{"client1":["127.0.0.1:5001"]}`),
+		Status:   200,
+	}))
+	require.NoError(log.Close())
+
+	// Reopening appends to the existing entries
+	log, err = Open(path)
+	require.NoError(err)
+	require.NoError(log.Record(Entry{Time: time.Now(), Identity: "anonymous", Method: "POST", Path: "/drain", Status: 202}))
+	require.NoError(log.Close())
+
+	entries := readEntries(t, path)
+	require.Len(entries, 2)
+	require.Equal("cn:operator", entries[0].Identity)
+	require.JSONEq(`{"client1":["127.0.0.1:5001"]}`, string(entries[0].Request))
+	require.Equal("/drain", entries[1].Path)
+
+	_, err = Open("")
+	require.Error(err)
+}
@@ -0,0 +1,248 @@
+package capture
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Direction is the direction of a captured chunk of data.
+type Direction string
+
+// define capture directions.
+const (
+	// FromClient is data sent by the client to the backend.
+	FromClient Direction = "client"
+
+	// FromBackend is data sent by the backend to the client.
+	FromBackend Direction = "backend"
+)
+
+// Record is a chunk of data captured on a connection. Captures are stored
+// as newline-delimited JSON records, with the data encoded in base64.
+type Record struct {
+	// Offset is the time since the start of the capture.
+	Offset time.Duration `json:"offset"`
+
+	// Direction is the direction of the data.
+	Direction Direction `json:"direction"`
+
+	// Data is the captured data.
+	Data []byte `json:"data"`
+}
+
+// Writer writes the records of a capture.
+type Writer struct {
+	// mu ensures concurrent writes from both directions.
+	mu sync.Mutex
+
+	// encoder encodes the records.
+	encoder *json.Encoder
+
+	// start is the time the capture started.
+	start time.Time
+
+	// err is the first write error, after which records are dropped.
+	err error
+}
+
+// NewWriter creates a Writer starting a capture now.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		encoder: json.NewEncoder(w),
+		start:   time.Now(),
+	}
+}
+
+// Write records a chunk of data in the given direction.
+func (w *Writer) Write(direction Direction, data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+	w.err = w.encoder.Encode(Record{
+		Offset:    time.Since(w.start),
+		Direction: direction,
+		Data:      data,
+	})
+	return w.err
+}
+
+// Conn captures the data read from and written to a client connection.
+type Conn struct {
+	net.Conn
+
+	// writer records the captured data.
+	writer *Writer
+}
+
+// NewConn returns a connection capturing the data of a client connection:
+// data read is recorded as sent by the client, data written as sent by
+// the backend.
+func NewConn(conn net.Conn, writer *Writer) *Conn {
+	return &Conn{Conn: conn, writer: writer}
+}
+
+// Read implements net.Conn.
+func (c *Conn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.writer.Write(FromClient, b[:n])
+	}
+	return n, err
+}
+
+// Write implements net.Conn.
+func (c *Conn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.writer.Write(FromBackend, b[:n])
+	}
+	return n, err
+}
+
+// CloseWrite half-closes the underlying connection if supported.
+func (c *Conn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// ReadRecords reads all the records of a capture.
+func ReadRecords(r io.Reader) ([]Record, error) {
+	var records []Record
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("invalid capture record on line %d: %w", line, err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read capture: %w", err)
+	}
+	return records, nil
+}
+
+// ReplayResult summarizes a replay.
+type ReplayResult struct {
+	// Sent is the number of bytes sent to the backend.
+	Sent int64
+
+	// Received is the number of bytes received from the backend.
+	Received int64
+
+	// Expected is the number of bytes the backend sent in the capture.
+	Expected int64
+
+	// Duration is the time the replay took.
+	Duration time.Duration
+}
+
+// String summarizes the replay.
+func (r ReplayResult) String() string {
+	return fmt.Sprintf("sent %d bytes, received %d bytes (%d captured) in %s",
+		r.Sent, r.Received, r.Expected, r.Duration)
+}
+
+// Replay sends the client data of the records to the backend connection,
+// preserving the captured timing divided by speed, and reads the backend's
+// responses until it closes the connection, ctx is done, or no data
+// arrives for idleTimeout after the last record was sent.
+func Replay(ctx context.Context, conn net.Conn, records []Record, speed float64, idleTimeout time.Duration) (ReplayResult, error) {
+	var result ReplayResult
+	start := time.Now()
+
+	// Read the backend's responses concurrently
+	received := make(chan error, 1)
+	var receivedBytes int64
+	lastRead := make(chan struct{}, 1)
+	go func() {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := conn.Read(buf)
+			if n > 0 {
+				receivedBytes += int64(n)
+				select {
+				case lastRead <- struct{}{}:
+				default:
+				}
+			}
+			if err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+				received <- err
+				return
+			}
+		}
+	}()
+
+	for _, record := range records {
+		if record.Direction != FromClient {
+			result.Expected += int64(len(record.Data))
+			continue
+		}
+
+		wait := time.Until(start.Add(time.Duration(float64(record.Offset) / speed)))
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			conn.Close()
+			<-received
+			return result, ctx.Err()
+		case <-timer.C:
+		}
+
+		n, err := conn.Write(record.Data)
+		result.Sent += int64(n)
+		if err != nil {
+			conn.Close()
+			<-received
+			return result, fmt.Errorf("sending captured data: %w", err)
+		}
+	}
+
+	// Wait for the backend's responses until it goes idle
+	idle := time.NewTimer(idleTimeout)
+	defer idle.Stop()
+	var err error
+	for done := false; !done; {
+		select {
+		case <-lastRead:
+			idle.Reset(idleTimeout)
+		case err = <-received:
+			done = true
+		case <-idle.C:
+			// Closing the connection is the expected end of the replay
+			conn.Close()
+			if err = <-received; errors.Is(err, net.ErrClosed) {
+				err = nil
+			}
+			done = true
+		case <-ctx.Done():
+			conn.Close()
+			<-received
+			err = ctx.Err()
+			done = true
+		}
+	}
+	result.Received = receivedBytes
+	result.Duration = time.Since(start)
+	return result, err
+}
@@ -0,0 +1,65 @@
+package capture
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCaptureAndReplay(t *testing.T) {
+	require := require.New(t)
+
+	// Capture an exchange on the client side of a connection
+	var buf bytes.Buffer
+	client, peer := net.Pipe()
+	conn := NewConn(peer, NewWriter(&buf))
+	go func() {
+		client.Write([]byte("HELLO"))
+		io.ReadFull(client, make([]byte, 2))
+		client.Write([]byte("BYE"))
+		client.Close()
+	}()
+	b := make([]byte, 5)
+	_, err := io.ReadFull(conn, b)
+	require.NoError(err)
+	_, err = conn.Write([]byte("OK"))
+	require.NoError(err)
+	_, err = io.ReadFull(conn, b[:3])
+	require.NoError(err)
+
+	records, err := ReadRecords(&buf)
+	require.NoError(err)
+	require.Len(records, 3)
+	require.Equal(Record{Offset: records[0].Offset, Direction: FromClient, Data: []byte("HELLO")}, records[0])
+	require.Equal(FromBackend, records[1].Direction)
+	require.LessOrEqual(records[0].Offset, records[2].Offset)
+
+	_, err = ReadRecords(bytes.NewBufferString("{\"offset\": 0}\nnot json\n"))
+	require.ErrorContains(err, "line 2")
+
+	// Replay the client data against an echo backend
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer listener.Close()
+	go func() {
+		backend, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer backend.Close()
+		io.Copy(backend, backend)
+	}()
+
+	backendConn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(err)
+	result, err := Replay(context.Background(), backendConn, records, 1, 100*time.Millisecond)
+	require.NoError(err)
+	require.Equal(int64(8), result.Sent)
+	require.Equal(int64(8), result.Received)
+	require.Equal(int64(2), result.Expected)
+}
@@ -0,0 +1,318 @@
+// Package client helps applications connect to the load balancer: it
+// builds the mutual TLS configuration, redials with backoff and tells the
+// reasons the load balancer rejects connections apart.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reason identifies why the load balancer rejected a connection. Reasons
+// match the keys of the load balancer's rejection_responses setting.
+type Reason string
+
+// define rejection reasons.
+const (
+	ReasonUnauthorized       Reason = "unauthorized"
+	ReasonRateLimited        Reason = "rate_limited"
+	ReasonNoBackend          Reason = "no_backend"
+	ReasonOverloaded         Reason = "overloaded"
+	ReasonBackendUnreachable Reason = "backend_unreachable"
+	ReasonMaintenance        Reason = "maintenance"
+)
+
+// Retryable reports whether a connection rejected for the reason may
+// succeed later. Unauthorized clients are rejected until their
+// certificate or the access control list changes.
+func (r Reason) Retryable() bool {
+	return r != ReasonUnauthorized
+}
+
+// ErrRejected is wrapped by the errors of connections rejected by the
+// load balancer.
+var ErrRejected = errors.New("connection rejected by the load balancer")
+
+// RejectedError describes a connection rejected by the load balancer.
+type RejectedError struct {
+	// Reason tells why the connection was rejected.
+	Reason Reason
+
+	// Response is the response the load balancer sent, if any.
+	Response []byte
+
+	// Err is the TLS error the rejection was recognized from, if any.
+	Err error
+}
+
+// Error implements error.
+func (e *RejectedError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%v (%s): %v", ErrRejected, e.Reason, e.Err)
+	}
+	return fmt.Sprintf("%v (%s)", ErrRejected, e.Reason)
+}
+
+// Unwrap returns ErrRejected.
+func (e *RejectedError) Unwrap() error {
+	return ErrRejected
+}
+
+// NewTLSConfig creates the mutual TLS configuration of connections to the
+// load balancer: the client certificate and key files are presented to
+// the load balancer, whose certificate is verified against the CA file
+// for serverName. Only TLS 1.3 is used, as required by the load balancer.
+func NewTLSConfig(certFile, keyFile, caFile, serverName string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load client certificate and key: %w", err)
+	}
+
+	caCert, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read CA certificate: %w", err)
+	}
+	rootCAs := x509.NewCertPool()
+	if !rootCAs.AppendCertsFromPEM(caCert) {
+		return nil, errors.New("no certificates found in CA file")
+	}
+
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS13,
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      rootCAs,
+		ServerName:   serverName,
+	}, nil
+}
+
+// Backoff defines how redialing is delayed after a failed attempt.
+type Backoff struct {
+	// Initial is the delay after the first failed attempt, doubled
+	// after every further failure.
+	Initial time.Duration
+
+	// Max bounds the delay between two attempts.
+	Max time.Duration
+
+	// Attempts is the maximum number of attempts. Zero means unlimited.
+	Attempts int
+}
+
+// DefaultBackoff is the backoff of a Dialer without one.
+var DefaultBackoff = Backoff{Initial: 100 * time.Millisecond, Max: 10 * time.Second, Attempts: 5}
+
+// delay returns the delay after the given number of failed attempts,
+// with up to 50% of jitter so that clients rejected together do not
+// redial together.
+func (b Backoff) delay(failures int) time.Duration {
+	d := b.Initial
+	for i := 1; i < failures && d < b.Max; i++ {
+		d *= 2
+	}
+	d = min(d, b.Max)
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// Dialer connects to the load balancer.
+type Dialer struct {
+	// Address is the address of the load balancer.
+	Address string
+
+	// TLSConfig is the mutual TLS configuration, see NewTLSConfig.
+	TLSConfig *tls.Config
+
+	// Timeout bounds the connection and TLS handshake. Zero means no timeout.
+	Timeout time.Duration
+
+	// Backoff defines how Do redials. DefaultBackoff is used if zero.
+	Backoff Backoff
+
+	// Responses maps a rejection reason to the response the load balancer
+	// is configured to send for it in rejection_responses, so that
+	// rejections are recognized. Responses should differ from anything a
+	// backend sends first.
+	Responses map[Reason][]byte
+
+	// dial establishes the TLS connection, for tests.
+	dial func(ctx context.Context) (net.Conn, error)
+}
+
+// DialContext connects to the load balancer and completes the TLS
+// handshake. Reads from the returned connection fail with a
+// *RejectedError if the load balancer rejects the connection.
+func (d *Dialer) DialContext(ctx context.Context) (net.Conn, error) {
+	dial := d.dial
+	if dial == nil {
+		dial = d.dialTLS
+	}
+	conn, err := dial(ctx)
+	if err != nil {
+		if rejected := rejectionAlert(err); rejected != nil {
+			return nil, rejected
+		}
+		return nil, err
+	}
+	return &Conn{Conn: conn, responses: d.Responses}, nil
+}
+
+// dialTLS establishes the TLS connection to the load balancer.
+func (d *Dialer) dialTLS(ctx context.Context) (net.Conn, error) {
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: d.Timeout},
+		Config:    d.TLSConfig,
+	}
+	return dialer.DialContext(ctx, "tcp", d.Address)
+}
+
+// Do connects to the load balancer and runs fn with the connection, which
+// is closed once fn returns. The connection is redialed with backoff while
+// dialing fails or fn fails with a retryable *RejectedError. Other errors
+// of fn are returned as is.
+func (d *Dialer) Do(ctx context.Context, fn func(conn net.Conn) error) error {
+	backoff := d.Backoff
+	if backoff == (Backoff{}) {
+		backoff = DefaultBackoff
+	}
+
+	for failures := 1; ; failures++ {
+		err := d.try(ctx, fn)
+		var rejected *RejectedError
+		if errors.As(err, &rejected) && !rejected.Reason.Retryable() {
+			return err
+		}
+		if err == nil || (rejected == nil && !errors.Is(err, errDial)) {
+			return err
+		}
+		if backoff.Attempts > 0 && failures >= backoff.Attempts {
+			return err
+		}
+
+		timer := time.NewTimer(backoff.delay(failures))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// errDial is wrapped by the dial errors of try.
+var errDial = errors.New("unable to connect to the load balancer")
+
+// try dials once and runs fn with the connection.
+func (d *Dialer) try(ctx context.Context, fn func(conn net.Conn) error) error {
+	conn, err := d.DialContext(ctx)
+	if err != nil {
+		var rejected *RejectedError
+		if errors.As(err, &rejected) {
+			return err
+		}
+		return fmt.Errorf("%w: %w", errDial, err)
+	}
+	defer conn.Close()
+	return fn(conn)
+}
+
+// Conn is a connection to the load balancer that recognizes rejections.
+type Conn struct {
+	net.Conn
+
+	// responses maps a rejection reason to its configured response.
+	responses map[Reason][]byte
+
+	// once ensures the first read is inspected once.
+	once sync.Once
+
+	// pending is data read while inspecting the first read, not yet returned.
+	pending []byte
+
+	// pendingErr is the error of the reads inspected, returned once the
+	// pending data was.
+	pendingErr error
+}
+
+// Read implements net.Conn. The first read fails with a *RejectedError if
+// the load balancer sent a TLS alert, or a configured rejection response
+// right before closing the connection.
+func (c *Conn) Read(b []byte) (int, error) {
+	c.once.Do(c.inspect)
+	if len(c.pending) > 0 {
+		n := copy(b, c.pending)
+		c.pending = c.pending[n:]
+		return n, nil
+	}
+	if c.pendingErr != nil {
+		err := c.pendingErr
+		// Rejections are permanent, unlike e.g. deadline errors
+		if !errors.Is(err, ErrRejected) {
+			c.pendingErr = nil
+		}
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+// inspect reads the first data of the connection. If it is the start of a
+// configured rejection response, it reads the rest of the response and
+// checks that the connection is closed right after.
+func (c *Conn) inspect() {
+	buf := make([]byte, 4096)
+	n, err := c.Conn.Read(buf)
+	c.pending = bytes.Clone(buf[:n])
+	defer func() {
+		c.pendingErr = err
+	}()
+	if n == 0 {
+		if rejected := rejectionAlert(err); rejected != nil {
+			err = rejected
+		}
+		return
+	}
+
+	for reason, response := range c.responses {
+		if len(response) == 0 || !bytes.HasPrefix(response, c.pending) && !bytes.HasPrefix(c.pending, response) {
+			continue
+		}
+		// The response may arrive in several reads
+		for len(c.pending) < len(response) && err == nil {
+			n, err = c.Conn.Read(buf)
+			c.pending = append(c.pending, buf[:n]...)
+		}
+		if !bytes.Equal(c.pending, response) {
+			continue
+		}
+		if err == nil {
+			n, err = c.Conn.Read(buf)
+			c.pending = append(c.pending, buf[:n]...)
+		}
+		if len(c.pending) == len(response) && err != nil {
+			c.pending = nil
+			err = &RejectedError{Reason: reason, Response: response}
+		}
+		return
+	}
+}
+
+// rejectionAlert returns the rejection of a connection the load balancer
+// closed with a TLS alert, which it sends to clients whose certificate
+// is not accepted, or nil if err is not such an alert.
+func rejectionAlert(err error) *RejectedError {
+	if err == nil || !strings.Contains(err.Error(), "remote error: tls: ") {
+		return nil
+	}
+	return &RejectedError{Reason: ReasonUnauthorized, Err: err}
+}
@@ -0,0 +1,248 @@
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// pipeDialer returns a dial function connecting to a server running
+// serve on the other end of an in-memory pipe.
+func pipeDialer(serve func(conn net.Conn)) func(ctx context.Context) (net.Conn, error) {
+	return func(ctx context.Context) (net.Conn, error) {
+		client, server := net.Pipe()
+		go func() {
+			defer server.Close()
+			serve(server)
+		}()
+		return client, nil
+	}
+}
+
+func TestConnRejections(t *testing.T) {
+	require := require.New(t)
+
+	responses := map[Reason][]byte{
+		ReasonRateLimited: []byte("421 Too many connections\r\n"),
+		ReasonOverloaded:  []byte("421 Overloaded\r\n"),
+	}
+
+	t.Run("Rejection response followed by close", func(t *testing.T) {
+		d := &Dialer{Responses: responses, dial: pipeDialer(func(conn net.Conn) {
+			// The response may be split across writes
+			conn.Write([]byte("421 Too many "))
+			conn.Write([]byte("connections\r\n"))
+		})}
+		conn, err := d.DialContext(context.Background())
+		require.NoError(err)
+
+		_, err = conn.Read(make([]byte, 64))
+		var rejected *RejectedError
+		require.True(errors.As(err, &rejected))
+		require.ErrorIs(err, ErrRejected)
+		require.Equal(ReasonRateLimited, rejected.Reason)
+
+		_, err = conn.Read(make([]byte, 64))
+		require.ErrorIs(err, ErrRejected)
+	})
+
+	t.Run("Backend data is passed through", func(t *testing.T) {
+		d := &Dialer{Responses: responses, dial: pipeDialer(func(conn net.Conn) {
+			conn.Write([]byte("421 Too many connections\r\n"))
+			conn.Write([]byte("but the backend keeps talking\r\n"))
+		})}
+		conn, err := d.DialContext(context.Background())
+		require.NoError(err)
+
+		data, err := io.ReadAll(conn)
+		require.NoError(err)
+		require.Equal("421 Too many connections\r\nbut the backend keeps talking\r\n", string(data))
+	})
+
+	t.Run("Unrelated data", func(t *testing.T) {
+		d := &Dialer{Responses: responses, dial: pipeDialer(func(conn net.Conn) {
+			conn.Write([]byte("220 Ready\r\n"))
+		})}
+		conn, err := d.DialContext(context.Background())
+		require.NoError(err)
+
+		data, err := io.ReadAll(conn)
+		require.NoError(err)
+		require.Equal("220 Ready\r\n", string(data))
+	})
+}
+
+func TestDo(t *testing.T) {
+	require := require.New(t)
+
+	backoff := Backoff{Initial: time.Millisecond, Max: 2 * time.Millisecond, Attempts: 4}
+
+	t.Run("Retries retryable rejections", func(t *testing.T) {
+		var attempts atomic.Int32
+		d := &Dialer{
+			Backoff:   backoff,
+			Responses: map[Reason][]byte{ReasonMaintenance: []byte("maintenance\n")},
+			dial: pipeDialer(func(conn net.Conn) {
+				if attempts.Add(1) < 3 {
+					conn.Write([]byte("maintenance\n"))
+					return
+				}
+				conn.Write([]byte("hello\n"))
+			}),
+		}
+		var greeting []byte
+		err := d.Do(context.Background(), func(conn net.Conn) error {
+			var err error
+			greeting, err = io.ReadAll(conn)
+			return err
+		})
+		require.NoError(err)
+		require.Equal("hello\n", string(greeting))
+		require.Equal(int32(3), attempts.Load())
+	})
+
+	t.Run("Gives up after the attempts", func(t *testing.T) {
+		attempts := 0
+		d := &Dialer{
+			Backoff: backoff,
+			dial: func(ctx context.Context) (net.Conn, error) {
+				attempts++
+				return nil, errors.New("connection refused")
+			},
+		}
+		err := d.Do(context.Background(), func(conn net.Conn) error { return nil })
+		require.ErrorContains(err, "connection refused")
+		require.Equal(backoff.Attempts, attempts)
+	})
+
+	t.Run("Other errors are not retried", func(t *testing.T) {
+		attempts := 0
+		dial := pipeDialer(func(conn net.Conn) {})
+		d := &Dialer{Backoff: backoff, dial: func(ctx context.Context) (net.Conn, error) {
+			attempts++
+			return dial(ctx)
+		}}
+		err := d.Do(context.Background(), func(conn net.Conn) error { return io.ErrUnexpectedEOF })
+		require.ErrorIs(err, io.ErrUnexpectedEOF)
+		require.Equal(1, attempts)
+	})
+}
+
+func TestBackoffDelay(t *testing.T) {
+	require := require.New(t)
+
+	b := Backoff{Initial: 100 * time.Millisecond, Max: time.Second}
+	for failures, max := range map[int]time.Duration{1: 100 * time.Millisecond, 3: 400 * time.Millisecond, 10: time.Second} {
+		d := b.delay(failures)
+		require.GreaterOrEqual(d, max/2)
+		require.LessOrEqual(d, max)
+	}
+}
+
+// writeCertificate creates a certificate signed by parent, or self-signed
+// if parent is nil, and writes it with its key to dir.
+func writeCertificate(t *testing.T, dir, name string, template *x509.Certificate, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	signer, signerKey := template, any(key)
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".crt"), certPEM, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".key"), keyPEM, 0o600))
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	cert.Leaf, err = x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func TestUnauthorizedAlert(t *testing.T) {
+	require := require.New(t)
+
+	dir := t.TempDir()
+	notAfter := time.Now().Add(time.Hour)
+	newCA := func(name string) tls.Certificate {
+		return writeCertificate(t, dir, name, &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: name},
+			NotAfter:              notAfter,
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign,
+		}, nil)
+	}
+	serverCA, otherCA := newCA("server-ca"), newCA("other-ca")
+	serverCert := writeCertificate(t, dir, "server", &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "lb.example.com"},
+		DNSNames:     []string{"lb.example.com"},
+		NotAfter:     notAfter,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, &serverCA)
+	writeCertificate(t, dir, "client", &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "client.example.com"},
+		NotAfter:     notAfter,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, &otherCA)
+
+	// The server does not trust the CA of the client certificate
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(serverCA.Leaf)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		MinVersion:   tls.VersionTLS13,
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	require.NoError(err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.(*tls.Conn).Handshake()
+	}()
+
+	tlsConfig, err := NewTLSConfig(
+		filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key"),
+		filepath.Join(dir, "server-ca.crt"), "lb.example.com")
+	require.NoError(err)
+
+	d := &Dialer{Address: listener.Addr().String(), TLSConfig: tlsConfig, Timeout: 5 * time.Second}
+	err = d.Do(context.Background(), func(conn net.Conn) error {
+		_, err := conn.Read(make([]byte, 1))
+		return err
+	})
+	var rejected *RejectedError
+	require.True(errors.As(err, &rejected), "%v", err)
+	require.Equal(ReasonUnauthorized, rejected.Reason)
+}
@@ -1,12 +1,28 @@
 package config
 
 import (
+	"bytes"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/devca"
+	"github.com/rrasulzade/tcp-lb-go/featureflag"
+	"github.com/rrasulzade/tcp-lb-go/fips"
+	"github.com/rrasulzade/tcp-lb-go/lib"
+	"github.com/rrasulzade/tcp-lb-go/listen"
+	"github.com/rrasulzade/tcp-lb-go/logging"
+	"github.com/rrasulzade/tcp-lb-go/overload"
 )
 
 // RateLimiterConfig defines the rate limiting settings.
@@ -16,6 +32,984 @@ type RateLimiterConfig struct {
 
 	// RefillRate is the number of tokens added to the bucket every second.
 	RefillRate uint64 `json:"refill_rate"`
+
+	// Key lists the connection attributes (client_id, source_ip, sni,
+	// tenant) the rate limiter is keyed on. Defaults to the client ID.
+	Key []string `json:"key"`
+}
+
+// rateLimitKeyParts lists the connection attributes the rate limiter can be keyed on.
+var rateLimitKeyParts = map[string]struct{}{
+	"client_id": {},
+	"source_ip": {},
+	"sni":       {},
+	"tenant":    {},
+}
+
+// ResolutionConfig defines how hostname backends are resolved on dial.
+type ResolutionConfig struct {
+	// Strategy is one of per_dial, ttl or pinned. Defaults to per_dial.
+	Strategy string `json:"strategy"`
+
+	// TTL is the time resolved IPs are cached with the ttl strategy.
+	TTL Duration `json:"ttl"`
+
+	// DNSServers are the DNS servers queried in order, "host" or
+	// "host:port". The system resolver is used if empty.
+	DNSServers []string `json:"dns_servers"`
+
+	// Timeout bounds the query of each DNS server. Zero means no timeout.
+	Timeout Duration `json:"timeout"`
+
+	// NegativeTTL is the time a failed lookup is cached. Zero disables
+	// negative caching.
+	NegativeTTL Duration `json:"negative_ttl"`
+}
+
+// DNSResolver returns how the hostnames of backends are looked up.
+func (r ResolutionConfig) DNSResolver() lib.DNSResolver {
+	return lib.DNSResolver{
+		Servers:     r.DNSServers,
+		Timeout:     r.Timeout.Duration,
+		NegativeTTL: r.NegativeTTL.Duration,
+	}
+}
+
+// resolutionStrategies lists the supported backend resolution strategies.
+var resolutionStrategies = map[string]struct{}{
+	string(lib.ResolvePerDial): {},
+	string(lib.ResolveTTL):     {},
+	string(lib.ResolvePinned):  {},
+}
+
+// BalancingConfig defines how a backend is selected among the eligible
+// allowed backends.
+type BalancingConfig struct {
+	// Strategy is least_connections, consistent_hash or least_latency.
+	// Defaults to least_connections.
+	Strategy string `json:"strategy"`
+
+	// HashKey is the connection attribute consistent hashing is keyed
+	// on: client_id or source_ip. Defaults to client_id.
+	HashKey string `json:"hash_key"`
+
+	// FirstByteLatency adds the time to the first byte received from
+	// backends to their dial latency with least_latency.
+	FirstByteLatency bool `json:"first_byte_latency"`
+
+	// SpreadFailureDomains spreads the connections of every client across
+	// the failure domains of its allowed backends.
+	SpreadFailureDomains bool `json:"spread_failure_domains"`
+}
+
+// define consistent hashing keys.
+const (
+	// HashByClientID hashes the client ID of the connection.
+	HashByClientID = "client_id"
+
+	// HashBySourceIP hashes the client's IP address.
+	HashBySourceIP = "source_ip"
+)
+
+// balancingStrategies lists the supported balancing strategies.
+var balancingStrategies = map[string]struct{}{
+	string(lib.BalanceLeastConnections): {},
+	string(lib.BalanceConsistentHash):   {},
+	string(lib.BalanceLeastLatency):     {},
+}
+
+// define policies for authenticated clients missing from the access control list.
+const (
+	// UnknownClientDeny rejects the client.
+	UnknownClientDeny = "deny"
+
+	// UnknownClientDefaultPool allows the client to access the default pool.
+	UnknownClientDefaultPool = "default_pool"
+
+	// UnknownClientAllowAll allows the client to access every pool.
+	UnknownClientAllowAll = "allow_all"
+)
+
+// unknownClientPolicies lists the supported policies for unknown clients.
+var unknownClientPolicies = map[string]struct{}{
+	UnknownClientDeny:        {},
+	UnknownClientDefaultPool: {},
+	UnknownClientAllowAll:    {},
+}
+
+// define client authentication policies of pools.
+const (
+	// ClientAuthRequire only admits clients presenting a verified
+	// certificate authorized by the access control list.
+	ClientAuthRequire = "require"
+
+	// ClientAuthRequest requests a certificate, verifying it if presented,
+	// and also admits clients presenting none.
+	ClientAuthRequest = "request"
+
+	// ClientAuthNone does not authenticate clients.
+	ClientAuthNone = "none"
+)
+
+// clientAuthPolicies lists the supported client authentication policies.
+var clientAuthPolicies = map[string]struct{}{
+	ClientAuthRequire: {},
+	ClientAuthRequest: {},
+	ClientAuthNone:    {},
+}
+
+// PrewarmConfig defines the settings of the probe connections opened
+// to backends when they are added, to report their readiness.
+type PrewarmConfig struct {
+	// Enabled enables probing backends when they are added.
+	Enabled bool `json:"enabled"`
+
+	// Timeout is the maximum time a backend has to accept a probe connection.
+	Timeout Duration `json:"timeout"`
+}
+
+// QueueConfig defines the admission queue settings used
+// when all allowed backends are at capacity.
+type QueueConfig struct {
+	// Size is the maximum number of connections waiting for capacity.
+	// Zero disables queueing.
+	Size int `json:"size"`
+
+	// Timeout is the maximum time a connection waits for capacity.
+	Timeout Duration `json:"timeout"`
+
+	// Pools overrides the size and timeout of the queue of these pools.
+	Pools map[string]PoolQueueConfig `json:"pools"`
+}
+
+// PoolQueueConfig defines the admission queue settings of a pool.
+type PoolQueueConfig struct {
+	// Size is the maximum number of connections waiting for the backends
+	// of the pool. Zero disables queueing for the pool.
+	Size int `json:"size"`
+
+	// Timeout is the maximum time a connection waits for the backends of
+	// the pool. Defaults to the queue timeout.
+	Timeout Duration `json:"timeout"`
+}
+
+// Payload defines bytes given either as text or, for binary protocols
+// whose messages are not printable, hex encoded.
+type Payload struct {
+	// Text is sent verbatim.
+	Text string `json:"text"`
+
+	// Hex is hex-encoded binary data.
+	Hex string `json:"hex"`
+}
+
+// Bytes returns the decoded payload.
+func (p Payload) Bytes() ([]byte, error) {
+	if p.Text != "" && p.Hex != "" {
+		return nil, errors.New("only one of text or hex may be set")
+	}
+	if p.Hex != "" {
+		b, err := hex.DecodeString(p.Hex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex data: %w", err)
+		}
+		return b, nil
+	}
+	return []byte(p.Text), nil
+}
+
+// RejectionResponse defines the bytes sent to a client before
+// closing the connection on a specific failure, e.g. a Postgres
+// error packet given as hex.
+// Exactly one of Text or Hex must be set.
+type RejectionResponse = Payload
+
+// rejectionReasons lists the failures a rejection response can be configured for.
+var rejectionReasons = map[string]struct{}{
+	"unauthorized":        {},
+	"rate_limited":        {},
+	"no_backend":          {},
+	"overloaded":          {},
+	"backend_unreachable": {},
+	"maintenance":         {},
+}
+
+// MaintenanceConfig defines the maintenance of a pool, during which its
+// clients are not connected to a backend.
+type MaintenanceConfig struct {
+	// Message is sent to the clients of the pool before closing their
+	// connection, e.g. a protocol error packet given as hex. Optional,
+	// defaults to the maintenance rejection response.
+	Message Payload `json:"message"`
+}
+
+// KeepaliveConfig defines the protocol-level pings sent to the idle
+// clients of a pool to keep NAT and firewall state alive.
+type KeepaliveConfig struct {
+	// Interval is the idle time after which a ping is sent.
+	Interval Duration `json:"interval"`
+
+	// Ping is the message written to the client.
+	Ping Payload `json:"ping"`
+
+	// Response is the answer expected from the client, which is not
+	// forwarded to the backend. Optional.
+	Response Payload `json:"response"`
+
+	// Timeout is the time to wait for the response before the
+	// connection is closed. Defaults to the interval.
+	Timeout Duration `json:"timeout"`
+}
+
+// BackendTLSConfig defines the TLS connections to the backends of a pool.
+type BackendTLSConfig struct {
+	// CAFile is a path to the CA file verifying the backend certificates.
+	// The system roots are used if empty.
+	CAFile string `json:"ca_file"`
+
+	// CertFile and KeyFile are paths to the client certificate presented
+	// to the backends and its private key. Optional.
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+
+	// ServerName is the name verified in the backend certificates.
+	// Defaults to the host of each backend address.
+	ServerName string `json:"server_name"`
+
+	// SessionCacheSize is the number of TLS sessions cached per backend.
+	// Defaults to lib.DefaultTLSSessionCacheSize, a negative size
+	// disables session resumption.
+	SessionCacheSize int `json:"session_cache_size"`
+}
+
+// Keepalive returns the keepalive settings of the load balancer.
+func (k KeepaliveConfig) Keepalive() (lib.Keepalive, error) {
+	ping, err := k.Ping.Bytes()
+	if err != nil {
+		return lib.Keepalive{}, fmt.Errorf("ping: %w", err)
+	}
+	response, err := k.Response.Bytes()
+	if err != nil {
+		return lib.Keepalive{}, fmt.Errorf("response: %w", err)
+	}
+	return lib.Keepalive{
+		Interval: k.Interval.Duration,
+		Ping:     ping,
+		Response: response,
+		Timeout:  k.Timeout.Duration,
+	}, nil
+}
+
+// FeatureFlagConfig defines the rollout of an experimental behavior.
+type FeatureFlagConfig struct {
+	// Enabled turns the behavior on.
+	Enabled bool `json:"enabled"`
+
+	// Pools limits the behavior to these pools. Optional.
+	Pools []string `json:"pools"`
+
+	// Percentage is the share of connections the behavior is turned
+	// on for, between 0 and 100. Defaults to 100.
+	Percentage *float64 `json:"percentage"`
+}
+
+// FeatureFlags returns the configured feature flags.
+func (c *ApplicationConfig) FeatureFlags() []featureflag.Flag {
+	flags := make([]featureflag.Flag, 0, len(c.Features))
+	for name, feature := range c.Features {
+		percentage := 100.0
+		if feature.Percentage != nil {
+			percentage = *feature.Percentage
+		}
+		flags = append(flags, featureflag.Flag{
+			Name:       name,
+			Enabled:    feature.Enabled,
+			Pools:      feature.Pools,
+			Percentage: percentage,
+		})
+	}
+	return flags
+}
+
+// PoolGroupsConfig defines the deployment groups (e.g. blue and green)
+// of a pool, of which only the active one receives new connections.
+type PoolGroupsConfig struct {
+	// Active is the initially active group.
+	Active string `json:"active"`
+
+	// Groups maps a group name to a list of backends in the group.
+	Groups map[string]BackendList `json:"groups"`
+}
+
+// BackendConfig defines a backend of a pool. It is configured either as
+// an address string, or as an object with the address, the weight and
+// the failure domain.
+type BackendConfig struct {
+	// Address is the address of the backend.
+	Address string `json:"address"`
+
+	// Weight is the initial weight of the backend, between 1 and
+	// lib.MaxWeight, e.g. proportional to its capacity so that larger
+	// machines receive proportionally more connections. Defaults to
+	// lib.DefaultWeight.
+	Weight int `json:"weight"`
+
+	// FailureDomain is the failure domain of the backend, e.g. its rack,
+	// host or availability zone. Optional.
+	FailureDomain string `json:"failure_domain"`
+}
+
+// UnmarshalJSON decodes a backend from an address string or an object.
+func (b *BackendConfig) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &b.Address); err == nil {
+		return nil
+	}
+
+	// Decode the object strictly, as nested decoders do not inherit
+	// the unknown fields check
+	type backendConfig BackendConfig
+	var decoded backendConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&decoded); err != nil {
+		return fmt.Errorf("backend must be an address or an object with an address, a weight and a failure domain: %w", err)
+	}
+	*b = BackendConfig(decoded)
+	return nil
+}
+
+// BackendList is a list of backends.
+type BackendList []BackendConfig
+
+// Addresses returns the addresses of the backends.
+func (l BackendList) Addresses() []string {
+	addresses := make([]string, len(l))
+	for i, backend := range l {
+		addresses[i] = backend.Address
+	}
+	return addresses
+}
+
+// ProxyProtocolConfig defines the PROXY protocol settings
+// for connections from clients and to backends.
+type ProxyProtocolConfig struct {
+	// Enabled enables sending a PROXY protocol v2 header to backends.
+	Enabled bool `json:"enabled"`
+
+	// ConnectionID includes the connection ID in the header as a TLV.
+	ConnectionID bool `json:"connection_id"`
+
+	// LoopDetection includes the instance IDs of the load balancers the
+	// connection went through in the header as a TLV, so that proxy loops
+	// across chained load balancers are detected.
+	LoopDetection bool `json:"loop_detection"`
+
+	// Accept reads a PROXY protocol v2 header sent by a load balancer in
+	// front before the TLS handshake of every client connection.
+	Accept bool `json:"accept"`
+}
+
+// DefaultAdminAddress is the default address of the admin API, which is
+// only reachable from the host.
+const DefaultAdminAddress = "127.0.0.1:9000"
+
+// AdminConfig defines the admin API listener settings.
+type AdminConfig struct {
+	// Address is an address on which the admin API listens.
+	// Defaults to DefaultAdminAddress.
+	Address string `json:"address"`
+
+	// GracePeriod is the default time given to drained connections
+	// before they are force-closed.
+	GracePeriod Duration `json:"grace_period"`
+
+	// TLS is the TLS settings of the listener. It is served over plain HTTP if nil.
+	TLS *ListenerTLSConfig `json:"tls"`
+
+	// Tokens are the bearer tokens granting access to the admin API.
+	Tokens []string `json:"tokens"`
+
+	// Peers are the admin APIs of the other load balancer instances of
+	// the cluster. Changes are not propagated if nil.
+	Peers *PeersConfig `json:"peers"`
+
+	// AuditLog is a path to the file every change requested on the admin
+	// API is appended to. Changes are not audited if empty.
+	AuditLog string `json:"audit_log"`
+
+	// DevCA is the development CA issuing client certificates on
+	// /dev/certificates. It must not be enabled in production, as
+	// anyone with access to the admin API can connect. Disabled if nil.
+	DevCA *DevCAConfig `json:"dev_ca"`
+}
+
+// DevCAConfig defines the development CA issuing short-lived client
+// certificates, trusted by the load balancer in addition to the CA file.
+type DevCAConfig struct {
+	// CertFile and KeyFile are paths to the CA certificate and its private
+	// key. A CA is generated at startup if empty, so that certificates
+	// issued before a restart are no longer trusted.
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+
+	// MaxTTL bounds the lifetime of the certificates issued.
+	// Defaults to DefaultDevCAMaxTTL.
+	MaxTTL Duration `json:"max_ttl"`
+}
+
+// CA loads the development CA from its files, or generates one if unset.
+func (c *DevCAConfig) CA() (*devca.CA, error) {
+	if c.CertFile == "" {
+		return devca.New("tcp-lb-go dev CA")
+	}
+	certPEM, err := os.ReadFile(c.CertFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read dev CA certificate: %w", err)
+	}
+	keyPEM, err := os.ReadFile(c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read dev CA key: %w", err)
+	}
+	return devca.Load(certPEM, keyPEM)
+}
+
+// DefaultDevCAMaxTTL is the default maximum lifetime of the client
+// certificates issued by the development CA.
+const DefaultDevCAMaxTTL = 24 * time.Hour
+
+// PeersConfig defines the admin APIs to which changes requested with
+// ?cluster=true are propagated, e.g. to drain a backend on every
+// instance of the cluster at once.
+type PeersConfig struct {
+	// URLs are the base URLs of the peer admin APIs, e.g. "https://10.0.0.2:9000".
+	URLs []string `json:"urls"`
+
+	// Token is the bearer token sent to the peers. Optional.
+	Token string `json:"token"`
+
+	// CAFile is a path to the CA file verifying the peer certificates.
+	// The system roots are used if empty.
+	CAFile string `json:"ca_file"`
+
+	// CertFile and KeyFile are paths to the client certificate presented
+	// to the peers and its private key. Optional.
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+
+	// Timeout bounds each request to a peer. Defaults to DefaultPeerTimeout.
+	Timeout Duration `json:"timeout"`
+}
+
+// DefaultPeerTimeout is the default timeout of the requests to the peer admin APIs.
+const DefaultPeerTimeout = 5 * time.Second
+
+// DrainConfig defines the settings of a drain requested before the
+// server is stopped, e.g. from an orchestration preStop hook.
+type DrainConfig struct {
+	// ReadinessDelay is the time the server is reported as not ready
+	// before it stops accepting connections.
+	ReadinessDelay Duration `json:"readiness_delay"`
+
+	// Timeout is the maximum time to wait for active connections to finish.
+	Timeout Duration `json:"timeout"`
+}
+
+// TimeoutsConfig gathers the timeouts bounding the phases of a connection,
+// from its acceptance to the shutdown of the server.
+type TimeoutsConfig struct {
+	// AcceptRetry is the delay before accepting again after an accept error.
+	AcceptRetry Duration `json:"accept_retry"`
+
+	// TLSHandshake bounds the TLS handshake of a client connection,
+	// including reading its PROXY protocol header. Zero means no timeout.
+	TLSHandshake Duration `json:"tls_handshake"`
+
+	// BackendDial bounds the establishment of a backend connection.
+	// Zero means no timeout.
+	BackendDial Duration `json:"backend_dial"`
+
+	// ClientIdle is the maximum time without data read from the client
+	// before a proxied connection is closed. Zero means no timeout.
+	ClientIdle Duration `json:"client_idle"`
+
+	// BackendIdle is the maximum time without data read from the backend
+	// before a proxied connection is closed. Zero means no timeout.
+	BackendIdle Duration `json:"backend_idle"`
+
+	// MaxLifetime is the maximum duration of a proxied connection.
+	// Zero means unlimited.
+	MaxLifetime Duration `json:"max_lifetime"`
+
+	// Shutdown is the time active connections are given to drain when
+	// the server stops, after any configured drain, before they are
+	// force-closed.
+	Shutdown Duration `json:"shutdown"`
+}
+
+// validate reports the invalid timeouts.
+func (c TimeoutsConfig) validate() []error {
+	var errs []error
+	if c.AcceptRetry.Duration <= 0 || c.Shutdown.Duration <= 0 {
+		errs = append(errs, errors.New("accept retry and shutdown timeouts must be positive"))
+	}
+	if c.TLSHandshake.Duration < 0 || c.BackendDial.Duration < 0 || c.ClientIdle.Duration < 0 ||
+		c.BackendIdle.Duration < 0 || c.MaxLifetime.Duration < 0 {
+		errs = append(errs, errors.New("timeouts must not be negative"))
+	}
+	return errs
+}
+
+// HealthConfig defines the self health check settings.
+type HealthConfig struct {
+	// Interval is the time between two rounds of self checks.
+	Interval Duration `json:"interval"`
+
+	// MaxGoroutines is the goroutine count above which the process is
+	// reported as degraded. Zero derives it from the active connections.
+	MaxGoroutines int `json:"max_goroutines"`
+}
+
+// HandshakesPerProc is the number of concurrent TLS handshakes per
+// processor when the limit is derived from GOMAXPROCS. Handshakes mostly
+// wait on the network, so several are performed per processor.
+const HandshakesPerProc = 64
+
+// RuntimeConfig defines how the process is sized to the CPUs available.
+type RuntimeConfig struct {
+	// GOMAXPROCS is the number of processors executing Go code. Zero
+	// derives it from the container CPU limit, see cpulimit.Tune.
+	GOMAXPROCS int `json:"gomaxprocs"`
+
+	// MaxConcurrentHandshakes is the number of TLS handshakes performed
+	// at the same time. Zero derives it from GOMAXPROCS.
+	MaxConcurrentHandshakes int `json:"max_concurrent_handshakes"`
+}
+
+// HandshakeConcurrency returns the number of TLS handshakes performed
+// at the same time with the given number of processors.
+func (c RuntimeConfig) HandshakeConcurrency(procs int) int {
+	if c.MaxConcurrentHandshakes > 0 {
+		return c.MaxConcurrentHandshakes
+	}
+	return procs * HandshakesPerProc
+}
+
+// DiscoveryConfig defines the service discovery settings.
+type DiscoveryConfig struct {
+	// Provider is the name of a registered discovery provider, e.g. "file".
+	Provider string `json:"provider"`
+
+	// Options are the provider specific settings.
+	Options json.RawMessage `json:"options"`
+
+	// Pools is a list of pools whose backends are discovered at runtime.
+	Pools []string `json:"pools"`
+}
+
+// AgentConfig defines the agent-check listener settings.
+type AgentConfig struct {
+	// Address is an address on which agent-check queries are answered.
+	Address string `json:"address"`
+}
+
+// HealthPortConfig defines the plaintext health check port settings.
+type HealthPortConfig struct {
+	// Address is an address on which health check connections are answered.
+	Address string `json:"address"`
+
+	// Banner is the fixed response written to every connection.
+	// Defaults to DefaultHealthPortBanner.
+	Banner string `json:"banner"`
+}
+
+// DefaultHealthPortBanner is the default response of the health port.
+const DefaultHealthPortBanner = "OK\n"
+
+// ListenRetryConfig defines how binding a listener address that is
+// already in use is retried, e.g. while a previous instance shuts down.
+type ListenRetryConfig struct {
+	// Attempts is the number of retries. Zero disables retrying.
+	Attempts int `json:"attempts"`
+
+	// Delay is the delay before the first retry, doubled after every retry.
+	Delay Duration `json:"delay"`
+
+	// MaxDelay bounds the delay between two retries.
+	MaxDelay Duration `json:"max_delay"`
+}
+
+// Retry converts the configuration to listener retry settings.
+func (c ListenRetryConfig) Retry() listen.Retry {
+	return listen.Retry{
+		Attempts: c.Attempts,
+		Delay:    c.Delay.Duration,
+		MaxDelay: c.MaxDelay.Duration,
+	}
+}
+
+// LoggingConfig defines the format and destination of the logs, e.g. to
+// ship them to a log pipeline without a sidecar.
+type LoggingConfig struct {
+	// Format is "text" (default) or "json", one object per line.
+	Format string `json:"format"`
+
+	// File is the path of the file logs are appended to instead of
+	// stderr.
+	File string `json:"file"`
+
+	// MaxSizeMB is the size in megabytes past which the file is rotated.
+	// The file is never rotated if zero.
+	MaxSizeMB int `json:"max_size_mb"`
+
+	// MaxBackups is the number of rotated files retained. All are
+	// retained if zero.
+	MaxBackups int `json:"max_backups"`
+
+	// MaxAge is the time rotated files are retained for. They are
+	// retained regardless of age if zero.
+	MaxAge Duration `json:"max_age"`
+
+	// Sampling rate limits the identical warnings logged for
+	// connections. They are all logged if nil.
+	Sampling *LogSamplingConfig `json:"sampling"`
+}
+
+// LogSamplingConfig defines how many identical warnings are logged for
+// connections, e.g. the same error of every connection of a client.
+type LogSamplingConfig struct {
+	// Interval is the window identical warnings are counted in.
+	// Defaults to 10 seconds.
+	Interval Duration `json:"interval"`
+
+	// Burst is the number of identical warnings logged in every interval,
+	// the others being summarized once it ends. Defaults to 5.
+	Burst int `json:"burst"`
+}
+
+// Config returns the sampling settings of the logs, nil if not sampled.
+func (c *LogSamplingConfig) Config() *logging.SamplingConfig {
+	if c == nil {
+		return nil
+	}
+	return &logging.SamplingConfig{
+		Interval: c.Interval.Duration,
+		Burst:    c.Burst,
+	}
+}
+
+// Rotation converts the configuration to log file rotation settings.
+func (c LoggingConfig) Rotation() logging.RotationConfig {
+	return logging.RotationConfig{
+		MaxSize:    int64(c.MaxSizeMB) << 20,
+		MaxBackups: c.MaxBackups,
+		MaxAge:     c.MaxAge.Duration,
+	}
+}
+
+// validate checks the format, rotation and sampling of the logs, applying
+// the sampling defaults.
+func (c LoggingConfig) validate() []error {
+	var errs []error
+	if sampling := c.Sampling; sampling != nil {
+		if sampling.Interval.Duration == 0 {
+			sampling.Interval = Duration{10 * time.Second}
+		}
+		if sampling.Burst == 0 {
+			sampling.Burst = 5
+		}
+		if sampling.Interval.Duration < 0 || sampling.Burst < 0 {
+			errs = append(errs, errors.New("log sampling interval and burst must not be negative"))
+		}
+	}
+	if c.Format != "" && c.Format != "text" && c.Format != "json" {
+		errs = append(errs, fmt.Errorf("unknown log format '%s'", c.Format))
+	}
+	if c.MaxSizeMB < 0 || c.MaxBackups < 0 || c.MaxAge.Duration < 0 {
+		errs = append(errs, errors.New("log max size, backups and age must not be negative"))
+	}
+	if c.File == "" && (c.MaxSizeMB > 0 || c.MaxBackups > 0 || c.MaxAge.Duration > 0) {
+		errs = append(errs, errors.New("log rotation requires a log file"))
+	}
+	return errs
+}
+
+// SocketOptionsConfig tunes the socket of a listener, e.g. for high
+// connection rates. Unset options keep the system defaults.
+type SocketOptionsConfig struct {
+	// Backlog is the maximum number of connections pending acceptance,
+	// capped by net.core.somaxconn.
+	Backlog int `json:"backlog"`
+
+	// ReuseAddr sets SO_REUSEADDR on TCP listeners, enabled by default.
+	ReuseAddr *bool `json:"reuse_addr"`
+
+	// DeferAccept sets TCP_DEFER_ACCEPT on TCP listeners, only accepting
+	// connections once their client sent data, waiting at most for
+	// this timeout.
+	DeferAccept Duration `json:"defer_accept"`
+}
+
+// Options converts the configuration to listener socket options.
+func (c SocketOptionsConfig) Options() listen.SocketOptions {
+	return listen.SocketOptions{
+		Backlog:     c.Backlog,
+		ReuseAddr:   c.ReuseAddr,
+		DeferAccept: c.DeferAccept.Duration,
+	}
+}
+
+// validate checks the socket options of the listener on the network.
+func (c SocketOptionsConfig) validate(network, address string) []error {
+	var errs []error
+	if c.Backlog < 0 || c.DeferAccept.Duration < 0 {
+		errs = append(errs, fmt.Errorf("listener %q: backlog and defer accept must not be negative", address))
+	}
+	if network == "unix" && (c.ReuseAddr != nil || c.DeferAccept.Duration > 0) {
+		errs = append(errs, fmt.Errorf("listener %q: reuse_addr and defer_accept are only available on tcp listeners", address))
+	}
+	return errs
+}
+
+// ListenerConfig defines an additional mutual TLS listener routing its
+// connections to its own pools.
+type ListenerConfig struct {
+	// Network is "tcp" or "unix". UDP is not supported, as connections
+	// are proxied as TLS streams.
+	Network string `json:"network"`
+
+	// Address is the TCP address, or the path of the Unix socket.
+	Address string `json:"address"`
+
+	// Pools restricts the listener's connections to these pools.
+	// Connections may be routed to any allowed backend if empty.
+	Pools []string `json:"pools"`
+
+	// PeerCredentials accepts plain connections on a Unix socket,
+	// identifying clients by the UID, GID or PID of their process in
+	// the access control list instead of a client certificate.
+	PeerCredentials bool `json:"peer_credentials"`
+
+	// SocketOptions tunes the socket of the listener.
+	SocketOptions SocketOptionsConfig `json:"socket_options"`
+
+	// RateLimitKey overrides the key of the rate limiter for the
+	// listener's connections, see RateLimiterConfig.Key. Optional.
+	RateLimitKey []string `json:"rate_limit_key"`
+}
+
+// validate checks the listener settings against the configured pools.
+func (c ListenerConfig) validate(pools []string) []error {
+	var errs []error
+	switch c.Network {
+	case "tcp", "unix":
+	case "udp":
+		errs = append(errs, fmt.Errorf("listener %q: udp listeners are not supported, connections are proxied as TLS streams", c.Address))
+	default:
+		errs = append(errs, fmt.Errorf("listener %q: network must be tcp or unix, got %q", c.Address, c.Network))
+	}
+	if c.Address == "" {
+		errs = append(errs, errors.New("listener address is required"))
+	}
+	if c.PeerCredentials && c.Network != "unix" {
+		errs = append(errs, fmt.Errorf("listener %q: peer credentials are only available on unix listeners", c.Address))
+	}
+	for _, pool := range c.Pools {
+		if !slices.Contains(pools, pool) {
+			errs = append(errs, fmt.Errorf("listener %q: unknown pool %q", c.Address, pool))
+		}
+	}
+	for _, part := range c.RateLimitKey {
+		if _, ok := rateLimitKeyParts[part]; !ok {
+			errs = append(errs, fmt.Errorf("listener %q: unknown rate limiter key '%s'", c.Address, part))
+		}
+	}
+	errs = append(errs, c.SocketOptions.validate(c.Network, c.Address)...)
+	return errs
+}
+
+// MetricsConfig defines the metrics listener settings.
+type MetricsConfig struct {
+	// Address is an address on which metrics are served over HTTP.
+	Address string `json:"address"`
+
+	// TLS is the TLS settings of the listener. It is served over plain HTTP if nil.
+	TLS *ListenerTLSConfig `json:"tls"`
+
+	// Tokens are the bearer tokens granting access to the metrics.
+	Tokens []string `json:"tokens"`
+}
+
+// ListenerTLSConfig defines the TLS settings of a control-plane
+// listener, independent of the data-plane TLS settings.
+type ListenerTLSConfig struct {
+	// CertFile is a path to the listener certificate file.
+	CertFile string `json:"cert_file"`
+
+	// KeyFile is a path to the listener private key file.
+	KeyFile string `json:"key_file"`
+
+	// ClientCAFile is a path to the CA file verifying client certificates.
+	// Client certificates are not requested if empty.
+	ClientCAFile string `json:"client_ca_file"`
+}
+
+// OutlierDetectionConfig defines the settings for ejecting backends whose
+// dial latency or error rate deviates from the median of their pool.
+type OutlierDetectionConfig struct {
+	// Interval is the time between two outlier evaluations.
+	Interval Duration `json:"interval"`
+
+	// BaseEjectionTime is the ejection time of a first ejection.
+	BaseEjectionTime Duration `json:"base_ejection_time"`
+
+	// MaxEjectionPercent is the maximum percentage of a pool's
+	// backends ejected at the same time.
+	MaxEjectionPercent int `json:"max_ejection_percent"`
+
+	// LatencyFactor is the factor by which a backend's mean dial
+	// latency must exceed the pool median to be ejected.
+	LatencyFactor float64 `json:"latency_factor"`
+
+	// ErrorRateThreshold is the amount by which a backend's dial
+	// error rate must exceed the pool median to be ejected.
+	ErrorRateThreshold float64 `json:"error_rate_threshold"`
+
+	// MinRequests is the minimum number of dials in an interval
+	// for a backend to be evaluated.
+	MinRequests int64 `json:"min_requests"`
+}
+
+// PassiveHealthCheckConfig defines the settings for ejecting backends
+// after consecutive dial failures.
+type PassiveHealthCheckConfig struct {
+	// ConsecutiveFailures is the number of consecutive failed dials
+	// after which a backend is ejected.
+	ConsecutiveFailures int64 `json:"consecutive_failures"`
+
+	// Cooldown is the time an ejected backend is kept out of selection.
+	Cooldown Duration `json:"cooldown"`
+}
+
+// AdaptiveWeightsConfig defines the settings for adjusting backend
+// weights from the latency and failure rate of health checks.
+type AdaptiveWeightsConfig struct {
+	// Interval is the time between two health checks.
+	Interval Duration `json:"interval"`
+
+	// Timeout is the time a backend has to accept a health check.
+	// Defaults to the interval.
+	Timeout Duration `json:"timeout"`
+
+	// LatencyTarget is the health check latency of a backend
+	// served at its full weight.
+	LatencyTarget Duration `json:"latency_target"`
+
+	// MinPercent is the lowest percentage of its weight a backend is
+	// derated to. Defaults to DefaultAdaptiveWeightsMinPercent.
+	MinPercent int `json:"min_percent"`
+
+	// MaxPercent is the highest percentage of its weight a backend is
+	// promoted to. Defaults to 100, i.e. backends are only derated.
+	MaxPercent int `json:"max_percent"`
+}
+
+// DefaultAdaptiveWeightsMinPercent is the default lowest percentage of
+// its weight a backend is derated to.
+const DefaultAdaptiveWeightsMinPercent = 10
+
+// AdaptiveWeights converts the configuration to adaptive weight
+// settings, applying the defaults.
+func (c AdaptiveWeightsConfig) AdaptiveWeights() lib.AdaptiveWeights {
+	aw := lib.AdaptiveWeights{
+		Interval:      c.Interval.Duration,
+		Timeout:       c.Timeout.Duration,
+		LatencyTarget: c.LatencyTarget.Duration,
+		MinPercent:    c.MinPercent,
+		MaxPercent:    c.MaxPercent,
+	}
+	if aw.Timeout == 0 {
+		aw.Timeout = aw.Interval
+	}
+	if aw.MinPercent == 0 {
+		aw.MinPercent = DefaultAdaptiveWeightsMinPercent
+	}
+	if aw.MaxPercent == 0 {
+		aw.MaxPercent = 100
+	}
+	return aw
+}
+
+// validate checks the adaptive weight settings.
+func (c AdaptiveWeightsConfig) validate() []error {
+	var errs []error
+	if c.Interval.Duration <= 0 || c.LatencyTarget.Duration <= 0 || c.Timeout.Duration < 0 {
+		errs = append(errs, errors.New("adaptive weights interval and latency target must be positive and timeout must not be negative"))
+	}
+	if c.MinPercent < 0 || c.MinPercent > 100 || (c.MaxPercent != 0 && c.MaxPercent < 100) {
+		errs = append(errs, errors.New("adaptive weights min percent must be between 1 and 100 and max percent at least 100"))
+	}
+	return errs
+}
+
+// AcceptRateLimitConfig defines the rate at which the listener accepts new
+// connections, whatever the client.
+type AcceptRateLimitConfig struct {
+	// Rate is the number of connections accepted per second.
+	Rate uint64 `json:"rate"`
+
+	// Burst is the number of connections accepted at once before the
+	// rate applies. Defaults to the rate.
+	Burst uint64 `json:"burst"`
+}
+
+// ReconnectStormsConfig defines when a client is in a reconnect storm:
+// its connection rate over the last minute far above its baseline, its
+// rate over the last hour.
+type ReconnectStormsConfig struct {
+	// Multiplier is the factor by which the rate must exceed the baseline.
+	// Defaults to 10.
+	Multiplier float64 `json:"multiplier"`
+
+	// MinRate is the connections per second below which a client is never
+	// in a storm. Defaults to 1.
+	MinRate float64 `json:"min_rate"`
+
+	// Limit is the connections per second a client in a storm is limited
+	// to until the storm ends. Zero does not limit them.
+	Limit uint64 `json:"limit"`
+}
+
+// OverloadSheddingConfig defines when a share of new connections is
+// closed right after being accepted because the listener is overloaded.
+type OverloadSheddingConfig struct {
+	// Threshold is the overload score, between 0 and 1, at or above
+	// which new connections are shed.
+	Threshold float64 `json:"threshold"`
+
+	// ShedFraction is the share of new connections, between 0 and 1,
+	// shed while the score is at or above the threshold.
+	ShedFraction float64 `json:"shed_fraction"`
+
+	// MaxHandshakes is the number of TLS handshakes in progress at which
+	// the handshake backlog is saturated. Optional.
+	MaxHandshakes int `json:"max_handshakes"`
+
+	// Interval is the time between two samples of the accept queue
+	// and CPU usage. Defaults to one second.
+	Interval Duration `json:"interval"`
+}
+
+// Config returns the shedding settings of the server.
+func (c *OverloadSheddingConfig) Config() *overload.Config {
+	if c == nil {
+		return nil
+	}
+	return &overload.Config{
+		Threshold:     c.Threshold,
+		ShedFraction:  c.ShedFraction,
+		MaxHandshakes: c.MaxHandshakes,
+		Interval:      c.Interval.Duration,
+	}
 }
 
 // TLSConfig defines the TLS settings.
@@ -23,24 +1017,216 @@ type TLSConfig struct {
 	// CertFile is a path to a server certificate file.
 	CertFile string `json:"cert_file"`
 
-	// KeyFile is a path to a server private key file.
-	KeyFile string `json:"key_file"`
+	// KeyFile is a path to a server private key file.
+	KeyFile string `json:"key_file"`
+
+	// CAFile is a path to a root CA file.
+	CAFile string `json:"ca_file"`
+
+	// CAReloadInterval is the time between two checks of the CA file
+	// for changes. Zero disables reloading.
+	CAReloadInterval Duration `json:"ca_reload_interval"`
+
+	// ClientCertPolicy is the constraints client certificates must meet
+	// during the handshake. Only the CA signature is verified if nil.
+	ClientCertPolicy *ClientCertPolicyConfig `json:"client_cert_policy"`
+
+	// Certificates are additional server certificates selected by the
+	// server name clients request with SNI. Clients requesting another
+	// or no server name are presented the certificate of CertFile.
+	Certificates []CertificateConfig `json:"certificates"`
+}
+
+// CertificateConfig defines an additional server certificate.
+type CertificateConfig struct {
+	// CertFile is a path to the certificate file.
+	CertFile string `json:"cert_file"`
+
+	// KeyFile is a path to the private key file.
+	KeyFile string `json:"key_file"`
+
+	// ServerNames are the server names, e.g. "lb.example.com" or
+	// "*.example.com", the certificate is presented for. Defaults to
+	// the DNS names of the certificate.
+	ServerNames []string `json:"server_names"`
+}
+
+// ClientCertPolicyConfig defines constraints on client certificates
+// beyond being signed by a trusted CA.
+type ClientCertPolicyConfig struct {
+	// ExtKeyUsages are the extended key usages, e.g. "client_auth",
+	// the client certificate must explicitly list.
+	ExtKeyUsages []string `json:"ext_key_usages"`
+
+	// PolicyOIDs are the certificate policy OIDs of which the client
+	// certificate must list at least one.
+	PolicyOIDs []string `json:"policy_oids"`
+
+	// MaxChainLength is the maximum number of certificates in the
+	// verified chain. Zero means unlimited.
+	MaxChainLength int `json:"max_chain_length"`
+}
+
+// extKeyUsages maps the configuration names of extended key usages to their values.
+var extKeyUsages = map[string]x509.ExtKeyUsage{
+	"client_auth":      x509.ExtKeyUsageClientAuth,
+	"server_auth":      x509.ExtKeyUsageServerAuth,
+	"code_signing":     x509.ExtKeyUsageCodeSigning,
+	"email_protection": x509.ExtKeyUsageEmailProtection,
+}
+
+// Policy converts the configuration to a certificate policy.
+// It must only be called on a validated configuration.
+func (c *ClientCertPolicyConfig) Policy() lib.CertificatePolicy {
+	policy := lib.CertificatePolicy{
+		PolicyOIDs:     c.PolicyOIDs,
+		MaxChainLength: c.MaxChainLength,
+	}
+	for _, name := range c.ExtKeyUsages {
+		policy.ExtKeyUsages = append(policy.ExtKeyUsages, extKeyUsages[name])
+	}
+	return policy
+}
+
+// validate verifies the extended key usage names and OIDs.
+func (c *ClientCertPolicyConfig) validate() []error {
+	var errs []error
+	for _, name := range c.ExtKeyUsages {
+		if _, ok := extKeyUsages[name]; !ok {
+			errs = append(errs, fmt.Errorf("unknown extended key usage '%s'", name))
+		}
+	}
+	for _, oid := range c.PolicyOIDs {
+		if !isOID(oid) {
+			errs = append(errs, fmt.Errorf("invalid policy OID '%s'", oid))
+		}
+	}
+	if c.MaxChainLength < 0 {
+		errs = append(errs, errors.New("max chain length must not be negative"))
+	}
+	return errs
+}
+
+// isOID reports whether s is a dotted-decimal object identifier, e.g. "2.5.29.32.0".
+func isOID(s string) bool {
+	arcs := strings.Split(s, ".")
+	if len(arcs) < 2 {
+		return false
+	}
+	for _, arc := range arcs {
+		if arc == "" || strings.Trim(arc, "0123456789") != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// FingerprintingConfig defines the TLS client fingerprinting settings.
+type FingerprintingConfig struct {
+	// Allow, if not empty, lists the only JA3 or JA4 fingerprints
+	// of clients that are allowed to connect.
+	Allow []string `json:"allow"`
+
+	// Deny lists JA3 or JA4 fingerprints of clients that are rejected.
+	Deny []string `json:"deny"`
+}
+
+// ApplicationConfig holds all the configuration settings.
+type ApplicationConfig struct {
+	// Port is a port number on which the server runs.
+	Port int `json:"port"`
+
+	// Sidecar runs the load balancer as a per-pod egress sidecar: it only
+	// listens on localhost and Unix sockets, and identifies its clients
+	// by the UID of their process rather than by client certificates.
+	Sidecar bool `json:"sidecar"`
+
+	// Backends is a list of backends to add to the load balancer.
+	// They form the default pool.
+	Backends BackendList `json:"backends"`
+
+	// Pools maps a pool name to a list of backends in the pool.
+	Pools map[string]BackendList `json:"pools"`
+
+	// PoolGroups maps a pool name to its deployment groups. Backends
+	// of the groups are added to the pool.
+	PoolGroups map[string]PoolGroupsConfig `json:"pool_groups"`
+
+	// PoolClientAuth maps a pool name to its client authentication
+	// policy: "require" (default), "request" or "none".
+	PoolClientAuth map[string]string `json:"pool_client_auth"`
+
+	// PoolKeepalives maps a pool name to the keepalive pings sent to
+	// the idle clients of its connections.
+	PoolKeepalives map[string]KeepaliveConfig `json:"pool_keepalive"`
+
+	// PoolBackendTLS maps a pool name to the TLS settings of the
+	// connections to its backends.
+	PoolBackendTLS map[string]BackendTLSConfig `json:"pool_backend_tls"`
+
+	// PoolMaintenance maps a pool name to its maintenance settings,
+	// putting the pool in maintenance on startup.
+	PoolMaintenance map[string]MaintenanceConfig `json:"pool_maintenance"`
+
+	// MigrationPools lists the pools whose backends clients may be
+	// pinned to through the admin API, e.g. during data migrations.
+	MigrationPools []string `json:"migration_pools"`
+
+	// MetadataPools lists the pools whose backend connections start with
+	// a metadata frame describing the client.
+	MetadataPools []string `json:"metadata_pools"`
+
+	// Discovery is the service discovery settings.
+	// Service discovery is disabled if nil.
+	Discovery *DiscoveryConfig `json:"discovery"`
+
+	// DefaultBackendPort is the port used for backend and ACL
+	// addresses that do not specify one.
+	DefaultBackendPort string `json:"default_backend_port"`
+
+	// MaxBackendConnections is the maximum number of active connections
+	// per backend. Zero means unlimited.
+	MaxBackendConnections int64 `json:"max_backend_connections"`
+
+	// BackendResolution is how hostname backends are resolved on dial.
+	BackendResolution ResolutionConfig `json:"backend_resolution"`
+
+	// Balancing is how a backend is selected for a connection.
+	Balancing BalancingConfig `json:"balancing"`
+
+	// Prewarm is the backend probe settings.
+	Prewarm PrewarmConfig `json:"prewarm"`
+
+	// Queue is the admission queue settings.
+	Queue QueueConfig `json:"queue"`
 
-	// CAFile is a path to a root CA file.
-	CAFile string `json:"ca_file"`
-}
+	// OutlierDetection is the outlier detection settings.
+	// Outlier detection is disabled if nil.
+	OutlierDetection *OutlierDetectionConfig `json:"outlier_detection"`
 
-// ApplicationConfig holds all the configuration settings.
-type ApplicationConfig struct {
-	// Port is a port number on which the server runs.
-	Port int `json:"port"`
+	// PassiveHealthCheck is the passive health check settings.
+	// Passive health checking is disabled if nil.
+	PassiveHealthCheck *PassiveHealthCheckConfig `json:"passive_health_check"`
 
-	// Backends is a list of backends to add to the load balancer.
-	Backends []string `json:"backends"`
+	// AdaptiveWeights is the settings for adjusting backend weights from
+	// health checks. Weights are not adjusted if nil.
+	AdaptiveWeights *AdaptiveWeightsConfig `json:"adaptive_weights"`
+
+	// ConnectionReconcileInterval is the time between two reconciliations
+	// of the backend connection counts with their active connections.
+	// Counts are not reconciled if zero.
+	ConnectionReconcileInterval Duration `json:"connection_reconcile_interval"`
 
 	// TLS is TLS configuration settings.
 	TLS *TLSConfig `json:"tls"`
 
+	// Fingerprinting is the TLS client fingerprinting settings.
+	// Fingerprinting is disabled if nil.
+	Fingerprinting *FingerprintingConfig `json:"fingerprinting"`
+
+	// ProxyProtocol is the PROXY protocol settings for backend connections.
+	ProxyProtocol ProxyProtocolConfig `json:"proxy_protocol"`
+
 	// RateLimiter is the rate limiting settings.
 	RateLimiter RateLimiterConfig `json:"rate_limiter"`
 
@@ -49,78 +1235,1048 @@ type ApplicationConfig struct {
 
 	// ClientBackendACL defines the access control list for clients and backends.
 	ClientBackendACL map[string][]string `json:"client_backend_acl"`
+
+	// UnknownClientPolicy decides how authenticated clients missing from
+	// the access control list are handled: "deny" (default), "default_pool"
+	// or "allow_all".
+	UnknownClientPolicy string `json:"unknown_client_policy"`
+
+	// AuthorizationCacheTTL is the time for which the authorization of a
+	// client is reused when it reconnects with the same certificate.
+	// Zero disables the cache.
+	AuthorizationCacheTTL Duration `json:"authorization_cache_ttl"`
+
+	// CertRolloverWindow is the grace window, from the issuance of the new
+	// certificate, during which a client whose certificate was rotated
+	// keeps the access of its previous certificate
+	// with the same CommonName until the ACL lists its new client ID.
+	// Zero disables the tolerance.
+	CertRolloverWindow Duration `json:"cert_rollover_window"`
+
+	// MaxConnections is the global limit of authorized connections.
+	// Zero means unlimited.
+	MaxConnections int `json:"max_connections"`
+
+	// PreemptIdleAfter is the idle time after which a lower-priority
+	// connection may be closed to admit a higher-priority client.
+	PreemptIdleAfter Duration `json:"preempt_idle_after"`
+
+	// ClientPriorities maps a client ID to its priority class.
+	ClientPriorities map[string]int `json:"client_priorities"`
+
+	// AcceptRateLimit is the listener accept rate limit settings.
+	// The accept rate is not limited if nil.
+	AcceptRateLimit *AcceptRateLimitConfig `json:"accept_rate_limit"`
+
+	// OverloadShedding is the settings for shedding new connections while
+	// the listener is overloaded. Shedding is disabled if nil.
+	OverloadShedding *OverloadSheddingConfig `json:"overload_shedding"`
+
+	// ReconnectStorms is the settings for detecting reconnect storms of
+	// clients. Storms are not detected if nil.
+	ReconnectStorms *ReconnectStormsConfig `json:"reconnect_storms"`
+
+	// ClientTags maps a client ID to the tags attached to its connections.
+	ClientTags map[string]map[string]string `json:"client_tags"`
+
+	// Admin is the admin API listener settings. The admin API is disabled if nil.
+	Admin *AdminConfig `json:"admin"`
+
+	// Drain is the drain settings.
+	Drain DrainConfig `json:"drain"`
+
+	// Timeouts is the connection timeouts settings.
+	Timeouts TimeoutsConfig `json:"timeouts"`
+
+	// Health is the self health check settings.
+	Health HealthConfig `json:"health"`
+
+	// Runtime is the sizing of the process to the CPUs available.
+	Runtime RuntimeConfig `json:"runtime"`
+
+	// Agent is the agent-check listener settings. The agent is disabled if nil.
+	Agent *AgentConfig `json:"agent"`
+
+	// HealthPort is the plaintext health check port settings.
+	// The health port is disabled if nil.
+	HealthPort *HealthPortConfig `json:"health_port"`
+
+	// Metrics is the metrics listener settings. Metrics are not served if nil.
+	Metrics *MetricsConfig `json:"metrics"`
+
+	// Features maps the name of an experimental behavior to its
+	// feature flag, which can be changed at runtime.
+	Features map[string]FeatureFlagConfig `json:"feature_flags"`
+
+	// RejectionResponses maps a rejection reason to the response
+	// sent to the client before the connection is closed.
+	RejectionResponses map[string]RejectionResponse `json:"rejection_responses"`
+
+	// ListenRetry defines how binding the listeners is retried.
+	ListenRetry ListenRetryConfig `json:"listen_retry"`
+
+	// SocketOptions tunes the socket of the main listener.
+	SocketOptions SocketOptionsConfig `json:"socket_options"`
+
+	// Listeners are additional listeners, e.g. on Unix sockets,
+	// each routing its connections to its own pools.
+	Listeners []ListenerConfig `json:"listeners"`
+
+	// CaptureDir is the directory debug sessions record the data of
+	// their connections in, to be replayed later. Optional.
+	CaptureDir string `json:"capture_dir"`
+
+	// AccessLog is the destination every proxied connection is recorded
+	// to once closed: "stdout", or the path to a file to append to.
+	// Connections are not recorded if empty.
+	AccessLog string `json:"access_log"`
+
+	// LogLevel is the minimum level of logged messages:
+	// debug, info, warn or error.
+	LogLevel string `json:"log_level"`
+
+	// Logging defines the format and destination of the logs.
+	Logging LoggingConfig `json:"logging"`
+
+	// FIPS restricts every TLS listener and client to FIPS 140 approved
+	// parameters and certificates, verified at startup. It requires a
+	// binary built with GOEXPERIMENT=boringcrypto.
+	FIPS bool `json:"fips"`
 }
 
 // LoadAppConfig reads the configuration from a JSON file and
-// unmarshals it into the global AppConfig variable.
+// unmarshals it into the global AppConfig variable. Unknown fields are
+// rejected, and all validation errors are reported together.
 func LoadAppConfig(configFile string) (*ApplicationConfig, error) {
 	// Initialize default settings
 	appConfig := &ApplicationConfig{
-		Port: 3003,
+		Port:     3003,
+		LogLevel: logging.LevelInfo.String(),
 		RateLimiter: RateLimiterConfig{
 			Capacity:   10,
 			RefillRate: 2,
 		},
-		AllowedClients:   make(map[string]bool),
-		ClientBackendACL: make(map[string][]string),
+		BackendResolution: ResolutionConfig{
+			Strategy: string(lib.ResolvePerDial),
+			TTL:      Duration{30 * time.Second},
+		},
+		Balancing: BalancingConfig{
+			Strategy: string(lib.BalanceLeastConnections),
+			HashKey:  HashByClientID,
+		},
+		Prewarm: PrewarmConfig{
+			Timeout: Duration{2 * time.Second},
+		},
+		AllowedClients:        make(map[string]bool),
+		ClientBackendACL:      make(map[string][]string),
+		UnknownClientPolicy:   UnknownClientDeny,
+		AuthorizationCacheTTL: Duration{5 * time.Second},
+		Drain: DrainConfig{
+			ReadinessDelay: Duration{5 * time.Second},
+			Timeout:        Duration{30 * time.Second},
+		},
+		Timeouts: TimeoutsConfig{
+			AcceptRetry:  Duration{time.Second},
+			TLSHandshake: Duration{10 * time.Second},
+			BackendDial:  Duration{5 * time.Second},
+			Shutdown:     Duration{time.Second},
+		},
+		Health: HealthConfig{
+			Interval: Duration{10 * time.Second},
+		},
+		ListenRetry: ListenRetryConfig{
+			Delay:    Duration{time.Second},
+			MaxDelay: Duration{30 * time.Second},
+		},
 	}
 
-	// Open configurations JSON file
-	f, err := os.Open(configFile)
+	// Read configurations JSON file
+	data, err := os.ReadFile(configFile)
 	if err != nil {
 		return nil, fmt.Errorf("unable to open configurations file '%s': %w", configFile, err)
 	}
 
-	if err := json.NewDecoder(f).Decode(appConfig); err != nil {
+	if err := decodeStrict(data, appConfig); err != nil {
 		return nil, fmt.Errorf("configuration parsing error for file '%s': %w", configFile, err)
 	}
 
+	if err := appConfig.validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration file '%s':\n%w", configFile, err)
+	}
+	return appConfig, nil
+}
+
+// validate verifies the configuration settings and canonicalizes
+// addresses. It reports every problem found rather than only the first,
+// joined into a single error.
+func (c *ApplicationConfig) validate() error {
+	var errs []error
+
 	// Verify if required values are provided
-	if appConfig.TLS == nil {
-		return nil, errors.New("TLS configuration is required")
+	if c.Sidecar {
+		errs = append(errs, c.validateSidecar()...)
+	} else if c.TLS == nil {
+		errs = append(errs, errors.New("TLS configuration is required"))
 	}
-	if len(appConfig.Backends) == 0 {
-		return nil, errors.New("backend service configuration is required")
+	if len(c.Backends) == 0 && len(c.Pools) == 0 && len(c.PoolGroups) == 0 &&
+		c.Discovery == nil {
+		errs = append(errs, errors.New("backend service configuration is required"))
 	}
-	if len(appConfig.AllowedClients) == 0 {
-		return nil, errors.New("allowed clients list configuration is required")
+	if d := c.Discovery; d != nil {
+		if d.Provider == "" || len(d.Pools) == 0 {
+			errs = append(errs, errors.New("discovery provider and pools are required"))
+		}
+		if slices.Contains(d.Pools, DefaultPool) {
+			errs = append(errs, fmt.Errorf("pool name '%s' is reserved for the backends list", DefaultPool))
+		}
 	}
-	if len(appConfig.ClientBackendACL) == 0 {
-		return nil, errors.New("access control list configuration is required")
+	if _, exists := c.Pools[DefaultPool]; exists {
+		errs = append(errs, fmt.Errorf("pool name '%s' is reserved for the backends list", DefaultPool))
 	}
-	return appConfig, nil
+	for pool, poolGroups := range c.PoolGroups {
+		if _, exists := poolGroups.Groups[poolGroups.Active]; !exists {
+			errs = append(errs, fmt.Errorf("active group '%s' of pool '%s' is not defined", poolGroups.Active, pool))
+		}
+	}
+	for pool, weights := range c.PoolBackendWeights() {
+		for address, weight := range weights {
+			if weight < 0 || weight > lib.MaxWeight {
+				errs = append(errs, fmt.Errorf("weight of backend %s of pool '%s' must be between 1 and %d", address, pool, lib.MaxWeight))
+			}
+		}
+	}
+	if od := c.OutlierDetection; od != nil {
+		if od.Interval.Duration <= 0 || od.BaseEjectionTime.Duration <= 0 {
+			errs = append(errs, errors.New("outlier detection interval and base ejection time must be positive"))
+		}
+		if od.MaxEjectionPercent <= 0 || od.MaxEjectionPercent > 100 {
+			errs = append(errs, errors.New("outlier detection max ejection percent must be between 1 and 100"))
+		}
+		if od.LatencyFactor < 0 || od.ErrorRateThreshold < 0 || od.ErrorRateThreshold > 1 || od.MinRequests < 0 {
+			errs = append(errs, errors.New("invalid outlier detection thresholds"))
+		}
+	}
+	if phc := c.PassiveHealthCheck; phc != nil {
+		if phc.ConsecutiveFailures <= 0 || phc.Cooldown.Duration <= 0 {
+			errs = append(errs, errors.New("passive health check consecutive failures and cooldown must be positive"))
+		}
+	}
+	if c.AdaptiveWeights != nil {
+		errs = append(errs, c.AdaptiveWeights.validate()...)
+	}
+	if c.ConnectionReconcileInterval.Duration < 0 {
+		errs = append(errs, errors.New("connection reconcile interval must not be negative"))
+	}
+	for _, part := range c.RateLimiter.Key {
+		if _, ok := rateLimitKeyParts[part]; !ok {
+			errs = append(errs, fmt.Errorf("unknown rate limiter key '%s'", part))
+		}
+	}
+	if c.Health.Interval.Duration <= 0 || c.Health.MaxGoroutines < 0 {
+		errs = append(errs, errors.New("health check interval must be positive and max goroutines must not be negative"))
+	}
+	if c.Runtime.GOMAXPROCS < 0 || c.Runtime.MaxConcurrentHandshakes < 0 {
+		errs = append(errs, errors.New("runtime gomaxprocs and max concurrent handshakes must not be negative"))
+	}
+	if c.TLS != nil && c.TLS.CAReloadInterval.Duration < 0 {
+		errs = append(errs, errors.New("CA reload interval must not be negative"))
+	}
+	if c.TLS != nil && c.TLS.ClientCertPolicy != nil {
+		errs = append(errs, c.TLS.ClientCertPolicy.validate()...)
+	}
+	if c.TLS != nil {
+		for i, certificate := range c.TLS.Certificates {
+			if certificate.CertFile == "" || certificate.KeyFile == "" {
+				errs = append(errs, fmt.Errorf("TLS certificate %d requires a certificate and a key file", i))
+			}
+		}
+	}
+	errs = append(errs, c.Timeouts.validate()...)
+	if c.AcceptRateLimit != nil && c.AcceptRateLimit.Rate == 0 {
+		errs = append(errs, errors.New("accept rate limit rate must be positive"))
+	}
+	if c.Drain.ReadinessDelay.Duration < 0 || c.Drain.Timeout.Duration <= 0 {
+		errs = append(errs, errors.New("drain readiness delay must not be negative and timeout must be positive"))
+	}
+	if c.ListenRetry.Attempts < 0 || c.ListenRetry.Delay.Duration < 0 || c.ListenRetry.MaxDelay.Duration < 0 {
+		errs = append(errs, errors.New("listen retry attempts and delays must not be negative"))
+	}
+	errs = append(errs, c.SocketOptions.validate("tcp", c.ListenAddress())...)
+	for _, listener := range c.Listeners {
+		errs = append(errs, listener.validate(c.poolNames())...)
+	}
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, c.Logging.validate()...)
+	if c.Admin != nil {
+		if c.Admin.Address == "" {
+			c.Admin.Address = DefaultAdminAddress
+		}
+		errs = append(errs, validateListenerAuth("admin", c.Admin.TLS, c.Admin.Tokens)...)
+		if c.Admin.Peers != nil {
+			errs = append(errs, c.Admin.Peers.validate()...)
+		}
+		if c.Admin.DevCA != nil {
+			errs = append(errs, c.Admin.DevCA.validate(c.Sidecar)...)
+		}
+	}
+	if c.Metrics != nil {
+		errs = append(errs, validateListenerAuth("metrics", c.Metrics.TLS, c.Metrics.Tokens)...)
+	}
+	if len(c.AllowedClients) == 0 && !c.Sidecar {
+		errs = append(errs, errors.New("allowed clients list configuration is required"))
+	} else if _, err := lib.NewCommonNameMatcher(c.AllowedClients); err != nil {
+		errs = append(errs, err)
+	}
+	if len(c.ClientBackendACL) == 0 {
+		errs = append(errs, errors.New("access control list configuration is required"))
+	}
+	if _, ok := unknownClientPolicies[c.UnknownClientPolicy]; !ok {
+		errs = append(errs, fmt.Errorf("invalid unknown client policy '%s'", c.UnknownClientPolicy))
+	} else if c.UnknownClientPolicy == UnknownClientDefaultPool && len(c.Backends) == 0 {
+		errs = append(errs, fmt.Errorf("unknown client policy '%s' requires the backends list", UnknownClientDefaultPool))
+	}
+	if c.MaxBackendConnections < 0 {
+		errs = append(errs, errors.New("max backend connections must not be negative"))
+	}
+	if _, ok := resolutionStrategies[c.BackendResolution.Strategy]; !ok {
+		errs = append(errs, fmt.Errorf("unknown backend resolution strategy '%s'", c.BackendResolution.Strategy))
+	}
+	if c.BackendResolution.TTL.Duration <= 0 {
+		errs = append(errs, errors.New("backend resolution TTL must be positive"))
+	}
+	if c.BackendResolution.Timeout.Duration < 0 || c.BackendResolution.NegativeTTL.Duration < 0 {
+		errs = append(errs, errors.New("backend resolution timeout and negative TTL must not be negative"))
+	}
+	for _, server := range c.BackendResolution.DNSServers {
+		if _, _, err := net.SplitHostPort(server); err != nil && net.ParseIP(server) == nil {
+			errs = append(errs, fmt.Errorf("invalid DNS server '%s'", server))
+		}
+	}
+	if _, ok := balancingStrategies[c.Balancing.Strategy]; !ok {
+		errs = append(errs, fmt.Errorf("unknown balancing strategy '%s'", c.Balancing.Strategy))
+	}
+	if c.Balancing.HashKey != HashByClientID && c.Balancing.HashKey != HashBySourceIP {
+		errs = append(errs, fmt.Errorf("unknown balancing hash key '%s'", c.Balancing.HashKey))
+	}
+	if c.Balancing.FirstByteLatency && c.Balancing.Strategy != string(lib.BalanceLeastLatency) {
+		errs = append(errs, errors.New("balancing first byte latency requires the least_latency strategy"))
+	}
+	if c.Balancing.SpreadFailureDomains && c.Balancing.Strategy == string(lib.BalanceConsistentHash) {
+		errs = append(errs, errors.New("spreading failure domains is not available with the consistent_hash strategy"))
+	}
+	if c.Prewarm.Enabled && c.Prewarm.Timeout.Duration <= 0 {
+		errs = append(errs, errors.New("prewarm timeout must be positive"))
+	}
+	if c.Queue.Size < 0 || c.Queue.Timeout.Duration < 0 {
+		errs = append(errs, errors.New("queue size and timeout must not be negative"))
+	}
+	if c.Queue.Size > 0 && c.Queue.Timeout.Duration == 0 {
+		errs = append(errs, errors.New("queue timeout is required when queueing is enabled"))
+	}
+	if c.AuthorizationCacheTTL.Duration < 0 {
+		errs = append(errs, errors.New("authorization cache TTL must not be negative"))
+	}
+	if c.CertRolloverWindow.Duration < 0 {
+		errs = append(errs, errors.New("certificate rollover window must not be negative"))
+	}
+	if c.MaxConnections < 0 || c.PreemptIdleAfter.Duration < 0 {
+		errs = append(errs, errors.New("max connections and preemption idle time must not be negative"))
+	}
+	if c.OverloadShedding != nil {
+		if c.OverloadShedding.Interval.Duration == 0 {
+			c.OverloadShedding.Interval = Duration{time.Second}
+		}
+		if err := c.OverloadShedding.Config().Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if storms := c.ReconnectStorms; storms != nil {
+		if storms.Multiplier == 0 {
+			storms.Multiplier = 10
+		}
+		if storms.MinRate == 0 {
+			storms.MinRate = 1
+		}
+		if storms.Multiplier <= 1 || storms.MinRate < 0 {
+			errs = append(errs, errors.New("reconnect storm multiplier must be greater than 1 and min rate must not be negative"))
+		}
+	}
+	for clientID, tags := range c.ClientTags {
+		if _, exists := tags[""]; exists {
+			errs = append(errs, fmt.Errorf("empty tag name for client %s", clientID))
+		}
+	}
+	if c.Agent != nil && c.Agent.Address == "" {
+		errs = append(errs, errors.New("agent listener address is required"))
+	}
+	if c.HealthPort != nil {
+		if c.HealthPort.Address == "" {
+			errs = append(errs, errors.New("health port address is required"))
+		}
+		if c.HealthPort.Banner == "" {
+			c.HealthPort.Banner = DefaultHealthPortBanner
+		}
+	}
+	if c.Metrics != nil && c.Metrics.Address == "" {
+		errs = append(errs, errors.New("metrics listener address is required"))
+	}
+	if err := canonicalizeAddresses(c); err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, c.checkSelfBackends()...)
+	pools := c.PoolBackends()
+	for pool, policy := range c.PoolClientAuth {
+		if _, exists := pools[pool]; !exists && !c.isDiscoveredPool(pool) {
+			errs = append(errs, fmt.Errorf("client auth policy of unknown pool '%s'", pool))
+		}
+		if _, ok := clientAuthPolicies[policy]; !ok {
+			errs = append(errs, fmt.Errorf("invalid client auth policy '%s' of pool '%s'", policy, pool))
+		}
+	}
+	for pool, backendTLS := range c.PoolBackendTLS {
+		if _, exists := pools[pool]; !exists && !c.isDiscoveredPool(pool) {
+			errs = append(errs, fmt.Errorf("backend TLS of unknown pool '%s'", pool))
+		}
+		if (backendTLS.CertFile == "") != (backendTLS.KeyFile == "") {
+			errs = append(errs, fmt.Errorf("backend TLS certificate and key files of pool '%s' must be set together", pool))
+		}
+	}
+	for _, pool := range c.MigrationPools {
+		if _, exists := pools[pool]; !exists && !c.isDiscoveredPool(pool) {
+			errs = append(errs, fmt.Errorf("unknown migration pool '%s'", pool))
+		}
+	}
+	for _, pool := range c.MetadataPools {
+		if _, exists := pools[pool]; !exists && !c.isDiscoveredPool(pool) {
+			errs = append(errs, fmt.Errorf("unknown metadata pool '%s'", pool))
+		}
+	}
+	for pool, queue := range c.Queue.Pools {
+		if _, exists := pools[pool]; !exists && !c.isDiscoveredPool(pool) {
+			errs = append(errs, fmt.Errorf("queue of unknown pool '%s'", pool))
+		}
+		if queue.Size < 0 || queue.Timeout.Duration < 0 {
+			errs = append(errs, fmt.Errorf("queue size and timeout of pool '%s' must not be negative", pool))
+		}
+		if queue.Size > 0 && queue.Timeout.Duration == 0 {
+			if c.Queue.Timeout.Duration == 0 {
+				errs = append(errs, fmt.Errorf("queue timeout of pool '%s' is required when queueing is enabled", pool))
+			}
+			queue.Timeout = c.Queue.Timeout
+			c.Queue.Pools[pool] = queue
+		}
+	}
+	for pool, keepalive := range c.PoolKeepalives {
+		if _, exists := pools[pool]; !exists && !c.isDiscoveredPool(pool) {
+			errs = append(errs, fmt.Errorf("keepalive of unknown pool '%s'", pool))
+		}
+		if keepalive.Interval.Duration <= 0 {
+			errs = append(errs, fmt.Errorf("keepalive interval of pool '%s' must be positive", pool))
+		}
+		if keepalive.Timeout.Duration < 0 {
+			errs = append(errs, fmt.Errorf("keepalive timeout of pool '%s' must not be negative", pool))
+		}
+		if k, err := keepalive.Keepalive(); err != nil {
+			errs = append(errs, fmt.Errorf("keepalive of pool '%s': %w", pool, err))
+		} else if len(k.Ping) == 0 {
+			errs = append(errs, fmt.Errorf("keepalive ping of pool '%s' is required", pool))
+		}
+	}
+	for pool, maintenance := range c.PoolMaintenance {
+		if _, exists := pools[pool]; !exists && !c.isDiscoveredPool(pool) {
+			errs = append(errs, fmt.Errorf("maintenance of unknown pool '%s'", pool))
+		}
+		if _, err := maintenance.Message.Bytes(); err != nil {
+			errs = append(errs, fmt.Errorf("maintenance message of pool '%s': %w", pool, err))
+		}
+	}
+	if _, err := featureflag.NewSet(c.FeatureFlags()...); err != nil {
+		errs = append(errs, err)
+	}
+	for name, feature := range c.Features {
+		for _, pool := range feature.Pools {
+			if _, exists := pools[pool]; !exists && !c.isDiscoveredPool(pool) {
+				errs = append(errs, fmt.Errorf("feature flag '%s' of unknown pool '%s'", name, pool))
+			}
+		}
+	}
+	for reason, response := range c.RejectionResponses {
+		if _, ok := rejectionReasons[reason]; !ok {
+			errs = append(errs, fmt.Errorf("unknown rejection reason '%s'", reason))
+		}
+		if _, err := response.Bytes(); err != nil {
+			errs = append(errs, fmt.Errorf("rejection response for '%s': %w", reason, err))
+		}
+	}
+	return errors.Join(errs...)
 }
 
-// MakeServerTLSConfig creates a TLS configuration using the provided certificate,
-// key, and CA files and ensures that only TLS 1.3 is used,
-// requires and verifies client certificates for mutual TLS authentication.
-// It returns a configured tls.Config object.
-func MakeServerTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
-	// Load the certificate and private key
-	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+// DefaultPool is the name of the pool formed by the backends list.
+const DefaultPool = "default"
+
+// PoolPrefix marks an access control list entry that refers to a whole
+// pool (e.g. "pool:primary") rather than to a single backend address.
+const PoolPrefix = lib.PoolPrefix
+
+// DenyPrefix marks an access control list entry that denies a backend
+// or pool (e.g. "!pool:primary") even if another entry allows it.
+const DenyPrefix = lib.DenyPrefix
+
+// PoolBackends returns the backends of every pool, including the
+// default pool formed by the backends list and the backends of the
+// pools' deployment groups.
+func (c *ApplicationConfig) PoolBackends() map[string][]string {
+	pools := make(map[string][]string, len(c.Pools)+1)
+	if len(c.Backends) > 0 {
+		pools[DefaultPool] = c.Backends.Addresses()
+	}
+	for name, backends := range c.Pools {
+		pools[name] = backends.Addresses()
+	}
+	for name, poolGroups := range c.PoolGroups {
+		for _, backends := range poolGroups.Groups {
+			pools[name] = append(pools[name], backends.Addresses()...)
+		}
+	}
+	return pools
+}
+
+// PoolBackendWeights maps a pool name to the configured weights of its
+// backends, by address. Backends without a configured weight are omitted.
+func (c *ApplicationConfig) PoolBackendWeights() map[string]map[string]int {
+	weights := make(map[string]map[string]int)
+	c.eachPoolBackend(func(pool string, backend BackendConfig) {
+		if backend.Weight == 0 {
+			return
+		}
+		if weights[pool] == nil {
+			weights[pool] = make(map[string]int)
+		}
+		weights[pool][backend.Address] = backend.Weight
+	})
+	return weights
+}
+
+// PoolBackendFailureDomains maps a pool name to the failure domains of its
+// backends, by address. Backends without a failure domain are omitted.
+func (c *ApplicationConfig) PoolBackendFailureDomains() map[string]map[string]string {
+	domains := make(map[string]map[string]string)
+	c.eachPoolBackend(func(pool string, backend BackendConfig) {
+		if backend.FailureDomain == "" {
+			return
+		}
+		if domains[pool] == nil {
+			domains[pool] = make(map[string]string)
+		}
+		domains[pool][backend.Address] = backend.FailureDomain
+	})
+	return domains
+}
+
+// eachPoolBackend calls fn with every configured backend and its pool.
+func (c *ApplicationConfig) eachPoolBackend(fn func(pool string, backend BackendConfig)) {
+	add := func(pool string, backends BackendList) {
+		for _, backend := range backends {
+			fn(pool, backend)
+		}
+	}
+	add(DefaultPool, c.Backends)
+	for name, backends := range c.Pools {
+		add(name, backends)
+	}
+	for name, poolGroups := range c.PoolGroups {
+		for _, backends := range poolGroups.Groups {
+			add(name, backends)
+		}
+	}
+}
+
+// BackendGroups maps a backend address to its deployment group.
+func (c *ApplicationConfig) BackendGroups() map[string]string {
+	groups := make(map[string]string)
+	for _, poolGroups := range c.PoolGroups {
+		for group, backends := range poolGroups.Groups {
+			for _, backend := range backends {
+				groups[backend.Address] = group
+			}
+		}
+	}
+	return groups
+}
+
+// poolNames returns the names of the configured and discovered pools.
+func (c *ApplicationConfig) poolNames() []string {
+	var names []string
+	for pool := range c.PoolBackends() {
+		names = append(names, pool)
+	}
+	if c.Discovery != nil {
+		for _, pool := range c.Discovery.Pools {
+			if !slices.Contains(names, pool) {
+				names = append(names, pool)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ClientAuth returns the client authentication type of the listener,
+// which is shared by all pools: certificates are required unless a pool
+// admits clients presenting none, and only requested if a pool
+// authenticates clients.
+func (c *ApplicationConfig) ClientAuth() tls.ClientAuthType {
+	var authenticated, relaxed bool
+	for _, pool := range c.poolNames() {
+		switch c.PoolClientAuth[pool] {
+		case ClientAuthRequest:
+			authenticated, relaxed = true, true
+		case ClientAuthNone:
+			relaxed = true
+		default:
+			authenticated = true
+		}
+	}
+	switch {
+	case !relaxed:
+		return tls.RequireAndVerifyClientCert
+	case authenticated:
+		return tls.VerifyClientCertIfGiven
+	default:
+		return tls.NoClientCert
+	}
+}
+
+// AnonymousPools returns the pools admitting clients that
+// present no certificate, sorted by name.
+func (c *ApplicationConfig) AnonymousPools() []string {
+	var pools []string
+	for _, pool := range c.poolNames() {
+		if policy := c.PoolClientAuth[pool]; policy == ClientAuthRequest || policy == ClientAuthNone {
+			pools = append(pools, pool)
+		}
+	}
+	return pools
+}
+
+// isDiscoveredPool reports whether the pool's backends are discovered at runtime.
+func (c *ApplicationConfig) isDiscoveredPool(pool string) bool {
+	return c.Discovery != nil && slices.Contains(c.Discovery.Pools, pool)
+}
+
+// ListenAddress returns the address the load balancer listens on,
+// the loopback address in sidecar mode.
+func (c *ApplicationConfig) ListenAddress() string {
+	if c.Sidecar {
+		return fmt.Sprintf("127.0.0.1:%d", c.Port)
+	}
+	return fmt.Sprintf(":%d", c.Port)
+}
+
+// validateSidecar rejects the settings that would expose the load
+// balancer beyond the host or that rely on client TLS in sidecar mode.
+func (c *ApplicationConfig) validateSidecar() []error {
+	var errs []error
+	if c.TLS != nil {
+		errs = append(errs, errors.New("tls must not be set in sidecar mode, clients are identified by their UID"))
+	}
+	if len(c.AllowedClients) > 0 {
+		errs = append(errs, errors.New("allowed_clients must not be set in sidecar mode, clients present no certificate"))
+	}
+	if c.Fingerprinting != nil {
+		errs = append(errs, errors.New("fingerprinting requires client TLS and is not supported in sidecar mode"))
+	}
+	if c.ProxyProtocol.Accept {
+		errs = append(errs, errors.New("accepting the PROXY protocol is not supported in sidecar mode"))
+	}
+	for _, listener := range c.Listeners {
+		if !listen.IsLocal(listener.Network, listener.Address) {
+			errs = append(errs, fmt.Errorf("listener %q must be a Unix socket or a loopback address in sidecar mode", listener.Address))
+		}
+	}
+	return errs
+}
+
+// checkSelfBackends rejects backends that refer to the load balancer's
+// own listener, directly or via name resolution, which would make it
+// proxy connections to itself.
+func (c *ApplicationConfig) checkSelfBackends() []error {
+	matcher, err := lib.NewSelfAddressMatcher(c.ListenAddress())
 	if err != nil {
-		return nil, fmt.Errorf("unable to load server certificate and key: %w", err)
+		return []error{err}
+	}
+
+	pools := c.PoolBackends()
+	names := make([]string, 0, len(pools))
+	for pool := range pools {
+		names = append(names, pool)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, pool := range names {
+		for _, address := range pools[pool] {
+			if matcher.Matches(address) {
+				errs = append(errs, fmt.Errorf("%w: backend %s of pool '%s'", lib.ErrSelfBackend, address, pool))
+			}
+		}
+	}
+	return errs
+}
+
+// canonicalizeAddresses rewrites backend addresses and ACL entries into
+// their canonical form, resolving ACL entries that refer to a backend by
+// hostname, IPv6 literal or without a port, so that authorization
+// matching does not depend on how an address happens to be spelled.
+func canonicalizeAddresses(appConfig *ApplicationConfig) error {
+	pools := appConfig.PoolBackends()
+	var allBackends []string
+	for _, backends := range pools {
+		allBackends = append(allBackends, backends...)
+	}
+
+	matcher, err := lib.NewAddressMatcher(allBackends, appConfig.DefaultBackendPort)
+	if err != nil {
+		return fmt.Errorf("invalid backend configuration: %w", err)
+	}
+
+	// Rewrite the configured lists in place, as pools may be built from
+	// the backends list, the pools map and the deployment groups
+	canonicalize := func(backends BackendList) {
+		for i, backend := range backends {
+			// Backend addresses were validated by the matcher
+			backends[i].Address, _ = matcher.Canonical(backend.Address)
+		}
+	}
+	canonicalize(appConfig.Backends)
+	for _, backends := range appConfig.Pools {
+		canonicalize(backends)
+	}
+	for _, poolGroups := range appConfig.PoolGroups {
+		for _, backends := range poolGroups.Groups {
+			canonicalize(backends)
+		}
+	}
+
+	return canonicalizeACL(appConfig, appConfig.ClientBackendACL, pools, matcher)
+}
+
+// CanonicalizeACL validates an access control list against the configured
+// backends and pools and rewrites its entries into their canonical form,
+// as is done for the configured list on load.
+func (c *ApplicationConfig) CanonicalizeACL(acl map[string][]string) error {
+	if len(acl) == 0 {
+		return errors.New("access control list configuration is required")
+	}
+
+	pools := c.PoolBackends()
+	var allBackends []string
+	for _, backends := range pools {
+		allBackends = append(allBackends, backends...)
+	}
+
+	matcher, err := lib.NewAddressMatcher(allBackends, c.DefaultBackendPort)
+	if err != nil {
+		return fmt.Errorf("invalid backend configuration: %w", err)
+	}
+	return canonicalizeACL(c, acl, pools, matcher)
+}
+
+// CanonicalizeRuntimeACL is like CanonicalizeACL, but also accepts the
+// addresses and pools of the backends registered at runtime, e.g. added
+// through the admin API, so that access to them can be granted.
+func (c *ApplicationConfig) CanonicalizeRuntimeACL(acl map[string][]string, registered []*lib.Backend) error {
+	if len(acl) == 0 {
+		return errors.New("access control list configuration is required")
+	}
+
+	pools := c.PoolBackends()
+	var allBackends []string
+	known := make(map[string]struct{})
+	for _, backends := range pools {
+		for _, backend := range backends {
+			allBackends = append(allBackends, backend)
+			if canonical, err := lib.CanonicalAddress(backend, c.DefaultBackendPort); err == nil {
+				known[canonical] = struct{}{}
+			}
+		}
+	}
+	for _, backend := range registered {
+		if _, exists := pools[backend.Pool]; !exists && backend.Pool != "" {
+			pools[backend.Pool] = nil
+		}
+		if _, exists := known[backend.Address]; !exists {
+			allBackends = append(allBackends, backend.Address)
+			known[backend.Address] = struct{}{}
+		}
+	}
+
+	matcher, err := lib.NewAddressMatcher(allBackends, c.DefaultBackendPort)
+	if err != nil {
+		return fmt.Errorf("invalid backend configuration: %w", err)
+	}
+	return canonicalizeACL(c, acl, pools, matcher)
+}
+
+// canonicalizeACL rewrites the entries of acl in place using matcher and
+// verifies that the pools they refer to exist.
+func canonicalizeACL(appConfig *ApplicationConfig, acl map[string][]string, pools map[string][]string, matcher *lib.AddressMatcher) error {
+	var errs []error
+	for clientID, entries := range acl {
+		if clientID == "" {
+			errs = append(errs, errors.New("invalid access control list: empty client ID"))
+			continue
+		}
+		for i, entry := range entries {
+			// Deny entries are canonicalized like allow entries
+			address, deny := strings.CutPrefix(entry, DenyPrefix)
+
+			// Pool references are kept as-is
+			if pool, ok := strings.CutPrefix(address, PoolPrefix); ok {
+				if _, exists := pools[pool]; !exists && !appConfig.isDiscoveredPool(pool) {
+					errs = append(errs, fmt.Errorf("invalid access control list entry for client %s: unknown pool '%s'", clientID, pool))
+				}
+				continue
+			}
+
+			canonical, err := matcher.Match(address)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid access control list entry for client %s: %w", clientID, err))
+				continue
+			}
+			if deny {
+				canonical = DenyPrefix + canonical
+			}
+			entries[i] = canonical
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ClientCAFileBundle is the name of the client CA bundle loaded from the CA file.
+const ClientCAFileBundle = "ca_file"
+
+// DevCABundle is the name of the client CA bundle of the development CA.
+const DevCABundle = "dev_ca"
+
+// validateListenerAuth verifies the TLS and token settings of a control-plane listener.
+func validateListenerAuth(listener string, tlsConfig *ListenerTLSConfig, tokens []string) []error {
+	var errs []error
+	if tlsConfig != nil && (tlsConfig.CertFile == "" || tlsConfig.KeyFile == "") {
+		errs = append(errs, fmt.Errorf("%s listener TLS certificate and key files are required", listener))
+	}
+	if len(tokens) > 0 && tlsConfig == nil {
+		errs = append(errs, fmt.Errorf("%s listener tokens require TLS", listener))
+	}
+	if slices.Contains(tokens, "") {
+		errs = append(errs, fmt.Errorf("empty %s listener token", listener))
+	}
+	return errs
+}
+
+// validate returns the problems of the development CA settings and
+// applies their defaults.
+func (c *DevCAConfig) validate(sidecar bool) []error {
+	var errs []error
+	if sidecar {
+		errs = append(errs, errors.New("dev_ca requires client TLS and is not supported in sidecar mode"))
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		errs = append(errs, errors.New("dev CA certificate and key files must be set together"))
+	}
+	if c.MaxTTL.Duration < 0 {
+		errs = append(errs, errors.New("dev CA max TTL must not be negative"))
+	} else if c.MaxTTL.Duration == 0 {
+		c.MaxTTL.Duration = DefaultDevCAMaxTTL
+	}
+	return errs
+}
+
+// validate returns the problems of the peer settings.
+func (c *PeersConfig) validate() []error {
+	var errs []error
+	if len(c.URLs) == 0 {
+		errs = append(errs, errors.New("admin peer URLs are required"))
+	}
+	https := true
+	for _, peer := range c.URLs {
+		u, err := url.Parse(peer)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("invalid admin peer URL '%s'", peer))
+			continue
+		}
+		https = https && u.Scheme == "https"
+	}
+	if c.Token != "" && !https {
+		errs = append(errs, errors.New("admin peer token requires https peer URLs"))
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		errs = append(errs, errors.New("admin peer certificate and key files must be set together"))
+	}
+	if c.Timeout.Duration < 0 {
+		errs = append(errs, errors.New("admin peer timeout must not be negative"))
+	} else if c.Timeout.Duration == 0 {
+		c.Timeout.Duration = DefaultPeerTimeout
+	}
+	return errs
+}
+
+// MakePeerTLSConfig creates the TLS configuration of the requests
+// to the peer admin APIs.
+func MakePeerTLSConfig(peersConfig *PeersConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS13}
+	if peersConfig.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(peersConfig.CertFile, peersConfig.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load admin peer certificate and key: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if peersConfig.CAFile == "" {
+		return tlsConfig, nil
+	}
+
+	caCert, err := os.ReadFile(peersConfig.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read admin peer CA certificate: %w", err)
+	}
+	tlsConfig.RootCAs = x509.NewCertPool()
+	if !tlsConfig.RootCAs.AppendCertsFromPEM(caCert) {
+		return nil, errors.New("no certificates found in admin peer CA file")
+	}
+	return tlsConfig, nil
+}
+
+// MakeBackendTLSConfig creates the TLS configuration of the connections
+// to the backends of a pool.
+func MakeBackendTLSConfig(backendTLS BackendTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: backendTLS.ServerName}
+	if backendTLS.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(backendTLS.CertFile, backendTLS.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load backend TLS certificate and key: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if backendTLS.CAFile == "" {
+		return tlsConfig, nil
 	}
 
+	caCert, err := os.ReadFile(backendTLS.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read backend CA certificate: %w", err)
+	}
+	tlsConfig.RootCAs = x509.NewCertPool()
+	if !tlsConfig.RootCAs.AppendCertsFromPEM(caCert) {
+		return nil, errors.New("no certificates found in backend CA file")
+	}
+	return tlsConfig, nil
+}
+
+// LoadClientCAs creates a client CA pool trusting the CAs of the CA file.
+func LoadClientCAs(caFile string) (*lib.ClientCAPool, error) {
 	// Read the CA certificate file
 	caCert, err := os.ReadFile(caFile)
 	if err != nil {
 		return nil, fmt.Errorf("unable to read CA certificate: %w", err)
 	}
 
-	// Create a new certificate pool and add the CA certificate to it
-	caCertPool := x509.NewCertPool()
-	ok := caCertPool.AppendCertsFromPEM(caCert)
-	if !ok {
-		return nil, errors.New("unable to parse CA certificate PEM")
+	clientCAs := lib.NewClientCAPool()
+	if err := clientCAs.Set(ClientCAFileBundle, caCert); err != nil {
+		return nil, err
+	}
+	return clientCAs, nil
+}
+
+// MakeServerTLSConfig creates a TLS configuration using the provided certificate
+// and key files, presenting the additional certificates to clients requesting
+// their server names with SNI, and ensures that only TLS 1.3 is used, and authenticates
+// clients according to clientAuth, e.g. tls.RequireAndVerifyClientCert
+// for mutual TLS authentication.
+// Client certificates are verified against the CAs trusted by clientCAs
+// at the time of the handshake, so CAs can be rotated at runtime, then
+// by verifyPeer if not nil, e.g. to enforce a certificate policy.
+// It returns a configured tls.Config object.
+func MakeServerTLSConfig(
+	certFile, keyFile string,
+	certificates []CertificateConfig,
+	clientCAs *lib.ClientCAPool,
+	clientAuth tls.ClientAuthType,
+	verifyPeer lib.PeerVerifier,
+	fipsMode bool,
+) (*tls.Config, error) {
+	// Load the certificate and private key
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load server certificate and key: %w", err)
 	}
 
 	// Construct the TLS configuration
 	tlsConfig := &tls.Config{
 		MinVersion:   tls.VersionTLS13,
 		Certificates: []tls.Certificate{cert},
-		ClientAuth:   tls.RequireAndVerifyClientCert,
-		ClientCAs:    caCertPool,
+		ClientAuth:   clientAuth,
+	}
+	if len(certificates) > 0 {
+		selector := lib.NewCertificateSelector(cert)
+		for _, certificate := range certificates {
+			sniCert, err := tls.LoadX509KeyPair(certificate.CertFile, certificate.KeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("unable to load server certificate '%s': %w", certificate.CertFile, err)
+			}
+			if fipsMode {
+				if err := fips.VerifyCertificate(sniCert); err != nil {
+					return nil, fmt.Errorf("server certificate '%s': %w", certificate.CertFile, err)
+				}
+			}
+			if err := selector.Add(sniCert, certificate.ServerNames...); err != nil {
+				return nil, fmt.Errorf("invalid server certificate '%s': %w", certificate.CertFile, err)
+			}
+		}
+		tlsConfig.GetCertificate = selector.GetCertificate
+	}
+	if verifyPeer != nil {
+		tlsConfig.VerifyPeerCertificate = verifyPeer
+	}
+	// Handshakes use copies of this configuration, which must
+	// already be restricted
+	if fipsMode {
+		fips.Apply(tlsConfig)
+	}
+	return clientCAs.TLSConfig(tlsConfig), nil
+}
+
+// MakeListenerTLSConfig creates the TLS configuration of a control-plane
+// listener. If a client CA file is set, clients must present a certificate
+// it verifies, unless tokenAuth is true, in which case a bearer token may be
+// presented instead.
+func MakeListenerTLSConfig(listenerConfig *ListenerTLSConfig, tokenAuth bool) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(listenerConfig.CertFile, listenerConfig.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load listener certificate and key: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS13,
+		Certificates: []tls.Certificate{cert},
+	}
+	if listenerConfig.ClientCAFile == "" {
+		return tlsConfig, nil
+	}
+
+	caCert, err := os.ReadFile(listenerConfig.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read listener client CA certificate: %w", err)
+	}
+	tlsConfig.ClientCAs = x509.NewCertPool()
+	if !tlsConfig.ClientCAs.AppendCertsFromPEM(caCert) {
+		return nil, errors.New("no certificates found in listener client CA file")
+	}
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	if tokenAuth {
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
 	}
 	return tlsConfig, nil
 }
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// decodeStrict unmarshals a JSON document into v, rejecting fields that
+// do not exist in v and trailing data after the document. Syntax and
+// type errors are reported with the line and column they occurred at.
+func decodeStrict(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(v); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			// The offset is just past the offending character
+			line, col := position(data, max(syntaxErr.Offset-1, 0))
+			return fmt.Errorf("line %d, column %d: %w", line, col, err)
+		case errors.As(err, &typeErr):
+			line, col := position(data, typeErr.Offset)
+			return fmt.Errorf("line %d, column %d: field '%s' must be of type %s, got %s",
+				line, col, typeErr.Field, typeErr.Type, typeErr.Value)
+		}
+		return err
+	}
+	if dec.More() {
+		line, col := position(data, dec.InputOffset())
+		return fmt.Errorf("line %d, column %d: unexpected data after the configuration object", line, col)
+	}
+	return nil
+}
+
+// position converts a byte offset in data into a 1-based line and column.
+func position(data []byte, offset int64) (line, col int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line = bytes.Count(before, []byte("\n")) + 1
+	col = int(offset) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
@@ -0,0 +1,338 @@
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/lib"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeStrict(t *testing.T) {
+	require := require.New(t)
+
+	var appConfig ApplicationConfig
+	require.NoError(decodeStrict([]byte(`{"rate_limiter": {"refill_rate": 5}}`), &appConfig))
+	require.Equal(uint64(5), appConfig.RateLimiter.RefillRate)
+
+	err := decodeStrict([]byte(`{"rate_limiter": {"refil_rate": 5}}`), &appConfig)
+	require.ErrorContains(err, `unknown field "refil_rate"`)
+
+	err = decodeStrict([]byte("{\n  \"port\": \"3003\"\n}"), &appConfig)
+	require.ErrorContains(err, "line 2")
+	require.ErrorContains(err, "field 'port'")
+
+	err = decodeStrict([]byte("{\n  \"port\": 3003,\n}"), &appConfig)
+	require.ErrorContains(err, "line 3, column 1")
+
+	err = decodeStrict([]byte(`{"port": 3003} {}`), &appConfig)
+	require.ErrorContains(err, "unexpected data")
+}
+
+func TestValidateAggregatesErrors(t *testing.T) {
+	require := require.New(t)
+
+	appConfig := &ApplicationConfig{
+		MaxBackendConnections:       -1,
+		ConnectionReconcileInterval: Duration{-time.Minute},
+		Health:                      HealthConfig{Interval: Duration{}},
+	}
+	err := appConfig.validate()
+	require.ErrorContains(err, "TLS configuration is required")
+	require.ErrorContains(err, "max backend connections must not be negative")
+	require.ErrorContains(err, "connection reconcile interval must not be negative")
+	require.ErrorContains(err, "health check interval must be positive")
+}
+
+func TestReconnectStormsDefaults(t *testing.T) {
+	require := require.New(t)
+
+	appConfig := &ApplicationConfig{ReconnectStorms: &ReconnectStormsConfig{Limit: 5}}
+	require.NotContains(appConfig.validate().Error(), "reconnect storm")
+	require.Equal(&ReconnectStormsConfig{Multiplier: 10, MinRate: 1, Limit: 5}, appConfig.ReconnectStorms)
+
+	appConfig.ReconnectStorms.Multiplier = 0.5
+	require.ErrorContains(appConfig.validate(), "reconnect storm multiplier must be greater than 1")
+}
+
+func TestClientAuth(t *testing.T) {
+	require := require.New(t)
+
+	appConfig := &ApplicationConfig{
+		Backends: BackendList{{Address: "127.0.0.1:5001"}},
+		Pools:    map[string]BackendList{"legacy": {{Address: "127.0.0.1:5002"}}},
+	}
+	require.Equal(tls.RequireAndVerifyClientCert, appConfig.ClientAuth())
+	require.Empty(appConfig.AnonymousPools())
+
+	appConfig.PoolClientAuth = map[string]string{"legacy": ClientAuthNone}
+	require.Equal(tls.VerifyClientCertIfGiven, appConfig.ClientAuth())
+	require.Equal([]string{"legacy"}, appConfig.AnonymousPools())
+
+	appConfig.PoolClientAuth[DefaultPool] = ClientAuthNone
+	require.Equal(tls.NoClientCert, appConfig.ClientAuth())
+	require.Equal([]string{DefaultPool, "legacy"}, appConfig.AnonymousPools())
+
+	appConfig.PoolClientAuth[DefaultPool] = ClientAuthRequest
+	require.Equal(tls.VerifyClientCertIfGiven, appConfig.ClientAuth())
+}
+
+func TestBackendWeights(t *testing.T) {
+	require := require.New(t)
+
+	var appConfig ApplicationConfig
+	require.NoError(decodeStrict([]byte(`{
+		"backends": ["127.0.0.1:5001", {"address": "127.0.0.1:5002", "weight": 300}],
+		"pools": {"big": [{"address": "127.0.0.1:5003", "weight": 200, "failure_domain": "rack-a"}, {"address": "127.0.0.1:5004"}]}
+	}`), &appConfig))
+	require.Equal(map[string][]string{
+		DefaultPool: {"127.0.0.1:5001", "127.0.0.1:5002"},
+		"big":       {"127.0.0.1:5003", "127.0.0.1:5004"},
+	}, appConfig.PoolBackends())
+	require.Equal(map[string]map[string]int{
+		DefaultPool: {"127.0.0.1:5002": 300},
+		"big":       {"127.0.0.1:5003": 200},
+	}, appConfig.PoolBackendWeights())
+	require.Equal(map[string]map[string]string{
+		"big": {"127.0.0.1:5003": "rack-a"},
+	}, appConfig.PoolBackendFailureDomains())
+
+	err := decodeStrict([]byte(`{"backends": [{"address": "127.0.0.1:5001", "wieght": 300}]}`), &appConfig)
+	require.ErrorContains(err, `unknown field "wieght"`)
+
+	appConfig.Pools["big"][0].Weight = lib.MaxWeight + 1
+	require.ErrorContains(appConfig.validate(), "weight of backend 127.0.0.1:5003 of pool 'big' must be between 1 and 1000")
+}
+
+func TestValidateSelfBackends(t *testing.T) {
+	require := require.New(t)
+
+	appConfig := &ApplicationConfig{
+		Port:     3003,
+		Backends: BackendList{{Address: "127.0.0.1:5001"}},
+		Pools:    map[string]BackendList{"loop": {{Address: "127.0.0.1:3003"}}},
+		Health:   HealthConfig{Interval: Duration{time.Second}},
+	}
+	err := appConfig.validate()
+	require.ErrorIs(err, lib.ErrSelfBackend)
+	require.ErrorContains(err, "backend 127.0.0.1:3003 of pool 'loop'")
+
+	appConfig.Port = 3004
+	require.NotErrorIs(appConfig.validate(), lib.ErrSelfBackend)
+}
+
+func TestValidatePeers(t *testing.T) {
+	require := require.New(t)
+
+	peers := &PeersConfig{URLs: []string{"https://10.0.0.2:9000", "https://10.0.0.3:9000/"}, Token: "secret"}
+	require.Empty(peers.validate())
+	require.Equal(DefaultPeerTimeout, peers.Timeout.Duration)
+
+	peers = &PeersConfig{
+		URLs:     []string{"http://10.0.0.2:9000", "10.0.0.3:9000"},
+		Token:    "secret",
+		CertFile: "peer.crt",
+		Timeout:  Duration{-time.Second},
+	}
+	err := errors.Join(peers.validate()...)
+	require.ErrorContains(err, "invalid admin peer URL '10.0.0.3:9000'")
+	require.ErrorContains(err, "admin peer token requires https peer URLs")
+	require.ErrorContains(err, "admin peer certificate and key files must be set together")
+	require.ErrorContains(err, "admin peer timeout must not be negative")
+
+	require.NotEmpty((&PeersConfig{}).validate())
+}
+
+func TestValidateAdmin(t *testing.T) {
+	require := require.New(t)
+
+	appConfig := &ApplicationConfig{
+		Port:     3003,
+		Backends: BackendList{{Address: "127.0.0.1:5001"}},
+		Admin:    &AdminConfig{},
+	}
+	require.NotContains(fmt.Sprint(appConfig.validate()), "admin")
+	require.Equal(DefaultAdminAddress, appConfig.Admin.Address)
+}
+
+func TestValidateDevCA(t *testing.T) {
+	require := require.New(t)
+
+	devCA := &DevCAConfig{}
+	require.Empty(devCA.validate(false))
+	require.Equal(DefaultDevCAMaxTTL, devCA.MaxTTL.Duration)
+
+	devCA = &DevCAConfig{CertFile: "dev-ca.pem", MaxTTL: Duration{-time.Hour}}
+	err := errors.Join(devCA.validate(true)...)
+	require.ErrorContains(err, "dev_ca requires client TLS and is not supported in sidecar mode")
+	require.ErrorContains(err, "dev CA certificate and key files must be set together")
+	require.ErrorContains(err, "dev CA max TTL must not be negative")
+}
+
+func TestValidatePoolQueues(t *testing.T) {
+	require := require.New(t)
+
+	appConfig := &ApplicationConfig{
+		Pools: map[string]BackendList{"api": {}},
+		Queue: QueueConfig{
+			Size:    10,
+			Timeout: Duration{time.Second},
+			Pools: map[string]PoolQueueConfig{
+				"api":   {Size: 5},
+				"batch": {Size: -1},
+			},
+		},
+	}
+	err := appConfig.validate()
+	require.ErrorContains(err, "queue of unknown pool 'batch'")
+	require.ErrorContains(err, "queue size and timeout of pool 'batch' must not be negative")
+	require.Equal(Duration{time.Second}, appConfig.Queue.Pools["api"].Timeout)
+}
+
+func TestValidateUnknownClientPolicy(t *testing.T) {
+	require := require.New(t)
+
+	appConfig := &ApplicationConfig{UnknownClientPolicy: UnknownClientAllowAll}
+	require.NotContains(appConfig.validate().Error(), "unknown client policy")
+
+	appConfig.UnknownClientPolicy = "allow"
+	require.ErrorContains(appConfig.validate(), "invalid unknown client policy 'allow'")
+
+	appConfig.UnknownClientPolicy = UnknownClientDefaultPool
+	require.ErrorContains(appConfig.validate(), "unknown client policy 'default_pool' requires the backends list")
+}
+
+func TestValidateTimeouts(t *testing.T) {
+	require := require.New(t)
+
+	timeouts := TimeoutsConfig{AcceptRetry: Duration{time.Second}, Shutdown: Duration{time.Second}}
+	require.Empty(timeouts.validate())
+
+	timeouts = TimeoutsConfig{BackendDial: Duration{-time.Second}}
+	err := errors.Join(timeouts.validate()...)
+	require.ErrorContains(err, "accept retry and shutdown timeouts must be positive")
+	require.ErrorContains(err, "timeouts must not be negative")
+}
+
+func TestValidateLogging(t *testing.T) {
+	require := require.New(t)
+
+	require.Empty(LoggingConfig{}.validate())
+	logging := LoggingConfig{Format: "json", File: "/var/log/lb.log", MaxSizeMB: 100, MaxBackups: 5, MaxAge: Duration{24 * time.Hour}}
+	require.Empty(logging.validate())
+	require.Equal(int64(100<<20), logging.Rotation().MaxSize)
+
+	err := errors.Join(LoggingConfig{Format: "logfmt"}.validate()...)
+	require.ErrorContains(err, "unknown log format 'logfmt'")
+
+	err = errors.Join(LoggingConfig{MaxSizeMB: 100}.validate()...)
+	require.ErrorContains(err, "log rotation requires a log file")
+
+	err = errors.Join(LoggingConfig{File: "/var/log/lb.log", MaxBackups: -1}.validate()...)
+	require.ErrorContains(err, "must not be negative")
+
+	logging = LoggingConfig{Sampling: &LogSamplingConfig{}}
+	require.Empty(logging.validate())
+	require.Equal(&LogSamplingConfig{Interval: Duration{10 * time.Second}, Burst: 5}, logging.Sampling)
+	err = errors.Join(LoggingConfig{Sampling: &LogSamplingConfig{Burst: -1}}.validate()...)
+	require.ErrorContains(err, "log sampling interval and burst must not be negative")
+}
+
+func TestValidateListener(t *testing.T) {
+	require := require.New(t)
+
+	pools := []string{"api"}
+	require.Empty(ListenerConfig{Network: "unix", Address: "/run/lb.sock", Pools: []string{"api"}}.validate(pools))
+
+	err := errors.Join(ListenerConfig{Network: "udp", Address: ":53"}.validate(pools)...)
+	require.ErrorContains(err, "udp listeners are not supported")
+
+	err = errors.Join(ListenerConfig{Network: "tcp", Address: ":4000", Pools: []string{"web"}}.validate(pools)...)
+	require.ErrorContains(err, `unknown pool "web"`)
+
+	require.Empty(ListenerConfig{Network: "unix", Address: "/run/lb.sock", PeerCredentials: true}.validate(pools))
+	err = errors.Join(ListenerConfig{Network: "tcp", Address: ":4000", PeerCredentials: true}.validate(pools)...)
+	require.ErrorContains(err, "peer credentials are only available on unix listeners")
+
+	reuseAddr := false
+	socketOptions := SocketOptionsConfig{Backlog: 4096, ReuseAddr: &reuseAddr, DeferAccept: Duration{time.Second}}
+	require.Empty(ListenerConfig{Network: "tcp", Address: ":4000", SocketOptions: socketOptions}.validate(pools))
+	err = errors.Join(ListenerConfig{Network: "unix", Address: "/run/lb.sock", SocketOptions: socketOptions}.validate(pools)...)
+	require.ErrorContains(err, "only available on tcp listeners")
+	err = errors.Join(ListenerConfig{Network: "tcp", Address: ":4000", SocketOptions: SocketOptionsConfig{Backlog: -1}}.validate(pools)...)
+	require.ErrorContains(err, "must not be negative")
+	err = errors.Join(ListenerConfig{Network: "tcp", Address: ":4000", RateLimitKey: []string{"sni", "host"}}.validate(pools)...)
+	require.ErrorContains(err, `listener ":4000": unknown rate limiter key 'host'`)
+}
+
+func TestValidateSidecar(t *testing.T) {
+	require := require.New(t)
+
+	appConfig := &ApplicationConfig{
+		Port:      3003,
+		Sidecar:   true,
+		Backends:  BackendList{{Address: "127.0.0.1:5001"}},
+		Listeners: []ListenerConfig{{Network: "unix", Address: "/run/lb.sock"}},
+		Health:    HealthConfig{Interval: Duration{time.Second}},
+	}
+	errs := fmt.Sprint(appConfig.validate())
+	require.NotContains(errs, "sidecar")
+	require.NotContains(errs, "TLS configuration is required")
+	require.Equal("127.0.0.1:3003", appConfig.ListenAddress())
+
+	appConfig.TLS = &TLSConfig{}
+	appConfig.ProxyProtocol.Accept = true
+	appConfig.Listeners = append(appConfig.Listeners, ListenerConfig{Network: "tcp", Address: ":4000"})
+	err := appConfig.validate()
+	require.ErrorContains(err, "tls must not be set in sidecar mode")
+	require.ErrorContains(err, "accepting the PROXY protocol is not supported in sidecar mode")
+	require.ErrorContains(err, `listener ":4000" must be a Unix socket or a loopback address in sidecar mode`)
+}
+
+func TestCanonicalizeRuntimeACL(t *testing.T) {
+	require := require.New(t)
+
+	appConfig := &ApplicationConfig{
+		Pools: map[string]BackendList{"api": {{Address: "127.0.0.1:5001"}}},
+	}
+	registered := []*lib.Backend{
+		{Address: "127.0.0.1:5001", Pool: "api"},
+		{Address: "127.0.0.1:5002", Pool: "web"},
+	}
+
+	// Backends and pools registered at runtime are known besides the
+	// configured ones
+	acl := map[string][]string{"client1": {"pool:api", "pool:web", "127.0.0.1:5002"}}
+	require.NoError(appConfig.CanonicalizeRuntimeACL(acl, registered))
+	require.ErrorContains(appConfig.CanonicalizeACL(acl), "unknown pool 'web'")
+	require.ErrorContains(appConfig.CanonicalizeRuntimeACL(map[string][]string{"client1": {"pool:batch"}}, registered), "unknown pool 'batch'")
+}
+
+func FuzzDecodeStrict(f *testing.F) {
+	f.Add([]byte(`{"port": 3003, "backends": ["127.0.0.1:5001"]}`))
+	f.Add([]byte(`{"rate_limiter": {"refill_rate": 5}, "drain": {"timeout": "30s"}}`))
+	f.Add([]byte(`{"rejection_responses": {"no_backend": {"hex": "4500"}}}`))
+	f.Add([]byte("{\n  \"port\": \"3003\"\n}"))
+	f.Add([]byte(`{"port": 3003} {}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var appConfig ApplicationConfig
+		if err := decodeStrict(data, &appConfig); err != nil {
+			return
+		}
+
+		// Decoded payloads and keepalives are validated without panicking
+		for _, response := range appConfig.RejectionResponses {
+			response.Bytes()
+		}
+		for _, keepalive := range appConfig.PoolKeepalives {
+			keepalive.Keepalive()
+		}
+		for _, maintenance := range appConfig.PoolMaintenance {
+			maintenance.Message.Bytes()
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package cpulimit
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// cgroupRoot is the mount point of the cgroup filesystems.
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cgroupV1Mounts are the usual mount points of the cgroup v1 CPU controller.
+var cgroupV1Mounts = []string{"cpu", "cpu,cpuacct", "cpuacct,cpu"}
+
+// cgroupLimit returns the CPU limit of the process's cgroup, which is the
+// lowest quota of the cgroup and its ancestors.
+func cgroupLimit() (float64, bool) {
+	self, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return 0, false
+	}
+	v2, v1 := cgroupPaths(string(self))
+
+	if v2 != "" {
+		if limit, ok := lowestLimit(cgroupRoot, v2, readCPUMax); ok {
+			return limit, true
+		}
+	}
+	if v1 != "" {
+		for _, mount := range cgroupV1Mounts {
+			if limit, ok := lowestLimit(filepath.Join(cgroupRoot, mount), v1, readCFSQuota); ok {
+				return limit, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// lowestLimit reads the limit of the cgroup and of each of its ancestors
+// below the mount point and returns the lowest one. Inside a cgroup
+// namespace the path may not exist, so the mount point itself is read too.
+func lowestLimit(mount, cgroup string, read func(dir string) (float64, bool)) (float64, bool) {
+	lowest, found := 0.0, false
+	for p := path.Clean(cgroup); ; p = path.Dir(p) {
+		if limit, ok := read(filepath.Join(mount, p)); ok && (!found || limit < lowest) {
+			lowest, found = limit, true
+		}
+		if p == "/" || p == "." {
+			break
+		}
+	}
+	return lowest, found
+}
+
+// readCPUMax reads the CPU limit of a cgroup v2 directory.
+func readCPUMax(dir string) (float64, bool) {
+	content, err := os.ReadFile(filepath.Join(dir, "cpu.max"))
+	if err != nil {
+		return 0, false
+	}
+	limit, ok, err := parseCPUMax(string(content))
+	return limit, ok && err == nil
+}
+
+// readCFSQuota reads the CPU limit of a cgroup v1 CPU controller directory.
+func readCFSQuota(dir string) (float64, bool) {
+	quota, err := os.ReadFile(filepath.Join(dir, "cpu.cfs_quota_us"))
+	if err != nil {
+		return 0, false
+	}
+	period, err := os.ReadFile(filepath.Join(dir, "cpu.cfs_period_us"))
+	if err != nil {
+		return 0, false
+	}
+	limit, ok, err := parseQuota(string(quota), string(period))
+	return limit, ok && err == nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package cpulimit
+
+// cgroupLimit returns the CPU limit of the process's cgroup.
+// Detecting it is only supported on Linux.
+func cgroupLimit() (float64, bool) {
+	return 0, false
+}
@@ -0,0 +1,127 @@
+// Package cpulimit detects the CPU limit of the container the process
+// runs in and sizes GOMAXPROCS accordingly, so that a load balancer
+// limited to 2 CPUs on a 64-core host does not schedule work for 64
+// CPUs and get throttled.
+package cpulimit
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Source describes where the GOMAXPROCS value comes from.
+type Source string
+
+// define GOMAXPROCS sources.
+const (
+	// SourceConfig means the value was configured explicitly.
+	SourceConfig Source = "configuration"
+
+	// SourceEnv means the value was set by the GOMAXPROCS environment variable.
+	SourceEnv Source = "GOMAXPROCS environment variable"
+
+	// SourceCgroup means the value was derived from the cgroup CPU quota.
+	SourceCgroup Source = "cgroup CPU quota"
+
+	// SourceHost means the value is the number of CPUs of the host.
+	SourceHost Source = "host CPUs"
+)
+
+// Limit returns the number of CPUs the process may use according to its
+// cgroup CPU quota, e.g. 1.5 for a quota of 150ms every 100ms, or false
+// if there is no quota or it cannot be read. Detecting the quota is only
+// supported on Linux.
+func Limit() (float64, bool) {
+	return cgroupLimit()
+}
+
+// Tune sets GOMAXPROCS and returns the new value and its source. A
+// positive procs value is applied as-is. Otherwise the GOMAXPROCS
+// environment variable is respected if set, and the value is derived
+// from the cgroup CPU quota, rounded down but at least one, if any.
+func Tune(procs int) (int, Source) {
+	if procs > 0 {
+		runtime.GOMAXPROCS(procs)
+		return procs, SourceConfig
+	}
+	if _, ok := os.LookupEnv("GOMAXPROCS"); ok {
+		return runtime.GOMAXPROCS(0), SourceEnv
+	}
+	limit, ok := Limit()
+	if !ok {
+		return runtime.GOMAXPROCS(0), SourceHost
+	}
+	procs = procsForLimit(limit, runtime.NumCPU())
+	runtime.GOMAXPROCS(procs)
+	return procs, SourceCgroup
+}
+
+// procsForLimit returns the number of processors to use for a CPU limit,
+// rounded down to not exceed the quota, but at least one and at most the
+// number of CPUs.
+func procsForLimit(limit float64, numCPU int) int {
+	procs := int(math.Floor(limit))
+	return max(1, min(procs, numCPU))
+}
+
+// cgroupPaths returns the paths of the process's cgroup v2 and v1 CPU
+// controller relative to their mount points, read from /proc/self/cgroup.
+// A path is empty if the process does not belong to such a cgroup.
+func cgroupPaths(selfCgroup string) (v2, v1 string) {
+	for _, line := range strings.Split(selfCgroup, "\n") {
+		// Lines are formatted as hierarchy-ID:controllers:path
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			v2 = parts[2]
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			if controller == "cpu" {
+				v1 = parts[2]
+			}
+		}
+	}
+	return v2, v1
+}
+
+// parseCPUMax parses the content of a cgroup v2 cpu.max file, e.g.
+// "150000 100000", into a number of CPUs. Returns false if unlimited.
+func parseCPUMax(content string) (float64, bool, error) {
+	fields := strings.Fields(content)
+	if len(fields) == 0 || len(fields) > 2 {
+		return 0, false, fmt.Errorf("invalid cpu.max %q", content)
+	}
+	if fields[0] == "max" {
+		return 0, false, nil
+	}
+	period := "100000"
+	if len(fields) == 2 {
+		period = fields[1]
+	}
+	return parseQuota(fields[0], period)
+}
+
+// parseQuota converts a CPU quota and period, in microseconds, into a
+// number of CPUs. Returns false if the quota is unlimited.
+func parseQuota(quota, period string) (float64, bool, error) {
+	q, err := strconv.ParseInt(strings.TrimSpace(quota), 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid CPU quota %q: %w", quota, err)
+	}
+	p, err := strconv.ParseInt(strings.TrimSpace(period), 10, 64)
+	if err != nil || p <= 0 {
+		return 0, false, fmt.Errorf("invalid CPU period %q", period)
+	}
+	if q <= 0 {
+		// cgroup v1 reports -1 for an unlimited quota
+		return 0, false, nil
+	}
+	return float64(q) / float64(p), true, nil
+}
@@ -0,0 +1,53 @@
+package cpulimit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCgroupPaths(t *testing.T) {
+	require := require.New(t)
+
+	v2, v1 := cgroupPaths("0::/kubepods/pod1/container1\n")
+	require.Equal("/kubepods/pod1/container1", v2)
+	require.Empty(v1)
+
+	v2, v1 = cgroupPaths("12:memory:/docker/abc\n4:cpu,cpuacct:/docker/abc\n1:name=systemd:/docker/abc\n")
+	require.Empty(v2)
+	require.Equal("/docker/abc", v1)
+}
+
+func TestParseLimits(t *testing.T) {
+	require := require.New(t)
+
+	limit, ok, err := parseCPUMax("150000 100000\n")
+	require.NoError(err)
+	require.True(ok)
+	require.Equal(1.5, limit)
+
+	_, ok, err = parseCPUMax("max 100000\n")
+	require.NoError(err)
+	require.False(ok)
+
+	_, _, err = parseCPUMax("")
+	require.Error(err)
+
+	limit, ok, err = parseQuota("200000\n", "100000\n")
+	require.NoError(err)
+	require.True(ok)
+	require.Equal(2.0, limit)
+
+	_, ok, err = parseQuota("-1", "100000")
+	require.NoError(err)
+	require.False(ok)
+}
+
+func TestProcsForLimit(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal(2, procsForLimit(2, 64))
+	require.Equal(1, procsForLimit(1.5, 64))
+	require.Equal(1, procsForLimit(0.5, 64))
+	require.Equal(4, procsForLimit(16, 4))
+}
@@ -0,0 +1,206 @@
+// Package devca implements a local certificate authority issuing
+// short-lived client certificates, so that test clients can be connected
+// to a development load balancer without a PKI. It must not be used in
+// production: anyone able to request a certificate gains access.
+package devca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// caValidity is the validity of a generated CA certificate.
+const caValidity = 365 * 24 * time.Hour
+
+// clockSkew backdates the certificates issued, so that they are valid on
+// hosts whose clock is slightly behind.
+const clockSkew = time.Minute
+
+// CA is a certificate authority signing client certificates.
+type CA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+
+	// certPEM is the PEM encoded CA certificate.
+	certPEM []byte
+}
+
+// Issued is a client certificate issued by a CA.
+type Issued struct {
+	// Certificate is the issued certificate.
+	Certificate *x509.Certificate
+
+	// CertificatePEM is the PEM encoded certificate.
+	CertificatePEM []byte
+
+	// KeyPEM is the PEM encoded PKCS #8 private key of the certificate.
+	KeyPEM []byte
+}
+
+// New generates a CA with an ECDSA P-256 key and a self-signed
+// certificate with the given name as its Common Name.
+func New(name string) (*CA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             now.Add(-clockSkew),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &CA{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}, nil
+}
+
+// Load returns the CA of the PEM encoded certificate and private key,
+// which may be a PKCS #8, PKCS #1 or SEC 1 key.
+func Load(certPEM, keyPEM []byte) (*CA, error) {
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil || certBlock.Type != "CERTIFICATE" {
+		return nil, errors.New("unable to parse dev CA certificate PEM")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse dev CA certificate: %w", err)
+	}
+	if !cert.IsCA {
+		return nil, errors.New("dev CA certificate is not a CA")
+	}
+
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return nil, errors.New("unable to parse dev CA key PEM")
+	}
+	key, err := parsePrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if !publicKeysEqual(cert.PublicKey, key.Public()) {
+		return nil, errors.New("dev CA key does not match its certificate")
+	}
+	return &CA{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBlock.Bytes}),
+	}, nil
+}
+
+// parsePrivateKey parses a PKCS #8, PKCS #1 or SEC 1 private key.
+func parsePrivateKey(der []byte) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("unsupported dev CA key type")
+		}
+		return signer, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("unable to parse dev CA key")
+}
+
+// publicKeysEqual reports whether the public keys are equal.
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(b)
+}
+
+// CertificatePEM returns the PEM encoded CA certificate, to be trusted by
+// the load balancer and shared with the clients.
+func (ca *CA) CertificatePEM() []byte {
+	return ca.certPEM
+}
+
+// Issue signs a client certificate with the Common Name, valid for ttl
+// from now, along with a new ECDSA P-256 key. The certificate is not
+// valid past the expiry of the CA.
+func (ca *CA) Issue(commonName string, ttl time.Duration) (*Issued, error) {
+	if commonName == "" {
+		return nil, errors.New("common name is required")
+	}
+	if ttl <= 0 {
+		return nil, errors.New("certificate lifetime must be positive")
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    now.Add(-clockSkew),
+		NotAfter:     minTime(now.Add(ttl), ca.cert.NotAfter),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Issued{
+		Certificate:    cert,
+		CertificatePEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		KeyPEM:         pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}),
+	}, nil
+}
+
+// newSerialNumber returns a random 128-bit certificate serial number.
+func newSerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// minTime returns the earlier of the times.
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,92 @@
+package devca
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIssue(t *testing.T) {
+	require := require.New(t)
+
+	ca, err := New("test CA")
+	require.NoError(err)
+
+	issued, err := ca.Issue("client1.example.com", time.Hour)
+	require.NoError(err)
+	require.Equal("client1.example.com", issued.Certificate.Subject.CommonName)
+	require.WithinDuration(time.Now().Add(time.Hour), issued.Certificate.NotAfter, time.Minute)
+
+	// The certificate verifies against the CA as a client certificate
+	roots := x509.NewCertPool()
+	require.True(roots.AppendCertsFromPEM(ca.CertificatePEM()))
+	_, err = issued.Certificate.Verify(x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	require.NoError(err)
+
+	// The key matches the certificate
+	_, err = tls.X509KeyPair(issued.CertificatePEM, issued.KeyPEM)
+	require.NoError(err)
+
+	// Serial numbers are unique
+	other, err := ca.Issue("client1.example.com", time.Hour)
+	require.NoError(err)
+	require.NotEqual(issued.Certificate.SerialNumber, other.Certificate.SerialNumber)
+
+	_, err = ca.Issue("", time.Hour)
+	require.Error(err)
+	_, err = ca.Issue("client1.example.com", 0)
+	require.Error(err)
+}
+
+func TestIssueBoundedByCA(t *testing.T) {
+	require := require.New(t)
+
+	ca, err := New("test CA")
+	require.NoError(err)
+
+	issued, err := ca.Issue("client1.example.com", 10*caValidity)
+	require.NoError(err)
+	require.Equal(ca.cert.NotAfter, issued.Certificate.NotAfter)
+}
+
+func TestLoad(t *testing.T) {
+	require := require.New(t)
+
+	ca, err := New("test CA")
+	require.NoError(err)
+	keyDER, err := x509.MarshalECPrivateKey(ca.key.(*ecdsa.PrivateKey))
+	require.NoError(err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	loaded, err := Load(ca.CertificatePEM(), keyPEM)
+	require.NoError(err)
+	require.Equal(ca.CertificatePEM(), loaded.CertificatePEM())
+	issued, err := loaded.Issue("client1.example.com", time.Hour)
+	require.NoError(err)
+	require.NoError(issued.Certificate.CheckSignatureFrom(ca.cert))
+
+	// A key of another CA is rejected
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(err)
+	otherDER, err := x509.MarshalPKCS8PrivateKey(otherKey)
+	require.NoError(err)
+	_, err = Load(ca.CertificatePEM(), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: otherDER}))
+	require.ErrorContains(err, "does not match")
+
+	// A client certificate is not a CA
+	_, err = Load(issued.CertificatePEM, keyPEM)
+	require.ErrorContains(err, "not a CA")
+
+	_, err = Load([]byte("not a certificate"), keyPEM)
+	require.Error(err)
+}
@@ -0,0 +1,91 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Backend is a backend reported by a discovery provider.
+type Backend struct {
+	// Address is a host:port address of the backend.
+	Address string `json:"address"`
+
+	// Group is the deployment group of the backend within its pool. Optional.
+	Group string `json:"group,omitempty"`
+}
+
+// Provider discovers the backends of pools. Integrations with service
+// registries (DNS, Consul, Kubernetes, files, Docker, ...) implement it.
+type Provider interface {
+	// Subscribe returns a channel receiving the complete backend set of
+	// the pool, first on subscription and then whenever it changes.
+	// The channel is closed once ctx is done.
+	Subscribe(ctx context.Context, pool string) (<-chan []Backend, error)
+}
+
+// Factory creates a provider from its JSON configuration options.
+type Factory func(options json.RawMessage) (Provider, error)
+
+var (
+	// factoriesMu ensures concurrent access to the factories map.
+	factoriesMu sync.RWMutex
+
+	// factories maps a provider name to its factory.
+	factories = make(map[string]Factory)
+)
+
+// Register makes a provider available by name, so that it can be
+// selected in the configuration. It panics if the name is already taken.
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if _, exists := factories[name]; exists {
+		panic(fmt.Sprintf("discovery provider %s registered twice", name))
+	}
+	factories[name] = factory
+}
+
+// NewProvider creates the provider registered under the given name.
+func NewProvider(name string, options json.RawMessage) (Provider, error) {
+	factoriesMu.RLock()
+	factory, exists := factories[name]
+	factoriesMu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("unknown discovery provider '%s', available: %v", name, Providers())
+	}
+	return factory(options)
+}
+
+// Providers returns the names of the registered providers.
+func Providers() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Watch subscribes to the pool and calls update with every backend set
+// reported by the provider until ctx is done.
+func Watch(ctx context.Context, provider Provider, pool string, update func([]Backend)) error {
+	updates, err := provider.Subscribe(ctx, pool)
+	if err != nil {
+		return fmt.Errorf("unable to subscribe to pool %s: %w", pool, err)
+	}
+
+	go func() {
+		for backends := range updates {
+			update(backends)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,57 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewProvider(t *testing.T) {
+	require := require.New(t)
+
+	provider, err := NewProvider("static", json.RawMessage(`{"web": [{"address": "10.0.0.1:80"}]}`))
+	require.NoError(err)
+
+	updates, err := provider.Subscribe(context.Background(), "web")
+	require.NoError(err)
+	require.Equal([]Backend{{Address: "10.0.0.1:80"}}, <-updates)
+
+	_, err = NewProvider("unknown", nil)
+	require.Error(err)
+
+	_, err = NewProvider("file", json.RawMessage(`{}`))
+	require.Error(err, "Expected an error for a missing path")
+}
+
+func TestFileProvider(t *testing.T) {
+	require := require.New(t)
+
+	path := filepath.Join(t.TempDir(), "backends.json")
+	write := func(content string) {
+		require.NoError(os.WriteFile(path, []byte(content), 0o644))
+	}
+	write(`{"web": [{"address": "10.0.0.1:80", "group": "blue"}]}`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	provider := NewFileProvider(path, 10*time.Millisecond)
+	updates, err := provider.Subscribe(ctx, "web")
+	require.NoError(err)
+	require.Equal([]Backend{{Address: "10.0.0.1:80", Group: "blue"}}, <-updates)
+
+	write(`{"web": [{"address": "10.0.0.1:80"}, {"address": "10.0.0.2:80"}]}`)
+	select {
+	case backends := <-updates:
+		require.Equal([]Backend{{Address: "10.0.0.1:80"}, {Address: "10.0.0.2:80"}}, backends)
+	case <-time.After(time.Second):
+		require.Fail("Expected an update after the file changed")
+	}
+
+	cancel()
+	for range updates {
+	}
+}
@@ -0,0 +1,129 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/logging"
+)
+
+// defaultFileInterval is the default time between two reads of the file.
+const defaultFileInterval = 5 * time.Second
+
+func init() {
+	Register("file", newFileProvider)
+}
+
+// fileOptions are the JSON options of the file provider.
+type fileOptions struct {
+	// Path is the path to a JSON file mapping pool names to backends.
+	Path string `json:"path"`
+
+	// Interval is the time between two reads of the file, e.g. "5s".
+	Interval string `json:"interval"`
+}
+
+// FileProvider discovers backends from a JSON file mapping pool names to
+// lists of backends, re-reading it periodically.
+type FileProvider struct {
+	// path is the path to the JSON file.
+	path string
+
+	// interval is the time between two reads of the file.
+	interval time.Duration
+}
+
+// NewFileProvider initializes and returns a new FileProvider.
+func NewFileProvider(path string, interval time.Duration) *FileProvider {
+	return &FileProvider{
+		path:     path,
+		interval: interval,
+	}
+}
+
+// newFileProvider creates a FileProvider from its JSON options.
+func newFileProvider(options json.RawMessage) (Provider, error) {
+	var opts fileOptions
+	dec := json.NewDecoder(bytes.NewReader(options))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&opts); err != nil {
+		return nil, fmt.Errorf("invalid file provider options: %w", err)
+	}
+	if opts.Path == "" {
+		return nil, errors.New("file provider path is required")
+	}
+
+	interval := defaultFileInterval
+	if opts.Interval != "" {
+		var err error
+		interval, err = time.ParseDuration(opts.Interval)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid file provider interval '%s'", opts.Interval)
+		}
+	}
+	return NewFileProvider(opts.Path, interval), nil
+}
+
+// read reads the backends of the pool from the file.
+func (p *FileProvider) read(pool string) ([]Backend, error) {
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var pools map[string][]Backend
+	if err := json.Unmarshal(data, &pools); err != nil {
+		return nil, fmt.Errorf("invalid discovery file '%s': %w", p.path, err)
+	}
+	return pools[pool], nil
+}
+
+// Subscribe implements Provider. Read errors are logged and the last
+// known backend set is kept.
+func (p *FileProvider) Subscribe(ctx context.Context, pool string) (<-chan []Backend, error) {
+	backends, err := p.read(pool)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make(chan []Backend, 1)
+	updates <- backends
+
+	go func() {
+		defer close(updates)
+
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			current, err := p.read(pool)
+			if err != nil {
+				logging.Warnf("Unable to read discovery file for pool %s: %v", pool, err)
+				continue
+			}
+			if slices.Equal(current, backends) {
+				continue
+			}
+			backends = current
+
+			select {
+			case updates <- backends:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return updates, nil
+}
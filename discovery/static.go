@@ -0,0 +1,45 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+func init() {
+	Register("static", newStaticProvider)
+}
+
+// StaticProvider reports a fixed set of backends per pool.
+// It is mostly useful for testing and as an example implementation.
+type StaticProvider struct {
+	// pools maps a pool name to its backends.
+	pools map[string][]Backend
+}
+
+// NewStaticProvider initializes and returns a new StaticProvider.
+func NewStaticProvider(pools map[string][]Backend) *StaticProvider {
+	return &StaticProvider{pools: pools}
+}
+
+// newStaticProvider creates a StaticProvider from JSON options
+// mapping pool names to lists of backends.
+func newStaticProvider(options json.RawMessage) (Provider, error) {
+	var pools map[string][]Backend
+	if err := json.Unmarshal(options, &pools); err != nil {
+		return nil, fmt.Errorf("invalid static provider options: %w", err)
+	}
+	return NewStaticProvider(pools), nil
+}
+
+// Subscribe implements Provider.
+func (p *StaticProvider) Subscribe(ctx context.Context, pool string) (<-chan []Backend, error) {
+	updates := make(chan []Backend, 1)
+	updates <- p.pools[pool]
+
+	go func() {
+		<-ctx.Done()
+		close(updates)
+	}()
+	return updates, nil
+}
@@ -0,0 +1,131 @@
+// Package featureflag gates experimental behaviors, so that they can be
+// rolled out incrementally to some pools or a percentage of connections
+// and turned off at runtime without a restart.
+package featureflag
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Flag defines the rollout of an experimental behavior.
+type Flag struct {
+	// Name identifies the behavior.
+	Name string `json:"name"`
+
+	// Enabled turns the behavior on for the matching connections.
+	Enabled bool `json:"enabled"`
+
+	// Pools limits the behavior to the connections routed to these
+	// pools. Connections of every pool match if empty.
+	Pools []string `json:"pools,omitempty"`
+
+	// Percentage is the share of matching connections, between 0 and
+	// 100, the behavior is turned on for.
+	Percentage float64 `json:"percentage"`
+}
+
+// validate verifies the flag settings.
+func (f Flag) validate() error {
+	if f.Name == "" {
+		return errors.New("feature flag name is required")
+	}
+	if f.Percentage < 0 || f.Percentage > 100 {
+		return fmt.Errorf("percentage of feature flag '%s' must be between 0 and 100", f.Name)
+	}
+	return nil
+}
+
+// Set holds the feature flags, which can be changed at runtime.
+type Set struct {
+	// mu serializes changes of the flags.
+	mu sync.Mutex
+
+	// flags maps a flag name to the flag.
+	flags atomic.Pointer[map[string]Flag]
+}
+
+// NewSet creates a Set holding the provided flags.
+func NewSet(flags ...Flag) (*Set, error) {
+	m := make(map[string]Flag, len(flags))
+	var errs []error
+	for _, flag := range flags {
+		if err := flag.validate(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		m[flag.Name] = flag
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	s := &Set{}
+	s.flags.Store(&m)
+	return s, nil
+}
+
+// Enabled reports whether the named behavior is turned on for a
+// connection routed to the pool. The key, e.g. the connection ID,
+// places the connection in the percentage deterministically. A nil
+// Set or an unknown flag turns the behavior off.
+func (s *Set) Enabled(name, pool, key string) bool {
+	if s == nil {
+		return false
+	}
+	flag, ok := (*s.flags.Load())[name]
+	if !ok || !flag.Enabled {
+		return false
+	}
+	if len(flag.Pools) > 0 && !slices.Contains(flag.Pools, pool) {
+		return false
+	}
+	return bucket(name, key) < flag.Percentage*100
+}
+
+// bucket maps a flag name and a key to a bucket between 0 and 9999, so
+// that each flag selects an independent share of the keys.
+func bucket(name, key string) float64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return float64(h.Sum64() % 10000)
+}
+
+// Flags returns the flags sorted by name.
+func (s *Set) Flags() []Flag {
+	m := *s.flags.Load()
+	flags := make([]Flag, 0, len(m))
+	for _, flag := range m {
+		flags = append(flags, flag)
+	}
+	sort.Slice(flags, func(i, j int) bool {
+		return flags[i].Name < flags[j].Name
+	})
+	return flags
+}
+
+// Set adds the flag, or replaces the flag of the same name.
+func (s *Set) Set(flag Flag) error {
+	if err := flag.validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := *s.flags.Load()
+	m := make(map[string]Flag, len(current)+1)
+	for name, f := range current {
+		m[name] = f
+	}
+	m[flag.Name] = flag
+	s.flags.Store(&m)
+	return nil
+}
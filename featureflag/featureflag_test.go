@@ -0,0 +1,62 @@
+package featureflag
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnabled(t *testing.T) {
+	require := require.New(t)
+
+	s, err := NewSet(
+		Flag{Name: "all", Enabled: true, Percentage: 100},
+		Flag{Name: "off", Enabled: false, Percentage: 100},
+		Flag{Name: "canary", Enabled: true, Pools: []string{"canary"}, Percentage: 100},
+		Flag{Name: "half", Enabled: true, Percentage: 50},
+	)
+	require.NoError(err)
+
+	require.True(s.Enabled("all", "primary", "conn1"))
+	require.False(s.Enabled("off", "primary", "conn1"))
+	require.False(s.Enabled("unknown", "primary", "conn1"))
+	require.True(s.Enabled("canary", "canary", "conn1"))
+	require.False(s.Enabled("canary", "primary", "conn1"))
+
+	enabled := 0
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("conn%d", i)
+		if s.Enabled("half", "primary", key) {
+			enabled++
+		}
+		// The same key is always placed in the same bucket
+		require.Equal(s.Enabled("half", "primary", key), s.Enabled("half", "primary", key))
+	}
+	require.InDelta(5000, enabled, 300)
+
+	var nilSet *Set
+	require.False(nilSet.Enabled("all", "primary", "conn1"))
+}
+
+func TestSet(t *testing.T) {
+	require := require.New(t)
+
+	_, err := NewSet(Flag{Name: "bad", Percentage: 150}, Flag{Percentage: 10})
+	require.ErrorContains(err, "must be between 0 and 100")
+	require.ErrorContains(err, "name is required")
+
+	s, err := NewSet()
+	require.NoError(err)
+	require.Empty(s.Flags())
+
+	require.NoError(s.Set(Flag{Name: "b", Enabled: true, Percentage: 100}))
+	require.NoError(s.Set(Flag{Name: "a", Percentage: 10}))
+	require.True(s.Enabled("b", "primary", "conn1"))
+
+	require.NoError(s.Set(Flag{Name: "b", Enabled: false, Percentage: 100}))
+	require.False(s.Enabled("b", "primary", "conn1"))
+	require.Equal([]Flag{{Name: "a", Percentage: 10}, {Name: "b", Percentage: 100}}, s.Flags())
+
+	require.Error(s.Set(Flag{Name: "c", Percentage: -1}))
+}
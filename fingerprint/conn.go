@@ -0,0 +1,78 @@
+package fingerprint
+
+import (
+	"net"
+	"sync"
+)
+
+// maxRecorded bounds the bytes recorded from a client, which is enough
+// for any ClientHello sent by a legitimate client.
+const maxRecorded = 16 * 1024
+
+// Conn records the first bytes read from a client connection so that
+// the ClientHello can be fingerprinted once the TLS server read it.
+type Conn struct {
+	net.Conn
+
+	// mu ensures concurrent access to the recorded bytes.
+	mu sync.Mutex
+
+	// recorded holds the bytes read so far, up to maxRecorded.
+	recorded []byte
+
+	// hello is the parsed ClientHello, set once it was recorded entirely.
+	hello *ClientHello
+
+	// err is the parsing error, if the recorded bytes are not a ClientHello.
+	err error
+}
+
+// NewConn wraps a client connection to record its ClientHello.
+func NewConn(conn net.Conn) *Conn {
+	return &Conn{Conn: conn}
+}
+
+// Read implements net.Conn, recording the bytes read
+// until the ClientHello is complete.
+func (c *Conn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.mu.Lock()
+		if c.hello == nil && c.err == nil {
+			c.record(b[:n])
+		}
+		c.mu.Unlock()
+	}
+	return n, err
+}
+
+// record appends the bytes and parses the ClientHello once it is complete.
+// The caller must hold mu.
+func (c *Conn) record(b []byte) {
+	c.recorded = append(c.recorded, b[:min(len(b), maxRecorded-len(c.recorded))]...)
+
+	hello, err := ParseClientHello(c.recorded)
+	switch {
+	case err == nil:
+		c.hello = hello
+		c.recorded = nil
+	case err != ErrIncomplete:
+		c.err = err
+		c.recorded = nil
+	case len(c.recorded) >= maxRecorded:
+		c.err = ErrIncomplete
+		c.recorded = nil
+	}
+}
+
+// ClientHello returns the client's ClientHello. Returns ErrIncomplete
+// if it has not been read entirely.
+func (c *Conn) ClientHello() (*ClientHello, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.hello == nil && c.err == nil {
+		return nil, ErrIncomplete
+	}
+	return c.hello, c.err
+}
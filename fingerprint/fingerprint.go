@@ -0,0 +1,369 @@
+package fingerprint
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// define TLS record and handshake constants.
+const (
+	// recordTypeHandshake is the content type of handshake records.
+	recordTypeHandshake byte = 22
+
+	// recordHeaderLen is the length of a TLS record header.
+	recordHeaderLen = 5
+
+	// handshakeTypeClientHello is the handshake message type of a ClientHello.
+	handshakeTypeClientHello byte = 1
+
+	// handshakeHeaderLen is the length of a handshake message header.
+	handshakeHeaderLen = 4
+)
+
+// define the extension types the fingerprints depend on.
+const (
+	extensionServerName          uint16 = 0x0000
+	extensionSupportedGroups     uint16 = 0x000a
+	extensionPointFormats        uint16 = 0x000b
+	extensionSignatureAlgorithms uint16 = 0x000d
+	extensionALPN                uint16 = 0x0010
+	extensionSupportedVersions   uint16 = 0x002b
+)
+
+// ErrIncomplete is returned when the data does not hold a whole ClientHello yet.
+var ErrIncomplete = errors.New("incomplete ClientHello")
+
+// ClientHello holds the ClientHello fields TLS fingerprints are computed from.
+type ClientHello struct {
+	// Version is the legacy protocol version of the message.
+	Version uint16
+
+	// CipherSuites are the offered cipher suites in order.
+	CipherSuites []uint16
+
+	// Extensions are the extension types in order.
+	Extensions []uint16
+
+	// SupportedGroups are the offered elliptic curves and groups in order.
+	SupportedGroups []uint16
+
+	// PointFormats are the offered elliptic curve point formats in order.
+	PointFormats []uint8
+
+	// SignatureAlgorithms are the offered signature algorithms in order.
+	SignatureAlgorithms []uint16
+
+	// SupportedVersions are the offered protocol versions in order.
+	SupportedVersions []uint16
+
+	// ALPN are the offered application protocols in order.
+	ALPN []string
+
+	// ServerName is the requested server name, if any.
+	ServerName string
+}
+
+// ParseClientHello parses the ClientHello from the first TLS records sent
+// by a client. The message may span several handshake records.
+// Returns ErrIncomplete if more data is needed.
+func ParseClientHello(data []byte) (*ClientHello, error) {
+	// Reassemble the handshake message from its records
+	var message []byte
+	for {
+		if len(data) < recordHeaderLen {
+			return nil, ErrIncomplete
+		}
+		if data[0] != recordTypeHandshake {
+			return nil, fmt.Errorf("unexpected TLS record type %d", data[0])
+		}
+		length := int(binary.BigEndian.Uint16(data[3:5]))
+		if len(data) < recordHeaderLen+length {
+			return nil, ErrIncomplete
+		}
+		message = append(message, data[recordHeaderLen:recordHeaderLen+length]...)
+		data = data[recordHeaderLen+length:]
+
+		if len(message) >= handshakeHeaderLen {
+			length := int(message[1])<<16 | int(message[2])<<8 | int(message[3])
+			if len(message) >= handshakeHeaderLen+length {
+				message = message[:handshakeHeaderLen+length]
+				break
+			}
+		}
+	}
+	if message[0] != handshakeTypeClientHello {
+		return nil, fmt.Errorf("unexpected handshake message type %d", message[0])
+	}
+
+	hello, err := parseClientHelloBody(&reader{b: message[handshakeHeaderLen:]})
+	if err != nil {
+		return nil, fmt.Errorf("malformed ClientHello: %w", err)
+	}
+	return hello, nil
+}
+
+// parseClientHelloBody parses the body of a ClientHello handshake message.
+func parseClientHelloBody(r *reader) (*ClientHello, error) {
+	hello := &ClientHello{Version: r.uint16()}
+	r.skip(32) // random
+	r.bytes8() // session ID
+	suites := r.bytes16()
+	r.bytes8() // compression methods
+	for s := (&reader{b: suites}); !s.empty(); {
+		hello.CipherSuites = append(hello.CipherSuites, s.uint16())
+	}
+
+	extensions := &reader{b: r.bytes16()}
+	for !extensions.empty() {
+		typ := extensions.uint16()
+		ext := &reader{b: extensions.bytes16()}
+		hello.Extensions = append(hello.Extensions, typ)
+
+		switch typ {
+		case extensionServerName:
+			names := &reader{b: ext.bytes16()}
+			for !names.empty() {
+				nameType := names.uint8()
+				name := names.bytes16()
+				if nameType == 0 {
+					hello.ServerName = string(name)
+				}
+			}
+		case extensionSupportedGroups:
+			for groups := (&reader{b: ext.bytes16()}); !groups.empty(); {
+				hello.SupportedGroups = append(hello.SupportedGroups, groups.uint16())
+			}
+		case extensionPointFormats:
+			hello.PointFormats = append(hello.PointFormats, ext.bytes8()...)
+		case extensionSignatureAlgorithms:
+			for algs := (&reader{b: ext.bytes16()}); !algs.empty(); {
+				hello.SignatureAlgorithms = append(hello.SignatureAlgorithms, algs.uint16())
+			}
+		case extensionALPN:
+			for protos := (&reader{b: ext.bytes16()}); !protos.empty(); {
+				hello.ALPN = append(hello.ALPN, string(protos.bytes8()))
+			}
+		case extensionSupportedVersions:
+			for versions := (&reader{b: ext.bytes8()}); !versions.empty(); {
+				hello.SupportedVersions = append(hello.SupportedVersions, versions.uint16())
+			}
+		}
+		if ext.err != nil {
+			return nil, ext.err
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if extensions.err != nil {
+		return nil, extensions.err
+	}
+	return hello, nil
+}
+
+// isGREASE reports whether the value is a GREASE value (RFC 8701),
+// which clients pick at random and are ignored by fingerprints.
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+// withoutGREASE returns the values that are not GREASE values.
+func withoutGREASE(values []uint16) []uint16 {
+	filtered := make([]uint16, 0, len(values))
+	for _, v := range values {
+		if !isGREASE(v) {
+			filtered = append(filtered, v)
+		}
+	}
+	return filtered
+}
+
+// JA3String returns the JA3 fingerprint string of the ClientHello:
+// version, cipher suites, extensions, groups and point formats in
+// decimal, with GREASE values removed.
+func (h *ClientHello) JA3String() string {
+	joinDecimal := func(values []uint16) string {
+		parts := make([]string, len(values))
+		for i, v := range values {
+			parts[i] = strconv.Itoa(int(v))
+		}
+		return strings.Join(parts, "-")
+	}
+
+	pointFormats := make([]uint16, len(h.PointFormats))
+	for i, f := range h.PointFormats {
+		pointFormats[i] = uint16(f)
+	}
+
+	return strings.Join([]string{
+		strconv.Itoa(int(h.Version)),
+		joinDecimal(withoutGREASE(h.CipherSuites)),
+		joinDecimal(withoutGREASE(h.Extensions)),
+		joinDecimal(withoutGREASE(h.SupportedGroups)),
+		joinDecimal(pointFormats),
+	}, ",")
+}
+
+// JA3 returns the JA3 fingerprint of the ClientHello,
+// the MD5 hash of its JA3 string.
+func (h *ClientHello) JA3() string {
+	sum := md5.Sum([]byte(h.JA3String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// JA4 returns the JA4 fingerprint of the ClientHello, e.g.
+// "t13d1516h2_8daaf6152771_e5627efa2ab1", for a connection over TCP.
+func (h *ClientHello) JA4() string {
+	ciphers := withoutGREASE(h.CipherSuites)
+	extensions := withoutGREASE(h.Extensions)
+
+	// The version is the highest supported one
+	version := h.Version
+	for _, v := range withoutGREASE(h.SupportedVersions) {
+		version = max(version, v)
+	}
+
+	sni := "i"
+	if h.ServerName != "" {
+		sni = "d"
+	}
+
+	alpn := "00"
+	if len(h.ALPN) > 0 && h.ALPN[0] != "" {
+		alpn = alpnChars(h.ALPN[0])
+	}
+
+	prefix := fmt.Sprintf("t%s%s%02d%02d%s",
+		ja4Version(version), sni, min(len(ciphers), 99), min(len(extensions), 99), alpn)
+
+	// The server name and ALPN extensions are left out of the extensions hash
+	var hashedExtensions []uint16
+	for _, ext := range extensions {
+		if ext != extensionServerName && ext != extensionALPN {
+			hashedExtensions = append(hashedExtensions, ext)
+		}
+	}
+	extensionsPart := joinHex(sorted(hashedExtensions))
+	if len(h.SignatureAlgorithms) > 0 {
+		extensionsPart += "_" + joinHex(h.SignatureAlgorithms)
+	}
+
+	return prefix + "_" + truncatedHash(joinHex(sorted(ciphers)), len(ciphers)) +
+		"_" + truncatedHash(extensionsPart, len(hashedExtensions))
+}
+
+// ja4Version returns the JA4 code of a protocol version.
+func ja4Version(version uint16) string {
+	switch version {
+	case 0x0304:
+		return "13"
+	case 0x0303:
+		return "12"
+	case 0x0302:
+		return "11"
+	case 0x0301:
+		return "10"
+	case 0x0300:
+		return "s3"
+	}
+	return "00"
+}
+
+// alpnChars returns the first and last characters of an ALPN value, or
+// the first and last hex digits of its bytes if they are not alphanumeric.
+func alpnChars(alpn string) string {
+	isAlnum := func(c byte) bool {
+		return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+	}
+	first, last := alpn[0], alpn[len(alpn)-1]
+	if isAlnum(first) && isAlnum(last) {
+		return string([]byte{first, last})
+	}
+	encoded := hex.EncodeToString([]byte{first, last})
+	return string([]byte{encoded[0], encoded[3]})
+}
+
+// sorted returns a sorted copy of the values.
+func sorted(values []uint16) []uint16 {
+	s := append([]uint16(nil), values...)
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	return s
+}
+
+// joinHex joins the values as comma-separated 4-digit hex numbers.
+func joinHex(values []uint16) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprintf("%04x", v)
+	}
+	return strings.Join(parts, ",")
+}
+
+// truncatedHash returns the first 12 hex digits of the SHA-256 hash
+// of s, or zeros if there are no values.
+func truncatedHash(s string, count int) string {
+	if count == 0 {
+		return "000000000000"
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// reader reads big-endian fields from a byte slice. The first read past
+// the end sets err, after which reads return zero values.
+type reader struct {
+	b   []byte
+	err error
+}
+
+// next returns the next n bytes.
+func (r *reader) next(n int) []byte {
+	if r.err != nil || len(r.b) < n {
+		r.err = errors.New("unexpected end of data")
+		r.b = nil
+		return nil
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b
+}
+
+// empty reports whether all bytes were read or a read failed.
+func (r *reader) empty() bool {
+	return len(r.b) == 0
+}
+
+func (r *reader) skip(n int) {
+	r.next(n)
+}
+
+func (r *reader) uint8() uint8 {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) uint16() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+// bytes8 returns a byte string prefixed with a 1-byte length.
+func (r *reader) bytes8() []byte {
+	return r.next(int(r.uint8()))
+}
+
+// bytes16 returns a byte string prefixed with a 2-byte length.
+func (r *reader) bytes16() []byte {
+	return r.next(int(r.uint16()))
+}
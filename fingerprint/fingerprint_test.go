@@ -0,0 +1,113 @@
+package fingerprint
+
+import (
+	"crypto/tls"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// captureClientHello returns the ClientHello of a TLS client as read by
+// the server side of a connection wrapped in a Conn.
+func captureClientHello(t *testing.T, config *tls.Config) (*ClientHello, error) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	go tls.Client(client, config).Handshake()
+
+	conn := NewConn(server)
+	defer conn.Close()
+
+	// The handshake fails without a certificate, after the ClientHello was read
+	tls.Server(conn, &tls.Config{}).Handshake()
+	return conn.ClientHello()
+}
+
+func TestClientHello(t *testing.T) {
+	require := require.New(t)
+
+	hello, err := captureClientHello(t, &tls.Config{
+		ServerName: "lb.example.com",
+		NextProtos: []string{"h2", "http/1.1"},
+		MinVersion: tls.VersionTLS13,
+	})
+	require.NoError(err)
+	require.Equal("lb.example.com", hello.ServerName)
+	require.Equal([]string{"h2", "http/1.1"}, hello.ALPN)
+	require.Contains(hello.SupportedVersions, uint16(tls.VersionTLS13))
+
+	ja4 := hello.JA4()
+	require.True(strings.HasPrefix(ja4, "t13d"), ja4)
+	require.True(strings.HasSuffix(strings.Split(ja4, "_")[0], "h2"), ja4)
+	require.Len(hello.JA3(), 32)
+
+	// Fingerprints do not depend on the server name
+	other, err := captureClientHello(t, &tls.Config{
+		ServerName: "other.example.com",
+		NextProtos: []string{"h2", "http/1.1"},
+		MinVersion: tls.VersionTLS13,
+	})
+	require.NoError(err)
+	require.Equal(hello.JA3(), other.JA3())
+	require.Equal(ja4, other.JA4())
+}
+
+func TestJA4(t *testing.T) {
+	require := require.New(t)
+
+	hello := &ClientHello{
+		Version:             tls.VersionTLS12,
+		CipherSuites:        []uint16{0x1a1a, 0x1302, 0x1301},
+		Extensions:          []uint16{0x2a2a, extensionServerName, extensionSupportedVersions, extensionALPN},
+		SupportedVersions:   []uint16{0x3a3a, tls.VersionTLS13, tls.VersionTLS12},
+		SignatureAlgorithms: []uint16{0x0403},
+		ALPN:                []string{"\x00x\xff"},
+	}
+	require.Equal("t13i02030f", strings.Split(hello.JA4(), "_")[0])
+	require.Equal("771,4866-4865,0-43-16,,", hello.JA3String())
+
+	require.Equal("t00i000000_000000000000_000000000000", (&ClientHello{}).JA4())
+}
+
+func TestParseClientHello(t *testing.T) {
+	require := require.New(t)
+
+	_, err := ParseClientHello([]byte{22, 3, 1, 0})
+	require.ErrorIs(err, ErrIncomplete)
+
+	_, err = ParseClientHello([]byte("GET / HTTP/1.1\r\n"))
+	require.Error(err)
+	require.NotErrorIs(err, ErrIncomplete)
+}
+
+func FuzzParseClientHello(f *testing.F) {
+	f.Add([]byte{22, 3, 1, 0})
+	f.Add([]byte("GET / HTTP/1.1\r\n"))
+	if hello, err := captureClientHelloRecord(); err == nil {
+		f.Add(hello)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		hello, err := ParseClientHello(data)
+		if err != nil {
+			return
+		}
+		hello.JA3()
+		hello.JA4()
+	})
+}
+
+// captureClientHelloRecord returns the raw ClientHello record of a TLS client.
+func captureClientHelloRecord() ([]byte, error) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go tls.Client(client, &tls.Config{ServerName: "lb.example.com", NextProtos: []string{"h2"}}).Handshake()
+
+	buf := make([]byte, 16*1024)
+	n, err := server.Read(buf)
+	return buf[:n], err
+}
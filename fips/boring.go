@@ -0,0 +1,15 @@
+//go:build boringcrypto
+
+package fips
+
+import (
+	"crypto/boring"
+
+	// Restrict crypto/tls to FIPS-approved settings
+	_ "crypto/tls/fipsonly"
+)
+
+// Enabled reports whether the binary uses BoringCrypto.
+func Enabled() bool {
+	return boring.Enabled()
+}
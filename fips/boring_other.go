@@ -0,0 +1,9 @@
+//go:build !boringcrypto
+
+package fips
+
+// Enabled reports whether the binary uses BoringCrypto, which requires
+// building with GOEXPERIMENT=boringcrypto.
+func Enabled() bool {
+	return false
+}
@@ -0,0 +1,135 @@
+// Package fips enforces FIPS 140 approved TLS parameters, for deployments
+// mandating validated cryptography on the terminating proxy. The approved
+// cryptography itself is only used by binaries built with
+// GOEXPERIMENT=boringcrypto, which link the BoringCrypto module and
+// restrict crypto/tls to FIPS-approved settings.
+package fips
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrNotAvailable is returned when FIPS mode is required from a binary
+// not built with BoringCrypto.
+var ErrNotAvailable = errors.New("FIPS mode requires a binary built with GOEXPERIMENT=boringcrypto")
+
+// minRSABits is the minimum size of an approved RSA key.
+const minRSABits = 2048
+
+// CipherSuites are the approved TLS 1.2 cipher suites. TLS 1.3 suites
+// are not configurable, and restricted to AES-GCM by BoringCrypto.
+var CipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+}
+
+// CurvePreferences are the approved key exchange curves.
+var CurvePreferences = []tls.CurveID{tls.CurveP256, tls.CurveP384}
+
+// Apply restricts the TLS configuration to approved parameters. The minimum
+// version is lowered to TLS 1.2, the only version BoringCrypto may
+// negotiate in FIPS-only mode, and session tickets are disabled so that
+// sessions are not resumed from keys outside the module's control.
+func Apply(config *tls.Config) {
+	config.MinVersion = tls.VersionTLS12
+	config.CipherSuites = slices.Clone(CipherSuites)
+	config.CurvePreferences = slices.Clone(CurvePreferences)
+	config.SessionTicketsDisabled = true
+}
+
+// Check returns ErrNotAvailable unless the binary uses BoringCrypto.
+func Check() error {
+	if !Enabled() {
+		return ErrNotAvailable
+	}
+	return nil
+}
+
+// Verify checks that the TLS configuration, and the configuration returned
+// for handshakes if any, only allow approved parameters and certificates.
+func Verify(config *tls.Config) error {
+	if err := verifyConfig(config); err != nil {
+		return err
+	}
+	if config.GetConfigForClient == nil {
+		return nil
+	}
+	handshakeConfig, err := config.GetConfigForClient(&tls.ClientHelloInfo{})
+	if err != nil || handshakeConfig == nil {
+		return err
+	}
+	if err := verifyConfig(handshakeConfig); err != nil {
+		return fmt.Errorf("handshake configuration: %w", err)
+	}
+	return nil
+}
+
+// verifyConfig checks the parameters and certificates of a TLS configuration.
+func verifyConfig(config *tls.Config) error {
+	if config.MinVersion < tls.VersionTLS12 {
+		return errors.New("TLS versions below 1.2 are not approved")
+	}
+	if len(config.CipherSuites) == 0 {
+		return errors.New("cipher suites are not restricted to approved ones")
+	}
+	for _, suite := range config.CipherSuites {
+		if !slices.Contains(CipherSuites, suite) {
+			return fmt.Errorf("cipher suite %s is not approved", tls.CipherSuiteName(suite))
+		}
+	}
+	if len(config.CurvePreferences) == 0 {
+		return errors.New("curves are not restricted to approved ones")
+	}
+	for _, curve := range config.CurvePreferences {
+		if !slices.Contains(CurvePreferences, curve) {
+			return fmt.Errorf("curve %s is not approved", curve)
+		}
+	}
+	if !config.SessionTicketsDisabled {
+		return errors.New("session tickets must be disabled")
+	}
+	for _, cert := range config.Certificates {
+		if err := VerifyCertificate(cert); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VerifyCertificate checks that the key of the certificate is approved:
+// RSA of at least 2048 bits, or ECDSA on P-256 or P-384.
+func VerifyCertificate(cert tls.Certificate) error {
+	leaf := cert.Leaf
+	if leaf == nil {
+		if len(cert.Certificate) == 0 {
+			return errors.New("empty certificate")
+		}
+		var err error
+		if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return fmt.Errorf("unable to parse certificate: %w", err)
+		}
+	}
+
+	switch key := leaf.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < minRSABits {
+			return fmt.Errorf("certificate %q: RSA key of %d bits is not approved", leaf.Subject.CommonName, key.N.BitLen())
+		}
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() && key.Curve != elliptic.P384() {
+			return fmt.Errorf("certificate %q: ECDSA curve %s is not approved", leaf.Subject.CommonName, key.Curve.Params().Name)
+		}
+	default:
+		return fmt.Errorf("certificate %q: %T keys are not approved", leaf.Subject.CommonName, key)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package fips
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCert returns a self-signed certificate for the key.
+func newTestCert(t *testing.T, public crypto.PublicKey, private crypto.Signer) tls.Certificate {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "server"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, public, private)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: private}
+}
+
+func TestVerify(t *testing.T) {
+	require := require.New(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(err)
+	config := &tls.Config{MinVersion: tls.VersionTLS13, Certificates: []tls.Certificate{newTestCert(t, &key.PublicKey, key)}}
+	require.ErrorContains(Verify(config), "cipher suites")
+
+	Apply(config)
+	require.NoError(Verify(config))
+	require.Equal(uint16(tls.VersionTLS12), config.MinVersion)
+	require.True(config.SessionTicketsDisabled)
+
+	config.CurvePreferences = append(config.CurvePreferences, tls.X25519)
+	require.ErrorContains(Verify(config), "X25519 is not approved")
+
+	// The configuration of handshakes is verified too
+	Apply(config)
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		return &tls.Config{MinVersion: tls.VersionTLS13}, nil
+	}
+	require.ErrorContains(Verify(config), "handshake configuration")
+}
+
+func TestVerifyCertificate(t *testing.T) {
+	require := require.New(t)
+
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(err)
+	require.NoError(VerifyCertificate(newTestCert(t, &p384.PublicKey, p384)))
+
+	p224, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	require.NoError(err)
+	require.ErrorContains(VerifyCertificate(newTestCert(t, &p224.PublicKey, p224)), "P-224 is not approved")
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(err)
+	require.ErrorContains(VerifyCertificate(newTestCert(t, public, private)), "ed25519.PublicKey keys are not approved")
+}
+
+func TestCheck(t *testing.T) {
+	if Enabled() {
+		require.NoError(t, Check())
+		return
+	}
+	require.ErrorIs(t, Check(), ErrNotAvailable)
+}
@@ -0,0 +1,182 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Status is the health status of a check or of the whole process.
+type Status string
+
+// define health statuses, ordered by severity.
+const (
+	StatusOK        Status = "ok"
+	StatusDegraded  Status = "degraded"
+	StatusUnhealthy Status = "unhealthy"
+)
+
+// severity returns the severity rank of the status.
+func (s Status) severity() int {
+	switch s {
+	case StatusOK:
+		return 0
+	case StatusDegraded:
+		return 1
+	}
+	return 2
+}
+
+// CheckFunc performs a single health check and returns its status
+// along with a human-readable message.
+type CheckFunc func() (Status, string)
+
+// Result is the outcome of a single health check.
+type Result struct {
+	// Name is the name of the check.
+	Name string `json:"name"`
+
+	// Status is the status reported by the check.
+	Status Status `json:"status"`
+
+	// Message describes the status.
+	Message string `json:"message,omitempty"`
+}
+
+// Report is the outcome of a round of health checks.
+type Report struct {
+	// Status is the most severe status among the checks.
+	Status Status `json:"status"`
+
+	// Checks are the results of the individual checks.
+	Checks []Result `json:"checks"`
+
+	// CheckedAt is the time the checks were run.
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// namedCheck is a registered health check.
+type namedCheck struct {
+	name  string
+	check CheckFunc
+}
+
+// Checker periodically runs registered health checks and serves the
+// latest report over HTTP.
+type Checker struct {
+	// mu ensures concurrent access to the checks and the report.
+	mu sync.RWMutex
+
+	// interval is the time between two rounds of checks.
+	interval time.Duration
+
+	// checks are the registered health checks.
+	checks []namedCheck
+
+	// report is the latest report.
+	report Report
+
+	// stop signals the checking loop to exit.
+	stop chan struct{}
+}
+
+// NewChecker initializes and returns a new Checker.
+func NewChecker(interval time.Duration) *Checker {
+	return &Checker{
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Register adds a named health check.
+func (c *Checker) Register(name string, check CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// Start runs the checks immediately and then periodically until Stop is called.
+func (c *Checker) Start() {
+	c.Run()
+	go func() {
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				c.Run()
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the periodic checks.
+func (c *Checker) Stop() {
+	close(c.stop)
+}
+
+// Run runs all checks once and stores the report.
+func (c *Checker) Run() Report {
+	c.mu.RLock()
+	checks := c.checks
+	c.mu.RUnlock()
+
+	report := Report{
+		Status:    StatusOK,
+		Checks:    make([]Result, 0, len(checks)),
+		CheckedAt: time.Now(),
+	}
+	for _, nc := range checks {
+		status, message := nc.check()
+		report.Checks = append(slices.Clip(report.Checks), Result{Name: nc.name, Status: status, Message: message})
+		if status.severity() > report.Status.severity() {
+			report.Status = status
+		}
+	}
+
+	c.mu.Lock()
+	c.report = report
+	c.mu.Unlock()
+	return report
+}
+
+// Report returns the latest report. If the checks have not run for more
+// than three intervals, the checker itself is considered wedged and the
+// report is marked unhealthy.
+func (c *Checker) Report() Report {
+	c.mu.RLock()
+	report := c.report
+	c.mu.RUnlock()
+
+	if time.Since(report.CheckedAt) > 3*c.interval {
+		report.Status = StatusUnhealthy
+		report.Checks = append(slices.Clip(report.Checks), Result{
+			Name:    "checker",
+			Status:  StatusUnhealthy,
+			Message: "health checks are stale",
+		})
+	}
+	return report
+}
+
+// ServeHTTP implements http.Handler. It responds with 200 when the
+// process is healthy or degraded and with 503 when it is unhealthy,
+// so that orchestration restarts only a wedged process.
+func (c *Checker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report := c.Report()
+
+	status := http.StatusOK
+	if report.Status == StatusUnhealthy {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
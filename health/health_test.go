@@ -0,0 +1,47 @@
+package health
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecker(t *testing.T) {
+	require := require.New(t)
+
+	t.Run("Most severe status wins", func(t *testing.T) {
+		c := NewChecker(time.Minute)
+		c.Register("ok", func() (Status, string) { return StatusOK, "" })
+		c.Register("degraded", func() (Status, string) { return StatusDegraded, "slow" })
+
+		report := c.Run()
+		require.Equal(StatusDegraded, report.Status)
+		require.Len(report.Checks, 2)
+
+		rec := httptest.NewRecorder()
+		c.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		require.Equal(http.StatusOK, rec.Code)
+	})
+
+	t.Run("Unhealthy responds with 503", func(t *testing.T) {
+		c := NewChecker(time.Minute)
+		c.Register("listener", func() (Status, string) { return StatusUnhealthy, "down" })
+		c.Run()
+
+		rec := httptest.NewRecorder()
+		c.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		require.Equal(http.StatusServiceUnavailable, rec.Code)
+	})
+
+	t.Run("Stale checks are unhealthy", func(t *testing.T) {
+		c := NewChecker(time.Millisecond)
+		c.Register("ok", func() (Status, string) { return StatusOK, "" })
+		c.Run()
+
+		time.Sleep(10 * time.Millisecond)
+		require.Equal(StatusUnhealthy, c.Report().Status)
+	})
+}
@@ -0,0 +1,99 @@
+package healthport
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/listen"
+	"github.com/rrasulzade/tcp-lb-go/logging"
+)
+
+// writeTimeout bounds the time taken to write the banner to a slow client.
+const writeTimeout = time.Second
+
+// HealthPortConfig encapsulates the configuration parameters required
+// to initialize and run the health port listener.
+type HealthPortConfig struct {
+	// Address is an address on which the health port listens.
+	Address string
+
+	// Banner is the fixed response written to every connection.
+	Banner []byte
+
+	// ListenRetry defines how binding an address in use is retried.
+	ListenRetry listen.Retry
+}
+
+// Server answers every plaintext connection with a fixed banner and closes
+// it, for network-level health checks of cloud load balancers that cannot
+// speak mTLS. It shares nothing with the data plane: no TLS, no client
+// authentication, no backend connections.
+type Server struct {
+	// config is configuration object that holds all the health port settings.
+	config *HealthPortConfig
+
+	// listener accepts health check connections.
+	listener net.Listener
+
+	// wg waits for the accept loop to exit.
+	wg sync.WaitGroup
+}
+
+// NewServer creates a new health port Server instance.
+func NewServer(config *HealthPortConfig) (*Server, error) {
+	if config.Address == "" {
+		return nil, errors.New("provided health port address is blank")
+	}
+	return &Server{config: config}, nil
+}
+
+// Start initializes the health port listener and starts answering connections.
+func (s *Server) Start() error {
+	listener, err := listen.Listen(s.config.Address, s.config.ListenRetry)
+	if err != nil {
+		return fmt.Errorf("unable to initialize health port listener: %w", err)
+	}
+	s.listener = listener
+
+	logging.Infof("Health port is listening on %s", listener.Addr())
+	s.wg.Add(1)
+	go s.acceptConnections()
+	return nil
+}
+
+// Stop closes the health port listener.
+func (s *Server) Stop() error {
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+// Addr returns the address the health port listens on.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// acceptConnections answers connections until the listener is closed.
+func (s *Server) acceptConnections() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			logging.Errorf("Error accepting health port connection: %v", err)
+			continue
+		}
+
+		// The banner is short, so it is written inline. Anything sent
+		// by the client is ignored.
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		conn.Write(s.config.Banner)
+		conn.Close()
+	}
+}
@@ -0,0 +1,35 @@
+package healthport
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer(t *testing.T) {
+	require := require.New(t)
+
+	s, err := NewServer(&HealthPortConfig{
+		Address: "127.0.0.1:0",
+		Banner:  []byte("OK\n"),
+	})
+	require.NoError(err)
+	require.NoError(s.Start())
+
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", s.Addr().String())
+		require.NoError(err)
+		reply, err := io.ReadAll(conn)
+		require.NoError(err)
+		require.Equal("OK\n", string(reply))
+	}
+
+	require.NoError(s.Stop())
+	_, err = net.Dial("tcp", s.Addr().String())
+	require.Error(err)
+
+	_, err = NewServer(&HealthPortConfig{})
+	require.Error(err)
+}
@@ -0,0 +1,74 @@
+package httpauth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func serve(a *Authenticator, r *http.Request) int {
+	handler := a.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, r)
+	return recorder.Code
+}
+
+func TestTokens(t *testing.T) {
+	require := require.New(t)
+	a := New([]string{"secret1", "secret2"}, false)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	require.Equal(http.StatusUnauthorized, serve(a, r))
+
+	r.Header.Set("Authorization", "Bearer wrong")
+	require.Equal(http.StatusUnauthorized, serve(a, r))
+
+	r.Header.Set("Authorization", "Bearer secret2")
+	require.Equal(http.StatusOK, serve(a, r))
+
+	r.Header.Set("Authorization", "secret2")
+	require.Equal(http.StatusUnauthorized, serve(a, r))
+}
+
+func TestClientCerts(t *testing.T) {
+	require := require.New(t)
+	a := New([]string{"secret"}, true)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.TLS = &tls.ConnectionState{}
+	require.Equal(http.StatusUnauthorized, serve(a, r))
+
+	r.TLS.VerifiedChains = [][]*x509.Certificate{{&x509.Certificate{}}}
+	require.Equal(http.StatusOK, serve(a, r))
+
+	// Verified certificates are ignored unless enabled
+	require.Equal(http.StatusUnauthorized, serve(New([]string{"secret"}, false), r))
+}
+
+func TestNoAuth(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	require.Equal(t, http.StatusOK, serve(New(nil, false), r))
+}
+
+func TestIdentity(t *testing.T) {
+	require := require.New(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	require.Equal("anonymous", Identity(r))
+
+	r.Header.Set("Authorization", "Bearer secret")
+	identity := Identity(r)
+	require.True(strings.HasPrefix(identity, "token:"))
+	require.NotContains(identity, "secret")
+
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{
+		&x509.Certificate{Subject: pkix.Name{CommonName: "operator"}},
+	}}}
+	require.Equal("cn:operator", Identity(r))
+}
@@ -0,0 +1,119 @@
+package lib
+
+import (
+	"context"
+	"time"
+)
+
+// adaptiveWeightSmoothing is the share of the last health check in the
+// smoothed latency and failure rate of a backend, between 0 and 1.
+const adaptiveWeightSmoothing = 0.3
+
+// AdaptiveWeights configures the adjustment of backend weights from the
+// latency and failure rate of periodic health checks, so that traffic
+// moves away from degrading backends before they fail outright.
+type AdaptiveWeights struct {
+	// Interval is the time between two health checks.
+	Interval time.Duration
+
+	// Timeout is the time a backend has to accept a health check
+	// connection before the check fails.
+	Timeout time.Duration
+
+	// LatencyTarget is the health check latency of a backend served at
+	// its full weight. Slower backends are derated in proportion, and
+	// faster ones are promoted up to MaxPercent.
+	LatencyTarget time.Duration
+
+	// MinPercent is the lowest percentage of its weight a backend is
+	// derated to, at least 1 so that a backend recovers its traffic.
+	MinPercent int
+
+	// MaxPercent is the highest percentage of its weight a backend is
+	// promoted to, at least 100.
+	MaxPercent int
+}
+
+// backendHealth is the smoothed outcome of a backend's health checks.
+type backendHealth struct {
+	// latency is the smoothed latency of successful checks.
+	latency float64
+
+	// failureRate is the smoothed share of failed checks.
+	failureRate float64
+}
+
+// observe adds the outcome of a health check to the smoothed values.
+func (h *backendHealth) observe(latency time.Duration, err error) {
+	failed := 0.0
+	if err != nil {
+		failed = 1
+	} else if h.latency == 0 {
+		h.latency = float64(latency)
+	} else {
+		h.latency += adaptiveWeightSmoothing * (float64(latency) - h.latency)
+	}
+	h.failureRate += adaptiveWeightSmoothing * (failed - h.failureRate)
+}
+
+// percent returns the percentage of its weight the backend is served at.
+func (h *backendHealth) percent(aw AdaptiveWeights) int64 {
+	percent := 100.0
+	if h.latency > 0 {
+		percent = 100 * float64(aw.LatencyTarget) / h.latency
+	}
+	percent *= 1 - h.failureRate
+	return int64(max(float64(aw.MinPercent), min(percent, float64(aw.MaxPercent))))
+}
+
+// EffectiveWeight returns the weight of the backend adjusted by its
+// health checks, which is used for selection. It is the weight of the
+// backend if weights are not adapted.
+func (b *Backend) EffectiveWeight() int {
+	weight := b.Weight()
+	percent := b.weightPercent.Load()
+	if percent == 0 || weight == 0 {
+		return weight
+	}
+	return max(1, int(int64(weight)*percent/100))
+}
+
+// AdaptWeights checks the health of the registered backends every interval
+// until ctx is canceled, and adjusts their effective weight from the
+// latency and failure rate of the recent checks, bounded by the
+// configured percentages of their weight. Checks do not count towards
+// outlier detection.
+func (lb *LoadBalancer) AdaptWeights(ctx context.Context, aw AdaptiveWeights) {
+	healths := make(map[*Backend]*backendHealth)
+
+	ticker := time.NewTicker(aw.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Forget the health of removed backends
+		backends := lb.Backends()
+		checked := make(map[*Backend]*backendHealth, len(backends))
+		for _, result := range lb.Prewarm(backends, aw.Timeout) {
+			health, ok := healths[result.Backend]
+			if !ok {
+				health = &backendHealth{}
+			}
+			health.observe(result.Latency, result.Err)
+			checked[result.Backend] = health
+
+			percent := health.percent(aw)
+			lb.mu.RLock()
+			result.Backend.weightPercent.Store(percent)
+			result.Backend.fixHeaps()
+			lb.mu.RUnlock()
+			lb.metrics.weightPercent.With(result.Backend.Pool, result.Backend.Address).Set(percent)
+		}
+		healths = checked
+	}
+}
@@ -0,0 +1,90 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackendHealthPercent(t *testing.T) {
+	require := require.New(t)
+
+	aw := AdaptiveWeights{LatencyTarget: 10 * time.Millisecond, MinPercent: 10, MaxPercent: 200}
+
+	health := &backendHealth{}
+	health.observe(10*time.Millisecond, nil)
+	require.Equal(int64(100), health.percent(aw))
+
+	// Slower backends are derated in proportion, down to the minimum
+	health = &backendHealth{}
+	health.observe(20*time.Millisecond, nil)
+	require.Equal(int64(50), health.percent(aw))
+	health = &backendHealth{}
+	health.observe(time.Second, nil)
+	require.Equal(int64(10), health.percent(aw))
+
+	// Faster backends are promoted up to the maximum
+	health = &backendHealth{}
+	health.observe(time.Millisecond, nil)
+	require.Equal(int64(200), health.percent(aw))
+
+	// Failed checks derate the backend
+	health = &backendHealth{}
+	health.observe(10*time.Millisecond, nil)
+	health.observe(0, errors.New("connection refused"))
+	require.Equal(int64(70), health.percent(aw))
+}
+
+func TestEffectiveWeight(t *testing.T) {
+	require := require.New(t)
+
+	backend := &Backend{Address: "127.0.0.1:5001"}
+	require.Equal(DefaultWeight, backend.EffectiveWeight())
+
+	backend.weightPercent.Store(50)
+	require.Equal(DefaultWeight/2, backend.EffectiveWeight())
+
+	// Derated backends keep receiving some traffic
+	backend.weightPercent.Store(1)
+	backend.setWeight(10, 0)
+	require.Equal(1, backend.EffectiveWeight())
+
+	backend.setWeight(0, 0)
+	require.Equal(0, backend.EffectiveWeight())
+}
+
+func TestAdaptWeights(t *testing.T) {
+	require := require.New(t)
+
+	lb := NewLoadBalancer(10, 10)
+	dialer := &toggleDialer{}
+	dialer.failing.Store(true)
+	lb.dialer = dialer
+
+	backend := &Backend{Address: "127.0.0.1:5001"}
+	lb.AddBackend(backend)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go lb.AdaptWeights(ctx, AdaptiveWeights{
+		Interval:      5 * time.Millisecond,
+		Timeout:       time.Second,
+		LatencyTarget: time.Second,
+		MinPercent:    10,
+		MaxPercent:    100,
+	})
+
+	// Failing backends are derated to the minimum
+	require.Eventually(func() bool {
+		return backend.EffectiveWeight() == DefaultWeight/10
+	}, time.Second, 5*time.Millisecond)
+
+	// and recover their weight once healthy
+	dialer.failing.Store(false)
+	require.Eventually(func() bool {
+		return backend.EffectiveWeight() > DefaultWeight/2
+	}, time.Second, 5*time.Millisecond)
+}
@@ -0,0 +1,150 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// addressLookupTimeout bounds the resolution of a hostname matched against
+// the configured backends, so that an unresponsive DNS server does not
+// hang the validation of the configuration.
+const addressLookupTimeout = 5 * time.Second
+
+// CanonicalAddress normalizes a backend address so that equivalent forms
+// compare equal: hostnames are lower-cased, IP literals (including
+// bracketed IPv6) are printed in their shortest form and a missing port
+// is replaced with defaultPort.
+func CanonicalAddress(address, defaultPort string) (string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		// Retry with the default port if the address has none
+		if defaultPort == "" {
+			return "", fmt.Errorf("invalid address %q: %w", address, err)
+		}
+		host, port, err = net.SplitHostPort(net.JoinHostPort(strings.Trim(address, "[]"), defaultPort))
+		if err != nil {
+			return "", fmt.Errorf("invalid address %q: %w", address, err)
+		}
+	}
+	if host == "" || port == "" {
+		return "", fmt.Errorf("invalid address %q: host and port are required", address)
+	}
+
+	if ip, err := netip.ParseAddr(host); err == nil {
+		host = ip.Unmap().String()
+	} else {
+		host = strings.ToLower(strings.TrimSuffix(host, "."))
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
+
+// AddressMatcher maps alternative spellings of a backend address
+// (hostnames, IPv6 literals, missing ports) onto the canonical address
+// of a configured backend.
+type AddressMatcher struct {
+	// defaultPort is used for addresses without a port.
+	defaultPort string
+
+	// backends is the set of canonical backend addresses.
+	backends map[string]struct{}
+
+	// byIP maps a resolved "ip:port" to the canonical backend address.
+	byIP map[string]string
+
+	// lookup resolves a hostname to its IP addresses.
+	lookup func(ctx context.Context, host string) ([]string, error)
+}
+
+// NewAddressMatcher canonicalizes the provided backend addresses and
+// resolves their hostnames so that aliases can be matched against them.
+// Backends resolving to the same IP and port are rejected.
+func NewAddressMatcher(backends []string, defaultPort string) (*AddressMatcher, error) {
+	return newAddressMatcher(backends, defaultPort, net.DefaultResolver.LookupHost)
+}
+
+// newAddressMatcher creates an AddressMatcher with a custom host lookup.
+func newAddressMatcher(
+	backends []string,
+	defaultPort string,
+	lookup func(ctx context.Context, host string) ([]string, error),
+) (*AddressMatcher, error) {
+	m := &AddressMatcher{
+		defaultPort: defaultPort,
+		backends:    make(map[string]struct{}, len(backends)),
+		byIP:        make(map[string]string, len(backends)),
+		lookup:      lookup,
+	}
+
+	for _, backend := range backends {
+		canonical, err := CanonicalAddress(backend, defaultPort)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := m.backends[canonical]; exists {
+			return nil, fmt.Errorf("duplicate backend address %q", backend)
+		}
+		m.backends[canonical] = struct{}{}
+
+		// Index the backend by its resolved IPs. Resolution failures are
+		// tolerated here since the backend is resolved again on dial.
+		for _, ipPort := range m.resolve(canonical) {
+			if existing, exists := m.byIP[ipPort]; exists && existing != canonical {
+				return nil, fmt.Errorf("backend addresses %q and %q both resolve to %s", existing, canonical, ipPort)
+			}
+			m.byIP[ipPort] = canonical
+		}
+	}
+
+	return m, nil
+}
+
+// resolve returns the "ip:port" forms of a canonical address.
+func (m *AddressMatcher) resolve(canonical string) []string {
+	host, port, _ := net.SplitHostPort(canonical)
+	if _, err := netip.ParseAddr(host); err == nil {
+		return []string{canonical}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), addressLookupTimeout)
+	defer cancel()
+	ips, err := m.lookup(ctx, host)
+	if err != nil {
+		return nil
+	}
+	resolved := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		if addr, err := netip.ParseAddr(ip); err == nil {
+			resolved = append(resolved, net.JoinHostPort(addr.Unmap().String(), port))
+		}
+	}
+	return resolved
+}
+
+// Canonical returns the canonical form of the given configured backend address.
+func (m *AddressMatcher) Canonical(address string) (string, error) {
+	return CanonicalAddress(address, m.defaultPort)
+}
+
+// Match returns the canonical address of the configured backend that
+// the given address refers to, either directly or via name resolution.
+func (m *AddressMatcher) Match(address string) (string, error) {
+	canonical, err := CanonicalAddress(address, m.defaultPort)
+	if err != nil {
+		return "", err
+	}
+	if _, exists := m.backends[canonical]; exists {
+		return canonical, nil
+	}
+
+	for _, ipPort := range m.resolve(canonical) {
+		if backend, exists := m.byIP[ipPort]; exists {
+			return backend, nil
+		}
+	}
+	return "", fmt.Errorf("address %q does not match any configured backend", address)
+}
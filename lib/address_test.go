@@ -0,0 +1,107 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalAddress(t *testing.T) {
+	require := require.New(t)
+
+	testCases := []struct {
+		address  string
+		expected string
+	}{
+		{"127.0.0.1:5001", "127.0.0.1:5001"},
+		{"Backend1.Example.com:80", "backend1.example.com:80"},
+		{"backend1.example.com.:80", "backend1.example.com:80"},
+		{"[::1]:5001", "[::1]:5001"},
+		{"[0:0::0:1]:5001", "[::1]:5001"},
+		{"[::ffff:10.0.0.1]:5001", "10.0.0.1:5001"},
+		{"backend1", "backend1:8080"},
+		{"::1", "[::1]:8080"},
+		{"[::1]", "[::1]:8080"},
+	}
+
+	for _, tc := range testCases {
+		canonical, err := CanonicalAddress(tc.address, "8080")
+		require.NoError(err, tc.address)
+		require.Equal(tc.expected, canonical, tc.address)
+	}
+
+	_, err := CanonicalAddress("backend1", "")
+	require.Error(err, "Expected error for address without port")
+}
+
+func TestAddressMatcher(t *testing.T) {
+	require := require.New(t)
+
+	lookup := func(_ context.Context, host string) ([]string, error) {
+		switch host {
+		case "db.internal":
+			return []string{"10.0.0.5"}, nil
+		case "cache.internal":
+			return []string{"fd00::7"}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+
+	backends := []string{"10.0.0.5:5432", "cache.internal:6379", "[fd00::9]:80"}
+	m, err := newAddressMatcher(backends, "", lookup)
+	require.NoError(err)
+
+	t.Run("Exact match", func(t *testing.T) {
+		b, err := m.Match("10.0.0.5:5432")
+		require.NoError(err)
+		require.Equal("10.0.0.5:5432", b)
+	})
+
+	t.Run("Hostname resolving to backend IP", func(t *testing.T) {
+		b, err := m.Match("DB.internal:5432")
+		require.NoError(err)
+		require.Equal("10.0.0.5:5432", b)
+	})
+
+	t.Run("IP of hostname backend", func(t *testing.T) {
+		b, err := m.Match("[fd00:0::7]:6379")
+		require.NoError(err)
+		require.Equal("cache.internal:6379", b)
+	})
+
+	t.Run("Unbracketed IPv6 literal", func(t *testing.T) {
+		m, err := newAddressMatcher(backends, "80", lookup)
+		require.NoError(err)
+		b, err := m.Match("fd00::9")
+		require.NoError(err)
+		require.Equal("[fd00::9]:80", b)
+	})
+
+	t.Run("No match", func(t *testing.T) {
+		_, err := m.Match("10.0.0.5:5433")
+		require.Error(err)
+	})
+
+	t.Run("Duplicate backends", func(t *testing.T) {
+		_, err := newAddressMatcher([]string{"[::1]:80", "[0::1]:80"}, "", lookup)
+		require.Error(err)
+	})
+
+	t.Run("Backends resolving to the same address", func(t *testing.T) {
+		_, err := newAddressMatcher([]string{"10.0.0.5:5432", "db.internal:5432"}, "", lookup)
+		require.ErrorContains(err, `backend addresses "10.0.0.5:5432" and "db.internal:5432" both resolve to 10.0.0.5:5432`)
+	})
+
+	t.Run("Bounded lookup", func(t *testing.T) {
+		m, err := newAddressMatcher(backends, "", func(ctx context.Context, host string) ([]string, error) {
+			_, hasDeadline := ctx.Deadline()
+			require.True(hasDeadline, "Expected the lookup to be bounded")
+			return lookup(ctx, host)
+		})
+		require.NoError(err)
+		_, err = m.Match("db.internal:5432")
+		require.NoError(err)
+	})
+}
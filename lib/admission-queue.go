@@ -0,0 +1,213 @@
+package lib
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// admissionQueue is a bounded waiting room for connections that
+// arrive while every allowed backend is at capacity.
+type admissionQueue struct {
+	// mu guards the released channel and the fallbacks map.
+	mu sync.Mutex
+
+	// size is the maximum number of connections allowed to wait.
+	size int64
+
+	// timeout is the maximum time a connection may wait for capacity.
+	timeout time.Duration
+
+	// waiting is the current number of queued connections.
+	waiting atomic.Int64
+
+	// released is closed and replaced whenever backend capacity is freed.
+	released chan struct{}
+
+	// fallbacks counts the queued connections per pool they may also be
+	// routed to, so that they are woken up when capacity frees up in any
+	// of them. Nil until the first one.
+	fallbacks map[string]int
+}
+
+// newAdmissionQueue initializes and returns a new admissionQueue.
+func newAdmissionQueue(size int, timeout time.Duration) *admissionQueue {
+	return &admissionQueue{
+		size:     int64(size),
+		timeout:  timeout,
+		released: make(chan struct{}),
+	}
+}
+
+// enter reserves a slot in the queue.
+// Returns false if the queue is full.
+func (q *admissionQueue) enter() bool {
+	if q.waiting.Add(1) > q.size {
+		q.waiting.Add(-1)
+		return false
+	}
+	return true
+}
+
+// leave releases a previously reserved slot.
+func (q *admissionQueue) leave() {
+	q.waiting.Add(-1)
+}
+
+// wakeup returns a channel that is closed on the next capacity release.
+func (q *admissionQueue) wakeup() <-chan struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.released
+}
+
+// notify wakes up all waiting connections so they can retry selection.
+func (q *admissionQueue) notify() {
+	// Skip the channel swap when nobody is waiting
+	if q.waiting.Load() == 0 {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	close(q.released)
+	q.released = make(chan struct{})
+}
+
+// watch records that a queued connection may also be routed to the pools.
+func (q *admissionQueue) watch(pools []string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.fallbacks == nil {
+		q.fallbacks = make(map[string]int)
+	}
+	for _, pool := range pools {
+		q.fallbacks[pool]++
+	}
+}
+
+// unwatch undoes watch once the connection left the queue.
+func (q *admissionQueue) unwatch(pools []string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, pool := range pools {
+		if q.fallbacks[pool]--; q.fallbacks[pool] <= 0 {
+			delete(q.fallbacks, pool)
+		}
+	}
+}
+
+// watches reports whether a queued connection may be routed to the pool.
+func (q *admissionQueue) watches(pool string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.fallbacks[pool] > 0
+}
+
+// queued returns the number of connections currently waiting.
+func (q *admissionQueue) queued() int64 {
+	return q.waiting.Load()
+}
+
+// queueLimits are the size and timeout of an admission queue.
+type queueLimits struct {
+	size    int
+	timeout time.Duration
+}
+
+// admissionQueues holds an admission queue per pool, so that the
+// connections of a busy pool cannot fill the queue and starve the
+// connections waiting for the backends of other pools.
+type admissionQueues struct {
+	// mu serializes the creation of queues.
+	mu sync.Mutex
+
+	// defaults are the limits of the queues of pools without limits of their own.
+	defaults queueLimits
+
+	// pools maps a pool to the limits of its queue. A size of zero
+	// disables queueing for the pool.
+	pools map[string]queueLimits
+
+	// queues maps a pool to its queue, created on first use. The map is
+	// replaced rather than modified, so that it is read without locking.
+	queues atomic.Pointer[map[string]*admissionQueue]
+}
+
+// newAdmissionQueues initializes and returns admission queues with
+// the default limits.
+func newAdmissionQueues() *admissionQueues {
+	q := &admissionQueues{pools: make(map[string]queueLimits)}
+	q.queues.Store(&map[string]*admissionQueue{})
+	return q
+}
+
+// limits returns the limits of the queue of the pool.
+func (q *admissionQueues) limits(pool string) queueLimits {
+	if limits, ok := q.pools[pool]; ok {
+		return limits
+	}
+	return q.defaults
+}
+
+// enabled reports whether connections waiting for the backends
+// of the pool are queued.
+func (q *admissionQueues) enabled(pool string) bool {
+	limits := q.limits(pool)
+	return limits.size > 0 && limits.timeout > 0
+}
+
+// get returns the queue of the pool, creating it on first use.
+// Returns nil if queueing is disabled for the pool.
+func (q *admissionQueues) get(pool string) *admissionQueue {
+	if queue := (*q.queues.Load())[pool]; queue != nil {
+		return queue
+	}
+	if !q.enabled(pool) {
+		return nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	queues := *q.queues.Load()
+	if queue := queues[pool]; queue != nil {
+		return queue
+	}
+	limits := q.limits(pool)
+	queue := newAdmissionQueue(limits.size, limits.timeout)
+	updated := make(map[string]*admissionQueue, len(queues)+1)
+	for name, existing := range queues {
+		updated[name] = existing
+	}
+	updated[pool] = queue
+	q.queues.Store(&updated)
+	return queue
+}
+
+// notify wakes up the connections waiting in the queue of the pool, and
+// those waiting in the queues of other pools that may be routed to it.
+func (q *admissionQueues) notify(pool string) {
+	for name, queue := range *q.queues.Load() {
+		if queue.queued() == 0 {
+			continue
+		}
+		if name == pool || queue.watches(pool) {
+			queue.notify()
+		}
+	}
+}
+
+// queued returns the number of connections currently waiting in all queues.
+func (q *admissionQueues) queued() int64 {
+	var total int64
+	for _, queue := range *q.queues.Load() {
+		total += queue.queued()
+	}
+	return total
+}
@@ -0,0 +1,168 @@
+package lib
+
+import (
+	"sync"
+	"time"
+)
+
+// define the number of entries retained per backend.
+const (
+	// transitionHistorySize is the number of health transitions retained.
+	transitionHistorySize = 32
+
+	// dialErrorHistorySize is the number of dial errors retained.
+	dialErrorHistorySize = 16
+)
+
+// HealthTransition is a change of the health of a backend.
+type HealthTransition string
+
+// define the health transitions of backends.
+const (
+	// TransitionEjected is recorded when a backend is ejected from
+	// selection, with the ejecting check and duration as the detail.
+	TransitionEjected HealthTransition = "ejected"
+
+	// TransitionDialFailing is recorded when a dial to a backend fails
+	// after a successful one.
+	TransitionDialFailing HealthTransition = "dial_failing"
+
+	// TransitionDialRecovered is recorded when a dial to a backend
+	// succeeds after failed ones.
+	TransitionDialRecovered HealthTransition = "dial_recovered"
+)
+
+// HealthEvent is a health transition of a backend.
+type HealthEvent struct {
+	// Time is the time of the transition.
+	Time time.Time `json:"time"`
+
+	// Transition is the kind of transition.
+	Transition HealthTransition `json:"transition"`
+
+	// Detail describes the transition, e.g. the ejection duration.
+	Detail string `json:"detail,omitempty"`
+}
+
+// DialError is a failed dial or TLS handshake to a backend.
+type DialError struct {
+	// Time is the time of the failure.
+	Time time.Time `json:"time"`
+
+	// Error is the error the dial failed with.
+	Error string `json:"error"`
+}
+
+// BackendHistory is the recent health history of a backend, oldest first.
+type BackendHistory struct {
+	// Address is the address of the backend.
+	Address string `json:"address"`
+
+	// Pool is the pool of the backend.
+	Pool string `json:"pool"`
+
+	// Transitions are the last health transitions of the backend.
+	Transitions []HealthEvent `json:"transitions"`
+
+	// DialErrors are the last dial errors of the backend.
+	DialErrors []DialError `json:"dial_errors"`
+}
+
+// ring retains the last entries added to it, up to its size.
+type ring[T any] struct {
+	entries []T
+
+	// next is the position of the next entry once the ring is full.
+	next int
+}
+
+// add adds an entry, replacing the oldest one once size are retained.
+func (r *ring[T]) add(entry T, size int) {
+	if len(r.entries) < size {
+		r.entries = append(r.entries, entry)
+		return
+	}
+	r.entries[r.next] = entry
+	r.next = (r.next + 1) % size
+}
+
+// list returns a copy of the entries, oldest first.
+func (r *ring[T]) list() []T {
+	entries := make([]T, 0, len(r.entries))
+	entries = append(entries, r.entries[r.next:]...)
+	return append(entries, r.entries[:r.next]...)
+}
+
+// backendHistory retains the recent health history of a backend.
+type backendHistory struct {
+	// mu guards the fields below.
+	mu sync.Mutex
+
+	transitions ring[HealthEvent]
+	dialErrors  ring[DialError]
+
+	// dialFailing is set while the last dial failed.
+	dialFailing bool
+}
+
+// recordTransition adds a health transition to the history.
+func (h *backendHistory) recordTransition(transition HealthTransition, detail string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.transitions.add(HealthEvent{Time: time.Now(), Transition: transition, Detail: detail}, transitionHistorySize)
+}
+
+// recordDial adds the dial error, if any, to the history along with the
+// transition between failing and successful dials.
+func (h *backendHistory) recordDial(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	failing := err != nil
+	if failing {
+		h.dialErrors.add(DialError{Time: now, Error: err.Error()}, dialErrorHistorySize)
+	}
+	if failing == h.dialFailing {
+		return
+	}
+	h.dialFailing = failing
+	transition := HealthEvent{Time: now, Transition: TransitionDialRecovered}
+	if failing {
+		transition.Transition, transition.Detail = TransitionDialFailing, err.Error()
+	}
+	h.transitions.add(transition, transitionHistorySize)
+}
+
+// recordHandshakeError adds a failed TLS handshake to the dial errors.
+func (h *backendHistory) recordHandshakeError(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.dialErrors.add(DialError{Time: time.Now(), Error: "TLS handshake: " + err.Error()}, dialErrorHistorySize)
+}
+
+// History returns the recent health history of the backend: its last
+// health transitions and dial errors. The history is kept as long as the
+// backend stays registered in its pool.
+func (b *Backend) History() BackendHistory {
+	b.history.mu.Lock()
+	defer b.history.mu.Unlock()
+
+	return BackendHistory{
+		Address:     b.Address,
+		Pool:        b.Pool,
+		Transitions: b.history.transitions.list(),
+		DialErrors:  b.history.dialErrors.list(),
+	}
+}
+
+// Histories returns the recent health history of the registered backends,
+// in the order of Backends.
+func (lb *LoadBalancer) Histories() []BackendHistory {
+	backends := lb.Backends()
+	histories := make([]BackendHistory, len(backends))
+	for i, backend := range backends {
+		histories[i] = backend.History()
+	}
+	return histories
+}
@@ -0,0 +1,73 @@
+package lib
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRing(t *testing.T) {
+	require := require.New(t)
+
+	var r ring[int]
+	require.Empty(r.list())
+	for i := 1; i <= 3; i++ {
+		r.add(i, 3)
+	}
+	require.Equal([]int{1, 2, 3}, r.list())
+	r.add(4, 3)
+	r.add(5, 3)
+	require.Equal([]int{3, 4, 5}, r.list())
+}
+
+func TestBackendHistory(t *testing.T) {
+	require := require.New(t)
+
+	lb := NewLoadBalancer(uint64(100), uint64(100), WithPassiveHealthCheck(PassiveHealthCheck{
+		ConsecutiveFailures: 2,
+		Cooldown:            time.Minute,
+	}))
+	dialer := &toggleDialer{}
+	lb.dialer = dialer
+	backend := &Backend{Address: "127.0.0.1:5010", Pool: "web"}
+	lb.AddBackend(backend)
+	route := func() error {
+		conn := &mockConn{readBuffer: new(bytes.Buffer), writeBuffer: new(bytes.Buffer)}
+		return lb.RouteConnection("client1", conn, map[string]struct{}{backend.Address: {}})
+	}
+
+	require.NoError(route())
+	require.Empty(backend.History().Transitions, "successful dials are not transitions")
+
+	dialer.failing.Store(true)
+	require.ErrorIs(route(), ErrBackendUnreachable)
+	require.ErrorIs(route(), ErrBackendUnreachable)
+
+	history := lb.Histories()
+	require.Len(history, 1)
+	require.Equal("127.0.0.1:5010", history[0].Address)
+	require.Len(history[0].DialErrors, 2)
+	require.Equal("connection refused", history[0].DialErrors[0].Error)
+	transitions := history[0].Transitions
+	require.Len(transitions, 2)
+	require.Equal(TransitionDialFailing, transitions[0].Transition)
+	require.Equal(TransitionEjected, transitions[1].Transition)
+	require.Equal("2 consecutive dial failures for 1m0s", transitions[1].Detail)
+
+	backend.ejectedUntil.Store(0)
+	dialer.failing.Store(false)
+	require.NoError(route())
+	transitions = backend.History().Transitions
+	require.Len(transitions, 3)
+	require.Equal(TransitionDialRecovered, transitions[2].Transition)
+
+	for i := 0; i < transitionHistorySize; i++ {
+		backend.history.recordDial(errors.New("refused"))
+		backend.history.recordDial(nil)
+	}
+	require.Len(backend.History().Transitions, transitionHistorySize)
+	require.Len(backend.History().DialErrors, dialErrorHistorySize)
+}
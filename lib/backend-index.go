@@ -0,0 +1,116 @@
+package lib
+
+import (
+	"slices"
+)
+
+// backendIndex maps allowed backends entries, i.e. backend addresses and
+// pool keys, to the registered backends they allow, so that backend
+// selection only visits the backends allowed for a client instead of
+// matching every registered backend against the client's allowed set.
+type backendIndex struct {
+	// positions maps an indexed backend to its registration order.
+	positions map[*Backend]int
+
+	// entries maps an allowed backends entry to the backends it allows,
+	// in registration order.
+	entries map[string][]*Backend
+
+	// heaps maps an allowed backends entry to the selection heap of
+	// the backends it allows.
+	heaps map[string]*selectionHeap
+}
+
+// newBackendIndex indexes the registered backends.
+func newBackendIndex(backends []*Backend) *backendIndex {
+	ix := &backendIndex{
+		positions: make(map[*Backend]int, len(backends)),
+		entries:   make(map[string][]*Backend),
+		heaps:     make(map[string]*selectionHeap),
+	}
+	for _, backend := range backends {
+		ix.add(backend)
+	}
+	return ix
+}
+
+// add indexes a backend registered after the indexed ones, precomputes
+// the entries denying it and applies its initial weight.
+func (ix *backendIndex) add(backend *Backend) {
+	backend.applyInitialWeight()
+	backend.denyAddressKey = DenyKey(backend.Address)
+	backend.denyPoolKey = ""
+	if backend.poolKey != "" {
+		backend.denyPoolKey = DenyKey(backend.poolKey)
+	}
+
+	position := len(ix.positions)
+	ix.positions[backend] = position
+	backend.heaps = nil
+	ix.addEntry(backend.Address, backend, position)
+	if backend.poolKey != "" {
+		ix.addEntry(backend.poolKey, backend, position)
+	}
+}
+
+// addEntry indexes a backend allowed by an entry.
+func (ix *backendIndex) addEntry(entry string, backend *Backend, position int) {
+	ix.entries[entry] = append(ix.entries[entry], backend)
+
+	h, ok := ix.heaps[entry]
+	if !ok {
+		h = newSelectionHeap()
+		ix.heaps[entry] = h
+	}
+	backend.heaps = append(backend.heaps, h.push(backend, position))
+}
+
+// selectionHeap returns the selection heap of the backends allowed by
+// allowedBackends if a single allow entry of the set matches indexed
+// backends. Returns nil otherwise.
+func (ix *backendIndex) selectionHeap(allowedBackends map[string]struct{}) *selectionHeap {
+	var h *selectionHeap
+	for entry := range allowedBackends {
+		entryHeap, ok := ix.heaps[entry]
+		if !ok {
+			continue
+		}
+		if h != nil {
+			return nil
+		}
+		h = entryHeap
+	}
+	return h
+}
+
+// candidates returns the backends allowed by an allow entry of
+// allowedBackends in registration order, without applying its deny
+// entries. The returned slice must not be modified.
+func (ix *backendIndex) candidates(allowedBackends map[string]struct{}) []*Backend {
+	var candidates []*Backend
+	matched := 0
+	for entry := range allowedBackends {
+		backends, ok := ix.entries[entry]
+		if !ok {
+			continue
+		}
+		// Share the indexed slice when a single entry matches
+		if matched++; matched == 1 {
+			candidates = backends
+			continue
+		}
+		if matched == 2 {
+			candidates = slices.Clone(candidates)
+		}
+		candidates = append(candidates, backends...)
+	}
+	if matched <= 1 {
+		return candidates
+	}
+
+	// A backend may be allowed both by address and by pool
+	slices.SortFunc(candidates, func(a, b *Backend) int {
+		return ix.positions[a] - ix.positions[b]
+	})
+	return slices.Compact(candidates)
+}
@@ -0,0 +1,170 @@
+package lib
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackendIndex(t *testing.T) {
+	require := require.New(t)
+
+	a1 := &Backend{Address: "10.0.0.1:80", Pool: "a", poolKey: PoolKey("a")}
+	b1 := &Backend{Address: "10.0.0.2:80", Pool: "b", poolKey: PoolKey("b")}
+	a2 := &Backend{Address: "10.0.0.3:80", Pool: "a", poolKey: PoolKey("a")}
+	plain := &Backend{Address: "10.0.0.4:80"}
+	ix := newBackendIndex([]*Backend{a1, b1, a2, plain})
+
+	t.Run("Pool entry", func(t *testing.T) {
+		require.Equal([]*Backend{a1, a2}, ix.candidates(map[string]struct{}{PoolKey("a"): {}}))
+	})
+
+	t.Run("Registration order and no duplicates", func(t *testing.T) {
+		allowed := map[string]struct{}{
+			plain.Address: {}, a2.Address: {}, PoolKey("a"): {}, PoolKey("b"): {},
+		}
+		require.Equal([]*Backend{a1, b1, a2, plain}, ix.candidates(allowed))
+	})
+
+	t.Run("Unknown and deny entries", func(t *testing.T) {
+		allowed := map[string]struct{}{"pool:unknown": {}, DenyKey(PoolKey("a")): {}}
+		require.Empty(ix.candidates(allowed))
+	})
+
+	t.Run("Deny keys precomputed", func(t *testing.T) {
+		require.Equal(DenyKey(a1.Address), a1.denyAddressKey)
+		require.Equal(DenyKey(PoolKey("a")), a1.denyPoolKey)
+		require.Empty(plain.denyPoolKey)
+	})
+}
+
+func TestGetBackendIndexed(t *testing.T) {
+	require := require.New(t)
+
+	lb := NewLoadBalancer(10, 1)
+	for i := 0; i < 4; i++ {
+		lb.AddBackend(&Backend{Address: fmt.Sprintf("10.0.0.%d:80", i+1), Pool: "a"})
+	}
+	lb.AddBackend(&Backend{Address: "10.0.1.1:80", Pool: "b"})
+
+	// Deny entries apply to the candidates
+	allowed := map[string]struct{}{PoolKey("a"): {}, DenyKey("10.0.0.1:80"): {}}
+	for i := 0; i < 6; i++ {
+		backend, err := lb.GetBackend(allowed)
+		require.NoError(err)
+		require.Equal("a", backend.Pool)
+		require.NotEqual("10.0.0.1:80", backend.Address)
+	}
+
+	// Backends added by a pool update are indexed
+	lb.SetPoolBackends("b", []*Backend{{Address: "10.0.1.2:80"}})
+	backend, err := lb.GetBackend(map[string]struct{}{PoolKey("b"): {}})
+	require.NoError(err)
+	require.Equal("10.0.1.2:80", backend.Address)
+
+	// And so are backends added by a transaction
+	_, err = lb.ApplyBackendTransaction(BackendTransaction{
+		Add: []*Backend{{Address: "10.0.2.1:80", Pool: "c"}},
+	})
+	require.NoError(err)
+	backend, err = lb.GetBackend(map[string]struct{}{PoolKey("c"): {}})
+	require.NoError(err)
+	require.Equal("10.0.2.1:80", backend.Address)
+
+	_, err = lb.GetBackend(map[string]struct{}{"10.0.1.1:80": {}})
+	require.ErrorIs(err, ErrNoAvailableBackend)
+}
+
+// BenchmarkGetBackend measures backend selection for a client allowed
+// a single pool out of many registered pools.
+func BenchmarkGetBackend(b *testing.B) {
+	lb := NewLoadBalancer(1, 1)
+	for pool := 0; pool < 100; pool++ {
+		for i := 0; i < 10; i++ {
+			lb.AddBackend(&Backend{Address: fmt.Sprintf("10.0.%d.%d:80", pool, i), Pool: fmt.Sprint(pool)})
+		}
+	}
+	allowed := map[string]struct{}{PoolKey("42"): {}}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		backend, err := lb.GetBackend(allowed)
+		if err != nil {
+			b.Fatal(err)
+		}
+		backend.decrementConnections()
+	}
+}
+
+// BenchmarkGetBackendLargePool measures backend selection for a client
+// allowed a single pool of many backends.
+func BenchmarkGetBackendLargePool(b *testing.B) {
+	lb := NewLoadBalancer(1, 1)
+	for i := 0; i < 2000; i++ {
+		lb.AddBackend(&Backend{Address: fmt.Sprintf("10.0.%d.%d:80", i/256, i%256), Pool: "web"})
+	}
+	allowed := map[string]struct{}{PoolKey("web"): {}}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		backend, err := lb.GetBackend(allowed)
+		if err != nil {
+			b.Fatal(err)
+		}
+		// Keep connections spread across the pool
+		if i%2 == 0 {
+			lb.mu.RLock()
+			backend.decrementConnections()
+			lb.mu.RUnlock()
+		}
+	}
+}
+
+// BenchmarkGetBackendParallel measures concurrent backend selections and
+// releases of connections, for clients allowed a single pool each and
+// for clients sharing a pool.
+func BenchmarkGetBackendParallel(b *testing.B) {
+	lb := NewLoadBalancer(1, 1)
+	for pool := 0; pool < 16; pool++ {
+		for i := 0; i < 64; i++ {
+			lb.AddBackend(&Backend{Address: fmt.Sprintf("10.0.%d.%d:80", pool, i), Pool: fmt.Sprint(pool)})
+		}
+	}
+
+	run := func(b *testing.B, allowed func(worker int64) map[string]struct{}) {
+		var workers atomic.Int64
+		b.RunParallel(func(pb *testing.PB) {
+			allowedBackends := allowed(workers.Add(1))
+			for pb.Next() {
+				backend, err := lb.GetBackend(allowedBackends)
+				if err != nil {
+					b.Error(err)
+					return
+				}
+				lb.mu.RLock()
+				backend.decrementConnections()
+				lb.mu.RUnlock()
+			}
+		})
+	}
+
+	b.Run("DistinctPools", func(b *testing.B) {
+		run(b, func(worker int64) map[string]struct{} {
+			return map[string]struct{}{PoolKey(fmt.Sprint(worker % 16)): {}}
+		})
+	})
+
+	b.Run("SharedPool", func(b *testing.B) {
+		run(b, func(int64) map[string]struct{} {
+			return map[string]struct{}{PoolKey("0"): {}}
+		})
+	})
+
+	b.Run("Addresses", func(b *testing.B) {
+		run(b, func(int64) map[string]struct{} {
+			return map[string]struct{}{"10.0.0.1:80": {}, "10.0.0.2:80": {}, "10.0.1.1:80": {}}
+		})
+	})
+}
@@ -0,0 +1,48 @@
+package lib
+
+import "sync/atomic"
+
+// BackendLease is a connection reserved on a backend with LeaseBackend.
+// It is registered as an active connection of the backend until released,
+// so that ReconcileConnections keeps counting it.
+type BackendLease struct {
+	// Backend is the reserved backend.
+	Backend *Backend
+
+	// lb is the load balancer the backend is registered with.
+	lb *LoadBalancer
+
+	// released is set once the lease is released.
+	released atomic.Bool
+}
+
+// LeaseBackend is like GetBackend, but registers the reservation as an
+// active connection of the selected backend, for embedders that connect
+// to the backend themselves while connection counts are reconciled. The
+// lease must be released once the connection ends.
+func (lb *LoadBalancer) LeaseBackend(allowedBackends map[string]struct{}) (*BackendLease, error) {
+	backend, err := lb.GetBackend(allowedBackends)
+	if err != nil {
+		return nil, err
+	}
+	lease := &BackendLease{Backend: backend, lb: lb}
+	backend.registry.add(lease)
+	return lease, nil
+}
+
+// Release releases the reservation of the lease, and wakes up the
+// connections waiting for capacity. Releasing it again has no effect.
+func (l *BackendLease) Release() {
+	if l.released.Swap(true) {
+		return
+	}
+	l.Backend.registry.remove(l)
+	l.lb.mu.RLock()
+	l.Backend.decrementConnections()
+	l.lb.mu.RUnlock()
+
+	// Wake up queued connections waiting for capacity
+	if l.lb.queues != nil {
+		l.lb.queues.notify(l.Backend.Pool)
+	}
+}
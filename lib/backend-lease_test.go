@@ -0,0 +1,33 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeaseBackend(t *testing.T) {
+	require := require.New(t)
+
+	lb := NewLoadBalancer(uint64(5), uint64(1))
+	backend := &Backend{Address: "127.0.0.1:5001", Pool: "api"}
+	lb.AddBackend(backend)
+
+	// A lease is registered, and is not corrected away
+	lease, err := lb.LeaseBackend(map[string]struct{}{PoolKey("api"): {}})
+	require.NoError(err)
+	require.Equal(backend, lease.Backend)
+	require.Equal(int64(1), backend.registry.count())
+	require.Empty(lb.reconcileConnections(nil))
+	require.Equal(int64(1), backend.ConnectionCount())
+
+	// Releasing it again has no effect
+	lease.Release()
+	lease.Release()
+	require.Equal(int64(0), backend.registry.count())
+	require.Equal(int64(0), backend.ConnectionCount())
+	require.Empty(lb.reconcileConnections(nil))
+
+	_, err = lb.LeaseBackend(map[string]struct{}{PoolKey("web"): {}})
+	require.ErrorIs(err, ErrNoAvailableBackend)
+}
@@ -0,0 +1,72 @@
+package lib
+
+import (
+	"context"
+	"time"
+)
+
+// removalPollInterval is the time between two checks of the active
+// connections of a backend being removed.
+const removalPollInterval = 100 * time.Millisecond
+
+// BackendRemoval describes the removal of a backend whose active
+// connections were drained.
+type BackendRemoval struct {
+	// Backend is the removed backend.
+	Backend *Backend
+
+	// ActiveAtStart is the number of active connections when the
+	// backend was removed.
+	ActiveAtStart int64
+
+	// ForceClosed is the number of connections still active at the
+	// timeout, which were force-closed.
+	ForceClosed int64
+
+	// Duration is the time the active connections took to finish.
+	Duration time.Duration
+}
+
+// RemoveBackend removes the backend with the address from the pool as a
+// single-change backend transaction, so that no new connection is routed
+// to it, then waits up to timeout for its active connections to finish.
+// Connections still active at the timeout are force-closed. Canceling ctx
+// stops the wait, leaving the remaining connections open, and returns the
+// removal so far along with ctx's error.
+func (lb *LoadBalancer) RemoveBackend(ctx context.Context, ref BackendRef, timeout time.Duration) (*BackendRemoval, error) {
+	result, err := lb.ApplyBackendTransaction(BackendTransaction{Remove: []BackendRef{ref}})
+	if err != nil {
+		return nil, err
+	}
+	backend := result.Removed[0]
+
+	start := time.Now()
+	removal := &BackendRemoval{Backend: backend, ActiveAtStart: backend.ConnectionCount()}
+	lb.logger.Infof("Backend %s removed from pool %s, waiting for %d active connections", backend.Address, backend.Pool, removal.ActiveAtStart)
+
+	ticker := time.NewTicker(removalPollInterval)
+	defer ticker.Stop()
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for backend.ConnectionCount() > 0 {
+		select {
+		case <-ticker.C:
+		case <-deadline.C:
+			removal.ForceClosed = backend.ConnectionCount()
+			removal.Duration = time.Since(start)
+			backend.closeConnections()
+			lb.logger.Warnf("Backend %s of pool %s still had %d active connections after %s, force-closing them",
+				backend.Address, backend.Pool, removal.ForceClosed, timeout)
+			return removal, nil
+		case <-ctx.Done():
+			removal.Duration = time.Since(start)
+			return removal, ctx.Err()
+		}
+	}
+
+	removal.Duration = time.Since(start)
+	lb.logger.Infof("Backend %s of pool %s drained, %d connections finished in %s",
+		backend.Address, backend.Pool, removal.ActiveAtStart, removal.Duration.Round(time.Millisecond))
+	return removal, nil
+}
@@ -0,0 +1,67 @@
+package lib
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoveBackend(t *testing.T) {
+	require := require.New(t)
+
+	lb := NewLoadBalancer(uint64(5), uint64(1))
+	lb.dialer = &mockDialer{}
+	backend := &Backend{Address: "127.0.0.1:5001", Pool: "api"}
+	lb.AddBackend(backend)
+
+	conn, err := lb.DialContext(WithRateLimitKey(context.Background(), "job1"), "api")
+	require.NoError(err)
+	time.AfterFunc(50*time.Millisecond, func() { conn.Close() })
+
+	// New connections are no longer routed to the backend while its
+	// active connection finishes
+	removal, err := lb.RemoveBackend(context.Background(), BackendRef{Pool: "api", Address: "127.0.0.1:5001"}, time.Minute)
+	require.NoError(err)
+	require.Same(backend, removal.Backend)
+	require.Equal(int64(1), removal.ActiveAtStart)
+	require.Zero(removal.ForceClosed)
+	require.GreaterOrEqual(removal.Duration, 50*time.Millisecond)
+	require.Empty(lb.Backends())
+
+	_, err = lb.RemoveBackend(context.Background(), BackendRef{Pool: "api", Address: "127.0.0.1:5001"}, time.Minute)
+	require.ErrorIs(err, ErrUnknownBackend)
+}
+
+func TestRemoveBackendTimeout(t *testing.T) {
+	require := require.New(t)
+
+	lb := NewLoadBalancer(uint64(5), uint64(1))
+	lb.dialer = &mockDialer{}
+	backend := &Backend{Address: "127.0.0.1:5001", Pool: "api"}
+	lb.AddBackend(backend)
+
+	conn, err := lb.DialContext(WithRateLimitKey(context.Background(), "job1"), "api")
+	require.NoError(err)
+	defer conn.Close()
+	closed := backend.closeContext()
+
+	// Connections still active at the timeout are force-closed
+	removal, err := lb.RemoveBackend(context.Background(), BackendRef{Pool: "api", Address: "127.0.0.1:5001"}, 10*time.Millisecond)
+	require.NoError(err)
+	require.Equal(int64(1), removal.ForceClosed)
+	require.Error(closed.Err())
+
+	// Canceling the context stops the wait
+	lb.AddBackend(&Backend{Address: "127.0.0.1:5002", Pool: "api"})
+	other, err := lb.DialContext(WithRateLimitKey(context.Background(), "job2"), "api")
+	require.NoError(err)
+	defer other.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	removal, err = lb.RemoveBackend(ctx, BackendRef{Pool: "api", Address: "127.0.0.1:5002"}, time.Minute)
+	require.ErrorIs(err, context.Canceled)
+	require.Equal(int64(1), removal.ActiveAtStart)
+	require.Zero(removal.ForceClosed)
+}
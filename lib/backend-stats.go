@@ -0,0 +1,66 @@
+package lib
+
+import "time"
+
+// BackendStats are the transfer statistics of a backend since it was
+// registered.
+type BackendStats struct {
+	// Address is the address of the backend.
+	Address string `json:"address"`
+
+	// Pool is the pool of the backend.
+	Pool string `json:"pool"`
+
+	// ActiveConnections is the number of active connections.
+	ActiveConnections int64 `json:"active_connections"`
+
+	// TotalConnections is the number of connections routed or dialed
+	// to the backend, including those that failed to connect.
+	TotalConnections uint64 `json:"total_connections"`
+
+	// BytesSent is the number of bytes transferred to the backend.
+	BytesSent uint64 `json:"bytes_sent"`
+
+	// BytesReceived is the number of bytes transferred from the backend.
+	BytesReceived uint64 `json:"bytes_received"`
+
+	// LastUsed is the time the backend was last selected or its last
+	// connection ended, zero if it was never used.
+	LastUsed time.Time `json:"last_used"`
+}
+
+// recordUse counts a new connection to the backend.
+func (b *Backend) recordUse() {
+	b.totalConnections.Add(1)
+	b.lastUsed.Store(time.Now().UnixNano())
+}
+
+// Stats returns the transfer statistics of the backend. Bytes are counted
+// as they are transferred, so that long-lived connections are accounted
+// for before they end.
+func (b *Backend) Stats() BackendStats {
+	stats := BackendStats{
+		Address:           b.Address,
+		Pool:              b.Pool,
+		ActiveConnections: b.ConnectionCount(),
+		TotalConnections:  b.totalConnections.Load(),
+		BytesSent:         b.bytesSent.Load(),
+		BytesReceived:     b.bytesReceived.Load(),
+	}
+	if lastUsed := b.lastUsed.Load(); lastUsed != 0 {
+		stats.LastUsed = time.Unix(0, lastUsed)
+	}
+	return stats
+}
+
+// Stats returns the transfer statistics of the registered backends, in
+// the order of Backends. Statistics of a backend are kept as long as it
+// stays registered in its pool.
+func (lb *LoadBalancer) Stats() []BackendStats {
+	backends := lb.Backends()
+	stats := make([]BackendStats, len(backends))
+	for i, backend := range backends {
+		stats[i] = backend.Stats()
+	}
+	return stats
+}
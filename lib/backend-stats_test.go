@@ -0,0 +1,47 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackendStats(t *testing.T) {
+	require := require.New(t)
+
+	lb := NewLoadBalancer(uint64(5), uint64(5))
+	lb.dialer = &mockDialer{}
+	backend := &Backend{Address: "127.0.0.1:5010", Pool: "api"}
+	idle := &Backend{Address: "127.0.0.1:5011", Pool: "other"}
+	lb.AddBackend(backend)
+	lb.AddBackend(idle)
+
+	start := time.Now()
+	clientConn := &mockConn{readBuffer: bytes.NewBufferString("client data"), writeBuffer: new(bytes.Buffer)}
+	require.NoError(lb.RouteConnection("client1", clientConn, map[string]struct{}{PoolKey("api"): {}}))
+
+	// Dialed connections count the bytes read and written
+	conn, err := lb.DialContext(context.Background(), "api")
+	require.NoError(err)
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(err)
+	_, err = conn.Read(make([]byte, 4))
+	require.NoError(err)
+	require.Equal(int64(1), lb.Stats()[0].ActiveConnections)
+	require.NoError(conn.Close())
+
+	stats := lb.Stats()
+	require.Len(stats, 2)
+	require.Equal(backend.Address, stats[0].Address)
+	require.Equal("api", stats[0].Pool)
+	require.Equal(int64(0), stats[0].ActiveConnections)
+	require.Equal(uint64(2), stats[0].TotalConnections)
+	require.Equal(uint64(len("client data")+len("ping")), stats[0].BytesSent)
+	require.Equal(uint64(len("mock data")+len("mock")), stats[0].BytesReceived)
+	require.False(stats[0].LastUsed.Before(start))
+
+	require.Equal(BackendStats{Address: idle.Address, Pool: "other"}, stats[1])
+}
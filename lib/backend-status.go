@@ -0,0 +1,68 @@
+package lib
+
+// BackendStatus describes whether a backend can currently be selected,
+// along with its connections and weights.
+type BackendStatus struct {
+	// Address is the address of the backend.
+	Address string `json:"address"`
+
+	// Pool is the pool of the backend.
+	Pool string `json:"pool"`
+
+	// Group is the deployment group of the backend, if any.
+	Group string `json:"group,omitempty"`
+
+	// FailureDomain is the failure domain of the backend, if any.
+	FailureDomain string `json:"failure_domain,omitempty"`
+
+	// Available is set if the backend can be selected for new connections.
+	Available bool `json:"available"`
+
+	// Reason is why the backend cannot be selected, empty if available.
+	Reason SkipReason `json:"reason,omitempty"`
+
+	// Connections is the active connection count of the backend.
+	Connections int64 `json:"connections"`
+
+	// MaxConnections is the connection limit of the backend, zero if
+	// unlimited.
+	MaxConnections int64 `json:"max_connections,omitempty"`
+
+	// Weight is the configured weight of the backend.
+	Weight int `json:"weight"`
+
+	// EffectiveWeight is the weight adjusted by health checks, which is
+	// used for selection.
+	EffectiveWeight int `json:"effective_weight"`
+
+	// ConsecutiveDialFailures is the number of failed dials since the last
+	// successful one.
+	ConsecutiveDialFailures int64 `json:"consecutive_dial_failures"`
+}
+
+// BackendStatuses returns the status of the registered backends, in the
+// order of Backends. A backend is unavailable for the first reason it
+// would be skipped by a selection, ignoring per-client deny entries.
+func (lb *LoadBalancer) BackendStatuses() []BackendStatus {
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+
+	statuses := make([]BackendStatus, len(lb.backends))
+	for i, backend := range lb.backends {
+		_, reason := lb.eligibility(backend)
+		statuses[i] = BackendStatus{
+			Address:                 backend.Address,
+			Pool:                    backend.Pool,
+			Group:                   backend.Group,
+			FailureDomain:           backend.FailureDomain,
+			Available:               reason == "",
+			Reason:                  reason,
+			Connections:             backend.ConnectionCount(),
+			MaxConnections:          backend.MaxConnections,
+			Weight:                  backend.Weight(),
+			EffectiveWeight:         backend.EffectiveWeight(),
+			ConsecutiveDialFailures: backend.ConsecutiveDialFailures(),
+		}
+	}
+	return statuses
+}
@@ -0,0 +1,44 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackendStatuses(t *testing.T) {
+	require := require.New(t)
+
+	lb := NewLoadBalancer(uint64(5), uint64(1))
+	healthy := &Backend{Address: "127.0.0.1:5001", Pool: "web", FailureDomain: "rack-a"}
+	full := &Backend{Address: "127.0.0.1:5002", Pool: "web", MaxConnections: 1}
+	ejected := &Backend{Address: "127.0.0.1:5003", Pool: "web"}
+	legacy := &Backend{Address: "127.0.0.1:5004", Pool: "legacy"}
+	for _, backend := range []*Backend{healthy, full, ejected, legacy} {
+		lb.AddBackend(backend)
+	}
+	healthy.connections.Store(2)
+	full.connections.Store(1)
+	ejected.eject(time.Minute)
+	ejected.consecutiveFailures.Store(3)
+	lb.StartMaintenance("legacy", nil)
+
+	statuses := lb.BackendStatuses()
+	require.Len(statuses, 4)
+	require.Equal(BackendStatus{
+		Address:         "127.0.0.1:5001",
+		Pool:            "web",
+		FailureDomain:   "rack-a",
+		Available:       true,
+		Connections:     2,
+		Weight:          DefaultWeight,
+		EffectiveWeight: DefaultWeight,
+	}, statuses[0])
+	require.Equal(SkipAtCapacity, statuses[1].Reason)
+	require.Equal(int64(1), statuses[1].MaxConnections)
+	require.False(statuses[2].Available)
+	require.Equal(SkipEjected, statuses[2].Reason)
+	require.Equal(int64(3), statuses[2].ConsecutiveDialFailures)
+	require.Equal(SkipMaintenance, statuses[3].Reason)
+}
@@ -0,0 +1,98 @@
+package lib
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"strconv"
+)
+
+// DefaultTLSSessionCacheSize is the default number of TLS sessions
+// cached per backend.
+const DefaultTLSSessionCacheSize = 64
+
+// BackendTLS defines the TLS connections to the backends of a pool.
+type BackendTLS struct {
+	// Config is the TLS configuration of the connections, e.g. with the
+	// CAs verifying the backend certificates and a client certificate.
+	// Its ServerName defaults to the host of the backend address.
+	Config *tls.Config
+
+	// SessionCacheSize is the number of TLS sessions cached per backend
+	// to resume handshakes, which keeps the dial latency of backends low.
+	// Zero means DefaultTLSSessionCacheSize, a negative size disables
+	// resumption.
+	SessionCacheSize int
+}
+
+// WithBackendTLS enables TLS on the connections to the pool's backends.
+// The TLS handshake follows the PROXY protocol header if one is sent.
+// Each backend caches the sessions of its handshakes, so that new
+// connections resume them rather than performing full handshakes.
+func WithBackendTLS(pool string, backendTLS BackendTLS) Option {
+	return func(lb *LoadBalancer) {
+		if backendTLS.Config == nil {
+			return
+		}
+		if lb.backendTLS == nil {
+			lb.backendTLS = make(map[string]BackendTLS)
+		}
+		lb.backendTLS[pool] = backendTLS
+	}
+}
+
+// tlsConfig returns the TLS configuration of the connections to the
+// backend, with the backend's own session cache, creating it from the
+// configuration of its pool on first use.
+func (b *Backend) tlsConfig(backendTLS BackendTLS) *tls.Config {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.tlsClientConfig != nil {
+		return b.tlsClientConfig
+	}
+	config := backendTLS.Config.Clone()
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(b.Address)
+		if err != nil {
+			host = b.Address
+		}
+		config.ServerName = host
+	}
+	config.ClientSessionCache = nil
+	if size := backendTLS.SessionCacheSize; size >= 0 {
+		if size == 0 {
+			size = DefaultTLSSessionCacheSize
+		}
+		config.ClientSessionCache = tls.NewLRUClientSessionCache(size)
+	}
+	b.tlsClientConfig = config
+	return config
+}
+
+// handshakeBackend performs the TLS handshake on the connection to the
+// backend if TLS is enabled for its pool, bounded by the dial timeout,
+// and returns the connection to transfer data on.
+func (lb *LoadBalancer) handshakeBackend(ctx context.Context, backend *Backend, backendConn net.Conn) (net.Conn, error) {
+	backendTLS, ok := lb.backendTLS[backend.Pool]
+	if !ok {
+		return backendConn, nil
+	}
+
+	if lb.dialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, lb.dialTimeout)
+		defer cancel()
+	}
+	tlsConn := tls.Client(backendConn, backend.tlsConfig(backendTLS))
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+
+	resumed := tlsConn.ConnectionState().DidResume
+	lb.metrics.tlsHandshakes.With(backend.Pool, backend.Address, strconv.FormatBool(resumed)).Inc()
+	if tracing(ctx) {
+		trace(ctx, "TLS handshake with backend %s (resumed: %t)", backend.Address, resumed)
+	}
+	return tlsConn, nil
+}
@@ -0,0 +1,90 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+// newTLSBackend starts a TLS backend greeting its clients, and returns
+// its address and the pool of the CA its certificate is issued by.
+func newTLSBackend(t *testing.T) (string, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "backend"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		MinVersion:   tls.VersionTLS13,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("hello"))
+			conn.Close()
+		}
+	}()
+	return listener.Addr().String(), roots
+}
+
+func TestBackendTLS(t *testing.T) {
+	require := require.New(t)
+
+	address, roots := newTLSBackend(t)
+	registry := metrics.NewRegistry()
+	lb := NewLoadBalancer(uint64(5), uint64(5),
+		WithMetrics(metrics.FromRegistry(registry)),
+		WithBackendTLS("secure", BackendTLS{Config: &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS13}}))
+	lb.AddBackend(&Backend{Address: address, Pool: "secure"})
+	allowed := map[string]struct{}{PoolKey("secure"): {}}
+
+	// The second connection resumes the session of the first one
+	for i := 0; i < 2; i++ {
+		clientConn := &mockConn{readBuffer: new(bytes.Buffer), writeBuffer: new(bytes.Buffer)}
+		require.NoError(lb.RouteConnection("client1", clientConn, allowed))
+		require.Equal("hello", clientConn.writeBuffer.String())
+	}
+
+	var buf bytes.Buffer
+	registry.Expose(&buf)
+	exposed := buf.String()
+	require.True(strings.Contains(exposed, `tcplb_backend_tls_handshakes_total{pool="secure",backend="`+address+`",resumed="false"} 1`), exposed)
+	require.True(strings.Contains(exposed, `tcplb_backend_tls_handshakes_total{pool="secure",backend="`+address+`",resumed="true"} 1`), exposed)
+
+	// Backends presenting an untrusted certificate are unreachable
+	lb = NewLoadBalancer(uint64(5), uint64(5), WithBackendTLS("secure", BackendTLS{Config: &tls.Config{}}))
+	lb.AddBackend(&Backend{Address: address, Pool: "secure"})
+	clientConn := &mockConn{readBuffer: new(bytes.Buffer), writeBuffer: new(bytes.Buffer)}
+	require.ErrorIs(lb.RouteConnection("client1", clientConn, allowed), ErrBackendUnreachable)
+}
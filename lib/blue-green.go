@@ -0,0 +1,90 @@
+package lib
+
+import (
+	"fmt"
+	"time"
+)
+
+// inActiveGroup reports whether the backend belongs to the active
+// deployment group of its pool. Backends of pools without an active
+// group, and backends without a group, are always eligible.
+// The caller must hold lb.mu.
+func (lb *LoadBalancer) inActiveGroup(backend *Backend) bool {
+	active, grouped := lb.activeGroups[backend.Pool]
+	return !grouped || backend.Group == "" || backend.Group == active
+}
+
+// SetActiveGroup sets the active deployment group of a pool without
+// draining the backends of other groups. It is meant for the initial
+// configuration; use SwitchPoolGroup to cut over live traffic.
+func (lb *LoadBalancer) SetActiveGroup(pool, group string) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	lb.activeGroups[pool] = group
+}
+
+// ActiveGroup returns the active deployment group of a pool.
+// Returns an empty string if the pool is not grouped.
+func (lb *LoadBalancer) ActiveGroup(pool string) string {
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+
+	return lb.activeGroups[pool]
+}
+
+// SwitchPoolGroup atomically switches new connections of the pool to the
+// backends of the given deployment group. Backends of the other groups
+// stop receiving new connections and their remaining connections are
+// force-closed once the grace period expires, unless the pool was
+// switched back in the meantime. A switch cancels the force-close
+// scheduled by the previous switch of the pool, whose drained backends are
+// drained again with the new grace period if they remain inactive.
+// Returns the backends being drained.
+func (lb *LoadBalancer) SwitchPoolGroup(pool, group string, gracePeriod time.Duration) ([]*Backend, error) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	var draining []*Backend
+	groupFound := false
+	for _, backend := range lb.backends {
+		if backend.Pool != pool || backend.Group == "" {
+			continue
+		}
+		if backend.Group == group {
+			groupFound = true
+			continue
+		}
+		draining = append(draining, backend)
+	}
+	if !groupFound {
+		return nil, fmt.Errorf("pool %s has no backends in group %s", pool, group)
+	}
+
+	lb.activeGroups[pool] = group
+
+	// Force-close the connections left on the drained backends after the
+	// grace period, replacing the force-close of the previous switch
+	if previous, ok := lb.groupDrains[pool]; ok {
+		previous.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(gracePeriod, func() {
+		lb.mu.Lock()
+		defer lb.mu.Unlock()
+
+		// The timer may have fired while being replaced
+		if lb.groupDrains[pool] != timer {
+			return
+		}
+		delete(lb.groupDrains, pool)
+		for _, backend := range draining {
+			if !lb.inActiveGroup(backend) {
+				backend.closeConnections()
+			}
+		}
+	})
+	lb.groupDrains[pool] = timer
+
+	return draining, nil
+}
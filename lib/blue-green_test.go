@@ -0,0 +1,104 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSwitchPoolGroup(t *testing.T) {
+	require := require.New(t)
+
+	blue := &Backend{Address: "127.0.0.1:5001", Pool: "web", Group: "blue"}
+	green := &Backend{Address: "127.0.0.1:5002", Pool: "web", Group: "green"}
+	allowedBackends := map[string]struct{}{
+		blue.Address:  {},
+		green.Address: {},
+	}
+
+	lb := NewLoadBalancer(uint64(5), uint64(1))
+	lb.AddBackend(blue)
+	lb.AddBackend(green)
+	lb.SetActiveGroup("web", "blue")
+
+	t.Run("Select active group only", func(t *testing.T) {
+		b, err := lb.GetBackend(allowedBackends)
+		require.NoError(err)
+		require.Equal(blue.Address, b.Address, "Expected blue backend")
+
+		// Blue has more connections but green is inactive
+		b, err = lb.GetBackend(allowedBackends)
+		require.NoError(err)
+		require.Equal(blue.Address, b.Address, "Expected blue backend")
+	})
+
+	t.Run("Switch to green and drain blue", func(t *testing.T) {
+		closed := blue.closeContext()
+
+		draining, err := lb.SwitchPoolGroup("web", "green", 50*time.Millisecond)
+		require.NoError(err)
+		require.Equal([]*Backend{blue}, draining)
+		require.Equal("green", lb.ActiveGroup("web"))
+
+		b, err := lb.GetBackend(allowedBackends)
+		require.NoError(err)
+		require.Equal(green.Address, b.Address, "Expected green backend")
+
+		select {
+		case <-closed.Done():
+		case <-time.After(time.Second):
+			require.Fail("Expected blue connections to be force-closed")
+		}
+		require.NoError(blue.closeContext().Err(), "Expected new blue connections to be unaffected")
+	})
+
+	t.Run("Unknown group", func(t *testing.T) {
+		_, err := lb.SwitchPoolGroup("web", "red", time.Second)
+		require.Error(err)
+		require.Equal("green", lb.ActiveGroup("web"))
+	})
+}
+
+func TestSwitchPoolGroupBackAndForth(t *testing.T) {
+	require := require.New(t)
+
+	blue := &Backend{Address: "127.0.0.1:5001", Pool: "web", Group: "blue"}
+	green := &Backend{Address: "127.0.0.1:5002", Pool: "web", Group: "green"}
+
+	lb := NewLoadBalancer(uint64(5), uint64(1))
+	lb.AddBackend(blue)
+	lb.AddBackend(green)
+	lb.SetActiveGroup("web", "blue")
+
+	blueClosed := blue.closeContext()
+	greenClosed := green.closeContext()
+
+	// Switching back and forth replaces the pending force-close, so that
+	// the short grace period of the first switch does not close blue
+	// while it is being drained by the last one
+	_, err := lb.SwitchPoolGroup("web", "green", 20*time.Millisecond)
+	require.NoError(err)
+	_, err = lb.SwitchPoolGroup("web", "blue", time.Minute)
+	require.NoError(err)
+	_, err = lb.SwitchPoolGroup("web", "green", 100*time.Millisecond)
+	require.NoError(err)
+
+	lb.mu.RLock()
+	require.Len(lb.groupDrains, 1, "Expected a single pending force-close")
+	lb.mu.RUnlock()
+
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(blueClosed.Err(), "Expected blue to be drained with the last grace period")
+
+	select {
+	case <-blueClosed.Done():
+	case <-time.After(time.Second):
+		require.Fail("Expected blue connections to be force-closed")
+	}
+	require.NoError(greenClosed.Err(), "Expected active green connections to be unaffected")
+
+	lb.mu.RLock()
+	require.Empty(lb.groupDrains, "Expected the fired force-close to be forgotten")
+	lb.mu.RUnlock()
+}
@@ -0,0 +1,80 @@
+package lib
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// PeerVerifier verifies a client certificate during the TLS handshake,
+// after its chains are verified against the trusted CAs. It has the
+// signature of tls.Config.VerifyPeerCertificate, and a returned error
+// aborts the handshake.
+type PeerVerifier func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error
+
+// CertificatePolicy holds constraints on client certificates beyond
+// being signed by a trusted CA, checked during the handshake so that
+// non-compliant clients are rejected before any data is exchanged.
+type CertificatePolicy struct {
+	// ExtKeyUsages are the extended key usages the client certificate
+	// must explicitly list. A certificate without extended key usages
+	// is otherwise accepted for any usage.
+	ExtKeyUsages []x509.ExtKeyUsage
+
+	// PolicyOIDs are the certificate policy OIDs, e.g. "1.3.6.1.4.1.99.1",
+	// of which the client certificate must list at least one.
+	PolicyOIDs []string
+
+	// MaxChainLength is the maximum number of certificates in the
+	// verified chain, including the client certificate and the root.
+	// Zero means unlimited.
+	MaxChainLength int
+}
+
+// Verifier returns a PeerVerifier enforcing the policy. A certificate
+// is accepted if at least one of its verified chains satisfies it.
+func (p CertificatePolicy) Verifier() PeerVerifier {
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		// Whether a certificate is required is up to the TLS client auth type
+		if len(rawCerts) == 0 {
+			return nil
+		}
+		if len(verifiedChains) == 0 {
+			return errors.New("no verified client certificate chain")
+		}
+		var errs []error
+		for _, chain := range verifiedChains {
+			err := p.verifyChain(chain)
+			if err == nil {
+				return nil
+			}
+			errs = append(errs, err)
+		}
+		return fmt.Errorf("client certificate rejected by policy: %w", errors.Join(errs...))
+	}
+}
+
+// verifyChain checks a verified chain, starting with the client certificate.
+func (p CertificatePolicy) verifyChain(chain []*x509.Certificate) error {
+	if p.MaxChainLength > 0 && len(chain) > p.MaxChainLength {
+		return fmt.Errorf("chain length %d exceeds %d", len(chain), p.MaxChainLength)
+	}
+
+	leaf := chain[0]
+	for _, usage := range p.ExtKeyUsages {
+		if !slices.Contains(leaf.ExtKeyUsage, usage) {
+			return fmt.Errorf("missing extended key usage %d", usage)
+		}
+	}
+
+	if len(p.PolicyOIDs) == 0 {
+		return nil
+	}
+	for _, oid := range leaf.PolicyIdentifiers {
+		if slices.Contains(p.PolicyOIDs, oid.String()) {
+			return nil
+		}
+	}
+	return fmt.Errorf("none of the required policies %v", p.PolicyOIDs)
+}
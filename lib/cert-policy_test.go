@@ -0,0 +1,48 @@
+package lib
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertificatePolicy(t *testing.T) {
+	require := require.New(t)
+
+	root := &x509.Certificate{IsCA: true}
+	leaf := &x509.Certificate{
+		ExtKeyUsage:       []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		PolicyIdentifiers: []asn1.ObjectIdentifier{{1, 3, 6, 1, 4, 1, 99, 1}},
+	}
+	chains := [][]*x509.Certificate{{leaf, root}}
+	rawCerts := [][]byte{leaf.Raw}
+
+	// An empty policy only requires a verified chain
+	require.NoError(CertificatePolicy{}.Verifier()(rawCerts, chains))
+	require.Error(CertificatePolicy{}.Verifier()(rawCerts, nil))
+
+	// Clients presenting no certificate are left to the TLS client auth type
+	require.NoError(CertificatePolicy{}.Verifier()(nil, nil))
+
+	policy := CertificatePolicy{
+		ExtKeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		PolicyOIDs:     []string{"1.3.6.1.4.1.99.2", "1.3.6.1.4.1.99.1"},
+		MaxChainLength: 2,
+	}
+	require.NoError(policy.Verifier()(rawCerts, chains))
+
+	longChain := [][]*x509.Certificate{{leaf, &x509.Certificate{IsCA: true}, root}}
+	require.ErrorContains(policy.Verifier()(rawCerts, longChain), "chain length 3 exceeds 2")
+
+	// Any chain satisfying the policy is enough
+	require.NoError(policy.Verifier()(rawCerts, append(longChain, chains...)))
+
+	policy.ExtKeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}
+	require.ErrorContains(policy.Verifier()(rawCerts, chains), "missing extended key usage")
+
+	policy.ExtKeyUsages = nil
+	policy.PolicyOIDs = []string{"1.3.6.1.4.1.99.2"}
+	require.ErrorContains(policy.Verifier()(rawCerts, chains), "none of the required policies")
+}
@@ -0,0 +1,210 @@
+package lib
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/logging"
+)
+
+// ErrUnknownClientCA is returned when removing a client CA bundle that is not trusted.
+var ErrUnknownClientCA = errors.New("unknown client CA bundle")
+
+// ClientCABundle describes a named bundle of trusted client CAs.
+type ClientCABundle struct {
+	// Name identifies the bundle.
+	Name string `json:"name"`
+
+	// Subjects are the subjects of the bundle's certificates.
+	Subjects []string `json:"subjects"`
+
+	// NotAfter is the earliest expiry of the bundle's certificates.
+	NotAfter time.Time `json:"not_after"`
+}
+
+// ClientCAPool holds the CAs trusted to sign client certificates as named
+// bundles, which can be added and removed at runtime. This allows both the
+// old and the new CA to be trusted during a CA rotation, after which the
+// old one is removed, without restarting the server.
+type ClientCAPool struct {
+	// mu ensures concurrent access to bundles.
+	mu sync.Mutex
+
+	// bundles maps a bundle name to its certificates.
+	bundles map[string][]*x509.Certificate
+
+	// pool holds the certificates of all bundles.
+	pool atomic.Pointer[x509.CertPool]
+}
+
+// NewClientCAPool initializes and returns an empty ClientCAPool.
+func NewClientCAPool() *ClientCAPool {
+	p := &ClientCAPool{
+		bundles: make(map[string][]*x509.Certificate),
+	}
+	p.pool.Store(x509.NewCertPool())
+	return p
+}
+
+// Set adds the PEM encoded CA certificates as the named bundle,
+// replacing the certificates previously trusted under that name.
+func (p *ClientCAPool) Set(name string, pemData []byte) error {
+	if name == "" {
+		return errors.New("client CA bundle name is required")
+	}
+	certs, err := parseCertificates(pemData)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.bundles[name] = certs
+	p.rebuild()
+	return nil
+}
+
+// Remove stops trusting the named bundle. The last bundle cannot be
+// removed, as no client could be authenticated anymore.
+func (p *ClientCAPool) Remove(name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, exists := p.bundles[name]; !exists {
+		return fmt.Errorf("%w '%s'", ErrUnknownClientCA, name)
+	}
+	if len(p.bundles) == 1 {
+		return fmt.Errorf("client CA bundle '%s' is the last trusted bundle", name)
+	}
+	delete(p.bundles, name)
+	p.rebuild()
+	return nil
+}
+
+// Bundles returns the trusted bundles sorted by name.
+func (p *ClientCAPool) Bundles() []ClientCABundle {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	bundles := make([]ClientCABundle, 0, len(p.bundles))
+	for name, certs := range p.bundles {
+		bundle := ClientCABundle{Name: name}
+		for _, cert := range certs {
+			bundle.Subjects = append(bundle.Subjects, cert.Subject.String())
+			if bundle.NotAfter.IsZero() || cert.NotAfter.Before(bundle.NotAfter) {
+				bundle.NotAfter = cert.NotAfter
+			}
+		}
+		bundles = append(bundles, bundle)
+	}
+	sort.Slice(bundles, func(i, j int) bool {
+		return bundles[i].Name < bundles[j].Name
+	})
+	return bundles
+}
+
+// CertPool returns the currently trusted CAs.
+func (p *ClientCAPool) CertPool() *x509.CertPool {
+	return p.pool.Load()
+}
+
+// TLSConfig returns a copy of base whose client certificates are verified
+// against the CAs trusted at the time of each handshake.
+func (p *ClientCAPool) TLSConfig(base *tls.Config) *tls.Config {
+	tlsConfig := base.Clone()
+	tlsConfig.ClientCAs = p.CertPool()
+	tlsConfig.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		handshakeConfig := base.Clone()
+		handshakeConfig.ClientCAs = p.CertPool()
+		return handshakeConfig, nil
+	}
+	return tlsConfig
+}
+
+// WatchFile re-reads the CA file every interval until ctx is canceled and
+// replaces the named bundle when the file changes. Read errors are logged
+// and the last known certificates are kept.
+func (p *ClientCAPool) WatchFile(ctx context.Context, name, path string, interval time.Duration) {
+	var modTime time.Time
+	if info, err := os.Stat(path); err == nil {
+		modTime = info.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			logging.Warnf("Unable to stat client CA file %s: %v", path, err)
+			continue
+		}
+		if info.ModTime().Equal(modTime) {
+			continue
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			logging.Warnf("Unable to read client CA file %s: %v", path, err)
+			continue
+		}
+		if err := p.Set(name, data); err != nil {
+			logging.Warnf("Unable to reload client CA file %s: %v", path, err)
+			continue
+		}
+		modTime = info.ModTime()
+		logging.Infof("Reloaded client CA bundle %s from %s", name, path)
+	}
+}
+
+// rebuild replaces the trusted pool with the certificates of all bundles.
+// The caller must hold mu.
+func (p *ClientCAPool) rebuild() {
+	pool := x509.NewCertPool()
+	for _, certs := range p.bundles {
+		for _, cert := range certs {
+			pool.AddCert(cert)
+		}
+	}
+	p.pool.Store(pool)
+}
+
+// parseCertificates parses all the certificates of a PEM bundle.
+func parseCertificates(pemData []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, pemData = pem.Decode(pemData)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse CA certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("unable to parse CA certificate PEM")
+	}
+	return certs, nil
+}
@@ -0,0 +1,65 @@
+package lib
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCA returns a PEM encoded self-signed CA certificate.
+func newTestCA(t *testing.T, commonName string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestClientCAPool(t *testing.T) {
+	require := require.New(t)
+
+	p := NewClientCAPool()
+	require.NoError(p.Set("old", newTestCA(t, "Old CA")))
+	require.Error(p.Set("invalid", []byte("not a certificate")))
+	require.Error(p.Remove("old"), "Expected an error for removing the last bundle")
+
+	tlsConfig := p.TLSConfig(&tls.Config{MinVersion: tls.VersionTLS13})
+	handshakeConfig, err := tlsConfig.GetConfigForClient(nil)
+	require.NoError(err)
+	require.True(handshakeConfig.ClientCAs.Equal(p.CertPool()))
+
+	// Rotate to the new CA
+	require.NoError(p.Set("new", newTestCA(t, "New CA")))
+	bundles := p.Bundles()
+	require.Len(bundles, 2)
+	require.Equal("new", bundles[0].Name)
+	require.Equal([]string{"CN=New CA"}, bundles[0].Subjects)
+
+	require.NoError(p.Remove("old"))
+	require.ErrorIs(p.Remove("old"), ErrUnknownClientCA)
+
+	// Handshakes use the CAs trusted at the time
+	handshakeConfig, err = tlsConfig.GetConfigForClient(nil)
+	require.NoError(err)
+	require.True(handshakeConfig.ClientCAs.Equal(p.CertPool()))
+	require.False(handshakeConfig.ClientCAs.Equal(tlsConfig.ClientCAs))
+}
@@ -0,0 +1,39 @@
+package lib
+
+// MarshalText encodes the close reason as its name, e.g. to use close
+// reasons as JSON object keys.
+func (r CloseReason) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// ProxyInitiated reports whether the connection was ended by the load
+// balancer rather than by a peer, e.g. to measure proxy-caused
+// terminations. Copy errors are not included, as they are mostly caused
+// by a peer resetting its connection.
+func (r CloseReason) ProxyInitiated() bool {
+	switch r {
+	case CloseIdleTimeout, CloseCanceled, CloseDeadline, CloseDrained:
+		return true
+	}
+	return false
+}
+
+// recordClose counts a transfer with the backend that ended for the reason.
+func (lb *LoadBalancer) recordClose(backend *Backend, reason CloseReason) {
+	if reason >= 0 && reason < closeReasonCount {
+		lb.closes[reason].Add(1)
+	}
+	lb.metrics.backendSeries(backend).close(reason).Inc()
+}
+
+// CloseStats returns the number of routed connections that ended per
+// close reason since the start, including reasons without connections,
+// so that embedders can build indicators such as the share of
+// proxy-initiated terminations.
+func (lb *LoadBalancer) CloseStats() map[CloseReason]uint64 {
+	stats := make(map[CloseReason]uint64, closeReasonCount)
+	for reason := CloseReason(0); reason < closeReasonCount; reason++ {
+		stats[reason] = lb.closes[reason].Load()
+	}
+	return stats
+}
@@ -0,0 +1,33 @@
+package lib
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloseStats(t *testing.T) {
+	require := require.New(t)
+
+	lb := NewLoadBalancer(uint64(5), uint64(1))
+	backend := &Backend{Address: "127.0.0.1:5001", Pool: "web"}
+	lb.recordClose(backend, CloseClientEOF)
+	lb.recordClose(backend, CloseClientEOF)
+	lb.recordClose(backend, CloseDrained)
+
+	stats := lb.CloseStats()
+	require.Len(stats, int(closeReasonCount))
+	require.Equal(uint64(2), stats[CloseClientEOF])
+	require.Equal(uint64(1), stats[CloseDrained])
+	require.Zero(stats[CloseIdleTimeout])
+
+	data, err := json.Marshal(map[CloseReason]uint64{CloseDrained: 1})
+	require.NoError(err)
+	require.JSONEq(`{"drained": 1}`, string(data))
+
+	require.True(CloseDrained.ProxyInitiated())
+	require.True(CloseIdleTimeout.ProxyInitiated())
+	require.False(CloseBackendEOF.ProxyInitiated())
+	require.False(CloseCopyError.ProxyInitiated())
+}
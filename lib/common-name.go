@@ -0,0 +1,122 @@
+package lib
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RegexPrefix marks an allowed clients entry holding a regular expression
+// (e.g. "regex:^api-[0-9]+\.example\.com$") rather than a common name.
+const RegexPrefix = "regex:"
+
+// namePattern is a compiled allowed clients wildcard or regex entry.
+type namePattern struct {
+	// pattern is the entry as configured.
+	pattern string
+
+	// re matches the common names covered by the entry.
+	re *regexp.Regexp
+
+	// literals is the number of non-wildcard characters of a wildcard entry.
+	literals int
+
+	// wildcards is the number of wildcards of a wildcard entry.
+	wildcards int
+
+	// allowed is whether matching clients are allowed or denied.
+	allowed bool
+}
+
+// CommonNameMatcher decides whether a client certificate common name is
+// allowed. Entries are exact names, wildcard patterns where "*" matches
+// one or more characters within a single DNS label (e.g.
+// "*.svc.prod.example.com") or regular expressions prefixed with
+// RegexPrefix, which must match the whole name. The first matching entry
+// decides, in a deterministic order of precedence:
+//  1. an exact name;
+//  2. wildcard patterns, the most specific first: more literal characters,
+//     then fewer wildcards, then lexicographic order;
+//  3. regular expressions in lexicographic order.
+//
+// An entry set to false denies matching names, so that a specific name can
+// be excluded from a broader pattern. Names matching no entry are denied.
+type CommonNameMatcher struct {
+	// exact maps an exact common name to whether it is allowed.
+	exact map[string]bool
+
+	// wildcards are the wildcard entries in order of precedence.
+	wildcards []namePattern
+
+	// regexes are the regular expression entries in order of precedence.
+	regexes []namePattern
+}
+
+// NewCommonNameMatcher compiles the allowed clients entries.
+func NewCommonNameMatcher(allowedClients map[string]bool) (*CommonNameMatcher, error) {
+	m := &CommonNameMatcher{
+		exact: make(map[string]bool, len(allowedClients)),
+	}
+
+	for entry, allowed := range allowedClients {
+		if expr, ok := strings.CutPrefix(entry, RegexPrefix); ok {
+			re, err := regexp.Compile("^(?:" + expr + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid allowed client pattern %q: %w", entry, err)
+			}
+			m.regexes = append(m.regexes, namePattern{pattern: entry, re: re, allowed: allowed})
+			continue
+		}
+
+		if !strings.Contains(entry, "*") {
+			m.exact[entry] = allowed
+			continue
+		}
+
+		wildcards := strings.Count(entry, "*")
+		if strings.Contains(entry, "**") {
+			return nil, fmt.Errorf("invalid allowed client pattern %q: consecutive wildcards", entry)
+		}
+		expr := strings.ReplaceAll(regexp.QuoteMeta(entry), `\*`, `[^.]+`)
+		m.wildcards = append(m.wildcards, namePattern{
+			pattern:   entry,
+			re:        regexp.MustCompile("^" + expr + "$"),
+			literals:  len(entry) - wildcards,
+			wildcards: wildcards,
+			allowed:   allowed,
+		})
+	}
+
+	sort.Slice(m.wildcards, func(i, j int) bool {
+		a, b := m.wildcards[i], m.wildcards[j]
+		if a.literals != b.literals {
+			return a.literals > b.literals
+		}
+		if a.wildcards != b.wildcards {
+			return a.wildcards < b.wildcards
+		}
+		return a.pattern < b.pattern
+	})
+	sort.Slice(m.regexes, func(i, j int) bool {
+		return m.regexes[i].pattern < m.regexes[j].pattern
+	})
+
+	return m, nil
+}
+
+// Allowed reports whether the common name is allowed and
+// returns the entry that decided it, if any.
+func (m *CommonNameMatcher) Allowed(commonName string) (bool, string) {
+	if allowed, exists := m.exact[commonName]; exists {
+		return allowed, commonName
+	}
+	for _, patterns := range [][]namePattern{m.wildcards, m.regexes} {
+		for _, p := range patterns {
+			if p.re.MatchString(commonName) {
+				return p.allowed, p.pattern
+			}
+		}
+	}
+	return false, ""
+}
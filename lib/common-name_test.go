@@ -0,0 +1,48 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommonNameMatcher(t *testing.T) {
+	require := require.New(t)
+
+	m, err := NewCommonNameMatcher(map[string]bool{
+		"client1.example.com":              true,
+		"debug.svc.prod.example.com":       false,
+		"*.svc.prod.example.com":           true,
+		"*.prod.example.com":               false,
+		"api-*.svc.prod.example.com":       false,
+		`regex:batch-[0-9]+\.example\.com`: true,
+	})
+	require.NoError(err)
+
+	tests := []struct {
+		commonName string
+		allowed    bool
+		entry      string
+	}{
+		{"client1.example.com", true, "client1.example.com"},
+		{"debug.svc.prod.example.com", false, "debug.svc.prod.example.com"},
+		{"web.svc.prod.example.com", true, "*.svc.prod.example.com"},
+		{"api-1.svc.prod.example.com", false, "api-*.svc.prod.example.com"},
+		{"db.prod.example.com", false, "*.prod.example.com"},
+		{"a.b.svc.prod.example.com", false, ""},
+		{"batch-42.example.com", true, `regex:batch-[0-9]+\.example\.com`},
+		{"xbatch-42.example.com", false, ""},
+		{"unknown.example.com", false, ""},
+	}
+	for _, tt := range tests {
+		allowed, entry := m.Allowed(tt.commonName)
+		require.Equal(tt.allowed, allowed, tt.commonName)
+		require.Equal(tt.entry, entry, tt.commonName)
+	}
+
+	_, err = NewCommonNameMatcher(map[string]bool{"regex:(": true})
+	require.Error(err, "Expected an error for an invalid regex")
+
+	_, err = NewCommonNameMatcher(map[string]bool{"**.example.com": true})
+	require.Error(err, "Expected an error for consecutive wildcards")
+}
@@ -0,0 +1,31 @@
+package lib
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// connectionIDKey is the context key of the connection ID.
+type connectionIDKey struct{}
+
+// NewConnectionID generates a random connection ID
+// used to correlate a connection across logs and systems.
+func NewConnectionID() string {
+	var b [8]byte
+	// crypto/rand.Read never returns an error
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// WithConnectionID returns a copy of ctx carrying the connection ID.
+func WithConnectionID(ctx context.Context, connectionID string) context.Context {
+	return context.WithValue(ctx, connectionIDKey{}, connectionID)
+}
+
+// ConnectionIDFromContext returns the connection ID carried by ctx.
+// Returns an empty string if ctx carries none.
+func ConnectionIDFromContext(ctx context.Context) string {
+	connectionID, _ := ctx.Value(connectionIDKey{}).(string)
+	return connectionID
+}
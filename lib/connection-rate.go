@@ -0,0 +1,226 @@
+package lib
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// rateWindows are the windows of the rolling connection rates.
+var rateWindows = [...]time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute, time.Hour}
+
+// RateStats describes the connection rate of a client.
+type RateStats struct {
+	// Total is the number of connections since the start,
+	// or since the statistics were reset.
+	Total uint64 `json:"total"`
+
+	// Rate1m, Rate5m, Rate15m and Rate1h are the exponentially weighted
+	// moving averages of the connections per second over 1, 5 and 15
+	// minutes and 1 hour, the latter being the client's baseline.
+	Rate1m  float64 `json:"rate_1m"`
+	Rate5m  float64 `json:"rate_5m"`
+	Rate15m float64 `json:"rate_15m"`
+	Rate1h  float64 `json:"rate_1h"`
+
+	// PeakPerSecond is the highest number of connections in one second.
+	PeakPerSecond uint64 `json:"peak_per_second"`
+
+	// PeakAt is the second of the peak.
+	PeakAt time.Time `json:"peak_at"`
+
+	// Closed is the number of closed connections.
+	Closed uint64 `json:"closed"`
+
+	// MeanLifetime is the mean lifetime of the closed connections. Clients
+	// reusing their connections keep them open for long, while clients
+	// reconnecting for every request close them right away.
+	MeanLifetime time.Duration `json:"mean_lifetime_ns"`
+
+	// ResetAt is the time the statistics were last reset.
+	// Nil if they count since the start.
+	ResetAt *time.Time `json:"reset_at,omitempty"`
+}
+
+// rateCounter counts connections per second and folds every elapsed
+// second into the rolling rates.
+type rateCounter struct {
+	// second is the Unix second being counted.
+	second int64
+
+	// count is the number of connections in the second being counted.
+	count uint64
+
+	// rates are the rolling rates of each window in rateWindows.
+	rates [len(rateWindows)]float64
+
+	// total is the number of connections since the start.
+	total uint64
+
+	// peak is the highest number of connections in an elapsed second.
+	peak uint64
+
+	// peakSecond is the Unix second of the peak.
+	peakSecond int64
+
+	// closed is the number of closed connections.
+	closed uint64
+
+	// lifetime is the sum of the lifetimes of the closed connections.
+	lifetime time.Duration
+
+	// resetAt is the time the counter was reset. Zero if it never was.
+	resetAt time.Time
+}
+
+// advance folds the elapsed seconds up to now into the rolling rates.
+func (c *rateCounter) advance(now time.Time) {
+	second := now.Unix()
+	elapsed := second - c.second
+	if elapsed <= 0 {
+		return
+	}
+
+	if c.count > c.peak {
+		c.peak = c.count
+		c.peakSecond = c.second
+	}
+	for i, window := range rateWindows {
+		decay := math.Exp(-1 / window.Seconds())
+		// Fold the counted second, then the seconds without connections
+		rate := c.rates[i]*decay + float64(c.count)*(1-decay)
+		c.rates[i] = rate * math.Pow(decay, float64(elapsed-1))
+	}
+	c.second = second
+	c.count = 0
+}
+
+// record counts a connection at the given time.
+func (c *rateCounter) record(now time.Time) {
+	c.advance(now)
+	c.count++
+	c.total++
+}
+
+// stats returns the rates of the counter at the given time. The second
+// being counted is included in the peak but not in the rolling rates.
+func (c *rateCounter) stats(now time.Time) RateStats {
+	c.advance(now)
+	stats := RateStats{
+		Total:         c.total,
+		Rate1m:        c.rates[0],
+		Rate5m:        c.rates[1],
+		Rate15m:       c.rates[2],
+		Rate1h:        c.rates[3],
+		PeakPerSecond: c.peak,
+		PeakAt:        time.Unix(c.peakSecond, 0),
+		Closed:        c.closed,
+	}
+	if c.closed > 0 {
+		stats.MeanLifetime = c.lifetime / time.Duration(c.closed)
+	}
+	if c.count > stats.PeakPerSecond {
+		stats.PeakPerSecond = c.count
+		stats.PeakAt = time.Unix(c.second, 0)
+	}
+	if !c.resetAt.IsZero() {
+		resetAt := c.resetAt
+		stats.ResetAt = &resetAt
+	}
+	return stats
+}
+
+// RateTracker tracks the rolling and peak connection rates per key,
+// e.g. per client, so that capacity planning is based on observed data.
+type RateTracker struct {
+	// mu ensures concurrent access to the counters.
+	mu sync.Mutex
+
+	// counters maps a key to its counter.
+	counters map[string]*rateCounter
+}
+
+// NewRateTracker initializes and returns a new RateTracker.
+func NewRateTracker() *RateTracker {
+	return &RateTracker{
+		counters: make(map[string]*rateCounter),
+	}
+}
+
+// Record counts a connection of the key.
+func (t *RateTracker) Record(key string) {
+	t.record(key, time.Now())
+}
+
+// RecordClose counts a closed connection of the key, open for lifetime.
+func (t *RateTracker) RecordClose(key string, lifetime time.Duration) {
+	t.recordClose(key, lifetime, time.Now())
+}
+
+// Stats returns the connection rates of every key.
+func (t *RateTracker) Stats() map[string]RateStats {
+	return t.stats(time.Now())
+}
+
+// Reset clears the statistics of the key, or of every key if empty, so
+// that they are compared from a known point in time, e.g. before and after
+// a change. Returns the number of keys reset.
+func (t *RateTracker) Reset(key string) int {
+	return t.reset(key, time.Now())
+}
+
+// reset clears the statistics of the key, or of every key if empty,
+// at the given time.
+func (t *RateTracker) reset(key string, now time.Time) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	reset := 0
+	for k := range t.counters {
+		if key == "" || k == key {
+			t.counters[k] = &rateCounter{second: now.Unix(), resetAt: now}
+			reset++
+		}
+	}
+	return reset
+}
+
+// record counts a connection of the key at the given time.
+func (t *RateTracker) record(key string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c, ok := t.counters[key]
+	if !ok {
+		c = &rateCounter{second: now.Unix()}
+		t.counters[key] = c
+	}
+	c.record(now)
+}
+
+// recordClose counts a closed connection of the key at the given time.
+// Connections opened before the statistics were reset are counted too.
+func (t *RateTracker) recordClose(key string, lifetime time.Duration, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c, ok := t.counters[key]
+	if !ok {
+		c = &rateCounter{second: now.Unix()}
+		t.counters[key] = c
+	}
+	c.closed++
+	c.lifetime += lifetime
+}
+
+// stats returns the connection rates of every key at the given time.
+func (t *RateTracker) stats(now time.Time) map[string]RateStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := make(map[string]RateStats, len(t.counters))
+	for key, c := range t.counters {
+		stats[key] = c.stats(now)
+	}
+	return stats
+}
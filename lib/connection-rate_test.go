@@ -0,0 +1,83 @@
+package lib
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateTracker(t *testing.T) {
+	require := require.New(t)
+
+	tracker := NewRateTracker()
+	start := time.Unix(1700000000, 0)
+
+	// A burst of 5 connections in the first second
+	for i := 0; i < 5; i++ {
+		tracker.record("client1", start.Add(time.Duration(i)*100*time.Millisecond))
+	}
+	stats := tracker.stats(start.Add(500 * time.Millisecond))["client1"]
+	require.Equal(uint64(5), stats.Total)
+	require.Equal(uint64(5), stats.PeakPerSecond, "Expected the current second in the peak")
+	require.Zero(stats.Rate1m, "Expected the current second out of the rates")
+
+	// One connection per second for 15 minutes
+	for i := 1; i <= 900; i++ {
+		tracker.record("client1", start.Add(time.Duration(i)*time.Second))
+	}
+	stats = tracker.stats(start.Add(901 * time.Second))["client1"]
+	require.Equal(uint64(905), stats.Total)
+	require.Equal(uint64(5), stats.PeakPerSecond)
+	require.Equal(start, stats.PeakAt)
+	require.InDelta(1, stats.Rate1m, 0.01)
+	require.InDelta(1, stats.Rate5m, 0.05)
+	require.Greater(stats.Rate15m, 0.6)
+	require.Greater(stats.Rate1h, 0.2)
+	require.Less(stats.Rate1h, stats.Rate15m)
+
+	// The rates decay while idle, the shorter windows faster
+	stats = tracker.stats(start.Add(961 * time.Second))["client1"]
+	require.InDelta(1/math.E, stats.Rate1m, 0.01)
+	require.InDelta(1*math.Exp(-60.0/300), stats.Rate5m, 0.05)
+
+	_, ok := tracker.stats(start)["client2"]
+	require.False(ok)
+	require.Nil(stats.ResetAt)
+
+	// Resetting clears the totals and records the time
+	tracker.record("client2", start.Add(961*time.Second))
+	resetAt := start.Add(962 * time.Second)
+	require.Zero(tracker.reset("client3", resetAt))
+	require.Equal(1, tracker.reset("client1", resetAt))
+	tracker.record("client1", start.Add(963*time.Second))
+
+	all := tracker.stats(start.Add(964 * time.Second))
+	require.Equal(uint64(1), all["client1"].Total)
+	require.Equal(uint64(1), all["client1"].PeakPerSecond)
+	require.Less(all["client1"].Rate15m, 0.01, "Expected the rates to restart")
+	require.Equal(&resetAt, all["client1"].ResetAt)
+	require.Equal(uint64(1), all["client2"].Total, "Expected other clients to be kept")
+
+	require.Equal(2, tracker.reset("", resetAt))
+}
+
+func TestRateTrackerLifetimes(t *testing.T) {
+	require := require.New(t)
+
+	tracker := NewRateTracker()
+	start := time.Unix(1700000000, 0)
+	require.Zero(tracker.stats(start)["client1"].MeanLifetime)
+
+	tracker.record("client1", start)
+	tracker.record("client1", start)
+	tracker.recordClose("client1", time.Second, start)
+	tracker.recordClose("client1", 3*time.Second, start)
+	stats := tracker.stats(start)["client1"]
+	require.Equal(uint64(2), stats.Closed)
+	require.Equal(2*time.Second, stats.MeanLifetime)
+
+	tracker.reset("client1", start)
+	require.Zero(tracker.stats(start)["client1"].Closed)
+}
@@ -0,0 +1,110 @@
+package lib
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// connectionRegistry holds the active connections routed or dialed to a
+// backend, and its leases, against which its connection count is
+// reconciled.
+type connectionRegistry struct {
+	// mu ensures concurrent access to conns.
+	mu sync.Mutex
+
+	// conns are the active connections, either a net.Conn or a
+	// *BackendLease. Nil until the first one.
+	conns map[any]struct{}
+}
+
+// add registers an active connection.
+func (r *connectionRegistry) add(conn any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.conns == nil {
+		r.conns = make(map[any]struct{})
+	}
+	r.conns[conn] = struct{}{}
+}
+
+// remove unregisters an ended connection.
+func (r *connectionRegistry) remove(conn any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.conns, conn)
+}
+
+// count returns the number of active connections.
+func (r *connectionRegistry) count() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return int64(len(r.conns))
+}
+
+// ReconcileConnections cross-checks the connection count of every
+// registered backend against its registered active connections every
+// interval until ctx is canceled, and corrects the count if they differ,
+// so that an accounting bug, e.g. a leaked increment, does not skew
+// least-connections selection or connection limits for good.
+//
+// Connections are registered right after their backend is reserved and
+// unregistered right before it is released, so a count may momentarily
+// be ahead of the registry. A difference is therefore only corrected once
+// it is observed twice in a row with the same value.
+//
+// Connections counted with GetBackend are not registered, and are
+// corrected away. As counts are clamped at zero, releasing them afterwards
+// does not drive the count negative. Embedders reserving backends while
+// reconciling use LeaseBackend instead, whose leases are registered.
+func (lb *LoadBalancer) ReconcileConnections(ctx context.Context, interval time.Duration) {
+	var drifts map[*Backend]int64
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		drifts = lb.reconcileConnections(drifts)
+	}
+}
+
+// reconcileConnections corrects the connection count of the backends
+// whose difference with their registered connections is the same as in
+// previous, the differences observed by the last pass, and returns the
+// differences observed but not corrected. Removed backends are forgotten.
+func (lb *LoadBalancer) reconcileConnections(previous map[*Backend]int64) map[*Backend]int64 {
+	drifts := make(map[*Backend]int64)
+	for _, backend := range lb.Backends() {
+		counted := backend.ConnectionCount()
+		registered := backend.registry.count()
+		drift := counted - registered
+		if drift == 0 {
+			continue
+		}
+		if previous[backend] != drift {
+			drifts[backend] = drift
+			continue
+		}
+
+		lb.logger.Warnf("Backend %s of pool %s counts %d active connections while %d are registered, correcting its count by %d",
+			backend.Address, backend.Pool, counted, registered, -drift)
+		lb.mu.RLock()
+		backend.adjustConnections(-drift)
+		lb.mu.RUnlock()
+		lb.metrics.connectionCorrections.With(backend.Pool, backend.Address).Add(max(drift, -drift))
+
+		// Wake up queued connections waiting for the capacity freed up
+		if drift > 0 && lb.queues != nil {
+			lb.queues.notify(backend.Pool)
+		}
+	}
+	return drifts
+}
@@ -0,0 +1,108 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/rrasulzade/tcp-lb-go/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectionRegistry(t *testing.T) {
+	require := require.New(t)
+
+	lb := NewLoadBalancer(uint64(5), uint64(1))
+	lb.dialer = &mockDialer{}
+	backend := &Backend{Address: "127.0.0.1:5001", Pool: "api"}
+	lb.AddBackend(backend)
+
+	// Dialed connections are registered until closed
+	conn, err := lb.DialContext(context.Background(), "api")
+	require.NoError(err)
+	require.Equal(int64(1), backend.registry.count())
+	require.Empty(lb.reconcileConnections(nil))
+
+	require.NoError(conn.Close())
+	require.Equal(int64(0), backend.registry.count())
+	require.Empty(lb.reconcileConnections(nil))
+
+	// Routed connections are unregistered once routing returns
+	clientMockConn := &mockConn{readBuffer: new(bytes.Buffer), writeBuffer: new(bytes.Buffer)}
+	require.NoError(lb.RouteConnection("client1", clientMockConn, map[string]struct{}{backend.Address: {}}))
+	require.Equal(int64(0), backend.registry.count())
+	require.Equal(int64(0), backend.ConnectionCount())
+}
+
+func TestReconcileConnections(t *testing.T) {
+	require := require.New(t)
+
+	registry := metrics.NewRegistry()
+	lb := NewLoadBalancer(uint64(5), uint64(1), WithMetrics(metrics.FromRegistry(registry)))
+	lb.dialer = &mockDialer{}
+	leaked := &Backend{Address: "127.0.0.1:5001", Pool: "api"}
+	underrun := &Backend{Address: "127.0.0.1:5002", Pool: "api"}
+	lb.AddBackend(leaked)
+	lb.AddBackend(underrun)
+
+	conn, err := lb.DialContext(WithRateLimitKey(context.Background(), "job1"), "api")
+	require.NoError(err)
+	defer conn.Close()
+	connected := conn.(*dialedConn).backend
+	other := leaked
+	if connected == leaked {
+		other = underrun
+	}
+
+	// A difference is only corrected once observed twice with the same value
+	connected.connections.Add(2)
+	other.connections.Add(-1)
+	drifts := lb.reconcileConnections(nil)
+	require.Equal(map[*Backend]int64{connected: 2, other: -1}, drifts)
+	require.Equal(int64(3), connected.ConnectionCount())
+
+	connected.connections.Add(1)
+	drifts = lb.reconcileConnections(drifts)
+	require.Equal(map[*Backend]int64{connected: 3}, drifts)
+	require.Equal(int64(0), other.ConnectionCount())
+
+	drifts = lb.reconcileConnections(drifts)
+	require.Empty(drifts)
+	require.Equal(int64(1), connected.ConnectionCount())
+	var buf bytes.Buffer
+	registry.Expose(&buf)
+	require.Contains(buf.String(), `tcplb_backend_connection_corrections_total{pool="api",backend="`+connected.Address+`"} 3`)
+	require.Contains(buf.String(), `tcplb_backend_connection_corrections_total{pool="api",backend="`+other.Address+`"} 1`)
+
+	// Closing the connection leaves no difference
+	require.NoError(conn.Close())
+	require.Empty(lb.reconcileConnections(nil))
+	require.Equal(int64(0), connected.ConnectionCount())
+}
+
+func TestReconcileGetBackend(t *testing.T) {
+	require := require.New(t)
+
+	lb := NewLoadBalancer(uint64(5), uint64(1))
+	backend := &Backend{Address: "127.0.0.1:5001", Pool: "api"}
+	lb.AddBackend(backend)
+
+	// A reservation of GetBackend is not registered and is corrected away
+	selected, err := lb.GetBackend(map[string]struct{}{PoolKey("api"): {}})
+	require.NoError(err)
+	require.Equal(backend, selected)
+	drifts := lb.reconcileConnections(nil)
+	require.Equal(map[*Backend]int64{backend: 1}, drifts)
+	require.Empty(lb.reconcileConnections(drifts))
+	require.Equal(int64(0), backend.ConnectionCount())
+
+	// Releasing it afterwards does not drive the count negative
+	selected.decrementConnections()
+	require.Equal(int64(0), backend.ConnectionCount())
+	require.Empty(lb.reconcileConnections(nil))
+
+	// Later reservations are counted as usual
+	_, err = lb.GetBackend(map[string]struct{}{PoolKey("api"): {}})
+	require.NoError(err)
+	require.Equal(int64(1), backend.ConnectionCount())
+}
@@ -0,0 +1,33 @@
+package lib
+
+import "context"
+
+// ConnectionReport describes how a connection was routed. The load
+// balancer fills in the report carried by the context of the connection
+// as it is routed, for the caller to read once routing returns.
+type ConnectionReport struct {
+	// Backend and Pool identify the selected backend, blank if no
+	// backend was selected.
+	Backend string
+	Pool    string
+
+	// Transferred reports whether the transfer with the backend started
+	// and ended, for the given reason.
+	Transferred bool
+	Reason      CloseReason
+}
+
+// connectionReportKey is the context key of the connection report.
+type connectionReportKey struct{}
+
+// WithConnectionReport returns a copy of ctx carrying the report, filled
+// in as the connection routed with ctx is routed.
+func WithConnectionReport(ctx context.Context, report *ConnectionReport) context.Context {
+	return context.WithValue(ctx, connectionReportKey{}, report)
+}
+
+// connectionReport returns the report carried by ctx, nil if none.
+func connectionReport(ctx context.Context) *ConnectionReport {
+	report, _ := ctx.Value(connectionReportKey{}).(*ConnectionReport)
+	return report
+}
@@ -0,0 +1,99 @@
+package lib
+
+import (
+	"context"
+	"math"
+)
+
+// BalancingStrategy defines how a backend is selected among the eligible
+// allowed backends.
+type BalancingStrategy string
+
+// define balancing strategies.
+const (
+	// BalanceLeastConnections selects the backend with the fewest active
+	// connections relative to its weight.
+	BalanceLeastConnections BalancingStrategy = "least_connections"
+
+	// BalanceConsistentHash selects the backend by rendezvous hashing of
+	// the connection's hash key, so that a client lands on the same
+	// backend across connections, e.g. for backends keeping per-client
+	// state in memory. Backends receive keys in proportion to their
+	// weight, and only the keys of a backend leaving the eligible ones
+	// move to other backends. Connections without a hash key fall back
+	// to BalanceLeastConnections.
+	BalanceConsistentHash BalancingStrategy = "consistent_hash"
+)
+
+// WithBalancing sets the balancing strategy. Defaults to
+// BalanceLeastConnections.
+func WithBalancing(strategy BalancingStrategy) Option {
+	return func(lb *LoadBalancer) {
+		lb.balancing = strategy
+	}
+}
+
+// ConsistentHashing reports whether backends are selected by consistent
+// hashing, see BalanceConsistentHash.
+func (lb *LoadBalancer) ConsistentHashing() bool {
+	return lb.balancing == BalanceConsistentHash
+}
+
+// hashKeyKey is the context key of the consistent hashing key.
+type hashKeyKey struct{}
+
+// WithHashKey returns a copy of ctx carrying the key the connection is
+// consistently hashed on, e.g. the client's IP address, instead of its
+// client ID.
+func WithHashKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, hashKeyKey{}, key)
+}
+
+// hashKey returns the consistent hashing key carried by ctx, or clientID
+// if ctx carries none. Returns an empty key unless consistent hashing is
+// enabled.
+func (lb *LoadBalancer) hashKey(ctx context.Context, clientID string) string {
+	if !lb.ConsistentHashing() {
+		return ""
+	}
+	if key, ok := ctx.Value(hashKeyKey{}).(string); ok {
+		return key
+	}
+	return clientID
+}
+
+// define FNV-1a 64-bit parameters.
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+// fnv64a hashes s with FNV-1a, continuing from h. Unlike hash/maphash,
+// the hash is stable across processes, so that load balancer instances
+// and restarts agree on the backend of a key.
+func fnv64a(h uint64, s string) uint64 {
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= fnvPrime64
+	}
+	return h
+}
+
+// rendezvousScore returns the weighted rendezvous hashing score of a
+// backend for a key hashed with fnv64a. The eligible backend with the
+// highest score is selected.
+func rendezvousScore(keyHash uint64, address string, weight int64) float64 {
+	// Separate the key from the address with a zero byte
+	h := fnv64a(keyHash*fnvPrime64, address)
+
+	// Finalize so that similar addresses spread uniformly
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+
+	// Map to (0, 1) and weigh, see "Weighted distributed hash tables"
+	u := (float64(h>>11) + 0.5) / (1 << 53)
+	return -float64(weight) / math.Log(u)
+}
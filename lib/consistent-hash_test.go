@@ -0,0 +1,93 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsistentHash(t *testing.T) {
+	require := require.New(t)
+
+	newLB := func(weights ...int) (*LoadBalancer, []*Backend) {
+		lb := NewLoadBalancer(uint64(5), uint64(1), WithBalancing(BalanceConsistentHash))
+		backends := make([]*Backend, len(weights))
+		for i, weight := range weights {
+			backends[i] = &Backend{Address: fmt.Sprintf("127.0.0.1:500%d", i), Pool: "web", InitialWeight: weight}
+			lb.AddBackend(backends[i])
+		}
+		return lb, backends
+	}
+	web := map[string]struct{}{PoolKey("web"): {}}
+	selectKey := func(lb *LoadBalancer, key string) *Backend {
+		backend, err := lb.getBackend(key, nil, web)
+		require.NoError(err)
+		backend.decrementConnections()
+		return backend
+	}
+
+	t.Run("Same key lands on the same backend", func(t *testing.T) {
+		lb, _ := newLB(100, 100, 100)
+		first := selectKey(lb, "client1")
+		first.incrementConnections()
+		first.incrementConnections()
+		for i := 0; i < 10; i++ {
+			require.Equal(first, selectKey(lb, "client1"), "Expected the key to ignore connection counts")
+		}
+	})
+
+	t.Run("Keys spread by weight", func(t *testing.T) {
+		lb, backends := newLB(100, 300)
+		counts := make(map[*Backend]int)
+		for i := 0; i < 4000; i++ {
+			counts[selectKey(lb, fmt.Sprintf("client%d", i))]++
+		}
+		require.InDelta(1000, counts[backends[0]], 150)
+		require.InDelta(3000, counts[backends[1]], 150)
+	})
+
+	t.Run("Only the keys of an ejected backend move", func(t *testing.T) {
+		lb, backends := newLB(100, 100, 100, 100)
+		before := make(map[string]*Backend)
+		for i := 0; i < 1000; i++ {
+			key := fmt.Sprintf("client%d", i)
+			before[key] = selectKey(lb, key)
+		}
+
+		backends[2].eject(time.Minute)
+		for key, backend := range before {
+			after := selectKey(lb, key)
+			if backend == backends[2] {
+				require.NotEqual(backends[2], after)
+			} else {
+				require.Equal(backend, after, "Expected key %s to stay on its backend", key)
+			}
+		}
+	})
+
+	t.Run("Connections without key use least connections", func(t *testing.T) {
+		lb, backends := newLB(100, 100)
+		backends[0].incrementConnections()
+		require.Equal(backends[1], selectKey(lb, ""))
+	})
+
+	t.Run("Route by the context hash key", func(t *testing.T) {
+		lb, _ := newLB(100, 100, 100)
+		require.Equal("client1", lb.hashKey(context.Background(), "client1"))
+		require.Equal("10.0.0.1", lb.hashKey(WithHashKey(context.Background(), "10.0.0.1"), "client1"))
+
+		leastConnections := NewLoadBalancer(uint64(5), uint64(1))
+		require.Empty(leastConnections.hashKey(context.Background(), "client1"))
+	})
+
+	t.Run("Explain agrees with the selection", func(t *testing.T) {
+		lb, _ := newLB(100, 200, 300)
+		for i := 0; i < 20; i++ {
+			key := fmt.Sprintf("client%d", i)
+			require.Equal(selectKey(lb, key).Address, lb.ExplainSelection(key, web).Selected)
+		}
+	})
+}
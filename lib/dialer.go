@@ -0,0 +1,154 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// DialContext connects to a backend of the pool selected as for a routed
+// connection, for client-side load balancing of outbound connections
+// without running the proxy server: the connection is rate limited, waits
+// in the admission queue if all backends are at capacity, goes through the
+// pool's TLS handshake and counts against the backend until it is closed.
+// Its dial outcome and latency feed the health checks and latency-aware
+// balancing. No PROXY protocol header is sent.
+//
+// Connections are rate limited by the pool, or by the key set with
+// WithRateLimitKey, and consistently hashed on the key set with
+// WithHashKey. The connection is closed when the backend's connections
+// are force-closed or its maximum lifetime is reached. The dial itself is
+// bounded by the dial timeout rather than ctx.
+func (lb *LoadBalancer) DialContext(ctx context.Context, pool string) (net.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	key := rateLimitKey(ctx, pool)
+	if !lb.rateLimiter.allowConnection(key) {
+		trace(ctx, "rate limited by key %s", key)
+		return nil, ErrRateLimitReached
+	}
+
+	allowed := map[string]struct{}{PoolKey(pool): {}}
+	backend, err := lb.acquireBackend(ctx, lb.hashKey(ctx, ""), nil, allowed)
+	if err != nil {
+		trace(ctx, "no backend selected: %v", err)
+		return nil, err
+	}
+	backendConnections := lb.metrics.backendSeries(backend).connections
+	backendConnections.Inc()
+	backend.recordUse()
+	conn := &dialedConn{backend: backend}
+	conn.release = func() {
+		backend.registry.remove(conn)
+		lb.mu.RLock()
+		backend.decrementConnections()
+		lb.mu.RUnlock()
+		backendConnections.Dec()
+		backend.lastUsed.Store(time.Now().UnixNano())
+
+		// Wake up queued connections waiting for capacity
+		if lb.queues != nil {
+			lb.queues.notify(backend.Pool)
+		}
+	}
+	backend.registry.add(conn)
+
+	dialStart := time.Now()
+	backendConn, err := lb.dialer.Dial("tcp", backend.Address)
+	lb.recordDial(backend, time.Since(dialStart), err)
+	if tracing(ctx) {
+		trace(ctx, "dialed backend %s in %s (err: %v)", backend.Address, time.Since(dialStart), err)
+	}
+	if err != nil {
+		conn.release()
+		lb.metrics.dialErrors.With(backend.Pool, backend.Address).Inc()
+		return nil, fmt.Errorf("%w: %w", ErrBackendUnreachable, err)
+	}
+	conn.Conn, err = lb.handshakeBackend(ctx, backend, backendConn)
+	if err != nil {
+		backendConn.Close()
+		conn.release()
+		lb.metrics.dialErrors.With(backend.Pool, backend.Address).Inc()
+		return nil, fmt.Errorf("%w: TLS handshake: %w", ErrBackendUnreachable, err)
+	}
+
+	backend.dialLatency.observe(time.Since(dialStart))
+	if lb.latencyObserver != nil {
+		lb.latencyObserver(backend, LatencyDial, time.Since(dialStart))
+	}
+
+	// Close the connection once the backend's connections are
+	// force-closed or its maximum lifetime is reached, leaving the
+	// release of the backend to the caller's Close
+	closeCtx, cancel := backend.closeContext(), context.CancelFunc(func() {})
+	if lb.maxLifetime > 0 {
+		closeCtx, cancel = context.WithTimeout(closeCtx, lb.maxLifetime)
+	}
+	stop := context.AfterFunc(closeCtx, func() { conn.Conn.Close() })
+	conn.stop = func() {
+		stop()
+		cancel()
+	}
+	return conn, nil
+}
+
+// Dialer returns a dial function connecting to the backends of the pool
+// through DialContext, e.g. for http.Transport.DialContext or
+// grpc.WithContextDialer. The address is ignored, as the pool selects the
+// backend, and only TCP networks are supported.
+func (lb *LoadBalancer) Dialer(pool string) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		switch network {
+		case "tcp", "tcp4", "tcp6":
+			return lb.DialContext(ctx, pool)
+		}
+		return nil, fmt.Errorf("unsupported network '%s'", network)
+	}
+}
+
+// dialedConn is a connection returned by DialContext, which counts the
+// bytes transferred with its backend and releases it once closed.
+type dialedConn struct {
+	net.Conn
+
+	// backend is the backend the connection is established with.
+	backend *Backend
+
+	// release decrements the connection count of the backend.
+	release func()
+
+	// stop stops closing the connection when its backend's
+	// connections are force-closed or its lifetime is reached.
+	stop func()
+
+	// closeOnce ensures the backend is released once.
+	closeOnce sync.Once
+}
+
+// Read implements net.Conn.
+func (c *dialedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.backend.bytesReceived.Add(uint64(n))
+	return n, err
+}
+
+// Write implements net.Conn.
+func (c *dialedConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.backend.bytesSent.Add(uint64(n))
+	return n, err
+}
+
+// Close closes the connection and releases its backend.
+func (c *dialedConn) Close() error {
+	err := net.ErrClosed
+	c.closeOnce.Do(func() {
+		c.stop()
+		err = c.Conn.Close()
+		c.release()
+	})
+	return err
+}
@@ -0,0 +1,87 @@
+package lib
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialContext(t *testing.T) {
+	require := require.New(t)
+
+	lb := NewLoadBalancer(uint64(2), uint64(1))
+	lb.dialer = &mockDialer{}
+	backend1 := &Backend{Address: "127.0.0.1:5001", Pool: "api"}
+	backend2 := &Backend{Address: "127.0.0.1:5002", Pool: "api"}
+	other := &Backend{Address: "127.0.0.1:5003", Pool: "other"}
+	lb.AddBackend(backend1)
+	lb.AddBackend(backend2)
+	lb.AddBackend(other)
+
+	// Connections are spread over the pool's backends and count against
+	// them until closed
+	conn1, err := lb.DialContext(context.Background(), "api")
+	require.NoError(err)
+	conn2, err := lb.DialContext(context.Background(), "api")
+	require.NoError(err)
+	require.Equal(int64(1), backend1.ConnectionCount())
+	require.Equal(int64(1), backend2.ConnectionCount())
+	require.Equal(int64(0), other.ConnectionCount())
+
+	require.NoError(conn1.Close())
+	require.ErrorIs(conn1.Close(), net.ErrClosed)
+	require.NoError(conn2.Close())
+	require.Equal(int64(0), backend1.ConnectionCount())
+	require.Equal(int64(0), backend2.ConnectionCount())
+
+	// Connections are rate limited by pool
+	_, err = lb.DialContext(context.Background(), "api")
+	require.ErrorIs(err, ErrRateLimitReached)
+	conn, err := lb.DialContext(WithRateLimitKey(context.Background(), "job1"), "api")
+	require.NoError(err)
+	conn.Close()
+
+	_, err = lb.DialContext(context.Background(), "unknown")
+	require.ErrorIs(err, ErrNoAvailableBackend)
+
+	// Unsupported networks are rejected by the dial function
+	_, err = lb.Dialer("other")(context.Background(), "udp", "ignored:53")
+	require.Error(err)
+}
+
+func TestDialContextMaxLifetime(t *testing.T) {
+	require := require.New(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	lb := NewLoadBalancer(uint64(5), uint64(5), WithMaxLifetime(50*time.Millisecond))
+	backend := &Backend{Address: listener.Addr().String(), Pool: "api"}
+	lb.AddBackend(backend)
+
+	conn, err := lb.Dialer("api")(context.Background(), "tcp", "ignored:80")
+	require.NoError(err)
+	require.Equal(int64(1), backend.ConnectionCount())
+
+	// The connection is closed once its lifetime is reached, while the
+	// backend is released by the caller's Close
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	require.ErrorIs(err, net.ErrClosed)
+	require.Equal(int64(1), backend.ConnectionCount())
+	conn.Close()
+	require.Equal(int64(0), backend.ConnectionCount())
+}
@@ -0,0 +1,221 @@
+package lib
+
+import (
+	"errors"
+	"time"
+)
+
+// SkipReason tells why an allowed backend was not eligible for selection.
+type SkipReason string
+
+// define the reasons an allowed backend is skipped, in the order they are checked.
+const (
+	// SkipDenied is reported for backends matching a deny entry.
+	SkipDenied SkipReason = "denied"
+
+	// SkipMaintenance is reported for backends of pools in maintenance.
+	SkipMaintenance SkipReason = "maintenance"
+
+	// SkipInactiveGroup is reported for backends outside of their pool's
+	// active deployment group.
+	SkipInactiveGroup SkipReason = "inactive_group"
+
+	// SkipEjected is reported for backends ejected as outliers or after
+	// consecutive dial failures.
+	SkipEjected SkipReason = "ejected"
+
+	// SkipWeightedOut is reported for backends with a zero weight.
+	SkipWeightedOut SkipReason = "weighted_out"
+
+	// SkipAtCapacity is reported for backends that reached their
+	// connection limit.
+	SkipAtCapacity SkipReason = "at_capacity"
+)
+
+// eligibility returns the current weight of an allowed backend, or why it
+// cannot be selected. The caller must hold lb.mu.
+func (lb *LoadBalancer) eligibility(backend *Backend) (int64, SkipReason) {
+	if lb.inMaintenance(backend) != nil {
+		return 0, SkipMaintenance
+	}
+	if !lb.inActiveGroup(backend) {
+		return 0, SkipInactiveGroup
+	}
+	if backend.Ejected() {
+		return 0, SkipEjected
+	}
+	weight := int64(backend.EffectiveWeight())
+	if weight == 0 {
+		return 0, SkipWeightedOut
+	}
+	if backend.atCapacity() {
+		return weight, SkipAtCapacity
+	}
+	return weight, ""
+}
+
+// CandidateScore describes how a backend allowed for a client was
+// evaluated during a backend selection.
+type CandidateScore struct {
+	// Address is the address of the backend.
+	Address string `json:"address"`
+
+	// Pool is the pool of the backend.
+	Pool string `json:"pool,omitempty"`
+
+	// Set is the position of the allowed backend set the backend was
+	// evaluated for.
+	Set int `json:"set"`
+
+	// Connections is the active connection count of the backend.
+	Connections int64 `json:"connections"`
+
+	// Weight is the current weight of the backend, adjusted by
+	// health checks if weights are adapted.
+	Weight int `json:"weight"`
+
+	// DialLatency is the moving average time to dial the backend, the
+	// latency compared by BalanceLeastLatency. Zero if not measured.
+	DialLatency time.Duration `json:"dial_latency_ns,omitempty"`
+
+	// FirstByteLatency is the moving average time to the first byte
+	// received from the backend. Zero if not measured.
+	FirstByteLatency time.Duration `json:"first_byte_latency_ns,omitempty"`
+
+	// Score is the connection count scaled to DefaultWeight, i.e.
+	// Connections * DefaultWeight / Weight. The eligible backend with the
+	// lowest score is selected, the first registered one on a tie. With
+	// consistent hashing, it is the rendezvous score of the backend for
+	// the hash key instead, and the highest score is selected. With
+	// latency balancing, it is the latency cost of the backend in
+	// nanoseconds, ties being broken by the least connections per weight.
+	Score float64 `json:"score"`
+
+	// Skipped tells why the backend is not eligible, empty if it is.
+	Skipped SkipReason `json:"skipped,omitempty"`
+
+	// Selected is set for the backend that would be selected.
+	Selected bool `json:"selected,omitempty"`
+}
+
+// SelectionExplanation describes the backend selection for a connection
+// with the given allowed backend sets, as evaluated by ExplainSelection.
+type SelectionExplanation struct {
+	// Selected is the address of the backend that would be selected,
+	// empty if none.
+	Selected string `json:"selected,omitempty"`
+
+	// Error is the error routing would fail with, empty if a backend
+	// would be selected.
+	Error string `json:"error,omitempty"`
+
+	// Candidates are the backends allowed by an entry of each set that was
+	// evaluated, in selection order. Sets after the one a backend is
+	// selected from are not evaluated.
+	Candidates []CandidateScore `json:"candidates"`
+}
+
+// ExplainSelection evaluates which backend would be selected for a
+// connection with the hash key and the ordered allowed backend sets, and
+// why, without routing a connection: no connection count changes and no
+// rate limit token or admission queue slot is taken. Connections that
+// would fail with ErrBackendsAtCapacity may still be queued when routed.
+// The hash key, e.g. the client ID, is ignored unless the balancing
+// strategy is BalanceConsistentHash.
+func (lb *LoadBalancer) ExplainSelection(key string, allowedBackends ...map[string]struct{}) SelectionExplanation {
+	if !lb.ConsistentHashing() {
+		key = ""
+	}
+	var keyHash uint64
+	if key != "" {
+		keyHash = fnv64a(fnvOffset64, key)
+	}
+
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+
+	explanation := SelectionExplanation{Candidates: []CandidateScore{}}
+	if len(lb.backends) == 0 {
+		explanation.Error = ErrNoRegisteredBackends.Error()
+		return explanation
+	}
+
+	var lastErr error = ErrNoAvailableBackend
+	if len(allowedBackends) > 0 {
+		lastErr = nil
+	}
+	for set, allowed := range allowedBackends {
+		selected := -1
+		var maintenanceErr *MaintenanceError
+		atCapacityFound := false
+		for _, backend := range lb.index.candidates(allowed) {
+			candidate := CandidateScore{
+				Address:          backend.Address,
+				Pool:             backend.Pool,
+				Set:              set,
+				Connections:      backend.ConnectionCount(),
+				Weight:           backend.EffectiveWeight(),
+				DialLatency:      backend.DialLatency(),
+				FirstByteLatency: backend.FirstByteLatency(),
+			}
+			switch {
+			case key != "":
+				candidate.Score = rendezvousScore(keyHash, backend.Address, int64(candidate.Weight))
+			case lb.balancing == BalanceLeastLatency && candidate.Weight > 0:
+				candidate.Score = lb.latencyCost(backend, int64(candidate.Weight))
+			case candidate.Weight > 0:
+				candidate.Score = float64(candidate.Connections) * DefaultWeight / float64(candidate.Weight)
+			}
+
+			if !backend.isAllowed(allowed) {
+				candidate.Skipped = SkipDenied
+			} else {
+				_, candidate.Skipped = lb.eligibility(backend)
+			}
+			switch candidate.Skipped {
+			case "":
+				// Compare the same way getBackend does
+				switch {
+				case selected < 0:
+					selected = len(explanation.Candidates)
+				case key != "":
+					if candidate.Score > explanation.Candidates[selected].Score {
+						selected = len(explanation.Candidates)
+					}
+				case lb.balancing == BalanceLeastLatency && candidate.Score != explanation.Candidates[selected].Score:
+					if candidate.Score < explanation.Candidates[selected].Score {
+						selected = len(explanation.Candidates)
+					}
+				case candidate.Connections*int64(explanation.Candidates[selected].Weight) <
+					explanation.Candidates[selected].Connections*int64(candidate.Weight):
+					selected = len(explanation.Candidates)
+				}
+			case SkipMaintenance:
+				maintenanceErr = lb.inMaintenance(backend)
+			case SkipAtCapacity:
+				atCapacityFound = true
+			}
+			explanation.Candidates = append(explanation.Candidates, candidate)
+		}
+
+		if selected >= 0 {
+			explanation.Candidates[selected].Selected = true
+			explanation.Selected = explanation.Candidates[selected].Address
+			return explanation
+		}
+		var err error = ErrNoAvailableBackend
+		if atCapacityFound {
+			err = ErrBackendsAtCapacity
+		} else if maintenanceErr != nil {
+			err = maintenanceErr
+		}
+		lastErr = fallbackError(lastErr, err)
+	}
+
+	if errors.Is(lastErr, ErrBackendsAtCapacity) && lb.queues != nil && lb.queues.enabled(lb.queuePoolLocked(allowedBackends)) {
+		explanation.Error = lastErr.Error() + " (the connection would wait in the admission queue)"
+	} else {
+		explanation.Error = lastErr.Error()
+	}
+	return explanation
+}
@@ -0,0 +1,84 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplainSelection(t *testing.T) {
+	require := require.New(t)
+
+	lb := NewLoadBalancer(uint64(5), uint64(1))
+	require.Equal(ErrNoRegisteredBackends.Error(), lb.ExplainSelection("").Error)
+
+	busy := &Backend{Address: "127.0.0.1:5001", Pool: "web"}
+	heavy := &Backend{Address: "127.0.0.1:5002", Pool: "web"}
+	denied := &Backend{Address: "127.0.0.1:5003", Pool: "web"}
+	full := &Backend{Address: "127.0.0.1:5004", Pool: "web", MaxConnections: 1}
+	ejected := &Backend{Address: "127.0.0.1:5005", Pool: "web"}
+	green := &Backend{Address: "127.0.0.1:5006", Pool: "web", Group: "green"}
+	other := &Backend{Address: "127.0.0.1:5007", Pool: "other"}
+	for _, backend := range []*Backend{busy, heavy, denied, full, ejected, green, other} {
+		lb.AddBackend(backend)
+	}
+	lb.SetActiveGroup("web", "blue")
+	busy.connections.Store(2)
+	heavy.connections.Store(3)
+	heavy.setWeight(2*DefaultWeight, 0)
+	full.connections.Store(1)
+	ejected.eject(time.Minute)
+	for _, backend := range []*Backend{busy, heavy, full} {
+		backend.fixHeaps()
+	}
+
+	web := map[string]struct{}{PoolKey("web"): {}, DenyKey(denied.Address): {}}
+
+	t.Run("Scores and skip reasons", func(t *testing.T) {
+		explanation := lb.ExplainSelection("", web)
+		require.Equal(heavy.Address, explanation.Selected)
+		require.Empty(explanation.Error)
+		require.Equal([]CandidateScore{
+			{Address: busy.Address, Pool: "web", Connections: 2, Weight: DefaultWeight, Score: 2},
+			{Address: heavy.Address, Pool: "web", Connections: 3, Weight: 2 * DefaultWeight, Score: 1.5, Selected: true},
+			{Address: denied.Address, Pool: "web", Weight: DefaultWeight, Skipped: SkipDenied},
+			{Address: full.Address, Pool: "web", Connections: 1, Weight: DefaultWeight, Score: 1, Skipped: SkipAtCapacity},
+			{Address: ejected.Address, Pool: "web", Weight: DefaultWeight, Skipped: SkipEjected},
+			{Address: green.Address, Pool: "web", Weight: DefaultWeight, Skipped: SkipInactiveGroup},
+		}, explanation.Candidates)
+
+		// Nothing was routed
+		require.Equal(int64(3), heavy.ConnectionCount())
+	})
+
+	t.Run("Agrees with GetBackend", func(t *testing.T) {
+		backend, err := lb.GetBackend(web)
+		require.NoError(err)
+		require.Equal(heavy, backend)
+		backend.decrementConnections()
+	})
+
+	t.Run("Falls back to the next set", func(t *testing.T) {
+		lb.StartMaintenance("web", nil)
+		defer lb.EndMaintenance("web")
+
+		explanation := lb.ExplainSelection("", web, map[string]struct{}{PoolKey("other"): {}})
+		require.Equal(other.Address, explanation.Selected)
+		require.Len(explanation.Candidates, 7)
+		require.Equal(SkipMaintenance, explanation.Candidates[0].Skipped)
+		require.Equal(SkipDenied, explanation.Candidates[2].Skipped)
+		require.Equal(1, explanation.Candidates[6].Set)
+	})
+
+	t.Run("Reports the routing error", func(t *testing.T) {
+		explanation := lb.ExplainSelection("", map[string]struct{}{full.Address: {}}, map[string]struct{}{"127.0.0.1:5009": {}})
+		require.Empty(explanation.Selected)
+		require.Equal(ErrBackendsAtCapacity.Error(), explanation.Error)
+
+		lb.StartMaintenance("other", nil)
+		defer lb.EndMaintenance("other")
+		explanation = lb.ExplainSelection("", map[string]struct{}{"127.0.0.1:5009": {}}, map[string]struct{}{PoolKey("other"): {}})
+		require.Equal(`pool 'other' is in maintenance`, explanation.Error)
+	})
+}
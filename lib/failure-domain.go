@@ -0,0 +1,69 @@
+package lib
+
+import "sync"
+
+// WithFailureDomainSpreading spreads the connections of every client
+// across the failure domains of its allowed backends, see
+// Backend.FailureDomain: a connection is routed to a backend of the
+// domain with the fewest active connections of its client, and the
+// balancing strategy only chooses among the backends of that domain.
+// A client then keeps a share of its connections when a domain fails.
+// Consistent hashing takes precedence over spreading.
+func WithFailureDomainSpreading() Option {
+	return func(lb *LoadBalancer) {
+		lb.domainSpreading = &domainSpreading{
+			connections: make(map[string]map[string]int64),
+		}
+	}
+}
+
+// domainSpreading counts the active connections of every client per
+// failure domain. Concurrent connections of a client are counted once
+// established, so they may still land in the same domain.
+type domainSpreading struct {
+	// mu guards connections.
+	mu sync.Mutex
+
+	// connections maps a client ID to its active connections per failure
+	// domain. Clients without connections are removed.
+	connections map[string]map[string]int64
+}
+
+// load returns a copy of the active connections of the client per failure
+// domain, nil if it has none or if connections are not spread.
+func (s *domainSpreading) load(clientID string) map[string]int64 {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	domains := s.connections[clientID]
+	if len(domains) == 0 {
+		return nil
+	}
+	load := make(map[string]int64, len(domains))
+	for domain, connections := range domains {
+		load[domain] = connections
+	}
+	return load
+}
+
+// add adds delta to the active connections of the client in the domain.
+func (s *domainSpreading) add(clientID, domain string, delta int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	domains := s.connections[clientID]
+	if domains == nil {
+		domains = make(map[string]int64)
+		s.connections[clientID] = domains
+	}
+	domains[domain] += delta
+	if domains[domain] <= 0 {
+		delete(domains, domain)
+		if len(domains) == 0 {
+			delete(s.connections, clientID)
+		}
+	}
+}
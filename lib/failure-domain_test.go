@@ -0,0 +1,58 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailureDomainSpreading(t *testing.T) {
+	require := require.New(t)
+
+	lb := NewLoadBalancer(uint64(5), uint64(1), WithFailureDomainSpreading())
+	rackA1 := &Backend{Address: "127.0.0.1:5001", Pool: "web", FailureDomain: "rack-a"}
+	rackA2 := &Backend{Address: "127.0.0.1:5002", Pool: "web", FailureDomain: "rack-a"}
+	rackB := &Backend{Address: "127.0.0.1:5003", Pool: "web", FailureDomain: "rack-b"}
+	lb.AddBackend(rackA1)
+	lb.AddBackend(rackA2)
+	lb.AddBackend(rackB)
+	web := map[string]struct{}{PoolKey("web"): {}}
+
+	// Without connections of the client, the least loaded backend is selected
+	rackB.incrementConnections()
+	rackB.incrementConnections()
+	backend, err := lb.getBackend("", lb.domainSpreading.load("client1"), web)
+	require.NoError(err)
+	require.Equal(rackA1, backend)
+	lb.domainSpreading.add("client1", backend.FailureDomain, 1)
+
+	// The next connections of the client go to the other domain even if
+	// its backends are more loaded, then alternate
+	backend, err = lb.getBackend("", lb.domainSpreading.load("client1"), web)
+	require.NoError(err)
+	require.Equal(rackB, backend)
+	lb.domainSpreading.add("client1", backend.FailureDomain, 1)
+
+	backend, err = lb.getBackend("", lb.domainSpreading.load("client1"), web)
+	require.NoError(err)
+	require.Equal(rackA2, backend)
+	lb.domainSpreading.add("client1", backend.FailureDomain, 1)
+
+	// Other clients are not affected
+	backend, err = lb.getBackend("", lb.domainSpreading.load("client2"), web)
+	require.NoError(err)
+	require.Equal(rackA1, backend)
+
+	// Domains without eligible backends are skipped
+	_, err = lb.SetBackendWeight(rackB.Address, 0, 0)
+	require.NoError(err)
+	backend, err = lb.getBackend("", lb.domainSpreading.load("client1"), web)
+	require.NoError(err)
+	require.Equal("rack-a", backend.FailureDomain)
+
+	// Clients are forgotten once their connections end
+	lb.domainSpreading.add("client1", "rack-a", -2)
+	lb.domainSpreading.add("client1", "rack-b", -1)
+	require.Nil(lb.domainSpreading.load("client1"))
+	require.Empty(lb.domainSpreading.connections)
+}
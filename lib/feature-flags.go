@@ -0,0 +1,37 @@
+package lib
+
+import (
+	"context"
+
+	"github.com/rrasulzade/tcp-lb-go/featureflag"
+)
+
+// define the experimental behaviors gated by feature flags.
+const (
+	// FeaturePooledBuffers reuses the copy buffers of transfers
+	// instead of allocating them for every connection.
+	FeaturePooledBuffers = "pooled_buffers"
+)
+
+// WithFeatureFlags sets the feature flags gating experimental behaviors,
+// which are turned off without them.
+func WithFeatureFlags(flags *featureflag.Set) Option {
+	return func(lb *LoadBalancer) {
+		lb.featureFlags = flags
+	}
+}
+
+// featureEnabled reports whether the named behavior is turned on for the
+// connection routed to the pool. Connections are placed in the rollout
+// percentage by their connection ID, or by client ID if they have none.
+func (lb *LoadBalancer) featureEnabled(ctx context.Context, name, pool, clientID string) bool {
+	key := ConnectionIDFromContext(ctx)
+	if key == "" {
+		key = clientID
+	}
+	enabled := lb.featureFlags.Enabled(name, pool, key)
+	if enabled {
+		trace(ctx, "feature %s enabled", name)
+	}
+	return enabled
+}
@@ -1,39 +1,250 @@
 package lib
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// TransferData bidirectionally transfers data between a client and backend connections
-func transferData(clientConn, backendConn net.Conn) error {
-	errChan := make(chan error, 2)
+// ErrIdleTimeout is returned when no data was read in one
+// direction of a transfer within its idle timeout.
+var ErrIdleTimeout = errors.New("connection idle timeout")
+
+// ErrBackendDrained is returned when a transfer was aborted because the
+// connections of its backend were force-closed, e.g. after a drain's
+// grace period.
+var ErrBackendDrained = errors.New("backend connections force-closed")
+
+// CloseReason describes why a data transfer ended.
+type CloseReason int
+
+// define transfer close reasons.
+const (
+	// CloseClientEOF means the client closed its side of the connection.
+	CloseClientEOF CloseReason = iota
+
+	// CloseBackendEOF means the backend closed its side of the connection.
+	CloseBackendEOF
+
+	// CloseIdleTimeout means a direction exceeded its idle timeout.
+	CloseIdleTimeout
+
+	// CloseCanceled means the transfer context was canceled, e.g. on a
+	// forced shutdown.
+	CloseCanceled
+
+	// CloseDeadline means the transfer context deadline, e.g. the
+	// maximum connection lifetime, was exceeded.
+	CloseDeadline
+
+	// CloseCopyError means copying data failed in one of the directions.
+	CloseCopyError
+
+	// CloseDrained means the connections of the backend were force-closed,
+	// e.g. once the grace period of a drain or pool switch expired.
+	CloseDrained
+
+	// closeReasonCount is the number of close reasons.
+	closeReasonCount
+)
+
+// String returns the name of the close reason.
+func (r CloseReason) String() string {
+	switch r {
+	case CloseClientEOF:
+		return "client_eof"
+	case CloseBackendEOF:
+		return "backend_eof"
+	case CloseIdleTimeout:
+		return "idle_timeout"
+	case CloseCanceled:
+		return "canceled"
+	case CloseDeadline:
+		return "deadline"
+	case CloseCopyError:
+		return "copy_error"
+	case CloseDrained:
+		return "drained"
+	}
+	return "unknown"
+}
+
+// transferOptions holds the settings of a transfer, such as the
+// per-direction idle timeouts. A zero timeout disables the timeout
+// for that direction.
+type transferOptions struct {
+	// clientIdle is the maximum time without data read from the client.
+	clientIdle time.Duration
+
+	// backendIdle is the maximum time without data read from the backend.
+	backendIdle time.Duration
+
+	// pooledBuffers reuses copy buffers across transfers
+	// instead of allocating them per transfer.
+	pooledBuffers bool
+
+	// sent and received count the bytes copied to and from the
+	// backend as they are written. Optional.
+	sent, received *atomic.Uint64
+}
+
+// copyBufferSize is the size of the buffer of each transfer direction.
+const copyBufferSize = 32 * 1024
+
+// copyBuffers holds copy buffers reused across transfers.
+var copyBuffers = sync.Pool{
+	New: func() any {
+		buf := make([]byte, copyBufferSize)
+		return &buf
+	},
+}
+
+// copyResult is the outcome of copying one direction of a transfer.
+type copyResult struct {
+	// reason is why the copy ended.
+	reason CloseReason
+
+	// err is the copy error, nil if the source reached EOF.
+	err error
+}
+
+// copyWithIdleTimeout copies from src to dst until src reaches EOF or an
+// error occurs, refreshing the read deadline of src before every read.
+// eofReason is reported when src reaches EOF. The bytes written to dst
+// are added to copied if not nil.
+func copyWithIdleTimeout(dst, src net.Conn, idle time.Duration, eofReason CloseReason, pooled bool, copied *atomic.Uint64) copyResult {
+	var buf []byte
+	if pooled {
+		pooledBuf := copyBuffers.Get().(*[]byte)
+		defer copyBuffers.Put(pooledBuf)
+		buf = *pooledBuf
+	} else {
+		buf = make([]byte, copyBufferSize)
+	}
+	for {
+		if idle > 0 {
+			src.SetReadDeadline(time.Now().Add(idle))
+		}
+
+		n, err := src.Read(buf)
+		if n > 0 {
+			written, werr := dst.Write(buf[:n])
+			if copied != nil {
+				copied.Add(uint64(written))
+			}
+			if werr != nil {
+				return copyResult{reason: CloseCopyError, err: werr}
+			}
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return copyResult{reason: eofReason}
+			}
+			var netErr net.Error
+			if idle > 0 && errors.As(err, &netErr) && netErr.Timeout() {
+				return copyResult{reason: CloseIdleTimeout, err: ErrIdleTimeout}
+			}
+			return copyResult{reason: CloseCopyError, err: err}
+		}
+	}
+}
+
+// closeWrite half-closes the write side of the connection if supported,
+// so that the peer observes EOF while the other direction keeps flowing.
+func closeWrite(conn net.Conn) {
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+	}
+}
+
+// TransferData bidirectionally transfers data between a client and backend
+// connections until both directions finish, ctx is done or a direction
+// fails. It returns the reason the transfer ended; the error is nil when
+// the transfer ended because a peer closed its connection.
+func transferData(
+	ctx context.Context,
+	clientConn, backendConn net.Conn,
+	options transferOptions,
+) (CloseReason, error) {
+	resultChan := make(chan copyResult, 2)
 
 	// Goroutine to handle data transfer from the backend to the client
 	go func() {
-		_, err := io.Copy(clientConn, backendConn)
-		if err != nil {
-			errChan <- fmt.Errorf("copying data from backend server: %w", err)
+		result := copyWithIdleTimeout(clientConn, backendConn, options.backendIdle, CloseBackendEOF, options.pooledBuffers, options.received)
+		if result.err != nil {
+			result.err = fmt.Errorf("copying data from backend server: %w", result.err)
 		} else {
-			errChan <- nil
+			closeWrite(clientConn)
 		}
+		resultChan <- result
 	}()
 
 	// Goroutine to handle data transfer from the client to the backend
 	go func() {
-		_, err := io.Copy(backendConn, clientConn)
-		if err != nil {
-			errChan <- fmt.Errorf("copying data to backend server: %w", err)
+		result := copyWithIdleTimeout(backendConn, clientConn, options.clientIdle, CloseClientEOF, options.pooledBuffers, options.sent)
+		if result.err != nil {
+			result.err = fmt.Errorf("copying data to backend server: %w", result.err)
 		} else {
-			errChan <- nil
+			closeWrite(backendConn)
 		}
+		resultChan <- result
 	}()
 
-	// Wait for both goroutines to complete
-	err1 := <-errChan
-	err2 := <-errChan
+	// abort unblocks both directions by expiring their deadlines
+	abort := func() {
+		clientConn.SetDeadline(time.Now())
+		backendConn.SetDeadline(time.Now())
+	}
+
+	// Wait for the first direction to complete, or for the context to end
+	var first copyResult
+	select {
+	case first = <-resultChan:
+	case <-ctx.Done():
+		abort()
+		<-resultChan
+		<-resultChan
+		return contextCloseReason(ctx)
+	}
+
+	// If one direction fails, abort the other one so that it is
+	// not left blocked on a read, e.g. when a connection is force-closed
+	if first.err != nil {
+		abort()
+	}
+
+	var second copyResult
+	select {
+	case second = <-resultChan:
+	case <-ctx.Done():
+		abort()
+		second = <-resultChan
+		return contextCloseReason(ctx)
+	}
+
+	// Errors caused by aborting the second direction are not reported
+	if first.err != nil {
+		return first.reason, first.err
+	}
+	if second.err != nil {
+		return second.reason, second.err
+	}
+	return first.reason, nil
+}
 
-	return errors.Join(err1, err2)
+// contextCloseReason returns the reason and error of a transfer that
+// ended because ctx is done.
+func contextCloseReason(ctx context.Context) (CloseReason, error) {
+	if cause := context.Cause(ctx); errors.Is(cause, ErrBackendDrained) {
+		return CloseDrained, cause
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return CloseDeadline, ctx.Err()
+	}
+	return CloseCanceled, ctx.Err()
 }
@@ -0,0 +1,113 @@
+package lib
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransferData(t *testing.T) {
+	require := require.New(t)
+
+	t.Run("Client closes connection", func(t *testing.T) {
+		client, clientPeer := net.Pipe()
+		backend, backendPeer := net.Pipe()
+
+		go func() {
+			clientPeer.Write([]byte("ping"))
+			clientPeer.Close()
+		}()
+		go func() {
+			buf := make([]byte, 4)
+			io.ReadFull(backendPeer, buf)
+			backendPeer.Close()
+		}()
+
+		reason, err := transferData(context.Background(), client, backend, transferOptions{})
+		require.NoError(err)
+		require.Contains([]CloseReason{CloseClientEOF, CloseBackendEOF}, reason)
+	})
+
+	t.Run("Pooled buffers", func(t *testing.T) {
+		client, clientPeer := net.Pipe()
+		backend, backendPeer := net.Pipe()
+
+		go func() {
+			clientPeer.Write([]byte("ping"))
+			clientPeer.Close()
+		}()
+		received := make(chan string, 1)
+		go func() {
+			buf := make([]byte, 4)
+			io.ReadFull(backendPeer, buf)
+			received <- string(buf)
+			backendPeer.Close()
+		}()
+
+		_, err := transferData(context.Background(), client, backend, transferOptions{pooledBuffers: true})
+		require.NoError(err)
+		require.Equal("ping", <-received)
+	})
+
+	t.Run("Idle timeout", func(t *testing.T) {
+		client, _ := net.Pipe()
+		backend, _ := net.Pipe()
+
+		deadlines := transferOptions{clientIdle: 50 * time.Millisecond}
+		reason, err := transferData(context.Background(), client, backend, deadlines)
+		require.ErrorIs(err, ErrIdleTimeout)
+		require.Equal(CloseIdleTimeout, reason)
+	})
+
+	t.Run("Context canceled", func(t *testing.T) {
+		client, _ := net.Pipe()
+		backend, _ := net.Pipe()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		reason, err := transferData(ctx, client, backend, transferOptions{})
+		require.ErrorIs(err, context.Canceled)
+		require.Equal(CloseCanceled, reason)
+	})
+
+	t.Run("Context deadline exceeded", func(t *testing.T) {
+		client, _ := net.Pipe()
+		backend, _ := net.Pipe()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		reason, err := transferData(ctx, client, backend, transferOptions{})
+		require.ErrorIs(err, context.DeadlineExceeded)
+		require.Equal(CloseDeadline, reason)
+	})
+
+	t.Run("Backend drained", func(t *testing.T) {
+		client, _ := net.Pipe()
+		backend, _ := net.Pipe()
+
+		ctx, cancel := context.WithCancelCause(context.Background())
+		time.AfterFunc(50*time.Millisecond, func() { cancel(ErrBackendDrained) })
+
+		reason, err := transferData(ctx, client, backend, transferOptions{})
+		require.ErrorIs(err, ErrBackendDrained)
+		require.Equal(CloseDrained, reason)
+	})
+
+	t.Run("Copy error", func(t *testing.T) {
+		client, clientPeer := net.Pipe()
+		backend, backendPeer := net.Pipe()
+		backendPeer.Close()
+
+		go clientPeer.Write([]byte("ping"))
+
+		reason, err := transferData(context.Background(), client, backend, transferOptions{})
+		require.Error(err)
+		require.Contains([]CloseReason{CloseCopyError, CloseBackendEOF}, reason)
+	})
+}
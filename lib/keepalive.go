@@ -0,0 +1,287 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/logging"
+)
+
+// ErrKeepaliveTimeout is returned when a client did not answer a keepalive ping in time.
+var ErrKeepaliveTimeout = errors.New("keepalive response timed out")
+
+// Keepalive defines the protocol-level pings sent to the clients of a
+// pool whose connections are idle, keeping NAT and firewall state alive
+// on long-lived connections without involving the backend.
+type Keepalive struct {
+	// Interval is the time without data in either direction
+	// after which a ping is sent.
+	Interval time.Duration
+
+	// Ping is written to the client, e.g. a protocol's no-op message.
+	Ping []byte
+
+	// Response is the answer expected from the client, which is consumed
+	// rather than forwarded to the backend. Optional, pings are not
+	// answered if empty.
+	Response []byte
+
+	// Timeout is the time to wait for the response before the connection
+	// is closed. Defaults to Interval.
+	Timeout time.Duration
+}
+
+// WithKeepalive enables keepalive pings on the connections routed to
+// the pool's backends. Pings are only sent after both directions have
+// been idle for the interval, so that they are not interleaved with
+// protocol messages.
+func WithKeepalive(pool string, keepalive Keepalive) Option {
+	return func(lb *LoadBalancer) {
+		if keepalive.Interval <= 0 || len(keepalive.Ping) == 0 {
+			return
+		}
+		if keepalive.Timeout <= 0 {
+			keepalive.Timeout = keepalive.Interval
+		}
+		if lb.keepalives == nil {
+			lb.keepalives = make(map[string]Keepalive)
+		}
+		lb.keepalives[pool] = keepalive
+	}
+}
+
+// keepaliveConn sends keepalive pings on a client connection while it
+// is idle and strips the client's responses from the data read.
+type keepaliveConn struct {
+	net.Conn
+
+	// keepalive defines the pings.
+	keepalive Keepalive
+
+	// metrics holds the metrics recorded for the pings.
+	metrics *lbMetrics
+
+	// logger logs the unanswered pings.
+	logger *logging.Logger
+
+	// pool is the pool the connection is routed to.
+	pool string
+
+	// connectionID is the ID of the connection, prefixing its log lines.
+	connectionID string
+
+	// lastActive is the time, in Unix nanoseconds, data was last
+	// read or written, or a ping was last sent.
+	lastActive atomic.Int64
+
+	// writeMu prevents pings from being interleaved with writes.
+	writeMu sync.Mutex
+
+	// mu ensures concurrent access to the response state.
+	mu sync.Mutex
+
+	// awaiting is set while the response to a ping is expected.
+	awaiting bool
+
+	// sentAt is the time the awaited ping was sent.
+	sentAt time.Time
+
+	// matched is the number of response bytes read so far.
+	matched int
+
+	// buffered holds data read from the client that was not returned yet.
+	buffered []byte
+
+	// timedOut is set once the connection was closed for a missing response.
+	timedOut atomic.Bool
+}
+
+// newKeepaliveConn wraps the client connection with the given ID.
+func newKeepaliveConn(conn net.Conn, connectionID string, keepalive Keepalive, pool string, metrics *lbMetrics, logger *logging.Logger) *keepaliveConn {
+	c := &keepaliveConn{
+		Conn:         conn,
+		keepalive:    keepalive,
+		metrics:      metrics,
+		logger:       logger,
+		pool:         pool,
+		connectionID: connectionID,
+	}
+	c.touch(time.Now())
+	return c
+}
+
+// touch records activity on the connection.
+func (c *keepaliveConn) touch(now time.Time) {
+	c.lastActive.Store(now.UnixNano())
+}
+
+// Read implements net.Conn.
+func (c *keepaliveConn) Read(b []byte) (int, error) {
+	for {
+		if n, ok := c.readBuffered(b); ok {
+			return n, nil
+		}
+
+		n, err := c.Conn.Read(b)
+		if n > 0 {
+			c.touch(time.Now())
+			n = c.consumeResponse(b[:n])
+			if n == 0 && err == nil {
+				continue
+			}
+		}
+		if err != nil && c.timedOut.Load() {
+			err = ErrKeepaliveTimeout
+		}
+		return n, err
+	}
+}
+
+// readBuffered returns buffered data, if any.
+func (c *keepaliveConn) readBuffered(b []byte) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.buffered) == 0 {
+		return 0, false
+	}
+	n := copy(b, c.buffered)
+	c.buffered = c.buffered[n:]
+	return n, true
+}
+
+// consumeResponse strips the awaited response from the start of data and
+// returns the length of the remaining data, moved to the start of data.
+// If the data does not match the response, it is returned unchanged,
+// including response bytes matched by previous reads.
+func (c *keepaliveConn) consumeResponse(data []byte) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.awaiting {
+		return len(data)
+	}
+
+	response := c.keepalive.Response
+	i := 0
+	for i < len(data) && c.matched < len(response) && data[i] == response[c.matched] {
+		i++
+		c.matched++
+	}
+
+	switch {
+	case c.matched == len(response):
+		// The response was received in full
+		c.awaiting = false
+		c.matched = 0
+		return copy(data, data[i:])
+
+	case i == len(data):
+		// The response may continue in the next read
+		return 0
+
+	default:
+		// The client sent other data, which is forwarded as-is
+		c.logger.Warnf("[conn %s] Unexpected keepalive response from client %s", c.connectionID, c.RemoteAddr())
+		c.buffered = append(append([]byte(nil), response[:c.matched]...), data[i:]...)
+		c.awaiting = false
+		c.matched = 0
+		n := copy(data, c.buffered)
+		c.buffered = c.buffered[n:]
+		return n
+	}
+}
+
+// Write implements net.Conn.
+func (c *keepaliveConn) Write(b []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	n, err := c.Conn.Write(b)
+	c.touch(time.Now())
+	return n, err
+}
+
+// CloseWrite half-closes the underlying connection if supported.
+func (c *keepaliveConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// run sends pings while the connection is idle until ctx is done, and
+// closes the connection if a ping is not answered in time.
+func (c *keepaliveConn) run(ctx context.Context) {
+	timer := time.NewTimer(c.keepalive.Interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		next, err := c.tick(time.Now())
+		if err != nil {
+			c.logger.Warnf("[conn %s] Closing connection of client %s: %v", c.connectionID, c.RemoteAddr(), err)
+			c.timedOut.Store(true)
+			c.Conn.Close()
+			return
+		}
+		timer.Reset(next)
+	}
+}
+
+// tick sends a ping if the connection has been idle for the interval and
+// returns the time until the next tick.
+func (c *keepaliveConn) tick(now time.Time) (time.Duration, error) {
+	c.mu.Lock()
+	if c.awaiting {
+		waited := now.Sub(c.sentAt)
+		c.mu.Unlock()
+		if waited >= c.keepalive.Timeout {
+			c.metrics.keepaliveTimeouts.With(c.pool).Inc()
+			return 0, ErrKeepaliveTimeout
+		}
+		return c.keepalive.Timeout - waited, nil
+	}
+
+	idle := now.Sub(time.Unix(0, c.lastActive.Load()))
+	if idle < c.keepalive.Interval {
+		c.mu.Unlock()
+		return c.keepalive.Interval - idle, nil
+	}
+
+	// Expect the response before sending the ping, as it may be read
+	// before the write returns
+	answered := len(c.keepalive.Response) > 0
+	c.awaiting = answered
+	c.sentAt = now
+	c.mu.Unlock()
+
+	// The lock is not held while writing, so that reads are not blocked
+	// by a client that is not reading
+	c.writeMu.Lock()
+	_, err := c.Conn.Write(c.keepalive.Ping)
+	c.writeMu.Unlock()
+	if err != nil {
+		// The transfer observes the failure on its own
+		c.mu.Lock()
+		c.awaiting = false
+		c.mu.Unlock()
+		return c.keepalive.Interval, nil
+	}
+	c.touch(now)
+	c.metrics.keepalivePings.With(c.pool).Inc()
+
+	if !answered {
+		return c.keepalive.Interval, nil
+	}
+	return c.keepalive.Timeout, nil
+}
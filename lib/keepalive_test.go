@@ -0,0 +1,79 @@
+package lib
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/logging"
+	"github.com/rrasulzade/tcp-lb-go/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeepaliveConn(t *testing.T) {
+	keepalive := Keepalive{
+		Interval: 20 * time.Millisecond,
+		Ping:     []byte("PING\r\n"),
+		Response: []byte("PONG\r\n"),
+		Timeout:  200 * time.Millisecond,
+	}
+
+	start := func(t *testing.T) (*keepaliveConn, net.Conn) {
+		server, client := net.Pipe()
+		t.Cleanup(func() {
+			server.Close()
+			client.Close()
+		})
+		conn := newKeepaliveConn(server, "9f2c4e1a7b3d5608", keepalive, "primary", newLBMetrics(metrics.Nop), logging.Default())
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		go conn.run(ctx)
+		return conn, client
+	}
+
+	t.Run("Response is consumed", func(t *testing.T) {
+		require := require.New(t)
+		conn, client := start(t)
+
+		ping := make([]byte, len(keepalive.Ping))
+		_, err := io.ReadFull(client, ping)
+		require.NoError(err)
+		require.Equal(keepalive.Ping, ping)
+
+		// The response is split across writes and followed by data
+		go func() {
+			client.Write([]byte("PO"))
+			client.Write([]byte("NG\r\nhello"))
+		}()
+		data := make([]byte, 5)
+		_, err = io.ReadFull(conn, data)
+		require.NoError(err)
+		require.Equal("hello", string(data))
+	})
+
+	t.Run("Other data is forwarded", func(t *testing.T) {
+		require := require.New(t)
+		conn, client := start(t)
+
+		ping := make([]byte, len(keepalive.Ping))
+		_, err := io.ReadFull(client, ping)
+		require.NoError(err)
+
+		go client.Write([]byte("POST /"))
+		data := make([]byte, 6)
+		_, err = io.ReadFull(conn, data)
+		require.NoError(err)
+		require.Equal("POST /", string(data))
+	})
+
+	t.Run("Unanswered ping closes the connection", func(t *testing.T) {
+		require := require.New(t)
+		conn, client := start(t)
+
+		go io.Copy(io.Discard, client)
+		_, err := conn.Read(make([]byte, 1))
+		require.ErrorIs(err, ErrKeepaliveTimeout)
+	})
+}
@@ -0,0 +1,84 @@
+package lib
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// BalanceLeastLatency selects the backend with the lowest latency cost,
+// its moving average latency multiplied by its active connections plus
+// one, relative to its weight. It keeps traffic away from overloaded
+// backends that still accept connections quickly but respond slowly.
+// Backends without a measured latency are tried first.
+const BalanceLeastLatency BalancingStrategy = "least_latency"
+
+// latencyEWMASmoothing is the share of the last measurement in the moving
+// average latency of a backend, between 0 and 1.
+const latencyEWMASmoothing = 0.2
+
+// WithFirstByteLatency adds the moving average time to the first byte
+// received from a backend to its dial latency in the latency cost of
+// BalanceLeastLatency, so that backends slow to respond are avoided
+// even when they accept connections quickly.
+func WithFirstByteLatency() Option {
+	return func(lb *LoadBalancer) {
+		lb.firstByteLatency = true
+	}
+}
+
+// ewma is an exponentially weighted moving average of latencies,
+// safe for concurrent use. The zero value has no measurement.
+type ewma struct {
+	// bits are the float64 bits of the average in nanoseconds.
+	bits atomic.Uint64
+}
+
+// observe adds a latency to the average. The first latency
+// initializes the average.
+func (e *ewma) observe(latency time.Duration) {
+	for {
+		old := e.bits.Load()
+		average := float64(latency)
+		if old != 0 {
+			average = math.Float64frombits(old)
+			average += latencyEWMASmoothing * (float64(latency) - average)
+		}
+		if e.bits.CompareAndSwap(old, math.Float64bits(max(average, 1))) {
+			return
+		}
+	}
+}
+
+// value returns the average, zero if nothing was measured.
+func (e *ewma) value() time.Duration {
+	return time.Duration(math.Float64frombits(e.bits.Load()))
+}
+
+// DialLatency returns the moving average time to dial the backend,
+// zero if no dial succeeded yet.
+func (b *Backend) DialLatency() time.Duration {
+	return b.dialLatency.value()
+}
+
+// FirstByteLatency returns the moving average time to the first byte
+// received from the backend, zero if it was not measured.
+func (b *Backend) FirstByteLatency() time.Duration {
+	return b.firstByteLatency.value()
+}
+
+// measuresFirstByte reports whether the first-byte latency of backend
+// connections is measured.
+func (lb *LoadBalancer) measuresFirstByte() bool {
+	return lb.latencyObserver != nil || (lb.balancing == BalanceLeastLatency && lb.firstByteLatency)
+}
+
+// latencyCost returns the latency cost of the backend for
+// BalanceLeastLatency, scaled to DefaultWeight.
+func (lb *LoadBalancer) latencyCost(backend *Backend, weight int64) float64 {
+	latency := backend.DialLatency()
+	if lb.firstByteLatency {
+		latency += backend.FirstByteLatency()
+	}
+	return float64(latency) * float64(backend.ConnectionCount()+1) * DefaultWeight / float64(weight)
+}
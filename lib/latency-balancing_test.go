@@ -0,0 +1,72 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEWMA(t *testing.T) {
+	require := require.New(t)
+
+	var e ewma
+	require.Zero(e.value())
+
+	e.observe(10 * time.Millisecond)
+	require.Equal(10*time.Millisecond, e.value())
+
+	e.observe(20 * time.Millisecond)
+	require.Equal(12*time.Millisecond, e.value())
+}
+
+func TestLeastLatency(t *testing.T) {
+	require := require.New(t)
+
+	lb := NewLoadBalancer(uint64(5), uint64(1), WithBalancing(BalanceLeastLatency))
+	fast := &Backend{Address: "127.0.0.1:5001", Pool: "web"}
+	slow := &Backend{Address: "127.0.0.1:5002", Pool: "web"}
+	lb.AddBackend(fast)
+	lb.AddBackend(slow)
+	web := map[string]struct{}{PoolKey("web"): {}}
+
+	// Backends without a measured latency are compared by connections
+	fast.incrementConnections()
+	backend, err := lb.getBackend("", nil, web)
+	require.NoError(err)
+	require.Equal(slow, backend)
+	backend.decrementConnections()
+	fast.decrementConnections()
+
+	// The backend with the lowest latency is preferred
+	fast.dialLatency.observe(time.Millisecond)
+	slow.dialLatency.observe(10 * time.Millisecond)
+	backend, err = lb.getBackend("", nil, web)
+	require.NoError(err)
+	require.Equal(fast, backend)
+
+	// until its connections outweigh its latency advantage
+	for i := 0; i < 10; i++ {
+		fast.incrementConnections()
+	}
+	backend, err = lb.getBackend("", nil, web)
+	require.NoError(err)
+	require.Equal(slow, backend)
+	backend.decrementConnections()
+
+	explanation := lb.ExplainSelection("", web)
+	require.Equal(slow.Address, explanation.Selected)
+	require.Equal(time.Millisecond, explanation.Candidates[0].DialLatency)
+
+	// The first-byte latency counts when enabled
+	lb = NewLoadBalancer(uint64(5), uint64(1), WithBalancing(BalanceLeastLatency), WithFirstByteLatency())
+	lb.AddBackend(fast)
+	lb.AddBackend(slow)
+	for i := 0; i < 11; i++ {
+		fast.decrementConnections()
+	}
+	fast.firstByteLatency.observe(50 * time.Millisecond)
+	backend, err = lb.getBackend("", nil, web)
+	require.NoError(err)
+	require.Equal(slow, backend)
+}
@@ -0,0 +1,65 @@
+package lib
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// LatencyPhase identifies the phase of a backend connection a latency is measured for.
+type LatencyPhase string
+
+// define measured latency phases.
+const (
+	// LatencyDial is the time to establish the backend connection.
+	LatencyDial LatencyPhase = "dial"
+
+	// LatencyFirstByte is the time from the established backend
+	// connection to the first byte received from the backend.
+	LatencyFirstByte LatencyPhase = "first_byte"
+)
+
+// LatencyObserver receives the latencies measured for a backend connection.
+type LatencyObserver func(backend *Backend, phase LatencyPhase, latency time.Duration)
+
+// WithLatencyObserver sets the observer of the dial and first-byte
+// latencies of backend connections, e.g. to compare backends and spot
+// a slow replica. Failed dials are not observed.
+func WithLatencyObserver(observer LatencyObserver) Option {
+	return func(lb *LoadBalancer) {
+		lb.latencyObserver = observer
+	}
+}
+
+// firstByteConn reports the time to the first byte read from a backend connection.
+type firstByteConn struct {
+	net.Conn
+
+	// start is the time the connection was established.
+	start time.Time
+
+	// once ensures the first byte is reported once.
+	once sync.Once
+
+	// report receives the time to the first byte.
+	report func(latency time.Duration)
+}
+
+// Read implements net.Conn.
+func (c *firstByteConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.once.Do(func() {
+			c.report(time.Since(c.start))
+		})
+	}
+	return n, err
+}
+
+// CloseWrite half-closes the underlying connection if supported.
+func (c *firstByteConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package lib
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatencyObserver(t *testing.T) {
+	require := require.New(t)
+
+	observed := make(map[LatencyPhase]int)
+	observer := func(backend *Backend, phase LatencyPhase, latency time.Duration) {
+		require.Equal("127.0.0.1:5010", backend.Address)
+		require.GreaterOrEqual(latency, time.Duration(0))
+		observed[phase]++
+	}
+
+	lb := NewLoadBalancer(uint64(5), uint64(5), WithLatencyObserver(observer))
+	lb.dialer = &mockDialer{}
+	backend := &Backend{Address: "127.0.0.1:5010"}
+	lb.AddBackend(backend)
+
+	clientMockConn := &mockConn{readBuffer: new(bytes.Buffer), writeBuffer: new(bytes.Buffer)}
+	require.NoError(lb.RouteConnection("client1", clientMockConn, map[string]struct{}{backend.Address: {}}))
+	require.Equal(map[LatencyPhase]int{LatencyDial: 1, LatencyFirstByte: 1}, observed)
+	require.Equal("mock data", clientMockConn.writeBuffer.String())
+}
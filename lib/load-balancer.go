@@ -1,10 +1,20 @@
 package lib
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
+	"fmt"
 	"net"
+	"slices"
 	"sync"
 	"sync/atomic"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/featureflag"
+	"github.com/rrasulzade/tcp-lb-go/logging"
+	"github.com/rrasulzade/tcp-lb-go/metrics"
+	"github.com/rrasulzade/tcp-lb-go/proxyproto"
 )
 
 // define custom errors.
@@ -12,6 +22,10 @@ var (
 	ErrNoRegisteredBackends = errors.New("no registered backends")
 	ErrNoAvailableBackend   = errors.New("no available backend")
 	ErrRateLimitReached     = errors.New("connection rejected due to rate limiting")
+	ErrBackendsAtCapacity   = errors.New("all allowed backends are at capacity")
+	ErrQueueFull            = errors.New("admission queue is full")
+	ErrQueueTimeout         = errors.New("timed out waiting in admission queue")
+	ErrBackendUnreachable   = errors.New("unable to connect to backend")
 )
 
 // dialer is an interface that abstracts the Dial method.
@@ -20,10 +34,13 @@ type dialer interface {
 }
 
 // lbDialer is the default implementation of the dialer interface.
-type lbDialer struct{}
+type lbDialer struct {
+	// timeout bounds the connection establishment. Zero means no timeout.
+	timeout time.Duration
+}
 
 func (d *lbDialer) Dial(network, address string) (net.Conn, error) {
-	return net.Dial(network, address)
+	return net.DialTimeout(network, address, d.timeout)
 }
 
 // Backend represents a backend server that
@@ -32,18 +49,146 @@ type Backend struct {
 	// Address is a hostname or IP address of the backend server.
 	Address string
 
+	// Pool is the name of the pool the backend belongs to.
+	Pool string
+
+	// Group is the deployment group (e.g. "blue" or "green") of the
+	// backend within its pool. Empty if the pool is not grouped.
+	Group string
+
+	// FailureDomain is the failure domain of the backend, e.g. its rack,
+	// host or availability zone, which connections are spread across
+	// with WithFailureDomainSpreading. Backends without one share a domain.
+	FailureDomain string
+
+	// MaxConnections is the maximum number of active connections
+	// the backend accepts. Zero means unlimited.
+	MaxConnections int64
+
+	// InitialWeight is the weight of the backend when it is registered,
+	// between 1 and MaxWeight, e.g. proportional to its capacity so that
+	// larger machines receive proportionally more connections. Zero means
+	// DefaultWeight. See SetBackendWeight to change it at runtime.
+	InitialWeight int
+
 	// connections is the current number of active connections.
 	connections atomic.Int64
+
+	// registry holds the active connections, against which
+	// connections is reconciled.
+	registry connectionRegistry
+
+	// poolKey is the allowed backends entry referring to the backend's pool.
+	poolKey string
+
+	// denyAddressKey and denyPoolKey are the allowed backends entries
+	// denying the backend, precomputed when it is registered.
+	denyAddressKey, denyPoolKey string
+
+	// dialStats accumulates dial outcomes for outlier detection.
+	dialStats dialStats
+
+	// ejectedUntil is the UnixNano time until which the backend is
+	// ejected from selection.
+	ejectedUntil atomic.Int64
+
+	// ejections is the ejection multiplier of the backend.
+	ejections atomic.Int64
+
+	// consecutiveFailures is the number of consecutive failed dials
+	// counted by the passive health check.
+	consecutiveFailures atomic.Int64
+
+	// history is the recent health history of the backend.
+	history backendHistory
+
+	// weight is the current weight ramp of the backend.
+	// Nil means DefaultWeight.
+	weight atomic.Pointer[weightRamp]
+
+	// heaps are the slots of the backend in the selection heaps of the
+	// index entries allowing it, guarded by lb.mu.
+	heaps []*heapSlot
+
+	// dialLatency is the moving average time to dial the backend,
+	// including the TLS handshake if enabled.
+	dialLatency ewma
+
+	// firstByteLatency is the moving average time to the first byte
+	// received from the backend.
+	firstByteLatency ewma
+
+	// weightPercent is the percentage of its weight the backend is
+	// served at, adjusted by health checks. Zero means 100.
+	weightPercent atomic.Int64
+
+	// totalConnections is the number of connections routed or dialed
+	// to the backend.
+	totalConnections atomic.Uint64
+
+	// bytesSent and bytesReceived are the bytes transferred to and
+	// from the backend.
+	bytesSent, bytesReceived atomic.Uint64
+
+	// lastUsed is the UnixNano time the backend was last selected
+	// or its last connection ended. Zero if never used.
+	lastUsed atomic.Int64
+
+	// series caches the metric series recorded for every connection to
+	// the backend. Nil until first used.
+	series atomic.Pointer[backendSeries]
+
+	// mu guards the close context and the TLS configuration.
+	mu sync.Mutex
+
+	// tlsClientConfig is the TLS configuration of the connections to
+	// the backend, holding its session cache. Nil until first used.
+	tlsClientConfig *tls.Config
+
+	// closeCtx is canceled to force-close the backend's active connections.
+	closeCtx context.Context
+
+	// closeCancel cancels closeCtx.
+	closeCancel context.CancelFunc
 }
 
 // incrementConnections increments the active connection count by one.
 func (b *Backend) incrementConnections() {
 	b.connections.Add(1)
+	b.fixHeaps()
+}
+
+// reserve increments the active connection count by one unless the
+// backend reached its connection limit, and reports whether it did.
+func (b *Backend) reserve() bool {
+	for {
+		connections := b.connections.Load()
+		if b.MaxConnections > 0 && connections >= b.MaxConnections {
+			return false
+		}
+		if b.connections.CompareAndSwap(connections, connections+1) {
+			b.fixHeaps()
+			return true
+		}
+	}
 }
 
 // decrementConnections decrements the active connection count by one.
 func (b *Backend) decrementConnections() {
-	b.connections.Add(-1)
+	b.adjustConnections(-1)
+}
+
+// adjustConnections adds delta to the active connection count, clamping
+// it at zero, as the count of a connection reserved with GetBackend may
+// have been corrected away by ReconcileConnections before its release.
+func (b *Backend) adjustConnections(delta int64) {
+	for {
+		connections := b.connections.Load()
+		if b.connections.CompareAndSwap(connections, max(connections+delta, 0)) {
+			b.fixHeaps()
+			return
+		}
+	}
 }
 
 // ConnectionCount returns the active connection count.
@@ -51,6 +196,35 @@ func (b *Backend) ConnectionCount() int64 {
 	return b.connections.Load()
 }
 
+// closeContext returns the context that is canceled when
+// the backend's active connections are force-closed.
+func (b *Backend) closeContext() context.Context {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closeCtx == nil {
+		b.closeCtx, b.closeCancel = context.WithCancel(context.Background())
+	}
+	return b.closeCtx
+}
+
+// closeConnections force-closes the backend's active connections.
+// Connections established afterwards are not affected.
+func (b *Backend) closeConnections() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closeCancel != nil {
+		b.closeCancel()
+	}
+	b.closeCtx, b.closeCancel = context.WithCancel(context.Background())
+}
+
+// atCapacity reports whether the backend reached its connection limit.
+func (b *Backend) atCapacity() bool {
+	return b.MaxConnections > 0 && b.ConnectionCount() >= b.MaxConnections
+}
+
 // LoadBalancer is responsible for managing a list of
 // backend servers and forwarding incoming requests
 // to them by leveraging least connections algorithm.
@@ -61,70 +235,447 @@ type LoadBalancer struct {
 	// backends is a list of registered backends ready to accept requests.
 	backends []*Backend
 
+	// index maps allowed backends entries to the registered backends.
+	index *backendIndex
+
 	// rateLimiter controls the rate of incoming connections.
 	rateLimiter *rateLimiter
 
 	// dialer is a dialer interface to establish backend connections.
 	dialer dialer
+
+	// queues hold connections waiting for backend capacity, per pool.
+	// Nil when queueing is disabled.
+	queues *admissionQueues
+
+	// transfer holds the settings of data transfers.
+	transfer transferOptions
+
+	// dialTimeout bounds the establishment of backend connections.
+	// Zero means no timeout.
+	dialTimeout time.Duration
+
+	// maxLifetime is the maximum duration of a proxied connection.
+	// Zero means unlimited.
+	maxLifetime time.Duration
+
+	// proxyProtocol enables sending a PROXY protocol v2 header to backends.
+	proxyProtocol bool
+
+	// proxyProtocolConnectionID enables the connection ID TLV
+	// in the PROXY protocol header.
+	proxyProtocolConnectionID bool
+
+	// instanceID is the ID of the load balancer appended to the loop
+	// detection TLV of the PROXY protocol header. The TLV is not sent if nil.
+	instanceID []byte
+
+	// selfAddress detects backends referring to the load balancer's own
+	// listener. Such backends are not checked if nil.
+	selfAddress *SelfAddressMatcher
+
+	// outlierDetection configures the ejection of outlier backends.
+	// Nil when outlier detection is disabled.
+	outlierDetection *OutlierDetection
+
+	// lastOutlierEvaluation is the UnixNano time of the last outlier evaluation.
+	lastOutlierEvaluation atomic.Int64
+
+	// passiveHealthCheck configures the ejection of backends after
+	// consecutive dial failures. Nil when disabled.
+	passiveHealthCheck *PassiveHealthCheck
+
+	// balancing is the balancing strategy. Empty means
+	// BalanceLeastConnections.
+	balancing BalancingStrategy
+
+	// activeGroups maps a pool name to its active deployment group.
+	// Backends of other groups in the pool are not selected.
+	activeGroups map[string]string
+
+	// groupDrains maps a pool name to the timer force-closing the
+	// connections left on its previously active groups, see
+	// SwitchPoolGroup. Guarded by mu.
+	groupDrains map[string]*time.Timer
+
+	// maintenance maps a pool in maintenance to the message sent to its
+	// clients. Backends of these pools are not selected.
+	maintenance map[string][]byte
+
+	// domainSpreading spreads the connections of every client across
+	// failure domains. Nil when connections are not spread.
+	domainSpreading *domainSpreading
+
+	// firstByteLatency adds the first-byte latency to the latency cost
+	// of backends.
+	firstByteLatency bool
+
+	// latencyObserver receives the latencies of backend connections.
+	// Nil when latencies are not observed.
+	latencyObserver LatencyObserver
+
+	// metrics holds the metrics recorded by the load balancer.
+	metrics *lbMetrics
+
+	// logger logs the events of the load balancer.
+	logger *logging.Logger
+
+	// featureFlags gate experimental behaviors. Nil turns them off.
+	featureFlags *featureflag.Set
+
+	// keepalives maps a pool name to the keepalive pings sent to the
+	// clients of its connections.
+	keepalives map[string]Keepalive
+
+	// dnsResolver defines how the hostnames of backends are looked up.
+	dnsResolver DNSResolver
+
+	// backendTLS maps a pool name to the TLS settings of the connections
+	// to its backends.
+	backendTLS map[string]BackendTLS
+
+	// metadataPools holds the pools whose backend connections start with
+	// a metadata frame.
+	metadataPools map[string]struct{}
+
+	// closes counts the ended transfers per close reason.
+	closes [closeReasonCount]atomic.Uint64
+}
+
+// Option configures optional LoadBalancer behavior.
+type Option func(*LoadBalancer)
+
+// WithAdmissionQueue enables queueing of connections that arrive while
+// all allowed backends are at capacity. Every pool has a queue of its
+// own, in which up to size connections wait for at most timeout before
+// being rejected, unless set otherwise with WithPoolAdmissionQueue.
+func WithAdmissionQueue(size int, timeout time.Duration) Option {
+	return func(lb *LoadBalancer) {
+		if size <= 0 || timeout <= 0 {
+			return
+		}
+		if lb.queues == nil {
+			lb.queues = newAdmissionQueues()
+		}
+		lb.queues.defaults = queueLimits{size: size, timeout: timeout}
+	}
+}
+
+// WithPoolAdmissionQueue sets the size and timeout of the admission
+// queue of the pool, overriding those of WithAdmissionQueue. A size of
+// zero disables queueing for the pool.
+func WithPoolAdmissionQueue(pool string, size int, timeout time.Duration) Option {
+	return func(lb *LoadBalancer) {
+		if lb.queues == nil {
+			lb.queues = newAdmissionQueues()
+		}
+		lb.queues.pools[pool] = queueLimits{size: size, timeout: timeout}
+	}
+}
+
+// WithIdleTimeouts sets the maximum time without data read from the
+// client and from the backend, respectively, before a proxied connection
+// is closed. Zero disables the timeout for that direction.
+func WithIdleTimeouts(clientIdle, backendIdle time.Duration) Option {
+	return func(lb *LoadBalancer) {
+		lb.transfer.clientIdle = clientIdle
+		lb.transfer.backendIdle = backendIdle
+	}
+}
+
+// WithDialTimeout bounds the establishment of backend connections, so
+// that an unresponsive backend fails the dial with ErrBackendUnreachable.
+// Zero means no timeout.
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(lb *LoadBalancer) {
+		lb.dialTimeout = timeout
+	}
+}
+
+// WithMaxLifetime sets the maximum duration of a proxied connection.
+// Zero means unlimited.
+func WithMaxLifetime(maxLifetime time.Duration) Option {
+	return func(lb *LoadBalancer) {
+		lb.maxLifetime = maxLifetime
+	}
+}
+
+// WithProxyProtocol enables sending a PROXY protocol v2 header with the
+// client's addresses to backends. If withConnectionID is set, the
+// connection ID carried by the routing context is included as a TLV.
+func WithProxyProtocol(withConnectionID bool) Option {
+	return func(lb *LoadBalancer) {
+		lb.proxyProtocol = true
+		lb.proxyProtocolConnectionID = withConnectionID
+	}
+}
+
+// WithClock sets the clock the rate limiter refills token buckets with,
+// e.g. to drive the load balancer in tests or simulations without waiting
+// for real time to pass. Defaults to the system clock.
+func WithClock(clock Clock) Option {
+	return func(lb *LoadBalancer) {
+		lb.rateLimiter.clock = clock
+	}
+}
+
+// WithLoopDetection includes a loop detection TLV in the PROXY protocol
+// header, listing the instance IDs of the load balancers the connection
+// went through, as carried by the routing context, followed by instanceID.
+// A load balancer further down the chain receiving its own ID rejects the
+// connection. Requires WithProxyProtocol.
+func WithLoopDetection(instanceID []byte) Option {
+	return func(lb *LoadBalancer) {
+		lb.instanceID = instanceID
+	}
+}
+
+// WithSelfAddress rejects backends added through transactions and
+// skips discovered backends that refer to the load balancer's own
+// listener, preventing proxy loops.
+func WithSelfAddress(matcher *SelfAddressMatcher) Option {
+	return func(lb *LoadBalancer) {
+		lb.selfAddress = matcher
+	}
+}
+
+// WithLogger sets the logger of the load balancer, e.g. one logging
+// through the embedder's slog handler. Defaults to logging.Default.
+func WithLogger(logger *logging.Logger) Option {
+	return func(lb *LoadBalancer) {
+		lb.logger = logger
+	}
 }
 
 // NewLoadBalancer initializes and returns a new LoadBalancer.
-func NewLoadBalancer(bucketCapacity, bucketRefillRate uint64) *LoadBalancer {
+func NewLoadBalancer(bucketCapacity, bucketRefillRate uint64, opts ...Option) *LoadBalancer {
 	// Initialize the rate limiter
 	rl := newRateLimiter(bucketCapacity, bucketRefillRate)
 
-	return &LoadBalancer{
-		rateLimiter: rl,
-		dialer:      &lbDialer{},
+	defaultDialer := &lbDialer{}
+	lb := &LoadBalancer{
+		rateLimiter:  rl,
+		index:        newBackendIndex(nil),
+		dialer:       defaultDialer,
+		activeGroups: make(map[string]string),
+		groupDrains:  make(map[string]*time.Timer),
+		maintenance:  make(map[string][]byte),
+		metrics:      newLBMetrics(metrics.Nop),
+		logger:       logging.Default(),
+	}
+	for _, opt := range opts {
+		opt(lb)
+	}
+	// Dialers wrapping the default one, e.g. the resolving dialer, are
+	// created by options applied in any order
+	defaultDialer.timeout = lb.dialTimeout
+	if d, ok := lb.dialer.(*resolvingDialer); ok {
+		d.useResolver(lb.dnsResolver)
+		d.logger = lb.logger
 	}
+	return lb
 }
 
 // AddBackend adds a backend server to the load balancer.
+// With the ResolvePinned strategy, a hostname backend is resolved here.
 func (lb *LoadBalancer) AddBackend(backend *Backend) {
+	// Resolve outside the lock, as lookups may be slow
+	if d, ok := lb.dialer.(*resolvingDialer); ok {
+		d.pin(backend.Address)
+	}
+
 	lb.mu.Lock()
 	defer lb.mu.Unlock()
 
+	if backend.Pool != "" {
+		backend.poolKey = PoolKey(backend.Pool)
+	}
 	lb.backends = append(lb.backends, backend)
+	lb.index.add(backend)
 }
 
-// GetBackend returns a backend server with the least connections by
-// iterating through the provided available backend servers pool and
-// matching with the provided list of allowed backends for the client.
-// It increments the connection count for the chosen backend before returning it.
+// Backends returns a snapshot of the registered backends.
+func (lb *LoadBalancer) Backends() []*Backend {
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+
+	backends := make([]*Backend, len(lb.backends))
+	copy(backends, lb.backends)
+	return backends
+}
+
+// GetBackend returns a backend server with the least connections relative
+// to its weight among the allowed backends for the client. Clients allowed
+// a single entry, e.g. a pool, are served from the entry's selection heap
+// in O(log n); other sets are matched against the allowed backends one by
+// one. It increments the connection count for the chosen backend before
+// returning it.
+//
+// The reservation is not registered as an active connection, unlike the
+// connections of RouteConnection and DialContext, so that
+// ReconcileConnections corrects it away if enabled. The count is clamped
+// at zero when the reservation is released afterwards. Use LeaseBackend
+// to keep it counted.
 func (lb *LoadBalancer) GetBackend(allowedBackends map[string]struct{}) (*Backend, error) {
+	return lb.getBackend("", nil, allowedBackends)
+}
+
+// getBackend is like GetBackend, but selects the backend by consistent
+// hashing of key if it is not empty, see BalanceConsistentHash, or else
+// among the backends of the failure domains with the fewest connections
+// in spread, the active connections of the client per failure domain.
+//
+// Selections only hold a read lock of lb.mu, so that concurrent
+// connections do not serialize on it, and reserve the selected backend
+// with a compare-and-swap of its connection count. A backend reaching its
+// connection limit after being selected by a concurrent selection is not
+// reserved, and the selection is retried.
+func (lb *LoadBalancer) getBackend(key string, spread map[string]int64, allowedBackends map[string]struct{}) (*Backend, error) {
 	// Acquire the lock
-	lb.mu.Lock()
-	defer lb.mu.Unlock()
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
 
 	// No registered backend servers
 	if len(lb.backends) == 0 {
 		return nil, ErrNoRegisteredBackends
 	}
 
+	for {
+		selectedBackend, err := lb.selectBackend(key, spread, allowedBackends)
+		if err != nil {
+			return nil, err
+		}
+
+		// Increment the connection count for the selected backend server
+		if selectedBackend.reserve() {
+			return selectedBackend, nil
+		}
+	}
+}
+
+// selectBackend returns the backend a new connection would be routed to
+// among the allowed backends, without reserving it. The caller must hold
+// at least a read lock of lb.mu.
+func (lb *LoadBalancer) selectBackend(key string, spread map[string]int64, allowedBackends map[string]struct{}) (*Backend, error) {
+	// Only visit the backends allowed by an entry of the set, unless
+	// the set is larger than the registered backends
+	backends := lb.backends
+	if len(allowedBackends) < len(backends) {
+		backends = lb.index.candidates(allowedBackends)
+	}
+
 	var selectedBackend *Backend
-	var leastConnectionCount int64
-	for _, backend := range lb.backends {
+	var leastConnectionCount, selectedWeight, selectedDomainLoad int64
+	var keyHash uint64
+	var highestScore, lowestCost float64
+	if key != "" {
+		keyHash = fnv64a(fnvOffset64, key)
+	}
+	var maintenanceErr *MaintenanceError
+	atCapacityFound := false
+
+	// Visit the backends from the least loaded one when selecting by
+	// least connections among the backends of a single entry, e.g. a pool,
+	// unless the client's connections are spread across failure domains
+	if key == "" && lb.balancing != BalanceLeastLatency && len(spread) == 0 {
+		if h := lb.index.selectionHeap(allowedBackends); h != nil {
+			visited := h.visit(func(backend *Backend) bool {
+				if !backend.isAllowed(allowedBackends) {
+					return false
+				}
+				switch _, skip := lb.eligibility(backend); skip {
+				case "":
+					selectedBackend = backend
+					return true
+				case SkipMaintenance:
+					maintenanceErr = lb.inMaintenance(backend)
+				case SkipAtCapacity:
+					atCapacityFound = true
+				}
+				return false
+			})
+			if visited {
+				backends = nil
+			}
+		}
+	}
+
+	for _, backend := range backends {
 		// Check if the backend is allowed for the client
-		if _, exists := allowedBackends[backend.Address]; !exists {
+		if !backend.isAllowed(allowedBackends) {
+			continue
+		}
+
+		weight, skip := lb.eligibility(backend)
+		switch skip {
+		case "":
+		case SkipMaintenance:
+			maintenanceErr = lb.inMaintenance(backend)
+			continue
+		case SkipAtCapacity:
+			atCapacityFound = true
+			continue
+		default:
 			continue
 		}
 
-		// Find the backend server with the least connections
+		// Find the backend server with the highest rendezvous score
+		if key != "" {
+			if score := rendezvousScore(keyHash, backend.Address, weight); selectedBackend == nil || score > highestScore {
+				selectedBackend = backend
+				highestScore = score
+			}
+			continue
+		}
+
+		// Only compare the backends of the failure domains with the fewest
+		// connections of the client
+		if spread != nil {
+			domainLoad := spread[backend.FailureDomain]
+			if selectedBackend != nil && domainLoad > selectedDomainLoad {
+				continue
+			}
+			if domainLoad < selectedDomainLoad {
+				selectedBackend = nil
+			}
+			selectedDomainLoad = domainLoad
+		}
+
+		// Find the backend server with the lowest latency cost, then the
+		// least connections per weight among backends of the same cost
+		if lb.balancing == BalanceLeastLatency {
+			cost := lb.latencyCost(backend, weight)
+			if selectedBackend == nil || cost < lowestCost ||
+				(cost == lowestCost && backend.ConnectionCount()*selectedWeight < leastConnectionCount*weight) {
+				selectedBackend = backend
+				lowestCost = cost
+				leastConnectionCount = backend.ConnectionCount()
+				selectedWeight = weight
+			}
+			continue
+		}
+
+		// Find the backend server with the least connections per weight,
+		// comparing the cross products to stay in integers
 		if selectedBackend == nil ||
-			backend.ConnectionCount() < leastConnectionCount {
+			backend.ConnectionCount()*selectedWeight < leastConnectionCount*weight {
 			selectedBackend = backend
 			leastConnectionCount = backend.ConnectionCount()
+			selectedWeight = weight
 		}
 	}
 
 	// No available backend
 	if selectedBackend == nil {
+		if atCapacityFound {
+			return nil, ErrBackendsAtCapacity
+		}
+		if maintenanceErr != nil {
+			return nil, maintenanceErr
+		}
 		return nil, ErrNoAvailableBackend
 	}
 
-	// Increment the connection count for the selected backend server
-	selectedBackend.incrementConnections()
-
 	return selectedBackend, nil
 }
 
@@ -134,43 +685,326 @@ func (lb *LoadBalancer) RouteConnection(
 	clientID string,
 	clientConn net.Conn,
 	allowedBackends map[string]struct{}) error {
-	// Check for rate limiting whether the client has sufficient tokens
-	if !lb.rateLimiter.allowConnection(clientID) {
+	return lb.RouteConnectionContext(context.Background(), clientID, clientConn, allowedBackends)
+}
+
+// RouteConnectionContext is like RouteConnection but stops transferring
+// data when ctx is done, e.g. on server shutdown. Multiple allowed
+// backend sets may be provided as an ordered fallback list: a set is
+// only used when no backend of the previous sets is available.
+func (lb *LoadBalancer) RouteConnectionContext(
+	ctx context.Context,
+	clientID string,
+	clientConn net.Conn,
+	allowedBackends ...map[string]struct{}) error {
+	// Check for rate limiting whether the client, or the key the
+	// connection is rate limited by, has sufficient tokens
+	key := rateLimitKey(ctx, clientID)
+	if !lb.rateLimiter.allowConnection(key) {
+		trace(ctx, "rate limited by key %s", key)
 		return ErrRateLimitReached
 	}
 
-	// Select a backend server with the least connections
-	selectedBackend, err := lb.GetBackend(allowedBackends)
+	// Select a backend server with the least connections,
+	// waiting in the admission queue if all of them are busy
+	selectStart := time.Now()
+	spread := lb.domainSpreading.load(clientID)
+	selectedBackend, err := lb.acquireBackend(ctx, lb.hashKey(ctx, clientID), spread, allowedBackends...)
 	if err != nil {
+		trace(ctx, "no backend selected after %s: %v", time.Since(selectStart), err)
 		return err
 	}
+	traced := tracing(ctx)
+	if traced {
+		trace(ctx, "selected backend %s of pool %s with %d connections in %s",
+			selectedBackend.Address, selectedBackend.Pool, selectedBackend.ConnectionCount(), time.Since(selectStart))
+	}
+	report := connectionReport(ctx)
+	if report != nil {
+		report.Backend, report.Pool = selectedBackend.Address, selectedBackend.Pool
+	}
+	selectedBackend.registry.add(clientConn)
+	backendConnections := lb.metrics.backendSeries(selectedBackend).connections
+	backendConnections.Inc()
+	selectedBackend.recordUse()
+	if lb.domainSpreading != nil {
+		lb.domainSpreading.add(clientID, selectedBackend.FailureDomain, 1)
+		defer lb.domainSpreading.add(clientID, selectedBackend.FailureDomain, -1)
+	}
 
-	// To accurately select a backend with the least connections,
-	// the connection count for each backend server has to be up-to-date
-	// and accurately reflect the current number of active connections.
-	// While both, incrementConnections() and decrementConnections() are
-	// atomic operations for each backend server, the mutex is used to
-	// prevent race conditions arising within the load balancer.
+	// The connection count is atomic, while the read lock keeps the
+	// selection heaps of the backend from being replaced as it is fixed
 	defer func() {
-		lb.mu.Lock()
+		selectedBackend.registry.remove(clientConn)
+		lb.mu.RLock()
 		// Decrement the connection count for the selected backend server
 		selectedBackend.decrementConnections()
-		lb.mu.Unlock()
+		lb.mu.RUnlock()
+		backendConnections.Dec()
+		selectedBackend.lastUsed.Store(time.Now().UnixNano())
+
+		// Wake up queued connections waiting for capacity
+		if lb.queues != nil {
+			lb.queues.notify(selectedBackend.Pool)
+		}
 	}()
 
 	// Establish a connection to the selected backend server
+	dialStart := time.Now()
 	backendConn, err := lb.dialer.Dial("tcp", selectedBackend.Address)
+	lb.recordDial(selectedBackend, time.Since(dialStart), err)
+	if traced {
+		trace(ctx, "dialed backend %s in %s (err: %v)", selectedBackend.Address, time.Since(dialStart), err)
+	}
 	if err != nil {
-		return err
+		lb.metrics.dialErrors.With(selectedBackend.Pool, selectedBackend.Address).Inc()
+		return fmt.Errorf("%w: %w", ErrBackendUnreachable, err)
 	}
 	defer backendConn.Close()
 
+	// Announce the client's addresses to the backend
+	if lb.proxyProtocol {
+		if err := lb.writeProxyHeader(ctx, clientConn, backendConn); err != nil {
+			return fmt.Errorf("%w: sending PROXY protocol header: %w", ErrBackendUnreachable, err)
+		}
+	}
+
+	// Secure the connection to the backend
+	backendConn, err = lb.handshakeBackend(ctx, selectedBackend, backendConn)
+	if err != nil {
+		lb.metrics.dialErrors.With(selectedBackend.Pool, selectedBackend.Address).Inc()
+		selectedBackend.history.recordHandshakeError(err)
+		return fmt.Errorf("%w: TLS handshake: %w", ErrBackendUnreachable, err)
+	}
+
+	// Describe the client to the backend
+	if err := lb.writeMetadataFrame(ctx, clientID, selectedBackend, backendConn); err != nil {
+		return fmt.Errorf("%w: sending metadata frame: %w", ErrBackendUnreachable, err)
+	}
+
+	// Measure the latencies of the backend, the dial latency including
+	// the TLS handshake
+	observer := lb.latencyObserver
+	selectedBackend.dialLatency.observe(time.Since(dialStart))
+	if observer != nil {
+		observer(selectedBackend, LatencyDial, time.Since(dialStart))
+	}
+	if lb.measuresFirstByte() {
+		backendConn = &firstByteConn{
+			Conn:  backendConn,
+			start: time.Now(),
+			report: func(latency time.Duration) {
+				selectedBackend.firstByteLatency.observe(latency)
+				if observer != nil {
+					observer(selectedBackend, LatencyFirstByte, latency)
+				}
+			},
+		}
+	}
+
+	// Bound the connection by its maximum lifetime
+	if lb.maxLifetime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, lb.maxLifetime)
+		defer cancel()
+	}
+
+	// Abort the transfer if the backend's connections are force-closed
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	stop := context.AfterFunc(selectedBackend.closeContext(), func() {
+		cancel(ErrBackendDrained)
+	})
+	defer stop()
+
+	// Keep the idle client connection alive with protocol-level pings
+	if keepalive, ok := lb.keepalives[selectedBackend.Pool]; ok {
+		keepaliveConn := newKeepaliveConn(clientConn, ConnectionIDFromContext(ctx), keepalive, selectedBackend.Pool, lb.metrics, lb.logger)
+		go keepaliveConn.run(ctx)
+		clientConn = keepaliveConn
+	}
+
 	// Bidirectional data transfer between the client and backend server.
 	// Waits till both sides complete copying data
-	err = transferData(clientConn, backendConn)
+	transfer := lb.transfer
+	transfer.pooledBuffers = lb.featureEnabled(ctx, FeaturePooledBuffers, selectedBackend.Pool, clientID)
+	transfer.sent, transfer.received = &selectedBackend.bytesSent, &selectedBackend.bytesReceived
+	reason, err := transferData(ctx, clientConn, backendConn, transfer)
+	if traced {
+		trace(ctx, "transfer with backend %s ended: %s (err: %v)", selectedBackend.Address, reason, err)
+	}
+	lb.recordClose(selectedBackend, reason)
+	if report != nil {
+		report.Transferred, report.Reason = true, reason
+	}
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// writeProxyHeader writes a PROXY protocol v2 header to the backend.
+func (lb *LoadBalancer) writeProxyHeader(ctx context.Context, clientConn, backendConn net.Conn) error {
+	var tlvs []proxyproto.TLV
+	if connectionID := ConnectionIDFromContext(ctx); lb.proxyProtocolConnectionID && connectionID != "" {
+		tlvs = append(tlvs, proxyproto.TLV{
+			Type:  proxyproto.TypeConnectionID,
+			Value: []byte(connectionID),
+		})
+	}
+	if lb.instanceID != nil {
+		path := append(slices.Clip(proxyPathFromContext(ctx)), lb.instanceID...)
+		tlvs = append(tlvs, proxyproto.TLV{
+			Type:  proxyproto.TypeLoopDetection,
+			Value: path,
+		})
+	}
+
+	header := proxyproto.HeaderV2(clientConn.RemoteAddr(), clientConn.LocalAddr(), tlvs...)
+	_, err := backendConn.Write(header)
+	return err
+}
+
+// getBackendWithFallback selects a backend from the first allowed backend
+// set that has an available backend. If no set has one, it returns
+// ErrBackendsAtCapacity if any backend was skipped for being at capacity,
+// so that the caller may wait for capacity to free up, or else a
+// MaintenanceError if any was skipped for being in maintenance.
+func (lb *LoadBalancer) getBackendWithFallback(key string, spread map[string]int64, allowedBackends []map[string]struct{}) (*Backend, error) {
+	if len(allowedBackends) == 0 {
+		return nil, ErrNoAvailableBackend
+	}
+
+	var lastErr error
+	for _, allowed := range allowedBackends {
+		backend, err := lb.getBackend(key, spread, allowed)
+		switch {
+		case err == nil:
+			return backend, nil
+		case errors.Is(err, ErrBackendsAtCapacity),
+			errors.Is(err, ErrPoolMaintenance),
+			errors.Is(err, ErrNoAvailableBackend):
+			lastErr = fallbackError(lastErr, err)
+		default:
+			return nil, err
+		}
+	}
+	return nil, lastErr
+}
+
+// fallbackError returns the error to report when no allowed backend set
+// has an available backend, out of the error of the sets tried so far
+// and err, the error of the next set: backends at capacity take
+// precedence over pools in maintenance, which take precedence over
+// backends otherwise unavailable.
+func fallbackError(lastErr, err error) error {
+	switch {
+	case errors.Is(err, ErrBackendsAtCapacity):
+		return err
+	case errors.Is(err, ErrPoolMaintenance):
+		if lastErr == nil || errors.Is(lastErr, ErrNoAvailableBackend) {
+			return err
+		}
+	case lastErr == nil:
+		return err
+	}
+	return lastErr
+}
+
+// acquireBackend selects a backend via getBackendWithFallback. If all
+// allowed backends are at capacity and the admission queue of the pool of
+// the first of them is enabled, the caller waits in that queue until
+// capacity frees up in any pool of its allowed backends, the queue
+// timeout expires or ctx is done.
+func (lb *LoadBalancer) acquireBackend(ctx context.Context, key string, spread map[string]int64, allowedBackends ...map[string]struct{}) (*Backend, error) {
+	backend, err := lb.getBackendWithFallback(key, spread, allowedBackends)
+	if lb.queues == nil || !errors.Is(err, ErrBackendsAtCapacity) {
+		return backend, err
+	}
+	queuePool, pools := lb.queuePools(allowedBackends)
+	queue := lb.queues.get(queuePool)
+	if queue == nil {
+		return nil, err
+	}
+
+	if !queue.enter() {
+		return nil, ErrQueueFull
+	}
+	queue.watch(pools)
+	lb.metrics.queued.Inc()
+	defer func() {
+		queue.unwatch(pools)
+		queue.leave()
+		lb.metrics.queued.Dec()
+	}()
+
+	timer := time.NewTimer(queue.timeout)
+	defer timer.Stop()
+
+	for {
+		// Grab the wakeup channel before retrying so that a release
+		// happening in between is not missed
+		released := queue.wakeup()
+
+		backend, err = lb.getBackendWithFallback(key, spread, allowedBackends)
+		if !errors.Is(err, ErrBackendsAtCapacity) {
+			return backend, err
+		}
+
+		select {
+		case <-released:
+		case <-timer.C:
+			return nil, ErrQueueTimeout
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// queuePools returns the pool of the first allowed backend at capacity,
+// whose admission queue a connection waits in, and the pools of all its
+// allowed backends, in which freed capacity wakes it up.
+func (lb *LoadBalancer) queuePools(allowedBackends []map[string]struct{}) (string, []string) {
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+
+	var pools []string
+	for _, allowed := range allowedBackends {
+		backends := lb.backends
+		if len(allowed) < len(backends) {
+			backends = lb.index.candidates(allowed)
+		}
+		for _, backend := range backends {
+			if backend.isAllowed(allowed) && !slices.Contains(pools, backend.Pool) {
+				pools = append(pools, backend.Pool)
+			}
+		}
+	}
+	return lb.queuePoolLocked(allowedBackends), pools
+}
+
+// queuePoolLocked is queuePool for callers already holding lb.mu.
+func (lb *LoadBalancer) queuePoolLocked(allowedBackends []map[string]struct{}) string {
+	for _, allowed := range allowedBackends {
+		backends := lb.backends
+		if len(allowed) < len(backends) {
+			backends = lb.index.candidates(allowed)
+		}
+		for _, backend := range backends {
+			if backend.isAllowed(allowed) && backend.atCapacity() {
+				return backend.Pool
+			}
+		}
+	}
+	return ""
+}
+
+// QueuedConnections returns the number of connections
+// currently waiting in the admission queue.
+func (lb *LoadBalancer) QueuedConnections() int64 {
+	if lb.queues == nil {
+		return 0
+	}
+	return lb.queues.queued()
+}
@@ -2,9 +2,13 @@ package lib
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -177,6 +181,51 @@ func TestLoadBalancer(t *testing.T) {
 	})
 }
 
+func TestGetBackendConcurrentCapacity(t *testing.T) {
+	require := require.New(t)
+
+	lb := NewLoadBalancer(uint64(5), uint64(1))
+	backends := make([]*Backend, 4)
+	for i := range backends {
+		backends[i] = &Backend{Address: fmt.Sprintf("127.0.0.1:500%d", i), Pool: "web", MaxConnections: 5}
+		lb.AddBackend(backends[i])
+	}
+	web := map[string]struct{}{PoolKey("web"): {}}
+	addresses := map[string]struct{}{backends[0].Address: {}, backends[1].Address: {}}
+
+	// Concurrent selections never exceed the connection limits
+	var wg sync.WaitGroup
+	var exceeded atomic.Bool
+	for i := 0; i < 50; i++ {
+		allowed := web
+		if i%2 == 1 {
+			allowed = addresses
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				backend, err := lb.GetBackend(allowed)
+				if err != nil {
+					continue
+				}
+				if backend.ConnectionCount() > backend.MaxConnections {
+					exceeded.Store(true)
+				}
+				lb.mu.RLock()
+				backend.decrementConnections()
+				lb.mu.RUnlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.False(exceeded.Load())
+	for _, backend := range backends {
+		require.Zero(backend.ConnectionCount())
+	}
+}
+
 // Mock connection for testing
 type mockConn struct {
 	readBuffer  *bytes.Buffer
@@ -234,3 +283,326 @@ func TestRouteConnection(t *testing.T) {
 	}
 	require.ErrorIs(ErrRateLimitReached, err, "Expected rate limit error")
 }
+
+func TestRouteConnectionRateLimitKey(t *testing.T) {
+	require := require.New(t)
+
+	lb := NewLoadBalancer(uint64(2), uint64(0))
+	lb.dialer = &mockDialer{}
+
+	backend := &Backend{Address: "127.0.0.1:5010"}
+	lb.AddBackend(backend)
+	allowedBackends := map[string]struct{}{backend.Address: {}}
+
+	// Clients of the same tenant share a bucket
+	ctx := WithRateLimitKey(context.Background(), "tenant=acme")
+	for _, clientID := range []string{"client1", "client2"} {
+		clientMockConn := &mockConn{readBuffer: new(bytes.Buffer), writeBuffer: new(bytes.Buffer)}
+		require.NoError(lb.RouteConnectionContext(ctx, clientID, clientMockConn, allowedBackends))
+	}
+
+	clientMockConn := &mockConn{readBuffer: new(bytes.Buffer), writeBuffer: new(bytes.Buffer)}
+	err := lb.RouteConnectionContext(ctx, "client3", clientMockConn, allowedBackends)
+	require.ErrorIs(err, ErrRateLimitReached, "Expected the tenant to be rate limited")
+
+	// Without a key, the client ID is used
+	err = lb.RouteConnection("client3", clientMockConn, allowedBackends)
+	require.NoError(err)
+}
+
+func TestAdmissionQueue(t *testing.T) {
+	require := require.New(t)
+
+	defaultCapacity := uint64(5)
+	defaulRefillRate := uint64(1)
+	allowedBackends := map[string]struct{}{
+		"127.0.0.1:5001": {},
+	}
+
+	t.Run("Reject at capacity without queue", func(t *testing.T) {
+		lb := NewLoadBalancer(defaultCapacity, defaulRefillRate)
+		lb.AddBackend(&Backend{Address: "127.0.0.1:5001", MaxConnections: 1})
+
+		_, err := lb.acquireBackend(context.Background(), "", nil, allowedBackends)
+		require.NoError(err)
+
+		_, err = lb.acquireBackend(context.Background(), "", nil, allowedBackends)
+		require.ErrorIs(err, ErrBackendsAtCapacity, "Expected ErrBackendsAtCapacity")
+	})
+
+	t.Run("Time out in queue", func(t *testing.T) {
+		lb := NewLoadBalancer(defaultCapacity, defaulRefillRate,
+			WithAdmissionQueue(1, 50*time.Millisecond))
+		lb.AddBackend(&Backend{Address: "127.0.0.1:5001", MaxConnections: 1})
+
+		_, err := lb.acquireBackend(context.Background(), "", nil, allowedBackends)
+		require.NoError(err)
+
+		_, err = lb.acquireBackend(context.Background(), "", nil, allowedBackends)
+		require.ErrorIs(err, ErrQueueTimeout, "Expected ErrQueueTimeout")
+		require.Equal(int64(0), lb.QueuedConnections())
+	})
+
+	t.Run("Admit after capacity is released", func(t *testing.T) {
+		lb := NewLoadBalancer(defaultCapacity, defaulRefillRate,
+			WithAdmissionQueue(1, time.Second))
+		backend := &Backend{Address: "127.0.0.1:5001", MaxConnections: 1}
+		lb.AddBackend(backend)
+
+		_, err := lb.acquireBackend(context.Background(), "", nil, allowedBackends)
+		require.NoError(err)
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			backend.decrementConnections()
+			lb.queues.notify("")
+		}()
+
+		b, err := lb.acquireBackend(context.Background(), "", nil, allowedBackends)
+		require.NoError(err)
+		require.Equal(backend.Address, b.Address)
+	})
+
+	t.Run("Reject when queue is full", func(t *testing.T) {
+		lb := NewLoadBalancer(defaultCapacity, defaulRefillRate,
+			WithAdmissionQueue(1, time.Second))
+		lb.AddBackend(&Backend{Address: "127.0.0.1:5001", MaxConnections: 1})
+
+		_, err := lb.acquireBackend(context.Background(), "", nil, allowedBackends)
+		require.NoError(err)
+
+		queue := lb.queues.get("")
+		require.True(queue.enter())
+		defer queue.leave()
+
+		_, err = lb.acquireBackend(context.Background(), "", nil, allowedBackends)
+		require.ErrorIs(err, ErrQueueFull, "Expected ErrQueueFull")
+	})
+
+	t.Run("Stop waiting when canceled", func(t *testing.T) {
+		lb := NewLoadBalancer(defaultCapacity, defaulRefillRate,
+			WithAdmissionQueue(1, time.Minute))
+		lb.AddBackend(&Backend{Address: "127.0.0.1:5001", MaxConnections: 1})
+
+		_, err := lb.acquireBackend(context.Background(), "", nil, allowedBackends)
+		require.NoError(err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		start := time.Now()
+		_, err = lb.acquireBackend(ctx, "", nil, allowedBackends)
+		require.ErrorIs(err, context.Canceled, "Expected context.Canceled")
+		require.Less(time.Since(start), time.Minute)
+		require.Equal(int64(0), lb.QueuedConnections())
+	})
+
+	t.Run("Queue per pool", func(t *testing.T) {
+		lb := NewLoadBalancer(defaultCapacity, defaulRefillRate,
+			WithAdmissionQueue(1, time.Second),
+			WithPoolAdmissionQueue("batch", 0, 0),
+			WithPoolAdmissionQueue("api", 1, 50*time.Millisecond))
+		lb.AddBackend(&Backend{Address: "127.0.0.1:5001", Pool: "api", MaxConnections: 1})
+		lb.AddBackend(&Backend{Address: "127.0.0.1:5002", Pool: "batch", MaxConnections: 1})
+		apiBackends := map[string]struct{}{"127.0.0.1:5001": {}}
+		batchBackends := map[string]struct{}{"127.0.0.1:5002": {}}
+
+		_, err := lb.acquireBackend(context.Background(), "", nil, apiBackends)
+		require.NoError(err)
+		_, err = lb.acquireBackend(context.Background(), "", nil, batchBackends)
+		require.NoError(err)
+
+		// Queueing is disabled for the batch pool
+		_, err = lb.acquireBackend(context.Background(), "", nil, batchBackends)
+		require.ErrorIs(err, ErrBackendsAtCapacity, "Expected ErrBackendsAtCapacity")
+
+		// The api pool has its own size and timeout
+		queue := lb.queues.get("api")
+		require.True(queue.enter())
+		_, err = lb.acquireBackend(context.Background(), "", nil, apiBackends)
+		require.ErrorIs(err, ErrQueueFull, "Expected ErrQueueFull")
+		queue.leave()
+
+		start := time.Now()
+		_, err = lb.acquireBackend(context.Background(), "", nil, apiBackends)
+		require.ErrorIs(err, ErrQueueTimeout, "Expected ErrQueueTimeout")
+		require.Less(time.Since(start), time.Second)
+	})
+
+	t.Run("Wake up on capacity of a fallback pool", func(t *testing.T) {
+		lb := NewLoadBalancer(defaultCapacity, defaulRefillRate,
+			WithAdmissionQueue(1, time.Minute),
+			WithPoolAdmissionQueue("batch", 0, 0))
+		primary := &Backend{Address: "127.0.0.1:5001", Pool: "api", MaxConnections: 1}
+		fallback := &Backend{Address: "127.0.0.1:5002", Pool: "batch", MaxConnections: 1}
+		lb.AddBackend(primary)
+		lb.AddBackend(fallback)
+		apiTier := map[string]struct{}{PoolKey("api"): {}}
+		batchTier := map[string]struct{}{PoolKey("batch"): {}}
+
+		_, err := lb.acquireBackend(context.Background(), "", nil, apiTier)
+		require.NoError(err)
+		_, err = lb.acquireBackend(context.Background(), "", nil, batchTier)
+		require.NoError(err)
+
+		// The connection waits in the queue of the api pool, and is routed
+		// to the batch pool it falls back to once it frees a slot
+		acquired := make(chan *Backend)
+		go func() {
+			backend, err := lb.acquireBackend(context.Background(), "", nil, apiTier, batchTier)
+			require.NoError(err)
+			acquired <- backend
+		}()
+		require.Eventually(func() bool { return lb.queues.get("api").queued() == 1 }, time.Second, time.Millisecond)
+
+		fallback.decrementConnections()
+		lb.queues.notify("batch")
+		select {
+		case backend := <-acquired:
+			require.Equal(fallback, backend)
+		case <-time.After(time.Second):
+			t.Fatal("Expected the queued connection to be woken up by the fallback pool")
+		}
+		require.Empty(lb.queues.get("api").fallbacks)
+	})
+}
+
+// Mock dialer that always fails for testing
+type failingDialer struct{}
+
+func (d *failingDialer) Dial(network, address string) (net.Conn, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestRouteConnectionDialFailure(t *testing.T) {
+	require := require.New(t)
+
+	lb := NewLoadBalancer(uint64(5), uint64(5))
+	lb.dialer = &failingDialer{}
+
+	backend := &Backend{Address: "127.0.0.1:5010"}
+	lb.AddBackend(backend)
+
+	allowedBackends := map[string]struct{}{
+		backend.Address: {},
+	}
+
+	err := lb.RouteConnection("client1", &mockConn{}, allowedBackends)
+	require.ErrorIs(err, ErrBackendUnreachable, "Expected ErrBackendUnreachable")
+	require.Equal(int64(0), backend.ConnectionCount(), "Expected connection count to be 0")
+}
+
+func TestRouteConnectionReport(t *testing.T) {
+	require := require.New(t)
+
+	lb := NewLoadBalancer(uint64(5), uint64(5))
+	lb.dialer = &mockDialer{}
+
+	backend := &Backend{Address: "127.0.0.1:5010", Pool: "pool1"}
+	lb.AddBackend(backend)
+	allowedBackends := map[string]struct{}{backend.Address: {}}
+
+	var report ConnectionReport
+	ctx := WithConnectionReport(context.Background(), &report)
+	clientMockConn := &mockConn{readBuffer: new(bytes.Buffer), writeBuffer: new(bytes.Buffer)}
+	require.NoError(lb.RouteConnectionContext(ctx, "client1", clientMockConn, allowedBackends))
+	require.Equal(backend.Address, report.Backend)
+	require.Equal("pool1", report.Pool)
+	require.True(report.Transferred)
+
+	// No backend is reported if none is selected
+	report = ConnectionReport{}
+	err := lb.RouteConnectionContext(ctx, "client1", clientMockConn, map[string]struct{}{"127.0.0.1:5011": {}})
+	require.Error(err)
+	require.Equal(ConnectionReport{}, report)
+}
+
+func TestDialTimeout(t *testing.T) {
+	require := require.New(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer listener.Close()
+
+	// The timeout applies to the dialer wrapped by the resolving dialer,
+	// whatever the order of the options
+	lb := NewLoadBalancer(uint64(5), uint64(5), WithDialTimeout(time.Nanosecond), WithResolution(ResolvePerDial, 0))
+	require.Equal(time.Nanosecond, lb.dialer.(*resolvingDialer).dialer.(*lbDialer).timeout)
+
+	backend := &Backend{Address: listener.Addr().String()}
+	lb.AddBackend(backend)
+
+	err = lb.RouteConnection("client1", &mockConn{}, map[string]struct{}{backend.Address: {}})
+	require.ErrorIs(err, ErrBackendUnreachable, "Expected the dial to time out")
+}
+
+func TestPoolFallback(t *testing.T) {
+	require := require.New(t)
+
+	primary := &Backend{Address: "127.0.0.1:5001", Pool: "primary", MaxConnections: 1}
+	secondary := &Backend{Address: "127.0.0.1:5002", Pool: "secondary"}
+
+	lb := NewLoadBalancer(uint64(5), uint64(1))
+	lb.AddBackend(primary)
+	lb.AddBackend(secondary)
+
+	tiers := []map[string]struct{}{
+		{primary.Address: {}},
+		{secondary.Address: {}},
+	}
+
+	b, err := lb.acquireBackend(context.Background(), "", nil, tiers...)
+	require.NoError(err)
+	require.Equal(primary.Address, b.Address, "Expected primary pool backend")
+
+	// Primary pool is at capacity
+	b, err = lb.acquireBackend(context.Background(), "", nil, tiers...)
+	require.NoError(err)
+	require.Equal(secondary.Address, b.Address, "Expected fallback to secondary pool")
+
+	// Unknown primary backends fall back as well
+	b, err = lb.acquireBackend(context.Background(), "", nil, map[string]struct{}{"127.0.0.1:5009": {}}, tiers[1])
+	require.NoError(err)
+	require.Equal(secondary.Address, b.Address, "Expected fallback to secondary pool")
+
+	_, err = lb.acquireBackend(context.Background(), "", nil)
+	require.ErrorIs(err, ErrNoAvailableBackend, "Expected ErrNoAvailableBackend")
+}
+
+// eofConn is a connection that is closed by its peer, without allocating
+// per dial, to measure the allocations of routing alone.
+type eofConn struct{}
+
+func (eofConn) Read(b []byte) (int, error)         { return 0, io.EOF }
+func (eofConn) Write(b []byte) (int, error)        { return len(b), nil }
+func (eofConn) Close() error                       { return nil }
+func (eofConn) LocalAddr() net.Addr                { return nil }
+func (eofConn) RemoteAddr() net.Addr               { return nil }
+func (eofConn) SetDeadline(t time.Time) error      { return nil }
+func (eofConn) SetReadDeadline(t time.Time) error  { return nil }
+func (eofConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// eofDialer dials eofConns.
+type eofDialer struct{}
+
+func (eofDialer) Dial(network, address string) (net.Conn, error) { return eofConn{}, nil }
+
+// BenchmarkRouteConnection measures the per-connection cost of routing a
+// connection, from the rate limiter to the end of its transfer.
+func BenchmarkRouteConnection(b *testing.B) {
+	lb := NewLoadBalancer(1<<62, 1<<20)
+	lb.dialer = eofDialer{}
+	for i := 0; i < 10; i++ {
+		lb.AddBackend(&Backend{Address: fmt.Sprintf("10.0.0.%d:80", i), Pool: "web"})
+	}
+	allowed := map[string]struct{}{PoolKey("web"): {}}
+	ctx := WithConnectionID(context.Background(), "0123456789abcdef")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := lb.RouteConnectionContext(ctx, "client1", eofConn{}, allowed); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package lib
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// ErrPoolMaintenance is returned when the backends allowed for a client
+// belong to pools in maintenance.
+var ErrPoolMaintenance = errors.New("pool is in maintenance")
+
+// MaintenanceError describes the pool in maintenance a connection
+// would have been routed to.
+type MaintenanceError struct {
+	// Pool is the pool in maintenance.
+	Pool string
+
+	// Message is the message sent to clients of the pool, empty if none.
+	Message []byte
+}
+
+// Error implements error.
+func (e *MaintenanceError) Error() string {
+	return fmt.Sprintf("pool '%s' is in maintenance", e.Pool)
+}
+
+// Unwrap returns ErrPoolMaintenance.
+func (e *MaintenanceError) Unwrap() error {
+	return ErrPoolMaintenance
+}
+
+// inMaintenance returns the maintenance error of the backend's pool,
+// or nil if it is not in maintenance. The caller must hold lb.mu.
+func (lb *LoadBalancer) inMaintenance(backend *Backend) *MaintenanceError {
+	message, ok := lb.maintenance[backend.Pool]
+	if !ok {
+		return nil
+	}
+	return &MaintenanceError{Pool: backend.Pool, Message: message}
+}
+
+// StartMaintenance puts a pool in maintenance: its backends stop receiving
+// new connections, which are routed to the client's next allowed backend
+// set if any, and fail with a MaintenanceError carrying the message
+// otherwise. Active connections are not affected. Starting the maintenance
+// of a pool already in maintenance replaces its message.
+func (lb *LoadBalancer) StartMaintenance(pool string, message []byte) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	lb.maintenance[pool] = bytes.Clone(message)
+}
+
+// EndMaintenance takes a pool out of maintenance. Returns false if the
+// pool was not in maintenance.
+func (lb *LoadBalancer) EndMaintenance(pool string) bool {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	_, ok := lb.maintenance[pool]
+	delete(lb.maintenance, pool)
+	return ok
+}
+
+// Maintenance returns the pools in maintenance mapped to their message.
+func (lb *LoadBalancer) Maintenance() map[string][]byte {
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+
+	maintenance := make(map[string][]byte, len(lb.maintenance))
+	for pool, message := range lb.maintenance {
+		maintenance[pool] = bytes.Clone(message)
+	}
+	return maintenance
+}
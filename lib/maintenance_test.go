@@ -0,0 +1,51 @@
+package lib
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenance(t *testing.T) {
+	require := require.New(t)
+
+	lb := NewLoadBalancer(uint64(5), uint64(1))
+	lb.AddBackend(&Backend{Address: "127.0.0.1:5001", Pool: "primary"})
+	lb.AddBackend(&Backend{Address: "127.0.0.1:5002", Pool: "secondary"})
+	primary := map[string]struct{}{PoolKey("primary"): {}}
+	secondary := map[string]struct{}{PoolKey("secondary"): {}}
+
+	lb.StartMaintenance("primary", []byte("down for maintenance\n"))
+	require.Equal(map[string][]byte{"primary": []byte("down for maintenance\n")}, lb.Maintenance())
+
+	t.Run("Clients of the pool receive the maintenance error", func(t *testing.T) {
+		_, err := lb.GetBackend(primary)
+		require.ErrorIs(err, ErrPoolMaintenance)
+
+		var maintenanceErr *MaintenanceError
+		require.True(errors.As(err, &maintenanceErr))
+		require.Equal("primary", maintenanceErr.Pool)
+		require.Equal("down for maintenance\n", string(maintenanceErr.Message))
+	})
+
+	t.Run("Clients fall back to their next allowed backend set", func(t *testing.T) {
+		backend, err := lb.getBackendWithFallback("", nil, []map[string]struct{}{primary, secondary})
+		require.NoError(err)
+		require.Equal("127.0.0.1:5002", backend.Address)
+		backend.decrementConnections()
+
+		_, err = lb.getBackendWithFallback("", nil, []map[string]struct{}{primary, {"127.0.0.1:5009": {}}})
+		require.ErrorIs(err, ErrPoolMaintenance)
+	})
+
+	t.Run("Ending the maintenance restores the pool", func(t *testing.T) {
+		require.True(lb.EndMaintenance("primary"))
+		require.False(lb.EndMaintenance("primary"))
+		require.Empty(lb.Maintenance())
+
+		backend, err := lb.GetBackend(primary)
+		require.NoError(err)
+		require.Equal("127.0.0.1:5001", backend.Address)
+	})
+}
@@ -0,0 +1,62 @@
+package lib
+
+import (
+	"context"
+	"net"
+
+	"github.com/rrasulzade/tcp-lb-go/metaframe"
+)
+
+// clientMetadataKey is the context key of the client metadata.
+type clientMetadataKey struct{}
+
+// ClientMetadata describes the client of a connection to the backends of
+// the pools with metadata framing, see WithMetadataFraming.
+type ClientMetadata struct {
+	// CommonName is the Common Name of the client certificate.
+	CommonName string
+
+	// Tags are the tags of the client, e.g. its tenant.
+	Tags map[string]string
+}
+
+// WithClientMetadata returns a copy of ctx carrying the client metadata.
+func WithClientMetadata(ctx context.Context, metadata ClientMetadata) context.Context {
+	return context.WithValue(ctx, clientMetadataKey{}, metadata)
+}
+
+// WithMetadataFraming prepends a metadata frame, see package metaframe,
+// to the connections to the backends of the pools, carrying the client ID
+// along with the connection ID and client metadata carried by the routing
+// context. The frame follows the PROXY protocol header and the TLS
+// handshake, if any, so that it is the first data the backend receives.
+func WithMetadataFraming(pools ...string) Option {
+	return func(lb *LoadBalancer) {
+		if lb.metadataPools == nil {
+			lb.metadataPools = make(map[string]struct{})
+		}
+		for _, pool := range pools {
+			lb.metadataPools[pool] = struct{}{}
+		}
+	}
+}
+
+// writeMetadataFrame writes a metadata frame to the backend if metadata
+// framing is enabled for its pool.
+func (lb *LoadBalancer) writeMetadataFrame(ctx context.Context, clientID string, backend *Backend, backendConn net.Conn) error {
+	if _, ok := lb.metadataPools[backend.Pool]; !ok {
+		return nil
+	}
+	client, _ := ctx.Value(clientMetadataKey{}).(ClientMetadata)
+	frame, err := metaframe.Encode(metaframe.Metadata{
+		ClientID:     clientID,
+		CommonName:   client.CommonName,
+		ConnectionID: ConnectionIDFromContext(ctx),
+		Tags:         client.Tags,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = backendConn.Write(frame)
+	return err
+}
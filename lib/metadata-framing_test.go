@@ -0,0 +1,44 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/rrasulzade/tcp-lb-go/metaframe"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadataFrame(t *testing.T) {
+	require := require.New(t)
+
+	lb := NewLoadBalancer(uint64(5), uint64(1), WithMetadataFraming("internal"))
+	ctx := WithConnectionID(context.Background(), "0123456789abcdef")
+	ctx = WithClientMetadata(ctx, ClientMetadata{
+		CommonName: "client1.example.com",
+		Tags:       map[string]string{"tenant": "a"},
+	})
+
+	t.Run("Pool with framing", func(t *testing.T) {
+		backendConn := &mockConn{readBuffer: new(bytes.Buffer), writeBuffer: new(bytes.Buffer)}
+		backend := &Backend{Address: "127.0.0.1:5001", Pool: "internal"}
+		require.NoError(lb.writeMetadataFrame(ctx, "c1", backend, backendConn))
+
+		metadata, err := metaframe.Read(backendConn.writeBuffer)
+		require.NoError(err)
+		require.Equal(&metaframe.Metadata{
+			ClientID:     "c1",
+			CommonName:   "client1.example.com",
+			ConnectionID: "0123456789abcdef",
+			Tags:         map[string]string{"tenant": "a"},
+		}, metadata)
+		require.Zero(backendConn.writeBuffer.Len())
+	})
+
+	t.Run("Pool without framing", func(t *testing.T) {
+		backendConn := &mockConn{readBuffer: new(bytes.Buffer), writeBuffer: new(bytes.Buffer)}
+		backend := &Backend{Address: "127.0.0.1:5002", Pool: "web"}
+		require.NoError(lb.writeMetadataFrame(ctx, "c1", backend, backendConn))
+		require.Zero(backendConn.writeBuffer.Len())
+	})
+}
@@ -0,0 +1,132 @@
+package lib
+
+import (
+	"sync/atomic"
+
+	"github.com/rrasulzade/tcp-lb-go/metrics"
+)
+
+// lbMetrics holds the metrics recorded by the load balancer.
+type lbMetrics struct {
+	// backendConnections is the number of active connections per backend.
+	backendConnections metrics.GaugeVec
+
+	// dialErrors counts failed backend dials per backend.
+	dialErrors metrics.CounterVec
+
+	// ejections counts outlier ejections per backend.
+	ejections metrics.CounterVec
+
+	// passiveEjections counts ejections after consecutive dial failures
+	// per backend.
+	passiveEjections metrics.CounterVec
+
+	// tlsHandshakes counts TLS handshakes with backends per backend and
+	// whether the session was resumed.
+	tlsHandshakes metrics.CounterVec
+
+	// weightPercent is the percentage of its weight each backend is
+	// served at when weights are adapted to health checks.
+	weightPercent metrics.GaugeVec
+
+	// closes counts ended connections per pool and close reason.
+	closes metrics.CounterVec
+
+	// keepalivePings counts keepalive pings sent to clients per pool.
+	keepalivePings metrics.CounterVec
+
+	// keepaliveTimeouts counts connections closed for unanswered
+	// keepalive pings per pool.
+	keepaliveTimeouts metrics.CounterVec
+
+	// queued is the number of connections waiting in the admission queue.
+	queued metrics.Gauge
+
+	// connectionCorrections counts the connections by which the
+	// connection count of each backend was corrected when reconciled.
+	connectionCorrections metrics.CounterVec
+}
+
+// newLBMetrics registers the load balancer metrics with the provided Metrics.
+func newLBMetrics(m metrics.Metrics) *lbMetrics {
+	return &lbMetrics{
+		backendConnections: m.Gauge("tcplb_backend_connections",
+			"Number of active connections per backend.", "pool", "backend"),
+		dialErrors: m.Counter("tcplb_backend_dial_errors_total",
+			"Total number of failed backend dials.", "pool", "backend"),
+		ejections: m.Counter("tcplb_backend_ejections_total",
+			"Total number of backend ejections by outlier detection.", "pool", "backend"),
+		passiveEjections: m.Counter("tcplb_backend_passive_ejections_total",
+			"Total number of backend ejections after consecutive dial failures.", "pool", "backend"),
+		tlsHandshakes: m.Counter("tcplb_backend_tls_handshakes_total",
+			"Total number of TLS handshakes with backends by whether the session was resumed.", "pool", "backend", "resumed"),
+		weightPercent: m.Gauge("tcplb_backend_weight_percent",
+			"Percentage of its weight each backend is served at after health check adjustment.", "pool", "backend"),
+		closes: m.Counter("tcplb_connection_closes_total",
+			"Total number of ended backend connections by close reason.", "pool", "reason"),
+		keepalivePings: m.Counter("tcplb_keepalive_pings_total",
+			"Total number of keepalive pings sent to idle clients.", "pool"),
+		keepaliveTimeouts: m.Counter("tcplb_keepalive_timeouts_total",
+			"Total number of connections closed for unanswered keepalive pings.", "pool"),
+		queued: m.Gauge("tcplb_admission_queue_connections",
+			"Number of connections waiting in the admission queue.").With(),
+		connectionCorrections: m.Counter("tcplb_backend_connection_corrections_total",
+			"Total number of connections by which backend connection counts were corrected when reconciled.", "pool", "backend"),
+	}
+}
+
+// backendSeries caches the metric series recorded for every connection to
+// a backend, so that routing a connection does not look them up by their
+// labels, which allocates.
+type backendSeries struct {
+	// owner is the metrics the series are recorded in.
+	owner *lbMetrics
+
+	// pool is the pool of the backend.
+	pool string
+
+	// connections is the number of active connections to the backend.
+	connections metrics.Gauge
+
+	// closes counts ended connections per close reason. Series are only
+	// looked up once a connection ends for their reason, so that unused
+	// reasons are not exposed.
+	closes [closeReasonCount]atomic.Pointer[metrics.Counter]
+}
+
+// backendSeries returns the cached series of the backend, looking them up
+// on first use.
+func (m *lbMetrics) backendSeries(backend *Backend) *backendSeries {
+	if series := backend.series.Load(); series != nil && series.owner == m {
+		return series
+	}
+	series := &backendSeries{
+		owner:       m,
+		pool:        backend.Pool,
+		connections: m.backendConnections.With(backend.Pool, backend.Address),
+	}
+	backend.series.Store(series)
+	return series
+}
+
+// close returns the counter of connections ended for the reason.
+func (s *backendSeries) close(reason CloseReason) metrics.Counter {
+	if reason < 0 || reason >= closeReasonCount {
+		return s.owner.closes.With(s.pool, reason.String())
+	}
+	if counter := s.closes[reason].Load(); counter != nil {
+		return *counter
+	}
+	counter := s.owner.closes.With(s.pool, reason.String())
+	s.closes[reason].Store(&counter)
+	return counter
+}
+
+// WithMetrics sets the Metrics the load balancer records its metrics
+// with, e.g. a metrics.Registry through metrics.FromRegistry. Metrics
+// are discarded by default.
+func WithMetrics(m metrics.Metrics) Option {
+	return func(lb *LoadBalancer) {
+		lb.metrics = newLBMetrics(m)
+	}
+}
@@ -0,0 +1,33 @@
+package lib
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/rrasulzade/tcp-lb-go/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithMetrics(t *testing.T) {
+	require := require.New(t)
+
+	registry := metrics.NewRegistry()
+	lb := NewLoadBalancer(uint64(5), uint64(5), WithMetrics(metrics.FromRegistry(registry)))
+	lb.dialer = &mockDialer{}
+	backend := &Backend{Address: "127.0.0.1:5010", Pool: "primary"}
+	lb.AddBackend(backend)
+	allowed := map[string]struct{}{backend.Address: {}}
+
+	clientMockConn := &mockConn{readBuffer: new(bytes.Buffer), writeBuffer: new(bytes.Buffer)}
+	require.NoError(lb.RouteConnection("client1", clientMockConn, allowed))
+
+	lb.dialer = &failingDialer{}
+	require.ErrorIs(lb.RouteConnection("client1", clientMockConn, allowed), ErrBackendUnreachable)
+
+	var buf bytes.Buffer
+	registry.Expose(&buf)
+	exposed := buf.String()
+	require.True(strings.Contains(exposed, `tcplb_backend_connections{pool="primary",backend="127.0.0.1:5010"} 0`), exposed)
+	require.True(strings.Contains(exposed, `tcplb_backend_dial_errors_total{pool="primary",backend="127.0.0.1:5010"} 1`), exposed)
+}
@@ -0,0 +1,214 @@
+package lib
+
+import (
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// maxEjectionMultiplier caps the growth of the ejection time
+// of a backend that is repeatedly ejected.
+const maxEjectionMultiplier = 10
+
+// minOutlierDetectionHosts is the minimum number of backends with enough
+// requests in a pool for the pool median to be meaningful.
+const minOutlierDetectionHosts = 3
+
+// OutlierDetection configures the ejection of backends whose dial latency
+// or connection error rate deviates from the median of their pool.
+type OutlierDetection struct {
+	// Interval is the time between two outlier evaluations.
+	Interval time.Duration
+
+	// BaseEjectionTime is the ejection time of a first ejection.
+	// Repeated ejections are multiplied by the number of ejections.
+	BaseEjectionTime time.Duration
+
+	// MaxEjectionPercent is the maximum percentage of a pool's
+	// backends that may be ejected at the same time.
+	MaxEjectionPercent int
+
+	// LatencyFactor ejects a backend whose mean dial latency exceeds
+	// the pool median by this factor. Zero disables latency ejection.
+	LatencyFactor float64
+
+	// ErrorRateThreshold ejects a backend whose dial error rate exceeds
+	// the pool median by this amount, between 0 and 1. Zero disables
+	// error rate ejection.
+	ErrorRateThreshold float64
+
+	// MinRequests is the minimum number of dials in an interval for
+	// a backend to be evaluated.
+	MinRequests int64
+}
+
+// dialStats accumulates a backend's dial outcomes over an evaluation interval.
+type dialStats struct {
+	// dials is the number of dial attempts.
+	dials atomic.Int64
+
+	// errors is the number of failed dial attempts.
+	errors atomic.Int64
+
+	// latency is the total latency of successful dials in nanoseconds.
+	latency atomic.Int64
+}
+
+// record records the outcome of a dial attempt.
+func (ds *dialStats) record(latency time.Duration, err error) {
+	ds.dials.Add(1)
+	if err != nil {
+		ds.errors.Add(1)
+		return
+	}
+	ds.latency.Add(int64(latency))
+}
+
+// take returns and resets the accumulated statistics.
+// Returns false if fewer than minRequests dials were recorded.
+func (ds *dialStats) take(minRequests int64) (errorRate, meanLatency float64, ok bool) {
+	dials := ds.dials.Swap(0)
+	errors := ds.errors.Swap(0)
+	latency := ds.latency.Swap(0)
+	if dials == 0 || dials < minRequests {
+		return 0, 0, false
+	}
+
+	errorRate = float64(errors) / float64(dials)
+	if successes := dials - errors; successes > 0 {
+		meanLatency = float64(latency) / float64(successes)
+	}
+	return errorRate, meanLatency, true
+}
+
+// intervalSample is a backend's dial statistics over one evaluation interval.
+type intervalSample struct {
+	backend     *Backend
+	errorRate   float64
+	meanLatency float64
+}
+
+// Ejected reports whether the backend is currently ejected from selection.
+func (b *Backend) Ejected() bool {
+	return time.Now().UnixNano() < b.ejectedUntil.Load()
+}
+
+// eject removes the backend from selection for the given duration.
+func (b *Backend) eject(duration time.Duration) {
+	b.ejectedUntil.Store(time.Now().Add(duration).UnixNano())
+}
+
+// WithOutlierDetection enables the ejection of outlier backends.
+func WithOutlierDetection(od OutlierDetection) Option {
+	return func(lb *LoadBalancer) {
+		if od.Interval > 0 && od.BaseEjectionTime > 0 && od.MaxEjectionPercent > 0 {
+			lb.outlierDetection = &od
+		}
+	}
+}
+
+// recordDial records the outcome of a dial to the backend for the passive
+// health check and runs the outlier evaluation if the evaluation interval
+// elapsed.
+func (lb *LoadBalancer) recordDial(backend *Backend, latency time.Duration, err error) {
+	backend.history.recordDial(err)
+	lb.recordDialOutcome(backend, err)
+	if lb.outlierDetection == nil {
+		return
+	}
+	backend.dialStats.record(latency, err)
+
+	// Only one caller runs the evaluation per interval
+	now := time.Now().UnixNano()
+	last := lb.lastOutlierEvaluation.Load()
+	if now-last < int64(lb.outlierDetection.Interval) {
+		return
+	}
+	if !lb.lastOutlierEvaluation.CompareAndSwap(last, now) {
+		return
+	}
+	lb.detectOutliers()
+}
+
+// detectOutliers compares each backend's dial statistics over the last
+// interval against its pool median and ejects the outliers, without
+// exceeding the maximum ejection percentage of the pool.
+func (lb *LoadBalancer) detectOutliers() {
+	od := lb.outlierDetection
+
+	// Group the evaluated backends by pool
+	pools := make(map[string][]*Backend)
+	samples := make(map[string][]intervalSample)
+	for _, backend := range lb.Backends() {
+		pools[backend.Pool] = append(pools[backend.Pool], backend)
+		errorRate, meanLatency, ok := backend.dialStats.take(od.MinRequests)
+		if !ok {
+			continue
+		}
+		samples[backend.Pool] = append(samples[backend.Pool], intervalSample{
+			backend:     backend,
+			errorRate:   errorRate,
+			meanLatency: meanLatency,
+		})
+	}
+
+	for pool, poolSamples := range samples {
+		if len(poolSamples) < minOutlierDetectionHosts {
+			continue
+		}
+
+		errorRates := make([]float64, len(poolSamples))
+		latencies := make([]float64, len(poolSamples))
+		for i, sample := range poolSamples {
+			errorRates[i] = sample.errorRate
+			latencies[i] = sample.meanLatency
+		}
+		medianErrorRate := median(errorRates)
+		medianLatency := median(latencies)
+
+		// Bound the number of ejected backends in the pool
+		ejected := 0
+		for _, backend := range pools[pool] {
+			if backend.Ejected() {
+				ejected++
+			}
+		}
+		maxEjected := max(1, len(pools[pool])*od.MaxEjectionPercent/100)
+
+		for _, sample := range poolSamples {
+			isOutlier := (od.ErrorRateThreshold > 0 && sample.errorRate-medianErrorRate > od.ErrorRateThreshold) ||
+				(od.LatencyFactor > 0 && medianLatency > 0 && sample.meanLatency > medianLatency*od.LatencyFactor)
+
+			if !isOutlier {
+				// Healthy intervals gradually reset the ejection multiplier
+				if sample.backend.ejections.Load() > 0 && !sample.backend.Ejected() {
+					sample.backend.ejections.Add(-1)
+				}
+				continue
+			}
+			if sample.backend.Ejected() || ejected >= maxEjected {
+				continue
+			}
+
+			multiplier := min(sample.backend.ejections.Add(1), maxEjectionMultiplier)
+			duration := od.BaseEjectionTime * time.Duration(multiplier)
+			sample.backend.eject(duration)
+			sample.backend.history.recordTransition(TransitionEjected, fmt.Sprintf("outlier for %s", duration))
+			lb.metrics.ejections.With(sample.backend.Pool, sample.backend.Address).Inc()
+			ejected++
+		}
+	}
+}
+
+// median returns the median of the provided values.
+func median(values []float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
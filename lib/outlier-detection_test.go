@@ -0,0 +1,90 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutlierDetection(t *testing.T) {
+	require := require.New(t)
+
+	newPool := func(od OutlierDetection) (*LoadBalancer, []*Backend) {
+		lb := NewLoadBalancer(uint64(5), uint64(1), WithOutlierDetection(od))
+		backends := make([]*Backend, 5)
+		for i := range backends {
+			backends[i] = &Backend{Address: fmt.Sprintf("127.0.0.1:500%d", i), Pool: "web"}
+			lb.AddBackend(backends[i])
+		}
+		return lb, backends
+	}
+
+	t.Run("Eject slow backend", func(t *testing.T) {
+		lb, backends := newPool(OutlierDetection{
+			Interval:           time.Hour,
+			BaseEjectionTime:   time.Minute,
+			MaxEjectionPercent: 20,
+			LatencyFactor:      3,
+		})
+		for i, backend := range backends {
+			latency := time.Millisecond
+			if i == 0 {
+				latency = 10 * time.Millisecond
+			}
+			backend.dialStats.record(latency, nil)
+		}
+
+		lb.detectOutliers()
+		require.True(backends[0].Ejected(), "Expected slow backend to be ejected")
+		for _, backend := range backends[1:] {
+			require.False(backend.Ejected())
+		}
+
+		allowedBackends := map[string]struct{}{backends[0].Address: {}}
+		_, err := lb.GetBackend(allowedBackends)
+		require.ErrorIs(err, ErrNoAvailableBackend, "Expected ejected backend to be skipped")
+	})
+
+	t.Run("Eject failing backends up to max percent", func(t *testing.T) {
+		lb, backends := newPool(OutlierDetection{
+			Interval:           time.Hour,
+			BaseEjectionTime:   time.Minute,
+			MaxEjectionPercent: 20,
+			ErrorRateThreshold: 0.5,
+		})
+		for i, backend := range backends {
+			var err error
+			if i < 2 {
+				err = errors.New("connection refused")
+			}
+			backend.dialStats.record(time.Millisecond, err)
+		}
+
+		lb.detectOutliers()
+		ejected := 0
+		for _, backend := range backends {
+			if backend.Ejected() {
+				ejected++
+			}
+		}
+		require.Equal(1, ejected, "Expected ejections bounded to 20% of the pool")
+	})
+
+	t.Run("Skip pools with too few samples", func(t *testing.T) {
+		lb, backends := newPool(OutlierDetection{
+			Interval:           time.Hour,
+			BaseEjectionTime:   time.Minute,
+			MaxEjectionPercent: 100,
+			LatencyFactor:      1.1,
+			MinRequests:        2,
+		})
+		backends[0].dialStats.record(time.Second, nil)
+		backends[0].dialStats.record(time.Second, nil)
+
+		lb.detectOutliers()
+		require.False(backends[0].Ejected())
+	})
+}
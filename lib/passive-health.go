@@ -0,0 +1,62 @@
+package lib
+
+import (
+	"fmt"
+	"time"
+)
+
+// PassiveHealthCheck configures the ejection of backends that repeatedly
+// fail to be dialed while routing connections, without waiting for the
+// next active health check or outlier evaluation.
+type PassiveHealthCheck struct {
+	// ConsecutiveFailures is the number of consecutive failed dials
+	// after which a backend is ejected.
+	ConsecutiveFailures int64
+
+	// Cooldown is the time an ejected backend is kept out of selection.
+	// The backend is admitted again once it elapsed, and ejected again
+	// after ConsecutiveFailures further failed dials.
+	Cooldown time.Duration
+}
+
+// WithPassiveHealthCheck enables the ejection of backends after
+// consecutive dial failures.
+func WithPassiveHealthCheck(phc PassiveHealthCheck) Option {
+	return func(lb *LoadBalancer) {
+		if phc.ConsecutiveFailures > 0 && phc.Cooldown > 0 {
+			lb.passiveHealthCheck = &phc
+		}
+	}
+}
+
+// ConsecutiveDialFailures returns the number of dials to the backend that
+// failed since the last successful dial or passive ejection.
+func (b *Backend) ConsecutiveDialFailures() int64 {
+	return b.consecutiveFailures.Load()
+}
+
+// recordDialOutcome counts the consecutive dial failures of the backend and
+// ejects it for the cooldown once they reach the threshold.
+func (lb *LoadBalancer) recordDialOutcome(backend *Backend, err error) {
+	phc := lb.passiveHealthCheck
+	if phc == nil {
+		return
+	}
+	if err == nil {
+		backend.consecutiveFailures.Store(0)
+		return
+	}
+
+	if backend.consecutiveFailures.Add(1) < phc.ConsecutiveFailures {
+		return
+	}
+	// Only the caller reaching the threshold ejects the backend, dials
+	// already in flight when it was ejected count towards the next one
+	backend.consecutiveFailures.Store(0)
+	if backend.Ejected() {
+		return
+	}
+	backend.eject(phc.Cooldown)
+	backend.history.recordTransition(TransitionEjected, fmt.Sprintf("%d consecutive dial failures for %s", phc.ConsecutiveFailures, phc.Cooldown))
+	lb.metrics.passiveEjections.With(backend.Pool, backend.Address).Inc()
+}
@@ -0,0 +1,97 @@
+package lib
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Mock dialer whose dials fail while failing is set
+type toggleDialer struct {
+	failing atomic.Bool
+}
+
+func (d *toggleDialer) Dial(network, address string) (net.Conn, error) {
+	if d.failing.Load() {
+		return nil, errors.New("connection refused")
+	}
+	return &mockConn{readBuffer: new(bytes.Buffer), writeBuffer: new(bytes.Buffer)}, nil
+}
+
+func TestPassiveHealthCheck(t *testing.T) {
+	require := require.New(t)
+
+	newLB := func(phc PassiveHealthCheck) (*LoadBalancer, *toggleDialer, *Backend) {
+		lb := NewLoadBalancer(uint64(100), uint64(100), WithPassiveHealthCheck(phc))
+		dialer := &toggleDialer{}
+		lb.dialer = dialer
+		backend := &Backend{Address: "127.0.0.1:5010", Pool: "web"}
+		lb.AddBackend(backend)
+		return lb, dialer, backend
+	}
+	route := func(lb *LoadBalancer, backend *Backend) error {
+		conn := &mockConn{readBuffer: new(bytes.Buffer), writeBuffer: new(bytes.Buffer)}
+		return lb.RouteConnection("client1", conn, map[string]struct{}{backend.Address: {}})
+	}
+
+	t.Run("Eject after consecutive failures", func(t *testing.T) {
+		lb, dialer, backend := newLB(PassiveHealthCheck{ConsecutiveFailures: 3, Cooldown: time.Minute})
+		dialer.failing.Store(true)
+
+		for i := 0; i < 2; i++ {
+			require.ErrorIs(route(lb, backend), ErrBackendUnreachable)
+		}
+		require.False(backend.Ejected(), "Expected backend to stay in rotation below the threshold")
+		require.Equal(int64(2), backend.ConsecutiveDialFailures())
+
+		require.ErrorIs(route(lb, backend), ErrBackendUnreachable)
+		require.True(backend.Ejected(), "Expected backend to be ejected at the threshold")
+		require.Equal(int64(0), backend.ConsecutiveDialFailures())
+
+		require.ErrorIs(route(lb, backend), ErrNoAvailableBackend, "Expected ejected backend to be skipped")
+	})
+
+	t.Run("Reset on successful dial", func(t *testing.T) {
+		lb, dialer, backend := newLB(PassiveHealthCheck{ConsecutiveFailures: 2, Cooldown: time.Minute})
+
+		dialer.failing.Store(true)
+		require.ErrorIs(route(lb, backend), ErrBackendUnreachable)
+		dialer.failing.Store(false)
+		require.NoError(route(lb, backend))
+		require.Equal(int64(0), backend.ConsecutiveDialFailures())
+
+		dialer.failing.Store(true)
+		require.ErrorIs(route(lb, backend), ErrBackendUnreachable)
+		require.False(backend.Ejected(), "Expected failures before a successful dial not to count")
+	})
+
+	t.Run("Readmit after cooldown", func(t *testing.T) {
+		lb, dialer, backend := newLB(PassiveHealthCheck{ConsecutiveFailures: 1, Cooldown: 50 * time.Millisecond})
+
+		dialer.failing.Store(true)
+		require.ErrorIs(route(lb, backend), ErrBackendUnreachable)
+		require.True(backend.Ejected())
+
+		dialer.failing.Store(false)
+		require.Eventually(func() bool {
+			return !backend.Ejected()
+		}, time.Second, 10*time.Millisecond, "Expected backend to be readmitted after the cooldown")
+		require.NoError(route(lb, backend))
+	})
+
+	t.Run("Disabled without threshold", func(t *testing.T) {
+		lb, dialer, backend := newLB(PassiveHealthCheck{Cooldown: time.Minute})
+		require.Nil(lb.passiveHealthCheck)
+
+		dialer.failing.Store(true)
+		for i := 0; i < 5; i++ {
+			require.ErrorIs(route(lb, backend), ErrBackendUnreachable)
+		}
+		require.False(backend.Ejected())
+	})
+}
@@ -0,0 +1,110 @@
+package lib
+
+import "slices"
+
+// PoolPrefix marks an allowed backends entry that refers to a whole pool
+// (e.g. "pool:primary") rather than to a single backend address, so that
+// backends joining the pool at runtime are allowed as well.
+const PoolPrefix = "pool:"
+
+// DenyPrefix marks an allowed backends entry that denies a backend address
+// or pool (e.g. "!pool:primary") even if it is allowed by another entry.
+const DenyPrefix = "!"
+
+// PoolKey returns the allowed backends entry referring to the given pool.
+func PoolKey(pool string) string {
+	return PoolPrefix + pool
+}
+
+// DenyKey returns the allowed backends entry denying the given
+// backend address or pool key.
+func DenyKey(entry string) string {
+	return DenyPrefix + entry
+}
+
+// isAllowed reports whether the backend is allowed by address or by pool.
+// Deny entries take precedence over allow entries.
+func (b *Backend) isAllowed(allowedBackends map[string]struct{}) bool {
+	if _, denied := allowedBackends[b.denyAddressKey]; denied {
+		return false
+	}
+	if b.denyPoolKey != "" {
+		if _, denied := allowedBackends[b.denyPoolKey]; denied {
+			return false
+		}
+	}
+	if _, exists := allowedBackends[b.Address]; exists {
+		return true
+	}
+	if b.poolKey == "" {
+		return false
+	}
+	_, exists := allowedBackends[b.poolKey]
+	return exists
+}
+
+// AllowedBy reports whether the backend is allowed by the allowed
+// backends set, see isAllowed.
+func (b *Backend) AllowedBy(allowedBackends map[string]struct{}) bool {
+	return b.isAllowed(allowedBackends)
+}
+
+// SetPoolBackends replaces the backends of a pool with the provided ones,
+// e.g. when service discovery reports a new backend set. Backends whose
+// address is already registered in the pool are kept, preserving their
+// connection counts. Removed backends stop receiving new connections
+// while their active connections continue. Backends referring to the load
+// balancer's own listener are skipped, see WithSelfAddress.
+// Returns the added and removed backends.
+func (lb *LoadBalancer) SetPoolBackends(pool string, backends []*Backend) (added, removed []*Backend) {
+	// Resolve outside the lock, as lookups may be slow
+	if lb.selfAddress != nil {
+		backends = slices.DeleteFunc(slices.Clone(backends), func(backend *Backend) bool {
+			if lb.selfAddress.Matches(backend.Address) {
+				lb.logger.Warnf("Ignoring backend %s of pool %s: %v", backend.Address, pool, ErrSelfBackend)
+				return true
+			}
+			return false
+		})
+	}
+
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	desired := make(map[string]*Backend, len(backends))
+	for _, backend := range backends {
+		desired[backend.Address] = backend
+	}
+
+	// Keep the backends of other pools and the ones still in the pool
+	kept := make([]*Backend, 0, len(lb.backends)+len(backends))
+	existing := make(map[string]struct{})
+	for _, backend := range lb.backends {
+		if backend.Pool != pool {
+			kept = append(kept, backend)
+			continue
+		}
+		if _, ok := desired[backend.Address]; !ok {
+			removed = append(removed, backend)
+			continue
+		}
+		kept = append(kept, backend)
+		existing[backend.Address] = struct{}{}
+	}
+
+	// Register the new backends
+	for _, backend := range backends {
+		if _, ok := existing[backend.Address]; ok {
+			continue
+		}
+		backend.Pool = pool
+		backend.poolKey = PoolKey(pool)
+		kept = append(kept, backend)
+		added = append(added, backend)
+		existing[backend.Address] = struct{}{}
+	}
+
+	lb.backends = kept
+	lb.index = newBackendIndex(kept)
+	return added, removed
+}
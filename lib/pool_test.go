@@ -0,0 +1,85 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetPoolBackends(t *testing.T) {
+	require := require.New(t)
+
+	lb := NewLoadBalancer(uint64(5), uint64(1))
+	lb.AddBackend(&Backend{Address: "127.0.0.1:5001", Pool: "default"})
+	allowedBackends := map[string]struct{}{PoolKey("web"): {}}
+
+	t.Run("Empty pool", func(t *testing.T) {
+		_, err := lb.GetBackend(allowedBackends)
+		require.ErrorIs(err, ErrNoAvailableBackend)
+	})
+
+	first := &Backend{Address: "127.0.0.1:6001"}
+	second := &Backend{Address: "127.0.0.1:6002"}
+
+	t.Run("Add discovered backends", func(t *testing.T) {
+		added, removed := lb.SetPoolBackends("web", []*Backend{first, second})
+		require.Len(added, 2)
+		require.Empty(removed)
+		require.Len(lb.Backends(), 3)
+
+		b, err := lb.GetBackend(allowedBackends)
+		require.NoError(err)
+		require.Equal("web", b.Pool, "Expected a backend of the pool")
+	})
+
+	t.Run("Keep existing backends", func(t *testing.T) {
+		connections := first.connections.Load() + second.connections.Load()
+
+		replacement := &Backend{Address: "127.0.0.1:6002"}
+		third := &Backend{Address: "127.0.0.1:6003"}
+		added, removed := lb.SetPoolBackends("web", []*Backend{replacement, third})
+		require.Equal([]*Backend{third}, added)
+		require.Equal([]*Backend{first}, removed)
+
+		backends := lb.Backends()
+		require.Len(backends, 3)
+		require.Contains(backends, second, "Expected the existing backend to be kept")
+		require.NotContains(backends, replacement)
+		require.Equal(connections, first.connections.Load()+second.connections.Load())
+	})
+
+	t.Run("Remove all backends", func(t *testing.T) {
+		_, removed := lb.SetPoolBackends("web", nil)
+		require.Len(removed, 2)
+		require.Len(lb.Backends(), 1)
+
+		_, err := lb.GetBackend(allowedBackends)
+		require.ErrorIs(err, ErrNoAvailableBackend)
+	})
+}
+
+func TestDenyEntries(t *testing.T) {
+	require := require.New(t)
+
+	lb := NewLoadBalancer(uint64(5), uint64(1))
+	lb.SetPoolBackends("web", []*Backend{{Address: "127.0.0.1:6001"}, {Address: "127.0.0.1:6002"}})
+
+	// A denied backend is skipped even though its pool is allowed
+	allowedBackends := map[string]struct{}{
+		PoolKey("web"):            {},
+		DenyKey("127.0.0.1:6001"): {},
+	}
+	for i := 0; i < 3; i++ {
+		b, err := lb.GetBackend(allowedBackends)
+		require.NoError(err)
+		require.Equal("127.0.0.1:6002", b.Address)
+	}
+
+	// A denied pool takes precedence over allowed addresses
+	allowedBackends = map[string]struct{}{
+		"127.0.0.1:6002":        {},
+		DenyKey(PoolKey("web")): {},
+	}
+	_, err := lb.GetBackend(allowedBackends)
+	require.ErrorIs(err, ErrNoAvailableBackend)
+}
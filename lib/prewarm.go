@@ -0,0 +1,73 @@
+package lib
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// PrewarmResult is the outcome of a probe connection to a backend.
+type PrewarmResult struct {
+	// Backend is the probed backend.
+	Backend *Backend
+
+	// Latency is the time it took to connect.
+	Latency time.Duration
+
+	// Err is the reason the backend could not be reached, if any.
+	Err error
+}
+
+// Prewarm opens and immediately closes a probe connection to each of the
+// given backends in parallel, so that misconfigured or unreachable
+// backends are reported right away rather than on the first client
+// connection. A backend that does not accept the connection within
+// timeout is reported as unreachable. Results are in the order of backends.
+// Probes do not count towards outlier detection.
+func (lb *LoadBalancer) Prewarm(backends []*Backend, timeout time.Duration) []PrewarmResult {
+	results := make([]PrewarmResult, len(backends))
+	done := make(chan int, len(backends))
+
+	for i, backend := range backends {
+		go func(i int, backend *Backend) {
+			results[i] = lb.probe(backend, timeout)
+			done <- i
+		}(i, backend)
+	}
+	for range backends {
+		<-done
+	}
+	return results
+}
+
+// probe opens and closes a connection to the backend.
+func (lb *LoadBalancer) probe(backend *Backend, timeout time.Duration) PrewarmResult {
+	type dialResult struct {
+		conn net.Conn
+		err  error
+	}
+	dialed := make(chan dialResult, 1)
+
+	start := time.Now()
+	go func() {
+		conn, err := lb.dialer.Dial("tcp", backend.Address)
+		dialed <- dialResult{conn, err}
+	}()
+
+	select {
+	case d := <-dialed:
+		if d.err != nil {
+			return PrewarmResult{Backend: backend, Latency: time.Since(start), Err: d.err}
+		}
+		d.conn.Close()
+		return PrewarmResult{Backend: backend, Latency: time.Since(start)}
+	case <-time.After(timeout):
+		// Close the connection should the dial still succeed
+		go func() {
+			if d := <-dialed; d.err == nil {
+				d.conn.Close()
+			}
+		}()
+		return PrewarmResult{Backend: backend, Latency: timeout, Err: fmt.Errorf("timed out after %s", timeout)}
+	}
+}
@@ -0,0 +1,39 @@
+package lib
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Mock dialer that never connects for testing
+type blockingDialer struct{}
+
+func (d *blockingDialer) Dial(network, address string) (net.Conn, error) {
+	select {}
+}
+
+func TestPrewarm(t *testing.T) {
+	require := require.New(t)
+
+	lb := NewLoadBalancer(10, 10)
+	backends := []*Backend{{Address: "127.0.0.1:5010"}, {Address: "127.0.0.1:5011"}}
+
+	lb.dialer = &mockDialer{}
+	results := lb.Prewarm(backends, time.Second)
+	require.Len(results, 2)
+	for i, result := range results {
+		require.NoError(result.Err)
+		require.Same(backends[i], result.Backend)
+	}
+
+	lb.dialer = &failingDialer{}
+	results = lb.Prewarm(backends, time.Second)
+	require.Error(results[0].Err)
+
+	lb.dialer = &blockingDialer{}
+	results = lb.Prewarm(backends[:1], 10*time.Millisecond)
+	require.ErrorContains(results[0].Err, "timed out")
+}
@@ -0,0 +1,21 @@
+package lib
+
+import "context"
+
+// rateLimitKeyKey is the context key of the rate limiting key.
+type rateLimitKeyKey struct{}
+
+// WithRateLimitKey returns a copy of ctx carrying the key the connection
+// is rate limited by, e.g. a tenant or SNI, instead of its client ID.
+func WithRateLimitKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, rateLimitKeyKey{}, key)
+}
+
+// rateLimitKey returns the rate limiting key carried by ctx,
+// or clientID if ctx carries none.
+func rateLimitKey(ctx context.Context, clientID string) string {
+	if key, ok := ctx.Value(rateLimitKeyKey{}).(string); ok {
+		return key
+	}
+	return clientID
+}
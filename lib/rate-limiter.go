@@ -1,12 +1,32 @@
 package lib
 
 import (
+	"math"
 	"sync"
 	"time"
 )
 
+// Clock tells the current time. It is injected with WithClock so that
+// tests and simulations can control the passing of time.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+}
+
+// systemClock is the Clock telling the system time.
+type systemClock struct{}
+
+// Now implements Clock.
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
 // tokenBucket represents a token bucket rate limiter.
 type tokenBucket struct {
+	// mu ensures concurrent access to the bucket, so that clients
+	// taking tokens from their own bucket do not contend.
+	mu sync.Mutex
+
 	// capacity is the maximum number of tokens the bucket can hold.
 	capacity uint64
 
@@ -23,20 +43,25 @@ type tokenBucket struct {
 	lastRefillTime time.Time
 }
 
-// newTokenBucket initializes and returns a new tokenBucket.
-func newTokenBucket(capacity, refillRate uint64) *tokenBucket {
+// newTokenBucket initializes and returns a new full tokenBucket
+// created at the given time.
+func newTokenBucket(capacity, refillRate uint64, now time.Time) *tokenBucket {
 	return &tokenBucket{
 		capacity:       capacity,
 		tokens:         capacity,
 		refillRate:     refillRate,
-		lastRefillTime: time.Now(),
+		lastRefillTime: now,
 	}
 }
 
 // refillTokens refills the bucket based on the elapsed
-// time since the last refill.
-func (tb *tokenBucket) refillTokens() {
-	now := time.Now()
+// time since the last refill. The caller must hold tb.mu.
+func (tb *tokenBucket) refillTokens(now time.Time) {
+	// Concurrent callers may read the clock in a different order
+	// than they lock the bucket
+	if !now.After(tb.lastRefillTime) {
+		return
+	}
 	elapsed := now.Sub(tb.lastRefillTime).Seconds()
 	refillAmount := elapsed * float64(tb.refillRate)
 
@@ -50,16 +75,17 @@ func (tb *tokenBucket) refillTokens() {
 		tb.fractionalTokens--
 	}
 
-	if refillAmount > 0 {
-		tb.tokens = min(tb.capacity, tb.tokens+wholeTokens)
-		tb.lastRefillTime = now
-	}
+	tb.tokens = min(tb.capacity, tb.tokens+wholeTokens)
+	tb.lastRefillTime = now
 }
 
-// takeToken attempts to take a token from the bucket.
-func (tb *tokenBucket) takeToken() bool {
+// takeToken attempts to take a token from the bucket at the given time.
+func (tb *tokenBucket) takeToken(now time.Time) bool {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
 	// refresh the bucket
-	tb.refillTokens()
+	tb.refillTokens(now)
 
 	if tb.tokens == 0 {
 		return false
@@ -69,11 +95,41 @@ func (tb *tokenBucket) takeToken() bool {
 	return true
 }
 
+// TokenBucket limits the rate of events shared by all clients, such as the
+// connections accepted by a listener, with a single token bucket.
+type TokenBucket struct {
+	// bucket is the token bucket.
+	bucket *tokenBucket
+
+	// clock tells the time the bucket is refilled at.
+	clock Clock
+}
+
+// NewTokenBucket initializes and returns a full TokenBucket holding up to
+// capacity tokens, refilled with refillRate tokens every second. The
+// system clock is used if clock is nil.
+func NewTokenBucket(capacity, refillRate uint64, clock Clock) *TokenBucket {
+	if clock == nil {
+		clock = systemClock{}
+	}
+	return &TokenBucket{
+		bucket: newTokenBucket(capacity, refillRate, clock.Now()),
+		clock:  clock,
+	}
+}
+
+// Allow takes a token from the bucket, and reports whether one was left.
+func (b *TokenBucket) Allow() bool {
+	return b.bucket.takeToken(b.clock.Now())
+}
+
 // rateLimiter represents rate limiting capabilities
 // for multiple clients using the token bucket algorithm.
 type rateLimiter struct {
-	// mu ensures concurrent access to the clientBuckets map.
-	mu sync.Mutex
+	// mu ensures concurrent access to the clientBuckets map. Buckets
+	// are looked up under the read lock and lock themselves, so that
+	// only the creation of a client's first bucket is serialized.
+	mu sync.RWMutex
 
 	// bucketCapacity is a default capacity for a new client bucket.
 	bucketCapacity uint64
@@ -83,6 +139,12 @@ type rateLimiter struct {
 
 	// clientBuckets is map from clientID to a tokenBucket.
 	clientBuckets map[string]*tokenBucket
+
+	// lastPrune is the time idle buckets were last removed.
+	lastPrune time.Time
+
+	// clock tells the time buckets are refilled at.
+	clock Clock
 }
 
 // newRateLimiter initializes and returns a new rateLimiter
@@ -92,6 +154,7 @@ func newRateLimiter(bucketCapacity, bucketRefillRate uint64) *rateLimiter {
 		clientBuckets:    make(map[string]*tokenBucket),
 		bucketCapacity:   bucketCapacity,
 		bucketRefillRate: bucketRefillRate,
+		clock:            systemClock{},
 	}
 }
 
@@ -101,14 +164,63 @@ func newRateLimiter(bucketCapacity, bucketRefillRate uint64) *rateLimiter {
 // TODO leverage 'funtional option pattern' to make token bucket params
 // configurable per client if necessary
 func (rl *rateLimiter) allowConnection(clientID string) bool {
+	now := rl.clock.Now()
+	return rl.bucket(clientID, now).takeToken(now)
+}
+
+// bucket returns the tokenBucket of the client, creating it if needed.
+func (rl *rateLimiter) bucket(clientID string, now time.Time) *tokenBucket {
+	rl.mu.RLock()
+	bucket, exists := rl.clientBuckets[clientID]
+	rl.mu.RUnlock()
+	if exists {
+		return bucket
+	}
+
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
-	bucket, exists := rl.clientBuckets[clientID]
-	if !exists {
-		bucket = newTokenBucket(rl.bucketCapacity, rl.bucketRefillRate)
+	// Another connection of the client may have created it meanwhile
+	if bucket, exists = rl.clientBuckets[clientID]; !exists {
+		rl.pruneIdle(now)
+		bucket = newTokenBucket(rl.bucketCapacity, rl.bucketRefillRate, now)
 		rl.clientBuckets[clientID] = bucket
 	}
+	return bucket
+}
+
+// refillDuration returns the time an empty bucket takes to refill, after
+// which an unused bucket is full again, as if it was just created. Zero
+// if buckets are never refilled, or not within a representable duration.
+func (rl *rateLimiter) refillDuration() time.Duration {
+	if rl.bucketRefillRate == 0 {
+		return 0
+	}
+	seconds := float64(rl.bucketCapacity) / float64(rl.bucketRefillRate)
+	if seconds >= math.MaxInt64/float64(time.Second) {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
 
-	return bucket.takeToken()
+// pruneIdle removes the buckets unused for longer than they take to
+// refill, at most once per refill duration, so that keys chosen by the
+// clients, e.g. the TLS server name, do not grow the map without bound.
+// Removing a full bucket does not change the rate the key is limited to.
+// The caller must hold the write lock of rl.mu.
+func (rl *rateLimiter) pruneIdle(now time.Time) {
+	idle := rl.refillDuration()
+	if idle == 0 || now.Sub(rl.lastPrune) < idle {
+		return
+	}
+	rl.lastPrune = now
+
+	for clientID, bucket := range rl.clientBuckets {
+		bucket.mu.Lock()
+		unused := now.Sub(bucket.lastRefillTime) >= idle
+		bucket.mu.Unlock()
+		if unused {
+			delete(rl.clientBuckets, clientID)
+		}
+	}
 }
@@ -2,50 +2,98 @@ package lib
 
 import (
 	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
 )
 
+// fakeClock is a Clock advanced manually.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// newFakeClock creates a fakeClock starting at an arbitrary time.
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+// Now implements Clock.
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
 func TestTokenBucket(t *testing.T) {
 	require := require.New(t)
 
 	defaultCapacity := uint64(10)
 	defaulRefillRate := uint64(2)
+	clock := newFakeClock()
 
 	t.Run("NewTokenBucket", func(t *testing.T) {
-		tb := newTokenBucket(defaultCapacity, defaulRefillRate)
+		tb := newTokenBucket(defaultCapacity, defaulRefillRate, clock.Now())
 		require.Equal(defaultCapacity, tb.capacity)
 		require.Equal(defaultCapacity, tb.tokens)
 		require.Equal(defaulRefillRate, tb.refillRate)
 	})
 
 	t.Run("Take token successfully", func(t *testing.T) {
-		tb := newTokenBucket(defaultCapacity, defaulRefillRate)
-		require.True(tb.takeToken())
+		tb := newTokenBucket(defaultCapacity, defaulRefillRate, clock.Now())
+		require.True(tb.takeToken(clock.Now()))
 		require.Equal(uint64(9), tb.tokens)
 	})
 
 	t.Run("Fail to take token", func(t *testing.T) {
-		tb := newTokenBucket(0, uint64(1))
-		require.False(tb.takeToken())
+		tb := newTokenBucket(0, uint64(1), clock.Now())
+		require.False(tb.takeToken(clock.Now()))
 	})
 
 	t.Run("Refill tokens correctly", func(t *testing.T) {
-		tb := newTokenBucket(defaultCapacity, defaulRefillRate)
+		tb := newTokenBucket(defaultCapacity, defaulRefillRate, clock.Now())
 		tb.tokens = 0
-		time.Sleep(2 * time.Second)
-		tb.refillTokens()
+		clock.Advance(2 * time.Second)
+		tb.refillTokens(clock.Now())
 		require.Equal(uint64(4), tb.tokens)
 	})
 
 	t.Run("Do not exceed capacity", func(t *testing.T) {
-		tb := newTokenBucket(defaultCapacity, defaulRefillRate)
-		time.Sleep(2 * time.Second)
-		tb.refillTokens()
+		tb := newTokenBucket(defaultCapacity, defaulRefillRate, clock.Now())
+		clock.Advance(2 * time.Second)
+		tb.refillTokens(clock.Now())
 		require.Equal(defaultCapacity, tb.tokens)
 	})
+
+	t.Run("Ignore time going backwards", func(t *testing.T) {
+		tb := newTokenBucket(defaultCapacity, defaulRefillRate, clock.Now())
+		tb.tokens = 0
+		tb.refillTokens(clock.Now().Add(-time.Second))
+		require.Zero(tb.tokens)
+		require.Zero(tb.fractionalTokens)
+	})
+
+	t.Run("Accumulate fractional tokens", func(t *testing.T) {
+		tb := newTokenBucket(defaultCapacity, defaulRefillRate, clock.Now())
+		tb.tokens = 0
+		clock.Advance(250 * time.Millisecond)
+		tb.refillTokens(clock.Now())
+		require.Zero(tb.tokens)
+		clock.Advance(250 * time.Millisecond)
+		tb.refillTokens(clock.Now())
+		require.Equal(uint64(1), tb.tokens)
+	})
 }
 
 func TestRateLimiter(t *testing.T) {
@@ -53,7 +101,9 @@ func TestRateLimiter(t *testing.T) {
 
 	defaultCapacity := uint64(5)
 	defaulRefillRate := uint64(1)
+	clock := newFakeClock()
 	rl := newRateLimiter(defaultCapacity, defaulRefillRate)
+	rl.clock = clock
 
 	t.Run("Allow on first connection", func(t *testing.T) {
 		clientID := "client1"
@@ -70,7 +120,7 @@ func TestRateLimiter(t *testing.T) {
 
 	t.Run("Allow after tokens refill", func(t *testing.T) {
 		clientID := "client1"
-		time.Sleep(2 * time.Second)
+		clock.Advance(2 * time.Second)
 		require.True(rl.allowConnection(clientID))
 	})
 
@@ -108,6 +158,37 @@ func TestRateLimiter(t *testing.T) {
 		<-done
 	})
 
+	t.Run("Concurrent clients take exactly the capacity", func(t *testing.T) {
+		rl := newRateLimiter(defaultCapacity, defaulRefillRate)
+		rl.clock = clock
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		allowed := make(map[string]int)
+		for i := 0; i < 8; i++ {
+			for c := 0; c < 4; c++ {
+				clientID := fmt.Sprintf("client%d", c)
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 10; j++ {
+						if rl.allowConnection(clientID) {
+							mu.Lock()
+							allowed[clientID]++
+							mu.Unlock()
+						}
+					}
+				}()
+			}
+		}
+		wg.Wait()
+
+		require.Len(allowed, 4)
+		for clientID, count := range allowed {
+			require.Equal(int(defaultCapacity), count, clientID)
+		}
+	})
+
 	t.Run("Zero values", func(t *testing.T) {
 		clientID := "client1"
 		rl1 := newRateLimiter(0, defaulRefillRate)
@@ -128,4 +209,103 @@ func TestRateLimiter(t *testing.T) {
 
 		require.Equal(numClients, len(rl.clientBuckets))
 	})
+
+	t.Run("Remove idle buckets", func(t *testing.T) {
+		clock := newFakeClock()
+		rl := newRateLimiter(defaultCapacity, defaulRefillRate)
+		rl.clock = clock
+
+		for i := 0; i < 3; i++ {
+			rl.allowConnection(fmt.Sprintf("sni%d", i))
+		}
+		clock.Advance(4 * time.Second)
+		rl.allowConnection("sni0")
+		clock.Advance(time.Second)
+
+		// Buckets unused for as long as they take to refill are removed
+		// when another key is added
+		rl.allowConnection("sni3")
+		require.Len(rl.clientBuckets, 2)
+		require.Contains(rl.clientBuckets, "sni0")
+		require.Contains(rl.clientBuckets, "sni3")
+
+		// A removed key is limited as before
+		for i := 0; i < int(defaultCapacity); i++ {
+			require.True(rl.allowConnection("sni1"))
+		}
+		require.False(rl.allowConnection("sni1"))
+
+		// Buckets that are never refilled are kept
+		rl = newRateLimiter(defaultCapacity, 0)
+		rl.clock = clock
+		rl.allowConnection("sni0")
+		clock.Advance(time.Hour)
+		rl.allowConnection("sni1")
+		require.Len(rl.clientBuckets, 2)
+	})
+}
+
+func TestWithClock(t *testing.T) {
+	require := require.New(t)
+
+	clock := newFakeClock()
+	lb := NewLoadBalancer(1, 1, WithClock(clock))
+	require.True(lb.rateLimiter.allowConnection("client1"))
+	require.False(lb.rateLimiter.allowConnection("client1"))
+
+	clock.Advance(time.Second)
+	require.True(lb.rateLimiter.allowConnection("client1"))
+}
+
+func TestSharedTokenBucket(t *testing.T) {
+	require := require.New(t)
+
+	clock := newFakeClock()
+	bucket := NewTokenBucket(2, 4, clock)
+	require.True(bucket.Allow())
+	require.True(bucket.Allow())
+	require.False(bucket.Allow(), "Expected the burst to be exhausted")
+
+	clock.Advance(250 * time.Millisecond)
+	require.True(bucket.Allow())
+	require.False(bucket.Allow())
+
+	clock.Advance(time.Hour)
+	require.True(bucket.Allow())
+	require.True(bucket.Allow())
+	require.False(bucket.Allow(), "Expected tokens capped at the burst")
+}
+
+// BenchmarkRateLimiter measures the contention of concurrent connections
+// taking tokens from the same client's bucket or from distinct buckets.
+func BenchmarkRateLimiter(b *testing.B) {
+	b.Run("SameClient", func(b *testing.B) {
+		rl := newRateLimiter(1<<62, 1<<20)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				rl.allowConnection("client")
+			}
+		})
+	})
+
+	b.Run("DistinctClients", func(b *testing.B) {
+		rl := newRateLimiter(1<<62, 1<<20)
+		var next atomic.Int64
+		b.RunParallel(func(pb *testing.PB) {
+			clientID := fmt.Sprintf("client%d", next.Add(1))
+			for pb.Next() {
+				rl.allowConnection(clientID)
+			}
+		})
+	})
+
+	b.Run("NewClients", func(b *testing.B) {
+		rl := newRateLimiter(1<<62, 1<<20)
+		var next atomic.Int64
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				rl.allowConnection(strconv.FormatInt(next.Add(1)%10000, 10))
+			}
+		})
+	})
 }
@@ -0,0 +1,294 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/logging"
+)
+
+// ResolutionStrategy defines how hostname backends are resolved on dial.
+type ResolutionStrategy string
+
+// define resolution strategies.
+const (
+	// ResolvePerDial resolves the hostname afresh for every connection.
+	ResolvePerDial ResolutionStrategy = "per_dial"
+
+	// ResolveTTL caches the resolved IPs for a fixed time. Stale IPs are
+	// kept if a refresh fails, so that a DNS outage does not take the
+	// backend down.
+	ResolveTTL ResolutionStrategy = "ttl"
+
+	// ResolvePinned resolves the hostname once, when the backend is
+	// added, and keeps the IPs for the lifetime of the process.
+	ResolvePinned ResolutionStrategy = "pinned"
+)
+
+// DNSResolver defines how the hostnames of backends are looked up,
+// instead of relying on the system resolver.
+type DNSResolver struct {
+	// Servers are the addresses of the DNS servers queried, "host" or
+	// "host:port", in order: a server failing to answer, e.g. timing out,
+	// falls back to the next one. The system resolver is used if empty.
+	Servers []string
+
+	// Timeout bounds the query of each server, or the lookup of the
+	// system resolver. Zero means no timeout.
+	Timeout time.Duration
+
+	// NegativeTTL is the time a failed lookup is cached, failing the dials
+	// of the hostname without querying again, unless stale IPs are
+	// available. Zero disables negative caching.
+	NegativeTTL time.Duration
+}
+
+// WithDNSResolver sets how the hostnames of backends are looked up when
+// resolved with WithResolution.
+func WithDNSResolver(resolver DNSResolver) Option {
+	return func(lb *LoadBalancer) {
+		lb.dnsResolver = resolver
+	}
+}
+
+// newDNSLookup returns a host lookup querying the servers of the
+// resolver in order, or the system resolver if it has none.
+func newDNSLookup(resolver DNSResolver) func(ctx context.Context, host string) ([]string, error) {
+	withTimeout := func(ctx context.Context) (context.Context, context.CancelFunc) {
+		if resolver.Timeout <= 0 {
+			return context.WithCancel(ctx)
+		}
+		return context.WithTimeout(ctx, resolver.Timeout)
+	}
+	if len(resolver.Servers) == 0 {
+		return func(ctx context.Context, host string) ([]string, error) {
+			ctx, cancel := withTimeout(ctx)
+			defer cancel()
+			return net.DefaultResolver.LookupHost(ctx, host)
+		}
+	}
+
+	resolvers := make([]*net.Resolver, len(resolver.Servers))
+	for i, server := range resolver.Servers {
+		server := server
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		var dialer net.Dialer
+		resolvers[i] = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, server)
+			},
+		}
+	}
+	return func(ctx context.Context, host string) ([]string, error) {
+		var errs []error
+		for _, r := range resolvers {
+			queryCtx, cancel := withTimeout(ctx)
+			ips, err := r.LookupHost(queryCtx, host)
+			cancel()
+			// A name that does not exist is not looked up elsewhere
+			var dnsErr *net.DNSError
+			if err == nil || (errors.As(err, &dnsErr) && dnsErr.IsNotFound) {
+				return ips, err
+			}
+			errs = append(errs, err)
+		}
+		return nil, errors.Join(errs...)
+	}
+}
+
+// resolvedHost holds the cached IPs of a hostname.
+type resolvedHost struct {
+	// ips are the resolved IP addresses.
+	ips []string
+
+	// expires is the time the entry must be refreshed. Zero never expires.
+	expires time.Time
+}
+
+// resolvingDialer resolves hostname backends according to a resolution
+// strategy before dialing their IPs in order until one succeeds, making
+// the resolution behavior explicit rather than left to net.Dial.
+type resolvingDialer struct {
+	// dialer dials the resolved "ip:port" addresses.
+	dialer dialer
+
+	// strategy is the resolution strategy.
+	strategy ResolutionStrategy
+
+	// ttl is the cache lifetime of the ResolveTTL strategy.
+	ttl time.Duration
+
+	// lookup resolves a hostname to its IP addresses.
+	lookup func(ctx context.Context, host string) ([]string, error)
+
+	// logger logs the resolution failures.
+	logger *logging.Logger
+
+	// negativeTTL is the time a failed lookup is cached. Zero disables
+	// negative caching.
+	negativeTTL time.Duration
+
+	// mu ensures concurrent access to the caches.
+	mu sync.Mutex
+
+	// cache maps a hostname to its resolved IPs.
+	cache map[string]resolvedHost
+
+	// failures maps a hostname to its cached failed lookup.
+	failures map[string]failedLookup
+}
+
+// failedLookup is a cached failed lookup of a hostname.
+type failedLookup struct {
+	// err is the error of the lookup.
+	err error
+
+	// expires is the time the hostname is looked up again.
+	expires time.Time
+}
+
+// WithResolution sets how hostname backends are resolved on dial.
+// ttl is the cache lifetime used by the ResolveTTL strategy.
+func WithResolution(strategy ResolutionStrategy, ttl time.Duration) Option {
+	return func(lb *LoadBalancer) {
+		lb.dialer = newResolvingDialer(lb.dialer, strategy, ttl, net.DefaultResolver.LookupHost)
+	}
+}
+
+// newResolvingDialer creates a resolvingDialer with a custom host lookup.
+func newResolvingDialer(
+	d dialer,
+	strategy ResolutionStrategy,
+	ttl time.Duration,
+	lookup func(ctx context.Context, host string) ([]string, error),
+) *resolvingDialer {
+	return &resolvingDialer{
+		dialer:   d,
+		strategy: strategy,
+		ttl:      ttl,
+		lookup:   lookup,
+		logger:   logging.Default(),
+		cache:    make(map[string]resolvedHost),
+		failures: make(map[string]failedLookup),
+	}
+}
+
+// useResolver looks hostnames up with the resolver.
+func (d *resolvingDialer) useResolver(resolver DNSResolver) {
+	d.lookup = newDNSLookup(resolver)
+	d.negativeTTL = resolver.NegativeTTL
+}
+
+// Dial implements dialer. IP literal addresses are dialed as-is.
+func (d *resolvingDialer) Dial(network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := netip.ParseAddr(host); err == nil {
+		return d.dialer.Dial(network, address)
+	}
+
+	ips, err := d.resolve(host)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, ip := range ips {
+		conn, err := d.dialer.Dial(network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// pin resolves the hostname of a backend address ahead of its first
+// dial when using the ResolvePinned strategy. Failures are logged and
+// the resolution is retried on dial.
+func (d *resolvingDialer) pin(address string) {
+	if d.strategy != ResolvePinned {
+		return
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return
+	}
+	if _, err := netip.ParseAddr(host); err == nil {
+		return
+	}
+	if _, err := d.resolve(host); err != nil {
+		d.logger.Warnf("Unable to pin backend %s: %v", address, err)
+	}
+}
+
+// resolve returns the IPs of the hostname according to the strategy.
+func (d *resolvingDialer) resolve(host string) ([]string, error) {
+	if d.strategy == ResolvePerDial {
+		return d.lookupHost(host)
+	}
+
+	d.mu.Lock()
+	cached, ok := d.cache[host]
+	d.mu.Unlock()
+	if ok && (cached.expires.IsZero() || time.Now().Before(cached.expires)) {
+		return cached.ips, nil
+	}
+
+	ips, err := d.lookupHost(host)
+	if err != nil {
+		// Serve stale IPs rather than failing the dial
+		if ok {
+			d.logger.Warnf("Using stale IPs of %s: %v", host, err)
+			return cached.ips, nil
+		}
+		return nil, err
+	}
+
+	entry := resolvedHost{ips: ips}
+	if d.strategy == ResolveTTL {
+		entry.expires = time.Now().Add(d.ttl)
+	}
+	d.mu.Lock()
+	d.cache[host] = entry
+	d.mu.Unlock()
+	return ips, nil
+}
+
+// lookupHost resolves the hostname, failing if it has no IPs. Failed
+// lookups are cached for the negative TTL.
+func (d *resolvingDialer) lookupHost(host string) ([]string, error) {
+	if d.negativeTTL > 0 {
+		d.mu.Lock()
+		failure, ok := d.failures[host]
+		d.mu.Unlock()
+		if ok && time.Now().Before(failure.expires) {
+			return nil, failure.err
+		}
+	}
+
+	ips, err := d.lookup(context.Background(), host)
+	if err == nil && len(ips) == 0 {
+		err = errors.New("no addresses")
+	}
+	if err != nil {
+		err = fmt.Errorf("unable to resolve %s: %w", host, err)
+		if d.negativeTTL > 0 {
+			d.mu.Lock()
+			d.failures[host] = failedLookup{err: err, expires: time.Now().Add(d.negativeTTL)}
+			d.mu.Unlock()
+		}
+		return nil, err
+	}
+	return ips, nil
+}
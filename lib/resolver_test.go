@@ -0,0 +1,150 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// recordingDialer records the dialed addresses and fails for the listed ones.
+type recordingDialer struct {
+	dialed  []string
+	failing map[string]bool
+}
+
+func (d *recordingDialer) Dial(network, address string) (net.Conn, error) {
+	d.dialed = append(d.dialed, address)
+	if d.failing[address] {
+		return nil, errors.New("connection refused")
+	}
+	return &mockConn{readBuffer: new(bytes.Buffer), writeBuffer: new(bytes.Buffer)}, nil
+}
+
+// countingLookup resolves hosts to the configured IPs and counts lookups.
+type countingLookup struct {
+	ips     []string
+	err     error
+	lookups int
+}
+
+func (l *countingLookup) lookup(ctx context.Context, host string) ([]string, error) {
+	l.lookups++
+	return l.ips, l.err
+}
+
+func TestResolvingDialer(t *testing.T) {
+	require := require.New(t)
+
+	tests := []struct {
+		strategy ResolutionStrategy
+		ttl      time.Duration
+		lookups  int
+	}{
+		{ResolvePerDial, 0, 3},
+		{ResolveTTL, time.Hour, 1},
+		{ResolveTTL, -time.Second, 3},
+		{ResolvePinned, 0, 1},
+	}
+	for _, tt := range tests {
+		lookup := &countingLookup{ips: []string{"10.0.0.1"}}
+		d := newResolvingDialer(&recordingDialer{}, tt.strategy, tt.ttl, lookup.lookup)
+		for i := 0; i < 3; i++ {
+			_, err := d.Dial("tcp", "backend.example.com:80")
+			require.NoError(err)
+		}
+		require.Equal(tt.lookups, lookup.lookups, tt.strategy)
+	}
+}
+
+func TestResolvingDialerFallback(t *testing.T) {
+	require := require.New(t)
+
+	inner := &recordingDialer{failing: map[string]bool{"10.0.0.1:80": true}}
+	lookup := &countingLookup{ips: []string{"10.0.0.1", "10.0.0.2"}}
+	d := newResolvingDialer(inner, ResolveTTL, -time.Second, lookup.lookup)
+
+	// IPs are tried in order until one succeeds
+	_, err := d.Dial("tcp", "backend.example.com:80")
+	require.NoError(err)
+	require.Equal([]string{"10.0.0.1:80", "10.0.0.2:80"}, inner.dialed)
+
+	// Stale IPs are used when a refresh fails
+	lookup.err = errors.New("no such host")
+	_, err = d.Dial("tcp", "backend.example.com:80")
+	require.NoError(err)
+
+	// IP literals are not resolved
+	_, err = d.Dial("tcp", "10.0.0.3:80")
+	require.NoError(err)
+	require.Equal(2, lookup.lookups)
+
+	d = newResolvingDialer(inner, ResolvePerDial, 0, lookup.lookup)
+	_, err = d.Dial("tcp", "backend.example.com:80")
+	require.Error(err)
+}
+
+func TestResolvePinnedOnAddBackend(t *testing.T) {
+	require := require.New(t)
+
+	lookup := &countingLookup{ips: []string{"10.0.0.1"}}
+	lb := NewLoadBalancer(10, 10)
+	lb.dialer = newResolvingDialer(&recordingDialer{}, ResolvePinned, 0, lookup.lookup)
+
+	lb.AddBackend(&Backend{Address: "backend.example.com:80"})
+	require.Equal(1, lookup.lookups)
+
+	// The pinned IPs are kept even if the name resolves elsewhere later
+	lookup.ips = []string{"10.0.0.2"}
+	conn, err := lb.dialer.Dial("tcp", "backend.example.com:80")
+	require.NoError(err)
+	require.NotNil(conn)
+	require.Equal([]string{"10.0.0.1:80"}, lb.dialer.(*resolvingDialer).dialer.(*recordingDialer).dialed)
+}
+
+func TestResolvingDialerNegativeCache(t *testing.T) {
+	require := require.New(t)
+
+	lookup := &countingLookup{err: errors.New("no such host")}
+	d := newResolvingDialer(&recordingDialer{}, ResolvePerDial, 0, lookup.lookup)
+	d.negativeTTL = time.Hour
+
+	// Failed lookups are cached
+	for i := 0; i < 3; i++ {
+		_, err := d.Dial("tcp", "backend.example.com:80")
+		require.ErrorContains(err, "no such host")
+	}
+	require.Equal(1, lookup.lookups)
+
+	// until they expire
+	lookup.err = nil
+	lookup.ips = []string{"10.0.0.1"}
+	failure := d.failures["backend.example.com"]
+	failure.expires = time.Now()
+	d.failures["backend.example.com"] = failure
+	_, err := d.Dial("tcp", "backend.example.com:80")
+	require.NoError(err)
+	require.Equal(2, lookup.lookups)
+}
+
+func TestDNSLookupServers(t *testing.T) {
+	require := require.New(t)
+
+	// A server not answering times out and falls back to the next one
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(err)
+	defer silent.Close()
+
+	lookup := newDNSLookup(DNSResolver{
+		Servers: []string{silent.LocalAddr().String(), silent.LocalAddr().String()},
+		Timeout: 50 * time.Millisecond,
+	})
+	start := time.Now()
+	_, err = lookup(context.Background(), "backend.invalid")
+	require.Error(err)
+	require.Less(time.Since(start), 5*time.Second)
+}
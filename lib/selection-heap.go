@@ -0,0 +1,233 @@
+package lib
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// heapEntry is a backend ordered in a selection heap by the connection
+// count and weight it had when it was last fixed.
+type heapEntry struct {
+	slot        *heapSlot
+	connections int64
+	weight      int64
+	position    int
+}
+
+// heapSlot is the entry of a backend in a selection heap indexing it.
+type heapSlot struct {
+	backend *Backend
+	heap    *selectionHeap
+
+	// index is the position of the entry in the heap, guarded by heap.mu.
+	index int
+}
+
+// selectionHeap is an indexed min-heap of the backends allowed by an
+// allowed backends entry, ordered by connections per weight, then by
+// registration order, as the least connections selection compares them.
+// It lets selection visit backends from the least loaded one in
+// O(log n) instead of scanning every allowed backend.
+//
+// Entries are fixed whenever the connection count or weight of their
+// backend changes, under at least a read lock of lb.mu. Each heap has its
+// own mutex, so that selections and releases of connections in different
+// pools do not contend. As the weight of a ramping backend changes
+// continuously, the heap is not used while one of its backends is
+// ramping, and its entries are refreshed once the ramps ended.
+type selectionHeap struct {
+	// mu guards the entries and rampingUntil.
+	mu sync.Mutex
+
+	// entries is the heap.
+	entries []heapEntry
+
+	// rampingUntil is the time the last weight ramp of a backend of the
+	// heap ends.
+	rampingUntil time.Time
+}
+
+// newSelectionHeap creates an empty selection heap.
+func newSelectionHeap() *selectionHeap {
+	return &selectionHeap{}
+}
+
+// less reports whether entry i is selected before entry j. Backends with
+// a zero weight are never selected and are ordered last.
+func (h *selectionHeap) less(i, j int) bool {
+	a, b := &h.entries[i], &h.entries[j]
+	if (a.weight == 0) != (b.weight == 0) {
+		return b.weight == 0
+	}
+	if lhs, rhs := a.connections*b.weight, b.connections*a.weight; lhs != rhs {
+		return lhs < rhs
+	}
+	return a.position < b.position
+}
+
+// swap swaps entries i and j.
+func (h *selectionHeap) swap(i, j int) {
+	h.entries[i], h.entries[j] = h.entries[j], h.entries[i]
+	h.entries[i].slot.index = i
+	h.entries[j].slot.index = j
+}
+
+// up moves entry i towards the root until the heap is ordered.
+func (h *selectionHeap) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !h.less(i, parent) {
+			return
+		}
+		h.swap(i, parent)
+		i = parent
+	}
+}
+
+// down moves entry i towards the leaves until the heap is ordered.
+func (h *selectionHeap) down(i int) {
+	for {
+		least := i
+		if left := 2*i + 1; left < len(h.entries) && h.less(left, least) {
+			least = left
+		}
+		if right := 2*i + 2; right < len(h.entries) && h.less(right, least) {
+			least = right
+		}
+		if least == i {
+			return
+		}
+		h.swap(i, least)
+		i = least
+	}
+}
+
+// push adds a backend registered at the given position and returns its
+// slot.
+func (h *selectionHeap) push(backend *Backend, position int) *heapSlot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	slot := &heapSlot{backend: backend, heap: h, index: len(h.entries)}
+	h.entries = append(h.entries, heapEntry{slot: slot, position: position})
+	h.fixLocked(slot)
+	return slot
+}
+
+// fix updates the entry of the slot to the current connection count and
+// weight of its backend.
+func (h *selectionHeap) fix(slot *heapSlot) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.fixLocked(slot)
+}
+
+// fixLocked is like fix, but the caller must hold h.mu.
+func (h *selectionHeap) fixLocked(slot *heapSlot) {
+	i, backend := slot.index, slot.backend
+	h.entries[i].connections = backend.ConnectionCount()
+	h.entries[i].weight = int64(backend.EffectiveWeight())
+	if end := backend.rampEnd(); end.After(h.rampingUntil) {
+		h.rampingUntil = end
+	}
+	h.up(i)
+	h.down(slot.index)
+}
+
+// usable reports whether the heap orders its backends by their current
+// weight, refreshing its entries once the weight ramps of its backends
+// ended. The caller must hold h.mu.
+func (h *selectionHeap) usable() bool {
+	if h.rampingUntil.IsZero() {
+		return true
+	}
+	if time.Now().Before(h.rampingUntil) {
+		return false
+	}
+	h.rampingUntil = time.Time{}
+	slots := make([]*heapSlot, len(h.entries))
+	for i, entry := range h.entries {
+		slots[i] = entry.slot
+	}
+	for _, slot := range slots {
+		h.fixLocked(slot)
+	}
+	return true
+}
+
+// frontier is a min-heap of the selection heap entries whose parent was
+// visited, ordered as the selection heap.
+type frontier struct {
+	h       *selectionHeap
+	indexes []int
+}
+
+// Len implements heap.Interface.
+func (f *frontier) Len() int { return len(f.indexes) }
+
+// Less implements heap.Interface.
+func (f *frontier) Less(i, j int) bool { return f.h.less(f.indexes[i], f.indexes[j]) }
+
+// Swap implements heap.Interface.
+func (f *frontier) Swap(i, j int) { f.indexes[i], f.indexes[j] = f.indexes[j], f.indexes[i] }
+
+// Push implements heap.Interface.
+func (f *frontier) Push(x any) { f.indexes = append(f.indexes, x.(int)) }
+
+// Pop implements heap.Interface.
+func (f *frontier) Pop() any {
+	i := f.indexes[len(f.indexes)-1]
+	f.indexes = f.indexes[:len(f.indexes)-1]
+	return i
+}
+
+// frontiers holds frontiers reused across visits, as a backend is
+// selected by a visit for every connection.
+var frontiers = sync.Pool{
+	New: func() any { return &frontier{} },
+}
+
+// visit calls fn with the backends of the heap in selection order until
+// fn returns true, and returns false without calling fn if the heap is
+// not usable. Visiting the k first backends takes O(k log k). The heap
+// is locked during the visit, so fn must not fix it.
+func (h *selectionHeap) visit(fn func(backend *Backend) bool) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.usable() {
+		return false
+	}
+	if len(h.entries) == 0 {
+		return true
+	}
+	f := frontiers.Get().(*frontier)
+	f.h, f.indexes = h, append(f.indexes[:0], 0)
+	defer func() {
+		f.h = nil
+		frontiers.Put(f)
+	}()
+	for f.Len() > 0 {
+		i := heap.Pop(f).(int)
+		if fn(h.entries[i].slot.backend) {
+			return true
+		}
+		if left := 2*i + 1; left < len(h.entries) {
+			heap.Push(f, left)
+		}
+		if right := 2*i + 2; right < len(h.entries) {
+			heap.Push(f, right)
+		}
+	}
+	return true
+}
+
+// fixHeaps updates the entries of the backend in the selection heaps
+// indexing it. The caller must hold at least a read lock of lb.mu.
+func (b *Backend) fixHeaps() {
+	for _, slot := range b.heaps {
+		slot.heap.fix(slot)
+	}
+}
@@ -0,0 +1,60 @@
+package lib
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectionHeap(t *testing.T) {
+	require := require.New(t)
+
+	lb := NewLoadBalancer(uint64(5), uint64(1))
+	backends := make([]*Backend, 50)
+	for i := range backends {
+		backends[i] = &Backend{Address: fmt.Sprintf("127.0.0.1:%d", 5000+i), Pool: "web", MaxConnections: 20}
+		lb.AddBackend(backends[i])
+	}
+	web := map[string]struct{}{PoolKey("web"): {}}
+	require.NotNil(lb.index.selectionHeap(web))
+
+	// Selection from the heap agrees with the scan of the explanation
+	random := rand.New(rand.NewSource(1))
+	var routed []*Backend
+	for i := 0; i < 2000; i++ {
+		switch backend := backends[random.Intn(len(backends))]; random.Intn(10) {
+		case 0:
+			lb.SetBackendWeight(backend.Address, random.Intn(3)*DefaultWeight, 0)
+		case 1:
+			backend.eject(time.Duration(random.Intn(2)) * time.Minute)
+		}
+		if len(routed) > 0 && random.Intn(3) == 0 {
+			j := random.Intn(len(routed))
+			lb.mu.Lock()
+			routed[j].decrementConnections()
+			lb.mu.Unlock()
+			routed = append(routed[:j], routed[j+1:]...)
+		}
+
+		explanation := lb.ExplainSelection("", web)
+		backend, err := lb.GetBackend(web)
+		if explanation.Selected == "" {
+			require.Error(err)
+			continue
+		}
+		require.NoError(err)
+		require.Equal(explanation.Selected, backend.Address)
+		routed = append(routed, backend)
+	}
+
+	// Ramping weights fall back to the scan until the ramps ended
+	_, err := lb.SetBackendWeight(backends[0].Address, DefaultWeight, time.Hour)
+	require.NoError(err)
+	require.False(lb.index.selectionHeap(web).visit(func(*Backend) bool { return true }))
+
+	// Several entries are not covered by a single heap
+	require.Nil(lb.index.selectionHeap(map[string]struct{}{backends[1].Address: {}, backends[2].Address: {}}))
+}
@@ -0,0 +1,142 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+// ErrSelfBackend is returned when a backend address refers to the load
+// balancer's own listener, which would make it proxy connections to itself.
+var ErrSelfBackend = errors.New("backend address refers to the load balancer's own listener")
+
+// SelfAddressMatcher detects backend addresses that refer to the load
+// balancer's own listener, either directly or via name resolution.
+type SelfAddressMatcher struct {
+	// port is the port of the listener.
+	port string
+
+	// wildcard is set if the listener is bound to every local address.
+	wildcard bool
+
+	// ips are the addresses the listener is reachable on, i.e. its bound
+	// address or every local interface address for a wildcard listener.
+	ips map[netip.Addr]struct{}
+
+	// lookup resolves a hostname to its IP addresses.
+	lookup func(host string) ([]string, error)
+}
+
+// NewSelfAddressMatcher creates a SelfAddressMatcher for the listener
+// address, e.g. ":3003" or "10.0.0.1:3003".
+func NewSelfAddressMatcher(listenAddress string) (*SelfAddressMatcher, error) {
+	return newSelfAddressMatcher(listenAddress, net.LookupHost, net.InterfaceAddrs)
+}
+
+// newSelfAddressMatcher creates a SelfAddressMatcher with a custom host
+// lookup and local interface addresses.
+func newSelfAddressMatcher(
+	listenAddress string,
+	lookup func(host string) ([]string, error),
+	interfaceAddrs func() ([]net.Addr, error),
+) (*SelfAddressMatcher, error) {
+	host, port, err := net.SplitHostPort(listenAddress)
+	if err != nil {
+		return nil, fmt.Errorf("invalid listener address %q: %w", listenAddress, err)
+	}
+	m := &SelfAddressMatcher{
+		port:   port,
+		ips:    make(map[netip.Addr]struct{}),
+		lookup: lookup,
+	}
+
+	if host != "" {
+		ip, err := netip.ParseAddr(host)
+		if err != nil {
+			return nil, fmt.Errorf("invalid listener address %q: %w", listenAddress, err)
+		}
+		m.wildcard = ip.IsUnspecified()
+		m.ips[ip.Unmap()] = struct{}{}
+	} else {
+		m.wildcard = true
+	}
+	if !m.wildcard {
+		return m, nil
+	}
+
+	addrs, err := interfaceAddrs()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list local addresses: %w", err)
+	}
+	for _, addr := range addrs {
+		if prefix, err := netip.ParsePrefix(addr.String()); err == nil {
+			m.ips[prefix.Addr().Unmap()] = struct{}{}
+		}
+	}
+	return m, nil
+}
+
+// Matches reports whether the canonical backend address refers to the
+// listener. Hostnames that cannot be resolved are not matched.
+func (m *SelfAddressMatcher) Matches(address string) bool {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || port != m.port {
+		return false
+	}
+
+	hosts := []string{host}
+	if _, err := netip.ParseAddr(host); err != nil {
+		if hosts, err = m.lookup(host); err != nil {
+			return false
+		}
+	}
+	for _, h := range hosts {
+		ip, err := netip.ParseAddr(h)
+		if err != nil {
+			continue
+		}
+		ip = ip.Unmap()
+		if _, ok := m.ips[ip]; ok {
+			return true
+		}
+		// Unspecified addresses are dialed on the local host
+		if m.wildcard && (ip.IsLoopback() || ip.IsUnspecified()) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSelfBackends returns an ErrSelfBackend error per backend that
+// refers to the load balancer's own listener.
+func (lb *LoadBalancer) checkSelfBackends(backends []*Backend) []error {
+	if lb.selfAddress == nil {
+		return nil
+	}
+	var errs []error
+	for _, backend := range backends {
+		address, err := CanonicalAddress(backend.Address, "")
+		if err == nil && lb.selfAddress.Matches(address) {
+			errs = append(errs, fmt.Errorf("%w: %s", ErrSelfBackend, address))
+		}
+	}
+	return errs
+}
+
+// proxyPathKey is the context key of the loop detection path.
+type proxyPathKey struct{}
+
+// WithProxyPath returns a copy of ctx carrying the instance IDs of the
+// load balancers a connection went through before this one, as read from
+// the loop detection TLV of its PROXY protocol header.
+func WithProxyPath(ctx context.Context, path []byte) context.Context {
+	return context.WithValue(ctx, proxyPathKey{}, path)
+}
+
+// proxyPathFromContext returns the loop detection path carried by ctx.
+func proxyPathFromContext(ctx context.Context) []byte {
+	path, _ := ctx.Value(proxyPathKey{}).([]byte)
+	return path
+}
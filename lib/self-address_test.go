@@ -0,0 +1,115 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/rrasulzade/tcp-lb-go/proxyproto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelfAddressMatcher(t *testing.T) {
+	require := require.New(t)
+
+	lookup := func(host string) ([]string, error) {
+		switch host {
+		case "localhost":
+			return []string{"127.0.0.1", "::1"}, nil
+		case "lb.example.com":
+			return []string{"10.0.0.1"}, nil
+		case "backend.example.com":
+			return []string{"10.0.0.2"}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	interfaceAddrs := func() ([]net.Addr, error) {
+		return []net.Addr{
+			&net.IPNet{IP: net.ParseIP("127.0.0.1"), Mask: net.CIDRMask(8, 32)},
+			&net.IPNet{IP: net.ParseIP("10.0.0.1"), Mask: net.CIDRMask(24, 32)},
+		}, nil
+	}
+
+	t.Run("Wildcard listener", func(t *testing.T) {
+		m, err := newSelfAddressMatcher(":3003", lookup, interfaceAddrs)
+		require.NoError(err)
+
+		require.True(m.Matches("127.0.0.1:3003"))
+		require.True(m.Matches("127.0.0.2:3003"))
+		require.True(m.Matches("[::1]:3003"))
+		require.True(m.Matches("0.0.0.0:3003"))
+		require.True(m.Matches("10.0.0.1:3003"))
+		require.True(m.Matches("localhost:3003"))
+		require.True(m.Matches("lb.example.com:3003"))
+
+		require.False(m.Matches("127.0.0.1:5001"))
+		require.False(m.Matches("10.0.0.2:3003"))
+		require.False(m.Matches("backend.example.com:3003"))
+		require.False(m.Matches("unknown.example.com:3003"))
+	})
+
+	t.Run("Listener bound to an address", func(t *testing.T) {
+		m, err := newSelfAddressMatcher("10.0.0.1:3003", lookup, interfaceAddrs)
+		require.NoError(err)
+
+		require.True(m.Matches("10.0.0.1:3003"))
+		require.True(m.Matches("lb.example.com:3003"))
+		require.False(m.Matches("127.0.0.1:3003"))
+	})
+
+	t.Run("Invalid listener address", func(t *testing.T) {
+		_, err := newSelfAddressMatcher("3003", lookup, interfaceAddrs)
+		require.Error(err)
+		_, err = newSelfAddressMatcher("lb.example.com:3003", lookup, interfaceAddrs)
+		require.Error(err)
+	})
+}
+
+func TestSelfBackends(t *testing.T) {
+	require := require.New(t)
+
+	matcher, err := NewSelfAddressMatcher("127.0.0.1:3003")
+	require.NoError(err)
+	lb := NewLoadBalancer(uint64(5), uint64(1), WithSelfAddress(matcher))
+	lb.AddBackend(&Backend{Address: "127.0.0.1:5001", Pool: "web"})
+
+	t.Run("Transactions adding the listener are rejected", func(t *testing.T) {
+		tx := BackendTransaction{Add: []*Backend{{Address: "127.0.0.1:3003", Pool: "web"}}}
+		require.ErrorIs(lb.ValidateBackendTransaction(tx), ErrSelfBackend)
+		_, err := lb.ApplyBackendTransaction(tx)
+		require.ErrorIs(err, ErrSelfBackend)
+		require.Len(lb.Backends(), 1)
+	})
+
+	t.Run("Discovered listener is skipped", func(t *testing.T) {
+		added, _ := lb.SetPoolBackends("discovered", []*Backend{
+			{Address: "127.0.0.1:3003"},
+			{Address: "127.0.0.1:5002"},
+		})
+		require.Len(added, 1)
+		require.Equal("127.0.0.1:5002", added[0].Address)
+	})
+}
+
+func TestLoopDetectionHeader(t *testing.T) {
+	require := require.New(t)
+
+	instanceID := proxyproto.NewInstanceID()
+	lb := NewLoadBalancer(uint64(5), uint64(1), WithProxyProtocol(false), WithLoopDetection(instanceID))
+
+	upstream := proxyproto.NewInstanceID()
+	ctx := WithProxyPath(context.Background(), upstream)
+
+	clientConn := &mockConn{readBuffer: new(bytes.Buffer), writeBuffer: new(bytes.Buffer)}
+	backendConn := &mockConn{readBuffer: new(bytes.Buffer), writeBuffer: new(bytes.Buffer)}
+	require.NoError(lb.writeProxyHeader(ctx, clientConn, backendConn))
+
+	header, err := proxyproto.ReadHeaderV2(backendConn.writeBuffer)
+	require.NoError(err)
+	path, ok := header.TLV(proxyproto.TypeLoopDetection)
+	require.True(ok)
+	require.Equal(append(bytes.Clone(upstream), instanceID...), path)
+	require.True(proxyproto.LoopDetected(path, instanceID))
+}
@@ -0,0 +1,313 @@
+package lib
+
+import (
+	"bufio"
+	"cmp"
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"slices"
+	"sort"
+	"time"
+)
+
+// Arrival is a connection of a trace replayed by Simulate. Traces are
+// stored as newline-delimited JSON arrivals, e.g. recorded from the
+// connections of a production load balancer.
+type Arrival struct {
+	// Offset is the time of the arrival since the start of the trace.
+	Offset time.Duration `json:"offset"`
+
+	// Duration is the time the connection stays open on an idle backend.
+	Duration time.Duration `json:"duration"`
+
+	// Client is the ID of the client, which consistent hashing is keyed on.
+	Client string `json:"client"`
+}
+
+// ReadArrivals reads the arrivals of a trace, sorted by offset.
+func ReadArrivals(r io.Reader) ([]Arrival, error) {
+	var arrivals []Arrival
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var arrival Arrival
+		if err := json.Unmarshal(scanner.Bytes(), &arrival); err != nil {
+			return nil, fmt.Errorf("invalid arrival on line %d: %w", line, err)
+		}
+		if arrival.Offset < 0 || arrival.Duration < 0 {
+			return nil, fmt.Errorf("invalid arrival on line %d: negative offset or duration", line)
+		}
+		arrivals = append(arrivals, arrival)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read trace: %w", err)
+	}
+	slices.SortStableFunc(arrivals, func(a, b Arrival) int {
+		return cmp.Compare(a.Offset, b.Offset)
+	})
+	return arrivals, nil
+}
+
+// SyntheticTrace generates a trace of Poisson arrivals with exponentially
+// distributed durations, from clients whose activity follows a Zipf
+// distribution, so that a few clients open most connections.
+type SyntheticTrace struct {
+	// Connections is the number of arrivals.
+	Connections int
+
+	// Rate is the mean number of arrivals per second.
+	Rate float64
+
+	// MeanDuration is the mean duration of the connections.
+	MeanDuration time.Duration
+
+	// Clients is the number of distinct clients.
+	Clients int
+
+	// Seed seeds the generator, so that traces are reproducible.
+	Seed int64
+}
+
+// Arrivals generates the arrivals of the trace.
+func (s SyntheticTrace) Arrivals() []Arrival {
+	random := rand.New(rand.NewSource(s.Seed))
+	zipf := rand.NewZipf(random, 1.1, 1, uint64(max(s.Clients, 1)-1))
+	arrivals := make([]Arrival, s.Connections)
+	var offset time.Duration
+	for i := range arrivals {
+		offset += time.Duration(random.ExpFloat64() / s.Rate * float64(time.Second))
+		arrivals[i] = Arrival{
+			Offset:   offset,
+			Duration: time.Duration(random.ExpFloat64() * float64(s.MeanDuration)),
+			Client:   fmt.Sprintf("client-%d", zipf.Uint64()),
+		}
+	}
+	return arrivals
+}
+
+// SimulatedBackend is a backend of a simulation, whose latency and
+// connection durations grow with its active connections.
+type SimulatedBackend struct {
+	// Address identifies the backend.
+	Address string
+
+	// Weight is the weight of the backend. Zero means DefaultWeight.
+	Weight int
+
+	// Latency is the time to the first byte of a connection to the
+	// backend while it is idle.
+	Latency time.Duration
+
+	// Capacity is the number of active connections at which the latency
+	// and the durations of new connections double, growing linearly with
+	// the active connections. Zero means the backend never slows down.
+	Capacity int
+}
+
+// slowdown returns the factor the latency and durations of a connection
+// grow by when the backend has active connections.
+func (b SimulatedBackend) slowdown(active int64) float64 {
+	if b.Capacity <= 0 {
+		return 1
+	}
+	return 1 + float64(active)/float64(b.Capacity)
+}
+
+// SimulatedBackendStats are the outcome of a simulation for a backend.
+type SimulatedBackendStats struct {
+	// Address is the address of the backend.
+	Address string `json:"address"`
+
+	// Connections is the number of connections routed to the backend.
+	Connections int `json:"connections"`
+
+	// PeakConnections is the highest number of active connections.
+	PeakConnections int64 `json:"peak_connections"`
+
+	// Load is the time-averaged number of active connections per
+	// DefaultWeight of the backend's weight.
+	Load float64 `json:"load"`
+}
+
+// SimulationReport is the outcome of a simulation.
+type SimulationReport struct {
+	// Strategy is the simulated balancing strategy.
+	Strategy BalancingStrategy `json:"strategy"`
+
+	// Connections is the number of routed connections.
+	Connections int `json:"connections"`
+
+	// Rejected is the number of connections no backend was selected for.
+	Rejected int `json:"rejected"`
+
+	// Backends are the outcomes per backend.
+	Backends []SimulatedBackendStats `json:"backends"`
+
+	// Fairness is Jain's fairness index of the backend loads, from 1/n
+	// when a single backend takes all the load to 1 when the load is
+	// distributed in proportion to the weights.
+	Fairness float64 `json:"fairness"`
+
+	// Imbalance is the highest backend load relative to the mean load,
+	// 1 when the load is distributed in proportion to the weights.
+	Imbalance float64 `json:"imbalance"`
+
+	// LatencyP50, LatencyP95 and LatencyP99 are percentiles of the
+	// latency of the routed connections, and LatencyMax is the highest.
+	LatencyP50 time.Duration `json:"latency_p50_ns"`
+	LatencyP95 time.Duration `json:"latency_p95_ns"`
+	LatencyP99 time.Duration `json:"latency_p99_ns"`
+	LatencyMax time.Duration `json:"latency_max_ns"`
+}
+
+// simulatedConnection is an active connection of a simulation.
+type simulatedConnection struct {
+	backend *Backend
+	end     time.Duration
+}
+
+// simulatedConnections is a min-heap of active connections by end time.
+type simulatedConnections []simulatedConnection
+
+// Len implements heap.Interface.
+func (c simulatedConnections) Len() int { return len(c) }
+
+// Less implements heap.Interface.
+func (c simulatedConnections) Less(i, j int) bool { return c[i].end < c[j].end }
+
+// Swap implements heap.Interface.
+func (c simulatedConnections) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+
+// Push implements heap.Interface.
+func (c *simulatedConnections) Push(x any) { *c = append(*c, x.(simulatedConnection)) }
+
+// Pop implements heap.Interface.
+func (c *simulatedConnections) Pop() any {
+	old := *c
+	connection := old[len(old)-1]
+	*c = old[:len(old)-1]
+	return connection
+}
+
+// Simulate replays the arrivals of a trace, sorted by offset, against
+// the backends with the balancing strategy, selecting backends as the
+// load balancer does but in virtual time, without opening connections.
+// The latency of a connection to the selected backend is measured as by
+// BalanceLeastLatency.
+func Simulate(strategy BalancingStrategy, backends []SimulatedBackend, arrivals []Arrival) (*SimulationReport, error) {
+	if len(backends) == 0 {
+		return nil, errors.New("no simulated backends")
+	}
+
+	lb := NewLoadBalancer(1, 1, WithBalancing(strategy))
+	simulated := make(map[*Backend]int, len(backends))
+	stats := make([]SimulatedBackendStats, len(backends))
+	busy := make([]float64, len(backends))
+	for i, b := range backends {
+		backend := &Backend{Address: b.Address, Pool: "simulation", InitialWeight: b.Weight}
+		lb.AddBackend(backend)
+		simulated[backend] = i
+		stats[i].Address = b.Address
+	}
+	allowed := map[string]struct{}{PoolKey("simulation"): {}}
+
+	report := &SimulationReport{Strategy: strategy}
+	latencies := make([]time.Duration, 0, len(arrivals))
+	var active simulatedConnections
+	release := func(until time.Duration) {
+		for len(active) > 0 && active[0].end <= until {
+			connection := heap.Pop(&active).(simulatedConnection)
+			lb.mu.RLock()
+			connection.backend.decrementConnections()
+			lb.mu.RUnlock()
+		}
+	}
+	for _, arrival := range arrivals {
+		release(arrival.Offset)
+
+		key := ""
+		if lb.ConsistentHashing() {
+			key = arrival.Client
+		}
+		backend, err := lb.getBackend(key, nil, allowed)
+		if err != nil {
+			report.Rejected++
+			continue
+		}
+		i := simulated[backend]
+		connections := backend.ConnectionCount()
+		slowdown := backends[i].slowdown(connections - 1)
+		latency := time.Duration(float64(backends[i].Latency) * slowdown)
+		duration := time.Duration(float64(arrival.Duration) * slowdown)
+		backend.dialLatency.observe(latency)
+		heap.Push(&active, simulatedConnection{backend: backend, end: arrival.Offset + duration})
+
+		report.Connections++
+		latencies = append(latencies, latency)
+		stats[i].Connections++
+		stats[i].PeakConnections = max(stats[i].PeakConnections, connections)
+		busy[i] += duration.Seconds()
+	}
+
+	// The load is averaged over the time until the last connection ended
+	var elapsed time.Duration
+	for _, connection := range active {
+		elapsed = max(elapsed, connection.end)
+	}
+	if len(arrivals) > 0 {
+		elapsed = max(elapsed, arrivals[len(arrivals)-1].Offset)
+	}
+	loads := make([]float64, len(backends))
+	for i, b := range backends {
+		weight := b.Weight
+		if weight == 0 {
+			weight = DefaultWeight
+		}
+		if elapsed > 0 {
+			loads[i] = busy[i] / elapsed.Seconds() * DefaultWeight / float64(weight)
+		}
+		stats[i].Load = loads[i]
+	}
+	report.Backends = stats
+	report.Fairness, report.Imbalance = fairness(loads)
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	report.LatencyP50 = percentile(latencies, 0.50)
+	report.LatencyP95 = percentile(latencies, 0.95)
+	report.LatencyP99 = percentile(latencies, 0.99)
+	report.LatencyMax = percentile(latencies, 1)
+	return report, nil
+}
+
+// fairness returns Jain's fairness index of the loads and the highest
+// load relative to the mean load. Both are 1 without load.
+func fairness(loads []float64) (index, imbalance float64) {
+	var sum, squares, highest float64
+	for _, load := range loads {
+		sum += load
+		squares += load * load
+		highest = math.Max(highest, load)
+	}
+	if sum == 0 {
+		return 1, 1
+	}
+	mean := sum / float64(len(loads))
+	return sum * sum / (float64(len(loads)) * squares), highest / mean
+}
+
+// percentile returns the p-th percentile, between 0 and 1, of the sorted
+// latencies, zero without latency.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[max(i, 0)]
+}
@@ -0,0 +1,85 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// simulatedBackends returns n backends, the first one being slow.
+func simulatedBackends(n int) []SimulatedBackend {
+	backends := make([]SimulatedBackend, n)
+	for i := range backends {
+		backends[i] = SimulatedBackend{Address: fmt.Sprintf("backend-%d", i), Latency: 5 * time.Millisecond, Capacity: 50}
+	}
+	backends[0].Latency = 50 * time.Millisecond
+	return backends
+}
+
+func TestSimulate(t *testing.T) {
+	require := require.New(t)
+
+	arrivals := SyntheticTrace{Connections: 5000, Rate: 500, MeanDuration: 200 * time.Millisecond, Clients: 200, Seed: 1}.Arrivals()
+	reports := make(map[BalancingStrategy]*SimulationReport)
+	for _, strategy := range []BalancingStrategy{BalanceLeastConnections, BalanceConsistentHash, BalanceLeastLatency} {
+		report, err := Simulate(strategy, simulatedBackends(4), arrivals)
+		require.NoError(err)
+		require.Equal(len(arrivals), report.Connections)
+		require.Zero(report.Rejected)
+		require.LessOrEqual(report.LatencyP50, report.LatencyP99)
+		reports[strategy] = report
+	}
+
+	// Least connections spreads the load evenly, while hashing skewed
+	// clients does not
+	require.Greater(reports[BalanceLeastConnections].Fairness, 0.95)
+	require.Less(reports[BalanceConsistentHash].Fairness, reports[BalanceLeastConnections].Fairness)
+
+	// Least latency keeps connections away from the slow backend
+	require.Less(reports[BalanceLeastLatency].Backends[0].Connections, reports[BalanceLeastConnections].Backends[0].Connections)
+	require.Less(reports[BalanceLeastLatency].LatencyP99, reports[BalanceLeastConnections].LatencyP99)
+
+	_, err := Simulate(BalanceLeastConnections, nil, arrivals)
+	require.Error(err)
+}
+
+func TestReadArrivals(t *testing.T) {
+	require := require.New(t)
+
+	arrivals, err := ReadArrivals(strings.NewReader(`{"offset": 2000000, "duration": 1000, "client": "a"}
+
+{"offset": 1000000, "duration": 5000, "client": "b"}
+`))
+	require.NoError(err)
+	require.Equal([]Arrival{
+		{Offset: time.Millisecond, Duration: 5 * time.Microsecond, Client: "b"},
+		{Offset: 2 * time.Millisecond, Duration: time.Microsecond, Client: "a"},
+	}, arrivals)
+
+	_, err = ReadArrivals(strings.NewReader(`{"offset": -1}`))
+	require.ErrorContains(err, "line 1")
+}
+
+// BenchmarkSimulate simulates each balancing strategy on a synthetic
+// trace, reporting the fairness of the load distribution and the tail
+// latency along with the simulation time.
+func BenchmarkSimulate(b *testing.B) {
+	arrivals := SyntheticTrace{Connections: 20000, Rate: 1000, MeanDuration: time.Second, Clients: 1000, Seed: 1}.Arrivals()
+	for _, strategy := range []BalancingStrategy{BalanceLeastConnections, BalanceConsistentHash, BalanceLeastLatency} {
+		b.Run(string(strategy), func(b *testing.B) {
+			var report *SimulationReport
+			for i := 0; i < b.N; i++ {
+				var err error
+				if report, err = Simulate(strategy, simulatedBackends(8), arrivals); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(report.Fairness, "fairness")
+			b.ReportMetric(report.Imbalance, "imbalance")
+			b.ReportMetric(float64(report.LatencyP99.Microseconds()), "p99-µs")
+		})
+	}
+}
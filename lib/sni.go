@@ -0,0 +1,94 @@
+package lib
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CertificateSelector selects the server certificate presented to a client
+// by the server name it requested with SNI, so that one listener presents
+// the right certificate for several hostnames, e.g. during a domain
+// migration. Clients requesting no or an unknown server name are presented
+// the default certificate. Certificates must be added before the selector
+// is used in handshakes.
+type CertificateSelector struct {
+	// defaultCert is presented when no added certificate matches.
+	defaultCert *tls.Certificate
+
+	// names maps a lowercase server name, or a wildcard such as
+	// "*.example.com", to its certificate.
+	names map[string]*tls.Certificate
+}
+
+// NewCertificateSelector initializes and returns a CertificateSelector
+// presenting defaultCert unless an added certificate matches.
+func NewCertificateSelector(defaultCert tls.Certificate) *CertificateSelector {
+	return &CertificateSelector{
+		defaultCert: &defaultCert,
+		names:       make(map[string]*tls.Certificate),
+	}
+}
+
+// Add presents the certificate to clients requesting one of the server
+// names, which may be wildcards such as "*.example.com". Without server
+// names, the DNS names of the certificate are used. Returns an error if a
+// server name is already taken by another certificate.
+func (s *CertificateSelector) Add(cert tls.Certificate, serverNames ...string) error {
+	if len(serverNames) == 0 {
+		leaf, err := leafCertificate(cert)
+		if err != nil {
+			return err
+		}
+		serverNames = leaf.DNSNames
+	}
+	if len(serverNames) == 0 {
+		return errors.New("certificate has no DNS names to select it by")
+	}
+
+	for _, name := range serverNames {
+		name = strings.ToLower(strings.TrimSuffix(name, "."))
+		if _, exists := s.names[name]; exists {
+			return fmt.Errorf("server name '%s' is already served by another certificate", name)
+		}
+		s.names[name] = &cert
+	}
+	return nil
+}
+
+// GetCertificate returns the certificate matching the server name of the
+// ClientHello, for tls.Config.GetCertificate. Exact names take precedence
+// over wildcards.
+func (s *CertificateSelector) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if name == "" {
+		return s.defaultCert, nil
+	}
+	if cert, ok := s.names[name]; ok {
+		return cert, nil
+	}
+	// Wildcards only match a single label
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		if cert, ok := s.names["*"+name[i:]]; ok {
+			return cert, nil
+		}
+	}
+	return s.defaultCert, nil
+}
+
+// leafCertificate returns the parsed leaf of a certificate chain.
+func leafCertificate(cert tls.Certificate) (*x509.Certificate, error) {
+	if cert.Leaf != nil {
+		return cert.Leaf, nil
+	}
+	if len(cert.Certificate) == 0 {
+		return nil, errors.New("certificate chain is empty")
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse certificate: %w", err)
+	}
+	return leaf, nil
+}
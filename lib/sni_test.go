@@ -0,0 +1,63 @@
+package lib
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServerCert returns a self-signed server certificate for the DNS names.
+func newTestServerCert(t *testing.T, dnsNames ...string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "server"},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestCertificateSelector(t *testing.T) {
+	require := require.New(t)
+
+	defaultCert := newTestServerCert(t, "lb.old.example")
+	newCert := newTestServerCert(t, "lb.new.example", "*.new.example")
+	apiCert := newTestServerCert(t)
+
+	s := NewCertificateSelector(defaultCert)
+	require.NoError(s.Add(newCert))
+	require.NoError(s.Add(apiCert, "API.new.example."))
+
+	cases := map[string]tls.Certificate{
+		"":                  defaultCert,
+		"lb.old.example":    defaultCert,
+		"unknown.example":   defaultCert,
+		"lb.new.example":    newCert,
+		"LB.NEW.EXAMPLE.":   newCert,
+		"web.new.example":   newCert,
+		"api.new.example":   apiCert,
+		"a.web.new.example": defaultCert,
+	}
+	for serverName, expected := range cases {
+		cert, err := s.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+		require.NoError(err)
+		require.Equal(expected.Certificate, cert.Certificate, "Unexpected certificate for '%s'", serverName)
+	}
+
+	require.ErrorContains(s.Add(newTestServerCert(t, "lb.new.example")), "already served")
+	require.ErrorContains(s.Add(apiCert), "no DNS names")
+}
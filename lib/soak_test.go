@@ -0,0 +1,264 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"math/rand"
+	"net"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+// soakDuration enables the soak test mode, e.g. go test ./lib -run TestSoak -soak=10m.
+var soakDuration = flag.Duration("soak", 0, "duration of the data path soak test; a short run is done if zero")
+
+// soakBackend starts a backend that randomly echoes, closes right away or
+// reads until the client closes. Returns its address.
+func soakBackend(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	t.Cleanup(func() {
+		listener.Close()
+		wg.Wait()
+	})
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer conn.Close()
+				switch rand.Intn(4) {
+				case 0:
+					// Close right away
+				case 1:
+					// Drain until the client closes
+					io.Copy(io.Discard, conn)
+				default:
+					io.Copy(conn, conn)
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// soakClient opens a connection and exercises it randomly.
+func soakClient(address string) {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	// Backends draining the connection never answer
+	conn.SetDeadline(time.Now().Add(200 * time.Millisecond))
+
+	switch rand.Intn(5) {
+	case 0:
+		// Disconnect right away
+	case 1:
+		// Send and disconnect without waiting for the answer
+		conn.Write([]byte("fire and forget\n"))
+	case 2:
+		// Half-close and wait for the backend to finish
+		conn.Write([]byte("half close\n"))
+		conn.(*net.TCPConn).CloseWrite()
+		io.Copy(io.Discard, conn)
+	case 3:
+		// Stay connected for a while
+		time.Sleep(time.Duration(rand.Intn(50)) * time.Millisecond)
+	default:
+		// Exchange a few lines
+		r := bufio.NewReader(conn)
+		for i := 0; i < rand.Intn(5)+1; i++ {
+			if _, err := conn.Write([]byte("ping\n")); err != nil {
+				return
+			}
+			if _, err := r.ReadString('\n'); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// goroutineStacks returns the stacks of all goroutines.
+func goroutineStacks() string {
+	buf := make([]byte, 1<<20)
+	return string(buf[:runtime.Stack(buf, true)])
+}
+
+// routed reports whether RouteConnectionContext returned after the
+// transfer with the backend, as opposed to before a backend was connected.
+func routed(err error) bool {
+	for _, target := range []error{
+		ErrRateLimitReached, ErrNoRegisteredBackends, ErrNoAvailableBackend,
+		ErrBackendsAtCapacity, ErrQueueFull, ErrQueueTimeout,
+		ErrBackendUnreachable, ErrPoolMaintenance,
+	} {
+		if errors.Is(err, target) {
+			return false
+		}
+	}
+	return true
+}
+
+// TestSoak runs the data path under randomized connect/disconnect churn,
+// while backends are reweighted, put in maintenance and replaced, and
+// verifies that no connection count drifts and no goroutine leaks.
+func TestSoak(t *testing.T) {
+	require := require.New(t)
+
+	duration := *soakDuration
+	if duration == 0 {
+		duration = time.Second
+	}
+	baseline := runtime.NumGoroutine()
+
+	registry := metrics.NewRegistry()
+	lb := NewLoadBalancer(uint64(1<<20), uint64(1<<20),
+		WithMetrics(metrics.FromRegistry(registry)),
+		WithAdmissionQueue(16, 20*time.Millisecond))
+	addresses := []string{soakBackend(t), soakBackend(t), soakBackend(t)}
+	for i, address := range addresses {
+		lb.AddBackend(&Backend{Address: address, Pool: "soak", MaxConnections: int64(8 * (i + 1))})
+	}
+	allowedBackends := map[string]struct{}{PoolKey("soak"): {}}
+
+	// Every backend registered at some point, to verify their counts
+	var seenMu sync.Mutex
+	seen := lb.Backends()
+
+	// Route connections accepted by the proxy listener
+	proxy, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	var routes, routedConns atomic.Int64
+	var proxyWG sync.WaitGroup
+	proxyWG.Add(1)
+	go func() {
+		defer proxyWG.Done()
+		for {
+			conn, err := proxy.Accept()
+			if err != nil {
+				return
+			}
+			proxyWG.Add(1)
+			go func() {
+				defer proxyWG.Done()
+				defer conn.Close()
+				err := lb.RouteConnectionContext(context.Background(), "soak-client", conn, allowedBackends)
+				routes.Add(1)
+				if routed(err) {
+					routedConns.Add(1)
+				}
+			}()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	// Change the backends while connections come and go
+	var chaosWG sync.WaitGroup
+	chaosWG.Add(1)
+	go func() {
+		defer chaosWG.Done()
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				lb.EndMaintenance("soak")
+				return
+			case <-ticker.C:
+			}
+			address := addresses[rand.Intn(len(addresses))]
+			switch rand.Intn(4) {
+			case 0:
+				lb.SetBackendWeight(address, rand.Intn(3)*DefaultWeight, 0)
+			case 1:
+				if rand.Intn(2) == 0 {
+					lb.StartMaintenance("soak", nil)
+				} else {
+					lb.EndMaintenance("soak")
+				}
+			default:
+				// Replace the backend, keeping its active connections
+				tx := BackendTransaction{
+					Remove: []BackendRef{{Pool: "soak", Address: address}},
+					Add:    []*Backend{{Address: address, Pool: "soak", MaxConnections: 8}},
+				}
+				if result, err := lb.ApplyBackendTransaction(tx); err == nil {
+					seenMu.Lock()
+					seen = append(seen, result.Added...)
+					seenMu.Unlock()
+				}
+			}
+		}
+	}()
+
+	// Connect and disconnect clients concurrently
+	var clientWG sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		clientWG.Add(1)
+		go func() {
+			defer clientWG.Done()
+			for ctx.Err() == nil {
+				soakClient(proxy.Addr().String())
+			}
+		}()
+	}
+
+	clientWG.Wait()
+	chaosWG.Wait()
+	proxy.Close()
+	proxyWG.Wait()
+	require.Positive(routedConns.Load())
+	t.Logf("%d connections, %d routed to a backend", routes.Load(), routedConns.Load())
+
+	// No connection count drifted
+	for _, backend := range seen {
+		require.Zero(backend.ConnectionCount(), "connections of backend %s", backend.Address)
+	}
+	var exposed bytes.Buffer
+	registry.Expose(&exposed)
+	for _, line := range strings.Split(exposed.String(), "\n") {
+		if strings.HasPrefix(line, "tcplb_backend_connections{") {
+			require.True(strings.HasSuffix(line, " 0"), line)
+		}
+	}
+	require.Zero(lb.QueuedConnections())
+
+	// Every routed connection ended with exactly one close reason
+	var closes uint64
+	for _, count := range lb.CloseStats() {
+		closes += count
+	}
+	require.Equal(uint64(routedConns.Load()), closes)
+
+	// No goroutine outlived its connection, apart from the backends
+	// which are stopped on cleanup
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > baseline+len(addresses) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.LessOrEqual(runtime.NumGoroutine(), baseline+len(addresses), "goroutines leaked:\n%s", goroutineStacks())
+}
@@ -0,0 +1,31 @@
+package lib
+
+import "context"
+
+// Tracer receives detailed routing events of a traced connection,
+// formatted like log.Printf.
+type Tracer func(format string, args ...any)
+
+// tracerKey is the context key of the tracer.
+type tracerKey struct{}
+
+// WithTracer returns a copy of ctx carrying a tracer, which receives
+// the routing events of the connection routed with ctx.
+func WithTracer(ctx context.Context, tracer Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, tracer)
+}
+
+// trace reports a routing event to the tracer carried by ctx, if any.
+// Its arguments escape to the heap even if ctx carries no tracer, so calls
+// on the path of every connection are guarded by tracing.
+func trace(ctx context.Context, format string, args ...any) {
+	if tracer, ok := ctx.Value(tracerKey{}).(Tracer); ok {
+		tracer(format, args...)
+	}
+}
+
+// tracing reports whether ctx carries a tracer.
+func tracing(ctx context.Context) bool {
+	_, ok := ctx.Value(tracerKey{}).(Tracer)
+	return ok
+}
@@ -0,0 +1,238 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// BackendTransaction groups backend changes that are validated together
+// and applied atomically: either every change is applied or none is, and
+// connections are never routed to a pool in an intermediate state.
+// Removals are applied first, then additions, then weight changes, so
+// that a backend can be replaced or added with its initial weight.
+type BackendTransaction struct {
+	// Remove lists the backends to remove. They stop receiving new
+	// connections while their active connections continue.
+	Remove []BackendRef
+
+	// Add lists the backends to register. Their address, pool, group,
+	// failure domain, connection limit and initial weight are copied
+	// into the registered backends.
+	Add []*Backend
+
+	// Weights lists the weight changes.
+	Weights []WeightChange
+}
+
+// BackendRef identifies a backend within its pool.
+type BackendRef struct {
+	// Pool is the pool of the backend.
+	Pool string
+
+	// Address is the address of the backend.
+	Address string
+}
+
+// WeightChange changes the weight of the backends with an address,
+// see SetBackendWeight.
+type WeightChange struct {
+	// Address is the address of the backends.
+	Address string
+
+	// Weight is the new weight.
+	Weight int
+
+	// Ramp is the time over which the weight moves to the new value.
+	Ramp time.Duration
+}
+
+// BackendTransactionResult describes the changes of an applied transaction.
+type BackendTransactionResult struct {
+	// Added are the registered backends.
+	Added []*Backend
+
+	// Removed are the removed backends.
+	Removed []*Backend
+
+	// Reweighted are the backends whose weight changed.
+	Reweighted []*Backend
+}
+
+// backendPlan is the state of the backends once a transaction is applied.
+type backendPlan struct {
+	// backends are the registered backends.
+	backends []*Backend
+
+	// weights are the weight changes with canonical addresses.
+	weights []WeightChange
+
+	// result describes the changes.
+	result BackendTransactionResult
+}
+
+// ValidateBackendTransaction verifies that the transaction can be applied
+// to the current backends without applying it.
+func (lb *LoadBalancer) ValidateBackendTransaction(tx BackendTransaction) error {
+	// Resolve outside the lock, as lookups may be slow
+	selfErrs := lb.checkSelfBackends(tx.Add)
+
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+
+	_, err := lb.planTransaction(tx, selfErrs)
+	return err
+}
+
+// ApplyBackendTransaction validates the transaction against the current
+// backends and applies it atomically. Nothing is applied if any change is
+// invalid, and every problem found is reported.
+func (lb *LoadBalancer) ApplyBackendTransaction(tx BackendTransaction) (*BackendTransactionResult, error) {
+	// Resolve outside the lock, as lookups may be slow
+	selfErrs := lb.checkSelfBackends(tx.Add)
+	if d, ok := lb.dialer.(*resolvingDialer); ok {
+		for _, backend := range tx.Add {
+			if address, err := CanonicalAddress(backend.Address, ""); err == nil {
+				d.pin(address)
+			}
+		}
+	}
+
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	plan, err := lb.planTransaction(tx, selfErrs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Weights of added backends are set before they receive connections,
+	// and all weights are set while backend selection is blocked
+	for _, change := range plan.weights {
+		for _, backend := range plan.backends {
+			if backend.Address == change.Address {
+				backend.setWeight(change.Weight, change.Ramp)
+			}
+		}
+	}
+	lb.backends = plan.backends
+	lb.index = newBackendIndex(plan.backends)
+	return &plan.result, nil
+}
+
+// planTransaction computes the backends once the transaction is applied,
+// failing with errs, which were found beforehand, along with any problem
+// found here. The caller must hold lb.mu, and the registered backends are
+// not modified.
+func (lb *LoadBalancer) planTransaction(tx BackendTransaction, errs []error) (*backendPlan, error) {
+	plan := &backendPlan{}
+
+	// Removals
+	removing := make(map[BackendRef]struct{}, len(tx.Remove))
+	for _, ref := range tx.Remove {
+		address, err := CanonicalAddress(ref.Address, "")
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		ref.Address = address
+		if _, exists := removing[ref]; exists {
+			errs = append(errs, fmt.Errorf("backend %s of pool '%s' is removed twice", ref.Address, ref.Pool))
+			continue
+		}
+		removing[ref] = struct{}{}
+	}
+	registered := make(map[BackendRef]struct{}, len(lb.backends))
+	plan.backends = make([]*Backend, 0, len(lb.backends)+len(tx.Add))
+	for _, backend := range lb.backends {
+		ref := BackendRef{Pool: backend.Pool, Address: backend.Address}
+		if _, ok := removing[ref]; ok {
+			plan.result.Removed = append(plan.result.Removed, backend)
+			continue
+		}
+		registered[ref] = struct{}{}
+		plan.backends = append(plan.backends, backend)
+	}
+	if len(plan.result.Removed) < len(removing) {
+		for ref := range removing {
+			if !containsBackend(plan.result.Removed, ref) {
+				errs = append(errs, fmt.Errorf("%w '%s' in pool '%s'", ErrUnknownBackend, ref.Address, ref.Pool))
+			}
+		}
+	}
+
+	// Additions
+	for _, backend := range tx.Add {
+		address, err := CanonicalAddress(backend.Address, "")
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if backend.MaxConnections < 0 {
+			errs = append(errs, fmt.Errorf("max connections of backend %s must not be negative", address))
+			continue
+		}
+		ref := BackendRef{Pool: backend.Pool, Address: address}
+		if _, exists := registered[ref]; exists {
+			errs = append(errs, fmt.Errorf("backend %s is already registered in pool '%s'", address, backend.Pool))
+			continue
+		}
+		registered[ref] = struct{}{}
+		added := &Backend{
+			Address:        address,
+			Pool:           backend.Pool,
+			Group:          backend.Group,
+			FailureDomain:  backend.FailureDomain,
+			MaxConnections: backend.MaxConnections,
+			InitialWeight:  backend.InitialWeight,
+			poolKey:        PoolKey(backend.Pool),
+		}
+		plan.backends = append(plan.backends, added)
+		plan.result.Added = append(plan.result.Added, added)
+	}
+
+	// Weight changes
+	for _, change := range tx.Weights {
+		address, err := CanonicalAddress(change.Address, "")
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		change.Address = address
+		if change.Weight < 0 || change.Weight > MaxWeight {
+			errs = append(errs, fmt.Errorf("weight of backend %s must be between 0 and %d", address, MaxWeight))
+			continue
+		}
+		if change.Ramp < 0 {
+			errs = append(errs, fmt.Errorf("weight ramp of backend %s must not be negative", address))
+			continue
+		}
+		found := false
+		for _, backend := range plan.backends {
+			if backend.Address == address {
+				plan.result.Reweighted = append(plan.result.Reweighted, backend)
+				found = true
+			}
+		}
+		if !found {
+			errs = append(errs, fmt.Errorf("%w '%s'", ErrUnknownBackend, address))
+			continue
+		}
+		plan.weights = append(plan.weights, change)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// containsBackend reports whether a backend of the list is identified by ref.
+func containsBackend(backends []*Backend, ref BackendRef) bool {
+	for _, backend := range backends {
+		if backend.Pool == ref.Pool && backend.Address == ref.Address {
+			return true
+		}
+	}
+	return false
+}
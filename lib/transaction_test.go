@@ -0,0 +1,70 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyBackendTransaction(t *testing.T) {
+	require := require.New(t)
+
+	lb := NewLoadBalancer(uint64(5), uint64(1))
+	lb.AddBackend(&Backend{Address: "127.0.0.1:5001", Pool: "web"})
+	lb.AddBackend(&Backend{Address: "127.0.0.1:5002", Pool: "web"})
+	allowedBackends := map[string]struct{}{PoolKey("web"): {}}
+
+	t.Run("Invalid transaction is not applied", func(t *testing.T) {
+		tx := BackendTransaction{
+			Remove:  []BackendRef{{Pool: "web", Address: "127.0.0.1:5001"}, {Pool: "web", Address: "127.0.0.1:5009"}},
+			Add:     []*Backend{{Address: "127.0.0.1:5003", Pool: "web"}, {Address: "127.0.0.1:5002", Pool: "web"}},
+			Weights: []WeightChange{{Address: "127.0.0.1:5003", Weight: MaxWeight + 1}},
+		}
+		err := lb.ValidateBackendTransaction(tx)
+		require.ErrorIs(err, ErrUnknownBackend)
+
+		_, err = lb.ApplyBackendTransaction(tx)
+		require.ErrorIs(err, ErrUnknownBackend)
+		require.ErrorContains(err, "already registered")
+		require.ErrorContains(err, "must be between 0")
+
+		backends := lb.Backends()
+		require.Len(backends, 2)
+		require.Equal("127.0.0.1:5001", backends[0].Address)
+	})
+
+	t.Run("Valid transaction is applied", func(t *testing.T) {
+		tx := BackendTransaction{
+			Remove: []BackendRef{{Pool: "web", Address: "127.0.0.1:5001"}},
+			Add: []*Backend{
+				{Address: "127.0.0.1:5003", Pool: "web"},
+				{Address: "127.0.0.1:5001", Pool: "web", MaxConnections: 10, InitialWeight: 50},
+			},
+			Weights: []WeightChange{
+				{Address: "127.0.0.1:5002", Weight: 0},
+				{Address: "127.0.0.1:5003", Weight: 200, Ramp: time.Minute},
+			},
+		}
+		require.NoError(lb.ValidateBackendTransaction(tx))
+
+		result, err := lb.ApplyBackendTransaction(tx)
+		require.NoError(err)
+		require.Len(result.Removed, 1)
+		require.Len(result.Added, 2)
+		require.Len(result.Reweighted, 2)
+		require.Len(lb.Backends(), 3)
+		require.Equal(int64(10), result.Added[1].MaxConnections)
+		require.Equal(50, result.Added[1].Weight())
+
+		// The added backend is ramping up from its initial weight
+		require.Equal(200, result.Added[0].TargetWeight())
+
+		// The weighted out backend receives no connections
+		for i := 0; i < 10; i++ {
+			b, err := lb.GetBackend(allowedBackends)
+			require.NoError(err)
+			require.NotEqual("127.0.0.1:5002", b.Address)
+		}
+	})
+}
@@ -0,0 +1,132 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// define backend weight limits.
+const (
+	// DefaultWeight is the weight of a backend whose weight was never set.
+	DefaultWeight = 100
+
+	// MaxWeight is the highest weight of a backend.
+	MaxWeight = 1000
+)
+
+// ErrUnknownBackend is returned when changing the weight of a backend that is not registered.
+var ErrUnknownBackend = errors.New("unknown backend")
+
+// weightRamp describes a linear transition of a backend's weight.
+type weightRamp struct {
+	// from is the weight at the start of the ramp.
+	from int
+
+	// to is the weight at the end of the ramp.
+	to int
+
+	// start is the time the ramp started.
+	start time.Time
+
+	// duration is the length of the ramp. Zero applies the weight at once.
+	duration time.Duration
+}
+
+// at returns the weight of the ramp at the given time.
+func (r *weightRamp) at(now time.Time) int {
+	elapsed := now.Sub(r.start)
+	if r.duration <= 0 || elapsed >= r.duration {
+		return r.to
+	}
+	if elapsed <= 0 {
+		return r.from
+	}
+	return r.from + int(float64(r.to-r.from)*float64(elapsed)/float64(r.duration))
+}
+
+// Weight returns the current weight of the backend, which determines its
+// share of connections relative to the other allowed backends. A backend
+// with a zero weight receives no new connections.
+func (b *Backend) Weight() int {
+	ramp := b.weight.Load()
+	if ramp == nil {
+		return DefaultWeight
+	}
+	return ramp.at(time.Now())
+}
+
+// TargetWeight returns the weight the backend is ramping to.
+func (b *Backend) TargetWeight() int {
+	ramp := b.weight.Load()
+	if ramp == nil {
+		return DefaultWeight
+	}
+	return ramp.to
+}
+
+// rampEnd returns the time the weight ramp of the backend ends, or the
+// zero time if its weight is not ramping.
+func (b *Backend) rampEnd() time.Time {
+	ramp := b.weight.Load()
+	if ramp == nil || ramp.duration <= 0 {
+		return time.Time{}
+	}
+	end := ramp.start.Add(ramp.duration)
+	if !time.Now().Before(end) {
+		return time.Time{}
+	}
+	return end
+}
+
+// applyInitialWeight sets the initial weight of a backend being
+// registered, unless its weight was already set.
+func (b *Backend) applyInitialWeight() {
+	if b.InitialWeight <= 0 {
+		return
+	}
+	weight := min(b.InitialWeight, MaxWeight)
+	b.weight.CompareAndSwap(nil, &weightRamp{from: weight, to: weight})
+}
+
+// setWeight starts a ramp from the current weight to the given weight.
+// The caller must hold lb.mu.
+func (b *Backend) setWeight(weight int, ramp time.Duration) {
+	b.weight.Store(&weightRamp{
+		from:     b.Weight(),
+		to:       weight,
+		start:    time.Now(),
+		duration: ramp,
+	})
+	b.fixHeaps()
+}
+
+// SetBackendWeight changes the weight of the backends with the given
+// address, in every pool they belong to. The weight moves linearly from
+// its current value to the new one over the ramp duration, so that
+// traffic shifts gradually rather than at once. A zero ramp applies the
+// weight immediately. Active connections are not affected.
+// Returns the updated backends.
+func (lb *LoadBalancer) SetBackendWeight(address string, weight int, ramp time.Duration) ([]*Backend, error) {
+	if weight < 0 || weight > MaxWeight {
+		return nil, fmt.Errorf("weight must be between 0 and %d", MaxWeight)
+	}
+	if ramp < 0 {
+		return nil, errors.New("weight ramp must not be negative")
+	}
+
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	var updated []*Backend
+	for _, backend := range lb.backends {
+		if backend.Address == address {
+			backend.setWeight(weight, ramp)
+			updated = append(updated, backend)
+		}
+	}
+	if len(updated) == 0 {
+		return nil, fmt.Errorf("%w '%s'", ErrUnknownBackend, address)
+	}
+	return updated, nil
+}
@@ -0,0 +1,95 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWeightRamp(t *testing.T) {
+	require := require.New(t)
+
+	start := time.Now()
+	ramp := &weightRamp{from: 100, to: 0, start: start, duration: 10 * time.Second}
+	require.Equal(100, ramp.at(start))
+	require.Equal(50, ramp.at(start.Add(5*time.Second)))
+	require.Equal(0, ramp.at(start.Add(10*time.Second)))
+	require.Equal(0, ramp.at(start.Add(time.Minute)))
+
+	immediate := &weightRamp{from: 100, to: 20, start: start}
+	require.Equal(20, immediate.at(start))
+}
+
+func TestSetBackendWeight(t *testing.T) {
+	require := require.New(t)
+
+	lb := NewLoadBalancer(uint64(5), uint64(1))
+	heavy := &Backend{Address: "127.0.0.1:5001"}
+	light := &Backend{Address: "127.0.0.1:5002"}
+	lb.AddBackend(heavy)
+	lb.AddBackend(light)
+	allowedBackends := map[string]struct{}{heavy.Address: {}, light.Address: {}}
+
+	require.Equal(DefaultWeight, light.Weight())
+
+	_, err := lb.SetBackendWeight("127.0.0.1:5003", 50, 0)
+	require.ErrorIs(err, ErrUnknownBackend)
+	_, err = lb.SetBackendWeight(light.Address, MaxWeight+1, 0)
+	require.Error(err)
+
+	updated, err := lb.SetBackendWeight(light.Address, 25, 0)
+	require.NoError(err)
+	require.Equal([]*Backend{light}, updated)
+	require.Equal(25, light.Weight())
+
+	// Connections are spread proportionally to the weights
+	for i := 0; i < 10; i++ {
+		_, err := lb.GetBackend(allowedBackends)
+		require.NoError(err)
+	}
+	require.Equal(int64(8), heavy.ConnectionCount())
+	require.Equal(int64(2), light.ConnectionCount())
+
+	// A zero weight takes the backend out of the selection
+	_, err = lb.SetBackendWeight(heavy.Address, 0, 0)
+	require.NoError(err)
+	b, err := lb.GetBackend(allowedBackends)
+	require.NoError(err)
+	require.Equal(light, b)
+
+	// A ramp starts from the current weight
+	_, err = lb.SetBackendWeight(heavy.Address, 200, time.Hour)
+	require.NoError(err)
+	require.Less(heavy.Weight(), 10)
+	require.Equal(200, heavy.TargetWeight())
+}
+
+func TestInitialWeight(t *testing.T) {
+	require := require.New(t)
+
+	lb := NewLoadBalancer(uint64(5), uint64(1))
+	large := &Backend{Address: "127.0.0.1:5001", Pool: "web", InitialWeight: 300}
+	small := &Backend{Address: "127.0.0.1:5002", Pool: "web"}
+	lb.AddBackend(large)
+	lb.AddBackend(small)
+	require.Equal(300, large.Weight())
+	require.Equal(DefaultWeight, small.Weight())
+
+	// Connections are shared in proportion to the weights
+	allowedBackends := map[string]struct{}{PoolKey("web"): {}}
+	counts := make(map[*Backend]int)
+	for i := 0; i < 8; i++ {
+		backend, err := lb.GetBackend(allowedBackends)
+		require.NoError(err)
+		counts[backend]++
+	}
+	require.Equal(6, counts[large])
+	require.Equal(2, counts[small])
+
+	// Weights changed at runtime survive the re-registration of the pool
+	_, err := lb.SetBackendWeight(large.Address, 50, 0)
+	require.NoError(err)
+	lb.SetPoolBackends("web", []*Backend{{Address: large.Address}, {Address: small.Address}})
+	require.Equal(50, large.Weight())
+}
@@ -0,0 +1,191 @@
+package listen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/logging"
+)
+
+// Retry defines how binding an address already in use is retried, e.g.
+// while a previous instance is still shutting down. The zero value does
+// not retry.
+type Retry struct {
+	// Attempts is the number of retries after the first attempt.
+	Attempts int
+
+	// Delay is the delay before the first retry, doubled after every
+	// retry up to MaxDelay.
+	Delay time.Duration
+
+	// MaxDelay bounds the delay between two retries. Zero means unbounded.
+	MaxDelay time.Duration
+}
+
+// Error is a listen failure with an actionable diagnosis of its cause.
+type Error struct {
+	// Address is the address that could not be listened on.
+	Address string
+
+	// Diagnosis describes the cause of the failure and how to fix it.
+	Diagnosis string
+
+	// Err is the underlying error.
+	Err error
+}
+
+// Error implements error.
+func (e *Error) Error() string {
+	if e.Diagnosis == "" {
+		return fmt.Sprintf("unable to listen on %s: %v", e.Address, e.Err)
+	}
+	return fmt.Sprintf("unable to listen on %s: %s (%v)", e.Address, e.Diagnosis, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// SocketOptions tune the listening socket, e.g. for high connection
+// rates. The zero value keeps the system defaults.
+type SocketOptions struct {
+	// Backlog is the maximum number of connections pending acceptance,
+	// capped by net.core.somaxconn. Zero keeps the default of Go, which
+	// is net.core.somaxconn.
+	Backlog int
+
+	// ReuseAddr sets SO_REUSEADDR, allowing to bind the address while
+	// connections of a previous listener are in TIME_WAIT. Nil keeps the
+	// default of Go, which enables it on TCP listeners.
+	ReuseAddr *bool
+
+	// DeferAccept sets TCP_DEFER_ACCEPT, so that connections are only
+	// accepted once their client sent data, waiting at most for this
+	// timeout rounded up to seconds. Zero disables it.
+	DeferAccept time.Duration
+}
+
+// listen listens on the address with the socket options.
+func (o SocketOptions) listen(network, address string) (net.Listener, error) {
+	var config net.ListenConfig
+	if o.ReuseAddr != nil || o.DeferAccept > 0 {
+		config.Control = o.control
+	}
+	listener, err := config.Listen(context.Background(), network, address)
+	if err != nil {
+		return nil, err
+	}
+	if o.Backlog > 0 {
+		if err := setBacklog(listener, o.Backlog); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+	return listener, nil
+}
+
+// Listen listens on the TCP address like net.Listen, retrying with
+// backoff while the address is in use. On failure, the returned *Error
+// diagnoses the cause, e.g. the process holding the port.
+func Listen(address string, retry Retry) (net.Listener, error) {
+	return ListenNetwork("tcp", address, retry, SocketOptions{})
+}
+
+// ListenNetwork is like Listen on the "tcp" or "unix" network, with the
+// socket options. Unix addresses are socket paths, which must not exist
+// yet; binding them is not retried.
+func ListenNetwork(network, address string, retry Retry, options SocketOptions) (net.Listener, error) {
+	if network == "unix" {
+		retry = Retry{}
+	}
+	delay := retry.Delay
+	for attempt := 0; ; attempt++ {
+		listener, err := options.listen(network, address)
+		if err == nil {
+			return listener, nil
+		}
+		if attempt >= retry.Attempts || !errors.Is(err, syscall.EADDRINUSE) {
+			return nil, Diagnose(address, err)
+		}
+
+		logging.Warnf("Address %s is in use, retrying in %s (%d/%d)", address, delay, attempt+1, retry.Attempts)
+		time.Sleep(delay)
+		delay *= 2
+		if retry.MaxDelay > 0 && delay > retry.MaxDelay {
+			delay = retry.MaxDelay
+		}
+	}
+}
+
+// Diagnose returns an *Error describing the cause of a listen failure.
+func Diagnose(address string, err error) error {
+	e := &Error{Address: address, Err: err}
+	host, portStr, splitErr := net.SplitHostPort(address)
+	port, portErr := strconv.Atoi(portStr)
+	if splitErr != nil || portErr != nil {
+		return e
+	}
+
+	switch {
+	case errors.Is(err, syscall.EADDRINUSE):
+		e.Diagnosis = fmt.Sprintf("port %d is already in use", port)
+		if owner := portOwner(port); owner != "" {
+			e.Diagnosis += " by " + owner
+		}
+
+	case errors.Is(err, syscall.EACCES) && port < 1024:
+		e.Diagnosis = fmt.Sprintf("permission denied for privileged port %d, run as root or grant "+
+			"the binary the CAP_NET_BIND_SERVICE capability, e.g. setcap 'cap_net_bind_service=+ep' <binary>", port)
+
+	case errors.Is(err, syscall.EACCES):
+		e.Diagnosis = "permission denied, check the security policy (e.g. SELinux) of the process"
+
+	case errors.Is(err, syscall.EADDRNOTAVAIL):
+		e.Diagnosis = fmt.Sprintf("address %s is not assigned to any interface", host)
+		if addrs := interfaceAddresses(); addrs != "" {
+			e.Diagnosis += ", available addresses: " + addrs
+		}
+	}
+	return e
+}
+
+// interfaceAddresses lists the IP addresses of the network interfaces.
+func interfaceAddresses() string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ""
+	}
+	ips := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			ips = append(ips, ipNet.IP.String())
+		}
+	}
+	return strings.Join(ips, ", ")
+}
+
+// IsLocal reports whether the address on the "tcp" or "unix" network is
+// only reachable from the host: Unix sockets, and TCP addresses whose host
+// is "localhost" or a loopback IP. Addresses binding every interface, such
+// as ":8080", are not local.
+func IsLocal(network, address string) bool {
+	if network == "unix" {
+		return true
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,76 @@
+package listen
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenInUse(t *testing.T) {
+	require := require.New(t)
+
+	listener, err := Listen("127.0.0.1:0", Retry{})
+	require.NoError(err)
+	defer listener.Close()
+
+	start := time.Now()
+	_, err = Listen(listener.Addr().String(), Retry{Attempts: 2, Delay: 10 * time.Millisecond})
+	require.ErrorIs(err, syscall.EADDRINUSE)
+	require.GreaterOrEqual(time.Since(start), 30*time.Millisecond, "Expected retries with backoff")
+
+	var listenErr *Error
+	require.True(errors.As(err, &listenErr))
+	require.Contains(listenErr.Diagnosis, "is already in use")
+	if runtime.GOOS == "linux" {
+		require.Contains(err.Error(), fmt.Sprintf("PID %d", os.Getpid()))
+	}
+}
+
+func TestDiagnose(t *testing.T) {
+	require := require.New(t)
+
+	err := Diagnose("0.0.0.0:443", &os.SyscallError{Syscall: "bind", Err: syscall.EACCES})
+	require.ErrorContains(err, "CAP_NET_BIND_SERVICE")
+
+	err = Diagnose("192.0.2.1:3003", &os.SyscallError{Syscall: "bind", Err: syscall.EADDRNOTAVAIL})
+	require.ErrorContains(err, "192.0.2.1 is not assigned to any interface")
+
+	err = Diagnose("invalid", errors.New("missing port"))
+	require.EqualError(err, "unable to listen on invalid: missing port")
+}
+
+func TestListenNetworkUnix(t *testing.T) {
+	require := require.New(t)
+
+	path := t.TempDir() + "/lb.sock"
+	listener, err := ListenNetwork("unix", path, Retry{}, SocketOptions{})
+	require.NoError(err)
+	require.Equal(path, listener.Addr().String())
+
+	_, err = ListenNetwork("unix", path, Retry{}, SocketOptions{})
+	var listenErr *Error
+	require.ErrorAs(err, &listenErr, "Expected an existing socket path to fail")
+
+	require.NoError(listener.Close())
+	_, err = os.Stat(path)
+	require.True(os.IsNotExist(err), "Expected the socket file to be removed on close")
+}
+
+func TestIsLocal(t *testing.T) {
+	require := require.New(t)
+
+	require.True(IsLocal("unix", "/run/lb.sock"))
+	require.True(IsLocal("tcp", "127.0.0.1:3003"))
+	require.True(IsLocal("tcp", "[::1]:3003"))
+	require.True(IsLocal("tcp", "localhost:3003"))
+	require.False(IsLocal("tcp", ":3003"), "Expected every interface not to be local")
+	require.False(IsLocal("tcp", "0.0.0.0:3003"))
+	require.False(IsLocal("tcp", "10.0.0.5:3003"))
+	require.False(IsLocal("tcp", "127.0.0.1"), "Expected an address without port not to be local")
+}
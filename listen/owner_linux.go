@@ -0,0 +1,75 @@
+package listen
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// tcpListenState is the state of listening sockets in /proc/net/tcp.
+const tcpListenState = "0A"
+
+// portOwner describes the process listening on the TCP port, e.g.
+// "PID 1234 (nginx)", or returns an empty string if it cannot be found,
+// e.g. because the process belongs to another user.
+func portOwner(port int) string {
+	inodes := make(map[string]struct{})
+	for _, path := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		listeningInodes(path, port, inodes)
+	}
+	if len(inodes) == 0 {
+		return ""
+	}
+
+	fds, _ := filepath.Glob("/proc/[0-9]*/fd/*")
+	for _, fd := range fds {
+		link, err := os.Readlink(fd)
+		if err != nil {
+			continue
+		}
+		inode, ok := strings.CutPrefix(link, "socket:[")
+		if !ok {
+			continue
+		}
+		if _, ok := inodes[strings.TrimSuffix(inode, "]")]; !ok {
+			continue
+		}
+
+		pid := strings.Split(fd, "/")[2]
+		comm, err := os.ReadFile(filepath.Join("/proc", pid, "comm"))
+		if err != nil {
+			return "PID " + pid
+		}
+		return fmt.Sprintf("PID %s (%s)", pid, strings.TrimSpace(string(comm)))
+	}
+	return "a process of another user"
+}
+
+// listeningInodes adds the socket inodes listening on the port
+// listed in a /proc/net/tcp file to inodes.
+func listeningInodes(path string, port int, inodes map[string]struct{}) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != tcpListenState {
+			continue
+		}
+		_, localPort, ok := strings.Cut(fields[1], ":")
+		if !ok {
+			continue
+		}
+		if p, err := strconv.ParseInt(localPort, 16, 32); err == nil && int(p) == port {
+			inodes[fields[9]] = struct{}{}
+		}
+	}
+}
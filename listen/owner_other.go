@@ -0,0 +1,9 @@
+//go:build !linux
+
+package listen
+
+// portOwner describes the process listening on the TCP port.
+// Finding it is only supported on Linux.
+func portOwner(port int) string {
+	return ""
+}
@@ -0,0 +1,62 @@
+package listen
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// control sets the socket options on the socket before it is bound.
+func (o SocketOptions) control(network, address string, c syscall.RawConn) error {
+	var err error
+	controlErr := c.Control(func(fd uintptr) {
+		if o.ReuseAddr != nil {
+			reuse := 0
+			if *o.ReuseAddr {
+				reuse = 1
+			}
+			err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, reuse)
+			if err != nil {
+				err = os.NewSyscallError("setsockopt SO_REUSEADDR", err)
+				return
+			}
+		}
+		if o.DeferAccept > 0 {
+			seconds := int((o.DeferAccept + time.Second - 1) / time.Second)
+			err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_DEFER_ACCEPT, seconds)
+			if err != nil {
+				err = os.NewSyscallError("setsockopt TCP_DEFER_ACCEPT", err)
+			}
+		}
+	})
+	if controlErr != nil {
+		return controlErr
+	}
+	return err
+}
+
+// setBacklog sets the backlog of the listening socket by listening on it
+// again, which Linux allows to resize its queue of pending connections.
+func setBacklog(listener net.Listener, backlog int) error {
+	conn, ok := listener.(syscall.Conn)
+	if !ok {
+		return errors.New("unable to set the backlog of a listener without socket")
+	}
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return fmt.Errorf("unable to set the backlog: %w", err)
+	}
+	controlErr := raw.Control(func(fd uintptr) {
+		err = syscall.Listen(int(fd), backlog)
+	})
+	if controlErr != nil {
+		return fmt.Errorf("unable to set the backlog: %w", controlErr)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to set the backlog: %w", os.NewSyscallError("listen", err))
+	}
+	return nil
+}
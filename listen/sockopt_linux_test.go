@@ -0,0 +1,54 @@
+package listen
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// socketOption reads an integer option of the socket of the listener.
+func socketOption(t *testing.T, listener net.Listener, level, option int) int {
+	raw, err := listener.(syscall.Conn).SyscallConn()
+	require.NoError(t, err)
+	var value int
+	require.NoError(t, raw.Control(func(fd uintptr) {
+		value, err = syscall.GetsockoptInt(int(fd), level, option)
+	}))
+	require.NoError(t, err)
+	return value
+}
+
+func TestListenSocketOptions(t *testing.T) {
+	require := require.New(t)
+
+	reuseAddr := false
+	listener, err := ListenNetwork("tcp", "127.0.0.1:0", Retry{}, SocketOptions{
+		Backlog:     16,
+		ReuseAddr:   &reuseAddr,
+		DeferAccept: 1500 * time.Millisecond,
+	})
+	require.NoError(err)
+	defer listener.Close()
+
+	require.Zero(socketOption(t, listener, syscall.SOL_SOCKET, syscall.SO_REUSEADDR))
+	require.NotZero(socketOption(t, listener, syscall.IPPROTO_TCP, syscall.TCP_DEFER_ACCEPT))
+
+	// Connections are accepted once their client sent data
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(err)
+	accepted, err := listener.Accept()
+	require.NoError(err)
+	accepted.Close()
+
+	// Go enables SO_REUSEADDR by default
+	listener, err = Listen("127.0.0.1:0", Retry{})
+	require.NoError(err)
+	defer listener.Close()
+	require.NotZero(socketOption(t, listener, syscall.SOL_SOCKET, syscall.SO_REUSEADDR))
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package listen
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// errSocketOptions is returned when setting socket options, which is only
+// supported on Linux.
+var errSocketOptions = errors.New("listener socket options are only supported on Linux")
+
+// control sets the socket options on the socket before it is bound.
+func (o SocketOptions) control(network, address string, c syscall.RawConn) error {
+	return errSocketOptions
+}
+
+// setBacklog sets the backlog of the listening socket.
+func setBacklog(listener net.Listener, backlog int) error {
+	return errSocketOptions
+}
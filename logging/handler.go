@@ -0,0 +1,93 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// stdHandler is the handler of the default logger. It writes the records
+// of at least the level set with SetLevel through the standard logger as
+// "LEVEL message key=value ...".
+type stdHandler struct {
+	// attrs are the formatted attributes added with WithAttrs.
+	attrs string
+
+	// group prefixes the keys of the attributes added after WithGroup.
+	group string
+}
+
+// Enabled implements slog.Handler.
+func (h stdHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= level.Level()
+}
+
+// Handle implements slog.Handler.
+func (h stdHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	b.WriteString(r.Level.String())
+	b.WriteByte(' ')
+	b.WriteString(r.Message)
+	b.WriteString(h.attrs)
+	r.Attrs(func(attr slog.Attr) bool {
+		appendAttr(&b, h.group, attr)
+		return true
+	})
+	return log.Output(0, b.String())
+}
+
+// WithAttrs implements slog.Handler.
+func (h stdHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	b.WriteString(h.attrs)
+	for _, attr := range attrs {
+		appendAttr(&b, h.group, attr)
+	}
+	h.attrs = b.String()
+	return h
+}
+
+// WithGroup implements slog.Handler.
+func (h stdHandler) WithGroup(name string) slog.Handler {
+	if name != "" {
+		h.group += name + "."
+	}
+	return h
+}
+
+// appendAttr formats the attribute as " key=value", with the keys of
+// group attributes prefixed by their group, quoting values as needed.
+func appendAttr(b *strings.Builder, group string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+	if attr.Value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			group += attr.Key + "."
+		}
+		for _, groupAttr := range attr.Value.Group() {
+			appendAttr(b, group, groupAttr)
+		}
+		return
+	}
+	value := attr.Value.String()
+	if value == "" || strings.ContainsAny(value, " =\"\n") {
+		value = strconv.Quote(value)
+	}
+	b.WriteByte(' ')
+	b.WriteString(group)
+	b.WriteString(attr.Key)
+	b.WriteByte('=')
+	b.WriteString(value)
+}
+
+// NewJSONHandler returns a handler writing the records of at least the
+// level set with SetLevel to w as JSON objects, one per line, e.g. to ship
+// the logs to a log pipeline without parsing them.
+func NewJSONHandler(w io.Writer) slog.Handler {
+	return slog.NewJSONHandler(w, &slog.HandlerOptions{Level: &level})
+}
@@ -0,0 +1,214 @@
+// Package logging logs leveled messages, formatted like log.Printf,
+// through a log/slog handler. Messages are logged through the standard
+// logger by default, filtered by a level that can be changed at runtime;
+// embedders may supply their own handler instead, see New.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Level is the severity of a log message.
+type Level int32
+
+// define log levels, ordered by severity.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// String returns the name of the level.
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int32(l))
+}
+
+// Slog returns the slog level of the level.
+func (l Level) Slog() slog.Level {
+	switch l {
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelWarn:
+		return slog.LevelWarn
+	case LevelError:
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// ParseLevel returns the level with the given name, e.g. "debug".
+func ParseLevel(name string) (Level, error) {
+	for l := LevelDebug; l <= LevelError; l++ {
+		if strings.EqualFold(name, l.String()) {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level '%s'", name)
+}
+
+// level is the minimum level of the messages logged by the default
+// handler. The zero value is LevelInfo.
+var level slog.LevelVar
+
+// SetLevel sets the minimum level of the messages logged by the default
+// handler. It is safe to call at runtime, e.g. to raise the verbosity
+// while investigating an incident.
+func SetLevel(l Level) {
+	level.Set(l.Slog())
+}
+
+// GetLevel returns the minimum level of the messages logged by the
+// default handler.
+func GetLevel() Level {
+	switch l := level.Level(); {
+	case l < slog.LevelInfo:
+		return LevelDebug
+	case l < slog.LevelWarn:
+		return LevelInfo
+	case l < slog.LevelError:
+		return LevelWarn
+	}
+	return LevelError
+}
+
+// Enabled reports whether messages of the level are logged by the
+// default handler.
+func Enabled(l Level) bool {
+	return l >= GetLevel()
+}
+
+// Logger logs messages formatted like log.Printf at the level of the
+// method called through a slog handler.
+type Logger struct {
+	// handler handles the records of the logged messages.
+	handler slog.Handler
+}
+
+// New returns a logger logging through the handler, e.g. to route the
+// logs of an embedded load balancer into the embedder's logs. The level
+// set with SetLevel does not apply; the handler filters the messages.
+func New(handler slog.Handler) *Logger {
+	return &Logger{handler: handler}
+}
+
+// std is the default logger.
+var std atomic.Pointer[Logger]
+
+func init() {
+	std.Store(New(stdHandler{}))
+}
+
+// Default returns the default logger, which logs through the standard
+// logger the messages of at least the level set with SetLevel unless
+// replaced with SetDefault.
+func Default() *Logger {
+	return std.Load()
+}
+
+// SetDefault replaces the default logger, e.g. to log as JSON. Loggers
+// returned by Default before are not affected, so it should be called
+// at startup before the logger is handed out.
+func SetDefault(l *Logger) {
+	std.Store(l)
+}
+
+// Slog returns a slog logger logging through the handler of the logger.
+func (l *Logger) Slog() *slog.Logger {
+	return slog.New(l.handler)
+}
+
+// logf logs a message of the level through the handler.
+func (l *Logger) logf(level slog.Level, format string, args ...any) {
+	if !l.enabled(level) {
+		return
+	}
+	// Skip runtime.Callers, log, logf and the function calling it
+	l.log(4, level, fmt.Sprintf(format, args...))
+}
+
+// enabled reports whether the handler logs messages of the level.
+func (l *Logger) enabled(level slog.Level) bool {
+	return l.handler.Enabled(context.Background(), level)
+}
+
+// log logs the message through the handler, attributed to the caller
+// skip frames up the stack, as counted by runtime.Callers, or to no
+// caller if skip is zero.
+func (l *Logger) log(skip int, level slog.Level, msg string) {
+	var pcs [1]uintptr
+	if skip > 0 {
+		runtime.Callers(skip, pcs[:])
+	}
+	record := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	_ = l.handler.Handle(context.Background(), record)
+}
+
+// Debugf logs a debug message, formatted like log.Printf.
+func (l *Logger) Debugf(format string, args ...any) {
+	l.logf(slog.LevelDebug, format, args...)
+}
+
+// Infof logs an informational message, formatted like log.Printf.
+func (l *Logger) Infof(format string, args ...any) {
+	l.logf(slog.LevelInfo, format, args...)
+}
+
+// Warnf logs a warning, formatted like log.Printf.
+func (l *Logger) Warnf(format string, args ...any) {
+	l.logf(slog.LevelWarn, format, args...)
+}
+
+// Errorf logs an error, formatted like log.Printf.
+func (l *Logger) Errorf(format string, args ...any) {
+	l.logf(slog.LevelError, format, args...)
+}
+
+// Fatalf logs an error, formatted like log.Printf, and exits the process.
+func (l *Logger) Fatalf(format string, args ...any) {
+	l.logf(slog.LevelError, format, args...)
+	os.Exit(1)
+}
+
+// Debugf logs a debug message with the default logger.
+func Debugf(format string, args ...any) {
+	std.Load().logf(slog.LevelDebug, format, args...)
+}
+
+// Infof logs an informational message with the default logger.
+func Infof(format string, args ...any) {
+	std.Load().logf(slog.LevelInfo, format, args...)
+}
+
+// Warnf logs a warning with the default logger.
+func Warnf(format string, args ...any) {
+	std.Load().logf(slog.LevelWarn, format, args...)
+}
+
+// Errorf logs an error with the default logger.
+func Errorf(format string, args ...any) {
+	std.Load().logf(slog.LevelError, format, args...)
+}
+
+// Fatalf logs an error with the default logger and exits the process.
+func Fatalf(format string, args ...any) {
+	std.Load().logf(slog.LevelError, format, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,95 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLevels(t *testing.T) {
+	require := require.New(t)
+
+	defer log.SetOutput(log.Writer())
+	defer log.SetFlags(log.Flags())
+	defer SetLevel(GetLevel())
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+
+	Debugf("hidden %d", 1)
+	Infof("shown %d", 2)
+	require.Equal("INFO shown 2\n", buf.String())
+
+	level, err := ParseLevel("DEBUG")
+	require.NoError(err)
+	SetLevel(level)
+	buf.Reset()
+	Debugf("shown %d", 3)
+	require.Equal("DEBUG shown 3\n", buf.String())
+
+	SetLevel(LevelError)
+	buf.Reset()
+	Warnf("hidden")
+	require.Empty(buf.String())
+
+	_, err = ParseLevel("verbose")
+	require.Error(err)
+}
+
+func TestLogger(t *testing.T) {
+	require := require.New(t)
+
+	// The logger logs through the supplied handler, filtering by its level
+	var buf bytes.Buffer
+	logger := New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelWarn,
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	}))
+	logger.Infof("hidden")
+	logger.Warnf("shown %d", 1)
+	require.Equal("level=WARN msg=\"shown 1\"\n", buf.String())
+}
+
+func TestDefaultAttrs(t *testing.T) {
+	require := require.New(t)
+
+	defer log.SetOutput(log.Writer())
+	defer log.SetFlags(log.Flags())
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+
+	logger := Default().Slog().With("conn", "1a2b").WithGroup("backend")
+	logger.Info("selected", "address", "127.0.0.1:5001", "pool", "web api")
+	require.Equal("INFO selected conn=1a2b backend.address=127.0.0.1:5001 backend.pool=\"web api\"\n", buf.String())
+}
+
+func TestJSONDefault(t *testing.T) {
+	require := require.New(t)
+
+	defer SetDefault(Default())
+	defer SetLevel(GetLevel())
+
+	// The JSON handler filters by the level set with SetLevel
+	var buf bytes.Buffer
+	SetDefault(New(NewJSONHandler(&buf)))
+	SetLevel(LevelWarn)
+	Infof("hidden")
+	Warnf("shown %d", 1)
+
+	var record map[string]any
+	require.NoError(json.Unmarshal(buf.Bytes(), &record))
+	require.Equal("WARN", record["level"])
+	require.Equal("shown 1", record["msg"])
+}
@@ -0,0 +1,160 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeLayout is the layout of the time suffix of rotated log files,
+// which sorts them by age.
+const backupTimeLayout = "20060102T150405.000000000"
+
+// RotationConfig is when a rotating log file is rotated and how many of
+// the rotated files are retained.
+type RotationConfig struct {
+	// MaxSize is the size in bytes past which the file is rotated.
+	// The file is never rotated if zero.
+	MaxSize int64
+
+	// MaxBackups is the number of rotated files retained, removing the
+	// oldest first. All are retained if zero.
+	MaxBackups int
+
+	// MaxAge is the time rotated files are retained for. They are
+	// retained regardless of age if zero.
+	MaxAge time.Duration
+}
+
+// RotatingFile is a log file which is renamed with the time as a suffix,
+// e.g. "lb.log.20240102T150405.000000000", and replaced by an empty file
+// once it grows past its maximum size. Rotated files past the retention
+// are removed on rotation.
+type RotatingFile struct {
+	path   string
+	config RotationConfig
+
+	// mu guards the file and its size.
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// OpenRotatingFile opens the log file at path for appending, creating it
+// if needed.
+func OpenRotatingFile(path string, config RotationConfig) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, config: config}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the file at the path for appending.
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// Write appends p to the file, rotating it first if p would grow it past
+// its maximum size. p is never split across files.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.config.MaxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.config.MaxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate renames the file with the current time as a suffix, opens a new
+// one in its place and removes the rotated files past the retention.
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := os.Rename(f.path, f.path+"."+now.UTC().Format(backupTimeLayout)); err != nil {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.prune(now)
+	return nil
+}
+
+// prune removes the rotated files past the retention, on a best effort
+// basis: a file that fails to be removed is retried on the next rotation.
+func (f *RotatingFile) prune(now time.Time) {
+	backups := f.backups()
+	for i, backup := range backups {
+		expired := f.config.MaxAge > 0 && now.Sub(backup.rotatedAt) > f.config.MaxAge
+		excess := f.config.MaxBackups > 0 && i >= f.config.MaxBackups
+		if expired || excess {
+			os.Remove(backup.path)
+		}
+	}
+}
+
+// backup is a rotated log file.
+type backup struct {
+	path      string
+	rotatedAt time.Time
+}
+
+// backups returns the rotated files of the log file, newest first.
+func (f *RotatingFile) backups() []backup {
+	dir, name := filepath.Split(f.path)
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var backups []backup
+	for _, entry := range entries {
+		suffix, ok := strings.CutPrefix(entry.Name(), name+".")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		rotatedAt, err := time.Parse(backupTimeLayout, suffix)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{
+			path:      filepath.Join(dir, entry.Name()),
+			rotatedAt: rotatedAt,
+		})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].rotatedAt.After(backups[j].rotatedAt)
+	})
+	return backups
+}
+
+// Close closes the file.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
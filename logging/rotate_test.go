@@ -0,0 +1,67 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotatingFile(t *testing.T) {
+	require := require.New(t)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "lb.log")
+	f, err := OpenRotatingFile(path, RotationConfig{MaxSize: 10, MaxBackups: 2})
+	require.NoError(err)
+	defer f.Close()
+
+	// Writes are appended until they would grow the file past its size
+	_, err = f.Write([]byte("12345\n"))
+	require.NoError(err)
+	_, err = f.Write([]byte("123\n"))
+	require.NoError(err)
+	require.Len(f.backups(), 0)
+
+	// A write past the size rotates the file, retaining the newest backups
+	for i := 0; i < 3; i++ {
+		_, err = f.Write([]byte("123456789\n"))
+		require.NoError(err)
+	}
+	backups := f.backups()
+	require.Len(backups, 2)
+	data, err := os.ReadFile(backups[1].path)
+	require.NoError(err)
+	require.Equal("123456789\n", string(data))
+	data, err = os.ReadFile(path)
+	require.NoError(err)
+	require.Equal("123456789\n", string(data))
+
+	// Files unrelated to the log are ignored
+	require.NoError(os.WriteFile(path+".old", nil, 0o600))
+	require.Len(f.backups(), 2)
+}
+
+func TestRotatingFileMaxAge(t *testing.T) {
+	require := require.New(t)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "lb.log")
+	expired := path + "." + time.Now().Add(-2*time.Hour).UTC().Format(backupTimeLayout)
+	require.NoError(os.WriteFile(expired, nil, 0o600))
+
+	f, err := OpenRotatingFile(path, RotationConfig{MaxSize: 1, MaxAge: time.Hour})
+	require.NoError(err)
+	defer f.Close()
+
+	// Rotation removes the backups past the retention
+	_, err = f.Write([]byte("a"))
+	require.NoError(err)
+	_, err = f.Write([]byte("b"))
+	require.NoError(err)
+	backups := f.backups()
+	require.Len(backups, 1)
+	require.NotEqual(expired, backups[0].path)
+}
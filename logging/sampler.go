@@ -0,0 +1,147 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// maxSampledKeys bounds the keys a sampler tracks at once. Messages of
+// further keys are logged without sampling.
+const maxSampledKeys = 1024
+
+// SamplingConfig defines how many messages sharing a key are logged.
+type SamplingConfig struct {
+	// Interval is the window in which messages of a key are counted.
+	Interval time.Duration
+
+	// Burst is the number of messages of a key logged in every interval.
+	// Further messages are suppressed and summarized once it ends.
+	Burst int
+}
+
+// Sampler rate limits repeated messages logged through a logger, e.g. the
+// same error of every connection of a misbehaving client, so that they do
+// not flood the logs. Messages share a key chosen by the caller, e.g. the
+// error text without the connection details. The first messages of a key
+// in every interval are logged, and the number of the others is logged
+// along with the last of them once the interval ends.
+type Sampler struct {
+	logger *Logger
+	config SamplingConfig
+
+	// mu guards windows.
+	mu sync.Mutex
+
+	// windows maps a key to its current window.
+	windows map[string]*sampleWindow
+}
+
+// sampleWindow counts the messages of a key in an interval.
+type sampleWindow struct {
+	start      time.Time
+	logged     int
+	suppressed int
+
+	// level and last are the level and text of the last suppressed message.
+	level slog.Level
+	last  string
+}
+
+// NewSampler returns a sampler logging through the logger. Summaries are
+// logged by Run, or else when the next message of their key is logged.
+func NewSampler(logger *Logger, config SamplingConfig) *Sampler {
+	return &Sampler{
+		logger:  logger,
+		config:  config,
+		windows: make(map[string]*sampleWindow),
+	}
+}
+
+// Run logs the summaries of the ended intervals until ctx is done.
+func (s *Sampler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.flush(now)
+		}
+	}
+}
+
+// Warnf logs a warning sharing the key with other messages, formatted
+// like log.Printf, unless too many were logged in the interval.
+func (s *Sampler) Warnf(key, format string, args ...any) {
+	s.logf(time.Now(), slog.LevelWarn, key, format, args...)
+}
+
+// Errorf logs an error sharing the key with other messages, formatted
+// like log.Printf, unless too many were logged in the interval.
+func (s *Sampler) Errorf(key, format string, args ...any) {
+	s.logf(time.Now(), slog.LevelError, key, format, args...)
+}
+
+// logf logs or suppresses a message of the key at the given time.
+func (s *Sampler) logf(now time.Time, level slog.Level, key, format string, args ...any) {
+	if !s.logger.enabled(level) {
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+
+	s.mu.Lock()
+	window, ok := s.windows[key]
+	if ok && now.Sub(window.start) >= s.config.Interval {
+		s.summarize(window)
+		ok = false
+	}
+	if !ok {
+		if len(s.windows) >= maxSampledKeys {
+			s.mu.Unlock()
+			// Skip runtime.Callers, log, logf and the exported method
+			s.logger.log(5, level, msg)
+			return
+		}
+		window = &sampleWindow{start: now}
+		s.windows[key] = window
+	}
+	if window.logged >= s.config.Burst {
+		window.suppressed++
+		window.level, window.last = level, msg
+		s.mu.Unlock()
+		return
+	}
+	window.logged++
+	s.mu.Unlock()
+
+	// Skip runtime.Callers, log, logf and the exported method
+	s.logger.log(5, level, msg)
+}
+
+// flush summarizes and forgets the windows ended at the given time.
+func (s *Sampler) flush(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, window := range s.windows {
+		if now.Sub(window.start) >= s.config.Interval {
+			s.summarize(window)
+			delete(s.windows, key)
+		}
+	}
+}
+
+// summarize logs the number of messages suppressed in the window, if any.
+// The caller must hold s.mu.
+func (s *Sampler) summarize(window *sampleWindow) {
+	if window.suppressed == 0 {
+		return
+	}
+	s.logger.log(0, window.level, fmt.Sprintf("%d similar messages suppressed in the last %s, last: %s",
+		window.suppressed, s.config.Interval, window.last))
+}
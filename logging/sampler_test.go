@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSampler(t *testing.T) {
+	require := require.New(t)
+
+	var buf bytes.Buffer
+	logger := New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.TimeKey || attr.Key == slog.LevelKey {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	}))
+	sampler := NewSampler(logger, SamplingConfig{Interval: time.Minute, Burst: 2})
+	start := time.Unix(1700000000, 0)
+	lines := func() []string {
+		defer buf.Reset()
+		return strings.Split(strings.TrimSpace(buf.String()), "\n")
+	}
+
+	// The first messages of a key in the interval are logged
+	for i := 0; i < 5; i++ {
+		sampler.logf(start.Add(time.Duration(i)*time.Second), slog.LevelWarn, "tls", "conn %d: TLS authentication failed", i)
+	}
+	sampler.logf(start, slog.LevelWarn, "other", "other error")
+	require.Equal([]string{
+		`msg="conn 0: TLS authentication failed"`,
+		`msg="conn 1: TLS authentication failed"`,
+		`msg="other error"`,
+	}, lines())
+
+	// The suppressed ones are summarized once the interval ends
+	sampler.flush(start.Add(30 * time.Second))
+	require.Empty(buf.String())
+	sampler.flush(start.Add(time.Minute))
+	require.Equal([]string{
+		`msg="3 similar messages suppressed in the last 1m0s, last: conn 4: TLS authentication failed"`,
+	}, lines())
+	require.Empty(sampler.windows)
+
+	// A message of a key whose interval ended starts a new one
+	for i := 0; i < 3; i++ {
+		sampler.logf(start.Add(2*time.Minute), slog.LevelError, "tls", "conn %d", i)
+	}
+	sampler.logf(start.Add(3*time.Minute), slog.LevelError, "tls", "conn 3")
+	require.Equal([]string{
+		`msg="conn 0"`,
+		`msg="conn 1"`,
+		`msg="1 similar messages suppressed in the last 1m0s, last: conn 2"`,
+		`msg="conn 3"`,
+	}, lines())
+}
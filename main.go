@@ -1,20 +1,65 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/rrasulzade/tcp-lb-go/accesslog"
+	"github.com/rrasulzade/tcp-lb-go/admin"
+	"github.com/rrasulzade/tcp-lb-go/agent"
+	"github.com/rrasulzade/tcp-lb-go/audit"
 	"github.com/rrasulzade/tcp-lb-go/config"
+	"github.com/rrasulzade/tcp-lb-go/cpulimit"
+	"github.com/rrasulzade/tcp-lb-go/devca"
+	"github.com/rrasulzade/tcp-lb-go/discovery"
+	"github.com/rrasulzade/tcp-lb-go/featureflag"
+	"github.com/rrasulzade/tcp-lb-go/fips"
+	"github.com/rrasulzade/tcp-lb-go/health"
+	"github.com/rrasulzade/tcp-lb-go/healthport"
+	"github.com/rrasulzade/tcp-lb-go/httpauth"
 	"github.com/rrasulzade/tcp-lb-go/lib"
+	"github.com/rrasulzade/tcp-lb-go/listen"
+	"github.com/rrasulzade/tcp-lb-go/logging"
+	"github.com/rrasulzade/tcp-lb-go/metrics"
+	"github.com/rrasulzade/tcp-lb-go/proxyproto"
 	"github.com/rrasulzade/tcp-lb-go/server"
 )
 
-// TODO: add custom logger that supports log levels for debugging
 func main() {
+	// Manage the running load balancer through the admin API, or compare
+	// balancing strategies on a connection trace offline
+	if len(os.Args) > 1 {
+		var run func([]string) error
+		switch os.Args[1] {
+		case "acl":
+			run = runACL
+		case "status":
+			run = runStatus
+		case "backends":
+			run = runBackends
+		case "drain":
+			run = runDrain
+		case "simulate":
+			run = runSimulate
+		}
+		if run != nil {
+			if err := run(os.Args[2:]); err != nil {
+				logging.Fatalf("%v", err)
+			}
+			return
+		}
+	}
+
 	// Define a custom flag usage function
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage:\n")
@@ -23,8 +68,23 @@ func main() {
 	// Read config file flag
 	var configFileFlag string
 	flag.StringVar(&configFileFlag, "config", "", "Path to a configuration file")
+
+	// Read replay mode flags
+	var replayOpts replayOptions
+	flag.StringVar(&replayOpts.file, "replay", "", "Path to a connection capture to replay instead of running the server")
+	flag.StringVar(&replayOpts.target, "target", "", "Backend address to replay the capture against")
+	flag.StringVar(&replayOpts.pool, "pool", "", "Configured pool to replay the capture against")
+	flag.Float64Var(&replayOpts.speed, "speed", 1, "Replay speed factor of the captured timing")
+	flag.DurationVar(&replayOpts.idleTimeout, "idle-timeout", 5*time.Second, "Time to wait for backend data after the replay")
 	flag.Parse()
 
+	if replayOpts.file != "" {
+		if err := replay(configFileFlag, replayOpts); err != nil {
+			logging.Fatalf("%v", err)
+		}
+		return
+	}
+
 	// Check if the config flag was provided
 	if configFileFlag == "" {
 		fmt.Println("Error: Configuration file not provided")
@@ -33,80 +93,817 @@ func main() {
 	}
 
 	// Load gloabal AppConfig settings
+	configLoadedAt := time.Now()
 	appConfig, err := config.LoadAppConfig(configFileFlag)
 	if err != nil {
-		log.Fatal(err)
+		logging.Fatalf("%v", err)
+	}
+	logLevel, _ := logging.ParseLevel(appConfig.LogLevel)
+	logging.SetLevel(logLevel)
+	logFile, err := configureLogging(appConfig.Logging)
+	if err != nil {
+		logging.Fatalf("%v", err)
+	}
+	if logFile != nil {
+		defer logFile.Close()
+	}
+
+	// Refuse to run without approved cryptography if FIPS mode is required.
+	// BoringCrypto builds always restrict TLS to approved parameters
+	fipsMode := appConfig.FIPS || fips.Enabled()
+	if fipsMode {
+		if err := fips.Check(); err != nil {
+			logging.Fatalf("%v", err)
+		}
+		logging.Infof("FIPS mode enabled, TLS is restricted to FIPS 140 approved parameters")
+	}
+
+	// Size the process to the CPUs of its container rather than the host's
+	procs, procsSource := cpulimit.Tune(appConfig.Runtime.GOMAXPROCS)
+	logging.Infof("GOMAXPROCS is %d, set from the %s", procs, procsSource)
+
+	// Record backend latencies to compare backends and spot slow replicas
+	registry := metrics.NewRegistry()
+	backendLatencies := newBackendLatencies(registry)
+
+	// Gate experimental behaviors, which can be rolled out at runtime
+	featureFlags, err := featureflag.NewSet(appConfig.FeatureFlags()...)
+	if err != nil {
+		logging.Fatalf("%v", err)
 	}
 
 	// Initialize the load balancer
+	lbOptions := []lib.Option{
+		lib.WithFeatureFlags(featureFlags),
+		lib.WithMetrics(metrics.FromRegistry(registry)),
+		lib.WithLatencyObserver(backendLatencies.observe),
+		lib.WithAdmissionQueue(appConfig.Queue.Size, appConfig.Queue.Timeout.Duration),
+		lib.WithDialTimeout(appConfig.Timeouts.BackendDial.Duration),
+		lib.WithIdleTimeouts(appConfig.Timeouts.ClientIdle.Duration, appConfig.Timeouts.BackendIdle.Duration),
+		lib.WithMaxLifetime(appConfig.Timeouts.MaxLifetime.Duration),
+		lib.WithResolution(
+			lib.ResolutionStrategy(appConfig.BackendResolution.Strategy),
+			appConfig.BackendResolution.TTL.Duration),
+		lib.WithDNSResolver(appConfig.BackendResolution.DNSResolver()),
+		lib.WithBalancing(lib.BalancingStrategy(appConfig.Balancing.Strategy)),
+	}
+	for pool, queue := range appConfig.Queue.Pools {
+		lbOptions = append(lbOptions, lib.WithPoolAdmissionQueue(pool, queue.Size, queue.Timeout.Duration))
+	}
+	if appConfig.Balancing.FirstByteLatency {
+		lbOptions = append(lbOptions, lib.WithFirstByteLatency())
+	}
+	if appConfig.Balancing.SpreadFailureDomains {
+		lbOptions = append(lbOptions, lib.WithFailureDomainSpreading())
+	}
+	if od := appConfig.OutlierDetection; od != nil {
+		lbOptions = append(lbOptions, lib.WithOutlierDetection(lib.OutlierDetection{
+			Interval:           od.Interval.Duration,
+			BaseEjectionTime:   od.BaseEjectionTime.Duration,
+			MaxEjectionPercent: od.MaxEjectionPercent,
+			LatencyFactor:      od.LatencyFactor,
+			ErrorRateThreshold: od.ErrorRateThreshold,
+			MinRequests:        od.MinRequests,
+		}))
+	}
+	if phc := appConfig.PassiveHealthCheck; phc != nil {
+		lbOptions = append(lbOptions, lib.WithPassiveHealthCheck(lib.PassiveHealthCheck{
+			ConsecutiveFailures: phc.ConsecutiveFailures,
+			Cooldown:            phc.Cooldown.Duration,
+		}))
+	}
+	for pool, backendTLSConfig := range appConfig.PoolBackendTLS {
+		tlsConfig, err := config.MakeBackendTLSConfig(backendTLSConfig)
+		if err == nil {
+			err = enforceFIPS(tlsConfig, fipsMode)
+		}
+		if err != nil {
+			logging.Fatalf("Unable to configure backend TLS of pool %s: %v", pool, err)
+		}
+		lbOptions = append(lbOptions, lib.WithBackendTLS(pool, lib.BackendTLS{
+			Config:           tlsConfig,
+			SessionCacheSize: backendTLSConfig.SessionCacheSize,
+		}))
+	}
+	for pool, keepaliveConfig := range appConfig.PoolKeepalives {
+		// Keepalives were validated with the configuration
+		keepalive, _ := keepaliveConfig.Keepalive()
+		lbOptions = append(lbOptions, lib.WithKeepalive(pool, keepalive))
+	}
+	if appConfig.ProxyProtocol.Enabled {
+		lbOptions = append(lbOptions, lib.WithProxyProtocol(appConfig.ProxyProtocol.ConnectionID))
+	}
+	if len(appConfig.MetadataPools) > 0 {
+		lbOptions = append(lbOptions, lib.WithMetadataFraming(appConfig.MetadataPools...))
+	}
+	var instanceID []byte
+	if appConfig.ProxyProtocol.LoopDetection {
+		instanceID = proxyproto.NewInstanceID()
+		lbOptions = append(lbOptions, lib.WithLoopDetection(instanceID))
+	}
+
+	// Reject backends referring to the listener, e.g. when discovered
+	selfAddress, err := lib.NewSelfAddressMatcher(appConfig.ListenAddress())
+	if err != nil {
+		logging.Fatalf("%v", err)
+	}
+	lbOptions = append(lbOptions, lib.WithSelfAddress(selfAddress))
 	lb := lib.NewLoadBalancer(
 		appConfig.RateLimiter.Capacity,
-		appConfig.RateLimiter.RefillRate)
+		appConfig.RateLimiter.RefillRate,
+		lbOptions...)
 
-	// Add backend servers to the load balancer
-	log.Println("Backend Servers:")
-	for i, address := range appConfig.Backends {
-		server := &lib.Backend{
-			Address: address,
+	// Add backend servers of every pool to the load balancer
+	logging.Infof("Backend Servers:")
+	pools := appConfig.PoolBackends()
+	groups := appConfig.BackendGroups()
+	weights := appConfig.PoolBackendWeights()
+	failureDomains := appConfig.PoolBackendFailureDomains()
+	for pool, backends := range pools {
+		for i, address := range backends {
+			server := &lib.Backend{
+				Address:        address,
+				Pool:           pool,
+				Group:          groups[address],
+				FailureDomain:  failureDomains[pool][address],
+				MaxConnections: appConfig.MaxBackendConnections,
+				InitialWeight:  weights[pool][address],
+			}
+			lb.AddBackend(server)
+			// Print the backend server addr
+			logging.Infof("%s %d: %s", pool, i+1, address)
 		}
-		lb.AddBackend(server)
-		// Print the backend server addr
-		log.Printf("%d: %s\n", i+1, address)
 	}
 
-	// Configure TLS options
-	tlsConfig, err := config.MakeServerTLSConfig(
-		appConfig.TLS.CertFile,
-		appConfig.TLS.KeyFile,
-		appConfig.TLS.CAFile)
-	if err != nil {
-		log.Fatal(err)
+	// Activate the initial deployment group of grouped pools
+	for pool, poolGroups := range appConfig.PoolGroups {
+		lb.SetActiveGroup(pool, poolGroups.Active)
+	}
+
+	// Put pools in maintenance until it is ended through the admin API
+	for pool, maintenance := range appConfig.PoolMaintenance {
+		// Messages are validated while loading the config
+		message, _ := maintenance.Message.Bytes()
+		lb.StartMaintenance(pool, message)
+		logging.Warnf("Pool %s is in maintenance", pool)
+	}
+
+	// Probe backends as they are added to report their readiness
+	onBackendsAdded := func([]*lib.Backend) {}
+	if appConfig.Prewarm.Enabled {
+		prewarmer := newPrewarmer(lb, appConfig.Prewarm.Timeout.Duration, registry)
+		prewarmer.prewarm(lb.Backends())
+		onBackendsAdded = func(added []*lib.Backend) {
+			go prewarmer.prewarm(added)
+		}
+	}
+
+	// Keep discovered pools up to date until shutdown
+	discoveryCtx, stopDiscovery := context.WithCancel(context.Background())
+	defer stopDiscovery()
+	if appConfig.Discovery != nil {
+		if err := startDiscovery(discoveryCtx, appConfig, lb, onBackendsAdded); err != nil {
+			logging.Fatalf("%v", err)
+		}
+	}
+
+	// Adjust backend weights from health checks if configured
+	if appConfig.AdaptiveWeights != nil {
+		adaptCtx, stopAdapting := context.WithCancel(context.Background())
+		defer stopAdapting()
+		go lb.AdaptWeights(adaptCtx, appConfig.AdaptiveWeights.AdaptiveWeights())
+	}
+
+	// Correct drifting backend connection counts if configured
+	if interval := appConfig.ConnectionReconcileInterval.Duration; interval > 0 {
+		reconcileCtx, stopReconciling := context.WithCancel(context.Background())
+		defer stopReconciling()
+		go lb.ReconcileConnections(reconcileCtx, interval)
+	}
+
+	// Load the trusted client CAs, which can be rotated at runtime.
+	// Sidecars identify their local clients without TLS
+	var clientCAs *lib.ClientCAPool
+	var devCA *devca.CA
+	var devCAMaxTTL time.Duration
+	var tlsConfig *tls.Config
+	if !appConfig.Sidecar {
+		clientCAs, err = config.LoadClientCAs(appConfig.TLS.CAFile)
+		if err != nil {
+			logging.Fatalf("%v", err)
+		}
+		if interval := appConfig.TLS.CAReloadInterval.Duration; interval > 0 {
+			caWatchCtx, stopCAWatch := context.WithCancel(context.Background())
+			defer stopCAWatch()
+			go clientCAs.WatchFile(caWatchCtx, config.ClientCAFileBundle, appConfig.TLS.CAFile, interval)
+		}
+
+		// Trust the development CA issuing client certificates on the admin API
+		if appConfig.Admin != nil && appConfig.Admin.DevCA != nil {
+			devCA, err = appConfig.Admin.DevCA.CA()
+			if err != nil {
+				logging.Fatalf("%v", err)
+			}
+			if err := clientCAs.Set(config.DevCABundle, devCA.CertificatePEM()); err != nil {
+				logging.Fatalf("%v", err)
+			}
+			devCAMaxTTL = appConfig.Admin.DevCA.MaxTTL.Duration
+			logging.Warnf("Development CA is enabled: anyone with access to the admin API can connect, do not use it in production")
+		}
+
+		// Configure TLS options, enforcing the client certificate policy during the handshake
+		var verifyPeer lib.PeerVerifier
+		if policy := appConfig.TLS.ClientCertPolicy; policy != nil {
+			verifyPeer = policy.Policy().Verifier()
+		}
+		tlsConfig, err = config.MakeServerTLSConfig(
+			appConfig.TLS.CertFile,
+			appConfig.TLS.KeyFile,
+			appConfig.TLS.Certificates,
+			clientCAs,
+			appConfig.ClientAuth(),
+			verifyPeer,
+			fipsMode)
+		if err != nil {
+			logging.Fatalf("%v", err)
+		}
+		if fipsMode {
+			if err := fips.Verify(tlsConfig); err != nil {
+				logging.Fatalf("Server TLS configuration is not FIPS compliant: %v", err)
+			}
+		}
+	}
+
+	// Decode rejection responses sent to clients on failures
+	rejectionResponses := make(map[server.RejectReason][]byte, len(appConfig.RejectionResponses))
+	for reason, response := range appConfig.RejectionResponses {
+		// Responses are validated while loading the config
+		b, _ := response.Bytes()
+		rejectionResponses[server.RejectReason(reason)] = b
+	}
+
+	// Build the key connections are rate limited by
+	rateLimitKey := rateLimitKeyParts(appConfig.RateLimiter.Key)
+
+	// Compute TLS fingerprints of clients if configured
+	var allowedFingerprints, deniedFingerprints map[string]struct{}
+	if fp := appConfig.Fingerprinting; fp != nil {
+		allowedFingerprints = makeSet(fp.Allow)
+		deniedFingerprints = makeSet(fp.Deny)
+	}
+
+	// Serve metrics over HTTP if configured
+	var metricsServer *http.Server
+	if appConfig.Metrics != nil {
+		metricsTLSConfig, err := makeListenerTLSConfig(appConfig.Metrics.TLS, appConfig.Metrics.Tokens, fipsMode)
+		if err != nil {
+			logging.Fatalf("%v", err)
+		}
+		clientCerts := metricsTLSConfig != nil && metricsTLSConfig.ClientCAs != nil
+
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", registry)
+		metricsServer = &http.Server{
+			Addr:      appConfig.Metrics.Address,
+			Handler:   httpauth.New(appConfig.Metrics.Tokens, clientCerts).Wrap(mux),
+			TLSConfig: metricsTLSConfig,
+		}
+		metricsListener, err := listen.Listen(appConfig.Metrics.Address, appConfig.ListenRetry.Retry())
+		if err != nil {
+			logging.Fatalf("Unable to initialize metrics listener: %v", err)
+		}
+		go func() {
+			logging.Infof("Metrics are served on %s", appConfig.Metrics.Address)
+			var err error
+			if metricsTLSConfig != nil {
+				// The certificate is already loaded into the TLS config
+				err = metricsServer.ServeTLS(metricsListener, "", "")
+			} else {
+				err = metricsServer.Serve(metricsListener)
+			}
+			if err != nil && err != http.ErrServerClosed {
+				logging.Fatalf("Metrics server error: %v", err)
+			}
+		}()
+	}
+
+	// Open the access log
+	var accessLog *accesslog.Log
+	if appConfig.AccessLog != "" {
+		accessLog, err = accesslog.Open(appConfig.AccessLog)
+		if err != nil {
+			logging.Fatalf("%v", err)
+		}
+		defer accessLog.Close()
 	}
 
 	// Initialize the server
-	listenAddr := fmt.Sprintf(":%d", appConfig.Port)
+	listenAddr := appConfig.ListenAddress()
 	serverConfig := &server.ServerConfig{
-		Address:          listenAddr,
-		LoadBalancer:     lb,
-		TLSConfig:        tlsConfig,
-		AllowedClients:   appConfig.AllowedClients,
-		ClientBackendACL: mapSliceToMapSet(appConfig.ClientBackendACL),
+		Address:                 listenAddr,
+		LoadBalancer:            lb,
+		TLSConfig:               tlsConfig,
+		AllowedClients:          appConfig.AllowedClients,
+		ClientBackendEntries:    appConfig.ClientBackendACL,
+		AnonymousBackends:       anonymousBackends(appConfig),
+		UnknownClientBackends:   unknownClientBackends(appConfig),
+		AuthorizationCacheTTL:   appConfig.AuthorizationCacheTTL.Duration,
+		CertRolloverWindow:      appConfig.CertRolloverWindow.Duration,
+		RateLimitKey:            rateLimitKey,
+		HashBySourceIP:          appConfig.Balancing.HashKey == config.HashBySourceIP,
+		MaxConnections:          appConfig.MaxConnections,
+		PreemptIdleAfter:        appConfig.PreemptIdleAfter.Duration,
+		MaxConcurrentHandshakes: appConfig.Runtime.HandshakeConcurrency(procs),
+		ClientPriorities:        appConfig.ClientPriorities,
+		AcceptProxyProtocol:     appConfig.ProxyProtocol.Accept,
+		Sidecar:                 appConfig.Sidecar,
+		InstanceID:              instanceID,
+		Overload:                appConfig.OverloadShedding.Config(),
+		ClientTags:              appConfig.ClientTags,
+		Metrics:                 metrics.FromRegistry(registry),
+		RejectionResponses:      rejectionResponses,
+		CaptureDir:              appConfig.CaptureDir,
+		AccessLog:               accessLog,
+		ListenRetry:             appConfig.ListenRetry.Retry(),
+		SocketOptions:           appConfig.SocketOptions.Options(),
+		LogSampling:             appConfig.Logging.Sampling.Config(),
+		Timeouts: server.Timeouts{
+			AcceptRetry:  appConfig.Timeouts.AcceptRetry.Duration,
+			TLSHandshake: appConfig.Timeouts.TLSHandshake.Duration,
+			Shutdown:     appConfig.Timeouts.Shutdown.Duration,
+		},
+
+		Fingerprinting:      appConfig.Fingerprinting != nil,
+		AllowedFingerprints: allowedFingerprints,
+		DeniedFingerprints:  deniedFingerprints,
+		MigrationPools:      makeSet(appConfig.MigrationPools),
+	}
+	if acceptRateLimit := appConfig.AcceptRateLimit; acceptRateLimit != nil {
+		serverConfig.AcceptRate = acceptRateLimit.Rate
+		serverConfig.AcceptBurst = acceptRateLimit.Burst
+	}
+	if storms := appConfig.ReconnectStorms; storms != nil {
+		serverConfig.ReconnectStorms = &server.ReconnectStormConfig{
+			Multiplier: storms.Multiplier,
+			MinRate:    storms.MinRate,
+			Limit:      storms.Limit,
+		}
+	}
+	for _, listener := range appConfig.Listeners {
+		serverConfig.Listeners = append(serverConfig.Listeners, server.Listener{
+			Network:         listener.Network,
+			Address:         listener.Address,
+			Pools:           listener.Pools,
+			PeerCredentials: listener.PeerCredentials,
+			SocketOptions:   listener.SocketOptions.Options(),
+			RateLimitKey:    rateLimitKeyParts(listener.RateLimitKey),
+		})
 	}
 	lbServer, err := server.NewServer(serverConfig)
 	if err != nil {
-		log.Fatal(err)
+		logging.Fatalf("%v", err)
 	}
 
 	// Start the server
 	err = lbServer.Start()
 	if err != nil {
-		log.Fatal(err)
+		logging.Fatalf("%v", err)
 	}
 
-	// Wait for a SIGINT or SIGTERM signal to gracefully shut down the server
+	// Run periodic self health checks
+	healthChecker := health.NewChecker(appConfig.Health.Interval.Duration)
+	lbServer.RegisterHealthChecks(healthChecker, appConfig.Health.MaxGoroutines)
+	healthChecker.Register("config", func() (health.Status, string) {
+		return checkConfigStaleness(configFileFlag, configLoadedAt)
+	})
+	healthChecker.Start()
+	defer healthChecker.Stop()
+
+	// Signals, and shutdown requests of the admin API, stop the server
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
 
-	log.Println("Shutting down the server...")
+	// Start the admin API if configured
+	var adminServer *admin.Server
+	if appConfig.Admin != nil {
+		adminTLSConfig, err := makeListenerTLSConfig(appConfig.Admin.TLS, appConfig.Admin.Tokens, fipsMode)
+		if err != nil {
+			logging.Fatalf("%v", err)
+		}
+		adminPeers, err := makeAdminPeers(appConfig.Admin.Peers, fipsMode)
+		if err != nil {
+			logging.Fatalf("%v", err)
+		}
+		var auditLog *audit.Log
+		if appConfig.Admin.AuditLog != "" {
+			auditLog, err = audit.Open(appConfig.Admin.AuditLog)
+			if err != nil {
+				logging.Fatalf("%v", err)
+			}
+			defer auditLog.Close()
+		}
+		// Validate ACL changes against the backends registered at runtime
+		validateACL := func(acl map[string][]string) error {
+			return appConfig.CanonicalizeRuntimeACL(acl, lb.Backends())
+		}
+		adminServer, err = admin.NewServer(&admin.AdminConfig{
+			Address:                      appConfig.Admin.Address,
+			LoadBalancer:                 lb,
+			DefaultGracePeriod:           appConfig.Admin.GracePeriod.Duration,
+			HealthChecker:                healthChecker,
+			ProxyServer:                  lbServer,
+			ValidateACL:                  validateACL,
+			DefaultMaxBackendConnections: appConfig.MaxBackendConnections,
+			DefaultReadinessDelay:        appConfig.Drain.ReadinessDelay.Duration,
+			DefaultDrainTimeout:          appConfig.Drain.Timeout.Duration,
+			ClientCAs:                    clientCAs,
+			DevCA:                        devCA,
+			DevCAMaxTTL:                  devCAMaxTTL,
+			FeatureFlags:                 featureFlags,
+			BackendLatencies:             backendLatencies.families,
+			TLSConfig:                    adminTLSConfig,
+			ListenRetry:                  appConfig.ListenRetry.Retry(),
+			Tokens:                       appConfig.Admin.Tokens,
+			Peers:                        adminPeers,
+			AuditLog:                     auditLog,
+			Shutdown: func() {
+				select {
+				case sigChan <- syscall.SIGTERM:
+				default:
+				}
+			},
+		})
+		if err != nil {
+			logging.Fatalf("%v", err)
+		}
+		if err := adminServer.Start(); err != nil {
+			logging.Fatalf("%v", err)
+		}
+	}
+
+	// Answer agent-check queries of external load balancers if configured
+	var agentServer *agent.Server
+	if appConfig.Agent != nil {
+		agentServer, err = agent.NewServer(&agent.AgentConfig{
+			Address: appConfig.Agent.Address,
+			Status: func() agent.Status {
+				return lbServer.AgentStatus(healthChecker.Report())
+			},
+			ListenRetry: appConfig.ListenRetry.Retry(),
+		})
+		if err != nil {
+			logging.Fatalf("%v", err)
+		}
+		if err := agentServer.Start(); err != nil {
+			logging.Fatalf("%v", err)
+		}
+	}
+
+	// Answer plaintext health checks of network load balancers if configured,
+	// once the data plane is up
+	var healthPortServer *healthport.Server
+	if appConfig.HealthPort != nil {
+		healthPortServer, err = healthport.NewServer(&healthport.HealthPortConfig{
+			Address:     appConfig.HealthPort.Address,
+			Banner:      []byte(appConfig.HealthPort.Banner),
+			ListenRetry: appConfig.ListenRetry.Retry(),
+		})
+		if err != nil {
+			logging.Fatalf("%v", err)
+		}
+		if err := healthPortServer.Start(); err != nil {
+			logging.Fatalf("%v", err)
+		}
+	}
+
+	// Wait for a SIGINT or SIGTERM signal to gracefully shut down the server.
+	// SIGUSR1 drains the server ahead of the shutdown, and SIGUSR2 toggles
+	// debug logging.
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1, syscall.SIGUSR2)
+	for sig := range sigChan {
+		if sig == syscall.SIGUSR1 {
+			go drain(lbServer, appConfig.Drain)
+			continue
+		}
+		if sig == syscall.SIGUSR2 {
+			toggleDebugLogging(logLevel)
+			continue
+		}
+		break
+	}
+
+	logging.Infof("Shutting down the server...")
+
+	// Fail network health checks first so that no new traffic is sent
+	if healthPortServer != nil {
+		healthPortServer.Stop()
+	}
 
 	// Stop the server
-	err = lbServer.Stop()
+	report, err := lbServer.StopWithReport()
+	logging.Infof("Shutdown report: %s", report)
+	if err != nil {
+		logging.Fatalf("%v", err)
+	}
+	if adminServer != nil {
+		adminServer.Stop()
+	}
+	if agentServer != nil {
+		agentServer.Stop()
+	}
+	if metricsServer != nil {
+		metricsServer.Close()
+	}
+	logging.Infof("Server stopped.")
+}
+
+// prewarmer probes backends and reports their readiness
+// in the logs and metrics.
+type prewarmer struct {
+	lb      *lib.LoadBalancer
+	timeout time.Duration
+
+	// ready is whether a backend accepted its last probe connection.
+	ready *metrics.Family
+
+	// latency is the connect time of a backend's last probe connection.
+	latency *metrics.Family
+}
+
+// newPrewarmer registers the prewarm metrics and returns a prewarmer.
+func newPrewarmer(lb *lib.LoadBalancer, timeout time.Duration, registry *metrics.Registry) *prewarmer {
+	return &prewarmer{
+		lb:      lb,
+		timeout: timeout,
+		ready: registry.Gauge("tcplb_backend_ready",
+			"Whether the backend accepted its last prewarm probe connection.", "backend"),
+		latency: registry.Gauge("tcplb_backend_prewarm_latency_milliseconds",
+			"Connect time of the backend's last prewarm probe connection.", "backend"),
+	}
+}
+
+// prewarm probes the backends and reports their readiness.
+func (p *prewarmer) prewarm(backends []*lib.Backend) {
+	for _, result := range p.lb.Prewarm(backends, p.timeout) {
+		address := result.Backend.Address
+		p.latency.With(address).Set(result.Latency.Milliseconds())
+		if result.Err != nil {
+			p.ready.With(address).Set(0)
+			logging.Warnf("Backend %s of pool %s is not ready: %v", address, result.Backend.Pool, result.Err)
+			continue
+		}
+		p.ready.With(address).Set(1)
+		logging.Infof("Backend %s of pool %s is ready (connected in %s)", address, result.Backend.Pool, result.Latency)
+	}
+}
+
+// latencyBuckets are the upper bounds, in milliseconds, of the backend latency histograms.
+var latencyBuckets = []float64{1, 2.5, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// backendLatencies records the latencies of backend connections per phase
+// in histograms labeled by pool and backend.
+type backendLatencies struct {
+	// families maps a latency phase to its histogram family.
+	families map[lib.LatencyPhase]*metrics.HistogramFamily
+}
+
+// newBackendLatencies registers the backend latency histograms in the registry.
+func newBackendLatencies(registry *metrics.Registry) *backendLatencies {
+	return &backendLatencies{
+		families: map[lib.LatencyPhase]*metrics.HistogramFamily{
+			lib.LatencyDial: registry.Histogram("tcplb_backend_dial_latency_milliseconds",
+				"Time to establish backend connections.", latencyBuckets, "pool", "backend"),
+			lib.LatencyFirstByte: registry.Histogram("tcplb_backend_first_byte_latency_milliseconds",
+				"Time from an established backend connection to its first byte.", latencyBuckets, "pool", "backend"),
+		},
+	}
+}
+
+// observe implements lib.LatencyObserver.
+func (l *backendLatencies) observe(backend *lib.Backend, phase lib.LatencyPhase, latency time.Duration) {
+	if family, ok := l.families[phase]; ok {
+		family.With(backend.Pool, backend.Address).Observe(float64(latency) / float64(time.Millisecond))
+	}
+}
+
+// makeListenerTLSConfig creates the TLS configuration of a control-plane
+// listener, or returns nil if it is served over plain HTTP.
+func makeListenerTLSConfig(listenerConfig *config.ListenerTLSConfig, tokens []string, fipsMode bool) (*tls.Config, error) {
+	if listenerConfig == nil {
+		return nil, nil
+	}
+	tlsConfig, err := config.MakeListenerTLSConfig(listenerConfig, len(tokens) > 0)
+	if err != nil {
+		return nil, err
+	}
+	return tlsConfig, enforceFIPS(tlsConfig, fipsMode)
+}
+
+// makeAdminPeers creates the client of the peer admin APIs,
+// or returns nil if no peers are configured.
+func makeAdminPeers(peersConfig *config.PeersConfig, fipsMode bool) (*admin.Peers, error) {
+	if peersConfig == nil {
+		return nil, nil
+	}
+	tlsConfig, err := config.MakePeerTLSConfig(peersConfig)
+	if err != nil {
+		return nil, err
+	}
+	if err := enforceFIPS(tlsConfig, fipsMode); err != nil {
+		return nil, fmt.Errorf("admin peers: %w", err)
+	}
+	return &admin.Peers{
+		URLs:  peersConfig.URLs,
+		Token: peersConfig.Token,
+		Client: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+			Timeout:   peersConfig.Timeout.Duration,
+		},
+	}, nil
+}
+
+// enforceFIPS restricts the TLS configuration to FIPS 140 approved
+// parameters in FIPS mode, and verifies its certificates.
+func enforceFIPS(tlsConfig *tls.Config, fipsMode bool) error {
+	if !fipsMode {
+		return nil
+	}
+	fips.Apply(tlsConfig)
+	if err := fips.Verify(tlsConfig); err != nil {
+		return fmt.Errorf("TLS configuration is not FIPS compliant: %w", err)
+	}
+	return nil
+}
+
+// configureLogging sets the format and destination of the logs, returning
+// the log file to close on exit, if any.
+func configureLogging(loggingConfig config.LoggingConfig) (io.Closer, error) {
+	var out io.Writer = os.Stderr
+	var logFile *logging.RotatingFile
+	if loggingConfig.File != "" {
+		var err error
+		logFile, err = logging.OpenRotatingFile(loggingConfig.File, loggingConfig.Rotation())
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		out = logFile
+	}
+	if loggingConfig.Format == "json" {
+		// Route the standard logger, used by e.g. net/http, into the JSON
+		// logs too rather than interleaving plain text lines
+		logging.SetDefault(logging.New(logging.NewJSONHandler(out)))
+		slog.SetDefault(logging.Default().Slog())
+	} else {
+		log.SetOutput(out)
+	}
+	if logFile == nil {
+		return nil, nil
+	}
+	return logFile, nil
+}
+
+// toggleDebugLogging switches between debug logging and the configured level.
+func toggleDebugLogging(configured logging.Level) {
+	level := logging.LevelDebug
+	if logging.GetLevel() == logging.LevelDebug {
+		level = configured
+	}
+	logging.SetLevel(level)
+	logging.Infof("Log level set to %s", level)
+}
+
+// drain drains the server with the configured settings, logging its progress.
+func drain(lbServer *server.Server, drainConfig config.DrainConfig) {
+	logging.Infof("Draining the server...")
+	_, err := lbServer.Drain(
+		context.Background(),
+		drainConfig.ReadinessDelay.Duration,
+		drainConfig.Timeout.Duration,
+		func(p server.DrainProgress) {
+			logging.Infof("Drain %s: %d active connections, elapsed %s", p.Phase, p.Active, p.Elapsed)
+		})
+	if err != nil {
+		logging.Errorf("Unable to drain the server: %v", err)
+	}
+}
+
+// startDiscovery subscribes to the configured discovery provider for
+// every discovered pool and applies the reported backend sets to the
+// load balancer. onAdded is called with the backends added to a pool.
+func startDiscovery(
+	ctx context.Context,
+	appConfig *config.ApplicationConfig,
+	lb *lib.LoadBalancer,
+	onAdded func([]*lib.Backend),
+) error {
+	provider, err := discovery.NewProvider(appConfig.Discovery.Provider, appConfig.Discovery.Options)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+
+	for _, pool := range appConfig.Discovery.Pools {
+		err := discovery.Watch(ctx, provider, pool, func(discovered []discovery.Backend) {
+			backends := make([]*lib.Backend, 0, len(discovered))
+			for _, d := range discovered {
+				address, err := lib.CanonicalAddress(d.Address, appConfig.DefaultBackendPort)
+				if err != nil {
+					logging.Warnf("Ignoring discovered backend of pool %s: %v", pool, err)
+					continue
+				}
+				backends = append(backends, &lib.Backend{
+					Address:        address,
+					Group:          d.Group,
+					MaxConnections: appConfig.MaxBackendConnections,
+				})
+			}
+
+			added, removed := lb.SetPoolBackends(pool, backends)
+			for _, backend := range added {
+				logging.Infof("Discovered backend %s in pool %s", backend.Address, pool)
+			}
+			for _, backend := range removed {
+				logging.Infof("Removed backend %s from pool %s", backend.Address, pool)
+			}
+			if len(added) > 0 {
+				onAdded(added)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkConfigStaleness reports a degraded status if the configuration
+// file was modified after it was loaded, meaning the running
+// configuration no longer matches the file on disk.
+func checkConfigStaleness(configFile string, loadedAt time.Time) (health.Status, string) {
+	info, err := os.Stat(configFile)
+	if err != nil {
+		return health.StatusDegraded, fmt.Sprintf("unable to stat configuration file: %v", err)
+	}
+	if info.ModTime().After(loadedAt) {
+		return health.StatusDegraded, fmt.Sprintf("configuration file modified at %s after it was loaded at %s",
+			info.ModTime().Format(time.RFC3339), loadedAt.Format(time.RFC3339))
+	}
+	return health.StatusOK, fmt.Sprintf("configuration loaded at %s", loadedAt.Format(time.RFC3339))
+}
+
+// anonymousBackends returns the allowed backend sets of clients presenting
+// no certificate, formed by the pools admitting them, or nil if every pool
+// requires a certificate.
+func anonymousBackends(appConfig *config.ApplicationConfig) []map[string]struct{} {
+	pools := appConfig.AnonymousPools()
+	if len(pools) == 0 {
+		return nil
+	}
+	allowed := make(map[string]struct{}, len(pools))
+	for _, pool := range pools {
+		allowed[lib.PoolKey(pool)] = struct{}{}
 	}
-	log.Println("Server stopped.")
+	return []map[string]struct{}{allowed}
 }
 
-// mapSliceToMapSet converts a map of slices to a map of sets.
-func mapSliceToMapSet(mapSlice map[string][]string) map[string]map[string]struct{} {
-	mapSet := make(map[string]map[string]struct{}, len(mapSlice))
-	for key, slice := range mapSlice {
-		set := make(map[string]struct{}, len(slice))
-		for _, item := range slice {
-			set[item] = struct{}{}
+// unknownClientBackends returns the allowed backend sets of authenticated
+// clients missing from the access control list under the configured policy,
+// or nil if they are denied.
+func unknownClientBackends(appConfig *config.ApplicationConfig) []map[string]struct{} {
+	switch appConfig.UnknownClientPolicy {
+	case config.UnknownClientDefaultPool:
+		return []map[string]struct{}{{lib.PoolKey(config.DefaultPool): {}}}
+	case config.UnknownClientAllowAll:
+		allowed := make(map[string]struct{})
+		for pool := range appConfig.PoolBackends() {
+			allowed[lib.PoolKey(pool)] = struct{}{}
 		}
-		mapSet[key] = set
+		if appConfig.Discovery != nil {
+			for _, pool := range appConfig.Discovery.Pools {
+				allowed[lib.PoolKey(pool)] = struct{}{}
+			}
+		}
+		return []map[string]struct{}{allowed}
+	}
+	return nil
+}
+
+// makeSet converts a list of strings into a set.
+func makeSet(values []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		set[value] = struct{}{}
+	}
+	return set
+}
+
+// rateLimitKeyParts converts the configured rate limiter key, nil if it
+// is not set. Parts are validated while loading the config.
+func rateLimitKeyParts(key []string) []server.RateLimitKeyPart {
+	if len(key) == 0 {
+		return nil
+	}
+	parts := make([]server.RateLimitKeyPart, len(key))
+	for i, part := range key {
+		parts[i] = server.RateLimitKeyPart(part)
 	}
-	return mapSet
+	return parts
 }
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/rrasulzade/tcp-lb-go/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnknownClientBackends(t *testing.T) {
+	require := require.New(t)
+
+	appConfig := &config.ApplicationConfig{
+		Backends:            config.BackendList{{Address: "127.0.0.1:5001"}},
+		Pools:               map[string]config.BackendList{"api": {{Address: "127.0.0.1:5002"}}},
+		Discovery:           &config.DiscoveryConfig{Pools: []string{"discovered"}},
+		UnknownClientPolicy: config.UnknownClientDeny,
+	}
+	require.Nil(unknownClientBackends(appConfig))
+
+	appConfig.UnknownClientPolicy = config.UnknownClientDefaultPool
+	require.Equal([]map[string]struct{}{{"pool:default": {}}}, unknownClientBackends(appConfig))
+
+	appConfig.UnknownClientPolicy = config.UnknownClientAllowAll
+	require.Equal([]map[string]struct{}{{
+		"pool:default":    {},
+		"pool:api":        {},
+		"pool:discovered": {},
+	}}, unknownClientBackends(appConfig))
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/config"
+	"github.com/rrasulzade/tcp-lb-go/health"
+	"github.com/rrasulzade/tcp-lb-go/lib"
+)
+
+// defaultAdminURL is the base URL of the admin API listening on the
+// default admin address.
+const defaultAdminURL = "http://" + config.DefaultAdminAddress
+
+// adminOptions holds the settings of the subcommands calling the admin API.
+type adminOptions struct {
+	// admin is the base URL of the admin API, e.g. "https://127.0.0.1:9000".
+	admin string
+
+	// token is the bearer token presented to the admin API.
+	token string
+
+	// caFile is the CA file verifying the admin API certificate.
+	caFile string
+
+	// certFile and keyFile are the client certificate presented to the admin API.
+	certFile string
+	keyFile  string
+}
+
+// register defines the flags of the admin API settings.
+func (o *adminOptions) register(flags *flag.FlagSet) {
+	flags.StringVar(&o.admin, "admin", defaultAdminURL, "Base URL of the admin API")
+	flags.StringVar(&o.token, "token", "", "Bearer token presented to the admin API")
+	flags.StringVar(&o.caFile, "ca-file", "", "CA file verifying the admin API certificate")
+	flags.StringVar(&o.certFile, "cert-file", "", "Client certificate file presented to the admin API")
+	flags.StringVar(&o.keyFile, "key-file", "", "Client key file presented to the admin API")
+}
+
+// client creates an HTTP client for the admin API.
+func (o adminOptions) client() (*http.Client, error) {
+	if o.admin == "" {
+		return nil, errors.New("admin API URL is required")
+	}
+	return newAdminClient(o)
+}
+
+// runStatus runs the status subcommand, which prints the health and
+// readiness of the running load balancer and a summary of its backends:
+//
+//	tcp-lb-go status [-admin URL]
+func runStatus(args []string) error {
+	var opts adminOptions
+	flags := flag.NewFlagSet("status", flag.ExitOnError)
+	opts.register(flags)
+	flags.Parse(args)
+
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	// The health report and readiness are answered with 503 when failing
+	_, body, err := adminResponse(client, opts, http.MethodGet, "/healthz", nil)
+	if err != nil {
+		return err
+	}
+	var report health.Report
+	if err := json.Unmarshal(body, &report); err != nil {
+		return fmt.Errorf("invalid admin API response: %w", err)
+	}
+	readyStatus, _, err := adminResponse(client, opts, http.MethodGet, "/readyz", nil)
+	if err != nil {
+		return err
+	}
+	body, err = adminRequest(client, opts, http.MethodGet, "/backends", nil)
+	if err != nil {
+		return err
+	}
+	var backends []lib.BackendStatus
+	if err := json.Unmarshal(body, &backends); err != nil {
+		return fmt.Errorf("invalid admin API response: %w", err)
+	}
+
+	fmt.Printf("Status: %s (checked %s ago)\n", report.Status, time.Since(report.CheckedAt).Round(time.Second))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, check := range report.Checks {
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", check.Name, check.Status, check.Message)
+	}
+	w.Flush()
+	fmt.Printf("Ready: %t\n", readyStatus == http.StatusOK)
+
+	var available int
+	var connections int64
+	for _, backend := range backends {
+		if backend.Available {
+			available++
+		}
+		connections += backend.Connections
+	}
+	fmt.Printf("Backends: %d of %d available, %d active connections\n", available, len(backends), connections)
+	return nil
+}
+
+// runBackends runs the backends subcommand, which lists, adds and removes
+// the backends of the running load balancer:
+//
+//	tcp-lb-go backends list [-admin URL]
+//	tcp-lb-go backends add [-admin URL] -pool POOL [-group GROUP] [-failure-domain DOMAIN] [-max-connections N] ADDRESS
+//	tcp-lb-go backends remove [-admin URL] -pool POOL [-drain-timeout DURATION] ADDRESS
+func runBackends(args []string) error {
+	if len(args) == 0 || (args[0] != "list" && args[0] != "add" && args[0] != "remove") {
+		return errors.New("usage: backends list|add|remove [flags] [ADDRESS]")
+	}
+	action := args[0]
+
+	var opts adminOptions
+	var pool, group, failureDomain string
+	var maxConnections int64
+	var drainTimeout time.Duration
+	var cluster bool
+	flags := flag.NewFlagSet("backends "+action, flag.ExitOnError)
+	opts.register(flags)
+	if action != "list" {
+		flags.StringVar(&pool, "pool", "", "Pool of the backend")
+		flags.BoolVar(&cluster, "cluster", false, "Apply the change to every instance of the cluster")
+	}
+	if action == "add" {
+		flags.StringVar(&group, "group", "", "Deployment group of the backend")
+		flags.StringVar(&failureDomain, "failure-domain", "", "Failure domain of the backend")
+		flags.Int64Var(&maxConnections, "max-connections", -1, "Connection limit of the backend, defaults to the configured one")
+	}
+	if action == "remove" {
+		flags.DurationVar(&drainTimeout, "drain-timeout", 0, "Time to wait for the active connections of the backend before force-closing them")
+	}
+	flags.Parse(args[1:])
+
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+	if action == "list" {
+		return listBackends(client, opts)
+	}
+
+	if flags.NArg() != 1 || pool == "" {
+		return fmt.Errorf("usage: backends %s -pool POOL [flags] ADDRESS", action)
+	}
+	address := flags.Arg(0)
+	query := url.Values{}
+	if cluster {
+		query.Set("cluster", "true")
+	}
+
+	if action == "remove" {
+		query.Set("pool", pool)
+		query.Set("address", address)
+		if drainTimeout <= 0 {
+			if _, err := adminRequest(client, opts, http.MethodDelete, "/backends?"+query.Encode(), nil); err != nil {
+				return err
+			}
+			fmt.Printf("Backend %s removed from pool %s, its active connections continue\n", address, pool)
+			return nil
+		}
+
+		// The response only comes once the connections finished
+		query.Set("drain_timeout", drainTimeout.String())
+		client.Timeout += drainTimeout
+		body, err := adminRequest(client, opts, http.MethodDelete, "/backends?"+query.Encode(), nil)
+		if err != nil {
+			return err
+		}
+		var removal struct {
+			ActiveAtStart int64  `json:"active_at_start"`
+			ForceClosed   int64  `json:"force_closed"`
+			Duration      string `json:"duration"`
+		}
+		if err := json.Unmarshal(body, &removal); err != nil {
+			return fmt.Errorf("invalid admin API response: %w", err)
+		}
+		fmt.Printf("Backend %s removed from pool %s, %d of %d active connections finished in %s, %d force-closed\n",
+			address, pool, removal.ActiveAtStart-removal.ForceClosed, removal.ActiveAtStart, removal.Duration, removal.ForceClosed)
+		return nil
+	}
+
+	add := map[string]any{
+		"pool":           pool,
+		"address":        address,
+		"group":          group,
+		"failure_domain": failureDomain,
+	}
+	if maxConnections >= 0 {
+		add["max_connections"] = maxConnections
+	}
+	data, err := json.Marshal(add)
+	if err != nil {
+		return err
+	}
+	path := "/backends"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	if _, err := adminRequest(client, opts, http.MethodPost, path, data); err != nil {
+		return err
+	}
+	fmt.Printf("Backend %s added to pool %s\n", address, pool)
+	return nil
+}
+
+// listBackends prints the backends with their availability, connections
+// and weights, one per line.
+func listBackends(client *http.Client, opts adminOptions) error {
+	body, err := adminRequest(client, opts, http.MethodGet, "/backends", nil)
+	if err != nil {
+		return err
+	}
+	var backends []lib.BackendStatus
+	if err := json.Unmarshal(body, &backends); err != nil {
+		return fmt.Errorf("invalid admin API response: %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ADDRESS\tPOOL\tSTATUS\tCONNECTIONS\tWEIGHT")
+	for _, backend := range backends {
+		status := "available"
+		if !backend.Available {
+			status = string(backend.Reason)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d/%d\n", backend.Address, backend.Pool, status,
+			backend.Connections, backend.EffectiveWeight, backend.Weight)
+	}
+	return w.Flush()
+}
+
+// drainPollInterval is the interval at which the drain subcommand polls
+// the active connections of the drained backend.
+var drainPollInterval = time.Second
+
+// runDrain runs the drain subcommand, which stops routing new connections
+// to a backend of the running load balancer by setting its weight to zero
+// in every pool, then waits up to the timeout for its active connections
+// to finish, printing their count as it changes. With -cluster, only the
+// connections to the backend from the instance at -admin are waited for:
+//
+//	tcp-lb-go drain [-admin URL] [-ramp DURATION] [-timeout DURATION] [-cluster] ADDRESS
+func runDrain(args []string) error {
+	var opts adminOptions
+	var ramp, timeout time.Duration
+	var cluster bool
+	flags := flag.NewFlagSet("drain", flag.ExitOnError)
+	opts.register(flags)
+	flags.DurationVar(&ramp, "ramp", 0, "Time over which the weight of the backend decreases to zero")
+	flags.DurationVar(&timeout, "timeout", 5*time.Minute, "Time to wait for the active connections of the backend to finish, 0 to not wait")
+	flags.BoolVar(&cluster, "cluster", false, "Drain the backend on every instance of the cluster")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return errors.New("usage: drain [flags] ADDRESS")
+	}
+	address := flags.Arg(0)
+
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+	req := map[string]any{"address": address, "weight": 0}
+	if ramp > 0 {
+		req["ramp"] = ramp.String()
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	path := "/backends/weights"
+	if cluster {
+		path += "?cluster=true"
+	}
+	if _, err := adminRequest(client, opts, http.MethodPut, path, data); err != nil {
+		return err
+	}
+	if timeout <= 0 {
+		fmt.Printf("Backend %s drained, its active connections continue\n", address)
+		return nil
+	}
+
+	// The weight only reaches zero once the ramp ended
+	deadline := time.Now().Add(ramp + timeout)
+	reported := int64(-1)
+	for {
+		connections, err := backendConnections(client, opts, address)
+		if err != nil {
+			return err
+		}
+		if connections == 0 {
+			fmt.Printf("Backend %s drained, no active connections left\n", address)
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("backend %s still has %d active connections after %s", address, connections, ramp+timeout)
+		}
+		if connections != reported {
+			fmt.Printf("Waiting for %d active connections of backend %s\n", connections, address)
+			reported = connections
+		}
+		time.Sleep(drainPollInterval)
+	}
+}
+
+// backendConnections returns the active connections of the backend with
+// the address, summed over its pools.
+func backendConnections(client *http.Client, opts adminOptions, address string) (int64, error) {
+	body, err := adminRequest(client, opts, http.MethodGet, "/backends", nil)
+	if err != nil {
+		return 0, err
+	}
+	var backends []lib.BackendStatus
+	if err := json.Unmarshal(body, &backends); err != nil {
+		return 0, fmt.Errorf("invalid admin API response: %w", err)
+	}
+
+	var connections int64
+	for _, backend := range backends {
+		if backend.Address == address {
+			connections += backend.Connections
+		}
+	}
+	return connections, nil
+}
+
+// newAdminClient creates an HTTP client for the admin API.
+func newAdminClient(opts adminOptions) (*http.Client, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS13}
+	if opts.caFile != "" {
+		caCert, err := os.ReadFile(opts.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read admin CA file: %w", err)
+		}
+		rootCAs := x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(caCert) {
+			return nil, errors.New("unable to parse admin CA certificate PEM")
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+	if opts.certFile != "" || opts.keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.certFile, opts.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load admin client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}, nil
+}
+
+// adminRequest sends a request to the admin API and returns the response
+// body, or the error reported by the admin API.
+func adminRequest(client *http.Client, opts adminOptions, method, path string, body []byte) ([]byte, error) {
+	status, respBody, err := adminResponse(client, opts, method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	if status < 200 || status >= 300 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(respBody, &apiErr) == nil && apiErr.Error != "" {
+			return nil, fmt.Errorf("admin API error (%d %s): %s", status, http.StatusText(status), apiErr.Error)
+		}
+		return nil, fmt.Errorf("admin API error: %d %s", status, http.StatusText(status))
+	}
+	return respBody, nil
+}
+
+// adminResponse sends a request to the admin API and returns the status
+// and body of the response, whatever the status.
+func adminResponse(client *http.Client, opts adminOptions, method, path string, body []byte) (int, []byte, error) {
+	req, err := http.NewRequest(method, strings.TrimSuffix(opts.admin, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if opts.token != "" {
+		req.Header.Set("Authorization", "Bearer "+opts.token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("admin API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("unable to read admin API response: %w", err)
+	}
+	return resp.StatusCode, respBody, nil
+}
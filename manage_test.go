@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/health"
+	"github.com/rrasulzade/tcp-lb-go/lib"
+	"github.com/stretchr/testify/require"
+)
+
+// stubAdmin is an admin API serving backends whose active connections
+// finish one per poll once their weight was set.
+type stubAdmin struct {
+	mu       sync.Mutex
+	backends []lib.BackendStatus
+	weights  []map[string]any
+}
+
+func (a *stubAdmin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/healthz":
+		writeJSONResponse(w, http.StatusOK, health.Report{Status: health.StatusOK, CheckedAt: time.Now()})
+	case r.Method == http.MethodGet && r.URL.Path == "/readyz":
+		w.WriteHeader(http.StatusServiceUnavailable)
+	case r.Method == http.MethodGet && r.URL.Path == "/backends":
+		writeJSONResponse(w, http.StatusOK, a.backends)
+		if len(a.weights) > 0 {
+			for i := range a.backends {
+				if a.backends[i].Connections > 0 {
+					a.backends[i].Connections--
+				}
+			}
+		}
+	case r.Method == http.MethodPut && r.URL.Path == "/backends/weights":
+		var req map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		a.weights = append(a.weights, req)
+		writeJSONResponse(w, http.StatusOK, a.backends)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestManagementCommands(t *testing.T) {
+	drainPollInterval = time.Millisecond
+	defer func() { drainPollInterval = time.Second }()
+
+	newAdmin := func(t *testing.T) (*stubAdmin, []string) {
+		stub := &stubAdmin{backends: []lib.BackendStatus{
+			{Address: "10.0.0.1:8080", Pool: "web", Available: true, Connections: 2, Weight: 1, EffectiveWeight: 1},
+			{Address: "10.0.0.1:8080", Pool: "api", Available: true, Connections: 1, Weight: 1, EffectiveWeight: 1},
+			{Address: "10.0.0.2:8080", Pool: "web", Reason: lib.SkipAtCapacity, Connections: 5, Weight: 1, EffectiveWeight: 1},
+		}}
+		admin := httptest.NewServer(stub)
+		t.Cleanup(admin.Close)
+		return stub, []string{"-admin", admin.URL}
+	}
+
+	t.Run("Status", func(t *testing.T) {
+		_, flags := newAdmin(t)
+		output, err := captureStdout(t, func() error { return runStatus(flags) })
+		require.NoError(t, err)
+		require.Contains(t, output, "Ready: false\n")
+		require.Contains(t, output, "Backends: 2 of 3 available, 8 active connections\n")
+	})
+
+	t.Run("Drain waits for connections", func(t *testing.T) {
+		require := require.New(t)
+
+		stub, flags := newAdmin(t)
+		output, err := captureStdout(t, func() error {
+			return runDrain(append(flags, "10.0.0.1:8080"))
+		})
+		require.NoError(err)
+		require.Equal([]map[string]any{{"address": "10.0.0.1:8080", "weight": float64(0)}}, stub.weights)
+		require.Equal("Waiting for 3 active connections of backend 10.0.0.1:8080\n"+
+			"Waiting for 1 active connections of backend 10.0.0.1:8080\n"+
+			"Backend 10.0.0.1:8080 drained, no active connections left\n", output)
+	})
+
+	t.Run("Drain times out", func(t *testing.T) {
+		stub, flags := newAdmin(t)
+		stub.backends[2].Connections = 1000
+		_, err := captureStdout(t, func() error {
+			return runDrain(append(flags, "-timeout", "20ms", "10.0.0.2:8080"))
+		})
+		require.ErrorContains(t, err, "backend 10.0.0.2:8080 still has")
+	})
+
+	t.Run("Drain without waiting", func(t *testing.T) {
+		_, flags := newAdmin(t)
+		output, err := captureStdout(t, func() error {
+			return runDrain(append(flags, "-timeout", "0", "10.0.0.1:8080"))
+		})
+		require.NoError(t, err)
+		require.Equal(t, "Backend 10.0.0.1:8080 drained, its active connections continue\n", output)
+	})
+
+	t.Run("Usage", func(t *testing.T) {
+		require.ErrorContains(t, runDrain(nil), "usage: drain [flags] ADDRESS")
+		require.ErrorContains(t, runBackends([]string{"delete"}), "usage: backends list|add|remove")
+	})
+}
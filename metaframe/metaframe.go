@@ -0,0 +1,150 @@
+// Package metaframe implements a lightweight framing that prepends the
+// metadata of a client connection, e.g. its identity and tags, to the
+// connection to a backend, as a simpler alternative to the PROXY protocol
+// for backends aware of the load balancer.
+//
+// A frame is the 4-byte magic "LBMD", a version byte, the length of the
+// fields as a big-endian uint16, and the fields as type-length-value
+// entries: a type byte, the length of the value as a big-endian uint16
+// and the value. Fields of unknown types are skipped by readers.
+package metaframe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+// magic is the prefix of a metadata frame.
+var magic = []byte("LBMD")
+
+// version is the version of the frame format.
+const version byte = 0x01
+
+// define field types.
+const (
+	// TypeClientID is the field type carrying the client ID.
+	TypeClientID byte = 0x01
+
+	// TypeCommonName is the field type carrying the Common Name of the
+	// client certificate.
+	TypeCommonName byte = 0x02
+
+	// TypeConnectionID is the field type carrying the load balancer's
+	// connection ID.
+	TypeConnectionID byte = 0x03
+
+	// TypeTag is the field type carrying a client tag as "key=value".
+	// A frame holds one field per tag.
+	TypeTag byte = 0x04
+)
+
+// ErrFrameTooLarge is returned when the fields of a frame exceed the
+// length the frame can announce.
+var ErrFrameTooLarge = errors.New("metadata frame too large")
+
+// Metadata is the metadata of a client connection carried by a frame.
+// Empty values are omitted from the frame.
+type Metadata struct {
+	// ClientID is the ID of the client.
+	ClientID string
+
+	// CommonName is the Common Name of the client certificate.
+	CommonName string
+
+	// ConnectionID is the load balancer's ID of the connection.
+	ConnectionID string
+
+	// Tags are the tags of the client, e.g. its tenant.
+	Tags map[string]string
+}
+
+// Encode builds the frame carrying the metadata, with the tags sorted
+// by key.
+func Encode(metadata Metadata) ([]byte, error) {
+	var fields []byte
+	tooLarge := false
+	appendField := func(typ byte, value string) {
+		if len(value) > math.MaxUint16 {
+			tooLarge = true
+			return
+		}
+		if value == "" {
+			return
+		}
+		fields = append(fields, typ)
+		fields = binary.BigEndian.AppendUint16(fields, uint16(len(value)))
+		fields = append(fields, value...)
+	}
+	appendField(TypeClientID, metadata.ClientID)
+	appendField(TypeCommonName, metadata.CommonName)
+	appendField(TypeConnectionID, metadata.ConnectionID)
+	keys := make([]string, 0, len(metadata.Tags))
+	for key := range metadata.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		appendField(TypeTag, key+"="+metadata.Tags[key])
+	}
+	if tooLarge || len(fields) > math.MaxUint16 {
+		return nil, ErrFrameTooLarge
+	}
+
+	frame := make([]byte, 0, len(magic)+3+len(fields))
+	frame = append(frame, magic...)
+	frame = append(frame, version)
+	frame = binary.BigEndian.AppendUint16(frame, uint16(len(fields)))
+	return append(frame, fields...), nil
+}
+
+// Read reads a frame from r, reading no byte past the frame.
+func Read(r io.Reader) (*Metadata, error) {
+	prefix := make([]byte, len(magic)+3)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, fmt.Errorf("unable to read metadata frame: %w", err)
+	}
+	if !bytes.Equal(prefix[:len(magic)], magic) {
+		return nil, errors.New("invalid metadata frame magic")
+	}
+	if v := prefix[len(magic)]; v != version {
+		return nil, fmt.Errorf("unsupported metadata frame version 0x%02x", v)
+	}
+	fields := make([]byte, binary.BigEndian.Uint16(prefix[len(magic)+1:]))
+	if _, err := io.ReadFull(r, fields); err != nil {
+		return nil, fmt.Errorf("unable to read metadata frame: %w", err)
+	}
+
+	metadata := &Metadata{}
+	for len(fields) > 0 {
+		if len(fields) < 3 {
+			return nil, errors.New("truncated metadata frame field")
+		}
+		length := int(binary.BigEndian.Uint16(fields[1:3]))
+		if len(fields) < 3+length {
+			return nil, errors.New("truncated metadata frame field")
+		}
+		value := string(fields[3 : 3+length])
+		switch fields[0] {
+		case TypeClientID:
+			metadata.ClientID = value
+		case TypeCommonName:
+			metadata.CommonName = value
+		case TypeConnectionID:
+			metadata.ConnectionID = value
+		case TypeTag:
+			key, tagValue, _ := strings.Cut(value, "=")
+			if metadata.Tags == nil {
+				metadata.Tags = make(map[string]string)
+			}
+			metadata.Tags[key] = tagValue
+		}
+		fields = fields[3+length:]
+	}
+	return metadata, nil
+}
@@ -0,0 +1,94 @@
+package metaframe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncode(t *testing.T) {
+	require := require.New(t)
+
+	frame, err := Encode(Metadata{
+		ClientID: "c1",
+		Tags:     map[string]string{"tenant": "a", "env": "prod"},
+	})
+	require.NoError(err)
+	require.Equal([]byte("LBMD\x01\x00\x1B"+
+		"\x01\x00\x02c1"+
+		"\x04\x00\x08env=prod"+
+		"\x04\x00\x08tenant=a"), frame)
+
+	_, err = Encode(Metadata{ClientID: strings.Repeat("x", 1<<16)})
+	require.ErrorIs(err, ErrFrameTooLarge)
+}
+
+func TestRead(t *testing.T) {
+	require := require.New(t)
+
+	t.Run("round trip", func(t *testing.T) {
+		metadata := Metadata{
+			ClientID:     "c1",
+			CommonName:   "client1.example.com",
+			ConnectionID: "0123456789abcdef",
+			Tags:         map[string]string{"tenant": "a", "env": "prod"},
+		}
+		frame, err := Encode(metadata)
+		require.NoError(err)
+
+		r := bytes.NewReader(append(frame, "data"...))
+		read, err := Read(r)
+		require.NoError(err)
+		require.Equal(metadata, *read)
+		require.Equal(4, r.Len(), "no byte past the frame is read")
+	})
+
+	t.Run("unknown fields are skipped", func(t *testing.T) {
+		read, err := Read(bytes.NewReader([]byte("LBMD\x01\x00\x0A" +
+			"\x7F\x00\x02zz" +
+			"\x01\x00\x02c1")))
+		require.NoError(err)
+		require.Equal(&Metadata{ClientID: "c1"}, read)
+	})
+
+	t.Run("invalid frames", func(t *testing.T) {
+		for name, frame := range map[string]string{
+			"magic":     "LBMX\x01\x00\x00",
+			"version":   "LBMD\x02\x00\x00",
+			"truncated": "LBMD\x01\x00\x05\x01\x00\x02c",
+			"field":     "LBMD\x01\x00\x04\x01\x00\x02c",
+			"short":     "LBMD\x01\x00\x02\x01\x00",
+		} {
+			_, err := Read(strings.NewReader(frame))
+			require.Error(err, name)
+		}
+	})
+}
+
+func FuzzRead(f *testing.F) {
+	frame, _ := Encode(Metadata{ClientID: "c1", CommonName: "client1.example.com", Tags: map[string]string{"tenant": "a"}})
+	f.Add(frame)
+	f.Add([]byte("LBMD\x01\x00\x00"))
+	f.Add([]byte("LBMD\x01\x00\x06\x04\x00\x03a=b"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r := bytes.NewReader(data)
+		metadata, err := Read(r)
+		if err != nil {
+			return
+		}
+
+		// The frame is consumed entirely and nothing past it, and the
+		// metadata read survives a round trip
+		consumed := len(data) - r.Len()
+		require.Equal(t, len(magic)+3+int(binary.BigEndian.Uint16(data[5:7])), consumed)
+		encoded, err := Encode(*metadata)
+		require.NoError(t, err)
+		decoded, err := Read(bytes.NewReader(encoded))
+		require.NoError(t, err)
+		require.Equal(t, metadata, decoded)
+	})
+}
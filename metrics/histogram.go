@@ -0,0 +1,253 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// histogramType is the Prometheus type of histogram families.
+const histogramType metricType = "histogram"
+
+// Histogram is a single labeled time series counting observations
+// in buckets of upper bounds.
+type Histogram struct {
+	// labelValues are the values for the family's label names.
+	labelValues []string
+
+	// mu ensures concurrent access to the counts and sum.
+	mu sync.Mutex
+
+	// bounds are the sorted upper bounds of the buckets.
+	bounds []float64
+
+	// counts are the observation counts per bucket, the last one
+	// counting observations above every bound.
+	counts []uint64
+
+	// sum is the sum of the observed values.
+	sum float64
+}
+
+// Observe records a value.
+func (h *Histogram) Observe(value float64) {
+	i := sort.SearchFloat64s(h.bounds, value)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.counts[i]++
+	h.sum += value
+}
+
+// Snapshot returns the current counts of the histogram.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	snapshot := HistogramSnapshot{
+		Bounds: h.bounds,
+		Counts: append([]uint64(nil), h.counts...),
+		Sum:    h.sum,
+	}
+	for _, count := range h.counts {
+		snapshot.Count += count
+	}
+	return snapshot
+}
+
+// HistogramSnapshot holds the counts of a histogram at a point in time.
+type HistogramSnapshot struct {
+	// Bounds are the sorted upper bounds of the buckets.
+	Bounds []float64
+
+	// Counts are the observation counts per bucket, not cumulative.
+	// The last one counts observations above every bound.
+	Counts []uint64
+
+	// Count is the total number of observations.
+	Count uint64
+
+	// Sum is the sum of the observed values.
+	Sum float64
+}
+
+// Quantile estimates the q-quantile (0 <= q <= 1) of the observations by
+// interpolating linearly within the bucket it falls into. Observations
+// above every bound are estimated at the highest bound. Returns NaN if
+// there are no observations.
+func (s HistogramSnapshot) Quantile(q float64) float64 {
+	if s.Count == 0 {
+		return math.NaN()
+	}
+	rank := q * float64(s.Count)
+	var cumulative uint64
+	for i, count := range s.Counts {
+		if i == len(s.Bounds) {
+			break
+		}
+		if float64(cumulative+count) >= rank && count > 0 {
+			lower := 0.0
+			if i > 0 {
+				lower = s.Bounds[i-1]
+			}
+			return lower + (s.Bounds[i]-lower)*(rank-float64(cumulative))/float64(count)
+		}
+		cumulative += count
+	}
+	return s.Bounds[len(s.Bounds)-1]
+}
+
+// Since returns the observations recorded after the baseline, an earlier
+// snapshot of the same histogram, e.g. to report a distribution since its
+// statistics were reset without resetting the exposed histogram. The
+// snapshot is returned unchanged if the baseline is not an earlier
+// snapshot of the same buckets.
+func (s HistogramSnapshot) Since(baseline HistogramSnapshot) HistogramSnapshot {
+	if len(baseline.Counts) != len(s.Counts) || baseline.Count > s.Count {
+		return s
+	}
+	since := HistogramSnapshot{
+		Bounds: s.Bounds,
+		Counts: make([]uint64, len(s.Counts)),
+		Count:  s.Count - baseline.Count,
+		Sum:    s.Sum - baseline.Sum,
+	}
+	for i, count := range s.Counts {
+		if count < baseline.Counts[i] {
+			return s
+		}
+		since.Counts[i] = count - baseline.Counts[i]
+	}
+	return since
+}
+
+// HistogramFamily is a named histogram metric with a fixed set of label
+// names, whose series share the same bucket bounds.
+type HistogramFamily struct {
+	// mu ensures concurrent access to the values map.
+	mu sync.RWMutex
+
+	// name is the metric name.
+	name string
+
+	// help is the metric description.
+	help string
+
+	// bounds are the sorted upper bounds of the buckets.
+	bounds []float64
+
+	// labelNames are the label names of every series.
+	labelNames []string
+
+	// values maps joined label values to a series.
+	values map[string]*Histogram
+}
+
+// With returns the series for the given label values, creating it if needed.
+// The number of values must match the number of label names.
+func (f *HistogramFamily) With(labelValues ...string) *Histogram {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d",
+			f.name, len(f.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	f.mu.RLock()
+	h, ok := f.values[key]
+	f.mu.RUnlock()
+	if ok {
+		return h
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if h, ok = f.values[key]; !ok {
+		h = &Histogram{
+			labelValues: append([]string(nil), labelValues...),
+			bounds:      f.bounds,
+			counts:      make([]uint64, len(f.bounds)+1),
+		}
+		f.values[key] = h
+	}
+	return h
+}
+
+// Lookup returns the series for the given label values, if it exists.
+func (f *HistogramFamily) Lookup(labelValues ...string) (*Histogram, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	h, ok := f.values[strings.Join(labelValues, "\xff")]
+	return h, ok
+}
+
+// write writes the family in the Prometheus text exposition format.
+func (f *HistogramFamily) write(w io.Writer) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, f.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, histogramType)
+
+	// Sort series for a stable output
+	keys := make([]string, 0, len(f.values))
+	for key := range f.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	bucketLabels := append(append([]string(nil), f.labelNames...), "le")
+	for _, key := range keys {
+		h := f.values[key]
+		snapshot := h.Snapshot()
+
+		var cumulative uint64
+		for i, count := range snapshot.Counts {
+			cumulative += count
+			le := "+Inf"
+			if i < len(snapshot.Bounds) {
+				le = strconv.FormatFloat(snapshot.Bounds[i], 'g', -1, 64)
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n",
+				f.name, formatLabels(bucketLabels, append(append([]string(nil), h.labelValues...), le)), cumulative)
+		}
+		labels := formatLabels(f.labelNames, h.labelValues)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, labels, strconv.FormatFloat(snapshot.Sum, 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, labels, snapshot.Count)
+	}
+}
+
+// Histogram returns the histogram family with the given name and bucket
+// upper bounds, registering it on first use.
+func (r *Registry) Histogram(name, help string, bounds []float64, labelNames ...string) *HistogramFamily {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if f, ok := r.histograms[name]; ok {
+		if len(f.labelNames) != len(labelNames) {
+			panic(fmt.Sprintf("metric %s registered twice with different definitions", name))
+		}
+		return f
+	}
+	if _, ok := r.families[name]; ok {
+		panic(fmt.Sprintf("metric %s registered twice with different definitions", name))
+	}
+
+	bounds = append([]float64(nil), bounds...)
+	sort.Float64s(bounds)
+	f := &HistogramFamily{
+		name:       name,
+		help:       help,
+		bounds:     bounds,
+		labelNames: labelNames,
+		values:     make(map[string]*Histogram),
+	}
+	r.histograms[name] = f
+	return f
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogram(t *testing.T) {
+	require := require.New(t)
+
+	t.Run("Expose histograms", func(t *testing.T) {
+		r := NewRegistry()
+		h := r.Histogram("test_latency", "Test histogram.", []float64{10, 1}, "backend").With("b1")
+		h.Observe(0.5)
+		h.Observe(5)
+		h.Observe(50)
+		r.Gauge("test_active", "Test gauge.").With().Set(1)
+
+		var buf bytes.Buffer
+		r.Expose(&buf)
+		require.Equal(`# HELP test_active Test gauge.
+# TYPE test_active gauge
+test_active 1
+# HELP test_latency Test histogram.
+# TYPE test_latency histogram
+test_latency_bucket{backend="b1",le="1"} 1
+test_latency_bucket{backend="b1",le="10"} 2
+test_latency_bucket{backend="b1",le="+Inf"} 3
+test_latency_sum{backend="b1"} 55.5
+test_latency_count{backend="b1"} 3
+`, buf.String())
+	})
+
+	t.Run("Quantiles", func(t *testing.T) {
+		r := NewRegistry()
+		h := r.Histogram("test_latency", "Test histogram.", []float64{10, 20})
+		require.True(math.IsNaN(h.With().Snapshot().Quantile(0.5)))
+
+		for i := 0; i < 10; i++ {
+			h.With().Observe(15)
+		}
+		snapshot := h.With().Snapshot()
+		require.Equal(uint64(10), snapshot.Count)
+		require.InDelta(15, snapshot.Quantile(0.5), 0.001)
+		require.InDelta(20, snapshot.Quantile(1), 0.001)
+
+		h.With().Observe(100)
+		require.Equal(20.0, h.With().Snapshot().Quantile(1))
+	})
+
+	t.Run("Observations since a baseline", func(t *testing.T) {
+		r := NewRegistry()
+		h := r.Histogram("test_latency", "Test histogram.", []float64{10, 20}).With()
+		h.Observe(5)
+		baseline := h.Snapshot()
+		h.Observe(15)
+		h.Observe(15)
+
+		since := h.Snapshot().Since(baseline)
+		require.Equal(uint64(2), since.Count)
+		require.Equal([]uint64{0, 2, 0}, since.Counts)
+		require.Equal(30.0, since.Sum)
+		require.Equal(uint64(3), h.Snapshot().Count, "Expected the histogram to be unchanged")
+
+		require.Equal(baseline, baseline.Since(h.Snapshot()))
+	})
+
+	t.Run("Conflicting definitions", func(t *testing.T) {
+		r := NewRegistry()
+		r.Counter("test_total", "Test counter.")
+		require.Panics(func() {
+			r.Histogram("test_total", "Test histogram.", []float64{1})
+		})
+		_, ok := r.Histogram("test_latency", "Test histogram.", []float64{1}).Lookup()
+		require.False(ok)
+	})
+}
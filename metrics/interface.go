@@ -0,0 +1,137 @@
+package metrics
+
+// Metrics records the metrics of the load balancer, so that embedders can
+// route them into their own telemetry system instead of a Registry. Metric
+// families are requested once, when a component is created, and their
+// series are looked up by label values as events occur.
+type Metrics interface {
+	// Counter returns the counter family with the given name.
+	Counter(name, help string, labelNames ...string) CounterVec
+
+	// Gauge returns the gauge family with the given name.
+	Gauge(name, help string, labelNames ...string) GaugeVec
+
+	// Histogram returns the histogram family with the given name,
+	// whose buckets have the given sorted upper bounds.
+	Histogram(name, help string, bounds []float64, labelNames ...string) HistogramVec
+}
+
+// CounterVec is a counter family.
+type CounterVec interface {
+	// With returns the series for the given label values.
+	With(labelValues ...string) Counter
+}
+
+// Counter is a series that is only increased.
+type Counter interface {
+	Inc()
+	Add(delta int64)
+}
+
+// GaugeVec is a gauge family.
+type GaugeVec interface {
+	// With returns the series for the given label values.
+	With(labelValues ...string) Gauge
+}
+
+// Gauge is a series that is increased, decreased and set.
+type Gauge interface {
+	Inc()
+	Dec()
+	Add(delta int64)
+	Set(value int64)
+}
+
+// HistogramVec is a histogram family.
+type HistogramVec interface {
+	// With returns the series for the given label values.
+	With(labelValues ...string) Observer
+}
+
+// Observer is a series recording observed values.
+type Observer interface {
+	Observe(value float64)
+}
+
+// Nop discards every metric. It is used when no Metrics is provided.
+var Nop Metrics = nopMetrics{}
+
+// nopMetrics returns families whose series discard every value.
+type nopMetrics struct{}
+
+func (nopMetrics) Counter(string, string, ...string) CounterVec { return nopCounterVec{} }
+func (nopMetrics) Gauge(string, string, ...string) GaugeVec     { return nopGaugeVec{} }
+func (nopMetrics) Histogram(string, string, []float64, ...string) HistogramVec {
+	return nopHistogramVec{}
+}
+
+type nopCounterVec struct{}
+
+func (nopCounterVec) With(...string) Counter { return nopSeries{} }
+
+type nopGaugeVec struct{}
+
+func (nopGaugeVec) With(...string) Gauge { return nopSeries{} }
+
+type nopHistogramVec struct{}
+
+func (nopHistogramVec) With(...string) Observer { return nopSeries{} }
+
+// nopSeries implements every series interface by discarding the values.
+type nopSeries struct{}
+
+func (nopSeries) Inc()            {}
+func (nopSeries) Dec()            {}
+func (nopSeries) Add(int64)       {}
+func (nopSeries) Set(int64)       {}
+func (nopSeries) Observe(float64) {}
+
+// FromRegistry returns a Metrics recording in the registry, which exposes
+// them in the Prometheus text exposition format.
+func FromRegistry(r *Registry) Metrics {
+	return registryMetrics{r}
+}
+
+// registryMetrics adapts a Registry to the Metrics interface.
+type registryMetrics struct {
+	r *Registry
+}
+
+func (m registryMetrics) Counter(name, help string, labelNames ...string) CounterVec {
+	return counterVec{m.r.Counter(name, help, labelNames...)}
+}
+
+func (m registryMetrics) Gauge(name, help string, labelNames ...string) GaugeVec {
+	return gaugeVec{m.r.Gauge(name, help, labelNames...)}
+}
+
+func (m registryMetrics) Histogram(name, help string, bounds []float64, labelNames ...string) HistogramVec {
+	return histogramVec{m.r.Histogram(name, help, bounds, labelNames...)}
+}
+
+// counterVec adapts a counter Family to the CounterVec interface.
+type counterVec struct {
+	f *Family
+}
+
+func (v counterVec) With(labelValues ...string) Counter {
+	return v.f.With(labelValues...)
+}
+
+// gaugeVec adapts a gauge Family to the GaugeVec interface.
+type gaugeVec struct {
+	f *Family
+}
+
+func (v gaugeVec) With(labelValues ...string) Gauge {
+	return v.f.With(labelValues...)
+}
+
+// histogramVec adapts a HistogramFamily to the HistogramVec interface.
+type histogramVec struct {
+	f *HistogramFamily
+}
+
+func (v histogramVec) With(labelValues ...string) Observer {
+	return v.f.With(labelValues...)
+}
@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromRegistry(t *testing.T) {
+	require := require.New(t)
+
+	r := NewRegistry()
+	m := FromRegistry(r)
+	m.Counter("test_total", "Test counter.", "reason").With("a").Add(2)
+	m.Gauge("test_active", "Test gauge.").With().Set(3)
+	m.Histogram("test_seconds", "Test histogram.", []float64{1}).With().Observe(0.5)
+
+	require.Equal(int64(2), r.Counter("test_total", "Test counter.", "reason").With("a").Load())
+	require.Equal(int64(3), r.Gauge("test_active", "Test gauge.").With().Load())
+	require.Equal(uint64(1), r.Histogram("test_seconds", "Test histogram.", []float64{1}).With().Snapshot().Count)
+}
+
+func TestNop(t *testing.T) {
+	require := require.New(t)
+
+	require.NotPanics(func() {
+		Nop.Counter("test_total", "Test counter.", "reason").With("a").Inc()
+		Nop.Gauge("test_active", "Test gauge.").With().Dec()
+		Nop.Histogram("test_seconds", "Test histogram.", []float64{1}).With().Observe(1)
+	})
+}
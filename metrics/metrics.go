@@ -0,0 +1,260 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// metricType is the Prometheus type of a metric family.
+type metricType string
+
+// define supported metric types.
+const (
+	counterType metricType = "counter"
+	gaugeType   metricType = "gauge"
+)
+
+// Value is a single labeled time series holding an integer value.
+type Value struct {
+	// labelValues are the values for the family's label names.
+	labelValues []string
+
+	// monotonic is set for counters, whose value never decreases.
+	monotonic bool
+
+	// value is the current value.
+	value atomic.Int64
+}
+
+// Add adds delta to the value. The value of a counter is only increased,
+// and saturates at the largest int64 rather than rolling over to a
+// negative value, so that rates computed from it stay correct.
+func (v *Value) Add(delta int64) {
+	if !v.monotonic {
+		v.value.Add(delta)
+		return
+	}
+	if delta <= 0 {
+		return
+	}
+	for {
+		current := v.value.Load()
+		next := current + delta
+		if next < current {
+			next = math.MaxInt64
+		}
+		if v.value.CompareAndSwap(current, next) {
+			return
+		}
+	}
+}
+
+// Inc increments the value by one.
+func (v *Value) Inc() {
+	v.Add(1)
+}
+
+// Dec decrements the value by one. Counters are not decremented.
+func (v *Value) Dec() {
+	v.Add(-1)
+}
+
+// Set sets the value. The value of a counter is only set if it
+// does not decrease.
+func (v *Value) Set(value int64) {
+	if !v.monotonic {
+		v.value.Store(value)
+		return
+	}
+	for {
+		current := v.value.Load()
+		if value <= current || v.value.CompareAndSwap(current, value) {
+			return
+		}
+	}
+}
+
+// Load returns the current value.
+func (v *Value) Load() int64 {
+	return v.value.Load()
+}
+
+// Family is a named metric with a fixed set of label names.
+type Family struct {
+	// mu ensures concurrent access to the values map.
+	mu sync.RWMutex
+
+	// name is the metric name.
+	name string
+
+	// help is the metric description.
+	help string
+
+	// typ is the metric type.
+	typ metricType
+
+	// labelNames are the label names of every series.
+	labelNames []string
+
+	// values maps joined label values to a series.
+	values map[string]*Value
+}
+
+// With returns the series for the given label values, creating it if needed.
+// The number of values must match the number of label names.
+func (f *Family) With(labelValues ...string) *Value {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d",
+			f.name, len(f.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	f.mu.RLock()
+	v, ok := f.values[key]
+	f.mu.RUnlock()
+	if ok {
+		return v
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if v, ok = f.values[key]; !ok {
+		v = &Value{
+			labelValues: append([]string(nil), labelValues...),
+			monotonic:   f.typ == counterType,
+		}
+		f.values[key] = v
+	}
+	return v
+}
+
+// write writes the family in the Prometheus text exposition format.
+func (f *Family) write(w io.Writer) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, f.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+
+	// Sort series for a stable output
+	keys := make([]string, 0, len(f.values))
+	for key := range f.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		v := f.values[key]
+		fmt.Fprintf(w, "%s%s %d\n", f.name, formatLabels(f.labelNames, v.labelValues), v.Load())
+	}
+}
+
+// formatLabels formats label pairs as {name="value",...}.
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=%q", name, values[i])
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Registry holds metric families and exposes them over HTTP
+// in the Prometheus text exposition format.
+type Registry struct {
+	// mu ensures concurrent access to the families map.
+	mu sync.Mutex
+
+	// families maps a metric name to its family.
+	families map[string]*Family
+
+	// histograms maps a metric name to its histogram family.
+	histograms map[string]*HistogramFamily
+}
+
+// writer is a metric family that can be exposed.
+type writer interface {
+	write(w io.Writer)
+}
+
+// NewRegistry initializes and returns a new Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		families:   make(map[string]*Family),
+		histograms: make(map[string]*HistogramFamily),
+	}
+}
+
+// Counter returns the counter family with the given name, registering it
+// on first use. Counters must only be increased.
+func (r *Registry) Counter(name, help string, labelNames ...string) *Family {
+	return r.family(name, help, counterType, labelNames)
+}
+
+// Gauge returns the gauge family with the given name, registering it on first use.
+func (r *Registry) Gauge(name, help string, labelNames ...string) *Family {
+	return r.family(name, help, gaugeType, labelNames)
+}
+
+// family returns a registered family or registers a new one.
+func (r *Registry) family(name, help string, typ metricType, labelNames []string) *Family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if f, ok := r.families[name]; ok {
+		if f.typ != typ || len(f.labelNames) != len(labelNames) {
+			panic(fmt.Sprintf("metric %s registered twice with different definitions", name))
+		}
+		return f
+	}
+	if _, ok := r.histograms[name]; ok {
+		panic(fmt.Sprintf("metric %s registered twice with different definitions", name))
+	}
+
+	f := &Family{
+		name:       name,
+		help:       help,
+		typ:        typ,
+		labelNames: labelNames,
+		values:     make(map[string]*Value),
+	}
+	r.families[name] = f
+	return f
+}
+
+// Expose writes all families in the Prometheus text exposition format.
+func (r *Registry) Expose(w io.Writer) {
+	r.mu.Lock()
+	families := make(map[string]writer, len(r.families)+len(r.histograms))
+	for name, f := range r.families {
+		families[name] = f
+	}
+	for name, f := range r.histograms {
+		families[name] = f
+	}
+	r.mu.Unlock()
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		families[name].write(w)
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	r.Expose(w)
+}
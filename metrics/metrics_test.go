@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	require := require.New(t)
+
+	t.Run("Expose counters and gauges", func(t *testing.T) {
+		r := NewRegistry()
+		r.Counter("test_total", "Test counter.", "tag", "value").With("tenant", "acme").Add(3)
+		r.Gauge("test_active", "Test gauge.").With().Set(7)
+
+		var buf bytes.Buffer
+		r.Expose(&buf)
+		require.Equal(`# HELP test_active Test gauge.
+# TYPE test_active gauge
+test_active 7
+# HELP test_total Test counter.
+# TYPE test_total counter
+test_total{tag="tenant",value="acme"} 3
+`, buf.String())
+	})
+
+	t.Run("Reuse registered family", func(t *testing.T) {
+		r := NewRegistry()
+		r.Counter("test_total", "Test counter.", "reason").With("a").Inc()
+		r.Counter("test_total", "Test counter.", "reason").With("a").Inc()
+		require.Equal(int64(2), r.Counter("test_total", "Test counter.", "reason").With("a").Load())
+	})
+
+	t.Run("Counters are monotonic", func(t *testing.T) {
+		r := NewRegistry()
+		counter := r.Counter("test_total", "Test counter.").With()
+		counter.Add(5)
+		counter.Dec()
+		counter.Add(-3)
+		counter.Set(2)
+		require.Equal(int64(5), counter.Load())
+
+		// Counters saturate rather than rolling over
+		counter.Set(math.MaxInt64 - 1)
+		counter.Add(10)
+		require.Equal(int64(math.MaxInt64), counter.Load())
+
+		gauge := r.Gauge("test_active", "Test gauge.").With()
+		gauge.Add(5)
+		gauge.Dec()
+		require.Equal(int64(4), gauge.Load())
+	})
+
+	t.Run("Label count mismatch", func(t *testing.T) {
+		r := NewRegistry()
+		require.Panics(func() {
+			r.Counter("test_total", "Test counter.", "reason").With()
+		})
+	})
+}
@@ -0,0 +1,211 @@
+// Package overload scores how overloaded the listener is, from the depth
+// of its accept queue, the number of TLS handshakes in progress and the
+// CPU usage of the process, so that a share of new connections can be
+// shed during traffic spikes to protect the established sessions.
+package overload
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/logging"
+)
+
+// Config defines when new connections are shed.
+type Config struct {
+	// Threshold is the score, between 0 and 1, at or above which
+	// new connections are shed.
+	Threshold float64
+
+	// ShedFraction is the share of new connections, between 0 and 1,
+	// closed while the score is at or above the threshold.
+	ShedFraction float64
+
+	// MaxHandshakes is the number of TLS handshakes in progress at which
+	// the handshake backlog is saturated. The handshake backlog is not
+	// scored if zero.
+	MaxHandshakes int
+
+	// Interval is the time between two samples of the accept queue
+	// and CPU usage.
+	Interval time.Duration
+}
+
+// Validate verifies the settings.
+func (c Config) Validate() error {
+	var errs []error
+	if c.Threshold <= 0 || c.Threshold > 1 {
+		errs = append(errs, errors.New("overload threshold must be greater than 0 and at most 1"))
+	}
+	if c.ShedFraction <= 0 || c.ShedFraction > 1 {
+		errs = append(errs, errors.New("overload shed fraction must be greater than 0 and at most 1"))
+	}
+	if c.MaxHandshakes < 0 {
+		errs = append(errs, errors.New("overload max handshakes must not be negative"))
+	}
+	if c.Interval <= 0 {
+		errs = append(errs, errors.New("overload sampling interval must be positive"))
+	}
+	return errors.Join(errs...)
+}
+
+// Signals are the saturation of each resource, where 0 is idle and 1
+// is saturated. Values may exceed 1, e.g. when more handshakes than
+// the maximum are in progress.
+type Signals struct {
+	// AcceptQueue is the depth of the listener's accept queue
+	// relative to its capacity.
+	AcceptQueue float64 `json:"accept_queue"`
+
+	// Handshakes is the number of TLS handshakes in progress
+	// relative to the configured maximum.
+	Handshakes float64 `json:"handshakes"`
+
+	// CPU is the CPU time used by the process relative to the
+	// time available to it.
+	CPU float64 `json:"cpu"`
+}
+
+// Score is the saturation of the most saturated resource, as any of
+// them slows down the handling of every connection.
+func (s Signals) Score() float64 {
+	return max(s.AcceptQueue, s.Handshakes, s.CPU)
+}
+
+// Detector samples the signals and decides which new connections are shed.
+type Detector struct {
+	// config defines when connections are shed.
+	config Config
+
+	// acceptQueue returns the depth and capacity of the accept queue,
+	// or false if they are unknown.
+	acceptQueue func() (depth, capacity int, ok bool)
+
+	// cpuTime returns the CPU time used by the process so far,
+	// or false if it is unknown.
+	cpuTime func() (time.Duration, bool)
+
+	// handshakes is the number of TLS handshakes in progress.
+	handshakes atomic.Int64
+
+	// mu ensures concurrent access to the sampled signals.
+	mu sync.Mutex
+
+	// sampled holds the latest sample of the accept queue and CPU usage.
+	sampled Signals
+
+	// lastCPU is the CPU time at the latest sample.
+	lastCPU time.Duration
+
+	// lastSample is the time of the latest sample.
+	lastSample time.Time
+
+	// random returns a number in [0, 1) deciding whether a connection is shed.
+	random func() float64
+
+	// overloaded is set while the score is at or above the threshold.
+	overloaded atomic.Bool
+}
+
+// NewDetector creates a Detector for the listener bound to the port.
+// The accept queue and CPU usage can only be sampled on Linux, and
+// are not scored on other platforms.
+func NewDetector(config Config, port int) (*Detector, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &Detector{
+		config: config,
+		acceptQueue: func() (int, int, bool) {
+			return acceptQueueDepth(port)
+		},
+		cpuTime: processCPUTime,
+		random:  rand.Float64,
+	}, nil
+}
+
+// HandshakeStarted records a TLS handshake in progress. The returned
+// function must be called once the handshake completed or failed.
+func (d *Detector) HandshakeStarted() func() {
+	d.handshakes.Add(1)
+	var once sync.Once
+	return func() {
+		once.Do(func() { d.handshakes.Add(-1) })
+	}
+}
+
+// Run samples the signals at the configured interval until ctx is done.
+func (d *Detector) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.config.Interval)
+	defer ticker.Stop()
+
+	d.sample(time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			d.sample(now)
+		}
+	}
+}
+
+// sample records the current depth of the accept queue and the CPU usage
+// since the previous sample.
+func (d *Detector) sample(now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if depth, capacity, ok := d.acceptQueue(); ok && capacity > 0 {
+		d.sampled.AcceptQueue = float64(depth) / float64(capacity)
+	}
+
+	cpu, ok := d.cpuTime()
+	if !ok {
+		return
+	}
+	if !d.lastSample.IsZero() {
+		elapsed := now.Sub(d.lastSample)
+		if elapsed > 0 {
+			available := elapsed * time.Duration(runtime.GOMAXPROCS(0))
+			d.sampled.CPU = float64(cpu-d.lastCPU) / float64(available)
+		}
+	}
+	d.lastCPU = cpu
+	d.lastSample = now
+}
+
+// Signals returns the latest sample of the accept queue and CPU usage,
+// along with the handshakes currently in progress.
+func (d *Detector) Signals() Signals {
+	d.mu.Lock()
+	signals := d.sampled
+	d.mu.Unlock()
+
+	if d.config.MaxHandshakes > 0 {
+		signals.Handshakes = float64(d.handshakes.Load()) / float64(d.config.MaxHandshakes)
+	}
+	return signals
+}
+
+// Shed reports whether a new connection should be closed right away,
+// which is the case for the configured share of connections while the
+// score is at or above the threshold.
+func (d *Detector) Shed() bool {
+	signals := d.Signals()
+	overloaded := signals.Score() >= d.config.Threshold
+	if d.overloaded.Swap(overloaded) != overloaded {
+		if overloaded {
+			logging.Warnf("Listener is overloaded (accept queue %.0f%%, handshakes %.0f%%, CPU %.0f%%), shedding %.0f%% of new connections",
+				signals.AcceptQueue*100, signals.Handshakes*100, signals.CPU*100, d.config.ShedFraction*100)
+		} else {
+			logging.Infof("Listener is no longer overloaded, accepting all new connections")
+		}
+	}
+	return overloaded && d.random() < d.config.ShedFraction
+}
@@ -0,0 +1,60 @@
+package overload
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetector(t *testing.T) {
+	require := require.New(t)
+
+	_, err := NewDetector(Config{Threshold: 2, ShedFraction: 0, Interval: time.Second}, 3003)
+	require.ErrorContains(err, "threshold")
+	require.ErrorContains(err, "shed fraction")
+
+	d, err := NewDetector(Config{Threshold: 0.8, ShedFraction: 0.5, MaxHandshakes: 4, Interval: time.Second}, 3003)
+	require.NoError(err)
+
+	depth := 0
+	var cpu time.Duration
+	d.acceptQueue = func() (int, int, bool) { return depth, 100, true }
+	d.cpuTime = func() (time.Duration, bool) { return cpu, true }
+	random := 0.0
+	d.random = func() float64 { return random }
+
+	// Below the threshold nothing is shed
+	start := time.Now()
+	d.sample(start)
+	require.Equal(Signals{}, d.Signals())
+	require.False(d.Shed())
+
+	// Handshakes in progress are scored right away
+	var done []func()
+	for i := 0; i < 4; i++ {
+		done = append(done, d.HandshakeStarted())
+	}
+	require.Equal(1.0, d.Signals().Handshakes)
+	require.True(d.Shed())
+	random = 0.6
+	require.False(d.Shed())
+
+	for _, f := range done {
+		f()
+		f()
+	}
+	require.Zero(d.Signals().Handshakes)
+
+	// The accept queue and CPU usage are sampled
+	depth = 90
+	cpu = 100 * time.Millisecond
+	d.sample(start.Add(time.Second))
+	signals := d.Signals()
+	require.Equal(0.9, signals.AcceptQueue)
+	require.Greater(signals.CPU, 0.0)
+	require.Equal(0.9, signals.Score())
+
+	random = 0.4
+	require.True(d.Shed())
+}
@@ -0,0 +1,81 @@
+package overload
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// tcpListenState is the state of listening sockets in /proc/net/tcp.
+const tcpListenState = "0A"
+
+// acceptQueueDepth returns the number of connections waiting to be
+// accepted on the port, and the capacity of the queue, which Go sets
+// to net.core.somaxconn. If several sockets listen on the port, e.g.
+// during a hot restart, the fullest queue is returned.
+func acceptQueueDepth(port int) (depth, capacity int, ok bool) {
+	somaxconn, err := os.ReadFile("/proc/sys/net/core/somaxconn")
+	if err != nil {
+		return 0, 0, false
+	}
+	capacity, err = strconv.Atoi(strings.TrimSpace(string(somaxconn)))
+	if err != nil {
+		return 0, 0, false
+	}
+
+	for _, path := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		if d, found := listenQueueDepth(path, port); found {
+			depth = max(depth, d)
+			ok = true
+		}
+	}
+	return depth, capacity, ok
+}
+
+// listenQueueDepth returns the largest accept queue of the sockets listening
+// on the port listed in a /proc/net/tcp file. For listening sockets, the
+// rx_queue column holds the number of connections waiting to be accepted.
+func listenQueueDepth(path string, port int) (depth int, found bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != tcpListenState {
+			continue
+		}
+		_, localPort, ok := strings.Cut(fields[1], ":")
+		if !ok {
+			continue
+		}
+		if p, err := strconv.ParseInt(localPort, 16, 32); err != nil || int(p) != port {
+			continue
+		}
+		_, rxQueue, ok := strings.Cut(fields[4], ":")
+		if !ok {
+			continue
+		}
+		if d, err := strconv.ParseInt(rxQueue, 16, 64); err == nil {
+			depth = max(depth, int(d))
+			found = true
+		}
+	}
+	return depth, found
+}
+
+// processCPUTime returns the user and system CPU time used by the process.
+func processCPUTime() (time.Duration, bool) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0, false
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano()), true
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package overload
+
+import "time"
+
+// acceptQueueDepth returns the depth and capacity of the port's accept
+// queue. Sampling it is only supported on Linux.
+func acceptQueueDepth(port int) (depth, capacity int, ok bool) {
+	return 0, 0, false
+}
+
+// processCPUTime returns the CPU time used by the process.
+// Sampling it is only supported on Linux.
+func processCPUTime() (time.Duration, bool) {
+	return 0, false
+}
@@ -0,0 +1,215 @@
+package proxyproto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+// signature is the PROXY protocol v2 header signature.
+var signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// define PROXY protocol v2 header constants.
+const (
+	// versionProxy is protocol version 2 with the PROXY command.
+	versionProxy byte = 0x21
+
+	// versionLocal is protocol version 2 with the LOCAL command, used
+	// when the original addresses are unknown.
+	versionLocal byte = 0x20
+
+	// familyUnspec is an unspecified address family and protocol.
+	familyUnspec byte = 0x00
+
+	// familyTCP4 is TCP over IPv4.
+	familyTCP4 byte = 0x11
+
+	// familyTCP6 is TCP over IPv6.
+	familyTCP6 byte = 0x21
+)
+
+// define custom TLV types, taken from the range reserved for custom use.
+const (
+	// TypeConnectionID is the TLV type carrying the load balancer's
+	// connection ID.
+	TypeConnectionID byte = 0xE0
+
+	// TypeLoopDetection is the TLV type carrying the instance IDs of the
+	// load balancers a connection went through, in order, so that a load
+	// balancer receiving its own ID detects a proxy loop.
+	TypeLoopDetection byte = 0xE1
+)
+
+// InstanceIDLength is the length of a load balancer instance ID in a
+// loop detection TLV.
+const InstanceIDLength = 8
+
+// maxHeaderLength bounds the length of the addresses and TLVs of a header
+// read from a connection.
+const maxHeaderLength = 4096
+
+// TLV is a type-length-value extension of a PROXY protocol v2 header.
+type TLV struct {
+	// Type is the TLV type.
+	Type byte
+
+	// Value is the TLV value.
+	Value []byte
+}
+
+// HeaderV2 builds a PROXY protocol v2 header announcing a TCP connection
+// from src to dst, followed by the provided TLVs. If either address is
+// not a TCP address, a LOCAL header without addresses is built instead.
+func HeaderV2(src, dst net.Addr, tlvs ...TLV) []byte {
+	version, family, addresses := versionLocal, familyUnspec, []byte(nil)
+
+	srcAddr, srcOK := src.(*net.TCPAddr)
+	dstAddr, dstOK := dst.(*net.TCPAddr)
+	if srcOK && dstOK {
+		version = versionProxy
+		srcIP4, dstIP4 := srcAddr.IP.To4(), dstAddr.IP.To4()
+		if srcIP4 != nil && dstIP4 != nil {
+			family = familyTCP4
+			addresses = append(addresses, srcIP4...)
+			addresses = append(addresses, dstIP4...)
+		} else {
+			// Mixed families are announced as IPv6 with mapped IPv4 addresses
+			family = familyTCP6
+			addresses = append(addresses, srcAddr.IP.To16()...)
+			addresses = append(addresses, dstAddr.IP.To16()...)
+		}
+		addresses = binary.BigEndian.AppendUint16(addresses, uint16(srcAddr.Port))
+		addresses = binary.BigEndian.AppendUint16(addresses, uint16(dstAddr.Port))
+	}
+
+	length := len(addresses)
+	for _, tlv := range tlvs {
+		length += 3 + len(tlv.Value)
+	}
+
+	header := make([]byte, 0, len(signature)+4+length)
+	header = append(header, signature...)
+	header = append(header, version, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(length))
+	header = append(header, addresses...)
+	for _, tlv := range tlvs {
+		header = append(header, tlv.Type)
+		header = binary.BigEndian.AppendUint16(header, uint16(len(tlv.Value)))
+		header = append(header, tlv.Value...)
+	}
+	return header
+}
+
+// Header is a PROXY protocol v2 header read from a connection.
+type Header struct {
+	// Source is the address of the original client, or nil
+	// for a LOCAL header or an unsupported address family.
+	Source net.Addr
+
+	// Destination is the original destination address, or nil
+	// for a LOCAL header or an unsupported address family.
+	Destination net.Addr
+
+	// TLVs are the header's type-length-value extensions.
+	TLVs []TLV
+}
+
+// TLV returns the value of the first TLV of the given type.
+func (h *Header) TLV(typ byte) ([]byte, bool) {
+	for _, tlv := range h.TLVs {
+		if tlv.Type == typ {
+			return tlv.Value, true
+		}
+	}
+	return nil, false
+}
+
+// ReadHeaderV2 reads a PROXY protocol v2 header from r, reading no byte
+// past the header.
+func ReadHeaderV2(r io.Reader) (*Header, error) {
+	prefix := make([]byte, len(signature)+4)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, fmt.Errorf("unable to read PROXY protocol header: %w", err)
+	}
+	if !bytes.Equal(prefix[:len(signature)], signature) {
+		return nil, errors.New("invalid PROXY protocol v2 signature")
+	}
+	version, family := prefix[len(signature)], prefix[len(signature)+1]
+	if version != versionProxy && version != versionLocal {
+		return nil, fmt.Errorf("unsupported PROXY protocol version and command 0x%02x", version)
+	}
+	length := int(binary.BigEndian.Uint16(prefix[len(signature)+2:]))
+	if length > maxHeaderLength {
+		return nil, fmt.Errorf("PROXY protocol header of %d bytes exceeds %d bytes", length, maxHeaderLength)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, fmt.Errorf("unable to read PROXY protocol header: %w", err)
+	}
+
+	header := &Header{}
+	var addressLength int
+	switch family {
+	case familyTCP4:
+		addressLength = 2*net.IPv4len + 4
+	case familyTCP6:
+		addressLength = 2*net.IPv6len + 4
+	}
+	if len(body) < addressLength {
+		return nil, errors.New("truncated PROXY protocol addresses")
+	}
+	if version == versionProxy && addressLength > 0 {
+		ipLength := (addressLength - 4) / 2
+		ports := body[2*ipLength:]
+		header.Source = &net.TCPAddr{
+			IP:   net.IP(bytes.Clone(body[:ipLength])),
+			Port: int(binary.BigEndian.Uint16(ports)),
+		}
+		header.Destination = &net.TCPAddr{
+			IP:   net.IP(bytes.Clone(body[ipLength : 2*ipLength])),
+			Port: int(binary.BigEndian.Uint16(ports[2:])),
+		}
+	}
+
+	// Addresses of other families are skipped along with the TLVs,
+	// as the length of their addresses is unknown
+	if addressLength == 0 && family != familyUnspec {
+		return header, nil
+	}
+	tlvs := body[addressLength:]
+	for len(tlvs) > 0 {
+		if len(tlvs) < 3 {
+			return nil, errors.New("truncated PROXY protocol TLV")
+		}
+		valueLength := int(binary.BigEndian.Uint16(tlvs[1:3]))
+		if len(tlvs) < 3+valueLength {
+			return nil, errors.New("truncated PROXY protocol TLV")
+		}
+		header.TLVs = append(header.TLVs, TLV{Type: tlvs[0], Value: bytes.Clone(tlvs[3 : 3+valueLength])})
+		tlvs = tlvs[3+valueLength:]
+	}
+	return header, nil
+}
+
+// NewInstanceID returns a random load balancer instance ID.
+func NewInstanceID() []byte {
+	id := make([]byte, InstanceIDLength)
+	// crypto/rand.Read never returns an error
+	rand.Read(id)
+	return id
+}
+
+// LoopDetected reports whether the instance ID is one of the instance IDs
+// of a loop detection TLV value.
+func LoopDetected(path, instanceID []byte) bool {
+	for ; len(path) >= InstanceIDLength; path = path[InstanceIDLength:] {
+		if bytes.Equal(path[:InstanceIDLength], instanceID) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package proxyproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeaderV2(t *testing.T) {
+	require := require.New(t)
+
+	t.Run("TCP over IPv4", func(t *testing.T) {
+		src := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 40000}
+		dst := &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 3003}
+
+		header := HeaderV2(src, dst)
+		require.Equal(signature, header[:12])
+		require.Equal([]byte{0x21, 0x11, 0x00, 0x0C}, header[12:16])
+		require.Equal([]byte{10, 0, 0, 1, 10, 0, 0, 2, 0x9C, 0x40, 0x0B, 0xBB}, header[16:])
+	})
+
+	t.Run("TCP over IPv6 with TLV", func(t *testing.T) {
+		src := &net.TCPAddr{IP: net.ParseIP("fd00::1"), Port: 40000}
+		dst := &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 3003}
+
+		header := HeaderV2(src, dst, TLV{Type: TypeConnectionID, Value: []byte("abc")})
+		require.Equal([]byte{0x21, 0x21, 0x00, 36 + 6}, header[12:16])
+		require.Equal([]byte{TypeConnectionID, 0x00, 0x03, 'a', 'b', 'c'}, header[len(header)-6:])
+	})
+
+	t.Run("Unknown addresses", func(t *testing.T) {
+		header := HeaderV2(nil, nil)
+		require.Equal([]byte{0x20, 0x00, 0x00, 0x00}, header[12:])
+	})
+}
+
+func TestReadHeaderV2(t *testing.T) {
+	require := require.New(t)
+
+	t.Run("Round trip", func(t *testing.T) {
+		src := &net.TCPAddr{IP: net.ParseIP("10.0.0.1").To4(), Port: 40000}
+		dst := &net.TCPAddr{IP: net.ParseIP("fd00::2"), Port: 3003}
+		tlv := TLV{Type: TypeLoopDetection, Value: []byte("12345678")}
+
+		r := bytes.NewReader(append(HeaderV2(src, dst, tlv), "payload"...))
+		header, err := ReadHeaderV2(r)
+		require.NoError(err)
+		require.Equal("10.0.0.1:40000", header.Source.String())
+		require.Equal("[fd00::2]:3003", header.Destination.String())
+		value, ok := header.TLV(TypeLoopDetection)
+		require.True(ok)
+		require.Equal(tlv.Value, value)
+		_, ok = header.TLV(TypeConnectionID)
+		require.False(ok)
+
+		rest, err := io.ReadAll(r)
+		require.NoError(err)
+		require.Equal("payload", string(rest))
+	})
+
+	t.Run("Local header", func(t *testing.T) {
+		header, err := ReadHeaderV2(bytes.NewReader(HeaderV2(nil, nil)))
+		require.NoError(err)
+		require.Nil(header.Source)
+		require.Empty(header.TLVs)
+	})
+
+	t.Run("Invalid headers", func(t *testing.T) {
+		_, err := ReadHeaderV2(bytes.NewReader([]byte("\x16\x03\x01\x02\x00\x01\x00\x01\xfc\x03\x03\x00\x00\x00\x00\x00")))
+		require.ErrorContains(err, "invalid PROXY protocol v2 signature")
+
+		header := HeaderV2(nil, nil, TLV{Type: TypeConnectionID, Value: []byte("abc")})
+		_, err = ReadHeaderV2(bytes.NewReader(header[:len(header)-1]))
+		require.Error(err)
+
+		header[15] = 2
+		_, err = ReadHeaderV2(bytes.NewReader(header[:18]))
+		require.ErrorContains(err, "truncated PROXY protocol TLV")
+	})
+}
+
+func TestLoopDetected(t *testing.T) {
+	require := require.New(t)
+
+	first, second := NewInstanceID(), NewInstanceID()
+	require.Len(first, InstanceIDLength)
+	require.NotEqual(first, second)
+
+	path := append(bytes.Clone(first), second...)
+	require.True(LoopDetected(path, first))
+	require.True(LoopDetected(path, second))
+	require.False(LoopDetected(path, NewInstanceID()))
+	require.False(LoopDetected(nil, first))
+}
+
+func FuzzReadHeaderV2(f *testing.F) {
+	src := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 40000}
+	dst := &net.TCPAddr{IP: net.ParseIP("fd00::2"), Port: 3003}
+	f.Add(HeaderV2(src, dst))
+	f.Add(HeaderV2(src, dst, TLV{Type: TypeConnectionID, Value: []byte("abc")}))
+	f.Add(HeaderV2(nil, nil, TLV{Type: TypeLoopDetection, Value: NewInstanceID()}))
+	f.Add([]byte("\x16\x03\x01\x02\x00\x01\x00\x01\xfc\x03\x03"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r := bytes.NewReader(data)
+		header, err := ReadHeaderV2(r)
+		if err != nil {
+			return
+		}
+
+		// The header is consumed entirely and nothing past it
+		consumed := len(data) - r.Len()
+		require.Equal(t, len(signature)+4+int(binary.BigEndian.Uint16(data[14:16])), consumed)
+		for _, tlv := range header.TLVs {
+			require.LessOrEqual(t, len(tlv.Value), consumed)
+		}
+	})
+}
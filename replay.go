@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/capture"
+	"github.com/rrasulzade/tcp-lb-go/config"
+)
+
+// replayOptions holds the settings of the replay mode.
+type replayOptions struct {
+	// file is the path of the capture to replay.
+	file string
+
+	// target is the address of the backend to replay against.
+	target string
+
+	// pool is the configured pool whose backends are tried in order
+	// when no target is given.
+	pool string
+
+	// speed divides the captured delays between records.
+	speed float64
+
+	// idleTimeout is the time to wait for backend data after the last record.
+	idleTimeout time.Duration
+}
+
+// replay replays the client data of a capture against a backend or pool,
+// preserving the captured timing, and prints the outcome.
+func replay(configFile string, opts replayOptions) error {
+	if opts.speed <= 0 {
+		return errors.New("replay speed must be positive")
+	}
+
+	f, err := os.Open(opts.file)
+	if err != nil {
+		return fmt.Errorf("unable to open capture: %w", err)
+	}
+	defer f.Close()
+	records, err := capture.ReadRecords(f)
+	if err != nil {
+		return err
+	}
+
+	targets, err := replayTargets(configFile, opts)
+	if err != nil {
+		return err
+	}
+
+	// Connect to the first backend accepting the connection
+	var conn net.Conn
+	var errs []error
+	for _, target := range targets {
+		if conn, err = net.DialTimeout("tcp", target, 5*time.Second); err == nil {
+			fmt.Printf("Replaying %d records of %s against %s\n", len(records), opts.file, target)
+			break
+		}
+		errs = append(errs, err)
+	}
+	if conn == nil {
+		return fmt.Errorf("unable to connect to backend: %w", errors.Join(errs...))
+	}
+	defer conn.Close()
+
+	result, err := capture.Replay(context.Background(), conn, records, opts.speed, opts.idleTimeout)
+	fmt.Printf("Replay %s\n", result)
+	return err
+}
+
+// replayTargets returns the backend addresses to replay against.
+func replayTargets(configFile string, opts replayOptions) ([]string, error) {
+	if (opts.target == "") == (opts.pool == "") {
+		return nil, errors.New("exactly one of -target or -pool is required")
+	}
+	if opts.target != "" {
+		return []string{opts.target}, nil
+	}
+
+	if configFile == "" {
+		return nil, errors.New("-pool requires -config")
+	}
+	appConfig, err := config.LoadAppConfig(configFile)
+	if err != nil {
+		return nil, err
+	}
+	backends, ok := appConfig.PoolBackends()[opts.pool]
+	if !ok || len(backends) == 0 {
+		return nil, fmt.Errorf("pool %s has no configured backends", opts.pool)
+	}
+	return backends, nil
+}
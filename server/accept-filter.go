@@ -0,0 +1,43 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+)
+
+// AcceptFilter is called with every accepted connection before its TLS
+// handshake, so that embedders enforce their own policies, e.g. check the
+// client's address against an external blocklist, without changing the
+// accept loop. conn is the raw connection under TLS, whose address is the
+// client's once a PROXY protocol header was read; reading from it would
+// break the handshake. A non-nil error rejects the connection. Otherwise
+// the returned context, derived from ctx, annotates the connection and is
+// passed to the load balancer; ctx is kept if it is nil.
+//
+// The filter runs in the connection's goroutine, so that a slow filter
+// does not delay other connections, and must be safe for concurrent use.
+type AcceptFilter func(ctx context.Context, conn net.Conn) (context.Context, error)
+
+// filterConnection runs the accept filter, if any, on the connection.
+// Returns the annotated context, or an error if the connection is rejected.
+func (s *Server) filterConnection(ctx context.Context, clientConn net.Conn) (context.Context, error) {
+	if s.config.AcceptFilter == nil {
+		return ctx, nil
+	}
+	conn := clientConn
+	if tlsConn, ok := clientConn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+
+	annotated, err := s.config.AcceptFilter(ctx, conn)
+	if err != nil {
+		s.sendRejection(ctx, clientConn, RejectFiltered)
+		return nil, fmt.Errorf("connection rejected by the accept filter: %w", err)
+	}
+	if annotated == nil {
+		return ctx, nil
+	}
+	return annotated, nil
+}
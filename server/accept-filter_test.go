@@ -0,0 +1,74 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/rrasulzade/tcp-lb-go/lib"
+	"github.com/rrasulzade/tcp-lb-go/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcceptFilter(t *testing.T) {
+	require := require.New(t)
+
+	pki := newTestPKI(t)
+	client := pki.client(t, "api")
+	lb := lib.NewLoadBalancer(100, 100)
+	lb.AddBackend(&lib.Backend{Address: startEchoBackend(t)})
+	registry := metrics.NewRegistry()
+
+	var blocked, rawConn atomic.Bool
+	var traced atomic.Int64
+	s := startTestServer(t, pki, &ServerConfig{
+		LoadBalancer:         lb,
+		ClientBackendEntries: aclFor(lb, client),
+		Metrics:              metrics.FromRegistry(registry),
+		AcceptFilter: func(ctx context.Context, conn net.Conn) (context.Context, error) {
+			_, isTLS := conn.(*tls.Conn)
+			rawConn.Store(!isTLS)
+			if blocked.Load() {
+				return nil, errors.New("blocklisted")
+			}
+			// Annotate the connection with a tracer counting its routing events
+			return lib.WithTracer(ctx, func(string, ...any) { traced.Add(1) }), nil
+		},
+	})
+
+	// The filter sees the raw connection and annotates it for the load balancer
+	connectClient(t, pki, s, client)
+	require.True(rawConn.Load(), "Expected the filter to be called with the connection under TLS")
+	require.Positive(traced.Load(), "Expected the annotated context to be passed to the load balancer")
+
+	// A connection rejected by the filter is closed before being routed
+	blocked.Store(true)
+	routed := traced.Load()
+	conn, err := pki.dial(s, client)
+	if err == nil {
+		defer conn.Close()
+		require.Error(echo(conn), "Expected the connection to be rejected")
+	}
+	require.Equal(routed, traced.Load())
+	waitFor(t, func() bool {
+		var buf bytes.Buffer
+		registry.Expose(&buf)
+		return bytes.Contains(buf.Bytes(), []byte(`tcplb_rejected_connections_total{reason="filtered"} 1`))
+	}, "Expected the rejection to be counted")
+}
+
+func TestAcceptFilterKeepsContext(t *testing.T) {
+	require := require.New(t)
+
+	s := &Server{config: &ServerConfig{
+		AcceptFilter: func(context.Context, net.Conn) (context.Context, error) { return nil, nil },
+	}}
+	ctx := lib.WithConnectionID(context.Background(), "conn1")
+	filtered, err := s.filterConnection(ctx, nil)
+	require.NoError(err)
+	require.Equal(ctx, filtered)
+}
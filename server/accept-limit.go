@@ -0,0 +1,28 @@
+package server
+
+import (
+	"github.com/rrasulzade/tcp-lb-go/lib"
+)
+
+// newAcceptLimiter creates the token bucket limiting the rate of accepted
+// connections, or returns nil if the rate is not limited.
+func newAcceptLimiter(rate, burst uint64) *lib.TokenBucket {
+	if rate == 0 {
+		return nil
+	}
+	if burst == 0 {
+		burst = rate
+	}
+	return lib.NewTokenBucket(burst, rate, nil)
+}
+
+// acceptRateLimited reports whether a new connection is closed right away,
+// before its TLS handshake, because the listener accepts connections
+// faster than its accept rate limit.
+func (s *Server) acceptRateLimited() bool {
+	if s.acceptLimiter == nil || s.acceptLimiter.Allow() {
+		return false
+	}
+	s.metrics.acceptRateLimited.Inc()
+	return true
+}
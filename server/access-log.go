@@ -0,0 +1,28 @@
+package server
+
+import (
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/accesslog"
+	"github.com/rrasulzade/tcp-lb-go/lib"
+)
+
+// recordAccess completes the access log entry of a routed connection
+// with the report of the load balancer and the error routing ended with,
+// and records it.
+func (s *Server) recordAccess(entry accesslog.Entry, report lib.ConnectionReport, err error) {
+	entry.Time = time.Now()
+	entry.Backend, entry.Pool = report.Backend, report.Pool
+	switch {
+	case report.Transferred:
+		entry.Reason = report.Reason.String()
+	case err != nil:
+		entry.Reason = "error"
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if err := s.config.AccessLog.Record(entry); err != nil {
+		s.logger.Errorf("[conn %s] Unable to record connection to the access log: %v", entry.ConnectionID, err)
+	}
+}
@@ -0,0 +1,372 @@
+package server
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/lib"
+)
+
+// maxACLSnapshots is the number of replaced access control lists kept to
+// roll back to.
+const maxACLSnapshots = 10
+
+// ErrNoACLSnapshot is returned when rolling back the access control list
+// while no list was replaced.
+var ErrNoACLSnapshot = errors.New("no access control list to roll back to")
+
+// ACLSnapshot is an access control list replaced by an import.
+type ACLSnapshot struct {
+	// ReplacedAt is the time the list was replaced.
+	ReplacedAt time.Time `json:"replaced_at"`
+
+	// ACL is the replaced list, which must not be modified.
+	ACL map[string][]string `json:"acl"`
+}
+
+// clientACL is an access control list as configured along with
+// its compiled form used to authorize clients.
+type clientACL struct {
+	// entries maps a client ID to its configured entries.
+	entries map[string][]string
+
+	// tiers maps a client ID to its ordered allowed backend sets.
+	tiers map[string][]map[string]struct{}
+}
+
+// ACLChange describes how the entries of a client changed.
+type ACLChange struct {
+	// Added are the entries only present in the new list.
+	Added []string `json:"added,omitempty"`
+
+	// Removed are the entries only present in the old list.
+	Removed []string `json:"removed,omitempty"`
+
+	// Reordered is set if the lists hold the same entries in a different
+	// order, which changes the order in which backend sets are tried.
+	Reordered bool `json:"reordered,omitempty"`
+}
+
+// ACLDiff describes the differences between two access control lists.
+type ACLDiff struct {
+	// AddedClients maps the clients only present in the new list to their entries.
+	AddedClients map[string][]string `json:"added_clients,omitempty"`
+
+	// RemovedClients are the clients only present in the old list.
+	RemovedClients []string `json:"removed_clients,omitempty"`
+
+	// ChangedClients maps the clients present in both lists
+	// whose entries differ to their changes.
+	ChangedClients map[string]ACLChange `json:"changed_clients,omitempty"`
+}
+
+// Empty reports whether the lists are identical.
+func (d ACLDiff) Empty() bool {
+	return len(d.AddedClients) == 0 && len(d.RemovedClients) == 0 && len(d.ChangedClients) == 0
+}
+
+// DiffACL compares the old and new access control lists.
+func DiffACL(old, new map[string][]string) ACLDiff {
+	var diff ACLDiff
+	for clientID, entries := range new {
+		oldEntries, exists := old[clientID]
+		if !exists {
+			if diff.AddedClients == nil {
+				diff.AddedClients = make(map[string][]string)
+			}
+			diff.AddedClients[clientID] = entries
+			continue
+		}
+		if slices.Equal(oldEntries, entries) {
+			continue
+		}
+
+		change := ACLChange{
+			Added:   difference(entries, oldEntries),
+			Removed: difference(oldEntries, entries),
+		}
+		change.Reordered = len(change.Added) == 0 && len(change.Removed) == 0
+		if diff.ChangedClients == nil {
+			diff.ChangedClients = make(map[string]ACLChange)
+		}
+		diff.ChangedClients[clientID] = change
+	}
+	for clientID := range old {
+		if _, exists := new[clientID]; !exists {
+			diff.RemovedClients = append(diff.RemovedClients, clientID)
+		}
+	}
+	sort.Strings(diff.RemovedClients)
+	return diff
+}
+
+// difference returns the entries of a that are not in b.
+func difference(a, b []string) []string {
+	var entries []string
+	for _, entry := range a {
+		if !slices.Contains(b, entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// authorizeClient returns the allowed backend sets of the client, falling
+// back to the access of their previous certificate for clients presenting
+// a certificate rotated within CertRolloverWindow, then to
+// UnknownClientBackends for clients missing from the access control list.
+// Authorizations found in the access control list are reused for clients
+// reconnecting within AuthorizationCacheTTL. The issuance time of the
+// client certificate starts its rotation grace window, and the connection
+// ID prefixes the logged events.
+func (s *Server) authorizeClient(connectionID, clientID, commonName string, issuedAt time.Time) ([]map[string]struct{}, error) {
+	acl := s.acl.Load()
+	now := time.Now()
+	if s.authorizations != nil {
+		if allowedBackends, ok := s.authorizations.get(clientID, acl, now); ok {
+			s.metrics.authorizationCache.With("hit").Inc()
+			return allowedBackends, nil
+		}
+		s.metrics.authorizationCache.With("miss").Inc()
+	}
+
+	allowedBackends, err := AuthorizeClientTiers(clientID, acl.tiers)
+	if err == nil {
+		if s.authorizations != nil {
+			s.authorizations.put(clientID, acl, allowedBackends, now)
+		}
+		if s.rollover != nil {
+			s.rollover.authorize(clientID, commonName)
+		}
+		return allowedBackends, nil
+	}
+	if s.rollover != nil {
+		if previousID, ok := s.rollover.tolerate(connectionID, clientID, commonName, issuedAt, now); ok {
+			if allowedBackends, err := AuthorizeClientTiers(previousID, acl.tiers); err == nil {
+				s.logger.Debugf("[conn %s] Client %s with CN=%s is granted the access of its previous certificate %s", connectionID, clientID, commonName, previousID)
+				s.metrics.certRollovers.Inc()
+				return allowedBackends, nil
+			}
+		}
+	}
+	if s.config.UnknownClientBackends == nil {
+		return nil, err
+	}
+
+	s.warnSampled("unknown client "+clientID, "[conn %s] Client %s with CN=%s is not listed in the access control list, granting default access", connectionID, clientID, commonName)
+	s.metrics.unknownClients.Inc()
+	return s.config.UnknownClientBackends, nil
+}
+
+// ClientBackendACL returns a copy of the access control list in effect.
+func (s *Server) ClientBackendACL() map[string][]string {
+	entries := s.acl.Load().entries
+	acl := make(map[string][]string, len(entries))
+	for clientID, clientEntries := range entries {
+		acl[clientID] = slices.Clone(clientEntries)
+	}
+	return acl
+}
+
+// DiffClientBackendACL compares the access control list in effect with acl.
+func (s *Server) DiffClientBackendACL(acl map[string][]string) ACLDiff {
+	return DiffACL(s.acl.Load().entries, acl)
+}
+
+// SetClientBackendACL atomically replaces the access control list in
+// effect with acl, whose entries must already be validated and canonical,
+// and returns the differences with the replaced list. The replaced list is
+// kept as a snapshot to roll back to. Connections already established are
+// not affected.
+func (s *Server) SetClientBackendACL(acl map[string][]string) (ACLDiff, error) {
+	if len(acl) == 0 {
+		return ACLDiff{}, errors.New("access control list configuration is required")
+	}
+
+	s.aclMu.Lock()
+	defer s.aclMu.Unlock()
+
+	return s.setACLLocked(acl), nil
+}
+
+// SetClientACLEntries atomically sets the entries of a single client in
+// the access control list in effect, leaving the other clients as they
+// are even if the list is replaced concurrently, and returns the
+// differences with the replaced list. The resulting list is passed to
+// validate, if not nil, which may rewrite its entries into their
+// canonical form, before it is put in effect. The replaced list is kept
+// as a snapshot to roll back to.
+func (s *Server) SetClientACLEntries(clientID string, entries []string, validate func(acl map[string][]string) error) (ACLDiff, error) {
+	if clientID == "" || len(entries) == 0 {
+		return ACLDiff{}, errors.New("client ID and access control list entries are required")
+	}
+
+	s.aclMu.Lock()
+	defer s.aclMu.Unlock()
+
+	current := s.acl.Load().entries
+	acl := make(map[string][]string, len(current)+1)
+	for id, clientEntries := range current {
+		acl[id] = slices.Clone(clientEntries)
+	}
+	acl[clientID] = slices.Clone(entries)
+	if validate != nil {
+		if err := validate(acl); err != nil {
+			return ACLDiff{}, err
+		}
+	}
+	return s.setACLLocked(acl), nil
+}
+
+// setACLLocked puts acl in effect, keeping the replaced list as a snapshot
+// if they differ, and returns their differences. The caller must hold
+// s.aclMu.
+func (s *Server) setACLLocked(acl map[string][]string) ACLDiff {
+	replaced := s.acl.Load()
+	diff := s.replaceACL(newClientACL(acl))
+	if !diff.Empty() {
+		s.aclSnapshots = append(s.aclSnapshots, ACLSnapshot{
+			ReplacedAt: time.Now(),
+			ACL:        replaced.entries,
+		})
+		if len(s.aclSnapshots) > maxACLSnapshots {
+			s.aclSnapshots = slices.Delete(s.aclSnapshots, 0, len(s.aclSnapshots)-maxACLSnapshots)
+		}
+	}
+	return diff
+}
+
+// RollbackClientBackendACL atomically restores the access control list
+// replaced by the last import, discarding its snapshot, and returns the
+// differences with the list it replaces. Repeated rollbacks restore older
+// lists. Returns ErrNoACLSnapshot if no list was replaced.
+func (s *Server) RollbackClientBackendACL() (ACLDiff, error) {
+	s.aclMu.Lock()
+	defer s.aclMu.Unlock()
+
+	if len(s.aclSnapshots) == 0 {
+		return ACLDiff{}, ErrNoACLSnapshot
+	}
+	snapshot := s.aclSnapshots[len(s.aclSnapshots)-1]
+	s.aclSnapshots = s.aclSnapshots[:len(s.aclSnapshots)-1]
+	return s.replaceACL(newClientACL(snapshot.ACL)), nil
+}
+
+// ACLSnapshots returns the lists replaced by imports that can be rolled
+// back to, newest first.
+func (s *Server) ACLSnapshots() []ACLSnapshot {
+	s.aclMu.Lock()
+	defer s.aclMu.Unlock()
+
+	snapshots := make([]ACLSnapshot, len(s.aclSnapshots))
+	for i, snapshot := range s.aclSnapshots {
+		snapshots[len(snapshots)-1-i] = snapshot
+	}
+	return snapshots
+}
+
+// replaceACL puts the compiled list in effect and returns the differences
+// with the replaced one. The caller must hold s.aclMu.
+func (s *Server) replaceACL(compiled *clientACL) ACLDiff {
+	diff := DiffACL(s.acl.Load().entries, compiled.entries)
+	s.acl.Store(compiled)
+	if s.authorizations != nil {
+		s.authorizations.clear()
+	}
+	return diff
+}
+
+// newClientACL copies and compiles the access control list.
+func newClientACL(acl map[string][]string) *clientACL {
+	entries := make(map[string][]string, len(acl))
+	for clientID, clientEntries := range acl {
+		entries[clientID] = slices.Clone(clientEntries)
+	}
+	return &clientACL{
+		entries: entries,
+		tiers:   BuildClientBackendACL(entries),
+	}
+}
+
+// legacyClientACL compiles an access control list of a single allowed
+// backends set per client, keeping the set as is. Its entries are the
+// sorted set members, so that it can be exported and diffed, while an
+// import or rollback of them is compiled like any other list.
+func legacyClientACL(acl map[string]map[string]struct{}) *clientACL {
+	compiled := &clientACL{
+		entries: make(map[string][]string, len(acl)),
+		tiers:   make(map[string][]map[string]struct{}, len(acl)),
+	}
+	for clientID, allowedBackends := range acl {
+		entries := make([]string, 0, len(allowedBackends))
+		for entry := range allowedBackends {
+			entries = append(entries, entry)
+		}
+		sort.Strings(entries)
+		compiled.entries[clientID] = entries
+		compiled.tiers[clientID] = []map[string]struct{}{maps.Clone(allowedBackends)}
+	}
+	return compiled
+}
+
+// BuildClientBackendACL converts an access control list into ordered
+// lists of allowed backend sets. A pool reference forms its own set,
+// matching any backend in the pool including the ones discovered at
+// runtime, while consecutive backend addresses are grouped into a single set.
+// Deny entries are added to every set, so that they take precedence over
+// the allow entries regardless of their position. Identical sets are
+// shared between clients and must not be modified.
+func BuildClientBackendACL(acl map[string][]string) map[string][]map[string]struct{} {
+	clientBackendACL := make(map[string][]map[string]struct{}, len(acl))
+	interned := make(map[string]map[string]struct{})
+	for clientID, entries := range acl {
+		var tiers []map[string]struct{}
+		var addresses map[string]struct{}
+		var denied []string
+		for _, entry := range entries {
+			if strings.HasPrefix(entry, lib.DenyPrefix) {
+				denied = append(denied, entry)
+				continue
+			}
+			if strings.HasPrefix(entry, lib.PoolPrefix) {
+				tiers = append(tiers, map[string]struct{}{entry: {}})
+				addresses = nil
+				continue
+			}
+
+			if addresses == nil {
+				addresses = make(map[string]struct{})
+				tiers = append(tiers, addresses)
+			}
+			addresses[entry] = struct{}{}
+		}
+		for i, tier := range tiers {
+			for _, entry := range denied {
+				tier[entry] = struct{}{}
+			}
+			tiers[i] = internSet(interned, tier)
+		}
+		clientBackendACL[clientID] = tiers
+	}
+	return clientBackendACL
+}
+
+// internSet returns the set in interned equal to set, adding set if none.
+func internSet(interned map[string]map[string]struct{}, set map[string]struct{}) map[string]struct{} {
+	entries := make([]string, 0, len(set))
+	for entry := range set {
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+	// Entries are addresses and pool names, which contain no newline
+	key := strings.Join(entries, "\n")
+	if existing, ok := interned[key]; ok {
+		return existing
+	}
+	interned[key] = set
+	return set
+}
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/rrasulzade/tcp-lb-go/lib"
+	"github.com/rrasulzade/tcp-lb-go/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffACL(t *testing.T) {
+	require := require.New(t)
+
+	old := map[string][]string{
+		"kept":      {"pool:api"},
+		"removed":   {"pool:api"},
+		"changed":   {"pool:api", "pool:batch"},
+		"reordered": {"pool:api", "pool:batch"},
+	}
+	new := map[string][]string{
+		"kept":      {"pool:api"},
+		"added":     {"pool:batch"},
+		"changed":   {"pool:api", "pool:web"},
+		"reordered": {"pool:batch", "pool:api"},
+	}
+
+	diff := DiffACL(old, new)
+	require.Equal(ACLDiff{
+		AddedClients:   map[string][]string{"added": {"pool:batch"}},
+		RemovedClients: []string{"removed"},
+		ChangedClients: map[string]ACLChange{
+			"changed":   {Added: []string{"pool:web"}, Removed: []string{"pool:batch"}},
+			"reordered": {Reordered: true},
+		},
+	}, diff)
+	require.False(diff.Empty())
+	require.True(DiffACL(old, old).Empty())
+}
+
+func TestSetClientBackendACL(t *testing.T) {
+	require := require.New(t)
+
+	pki := newTestPKI(t)
+	existing := pki.client(t, "existing")
+	imported := pki.client(t, "imported")
+	lb := lib.NewLoadBalancer(100, 100)
+	lb.AddBackend(&lib.Backend{Address: startEchoBackend(t)})
+	s := startTestServer(t, pki, &ServerConfig{
+		LoadBalancer:         lb,
+		ClientBackendEntries: aclFor(lb, existing),
+	})
+	established := connectClient(t, pki, s, existing)
+
+	// The exported list is a copy
+	exported := s.ClientBackendACL()
+	require.Equal(aclFor(lb, existing), exported)
+	exported[existing.id][0] = "modified"
+	require.Equal(aclFor(lb, existing), s.ClientBackendACL())
+
+	_, err := s.SetClientBackendACL(nil)
+	require.Error(err)
+
+	// The imported list authorizes new connections only
+	acl := aclFor(lb, imported)
+	require.Equal(ACLDiff{
+		AddedClients:   acl,
+		RemovedClients: []string{existing.id},
+	}, s.DiffClientBackendACL(acl))
+	diff, err := s.SetClientBackendACL(acl)
+	require.NoError(err)
+	require.Equal([]string{existing.id}, diff.RemovedClients)
+	require.Equal(acl, s.ClientBackendACL())
+
+	connectClient(t, pki, s, imported)
+	require.NoError(echo(established), "Expected established connections to be unaffected")
+	conn, err := pki.dial(s, existing)
+	require.NoError(err)
+	defer conn.Close()
+	require.Error(echo(conn), "Expected the removed client to be denied")
+}
+
+func TestUnknownClientBackends(t *testing.T) {
+	require := require.New(t)
+
+	pki := newTestPKI(t)
+	listed := pki.client(t, "listed")
+	unknown := pki.client(t, "unknown")
+	lb := lib.NewLoadBalancer(100, 100)
+	lb.AddBackend(&lib.Backend{Address: startEchoBackend(t), Pool: "default"})
+	registry := metrics.NewRegistry()
+
+	// Clients missing from the access control list are denied by default
+	s := startTestServer(t, pki, &ServerConfig{
+		LoadBalancer:         lb,
+		ClientBackendEntries: aclFor(lb, listed),
+	})
+	conn, err := pki.dial(s, unknown)
+	require.NoError(err)
+	defer conn.Close()
+	require.Error(echo(conn), "Expected the unknown client to be denied")
+
+	// Or granted the default access
+	s = startTestServer(t, pki, &ServerConfig{
+		LoadBalancer:          lb,
+		ClientBackendEntries:  aclFor(lb, listed),
+		UnknownClientBackends: []map[string]struct{}{{lib.PoolKey("default"): {}}},
+		Metrics:               metrics.FromRegistry(registry),
+	})
+	connectClient(t, pki, s, unknown)
+	connectClient(t, pki, s, listed)
+
+	var buf bytes.Buffer
+	registry.Expose(&buf)
+	require.Contains(buf.String(), "tcplb_unknown_client_connections_total 1\n")
+}
+
+func TestRollbackClientBackendACL(t *testing.T) {
+	require := require.New(t)
+
+	initial := map[string][]string{"client1": {"pool:api"}}
+	s, err := NewServer(&ServerConfig{
+		Address:              "127.0.0.1:0",
+		LoadBalancer:         lib.NewLoadBalancer(100, 100),
+		TLSConfig:            newTestPKI(t).serverTLSConfig(),
+		AllowedClients:       map[string]bool{"api": true},
+		ClientBackendEntries: initial,
+	})
+	require.NoError(err)
+
+	_, err = s.RollbackClientBackendACL()
+	require.ErrorIs(err, ErrNoACLSnapshot)
+
+	// Imports without changes are not snapshotted
+	_, err = s.SetClientBackendACL(initial)
+	require.NoError(err)
+	require.Empty(s.ACLSnapshots())
+
+	imported := map[string][]string{"client2": {"pool:api"}}
+	_, err = s.SetClientBackendACL(imported)
+	require.NoError(err)
+	updated := map[string][]string{"client2": {"pool:api", "pool:batch"}}
+	_, err = s.SetClientBackendACL(updated)
+	require.NoError(err)
+	snapshots := s.ACLSnapshots()
+	require.Len(snapshots, 2)
+	require.Equal(imported, snapshots[0].ACL)
+	require.Equal(initial, snapshots[1].ACL)
+
+	// Repeated rollbacks restore older lists
+	diff, err := s.RollbackClientBackendACL()
+	require.NoError(err)
+	require.Equal(ACLDiff{ChangedClients: map[string]ACLChange{"client2": {Removed: []string{"pool:batch"}}}}, diff)
+	require.Equal(imported, s.ClientBackendACL())
+	_, err = s.RollbackClientBackendACL()
+	require.NoError(err)
+	require.Equal(initial, s.ClientBackendACL())
+	_, err = s.RollbackClientBackendACL()
+	require.ErrorIs(err, ErrNoACLSnapshot)
+
+	// Only the last maxACLSnapshots lists are kept
+	for i := 0; i <= maxACLSnapshots; i++ {
+		_, err = s.SetClientBackendACL(map[string][]string{fmt.Sprintf("client%d", i): {"pool:api"}})
+		require.NoError(err)
+	}
+	snapshots = s.ACLSnapshots()
+	require.Len(snapshots, maxACLSnapshots)
+	require.Equal(map[string][]string{"client0": {"pool:api"}}, snapshots[len(snapshots)-1].ACL)
+}
+
+func TestSetClientACLEntries(t *testing.T) {
+	require := require.New(t)
+
+	s, err := NewServer(&ServerConfig{
+		Address:              "127.0.0.1:0",
+		LoadBalancer:         lib.NewLoadBalancer(100, 100),
+		TLSConfig:            newTestPKI(t).serverTLSConfig(),
+		AllowedClients:       map[string]bool{"api": true},
+		ClientBackendEntries: map[string][]string{"client1": {"pool:api"}},
+	})
+	require.NoError(err)
+
+	_, err = s.SetClientACLEntries("client2", nil, nil)
+	require.Error(err)
+
+	// The entries of the other clients are kept, including those of a
+	// list imported in the meantime
+	imported := map[string][]string{"client3": {"pool:api"}}
+	_, err = s.SetClientBackendACL(imported)
+	require.NoError(err)
+	diff, err := s.SetClientACLEntries("client2", []string{"web"}, func(acl map[string][]string) error {
+		acl["client2"] = []string{"pool:web"}
+		return nil
+	})
+	require.NoError(err)
+	require.Equal(map[string][]string{"client2": {"pool:web"}}, diff.AddedClients)
+	require.Equal(map[string][]string{"client2": {"pool:web"}, "client3": {"pool:api"}}, s.ClientBackendACL())
+
+	// A list failing validation is not put in effect
+	_, err = s.SetClientACLEntries("client4", []string{"pool:unknown"}, func(map[string][]string) error {
+		return errors.New("unknown pool")
+	})
+	require.EqualError(err, "unknown pool")
+	require.NotContains(s.ClientBackendACL(), "client4")
+
+	// The replaced list can be rolled back to
+	require.Len(s.ACLSnapshots(), 2)
+	_, err = s.RollbackClientBackendACL()
+	require.NoError(err)
+	require.Equal(imported, s.ClientBackendACL())
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/rrasulzade/tcp-lb-go/agent"
+	"github.com/rrasulzade/tcp-lb-go/health"
+)
+
+// AgentStatus returns the availability and weight reported to agent
+// clients, given the latest health report. A draining server reports
+// drain and an unhealthy one down. Otherwise the weight is the share of
+// the global connection limit still available, halved when degraded.
+func (s *Server) AgentStatus(report health.Report) agent.Status {
+	if !s.Ready() {
+		return agent.Status{State: agent.StateDrain}
+	}
+
+	if report.Status == health.StatusUnhealthy {
+		return agent.Status{State: agent.StateDown, Message: unhealthyChecks(report)}
+	}
+
+	weight := 100
+	if s.config.MaxConnections > 0 {
+		s.connsMu.Lock()
+		admitted := s.admitted
+		s.connsMu.Unlock()
+		weight = max(100-admitted*100/s.config.MaxConnections, 0)
+	}
+	if report.Status == health.StatusDegraded {
+		weight /= 2
+	}
+	return agent.Status{State: agent.StateUp, Weight: weight}
+}
+
+// unhealthyChecks returns the names of the unhealthy checks of the report.
+func unhealthyChecks(report health.Report) string {
+	var names []string
+	for _, result := range report.Checks {
+		if result.Status == health.StatusUnhealthy {
+			names = append(names, result.Name)
+		}
+	}
+	return "unhealthy checks: " + strings.Join(names, ", ")
+}
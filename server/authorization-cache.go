@@ -0,0 +1,101 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// maxCachedAuthorizations bounds the number of clients whose
+// authorization is cached at the same time.
+const maxCachedAuthorizations = 10000
+
+// cachedAuthorization is the authorization of a client computed from an
+// access control list.
+type cachedAuthorization struct {
+	// acl is the access control list the authorization was computed from.
+	acl *clientACL
+
+	// allowedBackends are the allowed backend sets of the client.
+	allowedBackends []map[string]struct{}
+
+	// expires is the time after which the authorization is recomputed.
+	expires time.Time
+}
+
+// authorizationCache remembers the allowed backend sets of recently
+// authorized clients, so that a client reconnecting shortly after with
+// the same certificate skips the access control list lookup. Entries are
+// keyed by client ID, which is derived from the certificate's CommonName
+// and serial number, and are ignored once the access control list they
+// were computed from is replaced.
+type authorizationCache struct {
+	// ttl is the time an authorization is reused for.
+	ttl time.Duration
+
+	// mu ensures concurrent access to the entries map.
+	mu sync.Mutex
+
+	// entries maps a client ID to its cached authorization.
+	entries map[string]cachedAuthorization
+}
+
+// newAuthorizationCache creates an authorizationCache reusing
+// authorizations for ttl, or returns nil if ttl is not positive.
+func newAuthorizationCache(ttl time.Duration) *authorizationCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &authorizationCache{
+		ttl:     ttl,
+		entries: make(map[string]cachedAuthorization),
+	}
+}
+
+// get returns the cached allowed backend sets of the client if they were
+// computed from acl and have not expired.
+func (c *authorizationCache) get(clientID string, acl *clientACL, now time.Time) ([]map[string]struct{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[clientID]
+	if !ok {
+		return nil, false
+	}
+	if entry.acl != acl || !now.Before(entry.expires) {
+		delete(c.entries, clientID)
+		return nil, false
+	}
+	return entry.allowedBackends, true
+}
+
+// put caches the allowed backend sets of the client computed from acl.
+// Expired entries are purged when the cache is full, and nothing is
+// cached if it remains full.
+func (c *authorizationCache) put(clientID string, acl *clientACL, allowedBackends []map[string]struct{}, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.entries[clientID]; !exists && len(c.entries) >= maxCachedAuthorizations {
+		for id, entry := range c.entries {
+			if entry.acl != acl || !now.Before(entry.expires) {
+				delete(c.entries, id)
+			}
+		}
+		if len(c.entries) >= maxCachedAuthorizations {
+			return
+		}
+	}
+	c.entries[clientID] = cachedAuthorization{
+		acl:             acl,
+		allowedBackends: allowedBackends,
+		expires:         now.Add(c.ttl),
+	}
+}
+
+// clear removes every cached authorization.
+func (c *authorizationCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	clear(c.entries)
+}
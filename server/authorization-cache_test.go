@@ -0,0 +1,94 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/lib"
+	"github.com/rrasulzade/tcp-lb-go/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthorizationCache(t *testing.T) {
+	require := require.New(t)
+
+	acl := newClientACL(map[string][]string{"client1": {"pool:api"}})
+	cache := newAuthorizationCache(time.Minute)
+	now := time.Now()
+
+	_, ok := cache.get("client1", acl, now)
+	require.False(ok)
+
+	cache.put("client1", acl, acl.tiers["client1"], now)
+	allowedBackends, ok := cache.get("client1", acl, now.Add(30*time.Second))
+	require.True(ok)
+	require.Equal(acl.tiers["client1"], allowedBackends)
+
+	// A client ID of another certificate misses
+	_, ok = cache.get("client2", acl, now)
+	require.False(ok)
+
+	// Expired entries miss and are removed
+	_, ok = cache.get("client1", acl, now.Add(time.Minute))
+	require.False(ok)
+	require.Empty(cache.entries)
+
+	// Entries computed from a replaced list miss
+	cache.put("client1", acl, acl.tiers["client1"], now)
+	_, ok = cache.get("client1", newClientACL(map[string][]string{"client1": {"pool:api"}}), now)
+	require.False(ok)
+
+	require.Nil(newAuthorizationCache(0))
+}
+
+func TestAuthorizationCacheReconnects(t *testing.T) {
+	require := require.New(t)
+
+	registry := metrics.NewRegistry()
+	s, err := NewServer(&ServerConfig{
+		Address:               "127.0.0.1:0",
+		LoadBalancer:          lib.NewLoadBalancer(100, 100),
+		TLSConfig:             newTestPKI(t).serverTLSConfig(),
+		AllowedClients:        map[string]bool{"api": true},
+		ClientBackendEntries:  map[string][]string{"client1": {"pool:api"}, "client2": {"pool:api"}},
+		AuthorizationCacheTTL: time.Minute,
+		Metrics:               metrics.FromRegistry(registry),
+	})
+	require.NoError(err)
+	lookups := func() string {
+		var buf bytes.Buffer
+		registry.Expose(&buf)
+		return buf.String()
+	}
+
+	// A reconnect with the same certificate hits the cache
+	_, err = s.authorizeClient("conn1", "client1", "api", time.Now())
+	require.NoError(err)
+	_, err = s.authorizeClient("conn2", "client1", "api", time.Now())
+	require.NoError(err)
+	require.Contains(lookups(), `tcplb_authorization_cache_lookups_total{result="hit"} 1`)
+	require.Contains(lookups(), `tcplb_authorization_cache_lookups_total{result="miss"} 1`)
+
+	// A different certificate misses
+	_, err = s.authorizeClient("conn3", "client2", "api", time.Now())
+	require.NoError(err)
+	require.Contains(lookups(), `tcplb_authorization_cache_lookups_total{result="miss"} 2`)
+
+	// Replacing the access control list, e.g. by an import, invalidates the cache
+	_, err = s.SetClientBackendACL(map[string][]string{"client2": {"pool:api"}})
+	require.NoError(err)
+	_, err = s.authorizeClient("conn4", "client1", "api", time.Now())
+	require.Error(err, "Expected the removed client to be denied")
+	require.Contains(lookups(), `tcplb_authorization_cache_lookups_total{result="miss"} 3`)
+
+	// As does a rollback
+	_, err = s.authorizeClient("conn5", "client2", "api", time.Now())
+	require.NoError(err)
+	_, err = s.RollbackClientBackendACL()
+	require.NoError(err)
+	_, err = s.authorizeClient("conn6", "client1", "api", time.Now())
+	require.NoError(err)
+	require.Contains(lookups(), `tcplb_authorization_cache_lookups_total{result="miss"} 5`)
+	require.Contains(lookups(), `tcplb_authorization_cache_lookups_total{result="hit"} 1`)
+}
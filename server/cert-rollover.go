@@ -0,0 +1,130 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/logging"
+)
+
+// maxCertRotations bounds the number of rotated certificates tracked at
+// the same time. Rotations whose grace window ended are dropped to make
+// room, and further rotated certificates are tolerated without being
+// logged while the tracked ones are all within their window.
+const maxCertRotations = 10000
+
+// certRollover tolerates clients presenting a rotated certificate, whose
+// client ID changed with its serial number while its CommonName did not,
+// before the access control list lists the new client ID. During the
+// grace window following the issuance of the new certificate, its
+// NotBefore time, the client is granted the access of the client ID last
+// authorized with the same CommonName, so that an old certificate never
+// presented before is not granted a window of its own.
+//
+// The client IDs authorized per CommonName are only learned from
+// connections since the server started, so that a client whose previous
+// certificate did not connect before its rotation is not tolerated.
+type certRollover struct {
+	// window is the grace window of a rotated certificate.
+	window time.Duration
+
+	// logger logs the tolerated rotations.
+	logger *logging.Logger
+
+	// mu ensures concurrent access to the maps.
+	mu sync.Mutex
+
+	// authorized maps a CommonName to the client ID it was last
+	// authorized with by the access control list.
+	authorized map[string]string
+
+	// rotations maps the client ID of a rotated certificate tolerated
+	// within its grace window to its issuance time, so that the rotation
+	// is logged once.
+	rotations map[string]time.Time
+}
+
+// newCertRollover creates a certRollover tolerating rotated certificates
+// for window, or returns nil if window is not positive.
+func newCertRollover(window time.Duration, logger *logging.Logger) *certRollover {
+	if window <= 0 {
+		return nil
+	}
+	return &certRollover{
+		window:     window,
+		logger:     logger,
+		authorized: make(map[string]string),
+		rotations:  make(map[string]time.Time),
+	}
+}
+
+// authorize records that the client with the CommonName was authorized by
+// the access control list, which ends the rotation of its certificate.
+func (r *certRollover) authorize(clientID, commonName string) {
+	if commonName == "" {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.authorized[commonName] = clientID
+	delete(r.rotations, clientID)
+}
+
+// tolerate returns the client ID last authorized with the CommonName if
+// the client presents a certificate issued at issuedAt, rotated within
+// the grace window. The rotation is logged when the rotated certificate
+// first connects, with the ID of the connection.
+func (r *certRollover) tolerate(connectionID, clientID, commonName string, issuedAt, now time.Time) (string, bool) {
+	if commonName == "" || now.Sub(issuedAt) >= r.window {
+		return "", false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previousID, ok := r.authorized[commonName]
+	if !ok || previousID == clientID {
+		return "", false
+	}
+	if _, ok := r.rotations[clientID]; !ok {
+		if len(r.rotations) >= maxCertRotations {
+			r.pruneRotations(now)
+		}
+		if len(r.rotations) < maxCertRotations {
+			r.rotations[clientID] = issuedAt
+			r.logger.Warnf("[conn %s] Certificate of CN=%s rotated from client %s to %s, which is granted the access of %s until %s",
+				connectionID, commonName, previousID, clientID, previousID, issuedAt.Add(r.window).Format(time.RFC3339))
+		}
+	}
+	return previousID, true
+}
+
+// previous returns the client ID last authorized with the CommonName if
+// the client's rotated certificate connected and is within its grace
+// window, without recording a rotation.
+func (r *certRollover) previous(clientID, commonName string, now time.Time) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previousID, ok := r.authorized[commonName]
+	if !ok || previousID == clientID {
+		return "", false
+	}
+	issuedAt, ok := r.rotations[clientID]
+	if !ok || now.Sub(issuedAt) >= r.window {
+		return "", false
+	}
+	return previousID, true
+}
+
+// pruneRotations drops the rotations whose grace window ended. The caller
+// must hold r.mu.
+func (r *certRollover) pruneRotations(now time.Time) {
+	for clientID, issuedAt := range r.rotations {
+		if now.Sub(issuedAt) >= r.window {
+			delete(r.rotations, clientID)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/lib"
+	"github.com/rrasulzade/tcp-lb-go/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertRollover(t *testing.T) {
+	require := require.New(t)
+
+	logs := &logBuffer{}
+	rollover := newCertRollover(time.Minute, logs.logger())
+	now := time.Now()
+	issuedAt := now.Add(-10 * time.Second)
+
+	// Clients whose CommonName was never authorized are not tolerated
+	_, ok := rollover.tolerate("conn1", "rotated", "api", issuedAt, now)
+	require.False(ok)
+
+	rollover.authorize("original", "api")
+	_, ok = rollover.tolerate("conn2", "original", "api", issuedAt, now)
+	require.False(ok, "Expected the authorized certificate not to be a rotation")
+	_, ok = rollover.tolerate("conn3", "rotated", "", issuedAt, now)
+	require.False(ok, "Expected clients without CommonName not to be tolerated")
+
+	// A certificate issued before the grace window is not tolerated, even
+	// if it never connected before
+	_, ok = rollover.tolerate("conn4", "old", "api", now.Add(-time.Hour), now)
+	require.False(ok)
+	_, ok = rollover.previous("old", "api", now)
+	require.False(ok)
+
+	// A rotated certificate is granted the access of the previous one
+	// during the grace window following its issuance
+	previousID, ok := rollover.tolerate("conn5", "rotated", "api", issuedAt, now)
+	require.True(ok)
+	require.Equal("original", previousID)
+	require.Len(logs.lines("[conn conn5] Certificate of CN=api rotated from client original to rotated"), 1)
+
+	previousID, ok = rollover.tolerate("conn6", "rotated", "api", issuedAt, now.Add(30*time.Second))
+	require.True(ok)
+	require.Equal("original", previousID)
+	previousID, ok = rollover.previous("rotated", "api", now.Add(30*time.Second))
+	require.True(ok)
+	require.Equal("original", previousID)
+	require.Len(logs.lines("rotated from client"), 1, "Expected the rotation to be logged once")
+
+	_, ok = rollover.tolerate("conn7", "rotated", "api", issuedAt, issuedAt.Add(time.Minute))
+	require.False(ok, "Expected the grace window to end")
+	_, ok = rollover.previous("rotated", "api", issuedAt.Add(time.Minute))
+	require.False(ok)
+
+	// Authorizing the rotated certificate ends its rotation
+	rollover.authorize("rotated", "api")
+	require.Empty(rollover.rotations)
+	_, ok = rollover.tolerate("conn8", "original", "api", issuedAt, now)
+	require.True(ok, "Expected the certificate last authorized to be the previous one")
+
+	require.Nil(newCertRollover(0, logs.logger()))
+}
+
+func TestCertRolloverPrunesRotations(t *testing.T) {
+	require := require.New(t)
+
+	rollover := newCertRollover(time.Minute, (&logBuffer{}).logger())
+	rollover.authorize("original", "api")
+	now := time.Now()
+	for i := 0; i < maxCertRotations; i++ {
+		rollover.rotations[fmt.Sprintf("expired%d", i)] = now.Add(-time.Hour)
+	}
+
+	// Rotations whose grace window ended make room for new ones
+	_, ok := rollover.tolerate("conn1", "rotated", "api", now, now)
+	require.True(ok)
+	require.Equal(map[string]time.Time{"rotated": now}, rollover.rotations)
+
+	// Rotations within their window are still tolerated once the limit is reached
+	for i := 1; i < maxCertRotations; i++ {
+		rollover.rotations[fmt.Sprintf("recent%d", i)] = now
+	}
+	_, ok = rollover.tolerate("conn2", "untracked", "api", now, now)
+	require.True(ok)
+	require.NotContains(rollover.rotations, "untracked")
+}
+
+func TestCertRolloverAuthorization(t *testing.T) {
+	require := require.New(t)
+
+	registry := metrics.NewRegistry()
+	s, err := NewServer(&ServerConfig{
+		Address:              "127.0.0.1:0",
+		LoadBalancer:         lib.NewLoadBalancer(100, 100),
+		TLSConfig:            newTestPKI(t).serverTLSConfig(),
+		AllowedClients:       map[string]bool{"api": true},
+		ClientBackendEntries: map[string][]string{"original": {"pool:api"}},
+		CertRolloverWindow:   time.Minute,
+		Metrics:              metrics.FromRegistry(registry),
+	})
+	require.NoError(err)
+
+	// The rotated certificate is denied until its CommonName was authorized
+	_, err = s.authorizeClient("conn1", "rotated", "api", time.Now())
+	require.Error(err)
+
+	originalBackends, err := s.authorizeClient("conn2", "original", "api", time.Now())
+	require.NoError(err)
+	allowedBackends, err := s.authorizeClient("conn3", "rotated", "api", time.Now())
+	require.NoError(err)
+	require.Equal(originalBackends, allowedBackends)
+
+	// Certificates issued before the grace window are not
+	_, err = s.authorizeClient("conn4", "old", "api", time.Now().Add(-time.Hour))
+	require.Error(err)
+
+	// Other CommonNames are not granted its access
+	_, err = s.authorizeClient("conn5", "rotated", "web", time.Now())
+	require.Error(err)
+
+	var buf bytes.Buffer
+	registry.Expose(&buf)
+	require.Contains(buf.String(), "tcplb_cert_rollover_connections_total 1\n")
+
+	// Once listed, the rotated certificate is authorized by its own entry
+	_, err = s.SetClientBackendACL(map[string][]string{"rotated": {"pool:web"}})
+	require.NoError(err)
+	allowedBackends, err = s.authorizeClient("conn6", "rotated", "api", time.Now())
+	require.NoError(err)
+	require.Equal([]map[string]struct{}{{lib.PoolKey("web"): {}}}, allowedBackends)
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"sort"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/lib"
+	"github.com/rrasulzade/tcp-lb-go/metrics"
+)
+
+// ClientRate describes the connection rate of a client.
+type ClientRate struct {
+	// ClientID is the ID of the client.
+	ClientID string `json:"client_id"`
+
+	// CommonName is the CommonName of the client's certificate.
+	CommonName string `json:"common_name"`
+
+	lib.RateStats
+
+	// ReconnectStormSince is the time the client's current reconnect
+	// storm began, nil if it is not in one.
+	ReconnectStormSince *time.Time `json:"reconnect_storm_since,omitempty"`
+}
+
+// knownClient is the CommonName a client last connected with, along with
+// the counter of its connections, looked up once per client rather than
+// by its label on every connection.
+type knownClient struct {
+	commonName  string
+	connections metrics.Counter
+}
+
+// recordClientConnection counts an authorized connection of the client
+// in its connection rates and metrics.
+func (s *Server) recordClientConnection(clientID, commonName string) {
+	s.clientsMu.RLock()
+	client, ok := s.clients[clientID]
+	s.clientsMu.RUnlock()
+	if !ok || client.commonName != commonName {
+		client = knownClient{
+			commonName:  commonName,
+			connections: s.metrics.clientConnections.With(commonName),
+		}
+		s.clientsMu.Lock()
+		s.clients[clientID] = client
+		s.clientsMu.Unlock()
+	}
+	s.clientRates.Record(clientID)
+	client.connections.Inc()
+}
+
+// recordClientClose counts a closed connection of the client, opened at
+// the given time, in its connection statistics.
+func (s *Server) recordClientClose(clientID string, openedAt time.Time) {
+	s.clientRates.RecordClose(clientID, time.Since(openedAt))
+}
+
+// clientName returns the CommonName the client last connected with.
+func (s *Server) clientName(clientID string) (string, bool) {
+	s.clientsMu.RLock()
+	defer s.clientsMu.RUnlock()
+
+	client, ok := s.clients[clientID]
+	return client.commonName, ok
+}
+
+// ClientRates returns the rolling and peak connection rates of every
+// client that connected since the start, busiest first.
+func (s *Server) ClientRates() []ClientRate {
+	stats := s.clientRates.Stats()
+	rates := make([]ClientRate, 0, len(stats))
+	for clientID, clientStats := range stats {
+		commonName, _ := s.clientName(clientID)
+		rates = append(rates, ClientRate{
+			ClientID:   clientID,
+			CommonName: commonName,
+			RateStats:  clientStats,
+
+			ReconnectStormSince: s.reconnectStormSince(clientID),
+		})
+	}
+	sort.Slice(rates, func(i, j int) bool {
+		if rates[i].Rate1m != rates[j].Rate1m {
+			return rates[i].Rate1m > rates[j].Rate1m
+		}
+		return rates[i].ClientID < rates[j].ClientID
+	})
+	return rates
+}
+
+// ResetClientRates clears the connection statistics of the client, or of
+// every client if clientID is empty, e.g. to compare them before and after
+// a change. The exposed metrics are not affected. Returns the number of
+// clients reset.
+func (s *Server) ResetClientRates(clientID string) int {
+	return s.clientRates.Reset(clientID)
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"net"
+	"sort"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/lib"
+)
+
+// ConnectionInfo describes an active client connection.
+type ConnectionInfo struct {
+	// ID is the unique connection ID generated at accept time.
+	ID string `json:"id"`
+
+	// RemoteAddr is the client's network address.
+	RemoteAddr string `json:"remote_addr"`
+
+	// ClientID is the client ID, empty until the client is authenticated.
+	ClientID string `json:"client_id,omitempty"`
+
+	// CommonName is the CommonName of the client's certificate.
+	CommonName string `json:"common_name,omitempty"`
+
+	// Tags are the tags attached to the connection by routing rules.
+	Tags map[string]string `json:"tags,omitempty"`
+
+	// Priority is the priority class of the client.
+	Priority int `json:"priority"`
+
+	// JA3 and JA4 are the TLS fingerprints of the client,
+	// empty if fingerprinting is disabled.
+	JA3 string `json:"ja3,omitempty"`
+	JA4 string `json:"ja4,omitempty"`
+
+	// StartedAt is the time the connection was accepted.
+	StartedAt time.Time `json:"started_at"`
+
+	// admitted reports whether the connection counts
+	// against the global connection limit.
+	admitted bool
+
+	// activity tracks the last read or write on the connection.
+	activity *activityConn
+}
+
+// trackConnection registers an active client connection.
+// Returns the generated connection ID.
+func (s *Server) trackConnection(conn net.Conn) string {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+
+	connectionID := lib.NewConnectionID()
+	s.conns[conn] = &ConnectionInfo{
+		ID:         connectionID,
+		RemoteAddr: conn.RemoteAddr().String(),
+		StartedAt:  time.Now(),
+	}
+	s.metrics.accepted.Inc()
+	s.metrics.active.Inc()
+	return connectionID
+}
+
+// untrackConnection removes a finished client connection.
+func (s *Server) untrackConnection(conn net.Conn) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+
+	info, ok := s.conns[conn]
+	if !ok {
+		return
+	}
+	for tag, value := range info.Tags {
+		s.metrics.taggedActive.With(tag, value).Dec()
+	}
+	if info.admitted {
+		s.admitted--
+	}
+	s.metrics.active.Dec()
+	delete(s.conns, conn)
+}
+
+// identifyConnection records the identity and tags of an authorized connection.
+func (s *Server) identifyConnection(conn net.Conn, clientID, commonName string, tags map[string]string) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+
+	info, ok := s.conns[conn]
+	if !ok {
+		return
+	}
+	// The address may come from a PROXY protocol header read since
+	info.RemoteAddr = conn.RemoteAddr().String()
+	info.ClientID = clientID
+	info.CommonName = commonName
+	info.Tags = tags
+	for tag, value := range tags {
+		s.metrics.taggedTotal.With(tag, value).Inc()
+		s.metrics.taggedActive.With(tag, value).Inc()
+	}
+}
+
+// Connections returns a snapshot of the active client connections,
+// oldest first.
+func (s *Server) Connections() []ConnectionInfo {
+	s.connsMu.Lock()
+	connections := make([]ConnectionInfo, 0, len(s.conns))
+	for _, info := range s.conns {
+		connections = append(connections, *info)
+	}
+	s.connsMu.Unlock()
+
+	sort.Slice(connections, func(i, j int) bool {
+		return connections[i].StartedAt.Before(connections[j].StartedAt)
+	})
+	return connections
+}
+
+// Connection returns the active client connection with the ID, e.g. one
+// found in the logs, to follow it while it is open.
+func (s *Server) Connection(id string) (ConnectionInfo, bool) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+
+	for _, info := range s.conns {
+		if info.ID == id {
+			return *info, true
+		}
+	}
+	return ConnectionInfo{}, false
+}
+
+// activeConnections returns the number of active client connections.
+func (s *Server) activeConnections() int {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+
+	return len(s.conns)
+}
+
+// closeConnections force-closes all active client connections
+// and returns the number of connections closed.
+func (s *Server) closeConnections() int {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+
+	for conn := range s.conns {
+		conn.Close()
+	}
+	return len(s.conns)
+}
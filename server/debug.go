@@ -0,0 +1,189 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/capture"
+	"github.com/rrasulzade/tcp-lb-go/lib"
+)
+
+// maxDebugDuration bounds the duration of a debug session so that a
+// forgotten session does not keep verbose logging enabled.
+const maxDebugDuration = time.Hour
+
+// ErrUnknownDebugSession is returned when stopping a debug session that does not exist.
+var ErrUnknownDebugSession = errors.New("unknown debug session")
+
+// DebugSession traces the connections of a single client in detail for a
+// limited time, without enabling verbose logging for every connection.
+type DebugSession struct {
+	// ID identifies the session in logs and the admin API.
+	ID string `json:"id"`
+
+	// ClientID selects the connections of the client with this ID.
+	ClientID string `json:"client_id,omitempty"`
+
+	// CommonName selects the connections of clients with this CommonName.
+	CommonName string `json:"common_name,omitempty"`
+
+	// ExpiresAt is the time the session ends.
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// Capture enables recording the data of the traced connections in
+	// the capture directory, to be replayed later.
+	Capture bool `json:"capture"`
+}
+
+// matches reports whether the session selects the client.
+func (d DebugSession) matches(clientID, commonName string) bool {
+	return (d.ClientID != "" && d.ClientID == clientID) ||
+		(d.CommonName != "" && d.CommonName == commonName)
+}
+
+// StartDebug starts tracing the connections of the client with the given
+// ID or CommonName for the given duration, at most maxDebugDuration.
+// If capture is set, the data of the connections is recorded as well.
+func (s *Server) StartDebug(clientID, commonName string, duration time.Duration, capture bool) (DebugSession, error) {
+	if (clientID == "") == (commonName == "") {
+		return DebugSession{}, errors.New("exactly one of client ID or CommonName is required")
+	}
+	if duration <= 0 || duration > maxDebugDuration {
+		return DebugSession{}, fmt.Errorf("debug duration must be positive and at most %s", maxDebugDuration)
+	}
+	if capture && s.config.CaptureDir == "" {
+		return DebugSession{}, errors.New("capture directory is not configured")
+	}
+
+	session := DebugSession{
+		ID:         lib.NewConnectionID(),
+		ClientID:   clientID,
+		CommonName: commonName,
+		ExpiresAt:  time.Now().Add(duration),
+		Capture:    capture,
+	}
+
+	s.debugMu.Lock()
+	defer s.debugMu.Unlock()
+
+	s.debugSessions[session.ID] = session
+	s.logger.Infof("[debug %s] Started debugging client (id=%s cn=%s capture=%t) until %s",
+		session.ID, clientID, commonName, capture, session.ExpiresAt.Format(time.RFC3339))
+	return session, nil
+}
+
+// StopDebug ends a debug session before it expires.
+func (s *Server) StopDebug(id string) error {
+	s.debugMu.Lock()
+	defer s.debugMu.Unlock()
+
+	if _, ok := s.debugSessions[id]; !ok {
+		return fmt.Errorf("%w '%s'", ErrUnknownDebugSession, id)
+	}
+	delete(s.debugSessions, id)
+	s.logger.Infof("[debug %s] Stopped debugging client", id)
+	return nil
+}
+
+// DebugSessions returns the active debug sessions sorted by expiry.
+func (s *Server) DebugSessions() []DebugSession {
+	s.debugMu.Lock()
+	defer s.debugMu.Unlock()
+
+	s.pruneDebugSessions()
+	sessions := make([]DebugSession, 0, len(s.debugSessions))
+	for _, session := range s.debugSessions {
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].ExpiresAt.Before(sessions[j].ExpiresAt)
+	})
+	return sessions
+}
+
+// debugSession returns the active debug session selecting the client, if any.
+func (s *Server) debugSession(clientID, commonName string) (DebugSession, bool) {
+	s.debugMu.Lock()
+	defer s.debugMu.Unlock()
+
+	s.pruneDebugSessions()
+	for _, session := range s.debugSessions {
+		if session.matches(clientID, commonName) {
+			return session, true
+		}
+	}
+	return DebugSession{}, false
+}
+
+// pruneDebugSessions removes the expired debug sessions.
+// The caller must hold debugMu.
+func (s *Server) pruneDebugSessions() {
+	now := time.Now()
+	for id, session := range s.debugSessions {
+		if now.After(session.ExpiresAt) {
+			delete(s.debugSessions, id)
+			s.logger.Infof("[debug %s] Debug session expired", id)
+		}
+	}
+}
+
+// startCapture creates the capture file of a debugged connection and
+// returns the connection recording its data, and a function closing the file.
+func (s *Server) startCapture(conn net.Conn, session DebugSession, connectionID string) (net.Conn, func() error, error) {
+	path := filepath.Join(s.config.CaptureDir, fmt.Sprintf("%s-%s.ndjson", session.ID, connectionID))
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create capture file: %w", err)
+	}
+	return capture.NewConn(conn, capture.NewWriter(file)), file.Close, nil
+}
+
+// countingConn counts the bytes and operations in each direction of a
+// debugged client connection.
+type countingConn struct {
+	net.Conn
+
+	// bytesRead and reads count the data received from the client.
+	bytesRead atomic.Int64
+	reads     atomic.Int64
+
+	// bytesWritten and writes count the data sent to the client.
+	bytesWritten atomic.Int64
+	writes       atomic.Int64
+}
+
+// Read implements net.Conn.
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.bytesRead.Add(int64(n))
+	c.reads.Add(1)
+	return n, err
+}
+
+// Write implements net.Conn.
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.bytesWritten.Add(int64(n))
+	c.writes.Add(1)
+	return n, err
+}
+
+// CloseWrite half-closes the underlying connection if supported.
+func (c *countingConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// String summarizes the counted transfer.
+func (c *countingConn) String() string {
+	return fmt.Sprintf("received %d bytes in %d reads, sent %d bytes in %d writes",
+		c.bytesRead.Load(), c.reads.Load(), c.bytesWritten.Load(), c.writes.Load())
+}
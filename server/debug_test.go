@@ -0,0 +1,118 @@
+package server
+
+import (
+	"bytes"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/lib"
+	"github.com/rrasulzade/tcp-lb-go/logging"
+	"github.com/stretchr/testify/require"
+)
+
+// logBuffer collects the messages logged by a test server.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// Write implements io.Writer.
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// lines returns the logged lines containing substr.
+func (b *logBuffer) lines(substr string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var lines []string
+	for _, line := range strings.Split(b.buf.String(), "\n") {
+		if strings.Contains(line, substr) {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// logger returns a logger writing to the buffer.
+func (b *logBuffer) logger() *logging.Logger {
+	return logging.New(slog.NewTextHandler(b, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+func TestStartDebug(t *testing.T) {
+	require := require.New(t)
+
+	pki := newTestPKI(t)
+	s := startTestServer(t, pki, &ServerConfig{ClientBackendEntries: map[string][]string{"client": {"pool:default"}}})
+
+	_, err := s.StartDebug("client", "api", time.Minute, false)
+	require.ErrorContains(err, "exactly one of client ID or CommonName is required")
+	_, err = s.StartDebug("client", "", 2*time.Hour, false)
+	require.ErrorContains(err, "debug duration must be positive")
+	_, err = s.StartDebug("client", "", time.Minute, true)
+	require.ErrorContains(err, "capture directory is not configured")
+
+	// Expired sessions are pruned
+	expiring, err := s.StartDebug("client", "", 20*time.Millisecond, false)
+	require.NoError(err)
+	session, err := s.StartDebug("", "api", time.Minute, false)
+	require.NoError(err)
+	require.Equal([]DebugSession{expiring, session}, s.DebugSessions())
+	waitFor(t, func() bool { return len(s.DebugSessions()) == 1 }, "Expected the expired session to be pruned")
+
+	require.NoError(s.StopDebug(session.ID))
+	require.Empty(s.DebugSessions())
+	require.ErrorIs(s.StopDebug(session.ID), ErrUnknownDebugSession)
+}
+
+func TestDebugSession(t *testing.T) {
+	require := require.New(t)
+
+	pki := newTestPKI(t)
+	debugged := pki.client(t, "debugged")
+	other := pki.client(t, "other")
+	logs := &logBuffer{}
+	lb := lib.NewLoadBalancer(100, 100)
+	lb.AddBackend(&lib.Backend{Address: startEchoBackend(t)})
+	s := startTestServer(t, pki, &ServerConfig{
+		LoadBalancer:         lb,
+		ClientBackendEntries: aclFor(lb, debugged, other),
+		CaptureDir:           t.TempDir(),
+		Logger:               logs.logger(),
+	})
+
+	session, err := s.StartDebug("", "debugged", time.Minute, true)
+	require.NoError(err)
+	tag := "[debug " + session.ID + "]"
+
+	// Only the connections of the debugged client are traced
+	connectClient(t, pki, s, other).Close()
+	connectClient(t, pki, s, debugged).Close()
+	waitFor(t, func() bool { return len(logs.lines("connection closed after")) == 1 }, "Expected the debugged connection to be traced until closed")
+
+	traced := logs.lines(tag)
+	require.NotEmpty(traced)
+	for _, line := range traced {
+		require.NotContains(line, other.id)
+	}
+	require.Len(logs.lines(tag+" client CN=debugged id="+debugged.id), 1)
+	require.Contains(logs.lines("connection closed after")[0], "received 4 bytes")
+
+	// Its data is captured
+	captures, err := filepath.Glob(filepath.Join(s.config.CaptureDir, session.ID+"-*.ndjson"))
+	require.NoError(err)
+	require.Len(captures, 1)
+
+	// Connections are no longer traced once the session stopped
+	require.NoError(s.StopDebug(session.ID))
+	connectClient(t, pki, s, debugged).Close()
+	waitFor(t, func() bool { return s.activeConnections() == 0 }, "Expected the connections to be closed")
+	require.Len(logs.lines("connection closed after"), 1)
+}
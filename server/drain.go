@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// drainProgressInterval is the time between two drain progress reports.
+const drainProgressInterval = time.Second
+
+// ErrDrainInProgress is returned when a drain is requested while
+// the server is already draining.
+var ErrDrainInProgress = errors.New("server is already draining")
+
+// DrainPhase is a stage of a server drain.
+type DrainPhase string
+
+// define drain phases.
+const (
+	// DrainNotReady waits for the readiness delay so that orchestration
+	// stops sending new traffic before the listener is closed.
+	DrainNotReady DrainPhase = "not_ready"
+
+	// DrainWaiting waits for the active connections to finish.
+	DrainWaiting DrainPhase = "waiting"
+
+	// DrainCompleted reports that all connections finished.
+	DrainCompleted DrainPhase = "completed"
+
+	// DrainTimedOut reports that connections remained after the timeout.
+	DrainTimedOut DrainPhase = "timed_out"
+)
+
+// DrainProgress reports the progress of a server drain.
+type DrainProgress struct {
+	// Phase is the current stage of the drain.
+	Phase DrainPhase `json:"phase"`
+
+	// ActiveAtStart is the number of active connections when the listener was closed.
+	ActiveAtStart int `json:"active_at_start"`
+
+	// Active is the number of connections still active.
+	Active int `json:"active"`
+
+	// Elapsed is the time since the drain began.
+	Elapsed string `json:"elapsed"`
+}
+
+// Ready reports whether the server accepts new traffic,
+// i.e. it is neither draining nor shut down.
+func (s *Server) Ready() bool {
+	return !s.draining.Load() && !s.shutdown.Load()
+}
+
+// Drain prepares the server to be stopped, e.g. from an orchestration
+// preStop hook. It immediately reports the server as not ready, waits
+// for readinessDelay so that new traffic is no longer routed to it, then
+// stops accepting connections and waits up to timeout for the active ones
+// to finish. Remaining connections are left open for Stop to handle.
+// Canceling ctx before the listener is closed makes the server ready again.
+// progress, if not nil, is called when a phase begins and periodically
+// while waiting. Returns the final progress.
+func (s *Server) Drain(
+	ctx context.Context,
+	readinessDelay, timeout time.Duration,
+	progress func(DrainProgress),
+) (DrainProgress, error) {
+	if !s.draining.CompareAndSwap(false, true) {
+		return DrainProgress{}, ErrDrainInProgress
+	}
+
+	start := time.Now()
+	current := DrainProgress{Phase: DrainNotReady, Active: s.activeConnections()}
+	report := func() {
+		current.Elapsed = time.Since(start).Round(time.Millisecond).String()
+		if progress != nil {
+			progress(current)
+		}
+	}
+	report()
+
+	select {
+	case <-time.After(readinessDelay):
+	case <-ctx.Done():
+		// The listener is still open, so the server can become ready again
+		s.draining.Store(false)
+		return current, ctx.Err()
+	}
+
+	// Stop accepting new connections
+	s.shutdown.Store(true)
+	s.listener.Close()
+	s.closeListeners()
+
+	current.Phase = DrainWaiting
+	current.ActiveAtStart = s.activeConnections()
+	current.Active = current.ActiveAtStart
+	report()
+
+	ticker := time.NewTicker(drainProgressInterval)
+	defer ticker.Stop()
+	deadline := time.After(timeout)
+
+	for current.Active > 0 {
+		select {
+		case <-ticker.C:
+			current.Active = s.activeConnections()
+			if current.Active > 0 {
+				report()
+			}
+		case <-deadline:
+			current.Phase = DrainTimedOut
+			current.Active = s.activeConnections()
+			report()
+			s.logger.Warnf("Drain timed out with %d active connections", current.Active)
+			return current, nil
+		case <-ctx.Done():
+			return current, ctx.Err()
+		}
+	}
+
+	current.Phase = DrainCompleted
+	report()
+	s.logger.Infof("Drain completed, %d connections finished", current.ActiveAtStart)
+	return current, nil
+}
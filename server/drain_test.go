@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/lib"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrain(t *testing.T) {
+	pki := newTestPKI(t)
+	client := pki.client(t, "api")
+	newServer := func(t *testing.T) *Server {
+		lb := lib.NewLoadBalancer(100, 100)
+		lb.AddBackend(&lib.Backend{Address: startEchoBackend(t)})
+		return startTestServer(t, pki, &ServerConfig{
+			LoadBalancer:         lb,
+			ClientBackendEntries: aclFor(lb, client),
+		})
+	}
+
+	t.Run("Wait for active connections", func(t *testing.T) {
+		require := require.New(t)
+		s := newServer(t)
+		conn := connectClient(t, pki, s, client)
+
+		var mu sync.Mutex
+		var phases []DrainPhase
+		var readyWhileNotReady bool
+		progress := func(p DrainProgress) {
+			mu.Lock()
+			defer mu.Unlock()
+			if p.Phase == DrainNotReady {
+				readyWhileNotReady = s.Ready()
+			}
+			phases = append(phases, p.Phase)
+		}
+
+		type result struct {
+			final DrainProgress
+			err   error
+		}
+		done := make(chan result)
+		go func() {
+			final, err := s.Drain(context.Background(), 50*time.Millisecond, time.Minute, progress)
+			done <- result{final, err}
+		}()
+
+		// Readiness flips before the listener is closed
+		waitFor(t, func() bool { return !s.Ready() }, "Expected the server to report not ready")
+		mu.Lock()
+		require.False(readyWhileNotReady, "Expected readiness to flip first")
+		mu.Unlock()
+
+		// New connections are refused once the listener is closed
+		waitFor(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(phases) == 2
+		}, "Expected the drain to wait for the active connections")
+		_, err := pki.dial(s, client)
+		require.Error(err, "Expected new connections to be refused")
+
+		// The drain waits for the active connection
+		require.NoError(echo(conn))
+		select {
+		case <-done:
+			require.Fail("Expected the drain to wait for the active connection")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		conn.Close()
+		select {
+		case r := <-done:
+			require.NoError(r.err)
+			require.Equal(DrainCompleted, r.final.Phase)
+			require.Equal(1, r.final.ActiveAtStart)
+			require.Zero(r.final.Active)
+		case <-time.After(5 * time.Second):
+			require.Fail("Expected the drain to complete once the connection ended")
+		}
+		mu.Lock()
+		require.Equal([]DrainPhase{DrainNotReady, DrainWaiting, DrainCompleted}, phases)
+		mu.Unlock()
+
+		_, err = s.Drain(context.Background(), 0, time.Second, nil)
+		require.ErrorIs(err, ErrDrainInProgress)
+	})
+
+	t.Run("Time out", func(t *testing.T) {
+		require := require.New(t)
+		s := newServer(t)
+		conn := connectClient(t, pki, s, client)
+
+		start := time.Now()
+		final, err := s.Drain(context.Background(), 0, 100*time.Millisecond, nil)
+		require.NoError(err)
+		require.Equal(DrainTimedOut, final.Phase)
+		require.Equal(1, final.Active)
+		require.Less(time.Since(start), 5*time.Second)
+
+		// Remaining connections are left open for Stop
+		require.NoError(echo(conn))
+	})
+
+	t.Run("Cancel before the listener is closed", func(t *testing.T) {
+		require := require.New(t)
+		s := newServer(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+		_, err := s.Drain(ctx, time.Minute, time.Minute, nil)
+		require.ErrorIs(err, context.Canceled)
+		require.True(s.Ready())
+		connectClient(t, pki, s, client)
+	})
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/lib"
+)
+
+// define the sources of the allowed backend sets of a client.
+const (
+	// AuthorizationACL is reported for clients listed in the access control list.
+	AuthorizationACL = "acl"
+
+	// AuthorizationUnknownClient is reported for clients missing from the
+	// access control list that are granted UnknownClientBackends.
+	AuthorizationUnknownClient = "unknown_client"
+
+	// AuthorizationCertRollover is reported for clients presenting a
+	// certificate rotated within CertRolloverWindow, which are granted
+	// the access of their previous certificate.
+	AuthorizationCertRollover = "cert_rollover"
+
+	// AuthorizationAnonymous is reported for clients presenting no
+	// certificate, which are granted AnonymousBackends.
+	AuthorizationAnonymous = "anonymous"
+)
+
+// RouteExplanation describes how a new connection of a client would be
+// routed in the current state, see lib.LoadBalancer.ExplainSelection.
+type RouteExplanation struct {
+	// ClientID is the ID of the client.
+	ClientID string `json:"client_id"`
+
+	// Authorization tells where the allowed backend sets of the client
+	// come from: AuthorizationACL, AuthorizationCertRollover,
+	// AuthorizationUnknownClient or AuthorizationAnonymous.
+	Authorization string `json:"authorization"`
+
+	// AllowedBackends are the entries of the client's allowed backend
+	// sets, in the order they are tried.
+	AllowedBackends [][]string `json:"allowed_backends"`
+
+	// Pin is the backend the client is pinned to, tried before its
+	// allowed backend sets, see Server.PinClient.
+	Pin *ClientPin `json:"pin,omitempty"`
+
+	// HashKey is the key the connection is consistently hashed on, the
+	// client ID or source IP, empty without consistent hashing.
+	HashKey string `json:"hash_key,omitempty"`
+
+	lib.SelectionExplanation
+}
+
+// ExplainRoute evaluates which backend a new connection of the client
+// from the source IP would be routed to and why, without routing a
+// connection or counting it in any statistic. The source IP is only used
+// by consistent hashing with HashBySourceIP. Returns an error if the
+// client would be rejected as unauthorized.
+func (s *Server) ExplainRoute(clientID, sourceIP string) (*RouteExplanation, error) {
+	explanation := &RouteExplanation{ClientID: clientID, HashKey: clientID}
+	if s.config.HashBySourceIP {
+		explanation.HashKey = sourceIP
+	}
+
+	var allowedBackends []map[string]struct{}
+	if strings.HasPrefix(clientID, "anonymous:") {
+		if s.config.AnonymousBackends == nil {
+			return nil, errors.New("clients presenting no certificate are not admitted")
+		}
+		explanation.Authorization = AuthorizationAnonymous
+		allowedBackends = s.config.AnonymousBackends
+	} else {
+		// Bypass authorizeClient, whose cache and metrics would count
+		// the lookup as a connection
+		var err error
+		explanation.Authorization = AuthorizationACL
+		allowedBackends, err = AuthorizeClientTiers(clientID, s.acl.Load().tiers)
+		if err != nil && s.rollover != nil {
+			if commonName, ok := s.clientName(clientID); ok {
+				if previousID, ok := s.rollover.previous(clientID, commonName, time.Now()); ok {
+					if previousBackends, previousErr := AuthorizeClientTiers(previousID, s.acl.Load().tiers); previousErr == nil {
+						explanation.Authorization = AuthorizationCertRollover
+						allowedBackends, err = previousBackends, nil
+					}
+				}
+			}
+		}
+		if err != nil {
+			if s.config.UnknownClientBackends == nil {
+				return nil, err
+			}
+			explanation.Authorization = AuthorizationUnknownClient
+			allowedBackends = s.config.UnknownClientBackends
+		}
+	}
+
+	allowedBackends, explanation.Pin = s.pinBackends("", clientID, allowedBackends)
+
+	explanation.AllowedBackends = make([][]string, len(allowedBackends))
+	for i, allowed := range allowedBackends {
+		entries := make([]string, 0, len(allowed))
+		for entry := range allowed {
+			entries = append(entries, entry)
+		}
+		sort.Strings(entries)
+		explanation.AllowedBackends[i] = entries
+	}
+	explanation.SelectionExplanation = s.config.LoadBalancer.ExplainSelection(explanation.HashKey, allowedBackends...)
+	if !s.config.LoadBalancer.ConsistentHashing() {
+		explanation.HashKey = ""
+	}
+	return explanation, nil
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+
+	"github.com/rrasulzade/tcp-lb-go/fingerprint"
+	"github.com/rrasulzade/tcp-lb-go/listen"
+)
+
+// fingerprintListener wraps accepted connections to record their ClientHello.
+type fingerprintListener struct {
+	net.Listener
+}
+
+// Accept implements net.Listener.
+func (l fingerprintListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return fingerprint.NewConn(conn), nil
+}
+
+// listen creates a TLS listener of the server on the "tcp" or "unix"
+// network, reading the PROXY protocol header of connections when
+// accepted, and recording the clients' ClientHello when fingerprinting
+// is enabled. In sidecar mode, the listener is plain, see listenSidecar.
+func (s *Server) listen(network, address string, options listen.SocketOptions) (net.Listener, error) {
+	if s.config.Sidecar {
+		return s.listenSidecar(network, address, options)
+	}
+	listener, err := listen.ListenNetwork(network, address, s.config.ListenRetry, options)
+	if err != nil {
+		return nil, err
+	}
+	if s.config.AcceptProxyProtocol {
+		listener = proxyListener{Listener: listener, instanceID: s.config.InstanceID}
+	}
+	if s.config.Fingerprinting {
+		listener = fingerprintListener{listener}
+	}
+	return tls.NewListener(listener, s.config.TLSConfig), nil
+}
+
+// tlsFingerprints are the TLS fingerprints of a client.
+type tlsFingerprints struct {
+	JA3 string
+	JA4 string
+}
+
+// String formats the fingerprints for logging, or returns an
+// empty string if they are unknown.
+func (f tlsFingerprints) String() string {
+	if f.JA4 == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (ja3=%s ja4=%s)", f.JA3, f.JA4)
+}
+
+// recordFingerprints computes the TLS fingerprints of the client once its
+// ClientHello was read and records them on the connection and in metrics.
+// Returns empty fingerprints if fingerprinting is disabled.
+func (s *Server) recordFingerprints(clientConn net.Conn) tlsFingerprints {
+	tlsConn, ok := clientConn.(*tls.Conn)
+	if !ok {
+		return tlsFingerprints{}
+	}
+	conn, ok := tlsConn.NetConn().(*fingerprint.Conn)
+	if !ok {
+		return tlsFingerprints{}
+	}
+	hello, err := conn.ClientHello()
+	if err != nil {
+		return tlsFingerprints{}
+	}
+
+	fingerprints := tlsFingerprints{JA3: hello.JA3(), JA4: hello.JA4()}
+	s.metrics.fingerprints.With(fingerprints.JA4).Inc()
+
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+
+	if info, ok := s.conns[clientConn]; ok {
+		info.JA3 = fingerprints.JA3
+		info.JA4 = fingerprints.JA4
+	}
+	return fingerprints
+}
+
+// checkFingerprints verifies the client's TLS fingerprints against the
+// allowed and denied fingerprints. A fingerprint list entry may be
+// either a JA3 or a JA4 fingerprint.
+func (s *Server) checkFingerprints(fingerprints tlsFingerprints) error {
+	if !s.config.Fingerprinting {
+		return nil
+	}
+
+	for _, fp := range []string{fingerprints.JA3, fingerprints.JA4} {
+		if _, denied := s.config.DeniedFingerprints[fp]; denied && fp != "" {
+			return fmt.Errorf("TLS fingerprint %s is denied", fp)
+		}
+	}
+	if len(s.config.AllowedFingerprints) == 0 {
+		return nil
+	}
+	for _, fp := range []string{fingerprints.JA3, fingerprints.JA4} {
+		if _, allowed := s.config.AllowedFingerprints[fp]; allowed && fp != "" {
+			return nil
+		}
+	}
+	return fmt.Errorf("TLS fingerprint%s is not allowed", fingerprints)
+}
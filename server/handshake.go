@@ -0,0 +1,28 @@
+package server
+
+// beginHandshake waits until fewer than MaxConcurrentHandshakes TLS
+// handshakes are in progress, bounding the CPU spent on handshakes in
+// line with the processors available. Waiting handshakes count towards
+// the handshake backlog of the overload score. The returned function
+// must be called once the handshake completed. Returns false if the
+// server stopped while waiting.
+func (s *Server) beginHandshake() (func(), bool) {
+	backlogDone := func() {}
+	if s.overload != nil {
+		backlogDone = s.overload.HandshakeStarted()
+	}
+	if s.handshakeSlots == nil {
+		return backlogDone, true
+	}
+
+	select {
+	case s.handshakeSlots <- struct{}{}:
+	case <-s.ctx.Done():
+		backlogDone()
+		return nil, false
+	}
+	return func() {
+		<-s.handshakeSlots
+		backlogDone()
+	}, true
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/health"
+)
+
+// probeTimeout bounds the time the accept loop has to pick up a probe connection.
+const probeTimeout = 2 * time.Second
+
+// baseGoroutines is the number of goroutines allowed on top of
+// the ones expected for the active connections.
+const baseGoroutines = 1000
+
+// goroutinesPerConnection is the number of goroutines expected per
+// active connection: the handler and the two copy directions.
+const goroutinesPerConnection = 3
+
+// RegisterHealthChecks registers the server's self checks: listener
+// alive, accept loop responsive, goroutine count sane and, if shedding is
+// enabled, listener not overloaded.
+// If maxGoroutines is zero, the limit is derived from the active connections.
+func (s *Server) RegisterHealthChecks(checker *health.Checker, maxGoroutines int) {
+	checker.Register("accept_loop", s.checkAcceptLoop)
+	checker.Register("goroutines", func() (health.Status, string) {
+		return s.checkGoroutines(maxGoroutines)
+	})
+	if s.overload != nil {
+		checker.Register("overload", s.checkOverload)
+	}
+}
+
+// checkAcceptLoop verifies that the listener is alive and the accept
+// loop picks up a probe connection in time.
+func (s *Server) checkAcceptLoop() (health.Status, string) {
+	// A drained listener is closed on purpose and must not
+	// get the process restarted before it is stopped
+	if s.draining.Load() {
+		return health.StatusOK, "server is draining"
+	}
+	if s.shutdown.Load() {
+		return health.StatusUnhealthy, "server is shutting down"
+	}
+	if s.listener == nil {
+		return health.StatusUnhealthy, "listener is not initialized"
+	}
+
+	// Hold the probe lock while dialing so that the accept loop can
+	// recognize the probe connection before it is registered
+	s.probeMu.Lock()
+	conn, err := net.DialTimeout("tcp", s.listener.Addr().String(), probeTimeout)
+	if err != nil {
+		s.probeMu.Unlock()
+		return health.StatusUnhealthy, fmt.Sprintf("listener is not accepting connections: %v", err)
+	}
+	defer conn.Close()
+
+	accepted := make(chan struct{})
+	probeAddr := conn.LocalAddr().String()
+	s.probes[probeAddr] = accepted
+	s.probeMu.Unlock()
+
+	defer func() {
+		s.probeMu.Lock()
+		delete(s.probes, probeAddr)
+		s.probeMu.Unlock()
+	}()
+
+	start := time.Now()
+	select {
+	case <-accepted:
+		return health.StatusOK, fmt.Sprintf("probe accepted in %s", time.Since(start))
+	case <-time.After(probeTimeout):
+		return health.StatusUnhealthy, "accept loop did not pick up the probe connection"
+	}
+}
+
+// isProbe reports whether the accepted connection is a health probe
+// and, if so, signals the prober.
+func (s *Server) isProbe(conn net.Conn) bool {
+	s.probeMu.Lock()
+	defer s.probeMu.Unlock()
+
+	accepted, ok := s.probes[conn.RemoteAddr().String()]
+	if ok {
+		close(accepted)
+		delete(s.probes, conn.RemoteAddr().String())
+	}
+	return ok
+}
+
+// checkGoroutines verifies that the goroutine count is in line with
+// the number of active connections, which would otherwise indicate a leak.
+func (s *Server) checkGoroutines(maxGoroutines int) (health.Status, string) {
+	limit := maxGoroutines
+	if limit <= 0 {
+		limit = baseGoroutines + goroutinesPerConnection*s.activeConnections()
+	}
+
+	count := runtime.NumGoroutine()
+	message := fmt.Sprintf("%d goroutines, limit %d", count, limit)
+	if count > limit {
+		return health.StatusDegraded, message
+	}
+	return health.StatusOK, message
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/rrasulzade/tcp-lb-go/lib"
+	"github.com/rrasulzade/tcp-lb-go/listen"
+)
+
+// Listener defines an additional listener of the server. It accepts the
+// same mutual TLS connections as the main listener, over TCP or a Unix
+// socket, unless it identifies its clients by their peer credentials, and
+// only routes them to its own pools, so that one server replaces several
+// proxies.
+type Listener struct {
+	// Network is "tcp" or "unix".
+	Network string
+
+	// Address is the TCP address, or the path of the Unix socket.
+	Address string
+
+	// Pools restricts the connections to the backends of these pools
+	// among those allowed for the client, by the pool entries of its
+	// allowed backend sets naming them; address entries do not apply.
+	// Connections may be routed to any allowed backend if empty.
+	Pools []string
+
+	// PeerCredentials accepts plain connections on a Unix socket instead
+	// of TLS, identifying clients by the credentials of their process,
+	// see PeerCredentials.ClientIDs. Only supported on Linux.
+	PeerCredentials bool
+
+	// SocketOptions tune the listening socket, e.g. its backlog.
+	SocketOptions listen.SocketOptions
+
+	// RateLimitKey overrides ServerConfig.RateLimitKey for the
+	// connections of the listener if not nil.
+	RateLimitKey []RateLimitKeyPart
+}
+
+// listenerPolicy holds how the connections accepted on a listener are
+// handled.
+type listenerPolicy struct {
+	// pools restricts the connections to the backends of these pools,
+	// nil if they may be routed to any allowed backend.
+	pools map[string]struct{}
+
+	// peerCredentials identifies clients by the credentials of their
+	// process rather than TLS.
+	peerCredentials bool
+
+	// rateLimitKey lists the connection attributes the rate limiter is
+	// keyed on.
+	rateLimitKey []RateLimitKeyPart
+}
+
+// policy returns the policy of the listener's connections, defaulting
+// the settings it does not override to those of the server.
+func (l Listener) policy(config *ServerConfig) *listenerPolicy {
+	policy := &listenerPolicy{
+		peerCredentials: l.PeerCredentials,
+		rateLimitKey:    config.RateLimitKey,
+	}
+	if len(l.Pools) > 0 {
+		policy.pools = make(map[string]struct{}, len(l.Pools))
+		for _, pool := range l.Pools {
+			policy.pools[pool] = struct{}{}
+		}
+	}
+	if l.RateLimitKey != nil {
+		policy.rateLimitKey = l.RateLimitKey
+	}
+	return policy
+}
+
+// startListeners listens on the additional listeners and starts accepting
+// their connections. The listeners opened are closed if one fails.
+func (s *Server) startListeners() error {
+	for _, config := range s.config.Listeners {
+		var listener net.Listener
+		var err error
+		if config.PeerCredentials {
+			listener, err = s.listenPeers(config.Network, config.Address, config.SocketOptions)
+		} else {
+			listener, err = s.listen(config.Network, config.Address, config.SocketOptions)
+		}
+		if err != nil {
+			s.closeListeners()
+			return fmt.Errorf("unable to initialize %s listener on %s: %w", config.Network, config.Address, err)
+		}
+		s.listeners = append(s.listeners, listener)
+
+		s.wg.Add(1)
+		go s.acceptConnections(listener, config.Address, config.policy(s.config))
+	}
+	return nil
+}
+
+// closeListeners closes the additional listeners.
+func (s *Server) closeListeners() {
+	for _, listener := range s.listeners {
+		listener.Close()
+	}
+}
+
+// restrictToPools returns the allowed backend sets narrowed to the
+// backends of the pools. Only the sets' entries allowing one of these
+// pools are kept, along with their deny entries, so that backends joining
+// other pools at runtime are never allowed. Address entries are dropped,
+// as they allow a backend whichever pool it is registered in. Sets left
+// without an allow entry are removed, and sets that only allow the pools
+// are returned as is.
+func restrictToPools(allowedBackends []map[string]struct{}, pools map[string]struct{}) []map[string]struct{} {
+	restricted := make([]map[string]struct{}, 0, len(allowedBackends))
+	for _, allowed := range allowedBackends {
+		kept, narrowed := 0, false
+		for entry := range allowed {
+			switch {
+			case strings.HasPrefix(entry, lib.DenyPrefix):
+			case inPools(entry, pools):
+				kept++
+			default:
+				narrowed = true
+			}
+		}
+		if kept == 0 {
+			continue
+		}
+		if !narrowed {
+			restricted = append(restricted, allowed)
+			continue
+		}
+
+		set := make(map[string]struct{}, kept)
+		for entry := range allowed {
+			if strings.HasPrefix(entry, lib.DenyPrefix) || inPools(entry, pools) {
+				set[entry] = struct{}{}
+			}
+		}
+		restricted = append(restricted, set)
+	}
+	return restricted
+}
+
+// inPools reports whether the allowed backends entry allows one of the pools.
+func inPools(entry string, pools map[string]struct{}) bool {
+	pool, ok := strings.CutPrefix(entry, lib.PoolPrefix)
+	if !ok {
+		return false
+	}
+	_, ok = pools[pool]
+	return ok
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+
+	"github.com/rrasulzade/tcp-lb-go/lib"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestrictToPools(t *testing.T) {
+	require := require.New(t)
+
+	pools := map[string]struct{}{"web": {}}
+	only := map[string]struct{}{lib.PoolKey("web"): {}, lib.DenyKey("127.0.0.1:5001"): {}}
+	mixed := map[string]struct{}{lib.PoolKey("web"): {}, lib.PoolKey("batch"): {}, "127.0.0.1:5002": {}}
+	other := map[string]struct{}{lib.PoolKey("batch"): {}, "127.0.0.1:5003": {}}
+
+	// Sets only allowing the listener's pools are kept as is, and other
+	// sets are narrowed to them or removed
+	restricted := restrictToPools([]map[string]struct{}{only, mixed, other}, pools)
+	require.Len(restricted, 2)
+	require.Equal(only, restricted[0])
+	require.Equal(map[string]struct{}{lib.PoolKey("web"): {}}, restricted[1])
+	require.Len(mixed, 3)
+
+	require.Empty(restrictToPools([]map[string]struct{}{other}, pools))
+}
+
+func TestListenerPools(t *testing.T) {
+	require := require.New(t)
+
+	pki := newTestPKI(t)
+	client := pki.client(t, "api")
+	lb := lib.NewLoadBalancer(100, 100)
+	web := startEchoBackend(t)
+	lb.AddBackend(&lib.Backend{Address: web, Pool: "web"})
+	s := startTestServer(t, pki, &ServerConfig{
+		LoadBalancer:         lb,
+		ClientBackendEntries: map[string][]string{client.id: {lib.PoolKey("web"), lib.PoolKey("batch")}},
+		Listeners:            []Listener{{Network: "tcp", Address: "127.0.0.1:0", Pools: []string{"batch"}}},
+	})
+	dial := func() (net.Conn, error) {
+		return tls.Dial("tcp", s.listeners[0].Addr().String(), &tls.Config{
+			Certificates: []tls.Certificate{client.cert},
+			RootCAs:      pki.pool,
+		})
+	}
+
+	// The client is allowed the web pool, but the listener only routes
+	// to the batch pool
+	conn, err := dial()
+	require.NoError(err)
+	require.Error(echo(conn))
+	conn.Close()
+
+	// Backends joining the listener's pools are selected
+	batch := startEchoBackend(t)
+	lb.AddBackend(&lib.Backend{Address: batch, Pool: "batch"})
+	conn, err = dial()
+	require.NoError(err)
+	defer conn.Close()
+	require.NoError(echo(conn))
+	require.Equal(int64(1), lb.Backends()[1].ConnectionCount())
+}
@@ -0,0 +1,12 @@
+package server
+
+// warnSampled logs a warning logged for every connection, e.g. its
+// error, sampled by the key if LogSampling is set so that a misbehaving
+// client cannot flood the logs.
+func (s *Server) warnSampled(key, format string, args ...any) {
+	if s.sampler == nil {
+		s.logger.Warnf(format, args...)
+		return
+	}
+	s.sampler.Warnf(key, format, args...)
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"github.com/rrasulzade/tcp-lb-go/metrics"
+)
+
+// serverMetrics holds the metrics recorded by the server.
+type serverMetrics struct {
+	// accepted counts accepted client connections.
+	accepted metrics.Counter
+
+	// active is the number of active client connections.
+	active metrics.Gauge
+
+	// rejected counts rejected client connections per reason.
+	rejected metrics.CounterVec
+
+	// preempted counts connections closed to make room
+	// for higher-priority connections.
+	preempted metrics.Counter
+
+	// taggedTotal counts authorized connections per tag and value.
+	taggedTotal metrics.CounterVec
+
+	// taggedActive is the number of active connections per tag and value.
+	taggedActive metrics.GaugeVec
+
+	// fingerprints counts client connections per JA4 TLS fingerprint.
+	fingerprints metrics.CounterVec
+
+	// clientConnections counts authorized connections per client CommonName.
+	clientConnections metrics.CounterVec
+
+	// reconnectStorms counts reconnect storms per client CommonName.
+	reconnectStorms metrics.CounterVec
+
+	// reconnectStorming is 1 while a client is in a reconnect storm, per
+	// client CommonName.
+	reconnectStorming metrics.GaugeVec
+
+	// shed counts connections closed right after being accepted
+	// because the listener was overloaded.
+	shed metrics.Counter
+
+	// shedRequested counts connections closed right after being accepted
+	// because of the shed percentage set through the admin API.
+	shedRequested metrics.Counter
+
+	// shedPercent is the percentage of new connections shed regardless
+	// of overload.
+	shedPercent metrics.Gauge
+
+	// acceptRateLimited counts connections closed right after being
+	// accepted because the accept rate limit was exceeded.
+	acceptRateLimited metrics.Counter
+
+	// unknownClients counts connections of clients missing from the
+	// access control list that were granted default access.
+	unknownClients metrics.Counter
+
+	// certRollovers counts connections of clients presenting a rotated
+	// certificate that were granted the access of their previous one.
+	certRollovers metrics.Counter
+
+	// authorizationCache counts authorization cache lookups per result.
+	authorizationCache metrics.CounterVec
+}
+
+// newServerMetrics registers the server metrics with the provided Metrics.
+func newServerMetrics(r metrics.Metrics) *serverMetrics {
+	return &serverMetrics{
+		accepted: r.Counter("tcplb_accepted_connections_total",
+			"Total number of accepted client connections.").With(),
+		active: r.Gauge("tcplb_active_connections",
+			"Number of active client connections.").With(),
+		rejected: r.Counter("tcplb_rejected_connections_total",
+			"Total number of rejected client connections by reason.", "reason"),
+		preempted: r.Counter("tcplb_preempted_connections_total",
+			"Total number of idle connections closed for higher-priority clients.").With(),
+		taggedTotal: r.Counter("tcplb_tagged_connections_total",
+			"Total number of authorized client connections by tag.", "tag", "value"),
+		taggedActive: r.Gauge("tcplb_tagged_active_connections",
+			"Number of active client connections by tag.", "tag", "value"),
+		fingerprints: r.Counter("tcplb_tls_fingerprint_connections_total",
+			"Total number of client connections by JA4 TLS fingerprint.", "ja4"),
+		clientConnections: r.Counter("tcplb_client_connections_total",
+			"Total number of authorized client connections by client CommonName.", "client"),
+		reconnectStorms: r.Counter("tcplb_client_reconnect_storms_total",
+			"Total number of reconnect storms by client CommonName.", "client"),
+		reconnectStorming: r.Gauge("tcplb_client_reconnect_storm",
+			"Whether a client is in a reconnect storm (1) or not (0) by client CommonName.", "client"),
+		shed: r.Counter("tcplb_shed_connections_total",
+			"Total number of new connections closed before their TLS handshake because the listener was overloaded.").With(),
+		shedRequested: r.Counter("tcplb_requested_shed_connections_total",
+			"Total number of new connections closed before their TLS handshake because of the requested shed percentage.").With(),
+		shedPercent: r.Gauge("tcplb_shed_percent",
+			"Percentage of new connections shed regardless of overload, as requested through the admin API.").With(),
+		acceptRateLimited: r.Counter("tcplb_accept_rate_limited_connections_total",
+			"Total number of new connections closed before their TLS handshake because the accept rate limit was exceeded.").With(),
+		unknownClients: r.Counter("tcplb_unknown_client_connections_total",
+			"Total number of connections of clients missing from the access control list granted default access.").With(),
+		certRollovers: r.Counter("tcplb_cert_rollover_connections_total",
+			"Total number of connections of clients presenting a rotated certificate granted the access of their previous one.").With(),
+		authorizationCache: r.Counter("tcplb_authorization_cache_lookups_total",
+			"Total number of authorization cache lookups of reconnecting clients by result.", "result"),
+	}
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/lib"
+)
+
+// maxPinDuration bounds the duration of a client pin so that a forgotten
+// pin does not keep a client off the balancing strategy.
+const maxPinDuration = 24 * time.Hour
+
+// ErrUnknownClientPin is returned when unpinning a client that is not pinned.
+var ErrUnknownClientPin = errors.New("unknown client pin")
+
+// ClientPin routes the new connections of a client to a designated backend
+// of a migration-capable pool for a limited time, overriding the balancing
+// strategy, e.g. to debug a client on a given backend or to move it to the
+// backend its data is migrated to. Connections fall back to the client's
+// allowed backends if the pinned backend is not available.
+type ClientPin struct {
+	// ClientID is the ID of the pinned client.
+	ClientID string `json:"client_id"`
+
+	// Pool is the pool of the backend.
+	Pool string `json:"pool"`
+
+	// Backend is the address of the backend.
+	Backend string `json:"backend"`
+
+	// ExpiresAt is the time the pin ends.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// PinClient pins the client to the backend of a migration-capable pool for
+// the given duration, at most maxPinDuration, replacing a previous pin of
+// the client. Active connections of the client are not affected.
+func (s *Server) PinClient(clientID, pool, backend string, duration time.Duration) (ClientPin, error) {
+	if clientID == "" || pool == "" || backend == "" {
+		return ClientPin{}, errors.New("client ID, pool and backend are required")
+	}
+	if _, ok := s.config.MigrationPools[pool]; !ok {
+		return ClientPin{}, fmt.Errorf("pool '%s' is not migration-capable", pool)
+	}
+	if duration <= 0 || duration > maxPinDuration {
+		return ClientPin{}, fmt.Errorf("pin duration must be positive and at most %s", maxPinDuration)
+	}
+	if s.pinnedBackend(pool, backend) == nil {
+		return ClientPin{}, fmt.Errorf("backend '%s' is not registered in pool '%s'", backend, pool)
+	}
+
+	pin := ClientPin{
+		ClientID:  clientID,
+		Pool:      pool,
+		Backend:   backend,
+		ExpiresAt: time.Now().Add(duration),
+	}
+
+	s.pinMu.Lock()
+	defer s.pinMu.Unlock()
+
+	s.pins[clientID] = pin
+	s.logger.Infof("Pinned client %s to backend %s of pool %s until %s",
+		clientID, backend, pool, pin.ExpiresAt.Format(time.RFC3339))
+	return pin, nil
+}
+
+// UnpinClient ends the pin of the client before it expires.
+func (s *Server) UnpinClient(clientID string) error {
+	s.pinMu.Lock()
+	defer s.pinMu.Unlock()
+
+	if _, ok := s.pins[clientID]; !ok {
+		return fmt.Errorf("%w '%s'", ErrUnknownClientPin, clientID)
+	}
+	delete(s.pins, clientID)
+	s.logger.Infof("Unpinned client %s", clientID)
+	return nil
+}
+
+// ClientPins returns the active client pins sorted by expiry.
+func (s *Server) ClientPins() []ClientPin {
+	s.pinMu.Lock()
+	defer s.pinMu.Unlock()
+
+	s.prunePins()
+	pins := make([]ClientPin, 0, len(s.pins))
+	for _, pin := range s.pins {
+		pins = append(pins, pin)
+	}
+	sort.Slice(pins, func(i, j int) bool {
+		return pins[i].ExpiresAt.Before(pins[j].ExpiresAt)
+	})
+	return pins
+}
+
+// clientPin returns the active pin of the client, if any.
+func (s *Server) clientPin(clientID string) (ClientPin, bool) {
+	s.pinMu.Lock()
+	defer s.pinMu.Unlock()
+
+	if len(s.pins) == 0 {
+		return ClientPin{}, false
+	}
+	s.prunePins()
+	pin, ok := s.pins[clientID]
+	return pin, ok
+}
+
+// prunePins removes the expired pins. The caller must hold pinMu.
+func (s *Server) prunePins() {
+	now := time.Now()
+	for clientID, pin := range s.pins {
+		if now.After(pin.ExpiresAt) {
+			delete(s.pins, clientID)
+			s.logger.Infof("Pin of client %s to backend %s expired", clientID, pin.Backend)
+		}
+	}
+}
+
+// pinnedBackend returns the registered backend of the pool with the
+// address, nil if there is none.
+func (s *Server) pinnedBackend(pool, address string) *lib.Backend {
+	for _, backend := range s.config.LoadBalancer.Backends() {
+		if backend.Pool == pool && backend.Address == address {
+			return backend
+		}
+	}
+	return nil
+}
+
+// pinnedSet returns the allowed backends set of the pin, allowing its
+// backend only in its pool, as the address may be registered in other
+// pools as well.
+func (s *Server) pinnedSet(pin ClientPin) map[string]struct{} {
+	set := map[string]struct{}{pin.Backend: {}}
+	for _, backend := range s.config.LoadBalancer.Backends() {
+		if backend.Address == pin.Backend && backend.Pool != pin.Pool {
+			set[lib.DenyKey(lib.PoolKey(backend.Pool))] = struct{}{}
+		}
+	}
+	return set
+}
+
+// pinBackends returns the allowed backend sets of a pinned client, trying
+// the pinned backend first if an allowed set allows it, along with the
+// pin. The allowed backend sets are returned unchanged otherwise, which
+// is logged for the connection with the ID, if not empty.
+func (s *Server) pinBackends(connectionID, clientID string, allowedBackends []map[string]struct{}) ([]map[string]struct{}, *ClientPin) {
+	pin, ok := s.clientPin(clientID)
+	if !ok {
+		return allowedBackends, nil
+	}
+	backend := s.pinnedBackend(pin.Pool, pin.Backend)
+	if backend == nil {
+		return allowedBackends, nil
+	}
+	for _, allowed := range allowedBackends {
+		if !backend.AllowedBy(allowed) {
+			continue
+		}
+		pinned := make([]map[string]struct{}, 0, len(allowedBackends)+1)
+		pinned = append(pinned, s.pinnedSet(pin))
+		return append(pinned, allowedBackends...), &pin
+	}
+	if connectionID != "" {
+		s.logger.Warnf("[conn %s] Client %s is pinned to backend %s of pool %s it is not allowed to access", connectionID, clientID, pin.Backend, pin.Pool)
+	}
+	return allowedBackends, nil
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/lib"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPinClient(t *testing.T) {
+	require := require.New(t)
+
+	pki := newTestPKI(t)
+	pinned := pki.client(t, "pinned")
+	other := pki.client(t, "other")
+	lb := lib.NewLoadBalancer(100, 100)
+	first := &lib.Backend{Address: startEchoBackend(t), Pool: "api"}
+	second := &lib.Backend{Address: startEchoBackend(t), Pool: "api"}
+	web := &lib.Backend{Address: startEchoBackend(t), Pool: "web"}
+	lb.AddBackend(first)
+	lb.AddBackend(second)
+	lb.AddBackend(web)
+	s := startTestServer(t, pki, &ServerConfig{
+		LoadBalancer:         lb,
+		ClientBackendEntries: map[string][]string{pinned.id: {"pool:api"}, other.id: {"pool:api"}},
+		MigrationPools:       map[string]struct{}{"api": {}},
+	})
+
+	_, err := s.PinClient(pinned.id, "web", web.Address, time.Minute)
+	require.ErrorContains(err, "pool 'web' is not migration-capable")
+	_, err = s.PinClient(pinned.id, "api", web.Address, time.Minute)
+	require.ErrorContains(err, "is not registered in pool 'api'")
+	_, err = s.PinClient(pinned.id, "api", second.Address, 25*time.Hour)
+	require.ErrorContains(err, "pin duration must be positive and at most 24h0m0s")
+
+	// New connections of the pinned client all go to the pinned backend,
+	// overriding the balancing strategy
+	pin, err := s.PinClient(pinned.id, "api", second.Address, time.Minute)
+	require.NoError(err)
+	require.Equal([]ClientPin{pin}, s.ClientPins())
+	for i := 0; i < 3; i++ {
+		connectClient(t, pki, s, pinned)
+	}
+	require.Equal(int64(0), first.ConnectionCount())
+	require.Equal(int64(3), second.ConnectionCount())
+
+	// Other clients are balanced as usual
+	connectClient(t, pki, s, other)
+	require.Equal(int64(1), first.ConnectionCount())
+
+	// Once unpinned, the client is balanced again
+	require.NoError(s.UnpinClient(pinned.id))
+	require.ErrorIs(s.UnpinClient(pinned.id), ErrUnknownClientPin)
+	connectClient(t, pki, s, pinned)
+	require.Equal(int64(2), first.ConnectionCount())
+	require.Equal(int64(3), second.ConnectionCount())
+}
+
+func TestPinClientFallback(t *testing.T) {
+	require := require.New(t)
+
+	pki := newTestPKI(t)
+	client := pki.client(t, "client")
+	lb := lib.NewLoadBalancer(100, 100)
+	allowed := &lib.Backend{Address: startEchoBackend(t), Pool: "api"}
+	denied := &lib.Backend{Address: startEchoBackend(t), Pool: "batch"}
+	lb.AddBackend(allowed)
+	lb.AddBackend(denied)
+	s := startTestServer(t, pki, &ServerConfig{
+		LoadBalancer:         lb,
+		ClientBackendEntries: map[string][]string{client.id: {"pool:api"}},
+		MigrationPools:       map[string]struct{}{"batch": {}},
+	})
+
+	// A pin to a backend the client is not allowed to access is ignored
+	_, err := s.PinClient(client.id, "batch", denied.Address, time.Minute)
+	require.NoError(err)
+	connectClient(t, pki, s, client)
+	require.Equal(int64(1), allowed.ConnectionCount())
+	require.Equal(int64(0), denied.ConnectionCount())
+
+	// Expired pins are pruned
+	_, err = s.PinClient(client.id, "batch", denied.Address, time.Millisecond)
+	require.NoError(err)
+	waitFor(t, func() bool { return len(s.ClientPins()) == 0 }, "Expected the pin to expire")
+}
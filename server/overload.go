@@ -0,0 +1,50 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/rrasulzade/tcp-lb-go/health"
+	"github.com/rrasulzade/tcp-lb-go/overload"
+)
+
+// newOverloadDetector creates the detector shedding new connections when
+// the listener bound to the address is overloaded, or returns nil if
+// shedding is disabled.
+func newOverloadDetector(address string, config *overload.Config) (*overload.Detector, error) {
+	if config == nil {
+		return nil, nil
+	}
+	_, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid listener address %s: %w", address, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid listener port %s: %w", portStr, err)
+	}
+	return overload.NewDetector(*config, port)
+}
+
+// shedConnection reports whether a new connection is closed right away,
+// before its TLS handshake, because the listener is overloaded.
+func (s *Server) shedConnection() bool {
+	if s.overload == nil || !s.overload.Shed() {
+		return false
+	}
+	s.metrics.shed.Inc()
+	return true
+}
+
+// checkOverload reports the listener as degraded while new connections
+// are shed.
+func (s *Server) checkOverload() (health.Status, string) {
+	signals := s.overload.Signals()
+	message := fmt.Sprintf("overload score %.2f (accept queue %.2f, handshakes %.2f, CPU %.2f)",
+		signals.Score(), signals.AcceptQueue, signals.Handshakes, signals.CPU)
+	if signals.Score() >= s.config.Overload.Threshold {
+		return health.StatusDegraded, message + ", shedding new connections"
+	}
+	return health.StatusOK, message
+}
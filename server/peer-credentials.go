@@ -0,0 +1,60 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/rrasulzade/tcp-lb-go/listen"
+)
+
+// PeerCredentials are the credentials of the process connected to a Unix
+// socket, read with SO_PEERCRED when the connection is established.
+type PeerCredentials struct {
+	// UID is the user ID of the process.
+	UID uint32
+
+	// GID is the group ID of the process.
+	GID uint32
+
+	// PID is the process ID.
+	PID int32
+}
+
+// ClientIDs returns the client IDs of the peer's identities, from the
+// most to the least specific: "pid:<pid>", "uid:<uid>" and "gid:<gid>".
+func (c PeerCredentials) ClientIDs() []string {
+	return []string{
+		"pid:" + strconv.FormatInt(int64(c.PID), 10),
+		"uid:" + strconv.FormatUint(uint64(c.UID), 10),
+		"gid:" + strconv.FormatUint(uint64(c.GID), 10),
+	}
+}
+
+// identifyPeer returns the client ID of a client connected over a Unix
+// socket by its peer credentials: the first of its identities listed in
+// the access control list, see PeerCredentials.ClientIDs, or its UID if
+// none is, so that unknown clients are reported by UID.
+func (s *Server) identifyPeer(clientConn net.Conn) (string, error) {
+	creds, err := peerCredentials(clientConn)
+	if err != nil {
+		return "", fmt.Errorf("unable to read peer credentials: %w", err)
+	}
+	clientIDs := creds.ClientIDs()
+	tiers := s.acl.Load().tiers
+	for _, clientID := range clientIDs {
+		if _, ok := tiers[clientID]; ok {
+			return clientID, nil
+		}
+	}
+	return clientIDs[1], nil
+}
+
+// listenPeers creates a plain listener of the server on a Unix socket,
+// whose clients are identified by their peer credentials.
+func (s *Server) listenPeers(network, address string, options listen.SocketOptions) (net.Listener, error) {
+	if network != "unix" {
+		return nil, fmt.Errorf("peer credentials are only available on Unix sockets, not on %s", network)
+	}
+	return listen.ListenNetwork(network, address, s.config.ListenRetry, options)
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// peerCredentials returns the credentials of the process connected to
+// the Unix socket connection, read with SO_PEERCRED.
+func peerCredentials(conn net.Conn) (PeerCredentials, error) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return PeerCredentials{}, errors.New("connection does not expose its socket")
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return PeerCredentials{}, err
+	}
+	var cred *syscall.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return PeerCredentials{}, err
+	}
+	if credErr != nil {
+		return PeerCredentials{}, credErr
+	}
+	return PeerCredentials{UID: cred.Uid, GID: cred.Gid, PID: cred.Pid}, nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package server
+
+import (
+	"errors"
+	"net"
+)
+
+// peerCredentials returns the credentials of the process connected to
+// the Unix socket connection. Reading them is only supported on Linux.
+func peerCredentials(conn net.Conn) (PeerCredentials, error) {
+	return PeerCredentials{}, errors.New("peer credentials are only supported on Linux")
+}
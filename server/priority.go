@@ -0,0 +1,127 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// ErrConnectionLimitReached is returned when the global connection
+// limit is reached and no lower-priority connection can be preempted.
+var ErrConnectionLimitReached = errors.New("global connection limit reached")
+
+// activityConn wraps a net.Conn and records the time of its last read or write.
+type activityConn struct {
+	net.Conn
+
+	// lastActivity is the UnixNano timestamp of the last read or write.
+	lastActivity atomic.Int64
+}
+
+// newActivityConn wraps the provided connection.
+func newActivityConn(conn net.Conn) *activityConn {
+	ac := &activityConn{Conn: conn}
+	ac.lastActivity.Store(time.Now().UnixNano())
+	return ac
+}
+
+// Read reads data from the connection and records the activity.
+func (ac *activityConn) Read(b []byte) (int, error) {
+	n, err := ac.Conn.Read(b)
+	if n > 0 {
+		ac.lastActivity.Store(time.Now().UnixNano())
+	}
+	return n, err
+}
+
+// Write writes data to the connection and records the activity.
+func (ac *activityConn) Write(b []byte) (int, error) {
+	n, err := ac.Conn.Write(b)
+	if n > 0 {
+		ac.lastActivity.Store(time.Now().UnixNano())
+	}
+	return n, err
+}
+
+// CloseWrite half-closes the underlying connection if supported.
+func (ac *activityConn) CloseWrite() error {
+	if cw, ok := ac.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// idleFor returns the time elapsed since the last read or write.
+func (ac *activityConn) idleFor() time.Duration {
+	return time.Since(time.Unix(0, ac.lastActivity.Load()))
+}
+
+// admitConnection enforces the global connection limit for an authorized
+// connection with the given priority. When the limit is reached and
+// preemption is enabled, the lowest-priority connection that has been
+// idle for long enough and has a strictly lower priority is closed to
+// make room. Returns the connection wrapped for activity tracking.
+func (s *Server) admitConnection(conn net.Conn, priority int) (net.Conn, error) {
+	tracked := newActivityConn(conn)
+
+	s.connsMu.Lock()
+	info, ok := s.conns[conn]
+	if !ok {
+		s.connsMu.Unlock()
+		return tracked, nil
+	}
+	info.Priority = priority
+	info.activity = tracked
+
+	if s.config.MaxConnections <= 0 || s.admitted < s.config.MaxConnections {
+		info.admitted = true
+		s.admitted++
+		s.connsMu.Unlock()
+		return tracked, nil
+	}
+
+	victimConn, victim := s.preemptionCandidate(priority)
+	if victim == nil {
+		s.connsMu.Unlock()
+		return nil, ErrConnectionLimitReached
+	}
+
+	// Hand the victim's slot over to the new connection
+	victim.admitted = false
+	info.admitted = true
+	s.connsMu.Unlock()
+
+	victimConn.Close()
+	s.metrics.preempted.Inc()
+	return tracked, nil
+}
+
+// preemptionCandidate returns the admitted connection with the lowest
+// priority, below the given one, that has been idle for at least the
+// configured preemption threshold. Ties are broken by the longest idle
+// time. The caller must hold connsMu.
+func (s *Server) preemptionCandidate(priority int) (net.Conn, *ConnectionInfo) {
+	if s.config.PreemptIdleAfter <= 0 {
+		return nil, nil
+	}
+
+	var victimConn net.Conn
+	var victim *ConnectionInfo
+	var victimIdle time.Duration
+	for conn, info := range s.conns {
+		if !info.admitted || info.Priority >= priority {
+			continue
+		}
+		idle := info.activity.idleFor()
+		if idle < s.config.PreemptIdleAfter {
+			continue
+		}
+		if victim == nil ||
+			info.Priority < victim.Priority ||
+			(info.Priority == victim.Priority && idle > victimIdle) {
+			victimConn, victim, victimIdle = conn, info, idle
+		}
+	}
+	return victimConn, victim
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/lib"
+	"github.com/stretchr/testify/require"
+)
+
+// admittedConnections returns the number of connections counting
+// against the global connection limit.
+func (s *Server) admittedConnections() int {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+
+	return s.admitted
+}
+
+func TestConnectionLimit(t *testing.T) {
+	require := require.New(t)
+
+	pki := newTestPKI(t)
+	first := pki.client(t, "first")
+	second := pki.client(t, "second")
+	lb := lib.NewLoadBalancer(100, 100)
+	lb.AddBackend(&lib.Backend{Address: startEchoBackend(t)})
+	s := startTestServer(t, pki, &ServerConfig{
+		LoadBalancer:         lb,
+		ClientBackendEntries: aclFor(lb, first, second),
+		MaxConnections:       1,
+	})
+
+	connectClient(t, pki, s, first)
+
+	// The limit is reached, without preemption
+	conn, err := pki.dial(s, second)
+	require.NoError(err)
+	defer conn.Close()
+	require.Error(echo(conn), "Expected the connection to be rejected")
+	waitFor(t, func() bool { return s.activeConnections() == 1 }, "Expected the rejected connection to be untracked")
+	require.Equal(1, s.admittedConnections())
+}
+
+func TestConnectionPreemption(t *testing.T) {
+	pki := newTestPKI(t)
+	low := pki.client(t, "low")
+	high := pki.client(t, "high")
+	peer := pki.client(t, "peer")
+	lb := lib.NewLoadBalancer(100, 100)
+	lb.AddBackend(&lib.Backend{Address: startEchoBackend(t)})
+	newServer := func(t *testing.T) *Server {
+		return startTestServer(t, pki, &ServerConfig{
+			LoadBalancer:         lb,
+			ClientBackendEntries: aclFor(lb, low, high, peer),
+			MaxConnections:       1,
+			PreemptIdleAfter:     50 * time.Millisecond,
+			ClientPriorities:     map[string]int{low.id: 0, high.id: 10, peer.id: 10},
+		})
+	}
+
+	t.Run("Preempt idle lower priority", func(t *testing.T) {
+		require := require.New(t)
+		s := newServer(t)
+
+		victim := connectClient(t, pki, s, low)
+		time.Sleep(60 * time.Millisecond)
+
+		// The idle lower-priority connection is closed to admit the newcomer
+		connectClient(t, pki, s, high)
+		require.Error(echo(victim), "Expected the idle connection to be preempted")
+		waitFor(t, func() bool { return s.activeConnections() == 1 }, "Expected the preempted connection to be untracked")
+
+		// The newcomer took over the slot of the victim
+		require.Equal(1, s.admittedConnections())
+	})
+
+	t.Run("Keep active lower priority", func(t *testing.T) {
+		require := require.New(t)
+		s := newServer(t)
+
+		active := connectClient(t, pki, s, low)
+
+		// The lower-priority connection has not been idle for long enough
+		conn, err := pki.dial(s, high)
+		require.NoError(err)
+		defer conn.Close()
+		require.Error(echo(conn), "Expected the connection to be rejected")
+		require.NoError(echo(active))
+	})
+
+	t.Run("Never preempt equal or higher priority", func(t *testing.T) {
+		require := require.New(t)
+		s := newServer(t)
+
+		established := connectClient(t, pki, s, high)
+		time.Sleep(60 * time.Millisecond)
+
+		// Neither a client with the same priority nor a lower one preempts
+		for _, client := range []testClient{peer, low} {
+			conn, err := pki.dial(s, client)
+			require.NoError(err)
+			require.Error(echo(conn), "Expected the connection to be rejected")
+			conn.Close()
+		}
+		require.NoError(echo(established))
+		require.Equal(1, s.admittedConnections())
+	})
+}
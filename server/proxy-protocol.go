@@ -0,0 +1,110 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rrasulzade/tcp-lb-go/fingerprint"
+	"github.com/rrasulzade/tcp-lb-go/proxyproto"
+)
+
+// ErrProxyLoop is returned when a connection's PROXY protocol header shows
+// that it already went through this load balancer.
+var ErrProxyLoop = errors.New("proxy loop detected")
+
+// proxyListener wraps accepted connections to read the PROXY protocol
+// header sent by a load balancer in front.
+type proxyListener struct {
+	net.Listener
+
+	// instanceID is the ID of this load balancer in loop detection TLVs.
+	instanceID []byte
+}
+
+// Accept implements net.Listener.
+func (l proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyConn{Conn: conn, instanceID: l.instanceID}, nil
+}
+
+// proxyConn reads a PROXY protocol v2 header before any other byte, so
+// that the header is consumed by the TLS handshake's first read rather
+// than by the accept loop.
+type proxyConn struct {
+	net.Conn
+
+	// instanceID is the ID of this load balancer in loop detection TLVs.
+	instanceID []byte
+
+	// once ensures the header is read once.
+	once sync.Once
+
+	// header is the header read, nil until then.
+	header atomic.Pointer[proxyproto.Header]
+
+	// err is the error reading the header.
+	err error
+}
+
+// Read implements net.Conn, reading the header on the first call.
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.Conn.Read(b)
+}
+
+// readHeader reads the header and verifies the connection did not go
+// through this load balancer already.
+func (c *proxyConn) readHeader() {
+	header, err := proxyproto.ReadHeaderV2(c.Conn)
+	if err != nil {
+		c.err = err
+		return
+	}
+	if path, ok := header.TLV(proxyproto.TypeLoopDetection); ok && c.instanceID != nil &&
+		proxyproto.LoopDetected(path, c.instanceID) {
+		c.err = ErrProxyLoop
+		return
+	}
+	c.header.Store(header)
+}
+
+// RemoteAddr implements net.Conn, returning the original client's address
+// once the header was read.
+func (c *proxyConn) RemoteAddr() net.Addr {
+	if header := c.header.Load(); header != nil && header.Source != nil {
+		return header.Source
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// proxyPath returns the instance IDs of the load balancers the client
+// connection went through, as listed in the loop detection TLV of its
+// PROXY protocol header, or nil if none.
+func proxyPath(clientConn net.Conn) []byte {
+	conn := clientConn
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	if fingerprintConn, ok := conn.(*fingerprint.Conn); ok {
+		conn = fingerprintConn.Conn
+	}
+	pc, ok := conn.(*proxyConn)
+	if !ok {
+		return nil
+	}
+	header := pc.header.Load()
+	if header == nil {
+		return nil
+	}
+	path, _ := header.TLV(proxyproto.TypeLoopDetection)
+	return path
+}
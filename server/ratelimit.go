@@ -0,0 +1,61 @@
+package server
+
+import (
+	"crypto/tls"
+	"net"
+	"strings"
+)
+
+// RateLimitKeyPart is a connection attribute the rate limiting key is built from.
+type RateLimitKeyPart string
+
+// define supported rate limiting key parts.
+const (
+	// RateLimitByClientID limits each client certificate individually.
+	RateLimitByClientID RateLimitKeyPart = "client_id"
+
+	// RateLimitBySourceIP limits each source IP address.
+	RateLimitBySourceIP RateLimitKeyPart = "source_ip"
+
+	// RateLimitBySNI limits each TLS server name requested by clients.
+	RateLimitBySNI RateLimitKeyPart = "sni"
+
+	// RateLimitByTenant limits each value of the client's "tenant" tag.
+	RateLimitByTenant RateLimitKeyPart = "tenant"
+)
+
+// tenantTag is the client tag identifying the client's tenant.
+const tenantTag = "tenant"
+
+// rateLimitKey builds the key the connection is rate limited by from the
+// parts, the client ID if empty. A part without a value, e.g. a client without a
+// tenant tag, falls back to the client ID so that unidentified clients
+// are still limited individually rather than sharing a bucket.
+func rateLimitKey(parts []RateLimitKeyPart, clientConn net.Conn, clientID string, tags map[string]string) string {
+	if len(parts) == 0 {
+		return clientID
+	}
+
+	values := make([]string, len(parts))
+	for i, part := range parts {
+		var value string
+		switch part {
+		case RateLimitByClientID:
+			value = clientID
+		case RateLimitBySourceIP:
+			value, _, _ = net.SplitHostPort(clientConn.RemoteAddr().String())
+		case RateLimitBySNI:
+			if tlsConn, ok := clientConn.(*tls.Conn); ok {
+				value = tlsConn.ConnectionState().ServerName
+			}
+		case RateLimitByTenant:
+			value = tags[tenantTag]
+		}
+
+		if value == "" {
+			part, value = RateLimitByClientID, clientID
+		}
+		values[i] = string(part) + "=" + value
+	}
+	return strings.Join(values, "|")
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/lib"
+)
+
+// stormCheckInterval is the interval at which the connection rates of
+// clients are compared to their baseline.
+const stormCheckInterval = 5 * time.Second
+
+// ReconnectStormConfig defines when a client is in a reconnect storm,
+// e.g. after a buggy release makes it reconnect in a loop.
+type ReconnectStormConfig struct {
+	// Multiplier is the factor by which the connection rate of a client
+	// over the last minute must exceed its baseline, its rate over the
+	// last hour, for a storm to begin. The storm ends once the rate falls
+	// back under the baseline of when it began times the factor.
+	Multiplier float64
+
+	// MinRate is the connections per second below which a client is
+	// never in a storm, so that clients without a baseline yet, or
+	// connecting rarely, are not reported.
+	MinRate float64
+
+	// Limit, if not zero, is the connections per second a client in a
+	// storm is limited to until the storm ends, on top of the rate
+	// limiter. Connections above it are rejected as rate limited.
+	Limit uint64
+}
+
+// reconnectStorm is a reconnect storm in progress.
+type reconnectStorm struct {
+	// since is the time the storm was detected.
+	since time.Time
+
+	// baseline is the connections per second of the client over the last
+	// hour when the storm began.
+	baseline float64
+
+	// limiter limits the connections of the client during the storm.
+	// Nil if they are not limited.
+	limiter *lib.TokenBucket
+}
+
+// detectReconnectStorms compares the connection rates of clients to their
+// baseline until ctx is done.
+func (s *Server) detectReconnectStorms(ctx context.Context) {
+	ticker := time.NewTicker(stormCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.checkReconnectStorms(time.Now())
+		}
+	}
+}
+
+// checkReconnectStorms begins and ends the reconnect storms of clients
+// from their current connection rates.
+func (s *Server) checkReconnectStorms(now time.Time) {
+	config := s.config.ReconnectStorms
+	for clientID, stats := range s.clientRates.Stats() {
+		s.stormsMu.RLock()
+		storm, storming := s.storms[clientID]
+		s.stormsMu.RUnlock()
+
+		baseline := stats.Rate1h
+		if storming {
+			baseline = storm.baseline
+		}
+		above := stats.Rate1m >= config.MinRate && stats.Rate1m > baseline*config.Multiplier
+		if above == storming {
+			continue
+		}
+
+		commonName, _ := s.clientName(clientID)
+		if above {
+			storm = &reconnectStorm{since: now, baseline: baseline}
+			if config.Limit > 0 {
+				storm.limiter = lib.NewTokenBucket(config.Limit, config.Limit, nil)
+			}
+			s.stormsMu.Lock()
+			s.storms[clientID] = storm
+			s.stormsMu.Unlock()
+			s.metrics.reconnectStorms.With(commonName).Inc()
+			s.metrics.reconnectStorming.With(commonName).Set(1)
+			s.logger.Warnf("Client %s (CN=%s) is in a reconnect storm: %.1f connections/s over the last minute, baseline %.2f/s",
+				clientID, commonName, stats.Rate1m, baseline)
+			continue
+		}
+
+		s.stormsMu.Lock()
+		delete(s.storms, clientID)
+		s.stormsMu.Unlock()
+		s.metrics.reconnectStorming.With(commonName).Set(0)
+		s.logger.Infof("Reconnect storm of client %s (CN=%s) ended after %s: %.1f connections/s over the last minute",
+			clientID, commonName, now.Sub(storm.since).Round(time.Second), stats.Rate1m)
+	}
+}
+
+// allowDuringStorm reports whether a new connection of the client is
+// allowed by the limit of its reconnect storm, if any.
+func (s *Server) allowDuringStorm(clientID string) bool {
+	if s.config.ReconnectStorms == nil {
+		return true
+	}
+	s.stormsMu.RLock()
+	storm, storming := s.storms[clientID]
+	s.stormsMu.RUnlock()
+	return !storming || storm.limiter == nil || storm.limiter.Allow()
+}
+
+// reconnectStormSince returns the time the reconnect storm of the client
+// began, nil if it is not in one.
+func (s *Server) reconnectStormSince(clientID string) *time.Time {
+	s.stormsMu.RLock()
+	defer s.stormsMu.RUnlock()
+
+	storm, storming := s.storms[clientID]
+	if !storming {
+		return nil
+	}
+	since := storm.since
+	return &since
+}
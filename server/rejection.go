@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/lib"
+)
+
+// RejectReason identifies why a client connection was rejected.
+type RejectReason string
+
+// define rejection reasons.
+const (
+	RejectUnauthorized       RejectReason = "unauthorized"
+	RejectRateLimited        RejectReason = "rate_limited"
+	RejectNoBackend          RejectReason = "no_backend"
+	RejectOverloaded         RejectReason = "overloaded"
+	RejectBackendUnreachable RejectReason = "backend_unreachable"
+	RejectMaintenance        RejectReason = "maintenance"
+	RejectFiltered           RejectReason = "filtered"
+)
+
+// rejectionWriteTimeout bounds the time spent writing a rejection response
+// so that a slow client cannot hold the connection open.
+const rejectionWriteTimeout = time.Second
+
+// classifyRouteError maps a load balancer routing error to a rejection reason.
+// Returns false if the error does not correspond to a rejection.
+func classifyRouteError(err error) (RejectReason, bool) {
+	switch {
+	case errors.Is(err, lib.ErrRateLimitReached):
+		return RejectRateLimited, true
+	case errors.Is(err, lib.ErrNoRegisteredBackends),
+		errors.Is(err, lib.ErrNoAvailableBackend):
+		return RejectNoBackend, true
+	case errors.Is(err, lib.ErrBackendsAtCapacity),
+		errors.Is(err, lib.ErrQueueFull),
+		errors.Is(err, lib.ErrQueueTimeout):
+		return RejectOverloaded, true
+	case errors.Is(err, lib.ErrBackendUnreachable):
+		return RejectBackendUnreachable, true
+	case errors.Is(err, lib.ErrPoolMaintenance):
+		return RejectMaintenance, true
+	}
+	return "", false
+}
+
+// sendRejection records the rejection and writes the configured response
+// for the given reason to the client before the connection is closed.
+// Nothing is written if no response is configured or the TLS handshake
+// has not completed.
+func (s *Server) sendRejection(ctx context.Context, clientConn net.Conn, reason RejectReason) {
+	s.sendRejectionResponse(ctx, clientConn, reason, s.config.RejectionResponses[reason])
+}
+
+// sendRouteRejection is sendRejection for a load balancer routing error.
+// Clients of a pool in maintenance receive the pool's message, if any,
+// instead of the configured response.
+func (s *Server) sendRouteRejection(ctx context.Context, clientConn net.Conn, reason RejectReason, err error) {
+	response := s.config.RejectionResponses[reason]
+	var maintenanceErr *lib.MaintenanceError
+	if errors.As(err, &maintenanceErr) && len(maintenanceErr.Message) > 0 {
+		response = maintenanceErr.Message
+	}
+	s.sendRejectionResponse(ctx, clientConn, reason, response)
+}
+
+// sendRejectionResponse records the rejection and writes the response to
+// the client. Nothing is written if the response is empty or the TLS
+// handshake has not completed.
+func (s *Server) sendRejectionResponse(ctx context.Context, clientConn net.Conn, reason RejectReason, response []byte) {
+	s.metrics.rejected.With(string(reason)).Inc()
+
+	if len(response) == 0 {
+		return
+	}
+
+	// Writing to a TLS connection without a completed handshake would
+	// trigger a new handshake attempt
+	if tlsConn, ok := clientConn.(*tls.Conn); ok && !tlsConn.ConnectionState().HandshakeComplete {
+		return
+	}
+
+	clientConn.SetWriteDeadline(time.Now().Add(rejectionWriteTimeout))
+	if _, err := clientConn.Write(response); err != nil {
+		s.logger.Debugf("[conn %s] Unable to send %s rejection response to %s: %v",
+			lib.ConnectionIDFromContext(ctx), reason, clientConn.RemoteAddr(), err)
+	}
+}
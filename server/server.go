@@ -1,19 +1,26 @@
 package server
 
 import (
+	"context"
 	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"log"
+	"maps"
 	"net"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/rrasulzade/tcp-lb-go/accesslog"
 	"github.com/rrasulzade/tcp-lb-go/lib"
+	"github.com/rrasulzade/tcp-lb-go/listen"
+	"github.com/rrasulzade/tcp-lb-go/logging"
+	"github.com/rrasulzade/tcp-lb-go/metrics"
+	"github.com/rrasulzade/tcp-lb-go/overload"
 )
 
 // ServerConfig encapsulates the configuration parameters required
@@ -29,10 +36,176 @@ type ServerConfig struct {
 	TLSConfig *tls.Config
 
 	// AllowedClients is a map of clients that are allowed to connect.
+	// Keys may be exact common names, wildcard patterns or regular
+	// expressions, see lib.CommonNameMatcher.
 	AllowedClients map[string]bool
 
-	// ClientBackendACL defines the access control list for clients and backends.
+	// ClientBackendACL defines the access control list for clients and backends,
+	// mapping a client ID to a single set of allowed backends. It is only
+	// used if ClientBackendEntries is nil.
+	//
+	// Deprecated: ClientBackendACL does not support ordered fallback
+	// between backend sets; use ClientBackendEntries.
 	ClientBackendACL map[string]map[string]struct{}
+
+	// ClientBackendEntries defines the access control list for clients and
+	// backends, mapping a client ID to its canonical entries. It is compiled
+	// into an ordered list of allowed backend sets per client, see
+	// BuildClientBackendACL, and may be replaced at runtime with
+	// SetClientBackendACL.
+	ClientBackendEntries map[string][]string
+
+	// AnonymousBackends are the ordered allowed backend sets of clients
+	// presenting no certificate, which requires the TLS configuration to
+	// not require one. Such clients are denied if nil.
+	AnonymousBackends []map[string]struct{}
+
+	// UnknownClientBackends are the ordered allowed backend sets of
+	// authenticated clients missing from the access control list, e.g.
+	// when a certificate was issued before the client's entry was added.
+	// Such clients are denied if nil.
+	UnknownClientBackends []map[string]struct{}
+
+	// AuthorizationCacheTTL is the time for which the allowed backend sets
+	// of a client are reused when it reconnects with the same certificate,
+	// skipping the access control list lookup. Cached authorizations are
+	// discarded when the access control list is replaced. Zero disables
+	// the cache.
+	AuthorizationCacheTTL time.Duration
+
+	// CertRolloverWindow is the grace window, from the issuance of its
+	// certificate, during which a client presenting a rotated certificate,
+	// whose CommonName was last authorized with another client ID, is
+	// granted the access of that client ID while the access control list
+	// does not list the new one. Zero disables the tolerance.
+	CertRolloverWindow time.Duration
+
+	// ClientTags maps a client ID to the tags (e.g. tenant, environment,
+	// priority) attached to its connections.
+	ClientTags map[string]map[string]string
+
+	// RateLimitKey lists the connection attributes the rate limiter is
+	// keyed on, combined into a composite key. Defaults to the client ID.
+	RateLimitKey []RateLimitKeyPart
+
+	// HashBySourceIP keys consistent hashing on the client's IP address
+	// instead of its client ID, see lib.BalanceConsistentHash.
+	HashBySourceIP bool
+
+	// MaxConnections is the global limit of authorized connections.
+	// Zero means unlimited.
+	MaxConnections int
+
+	// PreemptIdleAfter is the idle time after which a connection may be
+	// closed to admit a higher-priority client when MaxConnections is
+	// reached. Zero disables preemption.
+	PreemptIdleAfter time.Duration
+
+	// ClientPriorities maps a client ID to its priority class.
+	// Higher values take precedence; unlisted clients have priority 0.
+	ClientPriorities map[string]int
+
+	// MaxConcurrentHandshakes is the number of TLS handshakes performed
+	// at the same time; further connections wait for their handshake.
+	// Zero means unlimited.
+	MaxConcurrentHandshakes int
+
+	// AcceptProxyProtocol reads a PROXY protocol v2 header sent by a load
+	// balancer in front before the TLS handshake of every connection, and
+	// takes the client's address from it.
+	AcceptProxyProtocol bool
+
+	// Sidecar runs the server as a per-pod egress sidecar: listeners must
+	// be Unix sockets or loopback addresses, and are plain rather than
+	// TLS. Clients connected over a Unix socket are identified by the UID
+	// of their process, e.g. "uid:1000", and authorized by the access
+	// control list; clients connected over TCP are anonymous. TLSConfig,
+	// AcceptProxyProtocol and Fingerprinting are not used.
+	Sidecar bool
+
+	// InstanceID is the ID of this load balancer in loop detection TLVs,
+	// see lib.WithLoopDetection. With AcceptProxyProtocol, connections
+	// whose header lists the ID are rejected as a proxy loop.
+	InstanceID []byte
+
+	// AcceptRate is the number of new connections accepted per second,
+	// whatever the client. Connections above the rate are closed right
+	// after being accepted, before any per-client logic. Zero disables
+	// the limit.
+	AcceptRate uint64
+
+	// AcceptBurst is the number of connections accepted at once before
+	// AcceptRate applies. Defaults to AcceptRate.
+	AcceptBurst uint64
+
+	// AcceptFilter is called with every accepted connection before its
+	// TLS handshake to reject or annotate it. Optional.
+	AcceptFilter AcceptFilter
+
+	// ReconnectStorms defines when a client is in a reconnect storm, which
+	// is logged and counted, and optionally limited. Storms are not
+	// detected if nil.
+	ReconnectStorms *ReconnectStormConfig
+
+	// Overload defines when a share of new connections is closed right
+	// after being accepted, to protect the established ones during
+	// traffic spikes. Shedding is disabled if nil.
+	Overload *overload.Config
+
+	// Metrics records the server metrics, e.g. in a metrics.Registry
+	// through metrics.FromRegistry. If nil, metrics are discarded.
+	Metrics metrics.Metrics
+
+	// RejectionResponses maps a rejection reason to the bytes
+	// sent to the client before the connection is closed.
+	RejectionResponses map[RejectReason][]byte
+
+	// ListenRetry defines how binding an address in use is retried.
+	ListenRetry listen.Retry
+
+	// SocketOptions tune the socket of the main listener, e.g. its
+	// backlog.
+	SocketOptions listen.SocketOptions
+
+	// Listeners are additional listeners, e.g. on Unix sockets, each
+	// routing its connections to its own pools.
+	Listeners []Listener
+
+	// Timeouts bounds the phases of the connections, e.g. the TLS
+	// handshake.
+	Timeouts Timeouts
+
+	// CaptureDir is the directory debug sessions record the data of
+	// their connections in. Capturing is disabled if empty.
+	CaptureDir string
+
+	// Fingerprinting enables computing the JA3 and JA4 fingerprints
+	// of the clients' TLS ClientHello.
+	Fingerprinting bool
+
+	// AllowedFingerprints, if not empty, lists the only JA3 or JA4
+	// fingerprints of clients that are allowed to connect.
+	AllowedFingerprints map[string]struct{}
+
+	// DeniedFingerprints lists JA3 or JA4 fingerprints of clients
+	// that are rejected, e.g. those of known scanners.
+	DeniedFingerprints map[string]struct{}
+
+	// MigrationPools lists the pools whose backends clients may be
+	// pinned to, see Server.PinClient.
+	MigrationPools map[string]struct{}
+
+	// AccessLog, if not nil, records every connection forwarded to the
+	// load balancer once it is closed.
+	AccessLog *accesslog.Log
+
+	// Logger logs the events of the server, e.g. through the embedder's
+	// slog handler. Defaults to logging.Default.
+	Logger *logging.Logger
+
+	// LogSampling, if not nil, rate limits the identical warnings logged
+	// for connections, e.g. their errors, summarizing the suppressed ones.
+	LogSampling *logging.SamplingConfig
 }
 
 // Server represents the main structure for the load balancer server.
@@ -43,15 +216,125 @@ type Server struct {
 	// config is configuration object that holds all the server settings.
 	config *ServerConfig
 
+	// timeouts are the configured timeouts, with their defaults applied.
+	timeouts Timeouts
+
+	// allowedClients matches client common names against AllowedClients
+	// and the clients allowed with AllowClient.
+	allowedClients atomic.Pointer[lib.CommonNameMatcher]
+
+	// allowedEntries are the allowed clients entries compiled in
+	// allowedClients. Guarded by mu.
+	allowedEntries map[string]bool
+
 	// listener accepts incoming connections.
 	listener net.Listener
 
+	// listeners accept incoming connections of the additional listeners.
+	listeners []net.Listener
+
 	// shutdown is an atomic boolean to signal server shutdown.
 	shutdown atomic.Bool
 
+	// draining is set once a drain began, reporting the server as not ready.
+	draining atomic.Bool
+
 	// done is a WaitGroup to wait for goroutines to finish.
 	wg sync.WaitGroup
 
+	// ctx is canceled to abort active transfers on forced shutdown,
+	// and to stop background tasks once the server stopped.
+	ctx context.Context
+
+	// cancel cancels ctx.
+	cancel context.CancelFunc
+
+	// connsMu ensures concurrent access to the conns map.
+	connsMu sync.Mutex
+
+	// conns maps active client connections to their details.
+	conns map[net.Conn]*ConnectionInfo
+
+	// admitted is the number of connections counting
+	// against the global connection limit.
+	admitted int
+
+	// metrics holds the metrics recorded by the server.
+	metrics *serverMetrics
+
+	// logger logs the events of the server.
+	logger *logging.Logger
+
+	// sampler rate limits the warnings logged for connections. Nil if
+	// they are not sampled.
+	sampler *logging.Sampler
+
+	// probeMu ensures concurrent access to the probes map.
+	probeMu sync.Mutex
+
+	// probes maps the local address of a health probe connection
+	// to a channel closed when the accept loop picks it up.
+	probes map[string]chan struct{}
+
+	// debugMu ensures concurrent access to the debugSessions map.
+	debugMu sync.Mutex
+
+	// debugSessions maps a debug session ID to the session.
+	debugSessions map[string]DebugSession
+
+	// pinMu ensures concurrent access to the pins map.
+	pinMu sync.Mutex
+
+	// pins maps a client ID to the backend it is pinned to.
+	pins map[string]ClientPin
+
+	// clientRates tracks the connection rates per client ID.
+	clientRates *lib.RateTracker
+
+	// clientsMu ensures concurrent access to clients.
+	clientsMu sync.RWMutex
+
+	// clients maps a client ID to its CommonName and connection counter.
+	clients map[string]knownClient
+
+	// stormsMu ensures concurrent access to storms.
+	stormsMu sync.RWMutex
+
+	// storms maps a client ID to its reconnect storm in progress.
+	storms map[string]*reconnectStorm
+
+	// aclMu serializes replacements of the access control list and
+	// guards aclSnapshots.
+	aclMu sync.Mutex
+
+	// aclSnapshots are the lists replaced by imports, newest last.
+	aclSnapshots []ACLSnapshot
+
+	// acl is the access control list in effect.
+	acl atomic.Pointer[clientACL]
+
+	// authorizations caches the authorization of recently connected
+	// clients. Nil if disabled.
+	authorizations *authorizationCache
+
+	// rollover tolerates rotated client certificates. Nil if disabled.
+	rollover *certRollover
+
+	// acceptLimiter limits the rate of accepted connections. Nil if
+	// the rate is not limited.
+	acceptLimiter *lib.TokenBucket
+
+	// overload decides which new connections are shed, if enabled.
+	overload *overload.Detector
+
+	// shedPercent is the percentage of new connections shed regardless
+	// of overload, see SetShedPercent.
+	shedPercent atomic.Int64
+
+	// handshakeSlots holds a value per TLS handshake in progress,
+	// bounded by MaxConcurrentHandshakes. Nil if unlimited.
+	handshakeSlots chan struct{}
+
 	// connection is a channel to handle incoming connections.
 	connection chan net.Conn
 }
@@ -68,85 +351,318 @@ func NewServer(config *ServerConfig) (*Server, error) {
 		return nil, errors.New("load balancer instance is required")
 	}
 
-	// Check if the provided TLS configuration is valid
-	if config.TLSConfig == nil {
+	// Check if the provided TLS configuration is valid, unless clients
+	// are identified without TLS in sidecar mode
+	if config.TLSConfig == nil && !config.Sidecar {
 		return nil, errors.New("TLS configuration is required")
 	}
-	if len(config.AllowedClients) == 0 {
+	if len(config.AllowedClients) == 0 && !config.Sidecar {
 		return nil, errors.New("allowed clients list configuration is required")
 	}
-	if len(config.ClientBackendACL) == 0 {
+	if len(config.ClientBackendEntries) == 0 && len(config.ClientBackendACL) == 0 {
 		return nil, errors.New("access control list configuration is required")
 	}
+	allowedClients, err := lib.NewCommonNameMatcher(config.AllowedClients)
+	if err != nil {
+		return nil, err
+	}
+
+	overloadDetector, err := newOverloadDetector(config.Address, config.Overload)
+	if err != nil {
+		return nil, err
+	}
+
+	registry := config.Metrics
+	if registry == nil {
+		registry = metrics.Nop
+	}
 
-	return &Server{
-		config:     config,
-		connection: make(chan net.Conn),
-	}, nil
+	logger := config.Logger
+	if logger == nil {
+		logger = logging.Default()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := &Server{
+		ctx:            ctx,
+		cancel:         cancel,
+		config:         config,
+		timeouts:       config.Timeouts.withDefaults(),
+		allowedEntries: maps.Clone(config.AllowedClients),
+		connection:     make(chan net.Conn),
+		conns:          make(map[net.Conn]*ConnectionInfo),
+		metrics:        newServerMetrics(registry),
+		logger:         logger,
+		probes:         make(map[string]chan struct{}),
+		debugSessions:  make(map[string]DebugSession),
+		pins:           make(map[string]ClientPin),
+		clientRates:    lib.NewRateTracker(),
+		clients:        make(map[string]knownClient),
+		storms:         make(map[string]*reconnectStorm),
+		acceptLimiter:  newAcceptLimiter(config.AcceptRate, config.AcceptBurst),
+		overload:       overloadDetector,
+		authorizations: newAuthorizationCache(config.AuthorizationCacheTTL),
+		rollover:       newCertRollover(config.CertRolloverWindow, logger),
+	}
+	if config.MaxConcurrentHandshakes > 0 {
+		s.handshakeSlots = make(chan struct{}, config.MaxConcurrentHandshakes)
+	}
+	if config.LogSampling != nil {
+		s.sampler = logging.NewSampler(logger, *config.LogSampling)
+	}
+	s.allowedClients.Store(allowedClients)
+	if config.ClientBackendEntries != nil {
+		s.acl.Store(newClientACL(config.ClientBackendEntries))
+	} else {
+		s.acl.Store(legacyClientACL(config.ClientBackendACL))
+	}
+	return s, nil
 }
 
-// acceptConnections listens and accepts incoming requests.
-// TODO: add custom logger that supports log levels for debugging
-func (s *Server) acceptConnections() {
+// acceptConnections accepts incoming requests on the listener bound to
+// the address, handling them with the policy of the listener.
+func (s *Server) acceptConnections(listener net.Listener, address string, policy *listenerPolicy) {
 	defer s.wg.Done()
 
-	log.Printf("Server is listening on %s\n", s.config.Address)
+	s.logger.Infof("Server is listening on %s", address)
 
-	// TODO: add retryLimit and retryDelay settings to the config structure
+	// TODO: add a retryLimit setting to the config structure
 	retryLimit := 5
-	retryDelay := time.Second
+	retryDelay := s.timeouts.AcceptRetry
 
 	retryCount := 0
 	for !s.shutdown.Load() {
-		conn, err := s.listener.Accept()
+		conn, err := listener.Accept()
 		if err != nil {
+			// The listener was closed by Stop
+			if s.shutdown.Load() {
+				return
+			}
 			if retryCount < retryLimit {
 				retryCount++
-				log.Printf("Error accepting connection: %v\n", err)
+				s.logger.Errorf("Error accepting connection: %v", err)
 				time.Sleep(retryDelay)
 				continue
 			}
 			// TODO: replace with a proper notification or monitoring mechanism to notify maintainers
-			log.Fatalf("Exiting due to repeated errors: %v", err)
+			s.logger.Fatalf("Exiting due to repeated errors: %v", err)
 		}
 		// reset retry counter
 		retryCount = 0
+
+		// Health probes only verify that the accept loop is responsive
+		if s.isProbe(conn) {
+			conn.Close()
+			continue
+		}
+
+		// Limit the accept rate before any per-client logic, as a
+		// protection against connection floods
+		if s.acceptRateLimited() {
+			conn.Close()
+			continue
+		}
+
+		// Shed new connections before their TLS handshake while the
+		// listener is overloaded, leaving room for the established ones,
+		// or as requested through the admin API
+		if s.shedConnection() || s.shedRequested() {
+			conn.Close()
+			continue
+		}
+
 		s.wg.Add(1)
+		connectionID := s.trackConnection(conn)
 		go func() {
 			defer s.wg.Done()
-			err := s.handleConnection(conn)
+			defer s.untrackConnection(conn)
+			s.logger.Debugf("[conn %s] Accepted connection from %s", connectionID, conn.RemoteAddr())
+			err := s.handleConnection(conn, connectionID, policy)
 			if err != nil {
-				log.Printf("Error handling connection from %s: %v", conn.RemoteAddr(), err)
+				s.warnSampled(err.Error(), "[conn %s] Error handling connection from %s: %v", connectionID, conn.RemoteAddr(), err)
+				return
 			}
+			s.logger.Debugf("[conn %s] Connection from %s closed", connectionID, conn.RemoteAddr())
 		}()
 	}
 }
 
 // handleConnection handles incoming connections individually
-// by forwarding them to the selected backend server.
-// TODO: add custom logger that supports log levels for debugging
-func (s *Server) handleConnection(clientConn net.Conn) error {
+// by forwarding them to the selected backend server, as set by the
+// policy of the listener that accepted them.
+func (s *Server) handleConnection(clientConn net.Conn, connectionID string, policy *listenerPolicy) error {
 	defer clientConn.Close()
 
-	// Authenticate client connection using TLS
-	clientCert, err := AuthenticateClient(clientConn, s.config.AllowedClients)
+	// Propagate the connection ID to the load balancer
+	ctx := lib.WithConnectionID(s.ctx, connectionID)
+
+	// Let the embedder reject or annotate the connection
+	ctx, err := s.filterConnection(ctx, clientConn)
 	if err != nil {
-		return fmt.Errorf("TLS authentication failed for incoming connection: %w", err)
+		return err
+	}
+
+	// Identify the client by its certificate, or by the credentials of
+	// its process on Unix sockets authenticating peers and in sidecar mode
+	var clientID, commonName string
+	var clientCert *x509.Certificate
+	var anonymous bool
+	var fingerprints tlsFingerprints
+	switch {
+	case s.config.Sidecar:
+		clientID, anonymous, err = s.identifySidecarClient(clientConn)
+		if err != nil {
+			s.sendRejection(ctx, clientConn, RejectUnauthorized)
+			return err
+		}
+	case policy.peerCredentials:
+		clientID, err = s.identifyPeer(clientConn)
+		if err != nil {
+			s.sendRejection(ctx, clientConn, RejectUnauthorized)
+			return err
+		}
+	default:
+		clientID, clientCert, anonymous, fingerprints, err = s.authenticate(ctx, clientConn)
+		if err != nil {
+			return err
+		}
+		if clientCert != nil {
+			commonName = clientCert.Subject.CommonName
+		}
 	}
 
-	// Generate client ID based on the client's certificate details
-	clientID := GenerateClientID(clientCert.Subject.CommonName, clientCert.SerialNumber.String())
+	// Reject clients by the fingerprint of their TLS implementation
+	if err := s.checkFingerprints(fingerprints); err != nil {
+		s.sendRejection(ctx, clientConn, RejectUnauthorized)
+		return fmt.Errorf("client with CN=%s rejected: %w", commonName, err)
+	}
 
-	// Authorize the client to grant access
-	allowedBackends, err := AuthorizeClient(clientID, s.config.ClientBackendACL)
+	// Authorize the client to grant access. Clients presenting no
+	// certificate may only access the pools admitting them
+	allowedBackends := s.config.AnonymousBackends
+	if !anonymous {
+		var issuedAt time.Time
+		if clientCert != nil {
+			issuedAt = clientCert.NotBefore
+		}
+		allowedBackends, err = s.authorizeClient(connectionID, clientID, commonName, issuedAt)
+		if err != nil {
+			s.sendRejection(ctx, clientConn, RejectUnauthorized)
+			return fmt.Errorf("authorization denied for client with CN=%s err: %w", commonName, err)
+		}
+	}
+	if policy.pools != nil {
+		allowedBackends = restrictToPools(allowedBackends, policy.pools)
+	}
+
+	// Route the client to its pinned backend first if it is pinned
+	allowedBackends, pin := s.pinBackends(connectionID, clientID, allowedBackends)
+	if pin != nil {
+		s.logger.Debugf("[conn %s] client %s pinned to backend %s of pool %s", connectionID, clientID, pin.Backend, pin.Pool)
+	}
+
+	// Let the next load balancer in a chain detect proxy loops
+	if path := proxyPath(clientConn); path != nil {
+		ctx = lib.WithProxyPath(ctx, path)
+	}
+
+	// Track the client's connection rate and the lifetime of its
+	// connections. Anonymous clients are not tracked, as their IDs are
+	// as many as their source addresses
+	if !anonymous {
+		s.recordClientConnection(clientID, commonName)
+		defer s.recordClientClose(clientID, time.Now())
+
+		// Throttle the client while it is in a reconnect storm
+		if !s.allowDuringStorm(clientID) {
+			s.sendRejection(ctx, clientConn, RejectRateLimited)
+			return fmt.Errorf("client with CN=%s throttled during its reconnect storm: %w", commonName, lib.ErrRateLimitReached)
+		}
+	}
+
+	// Attach the client's tags to the connection
+	tags := s.config.ClientTags[clientID]
+	s.identifyConnection(clientConn, clientID, commonName, tags)
+
+	// Enforce the global connection limit based on the client's priority
+	trackedConn, err := s.admitConnection(clientConn, s.config.ClientPriorities[clientID])
 	if err != nil {
-		return fmt.Errorf("authorization denied for client with CN=%s err: %w", clientCert.Subject.CommonName, err)
+		s.sendRejection(ctx, clientConn, RejectOverloaded)
+		return err
+	}
+
+	// Count the transfer of the connection for the access log
+	var counted *countingConn
+	if s.config.AccessLog != nil {
+		counted = &countingConn{Conn: trackedConn}
+		trackedConn = counted
+	}
+
+	// Trace the connection in detail if its client is being debugged
+	if session, ok := s.debugSession(clientID, commonName); ok {
+		tracer := func(format string, args ...any) {
+			s.logger.Infof("[conn %s] [debug %s] "+format, append([]any{connectionID, session.ID}, args...)...)
+		}
+		tracer("client CN=%s id=%s from %s%s, tags %v, allowed backends %v",
+			commonName, clientID, clientConn.RemoteAddr(), fingerprints, tags, allowedBackends)
+		ctx = lib.WithTracer(ctx, tracer)
+
+		if counted == nil {
+			counted = &countingConn{Conn: trackedConn}
+			trackedConn = counted
+		}
+		start := time.Now()
+		defer func() {
+			tracer("connection closed after %s: %s", time.Since(start), counted)
+		}()
+
+		if session.Capture {
+			captured, closeCapture, err := s.startCapture(trackedConn, session, connectionID)
+			if err != nil {
+				tracer("%v", err)
+			} else {
+				trackedConn = captured
+				defer closeCapture()
+			}
+		}
+	}
+
+	// Describe the client to the backends of pools with metadata framing
+	ctx = lib.WithClientMetadata(ctx, lib.ClientMetadata{CommonName: commonName, Tags: tags})
+
+	// Rate limit the connection by the key of its listener
+	ctx = lib.WithRateLimitKey(ctx, rateLimitKey(policy.rateLimitKey, clientConn, clientID, tags))
+	if s.config.HashBySourceIP {
+		sourceIP, _, _ := net.SplitHostPort(clientConn.RemoteAddr().String())
+		ctx = lib.WithHashKey(ctx, sourceIP)
+	}
+
+	// Record the connection to the access log once it is closed
+	if s.config.AccessLog != nil {
+		var report lib.ConnectionReport
+		ctx = lib.WithConnectionReport(ctx, &report)
+		start := time.Now()
+		defer func() {
+			s.recordAccess(accesslog.Entry{
+				ConnectionID:  connectionID,
+				ClientID:      clientID,
+				CommonName:    commonName,
+				RemoteAddr:    clientConn.RemoteAddr().String(),
+				Duration:      time.Since(start),
+				BytesReceived: counted.bytesRead.Load(),
+				BytesSent:     counted.bytesWritten.Load(),
+			}, report, err)
+		}()
 	}
 
 	// Forward the connection to the appropriate backend server
-	err = s.config.LoadBalancer.RouteConnection(clientID, clientConn, allowedBackends)
+	err = s.config.LoadBalancer.RouteConnectionContext(ctx, clientID, trackedConn, allowedBackends...)
 	if err != nil {
-		return fmt.Errorf("unable to forward connection to backend server: %w", err)
+		if reason, ok := classifyRouteError(err); ok {
+			s.sendRouteRejection(ctx, clientConn, reason, err)
+		}
+		return fmt.Errorf("unable to forward connection to backend server (tags: %v): %w", tags, err)
 	}
 
 	return nil
@@ -156,24 +672,54 @@ func (s *Server) handleConnection(clientConn net.Conn) error {
 func (s *Server) Start() error {
 	var err error
 
-	s.listener, err = tls.Listen("tcp", s.config.Address, s.config.TLSConfig)
+	s.listener, err = s.listen("tcp", s.config.Address, s.config.SocketOptions)
 	if err != nil {
 		return fmt.Errorf("unable to initialize server TLS listener: %w", err)
 	}
+	if err := s.startListeners(); err != nil {
+		s.listener.Close()
+		return err
+	}
 
 	s.wg.Add(1)
-	go s.acceptConnections()
+	go s.acceptConnections(s.listener, s.config.Address, Listener{}.policy(s.config))
+
+	if s.overload != nil {
+		go s.overload.Run(s.ctx)
+	}
+	if s.config.ReconnectStorms != nil {
+		go s.detectReconnectStorms(s.ctx)
+	}
+	if s.sampler != nil {
+		go s.sampler.Run(s.ctx)
+	}
 
 	return nil
 }
 
 // Stop shuts down the load balancer server gracefully.
+// Active connections are given time to finish, after which the remaining
+// ones are force-closed, in which case an error is returned. Use
+// StopWithReport to get the outcome of the shutdown.
 func (s *Server) Stop() error {
+	_, err := s.StopWithReport()
+	return err
+}
+
+// StopWithReport is like Stop, but also returns a report describing the
+// outcome of the shutdown.
+func (s *Server) StopWithReport() (*ShutdownReport, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	start := time.Now()
 	s.shutdown.Store(true)
 	s.listener.Close()
+	s.closeListeners()
+
+	report := &ShutdownReport{
+		ActiveAtStart: s.activeConnections(),
+	}
 
 	done := make(chan struct{})
 	// Start a goroutine to wait for all active connections to finish
@@ -184,30 +730,120 @@ func (s *Server) Stop() error {
 
 	select {
 	case <-done:
-		return nil
-	case <-time.After(time.Second):
-		return errors.New("server shutdown timed out waiting for connections to close")
+		// Stop the background tasks, no transfer is left to abort
+		s.cancel()
+		report.Drained = report.ActiveAtStart
+		report.RemainingByBackend = s.remainingByBackend()
+		report.Duration = time.Since(start)
+		return report, nil
+	case <-time.After(s.timeouts.Shutdown):
 	}
 
+	// Force-close the connections that did not finish in time
+	report.RemainingByBackend = s.remainingByBackend()
+	s.cancel()
+	report.ForceClosed = s.closeConnections()
+	report.Drained = report.ActiveAtStart - report.ForceClosed
+
+	var err error
+	select {
+	case <-done:
+		err = fmt.Errorf("server shutdown timed out, force-closed %d connections", report.ForceClosed)
+	case <-time.After(forceCloseTimeout):
+		err = errors.New("server shutdown timed out waiting for force-closed connections to finish")
+	}
+	report.Duration = time.Since(start)
+	return report, err
 }
 
 // GenerateClientID creates a clientID by hashing the provided
 // CommonName and SerialNumber using SHA-256 alg
 func GenerateClientID(cn string, serialNumber string) string {
 	// Concatenate CN and serial number with a separator ':' in between
-	combined := fmt.Sprintf("%s:%s", cn, serialNumber)
+	var buf [clientIDBufferSize]byte
+	combined := append(append(append(buf[:0], cn...), ':'), serialNumber...)
+	return hashClientID(combined)
+}
+
+// clientIDBufferSize is the size of the stack buffer client IDs are
+// generated in, which fits the CommonName and serial number of most
+// certificates.
+const clientIDBufferSize = 192
+
+// certificateClientID returns the client ID of the certificate like
+// GenerateClientID, without allocating the decimal serial number, as it
+// is called for every connection.
+func certificateClientID(cert *x509.Certificate) string {
+	var buf [clientIDBufferSize]byte
+	combined := append(append(buf[:0], cert.Subject.CommonName...), ':')
+	if cert.SerialNumber.IsUint64() {
+		combined = strconv.AppendUint(combined, cert.SerialNumber.Uint64(), 10)
+	} else {
+		combined = cert.SerialNumber.Append(combined, 10)
+	}
+	return hashClientID(combined)
+}
+
+// hashClientID returns the hex-encoded SHA-256 hash of the CommonName and
+// serial number of a client, allocating only the returned string.
+func hashClientID(combined []byte) string {
+	hash := sha256.Sum256(combined)
+	var clientID [2 * sha256.Size]byte
+	hex.Encode(clientID[:], hash[:])
+	return string(clientID[:])
+}
+
+// authenticate performs the TLS handshake of the client connection and
+// returns the ID of the client, based on its certificate, or on its
+// address if it presented no certificate and anonymous clients are
+// admitted. The client is sent a rejection if it is not authenticated.
+func (s *Server) authenticate(ctx context.Context, clientConn net.Conn) (clientID string, clientCert *x509.Certificate, anonymous bool, fingerprints tlsFingerprints, err error) {
+	handshakeDone, ok := s.beginHandshake()
+	if !ok {
+		return "", nil, false, tlsFingerprints{}, errors.New("server stopped before the TLS handshake")
+	}
+	// Bound the handshake, including the PROXY protocol header read by it
+	if timeout := s.timeouts.TLSHandshake; timeout > 0 {
+		clientConn.SetDeadline(time.Now().Add(timeout))
+	}
+	clientCert, err = AuthenticateClientWith(clientConn, s.allowedClients.Load())
+	if s.timeouts.TLSHandshake > 0 {
+		clientConn.SetDeadline(time.Time{})
+	}
+	handshakeDone()
+	fingerprints = s.recordFingerprints(clientConn)
+	anonymous = errors.Is(err, ErrNoClientCertificate) && s.config.AnonymousBackends != nil
+	if err != nil && !anonymous {
+		s.sendRejection(ctx, clientConn, RejectUnauthorized)
+		return "", nil, false, fingerprints, fmt.Errorf("TLS authentication failed for incoming connection%s: %w", fingerprints, err)
+	}
 
-	// Generate a SHA-256 hash of the combined string
-	hash := sha256.Sum256([]byte(combined))
+	// Generate client ID based on the client's certificate details,
+	// or on its address if it presented no certificate
+	if anonymous {
+		return AnonymousClientID(clientConn), nil, true, fingerprints, nil
+	}
+	return certificateClientID(clientCert), clientCert, false, fingerprints, nil
+}
 
-	// Convert the hash to a string
-	clientID := hex.EncodeToString(hash[:])
+// ErrNoClientCertificate is returned when a client did not present a certificate.
+var ErrNoClientCertificate = errors.New("client did not provide a TLS certificate")
 
-	return clientID
+// AnonymousClientID returns the client ID of a client that presented no
+// certificate, based on its IP address.
+func AnonymousClientID(clientConn net.Conn) string {
+	host, _, err := net.SplitHostPort(clientConn.RemoteAddr().String())
+	if err != nil {
+		host = clientConn.RemoteAddr().String()
+	}
+	return "anonymous:" + host
 }
 
 // AuthorizeClient checks if the provided client is authorized to access backends.
 // Returns the list of allowed backends for the client.
+//
+// Deprecated: AuthorizeClient does not support ordered fallback between
+// backend sets; use AuthorizeClientTiers with BuildClientBackendACL.
 func AuthorizeClient(
 	clientID string,
 	clientBackendACL map[string]map[string]struct{},
@@ -219,6 +855,19 @@ func AuthorizeClient(
 	return allowedBackends, nil
 }
 
+// AuthorizeClientTiers checks if the provided client is authorized to access
+// backends. Returns the ordered list of allowed backend sets for the client.
+func AuthorizeClientTiers(
+	clientID string,
+	clientBackendACL map[string][]map[string]struct{},
+) ([]map[string]struct{}, error) {
+	allowedBackends, ok := clientBackendACL[clientID]
+	if !ok {
+		return nil, fmt.Errorf("client %s is not listed in the provided access control list", clientID)
+	}
+	return allowedBackends, nil
+}
+
 // GetTLSConnection ensures the connection is a TLS connection.
 func GetTLSConnection(clientConn net.Conn) (*tls.Conn, error) {
 	tlsConn, ok := clientConn.(*tls.Conn)
@@ -232,13 +881,14 @@ func GetTLSConnection(clientConn net.Conn) (*tls.Conn, error) {
 func GetClientCertificate(tlsConn *tls.Conn) (*x509.Certificate, error) {
 	clientCerts := tlsConn.ConnectionState().PeerCertificates
 	if len(clientCerts) == 0 {
-		return nil, fmt.Errorf("client did not provide a TLS certificate")
+		return nil, ErrNoClientCertificate
 	}
 	return clientCerts[0], nil
 }
 
 // ValidateCommonName checks if the CommonName (CN) from
-// the client's certificate is in the allowed list.
+// the client's certificate is in the allowed list, by exact name.
+// Use ValidateCommonNameWith to match wildcard and regex entries.
 func ValidateCommonName(clientCert *x509.Certificate, allowedClients map[string]bool) error {
 	clientCertCN := clientCert.Subject.CommonName
 	if clientCertCN == "" {
@@ -251,9 +901,76 @@ func ValidateCommonName(clientCert *x509.Certificate, allowedClients map[string]
 	return nil
 }
 
-// AuthenticateClient verifies the client's certificate CN.
-// Returns client's verified certificate
+// ValidateCommonNameWith checks if the CommonName (CN) from
+// the client's certificate is allowed by the matcher.
+func ValidateCommonNameWith(clientCert *x509.Certificate, allowedClients *lib.CommonNameMatcher) error {
+	clientCertCN := clientCert.Subject.CommonName
+	if clientCertCN == "" {
+		return fmt.Errorf("client's TLS certificate lacks a CommonName")
+	}
+	isAllowed, entry := allowedClients.Allowed(clientCertCN)
+	if !isAllowed {
+		if entry != "" {
+			return fmt.Errorf("client with CommonName %s is denied by allowed clients entry %s", clientCertCN, entry)
+		}
+		return fmt.Errorf("client with CommonName %s is not allowed", clientCertCN)
+	}
+	return nil
+}
+
+// AllowClient adds the CommonName to the allowed clients at runtime, e.g.
+// for clients presenting a certificate issued by the development CA.
+// CommonNames denied by an allowed clients entry are not overridden.
+func (s *Server) AllowClient(commonName string) error {
+	if commonName == "" {
+		return errors.New("common name is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	allowed, entry := s.allowedClients.Load().Allowed(commonName)
+	if allowed {
+		return nil
+	}
+	if entry != "" {
+		return fmt.Errorf("client with CommonName %s is denied by allowed clients entry %s", commonName, entry)
+	}
+
+	entries := maps.Clone(s.allowedEntries)
+	if entries == nil {
+		entries = make(map[string]bool)
+	}
+	entries[commonName] = true
+	matcher, err := lib.NewCommonNameMatcher(entries)
+	if err != nil {
+		return err
+	}
+	s.allowedEntries = entries
+	s.allowedClients.Store(matcher)
+	s.logger.Infof("Client with CommonName %s is allowed", commonName)
+	return nil
+}
+
+// AuthenticateClient verifies the client's certificate CN, by exact name.
+// Returns client's verified certificate. Use AuthenticateClientWith to
+// match wildcard and regex entries.
 func AuthenticateClient(clientConn net.Conn, allowedClients map[string]bool) (*x509.Certificate, error) {
+	return authenticateClient(clientConn, func(clientCert *x509.Certificate) error {
+		return ValidateCommonName(clientCert, allowedClients)
+	})
+}
+
+// AuthenticateClientWith verifies the client's certificate CN against the
+// matcher. Returns client's verified certificate
+func AuthenticateClientWith(clientConn net.Conn, allowedClients *lib.CommonNameMatcher) (*x509.Certificate, error) {
+	return authenticateClient(clientConn, func(clientCert *x509.Certificate) error {
+		return ValidateCommonNameWith(clientCert, allowedClients)
+	})
+}
+
+// authenticateClient performs the TLS handshake of the client connection
+// and validates the CommonName of its certificate.
+func authenticateClient(clientConn net.Conn, validate func(*x509.Certificate) error) (*x509.Certificate, error) {
 	tlsConn, err := GetTLSConnection(clientConn)
 	if err != nil {
 		return nil, err
@@ -269,7 +986,7 @@ func AuthenticateClient(clientConn net.Conn, allowedClients map[string]bool) (*x
 		return nil, err
 	}
 
-	err = ValidateCommonName(clientCert, allowedClients)
+	err = validate(clientCert)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,347 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/lib"
+	"github.com/stretchr/testify/require"
+)
+
+// testPKI issues the server and client certificates of test servers.
+type testPKI struct {
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	pool   *x509.CertPool
+	server tls.Certificate
+	serial atomic.Int64
+}
+
+// testClient is a client certificate along with the client ID derived from it.
+type testClient struct {
+	cert tls.Certificate
+	id   string
+}
+
+// newTestPKI creates a CA and a server certificate for 127.0.0.1.
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	require := require.New(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(err)
+	ca, err := x509.ParseCertificate(der)
+	require.NoError(err)
+
+	p := &testPKI{ca: ca, caKey: key, pool: x509.NewCertPool()}
+	p.pool.AddCert(ca)
+	p.serial.Store(1)
+	p.server = p.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	return p
+}
+
+// issue signs the template with the CA, with a new key and serial number.
+func (p *testPKI) issue(t *testing.T, template *x509.Certificate) tls.Certificate {
+	t.Helper()
+	require := require.New(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(err)
+	template.SerialNumber = big.NewInt(p.serial.Add(1))
+	template.NotBefore = time.Now().Add(-time.Minute)
+	template.NotAfter = time.Now().Add(time.Hour)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	der, err := x509.CreateCertificate(rand.Reader, template, p.ca, key.Public(), p.caKey)
+	require.NoError(err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// client issues a client certificate with the CommonName. Every call
+// issues a new certificate, and thus a new client ID.
+func (p *testPKI) client(t *testing.T, commonName string) testClient {
+	t.Helper()
+
+	cert := p.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: commonName},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return testClient{cert: cert, id: certificateClientID(cert.Leaf)}
+}
+
+// serverTLSConfig returns the TLS configuration of a test server
+// requiring client certificates.
+func (p *testPKI) serverTLSConfig() *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{p.server},
+		ClientCAs:    p.pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+}
+
+// startEchoBackend starts a backend echoing the data it receives.
+// Returns its address.
+func startEchoBackend(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// startTestServer starts a server on a random port with the config,
+// defaulting its address, TLS configuration, allowed clients and load
+// balancer, the latter with an echo backend. The server is stopped at the
+// end of the test.
+func startTestServer(t *testing.T, pki *testPKI, config *ServerConfig) *Server {
+	t.Helper()
+	require := require.New(t)
+
+	if config.Address == "" {
+		config.Address = "127.0.0.1:0"
+	}
+	if config.TLSConfig == nil {
+		config.TLSConfig = pki.serverTLSConfig()
+	}
+	if config.AllowedClients == nil {
+		config.AllowedClients = map[string]bool{lib.RegexPrefix + ".*": true}
+	}
+	if config.LoadBalancer == nil {
+		config.LoadBalancer = lib.NewLoadBalancer(100, 100)
+		config.LoadBalancer.AddBackend(&lib.Backend{Address: startEchoBackend(t)})
+	}
+
+	s, err := NewServer(config)
+	require.NoError(err)
+	require.NoError(s.Start())
+	t.Cleanup(func() { s.Stop() })
+	return s
+}
+
+// aclFor returns an access control list granting the clients access to
+// every backend of the server's load balancer.
+func aclFor(lb *lib.LoadBalancer, clients ...testClient) map[string][]string {
+	var entries []string
+	for _, backend := range lb.Backends() {
+		entries = append(entries, backend.Address)
+	}
+	acl := make(map[string][]string, len(clients))
+	for _, client := range clients {
+		acl[client.id] = entries
+	}
+	return acl
+}
+
+// dial connects the client to the server and completes the TLS handshake.
+func (p *testPKI) dial(s *Server, client testClient) (*tls.Conn, error) {
+	conn, err := tls.Dial("tcp", s.listener.Addr().String(), &tls.Config{
+		Certificates: []tls.Certificate{client.cert},
+		RootCAs:      p.pool,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// echo writes a message on the connection and reads it back, failing
+// if it is not echoed by the backend within a second.
+func echo(conn net.Conn) error {
+	conn.SetDeadline(time.Now().Add(time.Second))
+	defer conn.SetDeadline(time.Time{})
+
+	message := []byte("ping")
+	if _, err := conn.Write(message); err != nil {
+		return err
+	}
+	reply := make([]byte, len(message))
+	_, err := io.ReadFull(conn, reply)
+	return err
+}
+
+// connectClient dials the server and verifies that the client's
+// connection is routed to a backend.
+func connectClient(t *testing.T, pki *testPKI, s *Server, client testClient) *tls.Conn {
+	t.Helper()
+
+	conn, err := pki.dial(s, client)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	require.NoError(t, echo(conn))
+	return conn
+}
+
+// waitFor waits up to a second for the condition to be met.
+func waitFor(t *testing.T, condition func() bool, msg string) {
+	t.Helper()
+	require.Eventually(t, condition, time.Second, 5*time.Millisecond, msg)
+}
+
+func TestServerRoutesAuthorizedClients(t *testing.T) {
+	require := require.New(t)
+
+	pki := newTestPKI(t)
+	authorized := pki.client(t, "api")
+	unlisted := pki.client(t, "api")
+	lb := lib.NewLoadBalancer(100, 100)
+	lb.AddBackend(&lib.Backend{Address: startEchoBackend(t)})
+	s := startTestServer(t, pki, &ServerConfig{
+		LoadBalancer:         lb,
+		ClientBackendEntries: aclFor(lb, authorized),
+	})
+
+	connectClient(t, pki, s, authorized)
+
+	// A client missing from the access control list is disconnected
+	conn, err := pki.dial(s, unlisted)
+	require.NoError(err)
+	defer conn.Close()
+	require.Error(echo(conn))
+}
+
+func TestAnonymousClientsNotTracked(t *testing.T) {
+	require := require.New(t)
+
+	pki := newTestPKI(t)
+	client := pki.client(t, "api")
+	lb := lib.NewLoadBalancer(100, 100)
+	backend := startEchoBackend(t)
+	lb.AddBackend(&lib.Backend{Address: backend})
+	tlsConfig := pki.serverTLSConfig()
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	s := startTestServer(t, pki, &ServerConfig{
+		LoadBalancer:         lb,
+		TLSConfig:            tlsConfig,
+		ClientBackendEntries: aclFor(lb, client),
+		AnonymousBackends:    []map[string]struct{}{{backend: {}}},
+	})
+
+	// Clients presenting no certificate are routed without being tracked
+	// per source address
+	conn, err := pki.dial(s, testClient{})
+	require.NoError(err)
+	defer conn.Close()
+	require.NoError(echo(conn))
+	connectClient(t, pki, s, client)
+	rates := s.ClientRates()
+	require.Len(rates, 1)
+	require.Equal(client.id, rates[0].ClientID)
+	_, ok := s.clientName(AnonymousClientID(conn))
+	require.False(ok)
+}
+
+func TestLegacyClientBackendACL(t *testing.T) {
+	require := require.New(t)
+
+	pki := newTestPKI(t)
+	client := pki.client(t, "api")
+	lb := lib.NewLoadBalancer(100, 100)
+	backend := startEchoBackend(t)
+	lb.AddBackend(&lib.Backend{Address: backend, Pool: "api"})
+	s := startTestServer(t, pki, &ServerConfig{
+		LoadBalancer: lb,
+		ClientBackendACL: map[string]map[string]struct{}{
+			client.id: {lib.PoolKey("api"): {}, backend: {}},
+		},
+	})
+
+	// The former single set of allowed backends is kept as one set
+	connectClient(t, pki, s, client)
+	allowedBackends, err := s.authorizeClient("conn1", client.id, "api", time.Now())
+	require.NoError(err)
+	require.Equal([]map[string]struct{}{{lib.PoolKey("api"): {}, backend: {}}}, allowedBackends)
+	require.Equal(map[string][]string{client.id: {backend, lib.PoolKey("api")}}, s.ClientBackendACL())
+
+	// The entries take precedence
+	s = startTestServer(t, pki, &ServerConfig{
+		LoadBalancer:         lb,
+		ClientBackendACL:     map[string]map[string]struct{}{client.id: {backend: {}}},
+		ClientBackendEntries: map[string][]string{"other": {lib.PoolKey("api")}},
+	})
+	require.Equal(map[string][]string{"other": {lib.PoolKey("api")}}, s.ClientBackendACL())
+}
+
+func TestAuthorizeClient(t *testing.T) {
+	require := require.New(t)
+
+	allowed, err := AuthorizeClient("client1", map[string]map[string]struct{}{
+		"client1": {"127.0.0.1:5001": {}},
+	})
+	require.NoError(err)
+	require.Equal(map[string]struct{}{"127.0.0.1:5001": {}}, allowed)
+
+	tiers, err := AuthorizeClientTiers("client1", BuildClientBackendACL(map[string][]string{
+		"client1": {"pool:primary", "pool:secondary"},
+	}))
+	require.NoError(err)
+	require.Equal([]map[string]struct{}{{"pool:primary": {}}, {"pool:secondary": {}}}, tiers)
+
+	_, err = AuthorizeClientTiers("client2", nil)
+	require.ErrorContains(err, "client client2 is not listed")
+}
+
+func TestValidateCommonName(t *testing.T) {
+	require := require.New(t)
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "api.prod.example.com"}}
+
+	// Map entries are matched by exact name
+	require.NoError(ValidateCommonName(cert, map[string]bool{"api.prod.example.com": true}))
+	require.ErrorContains(ValidateCommonName(cert, map[string]bool{"*.prod.example.com": true}), "is not allowed")
+
+	matcher, err := lib.NewCommonNameMatcher(map[string]bool{
+		"*.prod.example.com":   true,
+		"api.prod.example.com": false,
+	})
+	require.NoError(err)
+	require.ErrorContains(ValidateCommonNameWith(cert, matcher), "denied by allowed clients entry api.prod.example.com")
+	cert.Subject.CommonName = "web.prod.example.com"
+	require.NoError(ValidateCommonNameWith(cert, matcher))
+
+	cert.Subject.CommonName = ""
+	require.ErrorContains(ValidateCommonNameWith(cert, matcher), "lacks a CommonName")
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"errors"
+	"math/rand"
+)
+
+// ErrInvalidShedPercent is returned when a shed percentage is outside of
+// [0, 100].
+var ErrInvalidShedPercent = errors.New("shed percent must be between 0 and 100")
+
+// SetShedPercent sets the percentage of new connections closed right
+// after being accepted, regardless of the overload of the listener, so
+// that external tooling can shed load more gradually than by draining.
+// Zero stops shedding.
+func (s *Server) SetShedPercent(percent int) error {
+	if percent < 0 || percent > 100 {
+		return ErrInvalidShedPercent
+	}
+	previous := s.shedPercent.Swap(int64(percent))
+	s.metrics.shedPercent.Set(int64(percent))
+	if int64(percent) != previous {
+		s.logger.Infof("Shedding %d%% of new connections (previously %d%%)", percent, previous)
+	}
+	return nil
+}
+
+// ShedPercent returns the percentage of new connections shed, see
+// SetShedPercent.
+func (s *Server) ShedPercent() int {
+	return int(s.shedPercent.Load())
+}
+
+// shedRequested reports whether a new connection is closed right away
+// because of the shed percentage.
+func (s *Server) shedRequested() bool {
+	percent := s.shedPercent.Load()
+	if percent <= 0 || rand.Int63n(100) >= percent {
+		return false
+	}
+	s.metrics.shedRequested.Inc()
+	return true
+}
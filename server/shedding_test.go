@@ -0,0 +1,78 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rrasulzade/tcp-lb-go/lib"
+	"github.com/rrasulzade/tcp-lb-go/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetShedPercent(t *testing.T) {
+	require := require.New(t)
+
+	pki := newTestPKI(t)
+	client := pki.client(t, "client")
+	lb := lib.NewLoadBalancer(100, 100)
+	lb.AddBackend(&lib.Backend{Address: startEchoBackend(t)})
+	registry := metrics.NewRegistry()
+	s := startTestServer(t, pki, &ServerConfig{
+		LoadBalancer:         lb,
+		ClientBackendEntries: aclFor(lb, client),
+		Metrics:              metrics.FromRegistry(registry),
+	})
+	exposed := func() string {
+		var buf bytes.Buffer
+		registry.Expose(&buf)
+		return buf.String()
+	}
+
+	require.ErrorIs(s.SetShedPercent(-1), ErrInvalidShedPercent)
+	require.ErrorIs(s.SetShedPercent(101), ErrInvalidShedPercent)
+	require.Zero(s.ShedPercent())
+	established := connectClient(t, pki, s, client)
+
+	// All new connections are shed, the established ones are not affected
+	require.NoError(s.SetShedPercent(100))
+	require.Equal(100, s.ShedPercent())
+	require.Contains(exposed(), "tcplb_shed_percent 100\n")
+	for i := 0; i < 3; i++ {
+		conn, err := pki.dial(s, client)
+		if err == nil {
+			require.Error(echo(conn), "Expected the connection to be shed")
+			conn.Close()
+		}
+	}
+	require.NoError(echo(established))
+	require.Contains(exposed(), "tcplb_requested_shed_connections_total 3\n")
+
+	// Zero stops shedding
+	require.NoError(s.SetShedPercent(0))
+	require.Contains(exposed(), "tcplb_shed_percent 0\n")
+	connectClient(t, pki, s, client)
+	require.Contains(exposed(), "tcplb_requested_shed_connections_total 3\n")
+}
+
+func TestShedRequested(t *testing.T) {
+	require := require.New(t)
+
+	s, err := NewServer(&ServerConfig{
+		Address:              "127.0.0.1:0",
+		LoadBalancer:         lib.NewLoadBalancer(100, 100),
+		TLSConfig:            newTestPKI(t).serverTLSConfig(),
+		AllowedClients:       map[string]bool{"api": true},
+		ClientBackendEntries: map[string][]string{"client": {"pool:api"}},
+	})
+	require.NoError(err)
+	require.NoError(s.SetShedPercent(50))
+
+	shed := 0
+	for i := 0; i < 1000; i++ {
+		if s.shedRequested() {
+			shed++
+		}
+	}
+	// The shed share is random, with a negligible chance of a false failure
+	require.InDelta(500, shed, 150)
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// forceCloseTimeout is the time Stop waits for connection
+// handlers to return after their connections were force-closed.
+const forceCloseTimeout = time.Second
+
+// ShutdownReport summarizes the outcome of a server shutdown
+// so that deploy tooling can verify that draining completed.
+type ShutdownReport struct {
+	// ActiveAtStart is the number of active connections when shutdown began.
+	ActiveAtStart int
+
+	// Drained is the number of connections that finished on their own.
+	Drained int
+
+	// ForceClosed is the number of connections closed after the drain timeout.
+	ForceClosed int
+
+	// Duration is the total time the shutdown took.
+	Duration time.Duration
+
+	// RemainingByBackend is the active connection count per backend
+	// at the end of the drain period, before any force-close.
+	RemainingByBackend map[string]int64
+}
+
+// String returns a single-line, human-readable summary of the report.
+func (r *ShutdownReport) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "active=%d drained=%d force_closed=%d duration=%s",
+		r.ActiveAtStart, r.Drained, r.ForceClosed, r.Duration)
+
+	// Sort addresses for a stable output
+	addresses := make([]string, 0, len(r.RemainingByBackend))
+	for address := range r.RemainingByBackend {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	for _, address := range addresses {
+		fmt.Fprintf(&sb, " backend[%s]=%d", address, r.RemainingByBackend[address])
+	}
+	return sb.String()
+}
+
+// remainingByBackend returns the active connection count per backend.
+func (s *Server) remainingByBackend() map[string]int64 {
+	backends := s.config.LoadBalancer.Backends()
+	remaining := make(map[string]int64, len(backends))
+	for _, backend := range backends {
+		remaining[backend.Address] = backend.ConnectionCount()
+	}
+	return remaining
+}
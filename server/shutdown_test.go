@@ -0,0 +1,69 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/lib"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStopReport(t *testing.T) {
+	require := require.New(t)
+
+	pki := newTestPKI(t)
+	client := pki.client(t, "api")
+	lb := lib.NewLoadBalancer(100, 100)
+	backend := startEchoBackend(t)
+	lb.AddBackend(&lib.Backend{Address: backend})
+	s := startTestServer(t, pki, &ServerConfig{
+		LoadBalancer:         lb,
+		ClientBackendEntries: aclFor(lb, client),
+	})
+
+	conn := connectClient(t, pki, s, client)
+	time.AfterFunc(50*time.Millisecond, func() { conn.Close() })
+
+	// The connection closed by the client is drained
+	report, err := s.StopWithReport()
+	require.NoError(err)
+	require.Equal(1, report.ActiveAtStart)
+	require.Equal(1, report.Drained)
+	require.Zero(report.ForceClosed)
+	require.Equal(map[string]int64{backend: 0}, report.RemainingByBackend)
+	require.GreaterOrEqual(report.Duration, 50*time.Millisecond)
+}
+
+func TestStopReportForceClosed(t *testing.T) {
+	require := require.New(t)
+
+	pki := newTestPKI(t)
+	client := pki.client(t, "api")
+	lb := lib.NewLoadBalancer(100, 100)
+	backend := startEchoBackend(t)
+	lb.AddBackend(&lib.Backend{Address: backend})
+	s := startTestServer(t, pki, &ServerConfig{
+		LoadBalancer:         lb,
+		ClientBackendEntries: aclFor(lb, client),
+		Timeouts:             Timeouts{Shutdown: 50 * time.Millisecond},
+	})
+
+	connectClient(t, pki, s, client)
+
+	// The connection still open at the timeout is force-closed, and
+	// reported as remaining on its backend
+	report, err := s.StopWithReport()
+	require.ErrorContains(err, "force-closed 1 connections")
+	require.Equal(1, report.ActiveAtStart)
+	require.Zero(report.Drained)
+	require.Equal(1, report.ForceClosed)
+	require.Equal(map[string]int64{backend: 1}, report.RemainingByBackend)
+	require.Equal("active=1 drained=0 force_closed=1 duration="+report.Duration.String()+" backend["+backend+"]=1", report.String())
+}
+
+func TestStop(t *testing.T) {
+	pki := newTestPKI(t)
+	s := startTestServer(t, pki, &ServerConfig{ClientBackendEntries: map[string][]string{"client": {"pool:default"}}})
+
+	require.NoError(t, s.Stop())
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/rrasulzade/tcp-lb-go/listen"
+)
+
+// identifySidecarClient returns the client ID of a connection accepted in
+// sidecar mode. Clients connected over a Unix socket are identified by
+// their peer credentials, see identifyPeer, while clients connected over
+// the loopback address are anonymous, only admitted if AnonymousBackends
+// is set.
+func (s *Server) identifySidecarClient(clientConn net.Conn) (clientID string, anonymous bool, err error) {
+	if _, ok := clientConn.LocalAddr().(*net.UnixAddr); !ok {
+		if s.config.AnonymousBackends == nil {
+			return "", false, errors.New("sidecar clients connected over TCP are not admitted")
+		}
+		return AnonymousClientID(clientConn), true, nil
+	}
+	clientID, err = s.identifyPeer(clientConn)
+	if err != nil {
+		return "", false, fmt.Errorf("unable to identify sidecar client: %w", err)
+	}
+	return clientID, false, nil
+}
+
+// listenSidecar creates a plain listener of the server in sidecar mode,
+// refusing addresses reachable from outside the host.
+func (s *Server) listenSidecar(network, address string, options listen.SocketOptions) (net.Listener, error) {
+	if !listen.IsLocal(network, address) {
+		return nil, fmt.Errorf("sidecar listener %s must be a Unix socket or a loopback address", address)
+	}
+	return listen.ListenNetwork(network, address, s.config.ListenRetry, options)
+}
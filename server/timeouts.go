@@ -0,0 +1,43 @@
+package server
+
+import (
+	"time"
+)
+
+// define the default timeouts of a server.
+const (
+	// DefaultAcceptRetryDelay is the default delay before accepting again
+	// after an accept error.
+	DefaultAcceptRetryDelay = time.Second
+
+	// DefaultShutdownTimeout is the default time Stop waits for active
+	// connections to finish before force-closing them.
+	DefaultShutdownTimeout = time.Second
+)
+
+// Timeouts bounds the phases of the connections handled by the server.
+// Zero values take their defaults, see withDefaults.
+type Timeouts struct {
+	// AcceptRetry is the delay before accepting again after an accept
+	// error. Defaults to DefaultAcceptRetryDelay.
+	AcceptRetry time.Duration
+
+	// TLSHandshake bounds the TLS handshake of a client connection,
+	// including reading its PROXY protocol header. Zero means no timeout.
+	TLSHandshake time.Duration
+
+	// Shutdown is the time Stop waits for active connections to finish
+	// before force-closing them. Defaults to DefaultShutdownTimeout.
+	Shutdown time.Duration
+}
+
+// withDefaults returns the timeouts with the unset ones defaulted.
+func (t Timeouts) withDefaults() Timeouts {
+	if t.AcceptRetry <= 0 {
+		t.AcceptRetry = DefaultAcceptRetryDelay
+	}
+	if t.Shutdown <= 0 {
+		t.Shutdown = DefaultShutdownTimeout
+	}
+	return t
+}
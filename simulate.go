@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rrasulzade/tcp-lb-go/lib"
+)
+
+// simulateOptions holds the settings of the simulate subcommand.
+type simulateOptions struct {
+	// trace is the path of a recorded trace to replay. A synthetic
+	// trace is generated if empty.
+	trace string
+
+	// synthetic defines the generated trace.
+	synthetic lib.SyntheticTrace
+
+	// backends are the simulated backends.
+	backends backendSpecs
+
+	// strategies are the balancing strategies to simulate.
+	strategies string
+
+	// json prints the reports as JSON instead of a table.
+	json bool
+}
+
+// backendSpecs is a repeatable flag of simulated backends given as
+// "latency[:capacity[:weight]]", e.g. "5ms:50:100".
+type backendSpecs []lib.SimulatedBackend
+
+// String implements flag.Value.
+func (s *backendSpecs) String() string {
+	return fmt.Sprint(len(*s), " backends")
+}
+
+// Set implements flag.Value.
+func (s *backendSpecs) Set(value string) error {
+	parts := strings.Split(value, ":")
+	if len(parts) > 3 {
+		return errors.New("backend must be latency[:capacity[:weight]]")
+	}
+	backend := lib.SimulatedBackend{Address: fmt.Sprintf("backend-%d", len(*s))}
+	var err error
+	if backend.Latency, err = time.ParseDuration(parts[0]); err != nil || backend.Latency < 0 {
+		return fmt.Errorf("invalid backend latency '%s'", parts[0])
+	}
+	if len(parts) > 1 {
+		if backend.Capacity, err = strconv.Atoi(parts[1]); err != nil || backend.Capacity < 0 {
+			return fmt.Errorf("invalid backend capacity '%s'", parts[1])
+		}
+	}
+	if len(parts) > 2 {
+		if backend.Weight, err = strconv.Atoi(parts[2]); err != nil || backend.Weight <= 0 || backend.Weight > lib.MaxWeight {
+			return fmt.Errorf("invalid backend weight '%s'", parts[2])
+		}
+	}
+	*s = append(*s, backend)
+	return nil
+}
+
+// simulatedStrategies lists the balancing strategies the simulate
+// subcommand compares by default.
+var simulatedStrategies = []lib.BalancingStrategy{
+	lib.BalanceLeastConnections,
+	lib.BalanceConsistentHash,
+	lib.BalanceLeastLatency,
+}
+
+// runSimulate runs the simulate subcommand, which replays a synthetic or
+// recorded trace of connection arrivals against each balancing strategy
+// offline and reports the fairness of the load distribution and the tail
+// latencies:
+//
+//	tcp-lb-go simulate [-trace trace.jsonl] [-backend 5ms:50] [-strategies least_connections,least_latency]
+func runSimulate(args []string) error {
+	var opts simulateOptions
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	flags.StringVar(&opts.trace, "trace", "", "Recorded trace of newline-delimited JSON arrivals; a synthetic trace is generated if empty")
+	flags.IntVar(&opts.synthetic.Connections, "connections", 10000, "Number of connections of the synthetic trace")
+	flags.Float64Var(&opts.synthetic.Rate, "rate", 500, "Connections per second of the synthetic trace")
+	flags.DurationVar(&opts.synthetic.MeanDuration, "mean-duration", time.Second, "Mean connection duration of the synthetic trace")
+	flags.IntVar(&opts.synthetic.Clients, "clients", 100, "Number of clients of the synthetic trace")
+	flags.Int64Var(&opts.synthetic.Seed, "seed", 1, "Seed of the synthetic trace")
+	flags.Var(&opts.backends, "backend", "Simulated backend as latency[:capacity[:weight]], repeatable; defaults to 4 backends of 10ms:100")
+	flags.StringVar(&opts.strategies, "strategies", "", "Comma-separated balancing strategies to simulate; defaults to all")
+	flags.BoolVar(&opts.json, "json", false, "Print the reports as JSON")
+	flags.Parse(args)
+
+	arrivals, err := simulationArrivals(opts)
+	if err != nil {
+		return err
+	}
+	backends := opts.backends
+	if len(backends) == 0 {
+		for i := 0; i < 4; i++ {
+			backends.Set("10ms:100")
+		}
+	}
+	strategies := simulatedStrategies
+	if opts.strategies != "" {
+		strategies = nil
+		for _, name := range strings.Split(opts.strategies, ",") {
+			strategy := lib.BalancingStrategy(strings.TrimSpace(name))
+			if !slices.Contains(simulatedStrategies, strategy) {
+				return fmt.Errorf("unknown balancing strategy '%s'", strategy)
+			}
+			strategies = append(strategies, strategy)
+		}
+	}
+
+	reports := make([]*lib.SimulationReport, 0, len(strategies))
+	for _, strategy := range strategies {
+		report, err := lib.Simulate(strategy, backends, arrivals)
+		if err != nil {
+			return err
+		}
+		reports = append(reports, report)
+	}
+
+	if opts.json {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(reports)
+	}
+	fmt.Printf("Simulated %d connections against %d backends\n\n", len(arrivals), len(backends))
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "STRATEGY\tREJECTED\tFAIRNESS\tIMBALANCE\tP50\tP95\tP99\tMAX\tCONNECTIONS PER BACKEND")
+	for _, report := range reports {
+		connections := make([]string, len(report.Backends))
+		for i, backend := range report.Backends {
+			connections[i] = strconv.Itoa(backend.Connections)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%.3f\t%.2f\t%s\t%s\t%s\t%s\t%s\n",
+			report.Strategy, report.Rejected, report.Fairness, report.Imbalance,
+			report.LatencyP50.Round(time.Microsecond), report.LatencyP95.Round(time.Microsecond),
+			report.LatencyP99.Round(time.Microsecond), report.LatencyMax.Round(time.Microsecond),
+			strings.Join(connections, " "))
+	}
+	return w.Flush()
+}
+
+// simulationArrivals reads the recorded trace or generates the synthetic one.
+func simulationArrivals(opts simulateOptions) ([]lib.Arrival, error) {
+	if opts.trace == "" {
+		if opts.synthetic.Connections <= 0 || opts.synthetic.Rate <= 0 || opts.synthetic.MeanDuration <= 0 {
+			return nil, errors.New("synthetic trace connections, rate and mean duration must be positive")
+		}
+		return opts.synthetic.Arrivals(), nil
+	}
+
+	f, err := os.Open(opts.trace)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open trace: %w", err)
+	}
+	defer f.Close()
+	return lib.ReadArrivals(f)
+}